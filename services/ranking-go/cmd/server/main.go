@@ -1,17 +1,271 @@
 package main
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"google.golang.org/grpc"
 
 	"ranking-go/internal/api"
+	"ranking-go/internal/auth"
+	"ranking-go/internal/config"
+	"ranking-go/internal/export"
+	"ranking-go/internal/health"
+	"ranking-go/internal/kafka"
+	"ranking-go/internal/rank"
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+	"ranking-go/internal/tracing"
 )
 
 func main() {
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		os.Exit(2)
+	}
+	level, _ := cfg.Level()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	var tenants *tenant.Registry
+	if cfg.TenantsFile != "" {
+		if tenants, err = tenant.LoadFile(cfg.TenantsFile); err != nil {
+			fatal("tenants", err)
+		}
+	}
+
+	st := openStore(cfg.Store)
+	srv := api.NewServer(st, tenants)
+	srv.Settings = &cfg
+	srv.Exports = exportTargets(cfg.Exports)
+	srv.AdminToken = cfg.AdminToken
+	srv.Webhook.Secret = cfg.Webhook.Secret
+	srv.Webhook.Allow = cfg.Webhook.Allow
+	srv.Auth = api.Auth{Required: cfg.Auth.Required, ServiceKeys: cfg.Auth.ServiceKeys}
+	if cfg.Auth.JWKSURL != "" {
+		srv.Auth.JWT = &auth.JWTVerifier{
+			JWKSURL:     cfg.Auth.JWKSURL,
+			Issuer:      cfg.Auth.Issuer,
+			Audience:    cfg.Auth.Audience,
+			TenantClaim: cfg.Auth.TenantClaim,
+		}
+	}
+	if cfg.Auth.Required && srv.Auth.JWT == nil && len(srv.Auth.ServiceKeys) == 0 && tenants == nil {
+		fatal("auth", fmt.Errorf("auth.required needs jwks_url, service_keys or a tenants file"))
+	}
+	srv.RateLimit = api.RateLimit{
+		Default:           cfg.RateLimit.Limit,
+		Routes:            cfg.RateLimit.Routes,
+		TrustForwardedFor: cfg.RateLimit.TrustForwardedFor,
+	}
+	srv.Limits = cfg.Limits
+	srv.Compression = cfg.Compression
+	srv.Ratings = cfg.Ratings
+	tracer, err := tracing.FromEnv()
+	if err != nil {
+		fatal("tracing", err)
+	}
+	srv.Tracer = tracer
+	if cfg.SortSpill.Threshold > 0 {
+		srv.ExternalSort = &rank.ExternalSort{Threshold: cfg.SortSpill.Threshold, Dir: cfg.SortSpill.Dir}
+	}
+	srv.JobWorkers = cfg.JobWorkers
+	srv.RankWorkers = cfg.RankWorkers
+	srv.DisableJobs = !cfg.Features.Jobs
+	srv.DisableMetrics = !cfg.Features.Metrics
+	srv.Cache = api.ResponseCache{MaxBytes: cfg.Cache.MaxBytes, TTL: time.Duration(cfg.Cache.TTL)}
+	if cfg.Cache.MaxBytes > 0 && cfg.Cache.RedisURL != "" {
+		tier, err := store.NewRedis(cfg.Cache.RedisURL)
+		if err != nil {
+			fatal("cache", err)
+		}
+		srv.Cache.Tier = tier
+	}
+
+	// The store is required; export targets only matter to requests that
+	// use them, and the cache falls back to the store without its shared
+	// tier.
+	srv.Checks = []health.Check{{Name: "store", Required: true, Pinger: st}}
+	names := make([]string, 0, len(srv.Exports))
+	for name := range srv.Exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if p, ok := srv.Exports[name].(health.Pinger); ok {
+			srv.Checks = append(srv.Checks, health.Check{Name: "export:" + name, Pinger: p})
+		}
+	}
+	if p, ok := srv.Cache.Tier.(health.Pinger); ok {
+		srv.Checks = append(srv.Checks, health.Check{Name: "cache", Pinger: p})
+	}
+	var consumer *kafka.Consumer
+	if len(cfg.Kafka.Brokers) > 0 {
+		consumer, err = kafka.NewConsumer(kafka.Config{
+			Brokers:  cfg.Kafka.Brokers,
+			Topic:    cfg.Kafka.Topic,
+			Group:    cfg.Kafka.Group,
+			Start:    cfg.Kafka.Start,
+			TLS:      cfg.Kafka.TLS,
+			CAFile:   cfg.Kafka.CAFile,
+			SASL:     cfg.Kafka.SASL,
+			Username: cfg.Kafka.Username,
+			Password: cfg.Kafka.Password,
+		})
+		if err != nil {
+			fatal("kafka", err)
+		}
+	}
+	if cfg.File != "" {
+		if err := srv.LoadConfigFile(cfg.File); err != nil {
+			fatal("config", err)
+		}
+	}
+	if err := srv.ResolveTenantDefaults(); err != nil {
+		fatal("tenants", err)
+	}
+
 	mux := http.NewServeMux()
-	api.RegisterHandlers(mux)
-	log.Println("ranking-go listening on :8080")
-	if err := http.ListenAndServe(":8080", mux); err != nil {
-		log.Fatal(err)
+	srv.RegisterHandlers(mux)
+	httpSrv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Duration(cfg.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.IdleTimeout),
+	}
+	httpSrv.RegisterOnShutdown(srv.CloseStreams)
+	grace := time.Duration(cfg.ShutdownGrace)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	errc := make(chan error, 2)
+	go func() { errc <- httpSrv.ListenAndServe() }()
+	slog.Info("ranking-go listening", "addr", httpSrv.Addr, "store", cfg.Store.Kind())
+	// gRPC calls share the HTTP routes' service layer, auth and rate
+	// limits.
+	var grpcSrv *grpc.Server
+	if cfg.GRPCAddr != "" {
+		lis, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			fatal("grpc", err)
+		}
+		grpcSrv = grpc.NewServer()
+		srv.RegisterGRPC(grpcSrv)
+		go func() { errc <- grpcSrv.Serve(lis) }()
+		slog.Info("ranking-go serving gRPC", "addr", cfg.GRPCAddr)
+	}
+	consumed := make(chan struct{})
+	if consumer != nil {
+		// The consumer stops with ctx; a batch cut short is not committed,
+		// so the next run applies it again.
+		go func() {
+			defer close(consumed)
+			consumer.Run(ctx, srv.ConsumeScores)
+		}()
+		slog.Info("consuming score events", "topic", cfg.Kafka.Topic, "group", cfg.Kafka.Group)
+	} else {
+		close(consumed)
+	}
+	select {
+	case err := <-errc:
+		fatal("serve", err)
+	case <-ctx.Done():
+	}
+
+	// Stop accepting connections and let in-flight requests finish, then
+	// let background jobs finish, all within one grace period.
+	slog.Info("shutting down", "grace_period", grace.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	grpcStopped := make(chan struct{})
+	if grpcSrv != nil {
+		go func() {
+			grpcSrv.GracefulStop()
+			close(grpcStopped)
+		}()
+	}
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutdown: requests still in flight", "error", err)
+	}
+	if grpcSrv != nil {
+		select {
+		case <-grpcStopped:
+		case <-shutdownCtx.Done():
+			slog.Error("shutdown: gRPC calls still in flight")
+			grpcSrv.Stop()
+		}
+	}
+	select {
+	case <-consumed:
+	case <-shutdownCtx.Done():
+		slog.Error("shutdown: score events still being applied")
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutdown", "error", err)
+	}
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// openStore opens the configured store. pgx is linked in; any other
+// database_driver must be added to the imports above.
+func openStore(c config.Store) store.Store {
+	switch c.Kind() {
+	case "redis":
+		st, err := store.NewRedis(c.RedisURL)
+		if err != nil {
+			fatal("store", err)
+		}
+		return st
+	case "postgres":
+		if !slices.Contains(sql.Drivers(), c.DatabaseDriver) {
+			fatal("store", fmt.Errorf("database_driver %q is not linked into this binary (have %s)", c.DatabaseDriver, strings.Join(sql.Drivers(), ", ")))
+		}
+		db, err := sql.Open(c.DatabaseDriver, c.DatabaseURL)
+		if err != nil {
+			fatal("store", err)
+		}
+		st, err := store.NewPostgres(context.Background(), db)
+		if err != nil {
+			fatal("store", err)
+		}
+		return st
+	}
+	return store.NewMemory()
+}
+
+// exportTargets configures the /rank export targets.
+func exportTargets(c config.Exports) map[string]export.Target {
+	targets := map[string]export.Target{}
+	if c.Dir != "" {
+		targets["local"] = export.LocalFS{Dir: c.Dir}
+	}
+	if s3 := c.S3; s3.Bucket != "" {
+		targets["s3"] = &export.S3{
+			Endpoint:  s3.Endpoint,
+			Region:    s3.Region,
+			Bucket:    s3.Bucket,
+			AccessKey: s3.AccessKeyID,
+			SecretKey: s3.SecretAccessKey,
+			PathStyle: s3.PathStyle,
+		}
 	}
+	return targets
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"ranking-go/internal/config"
+	"ranking-go/internal/rank"
+	"ranking-go/internal/store"
+)
+
+func TestDefaultDriverLinked(t *testing.T) {
+	if d := config.Default().Store.DatabaseDriver; !slices.Contains(sql.Drivers(), d) {
+		t.Errorf("default database_driver %q not linked in: %v", d, sql.Drivers())
+	}
+}
+
+// TestOpenStorePostgres opens the store the way the server does, with the
+// drivers the binary links in.
+func TestOpenStorePostgres(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+	c := config.Default().Store
+	c.DatabaseURL = dsn
+	if d := os.Getenv("POSTGRES_TEST_DRIVER"); d != "" {
+		c.DatabaseDriver = d
+	}
+	st := openStore(c)
+	ctx := context.Background()
+	if err := st.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tenant := "server-test-" + time.Now().Format("150405.000000000")
+
+	items := []rank.Item{{UserID: "a", Percent: 90}, {UserID: "b", Percent: 80}}
+	if _, err := st.Put(ctx, tenant, store.Ranking{CohortID: "c", Items: items, Results: rank.RankByPercent(items)}, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, err := st.Get(ctx, tenant, "c")
+	if err != nil || len(got.Results) != 2 || got.Results[0].UserID != "a" {
+		t.Fatalf("get: %+v, %v", got, err)
+	}
+}
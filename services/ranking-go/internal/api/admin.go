@@ -0,0 +1,138 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"ranking-go/internal/config"
+	"ranking-go/internal/export"
+)
+
+// redacted replaces secret values in admin output.
+const redacted = "[redacted]"
+
+// requireAdmin admits requests bearing "Authorization: Bearer <AdminToken>".
+// Without an AdminToken admin endpoints are off (404).
+func (s *Server) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.AdminToken == "" {
+		writeProblem(w, r, http.StatusNotFound, codeNotFound, "admin endpoints are disabled")
+		return false
+	}
+	got := r.Header.Get("Authorization")
+	if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+s.AdminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, "admin token required")
+		return false
+	}
+	return true
+}
+
+type configResponse struct {
+	// ConfigFile is the CONFIG_FILE the defaults came from, if any.
+	ConfigFile   string                     `json:"config_file,omitempty"`
+	Defaults     rankOptions                `json:"defaults"`
+	Profiles     map[string]json.RawMessage `json:"profiles,omitempty"`
+	Tenants      *tenantsConfig             `json:"tenants"`
+	Exports      map[string]exportConfig    `json:"exports"`
+	ExternalSort *externalSortConfig        `json:"external_sort"`
+	Checks       []string                   `json:"readiness_checks"`
+	AdminToken   string                     `json:"admin_token"`
+	// Server is the process configuration, with store passwords masked.
+	Server *config.Config `json:"server,omitempty"`
+}
+
+type externalSortConfig struct {
+	Threshold int    `json:"threshold"`
+	Dir       string `json:"dir"`
+}
+
+type tenantsConfig struct {
+	// Mode is "registry" (TENANTS_FILE) or "header" (X-Tenant trusted).
+	Mode    string         `json:"mode"`
+	Tenants []tenantConfig `json:"tenants,omitempty"`
+}
+
+type tenantConfig struct {
+	ID       string   `json:"id"`
+	APIKeys  []string `json:"api_keys"`
+	MaxItems int      `json:"max_items"`
+	Profile  string   `json:"profile,omitempty"`
+	// Defaults are the tenant's resolved defaults, if not the server's.
+	Defaults *rankOptions `json:"defaults,omitempty"`
+}
+
+type exportConfig struct {
+	Type      string `json:"type"`
+	Dir       string `json:"dir,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`
+	PathStyle bool   `json:"path_style,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+}
+
+// configHandler reports the effective configuration, after environment,
+// config file and defaults have been resolved, with secrets redacted.
+func (s *Server) configHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	out := configResponse{
+		ConfigFile: s.ConfigFile,
+		Defaults:   s.Defaults,
+		Profiles:   s.Profiles,
+		Tenants:    &tenantsConfig{Mode: "header"},
+		Exports:    map[string]exportConfig{},
+		Checks:     []string{},
+		AdminToken: redacted,
+	}
+	if s.Settings != nil {
+		c := s.Settings.Redacted()
+		out.Server = &c
+	}
+	if x := s.ExternalSort; x != nil {
+		out.ExternalSort = &externalSortConfig{Threshold: x.Threshold, Dir: x.Dir}
+	}
+	if s.Tenants != nil {
+		out.Tenants.Mode = "registry"
+		for _, t := range s.Tenants.All() {
+			keys := make([]string, len(t.APIKeys))
+			for i := range keys {
+				keys[i] = redacted
+			}
+			tc := tenantConfig{ID: t.ID, APIKeys: keys, MaxItems: t.MaxItems, Profile: t.Profile}
+			if opts, ok := s.tenantDefaults[t.ID]; ok {
+				tc.Defaults = &opts
+			}
+			out.Tenants.Tenants = append(out.Tenants.Tenants, tc)
+		}
+	}
+	for name, t := range s.Exports {
+		out.Exports[name] = describeExport(t)
+	}
+	for _, c := range s.Checks {
+		out.Checks = append(out.Checks, c.Name)
+	}
+	sort.Strings(out.Checks)
+	writeJSON(w, out)
+}
+
+func describeExport(t export.Target) exportConfig {
+	switch t := t.(type) {
+	case export.LocalFS:
+		return exportConfig{Type: "local", Dir: t.Dir}
+	case *export.S3:
+		c := exportConfig{Type: "s3", Endpoint: t.Endpoint, Region: t.Region, Bucket: t.Bucket, PathStyle: t.PathStyle}
+		if t.AccessKey != "" {
+			c.AccessKey = redacted
+		}
+		if t.SecretKey != "" {
+			c.SecretKey = redacted
+		}
+		return c
+	}
+	return exportConfig{Type: "other"}
+}
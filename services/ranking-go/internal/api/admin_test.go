@@ -0,0 +1,65 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ranking-go/internal/config"
+	"ranking-go/internal/export"
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+)
+
+func TestConfigEndpoint(t *testing.T) {
+	reg, err := tenant.NewRegistry([]tenant.Tenant{{ID: "college-a", APIKeys: []string{"key-a-secret"}, MaxItems: 500}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(store.NewMemory(), reg)
+	srv.AdminToken = "admin-secret"
+	settings := config.Default()
+	settings.Store.DatabaseURL = "postgres://app:db-secret@db/ranks"
+	srv.Settings = &settings
+	srv.Exports = map[string]export.Target{"s3": &export.S3{Bucket: "ranks", Region: "us-east-1", AccessKey: "AKIDSECRET", SecretKey: "s3-secret"}}
+	if err := srv.LoadConfigFile(writeConfig(t, `{"defaults": {"precision": 3}}`)); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	if resp := do(t, "GET", ts.URL+"/config", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no token: status %d, want 401", resp.StatusCode)
+	}
+	if resp := do(t, "GET", ts.URL+"/config", "", map[string]string{"Authorization": "Bearer wrong"}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want 401", resp.StatusCode)
+	}
+
+	resp := do(t, "GET", ts.URL+"/config", "", map[string]string{"Authorization": "Bearer admin-secret"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	body := string(b)
+	for _, secret := range []string{"admin-secret", "key-a-secret", "AKIDSECRET", "s3-secret", "db-secret"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("config leaks %q: %s", secret, body)
+		}
+	}
+	for _, want := range []string{`"precision":3`, `"bucket":"ranks"`, `"id":"college-a"`, `"max_items":500`, `"mode":"registry"`, `"addr":":8080"`, `"read_timeout":"2m0s"`, `"database_url":"postgres://app:xxxxx@db/ranks"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("config lacks %s: %s", want, body)
+		}
+	}
+}
+
+func TestConfigEndpointDisabledWithoutToken(t *testing.T) {
+	ts := newTestServer(t, nil)
+	if resp := do(t, "GET", ts.URL+"/config", "", map[string]string{"Authorization": "Bearer "}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"ranking-go/internal/auth"
+	"ranking-go/internal/tenant"
+)
+
+// Auth authenticates callers ahead of tenant resolution. Tenant API keys
+// (X-API-Key) are still checked by the tenant registry; Auth adds keys for
+// internal services and JWT bearer tokens from the gateway.
+type Auth struct {
+	// Required rejects requests that present no credentials.
+	Required bool
+	// ServiceKeys are X-API-Key values for internal services, which then
+	// name their tenant with X-Tenant.
+	ServiceKeys []string
+	// JWT verifies "Authorization: Bearer" tokens; nil ignores the header.
+	JWT *auth.JWTVerifier
+}
+
+// authExempt routes skip authentication: probes, and the admin endpoints,
+// which check the admin token themselves.
+var authExempt = map[string]bool{
+	"GET /health": true,
+	"GET /readyz": true,
+	"GET /config": true,
+	"POST /bench": true,
+}
+
+var (
+	errCredentialsRequired = errors.New("credentials required")
+	errUnknownKey          = errors.New("unknown api key")
+	errNoTenantClaim       = errors.New("token has no tenant claim")
+)
+
+// authenticated rejects unauthenticated requests to route with 401 and
+// passes the caller's principal, if any, to h.
+func (s *Server) authenticated(route string, h http.HandlerFunc) http.HandlerFunc {
+	if authExempt[route] {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := s.Auth.authenticate(r.Context(), credentialsOf(r.Header), s.Tenants != nil)
+		switch {
+		case errors.Is(err, auth.ErrInvalidToken):
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeProblem(w, r, http.StatusUnauthorized, codeInvalidToken, err.Error())
+			return
+		case errors.Is(err, errCredentialsRequired) || errors.Is(err, errUnknownKey):
+			if s.Auth.JWT != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, err.Error())
+			return
+		case err != nil:
+			// The JWKS couldn't be fetched; the token may well be fine.
+			s.logger().Error("auth: verifying token", "request_id", requestID(r.Context()), "error", err)
+			writeProblem(w, r, http.StatusServiceUnavailable, codeAuthUnavailable, "cannot verify token")
+			return
+		}
+		if p != nil {
+			r = r.WithContext(auth.NewContext(r.Context(), p))
+		}
+		h(w, r)
+	}
+}
+
+// credentials are what a caller presents: the Authorization, X-API-Key
+// and X-Tenant headers, or the same gRPC metadata keys.
+type credentials struct {
+	authorization, apiKey, tenant string
+}
+
+func credentialsOf(h http.Header) credentials {
+	return credentials{authorization: h.Get("Authorization"), apiKey: h.Get("X-API-Key"), tenant: h.Get("X-Tenant")}
+}
+
+// authenticate returns the caller's principal, or nil when it will be
+// identified by a tenant API key or X-Tenant alone.
+func (a *Auth) authenticate(ctx context.Context, c credentials, registry bool) (*auth.Principal, error) {
+	if token, ok := strings.CutPrefix(c.authorization, "Bearer "); ok && a.JWT != nil {
+		claims, err := a.JWT.Verify(ctx, strings.TrimSpace(token))
+		if err != nil {
+			return nil, err
+		}
+		return &auth.Principal{Method: auth.MethodJWT, Subject: claims.Subject, Tenant: claims.Tenant}, nil
+	}
+	if key := c.apiKey; key != "" {
+		for _, k := range a.ServiceKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+				return &auth.Principal{Method: auth.MethodServiceKey}, nil
+			}
+		}
+		if registry {
+			// A tenant key; the registry checks it.
+			return nil, nil
+		}
+		if a.Required {
+			return nil, errUnknownKey
+		}
+		return nil, nil
+	}
+	if a.Required {
+		return nil, errCredentialsRequired
+	}
+	return nil, nil
+}
+
+// tenantFor resolves the caller's tenant, from its principal in ctx if it
+// has one, else from the tenant registry.
+func (s *Server) tenantFor(ctx context.Context, c credentials) (*tenant.Tenant, error) {
+	p := auth.FromContext(ctx)
+	if p == nil {
+		return s.Tenants.ResolveKey(c.apiKey, c.tenant)
+	}
+	name := c.tenant
+	if p.Method == auth.MethodJWT {
+		if p.Tenant == "" {
+			return nil, errNoTenantClaim
+		}
+		if name != "" && name != p.Tenant {
+			return nil, tenant.ErrForbidden
+		}
+		name = p.Tenant
+	}
+	if name == "" {
+		name = tenant.Default
+	}
+	return s.Tenants.Lookup(name)
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ranking-go/internal/auth"
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+)
+
+// jwtIssuer serves a one-key JWKS and signs ES256 tokens with that key.
+type jwtIssuer struct {
+	key *ecdsa.PrivateKey
+	url string
+}
+
+func newJWTIssuer(t *testing.T) *jwtIssuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding
+	jwk := map[string]string{"kty": "EC", "kid": "k1", "crv": "P-256",
+		"x": b64.EncodeToString(key.X.FillBytes(make([]byte, 32))), "y": b64.EncodeToString(key.Y.FillBytes(make([]byte, 32)))}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []any{jwk}})
+	}))
+	t.Cleanup(ts.Close)
+	return &jwtIssuer{key: key, url: ts.URL}
+}
+
+func (i *jwtIssuer) token(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	b64 := base64.RawURLEncoding
+	h, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "k1"})
+	c, _ := json.Marshal(claims)
+	input := b64.EncodeToString(h) + "." + b64.EncodeToString(c)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, i.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return input + "." + b64.EncodeToString(sig)
+}
+
+func newAuthServer(t *testing.T, tenants *tenant.Registry, a Auth) *httptest.Server {
+	t.Helper()
+	srv := NewServer(store.NewMemory(), tenants)
+	srv.Auth = a
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestAuthRequired(t *testing.T) {
+	iss := newJWTIssuer(t)
+	ts := newAuthServer(t, nil, Auth{
+		Required:    true,
+		ServiceKeys: []string{"svc-key"},
+		JWT:         &auth.JWTVerifier{JWKSURL: iss.url, Audience: "ranking"},
+	})
+	body := `{"cohort_id":"c1","items":[{"user_id":"u1","percent":90}]}`
+
+	for name, tc := range map[string]struct {
+		header map[string]string
+		want   int
+	}{
+		"no credentials":      {nil, http.StatusUnauthorized},
+		"unknown key":         {map[string]string{"X-API-Key": "nope"}, http.StatusUnauthorized},
+		"bad token":           {map[string]string{"Authorization": "Bearer x.y.z"}, http.StatusUnauthorized},
+		"wrong audience":      {map[string]string{"Authorization": "Bearer " + iss.token(t, map[string]any{"aud": "other", "tenant": "t1"})}, http.StatusUnauthorized},
+		"service key":         {map[string]string{"X-API-Key": "svc-key", "X-Tenant": "t1"}, http.StatusOK},
+		"jwt":                 {map[string]string{"Authorization": "Bearer " + iss.token(t, map[string]any{"aud": "ranking", "tenant": "t1"})}, http.StatusOK},
+		"jwt, no tenant":      {map[string]string{"Authorization": "Bearer " + iss.token(t, map[string]any{"aud": "ranking"})}, http.StatusForbidden},
+		"jwt, other x-tenant": {map[string]string{"X-Tenant": "t2", "Authorization": "Bearer " + iss.token(t, map[string]any{"aud": "ranking", "tenant": "t1"})}, http.StatusForbidden},
+	} {
+		resp := do(t, "POST", ts.URL+"/rank", body, tc.header)
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: status = %d, want %d", name, resp.StatusCode, tc.want)
+		}
+		if tc.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate", name)
+		}
+	}
+
+	// The JWT's tenant owns the ranking.
+	tok := iss.token(t, map[string]any{"aud": "ranking", "tenant": "t1"})
+	resp := do(t, "GET", ts.URL+"/rank/c1", "", map[string]string{"X-API-Key": "svc-key", "X-Tenant": "t1"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("service key read: status = %d", resp.StatusCode)
+	}
+	resp = do(t, "GET", ts.URL+"/rank/c1", "", map[string]string{"Authorization": "Bearer " + tok})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("jwt read: status = %d", resp.StatusCode)
+	}
+
+	resp = do(t, "GET", ts.URL+"/health", "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/health: status = %d, want exempt", resp.StatusCode)
+	}
+}
+
+func TestAuthWithTenantRegistry(t *testing.T) {
+	reg, err := tenant.NewRegistry([]tenant.Tenant{{ID: "t1", APIKeys: []string{"t1-key"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newAuthServer(t, reg, Auth{Required: true, ServiceKeys: []string{"svc-key"}})
+	body := `{"cohort_id":"c1","items":[{"user_id":"u1","percent":90}]}`
+
+	for name, tc := range map[string]struct {
+		header map[string]string
+		want   int
+	}{
+		"tenant key":                  {map[string]string{"X-API-Key": "t1-key"}, http.StatusOK},
+		"service key":                 {map[string]string{"X-API-Key": "svc-key", "X-Tenant": "t1"}, http.StatusOK},
+		"service key, no such tenant": {map[string]string{"X-API-Key": "svc-key", "X-Tenant": "t9"}, http.StatusForbidden},
+		"x-tenant alone":              {map[string]string{"X-Tenant": "t1"}, http.StatusUnauthorized},
+	} {
+		resp := do(t, "POST", ts.URL+"/rank", body, tc.header)
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: status = %d, want %d", name, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+func TestAuthOptional(t *testing.T) {
+	// Without Required, callers without credentials resolve as before.
+	ts := newAuthServer(t, nil, Auth{ServiceKeys: []string{"svc-key"}})
+	resp := do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"u1","percent":90}]}`, map[string]string{"X-Tenant": "t1"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+
+	"ranking-go/internal/rank"
+)
+
+// awardOptions allocates numbered award slots (1 is the top prize) by tie
+// group rather than by rank, so users tied on score are never separated by
+// the user_id tie-break when prizes are at stake.
+type awardOptions struct {
+	// Slots is how many awards there are.
+	Slots int `json:"slots"`
+	// Policy says what a tie does to the awards after it. "skip" (the
+	// default): a tie of k consumes k slots, so after two co-winners of
+	// award 1 the next group gets award 3. "share": a tie consumes one slot,
+	// so the next group gets award 2.
+	Policy string `json:"policy,omitempty"`
+}
+
+func (a awardOptions) validate() error {
+	if a.Slots < 1 {
+		return fmt.Errorf("awards.slots must be at least 1, got %d", a.Slots)
+	}
+	switch a.Policy {
+	case "", "skip", "share":
+	default:
+		return fmt.Errorf("awards.policy must be skip or share, got %q", a.Policy)
+	}
+	return nil
+}
+
+// addAwards fills award and co_winner on rows, which are in the same
+// (best-first) order as results. Every member of a tie group gets the same
+// award, and co_winner when the group has more than one member. Groups
+// whose award would be past Slots get none.
+func addAwards(rows []rankResult, results []rank.Result, a awardOptions) {
+	next := 1
+	for start := 0; start < len(results) && next <= a.Slots; {
+		end := start + 1
+		for end < len(results) && results[end].TieGroup == results[start].TieGroup {
+			end++
+		}
+		for i := start; i < end; i++ {
+			award := next
+			rows[i].Award = &award
+			rows[i].CoWinner = end-start > 1
+		}
+		if a.Policy == "share" {
+			next++
+		} else {
+			next += end - start
+		}
+		start = end
+	}
+}
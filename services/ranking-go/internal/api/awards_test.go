@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAwards(t *testing.T) {
+	ts := newTestServer(t, nil)
+	// a and b tie at the top, ranked 1 and 2 only by user_id.
+	const items = `"items":[{"user_id":"b","percent":95},{"user_id":"a","percent":95},{"user_id":"c","percent":90},{"user_id":"d","percent":80}]`
+	for policy, want := range map[string][]int{
+		"skip":  {1, 1, 3, 0},
+		"share": {1, 1, 2, 3},
+	} {
+		got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"awards":{"slots":3,"policy":"`+policy+`"}}`, nil))
+		for i, r := range got.Results {
+			award := 0
+			if r.Award != nil {
+				award = *r.Award
+			}
+			if award != want[i] {
+				t.Errorf("%s: %s award %d, want %d", policy, r.UserID, award, want[i])
+			}
+			if coWinner := i < 2; r.CoWinner != coWinner {
+				t.Errorf("%s: %s co_winner %v, want %v", policy, r.UserID, r.CoWinner, coWinner)
+			}
+		}
+	}
+
+	// A tie straddling the last slot is awarded whole.
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"awards":{"slots":1}}`, nil))
+	if got.Results[0].Award == nil || got.Results[1].Award == nil || got.Results[2].Award != nil {
+		t.Errorf("slots 1: %+v", got.Results)
+	}
+
+	for _, body := range []string{
+		`{"items":[],"awards":{"slots":0}}`,
+		`{"items":[],"awards":{"slots":1,"policy":"split"}}`,
+	} {
+		if resp := do(t, "POST", ts.URL+"/rank", body, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBadges(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","badges":[
+		{"name":"Platinum","min_percentile":95},{"name":"Gold","min_percentile":75},{"name":"Silver","min_percentile":50},{"name":"Bronze","min_percentile":25}
+	],"items":[
+		{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":70},{"user_id":"d","percent":60},{"user_id":"e","percent":50}
+	]}`, nil)
+	got := decode[rankResponse](t, resp)
+	want := []string{"Platinum", "Gold", "Silver", "Bronze", ""}
+	for i, r := range got.Results {
+		if r.Badge != want[i] {
+			t.Errorf("%s: badge %q, want %q", r.UserID, r.Badge, want[i])
+		}
+	}
+
+	// The cohort's ladder is stored with it, so the leaderboard shows it.
+	lb := decode[leaderboardResponse](t, do(t, "GET", ts.URL+"/leaderboard/c1", "", nil))
+	for i, r := range lb.Results {
+		if r.Badge != want[i] {
+			t.Errorf("leaderboard %s: badge %q, want %q", r.UserID, r.Badge, want[i])
+		}
+	}
+	if p := decode[percentileResponse](t, do(t, "GET", ts.URL+"/rank/c1/percentile?score=85", "", nil)); p.Badge != "Gold" {
+		t.Errorf("hypothetical 85: badge %q", p.Badge)
+	}
+
+	resp = do(t, "POST", ts.URL+"/rank", `{"badges":[{"name":"Silver","min_percentile":50},{"name":"Gold","min_percentile":80}],"items":[{"user_id":"a","percent":1}]}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unordered ladder: status %d", resp.StatusCode)
+	}
+}
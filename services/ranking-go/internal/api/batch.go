@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"ranking-go/internal/tenant"
+)
+
+// batchEntry is one element of the /rank/batch response array: the cohort's
+// ranking, or the error that stopped it with its error code.
+type batchEntry struct {
+	CohortID string `json:"cohort_id"`
+	*rankResponse
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// failed is the batch entry for a cohort stopped by err.
+func failed(cohortID, code string, err error) batchEntry {
+	var ve *validationError
+	if errors.As(err, &ve) {
+		code = ve.Fields[0].Code
+	}
+	return batchEntry{CohortID: cohortID, Error: err.Error(), ErrorCode: code}
+}
+
+// batchHandler ranks a top-level JSON array of /rank requests. Cohorts are
+// decoded one at a time and ranked and stored up to rankWorkers at once,
+// so memory is bounded by that many cohorts rather than the whole batch,
+// and results are written in request order, each flushed as soon as it
+// and those before it are ready. A failing cohort yields an entry with
+// "error" and the batch continues; malformed JSON ends the array early.
+//
+// With ?arrival=batch, exact ties in every cohort are broken by each user's
+// earliest arrival anywhere in the batch (see batchArrivals). That needs the
+// whole batch before the first cohort can be ranked, so the batch is
+// buffered instead of streamed.
+func (s *Server) batchHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	mode := r.URL.Query().Get("arrival")
+	if mode != "" && mode != "batch" {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("arrival must be batch, got %q", mode))
+		return
+	}
+
+	dec := json.NewDecoder(r.Body)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "invalid json: expected an array of cohorts")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// Results are written while the body is still being read.
+	_ = rc.EnableFullDuplex()
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+
+	out := s.newBatchWriter(w, r, t, rc, enc)
+	if mode == "batch" {
+		s.writeBatchArrival(dec, out)
+		return
+	}
+
+	for dec.More() {
+		req := rankRequest{rankOptions: s.defaultsFor(out.t)}
+		if err := dec.Decode(&req); err != nil {
+			out.fail(fmt.Errorf("invalid json: %w", err))
+			break
+		}
+		out.rank(req)
+	}
+	out.close()
+}
+
+// batchWriter writes /rank/batch entries as a JSON array in request order
+// while ranking up to rankWorkers cohorts at once.
+type batchWriter struct {
+	s        *Server
+	r        *http.Request
+	t        *tenant.Tenant
+	w        http.ResponseWriter
+	entries  *inOrder[any]
+	written  int
+	inFlight map[string]bool
+}
+
+func (s *Server) newBatchWriter(w http.ResponseWriter, r *http.Request, t *tenant.Tenant, rc *http.ResponseController, enc *json.Encoder) *batchWriter {
+	b := &batchWriter{s: s, r: r, t: t, w: w, inFlight: make(map[string]bool)}
+	b.entries = &inOrder[any]{workers: s.rankWorkers(), emit: func(entry any) {
+		if b.written > 0 {
+			w.Write([]byte(","))
+		}
+		b.written++
+		_ = enc.Encode(entry)
+		_ = rc.Flush()
+	}}
+	w.Write([]byte("["))
+	return b
+}
+
+// rank queues req's cohort. A cohort_id already in flight waits for its
+// earlier entry, so the later one is still stored last.
+func (b *batchWriter) rank(req rankRequest) {
+	if req.CohortID != "" && b.inFlight[req.CohortID] {
+		b.entries.flush()
+		clear(b.inFlight)
+	}
+	b.inFlight[req.CohortID] = true
+	b.entries.submit(func() any {
+		return withCase(b.s.rankBatchEntry(b.r, b.t, req), req.FieldCase)
+	})
+}
+
+// fail writes the entry for a malformed batch after everything before it.
+func (b *batchWriter) fail(err error) {
+	b.entries.flush()
+	b.entries.emit(withCase(failed("", codeInvalidJSON, err), b.s.defaultsFor(b.t).FieldCase))
+}
+
+// close writes the remaining entries and ends the array.
+func (b *batchWriter) close() {
+	b.entries.flush()
+	b.w.Write([]byte("]\n"))
+}
+
+func (s *Server) rankBatchEntry(r *http.Request, t *tenant.Tenant, req rankRequest) batchEntry {
+	logRequest(r, "", len(req.Items))
+	if limit, tooMany := s.itemLimit(t); limit > 0 && len(req.Items) > limit {
+		return failed(req.CohortID, codeTooManyItems, tooMany)
+	}
+	if err := s.validateItems("items", req.Items); err != nil {
+		return failed(req.CohortID, codeInvalidRequest, err)
+	}
+	if err := rejectSubjects("items", req.Items); err != nil {
+		return failed(req.CohortID, codeInvalidRequest, err)
+	}
+	items, dropped, err := dedupeItems("items", req.Items, req.Duplicates)
+	if err != nil {
+		return failed(req.CohortID, codeInvalidOptions, err)
+	}
+	req.Items = items
+	if req.CallbackURL != "" {
+		return failed(req.CohortID, codeInvalidRequest, errors.New("callback_url is only supported by /rank/jobs"))
+	}
+	results, err := s.rankItems(r.Context(), req.Items, req.rankOptions)
+	if err != nil {
+		return failed(req.CohortID, codeInvalidOptions, err)
+	}
+	resp := toResponse(req.CohortID, results, req.rankOptions)
+	resp.DuplicatesDropped = dropped
+	if req.CohortID != "" {
+		v, err := s.storeRanking(r.Context(), t.ID, req.CohortID, req.Items, req.rankOptions, results, 0)
+		if err != nil {
+			return failed(req.CohortID, codeStoreError, fmt.Errorf("store: %w", err))
+		}
+		resp.Version = v
+	}
+	return batchEntry{CohortID: req.CohortID, rankResponse: &resp}
+}
+
+// writeBatchArrival buffers the whole batch, rewrites every item's arrival
+// to its user's batch-wide earliest, and ranks each cohort with
+// arrival_tie_break.
+func (s *Server) writeBatchArrival(dec *json.Decoder, out *batchWriter) {
+	var reqs []rankRequest
+	var decodeErr error
+	for dec.More() {
+		req := rankRequest{rankOptions: s.defaultsFor(out.t)}
+		if decodeErr = dec.Decode(&req); decodeErr != nil {
+			break
+		}
+		reqs = append(reqs, req)
+	}
+	batchArrivals(reqs)
+
+	for _, req := range reqs {
+		req.ArrivalTieBreak = true
+		out.rank(req)
+	}
+	if decodeErr != nil {
+		out.fail(fmt.Errorf("invalid json: %w", decodeErr))
+	}
+	out.close()
+}
+
+// batchArrivals replaces each item's arrival with the earliest arrival of
+// the same user_id across all cohorts, so a user's place in tie order is the
+// same in every cohort of the batch. Items without an arrival are left
+// alone (and fail their cohort under arrival_tie_break).
+func batchArrivals(reqs []rankRequest) {
+	earliest := map[string]float64{}
+	for _, req := range reqs {
+		for _, it := range req.Items {
+			if it.Arrival == nil {
+				continue
+			}
+			if a, ok := earliest[it.UserID]; !ok || *it.Arrival < a {
+				earliest[it.UserID] = *it.Arrival
+			}
+		}
+	}
+	for _, req := range reqs {
+		for i, it := range req.Items {
+			if it.Arrival != nil {
+				a := earliest[it.UserID]
+				req.Items[i].Arrival = &a
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// batchEntryJSON mirrors batchEntry for decoding; encoding/json can't
+// allocate the unexported embedded pointer.
+type batchEntryJSON struct {
+	CohortID  string       `json:"cohort_id"`
+	Results   []rankResult `json:"results"`
+	Error     string       `json:"error"`
+	ErrorCode string       `json:"error_code"`
+}
+
+func TestBatchStreamsCohortsInOrder(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	pr, pw := io.Pipe()
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Post(ts.URL+"/rank/batch", "application/json", pr)
+		if err != nil {
+			t.Error(err)
+			close(respc)
+			return
+		}
+		respc <- resp
+	}()
+
+	cohort := func(i int) string {
+		return fmt.Sprintf(`{"cohort_id":"c%d","items":[{"user_id":"a","percent":%d},{"user_id":"b","percent":50}]}`, i, 40+i*10)
+	}
+
+	// Each result must arrive before the next cohort is even sent.
+	io.WriteString(pw, "["+cohort(0))
+	resp, ok := <-respc
+	if !ok {
+		t.Fatal("no response")
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		t.Fatalf("expected array start, got %v %v", tok, err)
+	}
+
+	const n = 4
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			io.WriteString(pw, ","+cohort(i))
+		}
+		var e batchEntryJSON
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("cohort %d: %v", i, err)
+		}
+		if e.CohortID != fmt.Sprintf("c%d", i) || e.Results == nil {
+			t.Fatalf("cohort %d: got %+v", i, e)
+		}
+		wantTop := "a"
+		if 40+i*10 < 50 {
+			wantTop = "b"
+		}
+		if e.Results[0].UserID != wantTop {
+			t.Errorf("cohort %d: top %s, want %s", i, e.Results[0].UserID, wantTop)
+		}
+	}
+	io.WriteString(pw, "]")
+	pw.Close()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim(']') {
+		t.Fatalf("expected array end, got %v %v", tok, err)
+	}
+
+	// Batch results are stored like /rank results.
+	resp = do(t, "GET", ts.URL+"/rank/c3", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("stored cohort: status %d", resp.StatusCode)
+	}
+}
+
+func TestBatchReportsPerCohortErrors(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank/batch", `[
+		{"cohort_id":"bad","items":[{"user_id":"a","percent":1}],"trim_percent":99},
+		{"cohort_id":"good","items":[{"user_id":"a","percent":1}]}
+	]`, nil)
+	got := decode[[]batchEntryJSON](t, resp)
+	if len(got) != 2 {
+		t.Fatalf("got %d entries", len(got))
+	}
+	if got[0].CohortID != "bad" || got[0].Error == "" || got[0].Results != nil {
+		t.Errorf("bad cohort: %+v", got[0])
+	}
+	if got[1].CohortID != "good" || got[1].Error != "" || len(got[1].Results) != 1 {
+		t.Errorf("good cohort: %+v", got[1])
+	}
+}
+
+// TestBatchManyCohorts sends a nightly-sized batch in one request: entries
+// come back in input order, and a repeated cohort_id stores its last entry.
+func TestBatchManyCohorts(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const n = 500
+	var body strings.Builder
+	body.WriteString("[")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&body, `{"cohort_id":"c%d","items":[{"user_id":"a","percent":%d},{"user_id":"b","percent":50}]},`, i, i%100)
+	}
+	body.WriteString(`{"cohort_id":"c0","items":[{"user_id":"z","percent":1}]}]`)
+
+	got := decode[[]batchEntryJSON](t, do(t, "POST", ts.URL+"/rank/batch", body.String(), nil))
+	if len(got) != n+1 {
+		t.Fatalf("got %d entries, want %d", len(got), n+1)
+	}
+	for i, e := range got[:n] {
+		if e.CohortID != fmt.Sprintf("c%d", i) || len(e.Results) != 2 {
+			t.Fatalf("entry %d: %+v", i, e)
+		}
+	}
+	stored := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/c0", "", nil))
+	if len(stored.Results) != 1 || stored.Results[0].UserID != "z" {
+		t.Errorf("c0 stored %+v, want the batch's last entry", stored.Results)
+	}
+}
+
+func TestBatchRejectsNonArray(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank/batch", `{"cohort_id":"x"}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestBatchArrivalTieBreakAcrossCohorts(t *testing.T) {
+	ts := newTestServer(t, nil)
+	// In c2 alone, b arrived first; but a arrived earlier in c1, so
+	// batch-wide a is earliest and wins the c2 tie.
+	body := `[
+		{"cohort_id":"c1","items":[{"user_id":"a","percent":90,"arrival":1},{"user_id":"c","percent":50,"arrival":2}]},
+		{"cohort_id":"c2","items":[{"user_id":"b","percent":70,"arrival":3},{"user_id":"a","percent":70,"arrival":5}]}
+	]`
+	first := func(url string) string {
+		resp := do(t, "POST", url, body, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d", url, resp.StatusCode)
+		}
+		entries := decode[[]batchEntryJSON](t, resp)
+		if len(entries) != 2 || entries[1].Error != "" {
+			t.Fatalf("%s: got %+v", url, entries)
+		}
+		return entries[1].Results[0].UserID
+	}
+	if got := first(ts.URL + "/rank/batch?arrival=batch"); got != "a" {
+		t.Errorf("batch arrival: c2 winner %q, want a", got)
+	}
+
+	// Per cohort, arrival_tie_break uses c2's own arrivals.
+	perCohort := strings.ReplaceAll(body, `"items"`, `"arrival_tie_break":true,"items"`)
+	resp := do(t, "POST", ts.URL+"/rank/batch", perCohort, nil)
+	entries := decode[[]batchEntryJSON](t, resp)
+	if got := entries[1].Results[0].UserID; got != "b" {
+		t.Errorf("per-cohort arrival: c2 winner %q, want b", got)
+	}
+}
+
+func TestBatchArrivalRequiresArrival(t *testing.T) {
+	ts := newTestServer(t, nil)
+	body := `[{"cohort_id":"c1","items":[{"user_id":"a","percent":1},{"user_id":"b","percent":1,"arrival":1}]}]`
+	entries := decode[[]batchEntryJSON](t, do(t, "POST", ts.URL+"/rank/batch?arrival=batch", body, nil))
+	if len(entries) != 1 || !strings.Contains(entries[0].Error, "missing arrival") {
+		t.Errorf("got %+v", entries)
+	}
+	if resp := do(t, "POST", ts.URL+"/rank/batch?arrival=cohort", `[]`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// maxBenchSize bounds generated cohorts so a typo can't exhaust memory.
+const maxBenchSize = 2_000_000
+
+type benchRequest struct {
+	Size int `json:"size"`
+	// Distribution of generated percents: "uniform" on [0, 100] (default)
+	// or "normal" with Mean and SD, clamped to [0, 100].
+	Distribution string  `json:"distribution,omitempty"`
+	Mean         float64 `json:"mean,omitempty"`
+	SD           float64 `json:"sd,omitempty"`
+	// Decimals rounds generated percents, so fewer decimals mean more ties.
+	// nil keeps full precision.
+	Decimals *int  `json:"decimals,omitempty"`
+	Seed     int64 `json:"seed,omitempty"`
+	// Options are the ranking options to benchmark, on top of the
+	// server defaults.
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+type benchResponse struct {
+	Size         int     `json:"size"`
+	Distribution string  `json:"distribution"`
+	Seed         int64   `json:"seed"`
+	GenerateMS   float64 `json:"generate_ms"`
+	RankMS       float64 `json:"rank_ms"`
+	ResponseMS   float64 `json:"response_ms"`
+	ItemsPerSec  float64 `json:"items_per_sec"`
+	// Allocs and AllocBytes cover ranking and response building, not
+	// generation. They are process-wide, so concurrent requests inflate them.
+	Allocs     uint64 `json:"allocs"`
+	AllocBytes uint64 `json:"alloc_bytes"`
+	Ranks      int    `json:"distinct_ranks"`
+}
+
+func (b *benchRequest) validate() error {
+	if b.Size < 1 || b.Size > maxBenchSize {
+		return fmt.Errorf("size must be in [1, %d], got %d", maxBenchSize, b.Size)
+	}
+	switch b.Distribution {
+	case "":
+		b.Distribution = "uniform"
+	case "uniform":
+	case "normal":
+		if b.SD <= 0 {
+			return fmt.Errorf("sd must be > 0 for a normal distribution, got %v", b.SD)
+		}
+	default:
+		return fmt.Errorf("distribution must be uniform or normal, got %q", b.Distribution)
+	}
+	if d := b.Decimals; d != nil && (*d < 0 || *d > 6) {
+		return fmt.Errorf("decimals must be in [0, 6], got %d", *d)
+	}
+	return nil
+}
+
+// generate builds a synthetic cohort; the same request always yields the
+// same items.
+func (b benchRequest) generate() []rankItem {
+	rng := rand.New(rand.NewSource(b.Seed))
+	items := make([]rankItem, b.Size)
+	for i := range items {
+		var p float64
+		if b.Distribution == "normal" {
+			p = math.Min(100, math.Max(0, b.Mean+b.SD*rng.NormFloat64()))
+		} else {
+			p = 100 * rng.Float64()
+		}
+		if d := b.Decimals; d != nil {
+			scale := math.Pow(10, float64(*d))
+			p = math.Round(p*scale) / scale
+		}
+		items[i] = rankItem{UserID: "u" + strconv.Itoa(i), Percent: p}
+	}
+	return items
+}
+
+// benchHandler ranks a server-generated cohort and reports timings instead
+// of results, for capacity planning without large payloads.
+func (s *Server) benchHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	var req benchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, "json", err)
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	opts := s.Defaults
+	if len(req.Options) > 0 {
+		if err := json.Unmarshal(req.Options, &opts); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidOptions, "invalid options: "+err.Error())
+			return
+		}
+	}
+
+	start := time.Now()
+	items := req.generate()
+	generated := time.Now()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	results, err := s.rankUnmetered(toRankItems(items), opts)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidOptions, err.Error())
+		return
+	}
+	ranked := time.Now()
+	resp := toResponse("", results, opts)
+	done := time.Now()
+	runtime.ReadMemStats(&after)
+
+	out := benchResponse{
+		Size:         req.Size,
+		Distribution: req.Distribution,
+		Seed:         req.Seed,
+		GenerateMS:   ms(generated.Sub(start)),
+		RankMS:       ms(ranked.Sub(generated)),
+		ResponseMS:   ms(done.Sub(ranked)),
+		Allocs:       after.Mallocs - before.Mallocs,
+		AllocBytes:   after.TotalAlloc - before.TotalAlloc,
+	}
+	if d := ranked.Sub(generated); d > 0 {
+		out.ItemsPerSec = float64(req.Size) / d.Seconds()
+	}
+	for i, res := range resp.Results {
+		if i == 0 || res.Rank != resp.Results[i-1].Rank {
+			out.Ranks++
+		}
+	}
+	writeJSON(w, out)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
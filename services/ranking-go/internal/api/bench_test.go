@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ranking-go/internal/store"
+)
+
+func newAdminServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := NewServer(store.NewMemory(), nil)
+	srv.AdminToken = "admin-secret"
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestBench(t *testing.T) {
+	ts := newAdminServer(t)
+	admin := map[string]string{"Authorization": "Bearer admin-secret"}
+
+	if resp := do(t, "POST", ts.URL+"/bench", `{"size":10}`, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no token: status %d, want 401", resp.StatusCode)
+	}
+
+	resp := do(t, "POST", ts.URL+"/bench", `{"size":2000,"distribution":"normal","mean":60,"sd":15,"decimals":0,"seed":7,"options":{"grace_band":1}}`, admin)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[benchResponse](t, resp)
+	if got.Size != 2000 || got.Distribution != "normal" || got.Seed != 7 {
+		t.Errorf("echo: %+v", got)
+	}
+	if got.RankMS <= 0 || got.GenerateMS < 0 || got.ResponseMS < 0 || got.ItemsPerSec <= 0 {
+		t.Errorf("implausible timings: %+v", got)
+	}
+	if got.Allocs == 0 || got.AllocBytes == 0 {
+		t.Errorf("no allocations recorded: %+v", got)
+	}
+	// Whole-number percents in [0, 100] allow at most 101 distinct ranks.
+	if got.Ranks < 2 || got.Ranks > 101 {
+		t.Errorf("distinct_ranks %d, want 2..101", got.Ranks)
+	}
+
+	for name, body := range map[string]string{
+		"empty":        `{"size":0}`,
+		"too big":      `{"size":100000000}`,
+		"distribution": `{"size":10,"distribution":"pareto"}`,
+		"normal sd":    `{"size":10,"distribution":"normal","mean":50}`,
+		"options":      `{"size":10,"options":{"trim_percent":90}}`,
+	} {
+		if resp := do(t, "POST", ts.URL+"/bench", body, admin); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", name, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"ranking-go/internal/rank"
+)
+
+// bucket_by is a tiny, closed expression language, not an evaluator: the
+// expression is parsed into a bucketExpr and nothing in it is ever
+// executed. The whole grammar is
+//
+//	expr   = field | "range(" numField { "," number } ")" | "prefix(" strField "," int ")"
+//	numField = "percent" | "score" | "z_score" | "t_score" | "percentile"
+//	strField = "user_id"
+//
+// Anything else, including unknown names, nesting or extra tokens, is
+// rejected.
+const (
+	maxBucketExprLen = 256
+	maxBucketBounds  = 50
+	maxBucketPrefix  = 64
+)
+
+var (
+	bucketNumFields = map[string]func(rank.Result) (float64, bool){
+		"percent":    func(r rank.Result) (float64, bool) { return r.Percent, true },
+		"score":      func(r rank.Result) (float64, bool) { return r.Score, true },
+		"z_score":    func(r rank.Result) (float64, bool) { return r.ZScore, true },
+		"t_score":    func(r rank.Result) (float64, bool) { return r.TScore, true },
+		"percentile": func(r rank.Result) (float64, bool) { return r.Percentile, !r.PercentileNull },
+	}
+	bucketStrFields = map[string]func(rank.Result) string{
+		"user_id": func(r rank.Result) string { return r.UserID },
+	}
+)
+
+// bucketExpr is a parsed bucket_by expression.
+type bucketExpr struct {
+	num    func(rank.Result) (float64, bool) // range
+	bounds []float64                         // range breakpoints, increasing
+	str    func(rank.Result) string          // prefix or bare field
+	prefix int                               // 0 for a bare field
+}
+
+type bucketSummary struct {
+	Bucket      string   `json:"bucket"`
+	Count       int      `json:"count"`
+	MeanPercent *float64 `json:"mean_percent,omitempty"`
+	// UserIDs are the bucket's members, best first.
+	UserIDs []string `json:"user_ids"`
+}
+
+func parseBucketExpr(s string) (*bucketExpr, error) {
+	if len(s) > maxBucketExprLen {
+		return nil, fmt.Errorf("bucket_by: longer than %d characters", maxBucketExprLen)
+	}
+	toks, err := bucketTokens(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 1 {
+		f, ok := bucketStrFields[toks[0]]
+		if !ok {
+			return nil, fmt.Errorf("bucket_by: unknown field %q", toks[0])
+		}
+		return &bucketExpr{str: f}, nil
+	}
+	// fn ( field , arg ... )
+	if len(toks) < 4 || toks[1] != "(" || toks[len(toks)-1] != ")" {
+		return nil, fmt.Errorf("bucket_by: expected a field or fn(field, ...)")
+	}
+	fn, field := toks[0], toks[2]
+	var args []string
+	for i := 3; i < len(toks)-1; i += 2 {
+		if toks[i] != "," || i+1 >= len(toks)-1 {
+			return nil, fmt.Errorf("bucket_by: malformed argument list")
+		}
+		args = append(args, toks[i+1])
+	}
+
+	switch fn {
+	case "range":
+		f, ok := bucketNumFields[field]
+		if !ok {
+			return nil, fmt.Errorf("bucket_by: range needs a numeric field, got %q", field)
+		}
+		if len(args) == 0 || len(args) > maxBucketBounds {
+			return nil, fmt.Errorf("bucket_by: range needs 1 to %d breakpoints", maxBucketBounds)
+		}
+		bounds := make([]float64, len(args))
+		for i, a := range args {
+			v, err := strconv.ParseFloat(a, 64)
+			if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+				return nil, fmt.Errorf("bucket_by: invalid breakpoint %q", a)
+			}
+			if i > 0 && v <= bounds[i-1] {
+				return nil, fmt.Errorf("bucket_by: breakpoints must be increasing")
+			}
+			bounds[i] = v
+		}
+		return &bucketExpr{num: f, bounds: bounds}, nil
+	case "prefix":
+		f, ok := bucketStrFields[field]
+		if !ok {
+			return nil, fmt.Errorf("bucket_by: prefix needs a string field, got %q", field)
+		}
+		if len(args) != 1 {
+			return nil, fmt.Errorf("bucket_by: prefix takes a field and a length")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > maxBucketPrefix {
+			return nil, fmt.Errorf("bucket_by: prefix length must be 1 to %d", maxBucketPrefix)
+		}
+		return &bucketExpr{str: f, prefix: n}, nil
+	}
+	return nil, fmt.Errorf("bucket_by: unknown function %q", fn)
+}
+
+// bucketTokens splits s into names, numbers and the punctuation "(", ")"
+// and ","; any other character is an error.
+func bucketTokens(s string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			toks = append(toks, string(c))
+			i++
+		case c >= 'a' && c <= 'z' || c == '_':
+			j := i
+			for j < len(s) && (s[j] >= 'a' && s[j] <= 'z' || s[j] == '_') {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		case c >= '0' && c <= '9' || c == '-' || c == '.':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("bucket_by: unexpected character %q", c)
+		}
+	}
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("bucket_by: empty expression")
+	}
+	return toks, nil
+}
+
+// label is r's bucket. Range buckets are "<b1", "[b1,b2)", ..., ">=bk";
+// a withheld percentile is "null".
+func (e *bucketExpr) label(r rank.Result) string {
+	if e.num == nil {
+		v := e.str(r)
+		if e.prefix > 0 && len(v) > e.prefix {
+			v = v[:e.prefix]
+		}
+		return v
+	}
+	v, ok := e.num(r)
+	if !ok {
+		return "null"
+	}
+	return e.rangeLabel(sort.Search(len(e.bounds), func(i int) bool { return e.bounds[i] > v }))
+}
+
+// rangeLabel names the i-th range: values in [bounds[i-1], bounds[i]).
+func (e *bucketExpr) rangeLabel(i int) string {
+	f := func(x float64) string { return strconv.FormatFloat(x, 'f', -1, 64) }
+	switch i {
+	case 0:
+		return "<" + f(e.bounds[0])
+	case len(e.bounds):
+		return ">=" + f(e.bounds[i-1])
+	}
+	return "[" + f(e.bounds[i-1]) + "," + f(e.bounds[i]) + ")"
+}
+
+// summarize partitions best-first results into buckets. Range buckets come
+// in range order and include empty ranges (then "null", if any); other
+// buckets are sorted by label.
+func (e *bucketExpr) summarize(results []rank.Result) []bucketSummary {
+	idx := map[string]int{}
+	var out []bucketSummary
+	if e.num != nil {
+		for i := 0; i <= len(e.bounds); i++ {
+			idx[e.rangeLabel(i)] = len(out)
+			out = append(out, bucketSummary{Bucket: e.rangeLabel(i), UserIDs: []string{}})
+		}
+	}
+	sums := make([]float64, len(out))
+	for _, r := range results {
+		l := e.label(r)
+		i, ok := idx[l]
+		if !ok {
+			i = len(out)
+			idx[l] = i
+			out = append(out, bucketSummary{Bucket: l})
+			sums = append(sums, 0)
+		}
+		out[i].Count++
+		out[i].UserIDs = append(out[i].UserIDs, r.UserID)
+		sums[i] += r.Percent
+	}
+	for i := range out {
+		if out[i].Count > 0 {
+			m := sums[i] / float64(out[i].Count)
+			out[i].MeanPercent = &m
+		}
+	}
+	if e.num == nil {
+		sort.Slice(out, func(i, j int) bool { return out[i].Bucket < out[j].Bucket })
+	}
+	return out
+}
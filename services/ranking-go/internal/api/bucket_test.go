@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestBucketByPercentRange(t *testing.T) {
+	ts := newTestServer(t, nil)
+	body := `{"items":[
+		{"user_id":"a","percent":95},{"user_id":"b","percent":80},{"user_id":"c","percent":79.9},
+		{"user_id":"d","percent":55},{"user_id":"e","percent":40},{"user_id":"f","percent":10}
+	],"bucket_by":"range(percent, 50, 80, 100)"}`
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", body, nil))
+
+	want := []struct {
+		bucket string
+		count  int
+		users  []string
+	}{
+		{"<50", 2, []string{"e", "f"}},
+		{"[50,80)", 2, []string{"c", "d"}},
+		{"[80,100)", 2, []string{"a", "b"}},
+		{">=100", 0, []string{}},
+	}
+	if len(got.Buckets) != len(want) {
+		t.Fatalf("got %d buckets, want %d: %+v", len(got.Buckets), len(want), got.Buckets)
+	}
+	for i, w := range want {
+		b := got.Buckets[i]
+		if b.Bucket != w.bucket || b.Count != w.count || !reflect.DeepEqual(b.UserIDs, w.users) {
+			t.Errorf("bucket %d = %+v, want %+v", i, b, w)
+		}
+	}
+	if m := got.Buckets[0].MeanPercent; m == nil || *m != 25 {
+		t.Errorf("mean_percent %v, want 25", m)
+	}
+	if got.Buckets[3].MeanPercent != nil {
+		t.Error("empty bucket should have no mean_percent")
+	}
+}
+
+func TestBucketByPrefix(t *testing.T) {
+	ts := newTestServer(t, nil)
+	body := `{"items":[{"user_id":"cs-1","percent":9},{"user_id":"ee-1","percent":8},{"user_id":"cs-2","percent":7}],"bucket_by":"prefix(user_id, 2)"}`
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", body, nil))
+	if len(got.Buckets) != 2 || got.Buckets[0].Bucket != "cs" || got.Buckets[0].Count != 2 || got.Buckets[1].Bucket != "ee" {
+		t.Errorf("got %+v", got.Buckets)
+	}
+}
+
+func TestBucketByRejectsUnsafeExpressions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	for _, expr := range []string{
+		`os.exit(1)`,
+		`range(percent, 50`,
+		`range(percent, 80, 50)`,
+		`range(user_id, 1)`,
+		`range(percent, nan)`,
+		`range(range(percent, 1), 2)`,
+		`prefix(user_id, 0)`,
+		`percent + 1`,
+		`exec(\"rm\")`,
+		`tier`,
+	} {
+		resp := do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":1}],"bucket_by":"`+expr+`"}`, nil)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", expr, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// cacheTierTimeout bounds each call to the shared tier, which is
+	// skipped when it fails.
+	cacheTierTimeout = time.Second
+	// maxCachedResponse bounds one cached body; leaderboard pages and
+	// stats are far smaller.
+	maxCachedResponse = 1 << 20
+)
+
+// ResponseCache configures the cache of GET /leaderboard/{cohort_id} and
+// GET /cohorts/{cohort_id}/stats responses. A response is kept until its
+// cohort is next written, or TTL at most. A zero MaxBytes disables it.
+type ResponseCache struct {
+	// MaxBytes bounds the bodies kept in process; the least recently used
+	// go first.
+	MaxBytes int64
+	TTL      time.Duration
+	// Tier, if set, is a second tier shared by replicas (e.g. a
+	// store.Redis). It also carries invalidations between them: without
+	// it, a replica learns of other replicas' writes only as its entries
+	// expire.
+	Tier CacheTier
+}
+
+// CacheTier is the shared tier of the response cache.
+type CacheTier interface {
+	// GetBytes returns the value at key, nil if there is none.
+	GetBytes(ctx context.Context, key string) ([]byte, error)
+	SetBytes(ctx context.Context, key string, val []byte, ttl time.Duration) error
+	// Incr adds one to the counter at key and returns it.
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+type cacheKey struct {
+	tenant, cohort string
+	// request is the route, URL and Accept, which pick the view of the
+	// cohort.
+	request string
+}
+
+// cachedResponse is a 200 response as kept, in process and as JSON in the
+// shared tier.
+type cachedResponse struct {
+	Header map[string][]string `json:"header"`
+	Body   []byte              `json:"body"`
+}
+
+type cacheEntry struct {
+	key cacheKey
+	// gen is the cohort's generation the response was built at.
+	gen     int64
+	expires time.Time
+	resp    cachedResponse
+}
+
+// responseCache is the in-process tier: an LRU list of entries, bounded by
+// body bytes. Each cohort has a generation, bumped on every write, and an
+// entry only serves while its generation is current. With a shared tier
+// the generation lives there, so all replicas see each other's writes.
+type responseCache struct {
+	cfg ResponseCache
+
+	mu      sync.Mutex
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[cacheKey]*list.Element
+	size    int64
+	// Without a shared tier, gens holds the generation of each cohort
+	// written lately: the number of the write, counted by seq. A cohort
+	// not in gens is at floor. Past maxCacheGens cohorts gens starts over
+	// at a floor of the last write's number, which every generation
+	// handed out before a later write is below, so a response built
+	// before it is still never stored as current.
+	gens       map[streamKey]int64
+	seq, floor int64
+}
+
+// maxCacheGens bounds the cohorts whose generation is kept.
+const maxCacheGens = 10000
+
+func newResponseCache(cfg ResponseCache) *responseCache {
+	return &responseCache{cfg: cfg, lru: list.New(), entries: map[cacheKey]*list.Element{}, gens: map[streamKey]int64{}}
+}
+
+// tierKey is the shared tier's key for a cohort's generation, or with a
+// request and generation, for a response.
+func tierKey(k streamKey, gen int64, request string) string {
+	base := "cache:" + strconv.Quote(k.tenant) + ":" + strconv.Quote(k.cohort)
+	if request == "" {
+		return base + ":gen"
+	}
+	return base + ":" + strconv.FormatInt(gen, 10) + ":" + strconv.Quote(request)
+}
+
+// generation returns the cohort's current generation; ok is false if the
+// shared tier failed, and then nothing should be cached.
+func (c *responseCache) generation(ctx context.Context, k streamKey) (gen int64, ok bool) {
+	if c.cfg.Tier == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.localGen(k), true
+	}
+	ctx, cancel := context.WithTimeout(ctx, cacheTierTimeout)
+	defer cancel()
+	b, err := c.cfg.Tier.GetBytes(ctx, tierKey(k, 0, ""))
+	if err != nil {
+		return 0, false
+	}
+	if b == nil {
+		return 0, true
+	}
+	gen, err = strconv.ParseInt(string(b), 10, 64)
+	return gen, err == nil
+}
+
+// localGen is k's generation without a shared tier; c.mu must be held.
+func (c *responseCache) localGen(k streamKey) int64 {
+	if gen, ok := c.gens[k]; ok {
+		return gen
+	}
+	return c.floor
+}
+
+// invalidate retires every response cached for a cohort.
+func (c *responseCache) invalidate(k streamKey) error {
+	if c.cfg.Tier == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if len(c.gens) >= maxCacheGens {
+			c.gens, c.floor = map[streamKey]int64{}, c.seq
+		}
+		c.seq++
+		c.gens[k] = c.seq
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTierTimeout)
+	defer cancel()
+	_, err := c.cfg.Tier.Incr(ctx, tierKey(k, 0, ""))
+	return err
+}
+
+// get returns the response for key at gen and the tier it came from.
+func (c *responseCache) get(ctx context.Context, key cacheKey, gen int64) (cachedResponse, string, bool) {
+	now := time.Now()
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*cacheEntry)
+		if e.gen == gen && now.Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			return e.resp, "local", true
+		}
+		c.remove(el)
+	}
+	c.mu.Unlock()
+	if c.cfg.Tier == nil {
+		return cachedResponse{}, "", false
+	}
+	ctx, cancel := context.WithTimeout(ctx, cacheTierTimeout)
+	defer cancel()
+	b, err := c.cfg.Tier.GetBytes(ctx, tierKey(streamKey{key.tenant, key.cohort}, gen, key.request))
+	var resp cachedResponse
+	if err != nil || b == nil || json.Unmarshal(b, &resp) != nil {
+		return cachedResponse{}, "", false
+	}
+	c.putLocal(key, gen, resp)
+	return resp, "shared", true
+}
+
+// put keeps resp for key at gen in both tiers.
+func (c *responseCache) put(ctx context.Context, key cacheKey, gen int64, resp cachedResponse) error {
+	c.putLocal(key, gen, resp)
+	if c.cfg.Tier == nil {
+		return nil
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cacheTierTimeout)
+	defer cancel()
+	return c.cfg.Tier.SetBytes(ctx, tierKey(streamKey{key.tenant, key.cohort}, gen, key.request), b, c.cfg.TTL)
+}
+
+func (c *responseCache) putLocal(key cacheKey, gen int64, resp cachedResponse) {
+	n := int64(len(resp.Body))
+	if n > c.cfg.MaxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cfg.Tier == nil && gen != c.localGen(streamKey{key.tenant, key.cohort}) {
+		// The cohort was written while the response was built.
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, gen: gen, expires: time.Now().Add(c.cfg.TTL), resp: resp})
+	c.size += n
+	for c.size > c.cfg.MaxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops an entry; c.mu must be held.
+func (c *responseCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= int64(len(e.resp.Body))
+}
+
+// cached serves route's responses from the response cache, keyed by
+// tenant, cohort, URL and Accept, when it is enabled. Only 200s are kept, with
+// their ETag, so If-None-Match still gets 304 from a cached response.
+func (s *Server) cached(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := s.cache
+		if c == nil {
+			h(w, r)
+			return
+		}
+		t := s.resolveTenant(w, r)
+		if t == nil {
+			return
+		}
+		cohort := streamKey{t.ID, r.PathValue("cohort_id")}
+		key := cacheKey{t.ID, cohort.cohort, route + " " + r.URL.RequestURI() + " " + r.Header.Get("Accept")}
+		gen, ok := c.generation(r.Context(), cohort)
+		if !ok {
+			s.metrics.cacheRequests.Inc(route, "error")
+			h(w, r)
+			return
+		}
+		if resp, tier, ok := c.get(r.Context(), key, gen); ok {
+			s.metrics.cacheRequests.Inc(route, "hit_"+tier)
+			for name, values := range resp.Header {
+				w.Header()[name] = values
+			}
+			if etag := w.Header().Get("ETag"); etag != "" && etagMatch(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write(resp.Body)
+			return
+		}
+		s.metrics.cacheRequests.Inc(route, "miss")
+		rec := &responseCopy{ResponseWriter: w, status: http.StatusOK, limit: int(min(c.cfg.MaxBytes, maxCachedResponse))}
+		h(rec, r)
+		if rec.status != http.StatusOK || rec.tooLarge {
+			return
+		}
+		if err := c.put(r.Context(), key, gen, cachedResponse{Header: rec.header, Body: rec.body.Bytes()}); err != nil {
+			s.logger().Warn("response cache", "cohort_id", cohort.cohort, "error", err)
+		}
+	}
+}
+
+// invalidateCache retires a cohort's cached responses after a write.
+func (s *Server) invalidateCache(tenantID, cohortID string) {
+	if s.cache == nil {
+		return
+	}
+	if err := s.cache.invalidate(streamKey{tenantID, cohortID}); err != nil {
+		s.logger().Error("response cache: invalidation not shared", "cohort_id", cohortID, "error", err)
+	}
+}
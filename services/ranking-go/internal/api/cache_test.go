@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ranking-go/internal/store"
+)
+
+func cachingServer(t *testing.T, st store.Store, tier CacheTier) *httptest.Server {
+	t.Helper()
+	srv := NewServer(st, nil)
+	srv.Cache = ResponseCache{MaxBytes: 1 << 20, TTL: time.Minute, Tier: tier}
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestResponseCache(t *testing.T) {
+	ts := cachingServer(t, store.NewMemory(), nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80}]}`, nil)
+
+	first := do(t, "GET", ts.URL+"/leaderboard/c1", "", nil)
+	etag := first.Header.Get("ETag")
+	firstBody, _ := io.ReadAll(first.Body)
+	hit := do(t, "GET", ts.URL+"/leaderboard/c1", "", nil)
+	hitBody, _ := io.ReadAll(hit.Body)
+	if string(hitBody) != string(firstBody) || hit.Header.Get("ETag") != etag || hit.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("hit: %v\n%s\nwant\n%s", hit.Header, hitBody, firstBody)
+	}
+	if resp := do(t, "GET", ts.URL+"/leaderboard/c1", "", map[string]string{"If-None-Match": etag}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("revalidated hit: %d, want 304", resp.StatusCode)
+	}
+	do(t, "GET", ts.URL+"/cohorts/c1/stats", "", nil)
+	do(t, "GET", ts.URL+"/cohorts/c1/stats", "", nil)
+
+	// A score update retires the cohort's responses.
+	do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"b","percent":95}`, nil)
+	got := decode[leaderboardResponse](t, do(t, "GET", ts.URL+"/leaderboard/c1", "", nil))
+	if got.Version != 2 || got.Results[0].UserID != "b" {
+		t.Errorf("after a score update: version %d, %v", got.Version, userIDs(got.Results))
+	}
+	stats := decode[statsResponse](t, do(t, "GET", ts.URL+"/cohorts/c1/stats", "", nil))
+	if stats.Version != 2 {
+		t.Errorf("stats after a score update: version %d", stats.Version)
+	}
+
+	resp := do(t, "GET", ts.URL+"/metrics", "", nil)
+	b, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`ranking_response_cache_requests_total{route="GET /leaderboard/{cohort_id}",result="hit_local"} 2`,
+		`ranking_response_cache_requests_total{route="GET /leaderboard/{cohort_id}",result="miss"} 2`,
+		`ranking_response_cache_requests_total{route="GET /cohorts/{cohort_id}/stats",result="hit_local"} 1`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+
+	// Errors are not kept.
+	for i := 0; i < 2; i++ {
+		if resp := do(t, "GET", ts.URL+"/leaderboard/missing", "", nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("missing cohort: %d", resp.StatusCode)
+		}
+	}
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"missing","items":[{"user_id":"a","percent":90}]}`, nil)
+	if resp := do(t, "GET", ts.URL+"/leaderboard/missing", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("created cohort: %d", resp.StatusCode)
+	}
+}
+
+// memoryTier is a CacheTier in memory, standing in for Redis.
+type memoryTier struct {
+	mu sync.Mutex
+	m  map[string][]byte
+}
+
+func (m *memoryTier) GetBytes(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.m[key], nil
+}
+
+func (m *memoryTier) SetBytes(_ context.Context, key string, val []byte, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.m[key] = val
+	return nil
+}
+
+func (m *memoryTier) Incr(_ context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, _ := strconv.ParseInt(string(m.m[key]), 10, 64)
+	m.m[key] = []byte(strconv.FormatInt(n+1, 10))
+	return n + 1, nil
+}
+
+func TestResponseCacheShared(t *testing.T) {
+	st, tier := store.NewMemory(), &memoryTier{m: map[string][]byte{}}
+	a, b := cachingServer(t, st, tier), cachingServer(t, st, tier)
+	do(t, "POST", a.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80}]}`, nil)
+
+	do(t, "GET", a.URL+"/leaderboard/c1", "", nil)
+	do(t, "GET", b.URL+"/leaderboard/c1", "", nil)
+	resp := do(t, "GET", b.URL+"/metrics", "", nil)
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `result="hit_shared"} 1`) {
+		t.Errorf("second replica missed the shared tier:\n%s", body)
+	}
+
+	// A write on one replica retires the other's local copy too.
+	do(t, "POST", a.URL+"/rank/c1/scores", `{"user_id":"b","percent":95}`, nil)
+	if got := decode[leaderboardResponse](t, do(t, "GET", b.URL+"/leaderboard/c1", "", nil)); got.Version != 2 {
+		t.Errorf("other replica after a write: version %d, want 2", got.Version)
+	}
+}
+
+func TestResponseCacheGens(t *testing.T) {
+	c := newResponseCache(ResponseCache{MaxBytes: 1 << 20, TTL: time.Minute})
+	ctx := context.Background()
+	k := streamKey{"t", "c1"}
+	key := cacheKey{tenant: "t", cohort: "c1", request: "GET /leaderboard/c1"}
+	resp := cachedResponse{Body: []byte("{}")}
+
+	gen, _ := c.generation(ctx, k)
+	c.put(ctx, key, gen, resp)
+	if _, _, ok := c.get(ctx, key, gen); !ok {
+		t.Fatal("miss before any write")
+	}
+	// A response built before a write, and stored after it, is dropped
+	// even once the write has been forgotten.
+	c.invalidate(k)
+	for i := range maxCacheGens {
+		c.invalidate(streamKey{"t", strconv.Itoa(i)})
+	}
+	if len(c.gens) > maxCacheGens {
+		t.Errorf("%d generations kept, want at most %d", len(c.gens), maxCacheGens)
+	}
+	c.put(ctx, key, gen, resp)
+	cur, _ := c.generation(ctx, k)
+	if cur == gen {
+		t.Errorf("generation %d unchanged by a write", cur)
+	}
+	if _, _, ok := c.get(ctx, key, cur); ok {
+		t.Error("a response built before a write was kept")
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"ranking-go/internal/rank"
+)
+
+// addChanges fills in each user's movement since the version stored before
+// resp.Version. The comparison is best effort: a cohort's first version, or
+// a history the store can't read, leaves the changes out rather than
+// failing the ranking.
+func (s *Server) addChanges(ctx context.Context, tenantID string, resp *rankResponse, results []rank.Result, opts rankOptions) {
+	snaps, err := s.Store.History(ctx, tenantID, resp.CohortID, time.Time{}, time.Time{})
+	if err != nil {
+		return
+	}
+	for i := len(snaps) - 1; i >= 0; i-- {
+		if snaps[i].Version < resp.Version {
+			resp.PreviousVersion = snaps[i].Version
+			applyChanges(resp.Results, results, snaps[i].Results, opts)
+			return
+		}
+	}
+}
+
+// applyChanges sets rank_change and percentile_change on rows, which are
+// results as formatted by toResponse in any order, against prev. Users
+// missing from prev get neither, and users with a withheld percentile
+// either side get no percentile_change.
+func applyChanges(rows []rankResult, results, prev []rank.Result, opts rankOptions) {
+	before := make(map[string]rank.Result, len(prev))
+	for _, p := range prev {
+		before[p.UserID] = p
+	}
+	now := make(map[string]rank.Result, len(results))
+	for _, r := range results {
+		now[r.UserID] = r
+	}
+	for i := range rows {
+		p, ok := before[rows[i].UserID]
+		if !ok {
+			continue
+		}
+		r := now[rows[i].UserID]
+		d := p.Rank - r.Rank
+		rows[i].RankChange = &d
+		if !p.PercentileNull && !r.PercentileNull {
+			// Differencing the reported percentiles keeps the change
+			// consistent with them; formatting again drops float noise.
+			pd := opts.formatPercentile(opts.formatPercentile(r.Percentile) - opts.formatPercentile(p.Percentile))
+			rows[i].PercentileChange = &pd
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRankChanges(t *testing.T) {
+	ts := newTestServer(t, nil)
+	first := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[
+		{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":70}]}`, nil))
+	if first.PreviousVersion != 0 || first.Results[0].RankChange != nil {
+		t.Errorf("first version has changes: %+v", first)
+	}
+
+	second := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","precision":1,"items":[
+		{"user_id":"a","percent":60},{"user_id":"b","percent":80},{"user_id":"c","percent":70},{"user_id":"d","percent":95}]}`, nil))
+	if second.PreviousVersion != 1 {
+		t.Errorf("previous_version %d, want 1", second.PreviousVersion)
+	}
+	want := map[string]struct {
+		rank       int
+		percentile float64
+	}{
+		// d joins at the top: a falls from 1 to 4, and b and c keep
+		// their ranks in a larger cohort (50 -> 66.7, 0 -> 33.3).
+		"a": {-3, -100},
+		"b": {0, 16.7},
+		"c": {0, 33.3},
+	}
+	for _, r := range second.Results {
+		w, ok := want[r.UserID]
+		if !ok {
+			if r.RankChange != nil || r.PercentileChange != nil {
+				t.Errorf("new user %s has changes", r.UserID)
+			}
+			continue
+		}
+		if r.RankChange == nil || *r.RankChange != w.rank || r.PercentileChange == nil || *r.PercentileChange != w.percentile {
+			t.Errorf("%s: rank_change %v, percentile_change %v; want %d, %v", r.UserID, *r.RankChange, *r.PercentileChange, w.rank, w.percentile)
+		}
+	}
+
+	// Reads and patches compare with the version before them too.
+	got := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/c1", "", nil))
+	if got.PreviousVersion != 1 || got.Results[0].RankChange != nil || *got.Results[1].RankChange != 0 {
+		t.Errorf("get: %+v", got)
+	}
+	resp := do(t, "PATCH", ts.URL+"/rank/c1", `{"items":[{"user_id":"c","percent":99}]}`, map[string]string{"If-Match": `"2"`})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("patch: status %d", resp.StatusCode)
+	}
+	got = decode[rankResponse](t, resp)
+	if got.PreviousVersion != 2 || got.Results[0].UserID != "c" || *got.Results[0].RankChange != 2 {
+		t.Errorf("patch: %+v", got)
+	}
+}
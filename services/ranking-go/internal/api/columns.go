@@ -0,0 +1,167 @@
+package api
+
+import "slices"
+
+// rankColumns is the format=columns response: one array per field, aligned
+// by index, so user_ids[i], ranks[i] and percentiles[i] describe the same
+// user. Every array has one entry per user, in the same order the rows
+// format would list them. Optional columns appear under the same flags as
+// their row fields.
+type rankColumns struct {
+	CohortID           string           `json:"cohort_id"`
+	UserIDs            []string         `json:"user_ids"`
+	Ranks              []int            `json:"ranks"`
+	Percentiles        []*float64       `json:"percentiles"`
+	FractionalRanks    []float64        `json:"fractional_ranks,omitempty"`
+	PercentileEncoding string           `json:"percentile_encoding,omitempty"`
+	PercentileDivisor  int              `json:"percentile_divisor,omitempty"`
+	DuplicatePolicy    string           `json:"duplicate_policy,omitempty"`
+	DuplicatesDropped  int              `json:"duplicates_dropped,omitempty"`
+	Percents           []float64        `json:"percents,omitempty"`
+	TransformedScores  []float64        `json:"transformed_scores,omitempty"`
+	ZScores            []float64        `json:"z_scores,omitempty"`
+	TScores            []float64        `json:"t_scores,omitempty"`
+	BordaPoints        []float64        `json:"borda_points,omitempty"`
+	Composites         []float64        `json:"composites,omitempty"`
+	DecayedScores      []float64        `json:"decayed_scores,omitempty"`
+	AdjustedScores     []float64        `json:"adjusted_scores,omitempty"`
+	WilsonScores       []float64        `json:"wilson_scores,omitempty"`
+	TiedWith           [][]string       `json:"tied_with,omitempty"`
+	TiedCounts         []int            `json:"tied_counts,omitempty"`
+	TiedTruncated      []bool           `json:"tied_truncated,omitempty"`
+	BestRanks          []int            `json:"best_ranks,omitempty"`
+	WorstRanks         []int            `json:"worst_ranks,omitempty"`
+	DisplayRanks       []int            `json:"display_ranks,omitempty"`
+	TrueRanks          []int            `json:"true_ranks,omitempty"`
+	Awards             []*int           `json:"awards,omitempty"`
+	CoWinners          []bool           `json:"co_winners,omitempty"`
+	Quantiles          []int            `json:"quantiles,omitempty"`
+	QuantileLabels     []string         `json:"quantile_labels,omitempty"`
+	Badges             []string         `json:"badges,omitempty"`
+	PreviousVersion    int64            `json:"previous_version,omitempty"`
+	RankChanges        []*int           `json:"rank_changes,omitempty"`
+	PercentileChanges  []*float64       `json:"percentile_changes,omitempty"`
+	Curve              *rankCurve       `json:"curve,omitempty"`
+	Buckets            []bucketSummary  `json:"buckets,omitempty"`
+	Summary            *rankSummary     `json:"summary,omitempty"`
+	Subjects           []subjectColumns `json:"subjects,omitempty"`
+}
+
+// subjectColumns is a subjectRanking in the columns format.
+type subjectColumns struct {
+	Subject string `json:"subject"`
+	rankColumns
+}
+
+// present returns resp in the response format opts asks for.
+func present(resp rankResponse, opts rankOptions) any {
+	if opts.Format != "columns" {
+		return resp
+	}
+	n := len(resp.Results)
+	c := rankColumns{
+		CohortID:           resp.CohortID,
+		UserIDs:            make([]string, n),
+		Ranks:              make([]int, n),
+		Percentiles:        make([]*float64, n),
+		PercentileEncoding: resp.PercentileEncoding,
+		PercentileDivisor:  resp.PercentileDivisor,
+		DuplicatePolicy:    resp.DuplicatePolicy,
+		DuplicatesDropped:  resp.DuplicatesDropped,
+		PreviousVersion:    resp.PreviousVersion,
+		Curve:              resp.Curve,
+		Buckets:            resp.Buckets,
+		Summary:            resp.Summary,
+	}
+	if opts.Awards != nil {
+		c.Awards = make([]*int, n)
+		c.CoWinners = make([]bool, n)
+	}
+	if opts.Quantile != "" {
+		// 0 and "" where the percentile is withheld.
+		c.Quantiles = make([]int, n)
+		c.QuantileLabels = make([]string, n)
+	}
+	if slices.ContainsFunc(resp.Results, func(r rankResult) bool { return r.Badge != "" }) {
+		// "" for users without a badge.
+		c.Badges = make([]string, n)
+	}
+	for _, sub := range resp.Subjects {
+		c.Subjects = append(c.Subjects, subjectColumns{Subject: sub.Subject, rankColumns: present(sub.rankResponse, opts).(rankColumns)})
+	}
+	if resp.PreviousVersion != 0 {
+		// null for users new since the previous version.
+		c.RankChanges = make([]*int, n)
+		c.PercentileChanges = make([]*float64, n)
+	}
+	if opts.IncludeTies {
+		c.TiedWith = make([][]string, n)
+		c.TiedCounts = make([]int, n)
+		c.TiedTruncated = make([]bool, n)
+	}
+	for i, r := range resp.Results {
+		c.UserIDs[i] = r.UserID
+		if opts.IncludeTies {
+			c.TiedWith[i] = r.TiedWith
+			if c.TiedWith[i] == nil {
+				c.TiedWith[i] = []string{}
+			}
+			c.TiedCounts[i] = r.TiedCount
+			c.TiedTruncated[i] = r.TiedTruncated
+		}
+		if opts.Awards != nil {
+			c.Awards[i] = r.Award
+			c.CoWinners[i] = r.CoWinner
+		}
+		c.Ranks[i] = r.Rank
+		c.Percentiles[i] = r.Percentile
+		if r.Percent != nil {
+			c.Percents = append(c.Percents, *r.Percent)
+		}
+		if r.TransformedScore != nil {
+			c.TransformedScores = append(c.TransformedScores, *r.TransformedScore)
+		}
+		if r.ZScore != nil {
+			c.ZScores = append(c.ZScores, *r.ZScore)
+		}
+		if r.TScore != nil {
+			c.TScores = append(c.TScores, *r.TScore)
+		}
+		if r.BordaPoints != nil {
+			c.BordaPoints = append(c.BordaPoints, *r.BordaPoints)
+		}
+		if r.Composite != nil {
+			c.Composites = append(c.Composites, *r.Composite)
+		}
+		if r.DecayedScore != nil {
+			c.DecayedScores = append(c.DecayedScores, *r.DecayedScore)
+		}
+		if r.AdjustedScore != nil {
+			c.AdjustedScores = append(c.AdjustedScores, *r.AdjustedScore)
+		}
+		if r.WilsonScore != nil {
+			c.WilsonScores = append(c.WilsonScores, *r.WilsonScore)
+		}
+		if r.FractionalRank != nil {
+			c.FractionalRanks = append(c.FractionalRanks, *r.FractionalRank)
+		}
+		if r.TrueRank != nil {
+			c.DisplayRanks = append(c.DisplayRanks, *r.DisplayRank)
+			c.TrueRanks = append(c.TrueRanks, *r.TrueRank)
+		}
+		if c.Badges != nil {
+			c.Badges[i] = r.Badge
+		}
+		if c.RankChanges != nil {
+			c.RankChanges[i], c.PercentileChanges[i] = r.RankChange, r.PercentileChange
+		}
+		if c.Quantiles != nil {
+			c.Quantiles[i], c.QuantileLabels[i] = r.Quantile, r.QuantileLabel
+		}
+		if r.BestRank != nil {
+			c.BestRanks = append(c.BestRanks, *r.BestRank)
+			c.WorstRanks = append(c.WorstRanks, *r.WorstRank)
+		}
+	}
+	return c
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestFormatColumnsAlignedWithRows(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const body = `"items":[{"user_id":"a","percent":40},{"user_id":"b","percent":90},{"user_id":"c","percent":65},{"user_id":"d","percent":65}],"include_t_score":true`
+
+	rows := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+body+`}`, nil)).Results
+	cols := decode[rankColumns](t, do(t, "POST", ts.URL+"/rank", `{`+body+`,"format":"columns"}`, nil))
+
+	n := len(rows)
+	if len(cols.UserIDs) != n || len(cols.Ranks) != n || len(cols.Percentiles) != n || len(cols.TScores) != n {
+		t.Fatalf("column lengths %d/%d/%d/%d, want %d",
+			len(cols.UserIDs), len(cols.Ranks), len(cols.Percentiles), len(cols.TScores), n)
+	}
+	seen := map[string]bool{}
+	for i, r := range rows {
+		if cols.UserIDs[i] != r.UserID || cols.Ranks[i] != r.Rank ||
+			*cols.Percentiles[i] != *r.Percentile || cols.TScores[i] != *r.TScore {
+			t.Errorf("index %d: columns (%s,%d,%v,%v) != row %+v",
+				i, cols.UserIDs[i], cols.Ranks[i], *cols.Percentiles[i], cols.TScores[i], r)
+		}
+		seen[cols.UserIDs[i]] = true
+	}
+	if len(seen) != n {
+		t.Errorf("columns cover %d distinct users, want %d", len(seen), n)
+	}
+	if cols.Percents != nil {
+		t.Errorf("percents column should be absent without include_scores")
+	}
+}
+
+func TestFormatInvalid(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank", `{"items":[],"format":"parquet"}`, nil)
+	if resp.StatusCode != 400 {
+		t.Errorf("status %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func isCSV(r *http.Request) bool {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mt == "text/csv"
+}
+
+// decodeCSV fills req from a text/csv /rank body, such as a gradebook
+// export. The header row names the columns, matched without regard to case:
+// user_id and percent (or correct and total), optionally tier, subject,
+// weight, arrival, attempts, duration_seconds and finished_at (RFC 3339);
+// any other column is a metric. An empty cell leaves its field unset. As
+// with NDJSON, cohort_id and options come from the query, rows are read one
+// at a time, and maxItems > 0 stops at that many items.
+func decodeCSV(r *http.Request, req *rankRequest, maxItems int) error {
+	if err := decodeQuery(r, req); err != nil {
+		return err
+	}
+	cr := csv.NewReader(r.Body)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return errors.New("missing header row")
+	}
+	if err != nil {
+		return err
+	}
+	// Spreadsheets often start UTF-8 files with a byte order mark.
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	seen := map[string]bool{}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if known := strings.ToLower(name); csvFields[known] {
+			name = known
+		}
+		if name == "" || seen[name] {
+			return fmt.Errorf("header: column %d must have a unique name, got %q", i+1, name)
+		}
+		seen[name] = true
+		header[i] = name
+	}
+	if !seen["user_id"] || !seen["percent"] && !(seen["correct"] && seen["total"]) {
+		return errors.New("header: need a user_id column and a percent column, or correct and total")
+	}
+
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+		var it rankItem
+		for i, v := range rec {
+			if v = strings.TrimSpace(v); v != "" {
+				if err := setCSVField(&it, header[i], v); err != nil {
+					return fmt.Errorf("line %d: %s: %w", line, header[i], err)
+				}
+			}
+		}
+		if maxItems > 0 && len(req.Items) == maxItems {
+			return errTooManyItems
+		}
+		req.Items = append(req.Items, it)
+	}
+}
+
+// csvFields are the columns that fill rankItem fields rather than metrics.
+var csvFields = map[string]bool{
+	"user_id": true, "percent": true, "tier": true, "subject": true, "weight": true, "arrival": true,
+	"attempts": true, "correct": true, "total": true, "duration_seconds": true, "finished_at": true,
+}
+
+func setCSVField(it *rankItem, name, v string) error {
+	switch name {
+	case "user_id":
+		it.UserID = v
+	case "tier":
+		it.Tier = v
+	case "subject":
+		it.Subject = v
+	case "finished_at":
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("must be an RFC 3339 time, got %q", v)
+		}
+		it.FinishedAt = &t
+	case "attempts", "correct", "total":
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("must be an integer, got %q", v)
+		}
+		switch name {
+		case "attempts":
+			it.Attempts = &n
+		case "correct":
+			it.Correct = &n
+		default:
+			it.Total = &n
+		}
+	default:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("must be a number, got %q", v)
+		}
+		switch name {
+		case "percent":
+			it.Percent = f
+		case "weight":
+			it.Weight = f
+		case "arrival":
+			it.Arrival = &f
+		case "duration_seconds":
+			it.DurationSeconds = &f
+		default:
+			if it.Metrics == nil {
+				it.Metrics = map[string]float64{}
+			}
+			it.Metrics[name] = f
+		}
+	}
+	return nil
+}
+
+// writeRankingCSV writes results as text/csv; see writeCSV.
+func writeRankingCSV(w http.ResponseWriter, results []rankResult) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	_ = writeCSV(w, results)
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"ranking-go/internal/store"
+)
+
+func TestRankCSV(t *testing.T) {
+	ts := newTestServer(t, nil)
+	csvBody := map[string]string{"Content-Type": "text/csv; charset=utf-8"}
+	q := url.Values{"cohort_id": {"c1"}, "options": {`{"tie_break":[{"metric":"quiz","order":"desc"}]}`}}
+
+	body := "\ufeffUser_ID, Percent,quiz,tier\r\na,80,3,\nb, 90 ,1,\n\nc,80,5,gold\n"
+	resp := do(t, "POST", ts.URL+"/rank?"+q.Encode(), body, csvBody)
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("status %d: %s", resp.StatusCode, b)
+	}
+	if got := userIDs(decode[rankResponse](t, resp).Results); !slices.Equal(got, []string{"b", "c", "a"}) {
+		t.Errorf("order %v, want [b c a]", got)
+	}
+
+	// Correct and total stand in for percent.
+	resp = do(t, "POST", ts.URL+"/rank", "user_id,correct,total\na,3,4\nb,1,4\n", csvBody)
+	if got := userIDs(decode[rankResponse](t, resp).Results); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("counts: order %v", got)
+	}
+
+	for name, c := range map[string]struct{ body, want string }{
+		"empty":       {"", "missing header row"},
+		"no percent":  {"user_id,score\na,1\n", "percent column"},
+		"duplicate":   {"user_id,percent,Percent\na,1,2\n", "column 3"},
+		"bad number":  {"user_id,percent\na,1\nb,high\n", `line 3: percent: must be a number, got \"high\"`},
+		"bad time":    {"user_id,percent,finished_at\na,1,yesterday\n", "finished_at"},
+		"short row":   {"user_id,percent\na\n", "wrong number of fields"},
+		"bad options": {"user_id,percent\na,1\n", "options"},
+	} {
+		path := "/rank"
+		if name == "bad options" {
+			path += "?options={"
+		}
+		resp := do(t, "POST", ts.URL+path, c.body, csvBody)
+		b, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(b), c.want) {
+			t.Errorf("%s: %d %s, want 400 mentioning %s", name, resp.StatusCode, b, c.want)
+		}
+	}
+}
+
+func TestAcceptCSV(t *testing.T) {
+	ts := newTestServer(t, nil)
+	accept := map[string]string{"Accept": "text/csv, application/json;q=0.5"}
+	body := `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":70}]}`
+
+	rows := func(resp *http.Response) [][]string {
+		t.Helper()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+			t.Fatalf("Content-Type %q", ct)
+		}
+		recs, err := csv.NewReader(resp.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return recs
+	}
+	posted := rows(do(t, "POST", ts.URL+"/rank", body, accept))
+	if len(posted) != 4 || !slices.Equal(posted[0], []string{"user_id", "rank", "percentile", "percent", "badge"}) || !slices.Equal(posted[1], []string{"a", "1", "100", "90", ""}) {
+		t.Errorf("POST /rank: %v", posted)
+	}
+	if stored := rows(do(t, "GET", ts.URL+"/rank/c1", "", accept)); !slices.EqualFunc(stored, posted, slices.Equal) {
+		t.Errorf("GET /rank/c1: %v, want %v", stored, posted)
+	}
+
+	resp := do(t, "GET", ts.URL+"/leaderboard/c1?limit=2", "", accept)
+	link := resp.Header.Get("Link")
+	if page := rows(resp); len(page) != 3 || page[2][0] != "b" {
+		t.Errorf("first page: %v", page)
+	}
+	next, ok := strings.CutPrefix(link, "<")
+	next, _, _ = strings.Cut(next, ">")
+	if !ok || !strings.HasSuffix(link, `>; rel="next"`) {
+		t.Fatalf("Link %q", link)
+	}
+	resp = do(t, "GET", ts.URL+next, "", accept)
+	if resp.Header.Get("Link") != "" {
+		t.Errorf("last page has Link %q", resp.Header.Get("Link"))
+	}
+	if page := rows(resp); len(page) != 2 || page[1][0] != "c" {
+		t.Errorf("second page: %v", page)
+	}
+
+	// JSON first in Accept still gets JSON.
+	if got := decode[leaderboardResponse](t, do(t, "GET", ts.URL+"/leaderboard/c1", "", map[string]string{"Accept": "application/json, text/csv"})); len(got.Results) != 3 {
+		t.Errorf("JSON: %+v", got)
+	}
+}
+
+func TestCSVBadgesAndFormulas(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Limits.MinPercent = -10
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	accept := map[string]string{"Accept": "text/csv"}
+	body := `{"cohort_id":"c1","precision":2,"badges":[{"name":"Gold","min_percentile":90},{"name":"=Silver","min_percentile":40}],"items":[
+		{"user_id":"=HYPERLINK(\"http://x\")","percent":90},{"user_id":"+1","percent":80},{"user_id":"@a","percent":-5},{"user_id":"b-","percent":70}]}`
+	resp := do(t, "POST", ts.URL+"/rank", body, accept)
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("status %d: %s", resp.StatusCode, b)
+	}
+	recs, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Text that would start a formula is quoted with an apostrophe;
+	// numbers, even negative ones, are left as they are.
+	want := [][]string{
+		{"user_id", "rank", "percentile", "percent", "badge"},
+		{`'=HYPERLINK("http://x")`, "1", "100", "90", "Gold"},
+		{"'+1", "2", "66.67", "80", "'=Silver"},
+		{"b-", "3", "33.33", "70", ""},
+		{"'@a", "4", "0", "-5", ""},
+	}
+	if !slices.EqualFunc(recs, want, slices.Equal) {
+		t.Errorf("got %q, want %q", recs, want)
+	}
+}
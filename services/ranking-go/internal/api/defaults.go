@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"ranking-go/internal/config"
+	"ranking-go/internal/tenant"
+)
+
+// fileConfig is the layout of the CONFIG_FILE JSON document.
+type fileConfig struct {
+	// Defaults seed every /rank request; fields sent in a request override
+	// them one by one.
+	Defaults rankOptions `json:"defaults"`
+	// Profiles are named sets of /rank options over Defaults, for tenants
+	// that select them.
+	Profiles map[string]json.RawMessage `json:"profiles"`
+	// Server holds process settings, read by package config.
+	Server json.RawMessage `json:"server"`
+}
+
+// LoadConfigFile applies a JSON or YAML config file to s. Unknown fields
+// and invalid option values are errors so a bad deploy fails at startup.
+func (s *Server) LoadConfigFile(path string) error {
+	b, err := config.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var cfg fileConfig
+	if err := dec.Decode(&cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.Defaults.validate(); err != nil {
+		return fmt.Errorf("%s: defaults: %w", path, err)
+	}
+	if err := cfg.Defaults.toRank().Validate(); err != nil {
+		return fmt.Errorf("%s: defaults: %w", path, err)
+	}
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := overlay(cfg.Defaults, cfg.Profiles[name]); err != nil {
+			return fmt.Errorf("%s: profiles.%s: %w", path, name, err)
+		}
+	}
+	s.Defaults = cfg.Defaults
+	s.Profiles = cfg.Profiles
+	s.ConfigFile = path
+	return nil
+}
+
+// ResolveTenantDefaults works out the defaults of each registered tenant
+// with a profile or defaults of its own: Defaults, then the profile, then
+// the tenant's defaults, each overriding the last field by field. Call it
+// once Defaults, Profiles and Tenants are set; an unknown profile or an
+// invalid option is an error.
+func (s *Server) ResolveTenantDefaults() error {
+	resolved := map[string]rankOptions{}
+	for _, t := range s.Tenants.All() {
+		if t.Profile == "" && len(t.Defaults) == 0 {
+			continue
+		}
+		profile, ok := s.Profiles[t.Profile]
+		if t.Profile != "" && !ok {
+			return fmt.Errorf("tenant %q: unknown profile %q", t.ID, t.Profile)
+		}
+		opts, err := overlay(s.Defaults, profile, t.Defaults)
+		if err != nil {
+			return fmt.Errorf("tenant %q: defaults: %w", t.ID, err)
+		}
+		resolved[t.ID] = opts
+	}
+	s.tenantDefaults = resolved
+	return nil
+}
+
+// defaultsFor is the options t's /rank requests start from.
+func (s *Server) defaultsFor(t *tenant.Tenant) rankOptions {
+	if opts, ok := s.tenantDefaults[t.ID]; ok {
+		return opts
+	}
+	return s.Defaults
+}
+
+// overlay applies each layer of /rank options over base, as a request's
+// own options are, and validates the result.
+func overlay(base rankOptions, layers ...json.RawMessage) (rankOptions, error) {
+	// Decoding a copy keeps the layers out of base's maps and slices.
+	b, err := json.Marshal(base)
+	if err != nil {
+		return base, err
+	}
+	var opts rankOptions
+	if err := json.Unmarshal(b, &opts); err != nil {
+		return base, err
+	}
+	for _, layer := range layers {
+		if len(layer) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(layer))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&opts); err != nil {
+			return base, err
+		}
+	}
+	if err := opts.validate(); err != nil {
+		return base, err
+	}
+	if err := opts.toRank().Validate(); err != nil {
+		return base, err
+	}
+	return opts, nil
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigDefaultsApplyToBareRequest(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	path := writeConfig(t, `{"defaults": {"precision": 1, "single_item_percentile": 50, "output_order": "worst_first"}}`)
+	if err := srv.LoadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	single := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":10}]}`, nil))
+	if *single.Results[0].Percentile != 50 {
+		t.Errorf("single_item_percentile default not applied: %+v", single.Results[0])
+	}
+
+	const three = `"items":[{"user_id":"a","percent":10},{"user_id":"b","percent":20},{"user_id":"c","percent":30},{"user_id":"d","percent":40}]`
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+three+`}`, nil))
+	if got.Results[0].UserID != "a" {
+		t.Errorf("output_order default not applied: first is %s", got.Results[0].UserID)
+	}
+	if *got.Results[2].Percentile != 66.7 {
+		t.Errorf("precision default not applied: %v", *got.Results[2].Percentile)
+	}
+
+	// Per-request fields override the defaults.
+	got = decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+three+`,"output_order":"best_first","precision":3}`, nil))
+	if got.Results[0].UserID != "d" {
+		t.Errorf("request output_order ignored: first is %s", got.Results[0].UserID)
+	}
+	if *got.Results[1].Percentile != 66.667 {
+		t.Errorf("request precision ignored: %v", *got.Results[1].Percentile)
+	}
+}
+
+func TestConfigFileRejectsBadValues(t *testing.T) {
+	for name, body := range map[string]string{
+		"unknown field":  `{"defaults": {"precison": 2}}`,
+		"bad precision":  `{"defaults": {"precision": -1}}`,
+		"bad percentile": `{"defaults": {"single_item_percentile": 150}}`,
+		"bad order":      `{"defaults": {"output_order": "random"}}`,
+		"bad trim":       `{"defaults": {"trim_percent": 70}}`,
+		"not json":       `defaults: {}`,
+		"bad profile":    `{"profiles": {"strict": {"precision": -1}}}`,
+	} {
+		srv := NewServer(store.NewMemory(), nil)
+		if err := srv.LoadConfigFile(writeConfig(t, body)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestTiePrecisionPerRequestOverridesDefault(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	if err := srv.LoadConfigFile(writeConfig(t, `{"defaults": {"tie_precision": 0}}`)); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	const items = `"items":[{"user_id":"a","percent":80.01},{"user_id":"b","percent":80.04}]`
+	// The whole-number default ties a and b, so user_id puts a first.
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`}`, nil))
+	if got.Results[0].UserID != "a" {
+		t.Errorf("default precision: got %s first, want a", got.Results[0].UserID)
+	}
+	// This cohort is scored to two decimals.
+	got = decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"tie_precision":2}`, nil))
+	if got.Results[0].UserID != "b" {
+		t.Errorf("request precision: got %s first, want b", got.Results[0].UserID)
+	}
+}
+
+func TestConfigFileYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	body := "server:\n  addr: \":9000\"\ndefaults:\n  precision: 1\n  output_order: worst_first\n"
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(store.NewMemory(), nil)
+	if err := srv.LoadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if p := srv.Defaults.Precision; p == nil || *p != 1 || srv.Defaults.OutputOrder != "worst_first" {
+		t.Errorf("defaults %+v", srv.Defaults)
+	}
+}
+
+func TestTenantDefaults(t *testing.T) {
+	reg, err := tenant.NewRegistry([]tenant.Tenant{
+		{ID: "a", APIKeys: []string{"key-a"}, Profile: "exact", Defaults: []byte(`{"output_order": "worst_first"}`)},
+		{ID: "b", APIKeys: []string{"key-b"}, Defaults: []byte(`{"precision": 0}`)},
+		{ID: "c", APIKeys: []string{"key-c"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(store.NewMemory(), reg)
+	if err := srv.LoadConfigFile(writeConfig(t, `{"defaults": {"precision": 1}, "profiles": {"exact": {"precision": 3}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.ResolveTenantDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	const body = `{"items":[{"user_id":"a","percent":10},{"user_id":"b","percent":20},{"user_id":"c","percent":30},{"user_id":"d","percent":40}]}`
+	for _, tc := range []struct {
+		key, first string
+		percentile float64
+	}{
+		// The profile, then the tenant's own defaults, apply over the
+		// server's.
+		{"key-a", "a", 33.333},
+		{"key-b", "d", 67},
+		{"key-c", "d", 66.7},
+	} {
+		got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", body, map[string]string{"X-API-Key": tc.key}))
+		if got.Results[0].UserID != tc.first {
+			t.Errorf("%s: got %s first, want %s", tc.key, got.Results[0].UserID, tc.first)
+		}
+		if p := got.Results[1].Percentile; p == nil || *p != tc.percentile {
+			t.Errorf("%s: second percentile %v, want %v", tc.key, p, tc.percentile)
+		}
+	}
+}
+
+func TestResolveTenantDefaultsRejectsBadValues(t *testing.T) {
+	for name, tn := range map[string]tenant.Tenant{
+		"unknown profile": {ID: "a", Profile: "missing"},
+		"bad defaults":    {ID: "a", Defaults: []byte(`{"precision": -1}`)},
+		"unknown field":   {ID: "a", Defaults: []byte(`{"precison": 2}`)},
+	} {
+		reg, err := tenant.NewRegistry([]tenant.Tenant{tn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := NewServer(store.NewMemory(), reg)
+		if err := srv.ResolveTenantDefaults(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
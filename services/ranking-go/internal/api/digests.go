@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"ranking-go/internal/rank"
+	"ranking-go/internal/store"
+	"ranking-go/internal/tdigest"
+)
+
+// digestRetries is how often a score upload re-reads and re-merges when
+// another upload to the same cohort wins the race.
+const digestRetries = 3
+
+// Compression bounds for a new digest.
+const (
+	minCompression = 20
+	maxCompression = 10_000
+)
+
+type digestScoresRequest struct {
+	CohortID string `json:"cohort_id"`
+	// Compression sizes a new digest; tdigest.DefaultCompression if
+	// omitted. An existing digest keeps its own.
+	Compression *float64  `json:"compression,omitempty"`
+	Scores      []float64 `json:"scores"`
+}
+
+func (s *Server) validateDigestScores(req digestScoresRequest) error {
+	ve := &validationError{}
+	if req.CohortID == "" {
+		ve.add("cohort_id", codeMissingField, "is required")
+	}
+	if c := req.Compression; c != nil && !(*c >= minCompression && *c <= maxCompression) {
+		ve.add("compression", codeInvalidNumber, "must be between %d and %d, got %v", minCompression, maxCompression, *c)
+	}
+	if len(req.Scores) == 0 {
+		ve.add("scores", codeMissingField, "at least one score is required")
+	}
+	for i, x := range req.Scores {
+		s.checkPercent(ve, fmt.Sprintf("scores[%d]", i), x)
+	}
+	return ve.orNil()
+}
+
+type digestResponse struct {
+	CohortID    string    `json:"cohort_id"`
+	Version     int64     `json:"version"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Count       int64     `json:"count"`
+	Compression float64   `json:"compression"`
+	Centroids   int       `json:"centroids"`
+	Min         float64   `json:"min"`
+	Max         float64   `json:"max"`
+	// Quantiles are the estimated scores at the 10th, 25th, 50th, 75th,
+	// 90th and 99th percentiles, keyed "p10" to "p99".
+	Quantiles map[string]float64 `json:"quantiles"`
+}
+
+var digestQuantiles = []int{10, 25, 50, 75, 90, 99}
+
+func newDigestResponse(d store.Digest) digestResponse {
+	out := digestResponse{
+		CohortID:    d.CohortID,
+		Version:     d.Version,
+		UpdatedAt:   d.UpdatedAt,
+		Count:       int64(d.Digest.Count),
+		Compression: d.Digest.Compression,
+		Centroids:   len(d.Digest.Centroids),
+		Min:         d.Digest.Min,
+		Max:         d.Digest.Max,
+		Quantiles:   make(map[string]float64, len(digestQuantiles)),
+	}
+	for _, p := range digestQuantiles {
+		out.Quantiles[fmt.Sprintf("p%d", p)] = roundTo(d.Digest.Quantile(float64(p)/100), 4)
+	}
+	return out
+}
+
+// digestScoresHandler merges a batch of scores into the cohort's digest,
+// creating it on the first batch. Scores are anonymous: a digest answers
+// "what percentile is this score?" for cohorts too large to rank user by
+// user, in memory that does not grow with the cohort.
+func (s *Server) digestScoresHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	var req digestScoresRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, "json", err)
+		return
+	}
+	logRequest(r, req.CohortID, len(req.Scores))
+	limit, tooMany := s.itemLimit(t)
+	if limit > 0 && len(req.Scores) > limit {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codeTooManyItems, tooMany.Error())
+		return
+	}
+	if err := s.validateDigestScores(req); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	var (
+		d   store.Digest
+		err error
+	)
+	for attempt := 0; attempt < digestRetries; attempt++ {
+		d, err = s.Store.GetDigest(r.Context(), t.ID, req.CohortID)
+		if errors.Is(err, store.ErrNotFound) {
+			compression := float64(tdigest.DefaultCompression)
+			if req.Compression != nil {
+				compression = *req.Compression
+			}
+			d, err = store.Digest{CohortID: req.CohortID, Digest: *tdigest.New(compression)}, nil
+		}
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		if c := req.Compression; c != nil && *c != d.Digest.Compression {
+			ve := &validationError{}
+			ve.add("compression", codeInvalidRequest, "this cohort's digest has compression %v", d.Digest.Compression)
+			writeValidationError(w, r, ve)
+			return
+		}
+		d.Digest.Add(req.Scores...)
+		d.UpdatedAt = time.Now().UTC()
+		d.Version, err = s.Store.PutDigest(r.Context(), t.ID, d, d.Version)
+		if !errors.Is(err, store.ErrVersionConflict) {
+			break
+		}
+	}
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	writeJSON(w, withCase(newDigestResponse(d), s.Defaults.FieldCase))
+}
+
+// digestHandler describes a cohort's digest.
+func (s *Server) digestHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	d, err := s.Store.GetDigest(r.Context(), t.ID, r.PathValue("cohort_id"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	writeJSON(w, withCase(newDigestResponse(d), s.Defaults.FieldCase))
+}
+
+type digestPercentileResponse struct {
+	CohortID string  `json:"cohort_id"`
+	Version  int64   `json:"version"`
+	Count    int64   `json:"count"`
+	Score    float64 `json:"score"`
+	// Percentile is the share of the cohort scoring below Score, those
+	// scoring exactly Score counting half; ErrorBound is how far, in
+	// percentile points, it may be from the exact value.
+	Percentile         float64 `json:"percentile"`
+	ErrorBound         float64 `json:"error_bound"`
+	PercentileEncoding string  `json:"percentile_encoding,omitempty"`
+	PercentileDivisor  int     `json:"percentile_divisor,omitempty"`
+}
+
+// digestPercentileHandler answers "what percentile is this score?" from
+// a cohort's digest, in time and memory independent of the cohort's size.
+func (s *Server) digestPercentileHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	score, err := s.scoreParam(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	d, err := s.Store.GetDigest(r.Context(), t.ID, r.PathValue("cohort_id"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	share, bound := d.Digest.CDF(score)
+	p := 100 * share
+	if rank.PercentileDirection(s.Defaults.PercentileDirection) == rank.TopIsLow {
+		p = 100 - p
+	}
+	out := digestPercentileResponse{
+		CohortID:   d.CohortID,
+		Version:    d.Version,
+		Count:      int64(d.Digest.Count),
+		Score:      score,
+		Percentile: s.Defaults.formatPercentile(p),
+		ErrorBound: math.Round(100*bound*1e4) / 1e4,
+	}
+	if s.Defaults.PercentileEncoding == "bp" {
+		out.PercentileEncoding, out.PercentileDivisor = "bp", bpPerPercent
+		out.ErrorBound = math.Ceil(100 * bound * bpPerPercent)
+	}
+	writeJSON(w, withCase(out, s.Defaults.FieldCase))
+}
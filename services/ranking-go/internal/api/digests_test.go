@@ -0,0 +1,56 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDigests(t *testing.T) {
+	ts := newTestServer(t, nil)
+	scores := make([]string, 1000)
+	for i := range scores {
+		scores[i] = fmt.Sprint(float64(i) / 10) // 0, 0.1, ..., 99.9
+	}
+	for _, batch := range []string{strings.Join(scores[:500], ","), strings.Join(scores[500:], ",")} {
+		resp := do(t, "POST", ts.URL+"/digests/scores", `{"cohort_id":"national","compression":100,"scores":[`+batch+`]}`, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d", resp.StatusCode)
+		}
+		resp.Body.Close()
+	}
+
+	got := decode[digestResponse](t, do(t, "GET", ts.URL+"/digests/national", "", nil))
+	if got.Version != 2 || got.Count != 1000 || got.Centroids > 100 || got.Min != 0 || got.Max != 99.9 {
+		t.Errorf("digest %+v", got)
+	}
+	if q := got.Quantiles["p50"]; math.Abs(q-50) > 1 {
+		t.Errorf("p50 %v", q)
+	}
+
+	p := decode[digestPercentileResponse](t, do(t, "GET", ts.URL+"/digests/national/percentile?score=25", "", nil))
+	// 250 scores below 25, one at it.
+	if exact := 25.05; math.Abs(p.Percentile-exact) > p.ErrorBound || p.ErrorBound > 5 || p.Count != 1000 {
+		t.Errorf("percentile %+v, exact %v", p, exact)
+	}
+
+	for _, c := range []struct {
+		method, url, body string
+		status            int
+		field             string
+	}{
+		{"POST", "/digests/scores", `{"cohort_id":"national","compression":200,"scores":[1]}`, http.StatusBadRequest, "compression"},
+		{"POST", "/digests/scores", `{"cohort_id":"x","scores":[1,101]}`, http.StatusBadRequest, "scores[1]"},
+		{"POST", "/digests/scores", `{"scores":[1]}`, http.StatusBadRequest, "cohort_id"},
+		{"GET", "/digests/national/percentile", "", http.StatusBadRequest, "score"},
+		{"GET", "/digests/missing/percentile?score=1", "", http.StatusNotFound, ""},
+	} {
+		resp := do(t, c.method, ts.URL+c.url, c.body, nil)
+		p := decode[problem](t, resp)
+		if resp.StatusCode != c.status || (c.field != "" && (len(p.Fields) != 1 || p.Fields[0].Field != c.field)) {
+			t.Errorf("%s %s: status %d, %+v; want %d %s", c.method, c.url, resp.StatusCode, p.Fields, c.status, c.field)
+		}
+	}
+}
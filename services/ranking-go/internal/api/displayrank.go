@@ -0,0 +1,25 @@
+package api
+
+import "ranking-go/internal/rank"
+
+// addDisplayRanks fills display_rank and true_rank on rows, which are in
+// the same (best-first) order as results. true_rank is the ordinal
+// position, distinct even within a tie. display_rank gives a whole tie
+// group one number: its first member's position under "competition" (the
+// next group then skips past the tie, 1 2 2 2 5), or the group's own
+// count under "dense" (1 2 2 2 3). Neither depends on the strategy, and
+// both are numbered from base.
+func addDisplayRanks(rows []rankResult, results []rank.Result, mode string, base int) {
+	group, first := 0, 0
+	for i := range results {
+		if i == 0 || results[i].TieGroup != results[i-1].TieGroup {
+			group++
+			first = i + 1
+		}
+		ordinal, display := rebase(i+1, base), rebase(first, base)
+		if mode == "dense" {
+			display = rebase(group, base)
+		}
+		rows[i].TrueRank, rows[i].DisplayRank = &ordinal, &display
+	}
+}
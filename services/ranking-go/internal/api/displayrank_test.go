@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDisplayRank(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const items = `"items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":80},{"user_id":"d","percent":80},{"user_id":"e","percent":70}]`
+	for mode, want := range map[string][][2]int{
+		"dense":       {{1, 1}, {2, 2}, {2, 3}, {2, 4}, {3, 5}},
+		"competition": {{1, 1}, {2, 2}, {2, 3}, {2, 4}, {5, 5}},
+	} {
+		got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"display_rank":"`+mode+`"}`, nil))
+		for i, r := range got.Results {
+			if *r.DisplayRank != want[i][0] || *r.TrueRank != want[i][1] {
+				t.Errorf("%s: %s display %d true %d, want %d %d", mode, r.UserID, *r.DisplayRank, *r.TrueRank, want[i][0], want[i][1])
+			}
+		}
+		// Singletons agree; inside the tie only the first member does.
+		for _, i := range []int{0, 1} {
+			if r := got.Results[i]; *r.DisplayRank != *r.TrueRank {
+				t.Errorf("%s: %s display %d != true %d", mode, r.UserID, *r.DisplayRank, *r.TrueRank)
+			}
+		}
+	}
+
+	// worst_first keeps each user's numbers.
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"display_rank":"dense","output_order":"worst_first"}`, nil))
+	if r := got.Results[0]; r.UserID != "e" || *r.DisplayRank != 3 || *r.TrueRank != 5 {
+		t.Errorf("worst_first: %+v", r)
+	}
+
+	if resp := do(t, "POST", ts.URL+"/rank", `{"items":[],"display_rank":"ordinal"}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown mode: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestRankBase(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const items = `"items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":80},{"user_id":"d","percent":70}]`
+	one := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"display_rank":"dense","stability_delta":5}`, nil))
+	zero := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"display_rank":"dense","stability_delta":5,"rank_base":0}`, nil))
+	for i := range one.Results {
+		o, z := one.Results[i], zero.Results[i]
+		if z.Rank != o.Rank-1 || *z.TrueRank != *o.TrueRank-1 || *z.DisplayRank != *o.DisplayRank-1 || *z.BestRank != *o.BestRank-1 || *z.WorstRank != *o.WorstRank-1 {
+			t.Errorf("%s: 0-based %+v not one below 1-based %+v", o.UserID, z, o)
+		}
+		// Percentile math doesn't see the base: 100, 66.67, 33.33, 0 both ways.
+		if *z.Percentile != *o.Percentile {
+			t.Errorf("%s: percentile %v with rank_base 0, %v with 1", o.UserID, *z.Percentile, *o.Percentile)
+		}
+	}
+	if zero.Results[0].Rank != 0 || *zero.Results[0].Percentile != 100 || *zero.Results[3].Percentile != 0 {
+		t.Errorf("0-based top/bottom: %+v %+v", zero.Results[0], zero.Results[3])
+	}
+
+	// 0-based ranks fed back to /rank/percentiles give the same percentiles.
+	body := `{"cohort_size":4,"rank_base":0,"ranks":[{"user_id":"a","rank":0},{"user_id":"b","rank":1},{"user_id":"c","rank":2},{"user_id":"d","rank":3}]}`
+	re := decode[recomputeResponse](t, do(t, "POST", ts.URL+"/rank/percentiles", body, nil))
+	for i, r := range re.Results {
+		if r.Rank != i || *r.Percentile != *one.Results[i].Percentile {
+			t.Errorf("recompute %s: rank %d percentile %v, want %d %v", r.UserID, r.Rank, *r.Percentile, i, *one.Results[i].Percentile)
+		}
+	}
+
+	if resp := do(t, "POST", ts.URL+"/rank", `{"items":[],"rank_base":2}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("rank_base 2: status %d, want 400", resp.StatusCode)
+	}
+	if resp := do(t, "POST", ts.URL+"/rank/percentiles", `{"cohort_size":1,"rank_base":0,"ranks":[{"user_id":"a","rank":1}]}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("rank 1 in a 0-based cohort of 1: status %d, want 400", resp.StatusCode)
+	}
+}
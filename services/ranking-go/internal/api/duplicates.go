@@ -0,0 +1,71 @@
+package api
+
+import "fmt"
+
+// Duplicate policies: what to do when a user_id appears more than once
+// in one cohort.
+const (
+	// duplicatesReject fails the request, listing every repeat (default).
+	duplicatesReject = "reject"
+	// duplicatesKeepHighest keeps the user's item with the highest
+	// percent, the earliest of equals.
+	duplicatesKeepHighest = "keep_highest"
+	// duplicatesKeepLatest keeps the user's latest item: by arrival when
+	// both items carry one, else the later in the request.
+	duplicatesKeepLatest = "keep_latest"
+)
+
+func checkDuplicatePolicy(p string) error {
+	switch p {
+	case "", duplicatesReject, duplicatesKeepHighest, duplicatesKeepLatest:
+		return nil
+	}
+	return fmt.Errorf("duplicates must be %s, %s or %s, got %q", duplicatesReject, duplicatesKeepHighest, duplicatesKeepLatest, p)
+}
+
+// dedupeItems applies policy to items with repeated user_ids and returns
+// one item per user, each at its user's first position, and how many
+// items were dropped. Under reject, repeats are a validationError. Items
+// with subjects are one per user and subject.
+func dedupeItems(field string, items []rankItem, policy string) ([]rankItem, int, error) {
+	if err := checkDuplicatePolicy(policy); err != nil {
+		return nil, 0, err
+	}
+	type key struct{ user, subject string }
+	kept := make(map[key]int, len(items)) // index in out
+	out := make([]rankItem, 0, len(items))
+	ve := &validationError{}
+	for i, it := range items {
+		k := key{it.UserID, it.Subject}
+		j, dup := kept[k]
+		if !dup {
+			kept[k] = len(out)
+			out = append(out, it)
+			continue
+		}
+		switch policy {
+		case duplicatesKeepHighest:
+			if it.percent() > out[j].percent() {
+				out[j] = it
+			}
+		case duplicatesKeepLatest:
+			if prev := out[j]; it.Arrival == nil || prev.Arrival == nil || *it.Arrival >= *prev.Arrival {
+				out[j] = it
+			}
+		default:
+			if it.Subject != "" {
+				ve.add(fmt.Sprintf("%s[%d].user_id", field, i), codeDuplicateUserID, "duplicate user_id %q in subject %q", it.UserID, it.Subject)
+				break
+			}
+			ve.add(fmt.Sprintf("%s[%d].user_id", field, i), codeDuplicateUserID, "duplicate user_id %q", it.UserID)
+		}
+	}
+	if err := ve.orNil(); err != nil {
+		return nil, 0, err
+	}
+	if len(out) == len(items) {
+		// Nothing dropped; keep the caller's slice.
+		return items, 0, nil
+	}
+	return out, len(items) - len(out), nil
+}
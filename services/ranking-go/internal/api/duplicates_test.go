@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDuplicatePolicies(t *testing.T) {
+	ts := newTestServer(t, nil)
+	items := `[
+		{"user_id":"a","percent":70,"arrival":2},
+		{"user_id":"b","percent":80},
+		{"user_id":"a","percent":90,"arrival":1},
+		{"user_id":"b","percent":60}
+	]`
+
+	resp := do(t, "POST", ts.URL+"/rank", `{"items":`+items+`}`, nil)
+	got := decode[problem](t, resp)
+	if resp.StatusCode != http.StatusBadRequest || len(got.Fields) != 2 || got.Fields[0].Field != "items[2].user_id" || got.Fields[1].Field != "items[3].user_id" {
+		t.Fatalf("reject: status %d, fields %+v", resp.StatusCode, got.Fields)
+	}
+
+	for policy, want := range map[string]map[string]float64{
+		// a keeps 90; b keeps 80.
+		"keep_highest": {"a": 90, "b": 80},
+		// a's arrival 2 is later than 1; b has no arrivals, so the later item wins.
+		"keep_latest": {"a": 70, "b": 60},
+	} {
+		resp := do(t, "POST", ts.URL+"/rank", `{"include_scores":true,"duplicates":"`+policy+`","items":`+items+`}`, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d", policy, resp.StatusCode)
+		}
+		body := decode[rankResponse](t, resp)
+		if body.DuplicatePolicy != policy || body.DuplicatesDropped != 2 || len(body.Results) != 2 {
+			t.Fatalf("%s: policy %q, dropped %d, results %d", policy, body.DuplicatePolicy, body.DuplicatesDropped, len(body.Results))
+		}
+		for _, r := range body.Results {
+			if *r.Percent != want[r.UserID] {
+				t.Errorf("%s: %s kept percent %v, want %v", policy, r.UserID, *r.Percent, want[r.UserID])
+			}
+		}
+	}
+
+	resp = do(t, "POST", ts.URL+"/rank", `{"duplicates":"keep_first","items":[]}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown policy: status %d", resp.StatusCode)
+	}
+}
+
+func TestDuplicatesStoredOnce(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","duplicates":"keep_highest","items":[
+		{"user_id":"a","percent":10},{"user_id":"a","percent":20},{"user_id":"b","percent":15}]}`, nil)
+	resp.Body.Close()
+	resp = do(t, "GET", ts.URL+"/rank/c1", "", nil)
+	body := decode[rankResponse](t, resp)
+	if len(body.Results) != 2 || body.Results[0].UserID != "a" {
+		t.Fatalf("stored results = %+v", body.Results)
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+
+	"ranking-go/internal/equate"
+	"ranking-go/internal/rank"
+)
+
+type equateRequest struct {
+	// Method is "linear" or "equipercentile".
+	Method string `json:"method"`
+	// From's scores are mapped onto To's distribution.
+	From cohortSource `json:"from"`
+	To   cohortSource `json:"to"`
+}
+
+// cohortSource is a cohort given inline, labelled by CohortID, or without
+// items by the ID of a stored ranking.
+type cohortSource struct {
+	CohortID string     `json:"cohort_id,omitempty"`
+	Items    []rankItem `json:"items,omitempty"`
+}
+
+type equateResponse struct {
+	Method       string         `json:"method"`
+	FromCohortID string         `json:"from_cohort_id,omitempty"`
+	ToCohortID   string         `json:"to_cohort_id,omitempty"`
+	Results      []equatedScore `json:"results"`
+}
+
+type equatedScore struct {
+	UserID         string  `json:"user_id"`
+	Percent        float64 `json:"percent"`
+	EquatedPercent float64 `json:"equated_percent"`
+}
+
+// checkSource adds field errors for a source with neither items nor a
+// cohort_id, and for invalid inline items.
+func (s *Server) checkSource(ve *validationError, field string, src cohortSource) {
+	if src.CohortID == "" && len(src.Items) == 0 {
+		ve.add(field, codeMissingField, "needs cohort_id or items")
+		return
+	}
+	s.checkItems(ve, field+".items", src.Items)
+	checkNoSubjects(ve, field+".items", src.Items)
+}
+
+// sourceItems returns a source's items, reading stored cohorts from the
+// tenant's store.
+func (s *Server) sourceItems(ctx context.Context, tenantID string, src cohortSource) ([]rank.Item, error) {
+	if len(src.Items) > 0 {
+		return toRankItems(src.Items), nil
+	}
+	stored, err := s.Store.Get(ctx, tenantID, src.CohortID)
+	if err != nil {
+		return nil, err
+	}
+	return stored.Items, nil
+}
+
+func percents(items []rank.Item) []float64 {
+	out := make([]float64, len(items))
+	for i, it := range items {
+		out[i] = it.Percent
+	}
+	return out
+}
+
+// equateHandler maps every score of the from cohort onto the to cohort's
+// distribution, clamped to the configured percent range so the results
+// can be ranked together with the to cohort.
+func (s *Server) equateHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	var req equateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, "json", err)
+		return
+	}
+	ve := &validationError{}
+	switch equate.Method(req.Method) {
+	case equate.MethodLinear, equate.MethodEquipercentile:
+	case "":
+		ve.add("method", codeMissingField, "must be linear or equipercentile")
+	default:
+		ve.add("method", codeInvalidRequest, "must be linear or equipercentile, got %q", req.Method)
+	}
+	s.checkSource(ve, "from", req.From)
+	s.checkSource(ve, "to", req.To)
+	if err := ve.orNil(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if limit, tooMany := s.itemLimit(t); limit > 0 && (len(req.From.Items) > limit || len(req.To.Items) > limit) {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codeTooManyItems, tooMany.Error())
+		return
+	}
+
+	from, err := s.sourceItems(r.Context(), t.ID, req.From)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	to, err := s.sourceItems(r.Context(), t.ID, req.To)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	eq, err := equate.Fit(equate.Method(req.Method), percents(from), percents(to))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	out := equateResponse{Method: req.Method, FromCohortID: req.From.CohortID, ToCohortID: req.To.CohortID, Results: make([]equatedScore, len(from))}
+	for i, it := range from {
+		y := math.Max(s.Limits.MinPercent, math.Min(s.Limits.MaxPercent, eq.Equate(it.Percent)))
+		out.Results[i] = equatedScore{UserID: it.UserID, Percent: it.Percent, EquatedPercent: y}
+	}
+	writeJSON(w, withCase(out, s.Defaults.FieldCase))
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestEquate(t *testing.T) {
+	ts := newTestServer(t, nil)
+	// mock-2 was harder: its 40..60 spread maps onto mock-1's 65..75.
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"mock-1","items":[{"user_id":"x","percent":65},{"user_id":"y","percent":75}]}`, nil).Body.Close()
+	hard := `{"items":[{"user_id":"a","percent":40},{"user_id":"b","percent":60},{"user_id":"c","percent":80}]}`
+
+	resp := do(t, "POST", ts.URL+"/equate", `{"method":"linear","from":`+hard+`,"to":{"cohort_id":"mock-1"}}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[equateResponse](t, resp)
+	// mean 60, sd sqrt(800/3) onto mean 70, sd 5.
+	slope := 5 / math.Sqrt(800.0/3)
+	for i, w := range []float64{70 - 20*slope, 70, 70 + 20*slope} {
+		if r := got.Results[i]; math.Abs(r.EquatedPercent-w) > 1e-9 {
+			t.Errorf("linear %s: %v, want %v", r.UserID, r.EquatedPercent, w)
+		}
+	}
+	if got.ToCohortID != "mock-1" || got.Results[0].Percent != 40 {
+		t.Errorf("response %+v", got)
+	}
+
+	got = decode[equateResponse](t, do(t, "POST", ts.URL+"/equate", `{"method":"equipercentile","from":`+hard+`,"to":{"cohort_id":"mock-1"}}`, nil))
+	// a's rank 1/6 is below mock-1's lowest, c's above its highest; b
+	// sits at the median.
+	for i, w := range []float64{65, 70, 75} {
+		if r := got.Results[i]; math.Abs(r.EquatedPercent-w) > 1e-9 {
+			t.Errorf("equipercentile %s: %v, want %v", r.UserID, r.EquatedPercent, w)
+		}
+	}
+
+	// Linear results are clamped to the percent range.
+	steep := `{"method":"linear","from":{"items":[{"user_id":"a","percent":50},{"user_id":"b","percent":51}]},"to":{"items":[{"user_id":"x","percent":0},{"user_id":"y","percent":100}]}}`
+	got = decode[equateResponse](t, do(t, "POST", ts.URL+"/equate", steep, nil))
+	if got.Results[0].EquatedPercent != 0 || got.Results[1].EquatedPercent != 100 {
+		t.Errorf("clamped %+v", got.Results)
+	}
+
+	for _, c := range []struct {
+		body   string
+		status int
+		field  string
+	}{
+		{`{"from":` + hard + `,"to":{"cohort_id":"mock-1"}}`, http.StatusBadRequest, "method"},
+		{`{"method":"linear","from":{},"to":{"cohort_id":"mock-1"}}`, http.StatusBadRequest, "from"},
+		{`{"method":"linear","from":{"items":[{"user_id":"","percent":1}]},"to":{"cohort_id":"mock-1"}}`, http.StatusBadRequest, "from.items[0].user_id"},
+		{`{"method":"linear","from":` + hard + `,"to":{"cohort_id":"nope"}}`, http.StatusNotFound, ""},
+	} {
+		resp := do(t, "POST", ts.URL+"/equate", c.body, nil)
+		p := decode[problem](t, resp)
+		if resp.StatusCode != c.status || (c.field != "" && (len(p.Fields) != 1 || p.Fields[0].Field != c.field)) {
+			t.Errorf("%s: status %d, %+v; want %d %s", c.body, resp.StatusCode, p.Fields, c.status, c.field)
+		}
+	}
+}
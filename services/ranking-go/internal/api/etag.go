@@ -0,0 +1,129 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ranking-go/internal/store"
+)
+
+// maxETagEntries bounds the content hashes kept; past it the cache starts
+// over.
+const maxETagEntries = 10000
+
+// etagCache keeps the content hash of each cohort's latest stored ranking
+// read, so revalidating a large cohort doesn't hash it again.
+type etagCache struct {
+	mu sync.Mutex
+	m  map[streamKey]etagEntry
+}
+
+// etagEntry is the hash of one write: a version and its ranked_at, since
+// versions alone start over when an in-memory store restarts.
+type etagEntry struct {
+	version  int64
+	rankedAt time.Time
+	sum      [sha256.Size]byte
+}
+
+// contentHash hashes what a stored ranking shows: its results and the
+// options they were ranked with.
+func (c *etagCache) contentHash(tenantID string, stored store.Ranking) [sha256.Size]byte {
+	key := streamKey{tenantID, stored.CohortID}
+	c.mu.Lock()
+	e, ok := c.m[key]
+	c.mu.Unlock()
+	if ok && e.version == stored.Version && e.rankedAt.Equal(stored.RankedAt) {
+		return e.sum
+	}
+
+	opts := stored.Options
+	opts.ExternalSort = nil
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	_ = enc.Encode(opts)
+	_ = enc.Encode(stored.Results)
+	e = etagEntry{version: stored.Version, rankedAt: stored.RankedAt}
+	h.Sum(e.sum[:0])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil || len(c.m) >= maxETagEntries {
+		c.m = map[streamKey]etagEntry{}
+	}
+	if cur, ok := c.m[key]; !ok || cur.version <= e.version {
+		c.m[key] = e
+	}
+	return e.sum
+}
+
+// notModified sets the ETag of r's response, a view of stored, and
+// answers 304 if the client's If-None-Match already holds it. The tag
+// covers the ranking's content and version (both are in the body), the
+// URL, Accept and the server's defaults, which pick the view.
+func (s *Server) notModified(w http.ResponseWriter, r *http.Request, tenantID string, stored store.Ranking) bool {
+	return s.notModifiedSum(w, r, s.etags.contentHash(tenantID, stored), stored.Version)
+}
+
+// notModifiedPage is notModified for a view of part of a ranking, p,
+// whose tag covers what the page shows rather than the whole cohort.
+func (s *Server) notModifiedPage(w http.ResponseWriter, r *http.Request, p store.Page) bool {
+	opts := p.Options
+	opts.ExternalSort = nil
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	_ = enc.Encode(opts)
+	_ = enc.Encode([]int{p.Size, p.Items, p.Offset})
+	_ = enc.Encode(p.Results)
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return s.notModifiedSum(w, r, sum, p.Version)
+}
+
+// notModifiedSum is notModified given the content hash.
+func (s *Server) notModifiedSum(w http.ResponseWriter, r *http.Request, sum [sha256.Size]byte, version int64) bool {
+	h := sha256.New()
+	h.Write(sum[:])
+	fmt.Fprintf(h, "\x00%d\x00%s\x00%s\x00%s", version, r.URL.RequestURI(), r.Header.Get("Accept"), s.defaultsTag)
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if !etagMatch(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch is If-None-Match's weak comparison of etag against the
+// header's list. etag's gzipped form (see gzipETag) matches too, so a
+// client holding either encoding gets 304.
+func etagMatch(header, etag string) bool {
+	return etagListed(header, etag) || etagListed(header, gzipETag(etag)) || etagListed(header, "*")
+}
+
+// etagListed reports whether the If-None-Match header lists tag, weak or
+// strong.
+func etagListed(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(t), "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultsTag identifies s.Defaults in ETags, so replicas or restarts with
+// other defaults don't share tags.
+func defaultsTag(d rankOptions) string {
+	b, _ := json.Marshal(d)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
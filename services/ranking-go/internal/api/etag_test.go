@@ -0,0 +1,55 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestConditionalGet(t *testing.T) {
+	ts := newTestServer(t, nil)
+	body := `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80}]}`
+	do(t, "POST", ts.URL+"/rank", body, nil)
+
+	for _, path := range []string{"/rank/c1", "/leaderboard/c1?limit=1", "/rank/c1/users/a", "/cohorts/c1/stats"} {
+		first := do(t, "GET", ts.URL+path, "", nil)
+		etag := first.Header.Get("ETag")
+		if first.StatusCode != http.StatusOK || etag == "" || first.Header.Get("Cache-Control") != "private, no-cache" {
+			t.Fatalf("%s: %d, ETag %q, Cache-Control %q", path, first.StatusCode, etag, first.Header.Get("Cache-Control"))
+		}
+		again := do(t, "GET", ts.URL+path, "", map[string]string{"If-None-Match": `"other", W/` + etag})
+		b, _ := io.ReadAll(again.Body)
+		if again.StatusCode != http.StatusNotModified || len(b) != 0 || again.Header.Get("ETag") != etag {
+			t.Errorf("%s revalidated: %d, %d bytes, ETag %q", path, again.StatusCode, len(b), again.Header.Get("ETag"))
+		}
+	}
+
+	// Another view of the same ranking has its own tag.
+	page1 := do(t, "GET", ts.URL+"/leaderboard/c1?limit=1", "", nil).Header.Get("ETag")
+	if resp := do(t, "GET", ts.URL+"/leaderboard/c1?limit=2", "", map[string]string{"If-None-Match": page1}); resp.StatusCode != http.StatusOK {
+		t.Errorf("other page: %d, want 200", resp.StatusCode)
+	}
+
+	// A write changes the tag, even one leaving the standings as they were,
+	// since the version in the body moves on.
+	do(t, "POST", ts.URL+"/rank", body, nil)
+	if resp := do(t, "GET", ts.URL+"/leaderboard/c1?limit=1", "", map[string]string{"If-None-Match": page1}); resp.StatusCode != http.StatusOK {
+		t.Errorf("after a write: %d, want 200", resp.StatusCode)
+	}
+
+	// Tags follow content, not just the version: servers agree on the same
+	// ranking at the same version, and not on different ones (as after an
+	// in-memory store restarts).
+	tag := func(items string) string {
+		srv := newTestServer(t, nil)
+		do(t, "POST", srv.URL+"/rank", `{"cohort_id":"c1","items":`+items+`}`, nil)
+		return do(t, "GET", srv.URL+"/rank/c1", "", nil).Header.Get("ETag")
+	}
+	same := `[{"user_id":"a","percent":90},{"user_id":"b","percent":80}]`
+	if tag(same) != tag(same) {
+		t.Error("same ranking, different ETags")
+	}
+	if tag(same) == tag(`[{"user_id":"a","percent":10},{"user_id":"b","percent":80}]`) {
+		t.Error("different rankings, same ETag")
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ranking-go/internal/export"
+)
+
+// exportRequest asks /rank to write its results to a configured target
+// instead of returning them.
+type exportRequest struct {
+	Target string `json:"target"`
+	Format string `json:"format"` // json (default) or csv
+}
+
+type exportResult struct {
+	Target   string `json:"target"`
+	Format   string `json:"format"`
+	Location string `json:"location"`
+	SHA256   string `json:"sha256"`
+	Bytes    int    `json:"bytes"`
+}
+
+type exportResponse struct {
+	CohortID string       `json:"cohort_id"`
+	Export   exportResult `json:"export"`
+}
+
+func (e *exportRequest) validate(targets map[string]export.Target) error {
+	if _, ok := targets[e.Target]; !ok {
+		return fmt.Errorf("export target %q is not configured", e.Target)
+	}
+	switch e.Format {
+	case "":
+		e.Format = "json"
+	case "json", "csv":
+	default:
+		return fmt.Errorf("export format must be json or csv, got %q", e.Format)
+	}
+	return nil
+}
+
+// exportRanking encodes resp and writes it to the requested target. The
+// checksum is over exactly the bytes written.
+func (s *Server) exportRanking(r *http.Request, tenantID string, e exportRequest, resp rankResponse) (exportResult, error) {
+	var buf bytes.Buffer
+	contentType := "application/json"
+	if e.Format == "csv" {
+		contentType = "text/csv"
+		if err := writeCSV(&buf, resp.Results); err != nil {
+			return exportResult{}, err
+		}
+	} else if err := json.NewEncoder(&buf).Encode(resp); err != nil {
+		return exportResult{}, err
+	}
+
+	cohort := resp.CohortID
+	if cohort == "" {
+		cohort = "unnamed"
+	}
+	key, err := export.Key(tenantID, cohort, time.Now().UTC().Format("20060102T150405.000000000Z")+"."+e.Format)
+	if err != nil {
+		return exportResult{}, err
+	}
+	loc, err := s.Exports[e.Target].Put(r.Context(), key, contentType, buf.Bytes())
+	if err != nil {
+		return exportResult{}, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return exportResult{
+		Target:   e.Target,
+		Format:   e.Format,
+		Location: loc,
+		SHA256:   hex.EncodeToString(sum[:]),
+		Bytes:    buf.Len(),
+	}, nil
+}
+
+// writeCSV writes user_id,rank,percentile,percent,badge rows; a null
+// percentile is empty, as is the badge of a user without one.
+func writeCSV(w io.Writer, results []rankResult) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"user_id", "rank", "percentile", "percent", "badge"})
+	for _, r := range results {
+		pct := ""
+		if r.Percentile != nil {
+			pct = strconv.FormatFloat(*r.Percentile, 'f', -1, 64)
+		}
+		_ = cw.Write([]string{
+			csvText(r.UserID),
+			strconv.Itoa(r.Rank),
+			pct,
+			strconv.FormatFloat(r.percent, 'f', -1, 64),
+			csvText(r.Badge),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvText defuses a text cell that a spreadsheet would read as a formula
+// (CSV injection) by prefixing it with an apostrophe, which spreadsheets
+// don't display.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
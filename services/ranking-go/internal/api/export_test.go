@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"ranking-go/internal/export"
+	"ranking-go/internal/store"
+)
+
+type failingTarget struct{}
+
+func (failingTarget) Put(context.Context, string, string, []byte) (string, error) {
+	return "", errors.New("bucket unavailable")
+}
+
+func newExportServer(t *testing.T, targets map[string]export.Target) *httptest.Server {
+	t.Helper()
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Exports = targets
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func readExport(t *testing.T, e exportResult) string {
+	t.Helper()
+	u, err := url.Parse(e.Location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(u.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(b)
+	if hex.EncodeToString(sum[:]) != e.SHA256 || len(b) != e.Bytes {
+		t.Errorf("checksum/size mismatch: file %x (%d bytes), response %s (%d bytes)", sum, len(b), e.SHA256, e.Bytes)
+	}
+	return string(b)
+}
+
+func TestExportToLocalFS(t *testing.T) {
+	ts := newExportServer(t, map[string]export.Target{"local": export.LocalFS{Dir: t.TempDir()}})
+	const items = `"items":[{"user_id":"a","percent":40},{"user_id":"b","percent":90}]`
+
+	resp := do(t, "POST", ts.URL+"/rank", `{"cohort_id":"mock-1",`+items+`,"export":{"target":"local","format":"csv"}}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[exportResponse](t, resp)
+	if got.CohortID != "mock-1" || got.Export.Format != "csv" {
+		t.Errorf("unexpected response %+v", got)
+	}
+	if body := readExport(t, got.Export); body != "user_id,rank,percentile,percent,badge\nb,1,100,90,\na,2,0,40,\n" {
+		t.Errorf("csv contents %q", body)
+	}
+
+	got = decode[exportResponse](t, do(t, "POST", ts.URL+"/rank", `{"cohort_id":"mock-1",`+items+`,"export":{"target":"local"}}`, nil))
+	want := `{"cohort_id":"mock-1","results":[{"user_id":"b","rank":1,"percentile":100},{"user_id":"a","rank":2,"percentile":0}]}` + "\n"
+	if body := readExport(t, got.Export); body != want {
+		t.Errorf("json contents %q", body)
+	}
+}
+
+func TestExportFailureIsAnError(t *testing.T) {
+	ts := newExportServer(t, map[string]export.Target{"s3": failingTarget{}})
+	resp := do(t, "POST", ts.URL+"/rank", `{"cohort_id":"mock-1","items":[{"user_id":"a","percent":1}],"export":{"target":"s3"}}`, nil)
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status %d, want 502", resp.StatusCode)
+	}
+	if resp := do(t, "GET", ts.URL+"/rank/mock-1", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("failed export should not store the ranking: status %d", resp.StatusCode)
+	}
+}
+
+func TestExportUnknownTarget(t *testing.T) {
+	ts := newExportServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank", `{"items":[],"export":{"target":"s3"}}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// field_case selects the response's JSON key convention. The response
+// structs only know snake_case; camel is a rewrite of the encoded keys
+// (user_id -> userId), so both conventions always carry exactly the same
+// fields and values.
+const (
+	fieldCaseSnake = "snake"
+	fieldCaseCamel = "camel"
+)
+
+// withCase wraps v so it marshals with fieldCase's keys.
+func withCase(v any, fieldCase string) any {
+	if fieldCase == fieldCaseCamel {
+		return camelJSON{v}
+	}
+	return v
+}
+
+// camelJSON marshals its value with every object key in camelCase.
+type camelJSON struct{ v any }
+
+func (c camelJSON) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(c.v)
+	if err != nil {
+		return nil, err
+	}
+	return camelKeys(b)
+}
+
+// camelKeys re-emits the JSON document b token by token, renaming object
+// keys and leaving values (including numbers, via UseNumber) untouched.
+func camelKeys(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var out bytes.Buffer
+	// One frame per open container: whether it's an object, and how many
+	// tokens (keys and values) it has emitted.
+	type frame struct {
+		obj bool
+		n   int
+	}
+	var stack []frame
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if len(stack) == 0 && out.Len() > 0 {
+				return out.Bytes(), nil
+			}
+			return nil, err
+		}
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			out.WriteByte(byte(d))
+			continue
+		}
+		if len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.obj && top.n%2 == 0 {
+				if top.n > 0 {
+					out.WriteByte(',')
+				}
+				top.n++
+				key, _ := json.Marshal(snakeToCamel(tok.(string)))
+				out.Write(key)
+				out.WriteByte(':')
+				continue
+			}
+			if !top.obj && top.n > 0 {
+				out.WriteByte(',')
+			}
+			top.n++
+		}
+		switch v := tok.(type) {
+		case json.Delim:
+			out.WriteByte(byte(v))
+			stack = append(stack, frame{obj: v == '{'})
+		case json.Number:
+			out.WriteString(v.String())
+		case nil:
+			out.WriteString("null")
+		default:
+			s, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(s)
+		}
+	}
+}
+
+func snakeToCamel(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if p := parts[i]; p != "" {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func validFieldCase(fc string) error {
+	switch fc {
+	case "", fieldCaseSnake, fieldCaseCamel:
+		return nil
+	}
+	return fmt.Errorf("field_case must be %s or %s, got %q", fieldCaseSnake, fieldCaseCamel, fc)
+}
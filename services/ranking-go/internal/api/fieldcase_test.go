@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// camelize renames the keys of a decoded JSON document, recursively.
+func camelize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, x := range v {
+			out[snakeToCamel(k)] = camelize(x)
+		}
+		return out
+	case []any:
+		for i := range v {
+			v[i] = camelize(v[i])
+		}
+	}
+	return v
+}
+
+func keys(v any, into map[string]bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, x := range v {
+			into[k] = true
+			keys(x, into)
+		}
+	case []any:
+		for _, x := range v {
+			keys(x, into)
+		}
+	}
+}
+
+func TestFieldCaseCamel(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const body = `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":70},{"user_id":"c","percent":70}],
+		"transform":"log","include_scores":true,"include_t_score":true,"include_curve":true,"null_last_tie_percentile":true,
+		"bucket_by":"range(percent, 80)"`
+	// Store once first so both responses carry rank changes.
+	do(t, "POST", ts.URL+"/rank", body+`}`, nil).Body.Close()
+	var snake, camel any
+	for _, c := range []struct {
+		extra string
+		into  *any
+	}{{`}`, &snake}, {`,"field_case":"camel"}`, &camel}} {
+		resp := do(t, "POST", ts.URL+"/rank", body+c.extra, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d", resp.StatusCode)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(c.into); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Stored once more for camel.
+	snake.(map[string]any)["version"] = camel.(map[string]any)["version"]
+	snake.(map[string]any)["previous_version"] = camel.(map[string]any)["previousVersion"]
+
+	seen := map[string]bool{}
+	keys(camel, seen)
+	for _, k := range []string{"cohortId", "userId", "transformedScore", "tScore", "meanPercent", "userIds", "rankChange"} {
+		if !seen[k] {
+			t.Errorf("camel response lacks %q", k)
+		}
+	}
+	for k := range seen {
+		if strings.Contains(k, "_") {
+			t.Errorf("camel response has snake key %q", k)
+		}
+	}
+	if !reflect.DeepEqual(camelize(snake), camel) {
+		t.Errorf("camel response differs structurally:\nsnake %v\ncamel %v", snake, camel)
+	}
+}
+
+func TestFieldCaseColumnsAndBatch(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":1}],"format":"columns","field_case":"camel"}`, nil)
+	var cols map[string]any
+	json.NewDecoder(resp.Body).Decode(&cols)
+	if _, ok := cols["userIds"]; !ok {
+		t.Errorf("columns: got %v", cols)
+	}
+
+	resp = do(t, "POST", ts.URL+"/rank/batch", `[{"cohort_id":"x","items":[{"user_id":"a","percent":1}],"field_case":"camel"},{"cohort_id":"y","items":[]}]`, nil)
+	var entries []map[string]any
+	json.NewDecoder(resp.Body).Decode(&entries)
+	if _, ok := entries[0]["cohortId"]; !ok {
+		t.Errorf("batch camel entry: %v", entries[0])
+	}
+	if _, ok := entries[1]["cohort_id"]; !ok {
+		t.Errorf("batch snake entry: %v", entries[1])
+	}
+
+	if resp := do(t, "POST", ts.URL+"/rank", `{"items":[],"field_case":"kebab"}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("kebab: status %d, want 400", resp.StatusCode)
+	}
+}
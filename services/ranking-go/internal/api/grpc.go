@@ -0,0 +1,246 @@
+package api
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=ranking-go --go-grpc_out=../.. --go-grpc_opt=module=ranking-go ranking/v1/ranking.proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	grpcstatus "google.golang.org/grpc/status"
+
+	"ranking-go/internal/auth"
+	"ranking-go/internal/ratelimit"
+	"ranking-go/internal/rpc/rankingv1"
+	"ranking-go/internal/tenant"
+)
+
+// errorDomain is the ErrorInfo domain of the problem codes a failed gRPC
+// call carries.
+const errorDomain = "ranking-go"
+
+// Each RankingService method is the HTTP route of the same name, with its
+// authentication, rate limit and service-layer call.
+const (
+	routeRank        = "POST /rank"
+	routeLeaderboard = "GET /leaderboard/{cohort_id}"
+	routeUserRank    = "GET /rank/{cohort_id}/users/{user_id}"
+)
+
+// RegisterGRPC serves the RankingService (proto/ranking/v1) on gs. The
+// "authorization", "x-api-key" and "x-tenant" metadata keys authenticate
+// a call and pick its tenant as the headers do over HTTP.
+func (s *Server) RegisterGRPC(gs *grpc.Server) {
+	rankingv1.RegisterRankingServiceServer(gs, &grpcService{
+		s: s,
+		limiters: map[string]*ratelimit.Limiter{
+			routeRank:        s.limiterFor(routeRank),
+			routeLeaderboard: s.limiterFor(routeLeaderboard),
+			routeUserRank:    s.limiterFor(routeUserRank),
+		},
+	})
+}
+
+type grpcService struct {
+	rankingv1.UnimplementedRankingServiceServer
+	s        *Server
+	limiters map[string]*ratelimit.Limiter
+}
+
+// caller authenticates a call to route, rate limits it and resolves its
+// tenant. The context returned carries the caller's principal.
+func (g *grpcService) caller(ctx context.Context, route string) (context.Context, *tenant.Tenant, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(k string) string {
+		if vs := md.Get(k); len(vs) > 0 {
+			return vs[0]
+		}
+		return ""
+	}
+	c := credentials{authorization: get("authorization"), apiKey: get("x-api-key"), tenant: get("x-tenant")}
+	p, err := g.s.Auth.authenticate(ctx, c, g.s.Tenants != nil)
+	switch {
+	case errors.Is(err, auth.ErrInvalidToken):
+		return ctx, nil, &serviceError{http.StatusUnauthorized, codeInvalidToken, err}
+	case errors.Is(err, errCredentialsRequired) || errors.Is(err, errUnknownKey):
+		return ctx, nil, &serviceError{http.StatusUnauthorized, codeUnauthorized, err}
+	case err != nil:
+		g.s.logger().Error("auth: verifying token", "error", err)
+		return ctx, nil, &serviceError{http.StatusServiceUnavailable, codeAuthUnavailable, errors.New("cannot verify token")}
+	}
+	if p != nil {
+		ctx = auth.NewContext(ctx, p)
+	}
+	ip := ""
+	if pr, ok := peer.FromContext(ctx); ok && pr.Addr != nil {
+		ip = pr.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+	if ok, _ := g.limiters[route].Allow(g.s.clientKey(ctx, c, ip)); !ok {
+		return ctx, nil, &serviceError{http.StatusTooManyRequests, codeRateLimited, errors.New("rate limit exceeded")}
+	}
+	t, err := g.s.tenantFor(ctx, c)
+	switch {
+	case errors.Is(err, tenant.ErrUnauthorized):
+		return ctx, nil, &serviceError{http.StatusUnauthorized, codeUnauthorized, err}
+	case err != nil:
+		return ctx, nil, &serviceError{http.StatusForbidden, codeForbidden, err}
+	}
+	return ctx, t, nil
+}
+
+// Rank is POST /rank: options_json holds any /rank options on top of the
+// tenant's defaults, and the message's cohort_id and items replace any
+// there. Exports and callbacks are HTTP-only.
+func (g *grpcService) Rank(ctx context.Context, in *rankingv1.RankRequest) (*rankingv1.RankResponse, error) {
+	ctx, t, err := g.caller(ctx, routeRank)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	req := rankRequest{rankOptions: g.s.defaultsFor(t)}
+	if len(in.GetOptionsJson()) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(in.GetOptionsJson()))
+		if err := dec.Decode(&req); err != nil {
+			return nil, grpcError(&serviceError{http.StatusBadRequest, codeInvalidJSON, errors.New("invalid options_json: " + err.Error())})
+		}
+	}
+	if req.CallbackURL != "" || req.Export != nil {
+		return nil, grpcError(&serviceError{http.StatusBadRequest, codeInvalidRequest, errors.New("export and callback_url are only supported over HTTP")})
+	}
+	req.CohortID = in.GetCohortId()
+	req.Items = make([]rankItem, len(in.GetItems()))
+	for i, it := range in.GetItems() {
+		req.Items[i] = rankItem{
+			UserID:  it.GetUserId(),
+			Percent: it.GetPercent(),
+			Tier:    it.GetTier(),
+			Metrics: it.GetMetrics(),
+			Arrival: it.Arrival,
+			Weight:  it.GetWeight(),
+		}
+	}
+	if err := g.s.checkRankRequest(t, &req); err != nil {
+		return nil, grpcError(err)
+	}
+	resp, results, err := g.s.rankChecked(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if req.CohortID != "" {
+		if err := g.s.storeRanked(ctx, t.ID, req, results, &resp); err != nil {
+			return nil, grpcError(err)
+		}
+	}
+	return &rankingv1.RankResponse{
+		CohortId:         resp.CohortID,
+		Version:          resp.Version,
+		Results:          grpcResults(resp.Results, resp.PercentileDivisor),
+		PercentileMethod: string(resp.PercentileMethod),
+	}, nil
+}
+
+// GetLeaderboard is GET /leaderboard/{cohort_id}; limit 0 is the default.
+func (g *grpcService) GetLeaderboard(ctx context.Context, in *rankingv1.GetLeaderboardRequest) (*rankingv1.GetLeaderboardResponse, error) {
+	ctx, t, err := g.caller(ctx, routeLeaderboard)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	limit := int(in.GetLimit())
+	if limit == 0 {
+		limit = defaultLeaderboardLimit
+	}
+	_, out, err := g.s.leaderboardPage(ctx, t.ID, in.GetCohortId(), limit, in.GetCursor())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &rankingv1.GetLeaderboardResponse{
+		CohortId:   out.CohortID,
+		Version:    out.Version,
+		CohortSize: int64(out.CohortSize),
+		Results:    grpcResults(out.Results, out.PercentileDivisor),
+		NextCursor: out.NextCursor,
+	}, nil
+}
+
+// GetUserRank is GET /rank/{cohort_id}/users/{user_id}.
+func (g *grpcService) GetUserRank(ctx context.Context, in *rankingv1.GetUserRankRequest) (*rankingv1.GetUserRankResponse, error) {
+	ctx, t, err := g.caller(ctx, routeUserRank)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	_, out, err := g.s.userRank(ctx, t.ID, in.GetCohortId(), in.GetUserId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &rankingv1.GetUserRankResponse{
+		CohortId:   out.CohortID,
+		Version:    out.Version,
+		CohortSize: int64(out.CohortSize),
+		Result:     grpcResults([]rankResult{out.rankResult}, out.PercentileDivisor)[0],
+	}, nil
+}
+
+// grpcResults converts result rows, with percentiles as percentages
+// whatever the percentile_encoding.
+func grpcResults(rows []rankResult, divisor int) []*rankingv1.RankResult {
+	out := make([]*rankingv1.RankResult, len(rows))
+	for i, r := range rows {
+		p := r.Percentile
+		if p != nil && divisor > 0 {
+			v := *p / float64(divisor)
+			p = &v
+		}
+		out[i] = &rankingv1.RankResult{
+			UserId:         r.UserID,
+			Rank:           int64(r.Rank),
+			Percentile:     p,
+			FractionalRank: r.FractionalRank,
+		}
+	}
+	return out
+}
+
+// grpcError is a service-layer failure as a gRPC status: its code follows
+// the problem's HTTP status, its message is the problem's detail and its
+// ErrorInfo reason the problem's code.
+func grpcError(err error) error {
+	p := problemFor(err)
+	st := grpcstatus.New(grpcCode(p.Status), p.Detail)
+	if withInfo, err := st.WithDetails(&errdetails.ErrorInfo{Reason: p.Code, Domain: errorDomain}); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
+// grpcCode maps an HTTP error status to the nearest gRPC code.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusGone:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
+
+	"ranking-go/internal/ratelimit"
+	"ranking-go/internal/rpc/rankingv1"
+	"ranking-go/internal/store"
+)
+
+// grpcClient serves srv over HTTP and gRPC, the gRPC side on an in-memory
+// connection.
+func grpcClient(t *testing.T, srv *Server) (rankingv1.RankingServiceClient, *httptest.Server) {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	srv.RegisterGRPC(gs)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return rankingv1.NewRankingServiceClient(conn), ts
+}
+
+// wantGRPCError checks err's code and the problem code in its ErrorInfo.
+func wantGRPCError(t *testing.T, err error, code codes.Code, reason string) {
+	t.Helper()
+	st := grpcstatus.Convert(err)
+	if st.Code() != code {
+		t.Fatalf("got %v, want %v", err, code)
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.Reason == reason && info.Domain == errorDomain {
+			return
+		}
+	}
+	t.Errorf("%v: no ErrorInfo with reason %s", err, reason)
+}
+
+func TestGRPC(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Defaults.PercentileEncoding = "bp"
+	c, ts := grpcClient(t, srv)
+	ctx := context.Background()
+	arrival := 1.0
+	resp, err := c.Rank(ctx, &rankingv1.RankRequest{
+		CohortId: "exam",
+		Items: []*rankingv1.Item{
+			{UserId: "a", Percent: 90},
+			{UserId: "b", Percent: 70, Arrival: &arrival},
+			{UserId: "c", Percent: 80},
+		},
+		OptionsJson: []byte(`{"strategy": "dense"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetCohortId() != "exam" || resp.GetVersion() != 1 || len(resp.GetResults()) != 3 {
+		t.Fatalf("got %v", resp)
+	}
+	// Percentiles are percentages, not basis points.
+	if r := resp.GetResults()[0]; r.GetUserId() != "a" || r.GetRank() != 1 || r.Percentile == nil || r.GetPercentile() <= 0 || r.GetPercentile() > 100 {
+		t.Errorf("first result %v", r)
+	}
+
+	// The cohort is the one HTTP sees.
+	got := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/exam", "", nil))
+	if ids := userIDs(got.Results); len(ids) != 3 || got.Version != 1 {
+		t.Errorf("over HTTP: %v at version %d", ids, got.Version)
+	}
+
+	page, err := c.GetLeaderboard(ctx, &rankingv1.GetLeaderboardRequest{CohortId: "exam", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.GetCohortSize() != 3 || page.GetVersion() != 1 || len(page.GetResults()) != 2 || page.GetNextCursor() == "" {
+		t.Fatalf("first page %v", page)
+	}
+	cursor := page.GetNextCursor()
+	page, err = c.GetLeaderboard(ctx, &rankingv1.GetLeaderboardRequest{CohortId: "exam", Limit: 2, Cursor: cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.GetResults()) != 1 || page.GetResults()[0].GetUserId() != "b" || page.GetNextCursor() != "" {
+		t.Errorf("last page %v", page)
+	}
+
+	user, err := c.GetUserRank(ctx, &rankingv1.GetUserRankRequest{CohortId: "exam", UserId: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.GetCohortSize() != 3 || user.GetResult().GetUserId() != "c" || user.GetResult().GetRank() != 2 {
+		t.Errorf("got %v", user)
+	}
+
+	// Errors carry the HTTP API's problem codes.
+	_, err = c.Rank(ctx, &rankingv1.RankRequest{Items: []*rankingv1.Item{{UserId: "a", Percent: 101}}})
+	wantGRPCError(t, err, codes.InvalidArgument, codeInvalidPercent)
+	_, err = c.Rank(ctx, &rankingv1.RankRequest{OptionsJson: []byte(`[1]`)})
+	wantGRPCError(t, err, codes.InvalidArgument, codeInvalidJSON)
+	_, err = c.Rank(ctx, &rankingv1.RankRequest{OptionsJson: []byte(`{"strategy": "sideways"}`)})
+	wantGRPCError(t, err, codes.InvalidArgument, codeInvalidOptions)
+	_, err = c.GetLeaderboard(ctx, &rankingv1.GetLeaderboardRequest{CohortId: "missing"})
+	wantGRPCError(t, err, codes.NotFound, codeCohortNotFound)
+	_, err = c.GetLeaderboard(ctx, &rankingv1.GetLeaderboardRequest{CohortId: "exam", Limit: 5000})
+	wantGRPCError(t, err, codes.InvalidArgument, codeInvalidRequest)
+	_, err = c.GetUserRank(ctx, &rankingv1.GetUserRankRequest{CohortId: "exam", UserId: "z"})
+	wantGRPCError(t, err, codes.NotFound, codeUserNotFound)
+	if _, err := c.Rank(ctx, &rankingv1.RankRequest{CohortId: "exam", Items: []*rankingv1.Item{{UserId: "a", Percent: 50}}}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetLeaderboard(ctx, &rankingv1.GetLeaderboardRequest{CohortId: "exam", Limit: 2, Cursor: cursor})
+	wantGRPCError(t, err, codes.FailedPrecondition, codeStaleCursor)
+}
+
+func TestGRPCAuthAndRateLimit(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Auth = Auth{Required: true, ServiceKeys: []string{"svc-key"}}
+	srv.RateLimit = RateLimit{
+		Default: ratelimit.Limit{Rate: 0.01, Burst: 10},
+		Routes:  map[string]ratelimit.Limit{"POST /rank": {Rate: 0.01, Burst: 2}},
+	}
+	c, ts := grpcClient(t, srv)
+	req := &rankingv1.RankRequest{Items: []*rankingv1.Item{{UserId: "a", Percent: 50}}}
+
+	_, err := c.Rank(context.Background(), req)
+	wantGRPCError(t, err, codes.Unauthenticated, codeUnauthorized)
+
+	// The metadata authenticates as the headers do, and the route's bucket
+	// is shared with HTTP.
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "svc-key", "x-tenant", "acme")
+	if _, err := c.Rank(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if resp := do(t, "POST", ts.URL+"/rank", `{"items":[]}`, map[string]string{"X-API-Key": "svc-key"}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("HTTP /rank: status %d", resp.StatusCode)
+	}
+	_, err = c.Rank(ctx, req)
+	wantGRPCError(t, err, codes.ResourceExhausted, codeRateLimited)
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressibleTypes are the response types gzipped. Event streams are
+// left alone, so each event reaches the client as it is sent, and so are
+// already-compressed types such as .xlsx.
+var compressibleTypes = map[string]bool{
+	"application/json":         true,
+	"application/problem+json": true,
+	"application/x-ndjson":     true,
+	"text/csv":                 true,
+	"text/html":                true,
+	"text/plain":               true,
+}
+
+// gzipWriters pools gzip writers by level, since each holds a large
+// compression window.
+var gzipWriters sync.Map // level -> *sync.Pool
+
+func gzipPool(level int) *sync.Pool {
+	if p, ok := gzipWriters.Load(level); ok {
+		return p.(*sync.Pool)
+	}
+	p, _ := gzipWriters.LoadOrStore(level, &sync.Pool{New: func() any {
+		gz, _ := gzip.NewWriterLevel(nil, level)
+		return gz
+	}})
+	return p.(*sync.Pool)
+}
+
+// compressed decodes gzip request bodies and, with Compression enabled,
+// gzips responses of compressibleTypes of at least Compression.MinBytes
+// for clients that accept it. It runs outside limitBody, so
+// Limits.MaxBodyBytes bounds the decompressed body.
+func (s *Server) compressed(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid gzip body: "+err.Error())
+				return
+			}
+			defer zr.Close()
+			r.Body = zr
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+		default:
+			w.Header().Set("Accept-Encoding", "gzip")
+			writeProblem(w, r, http.StatusUnsupportedMediaType, codeUnsupportedEncoding, "Content-Encoding must be gzip or identity, got "+strconv.Quote(enc))
+			return
+		}
+
+		c := s.Compression
+		if !c.Enabled {
+			h(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			h(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w, minBytes: c.MinBytes, level: c.Level, ifNoneMatch: r.Header.Get("If-None-Match")}
+		defer gw.close()
+		h(gw, r)
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip", "x-gzip", "*":
+		default:
+			continue
+		}
+		name, q, _ := strings.Cut(strings.TrimSpace(params), "=")
+		if strings.TrimSpace(name) == "q" {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(q), 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipETag is the tag of the gzipped form of a response tagged etag:
+// "-gzip" inside a strong tag's quotes. A weak tag already stands for
+// either encoding and is kept.
+func gzipETag(etag string) string {
+	if strings.HasPrefix(etag, "W/") || len(etag) < 2 || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return etag[:len(etag)-1] + `-gzip"`
+}
+
+// gzipWriter holds back the status and the first minBytes of the body,
+// then decides: a compressible response that reaches minBytes, or is
+// flushed first, is gzipped; anything else is passed through as it is.
+// FlushError flushes through the compressor, and Unwrap keeps the rest of
+// http.ResponseController (deadlines, hijacking) working.
+type gzipWriter struct {
+	http.ResponseWriter
+	minBytes    int
+	level       int
+	ifNoneMatch string
+
+	status  int // held back until decided; 0 if none yet
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (g *gzipWriter) WriteHeader(code int) {
+	switch {
+	case g.decided:
+		g.ResponseWriter.WriteHeader(code)
+	case code < 200:
+		// Informational responses go out at once.
+		g.ResponseWriter.WriteHeader(code)
+	case g.status == 0:
+		g.status = code
+		if code == http.StatusNoContent || code == http.StatusNotModified {
+			g.decide(false)
+		}
+	}
+}
+
+func (g *gzipWriter) Write(b []byte) (int, error) {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if !g.decided {
+		if !g.compressible() {
+			g.decide(false)
+		} else {
+			g.buf = append(g.buf, b...)
+			if len(g.buf) >= g.minBytes {
+				g.decide(true)
+			}
+			return len(b), nil
+		}
+	}
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// compressible reports whether the response, as its headers stand, may
+// be gzipped.
+func (g *gzipWriter) compressible() bool {
+	h := g.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	mt, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return compressibleTypes[mt]
+}
+
+// decide sends the held-back status and body, gzipped or not.
+func (g *gzipWriter) decide(compress bool) {
+	g.decided = true
+	h := g.Header()
+	// The gzipped body is other bytes than the identity one, so it gets a
+	// tag of its own; a 304 confirms the form the client holds.
+	if etag := h.Get("ETag"); etag != "" && (compress || g.status == http.StatusNotModified && etagListed(g.ifNoneMatch, gzipETag(etag))) {
+		h.Set("ETag", gzipETag(etag))
+	}
+	if compress {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		pool := gzipPool(g.level)
+		g.gz = pool.Get().(*gzip.Writer)
+		g.gz.Reset(g.ResponseWriter)
+	}
+	if g.status != 0 {
+		g.ResponseWriter.WriteHeader(g.status)
+	}
+	if len(g.buf) > 0 {
+		if g.gz != nil {
+			g.gz.Write(g.buf)
+		} else {
+			g.ResponseWriter.Write(g.buf)
+		}
+	}
+	g.buf = nil
+}
+
+// FlushError sends what has been written so far, committing a response
+// still held back to compression if its type allows.
+func (g *gzipWriter) FlushError() error {
+	if !g.decided {
+		if g.status == 0 {
+			g.status = http.StatusOK
+		}
+		g.decide(g.compressible())
+	}
+	if g.gz != nil {
+		if err := g.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+func (g *gzipWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// close finishes the response once the handler returns. A response that
+// never wrote anything (or was hijacked) is left to the server.
+func (g *gzipWriter) close() {
+	if !g.decided && g.status != 0 {
+		g.decide(false)
+	}
+	if g.gz != nil {
+		g.gz.Close()
+		g.gz.Reset(nil)
+		gzipPool(g.level).Put(g.gz)
+		g.gz = nil
+	}
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ranking-go/internal/store"
+)
+
+func gzipped(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func gunzip(t *testing.T, r io.Reader) string {
+	t.Helper()
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func cohortJSON(id string, n int) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"user_id":"u%d","percent":%d}`, i, i%101)
+	}
+	return `{"cohort_id":"` + id + `","items":[` + strings.Join(items, ",") + `]}`
+}
+
+func TestGzipRequests(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Limits.MaxBodyBytes = 64 << 10
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	gz := map[string]string{"Content-Encoding": "gzip"}
+
+	resp := do(t, "POST", ts.URL+"/rank", gzipped(t, cohortJSON("c1", 100)), gz)
+	if got := decode[rankResponse](t, resp); resp.StatusCode != http.StatusOK || len(got.Results) != 100 {
+		t.Fatalf("gzip body: %d, %d results", resp.StatusCode, len(got.Results))
+	}
+
+	// The body limit applies to what the body inflates to.
+	big := cohortJSON("c2", 5000)
+	if len(gzipped(t, big)) >= 64<<10 || len(big) < 64<<10 {
+		t.Fatal("test body doesn't straddle the limit")
+	}
+	if resp := do(t, "POST", ts.URL+"/rank", gzipped(t, big), gz); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("inflated past the limit: %d, want 413", resp.StatusCode)
+	}
+
+	if resp := do(t, "POST", ts.URL+"/rank", cohortJSON("c3", 1), gz); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("not gzip: %d, want 400", resp.StatusCode)
+	}
+	resp = do(t, "POST", ts.URL+"/rank", cohortJSON("c3", 1), map[string]string{"Content-Encoding": "br"})
+	if p := decode[problem](t, resp); resp.StatusCode != http.StatusUnsupportedMediaType || p.Code != codeUnsupportedEncoding || resp.Header.Get("Accept-Encoding") != "gzip" {
+		t.Errorf("br: %d %+v", resp.StatusCode, p)
+	}
+}
+
+func TestGzipResponses(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", cohortJSON("c1", 200), nil)
+	gz := map[string]string{"Accept-Encoding": "gzip, br"}
+
+	plain := do(t, "GET", ts.URL+"/rank/c1", "", map[string]string{"Accept-Encoding": "identity"})
+	want, _ := io.ReadAll(plain.Body)
+	resp := do(t, "GET", ts.URL+"/rank/c1", "", gz)
+	if resp.Header.Get("Content-Encoding") != "gzip" || resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("headers %v", resp.Header)
+	}
+	if got := gunzip(t, resp.Body); got != string(want) {
+		t.Errorf("inflated body differs:\n%s\nwant\n%s", got, want)
+	}
+	if plain.Header.Get("Content-Encoding") != "" || plain.Header.Get("Vary") != "Accept-Encoding" {
+		t.Errorf("identity: headers %v", plain.Header)
+	}
+	// The encodings have tags of their own, and either revalidates.
+	etag := plain.Header.Get("ETag")
+	if got := resp.Header.Get("ETag"); got != strings.TrimSuffix(etag, `"`)+`-gzip"` {
+		t.Errorf("ETag %q, uncompressed %q", got, etag)
+	}
+	for _, inm := range []string{etag, resp.Header.Get("ETag")} {
+		for _, accept := range []string{"gzip", "identity"} {
+			resp := do(t, "GET", ts.URL+"/rank/c1", "", map[string]string{"Accept-Encoding": accept, "If-None-Match": inm})
+			if resp.StatusCode != http.StatusNotModified {
+				t.Errorf("If-None-Match %s, %s: status %d, want 304", inm, accept, resp.StatusCode)
+			}
+			// The 304 confirms the tag the client sent, if it may hold it.
+			want := etag
+			if accept == "gzip" {
+				want = inm
+			}
+			if resp.Header.Get("ETag") != want {
+				t.Errorf("If-None-Match %s, %s: ETag %q, want %q", inm, accept, resp.Header.Get("ETag"), want)
+			}
+		}
+	}
+
+	// Small responses, refused gzip and event streams go as they are.
+	for name, req := range map[string]struct{ path, accept string }{
+		"small":   {"/rank/c1/users/u1", "gzip"},
+		"refused": {"/rank/c1", "gzip;q=0, identity"},
+	} {
+		resp := do(t, "GET", ts.URL+req.path, "", map[string]string{"Accept-Encoding": req.accept})
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" {
+			t.Errorf("%s: %d, Content-Encoding %q", name, resp.StatusCode, resp.Header.Get("Content-Encoding"))
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/rank/c1/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	sse, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sse.Body.Close()
+	first := make([]byte, len("event: ready"))
+	if _, err := io.ReadFull(sse.Body, first); err != nil || sse.Header.Get("Content-Encoding") != "" || string(first) != "event: ready" {
+		t.Errorf("stream: Content-Encoding %q, first bytes %q, %v", sse.Header.Get("Content-Encoding"), first, err)
+	}
+
+	// A streamed response is compressed as it is flushed.
+	batch := do(t, "POST", ts.URL+"/rank/batch", `[`+cohortJSON("b1", 3)+`,`+cohortJSON("b2", 3)+`]`, gz)
+	if batch.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("batch: headers %v", batch.Header)
+	}
+	if body := gunzip(t, batch.Body); !strings.Contains(body, `"b1"`) || !strings.Contains(body, `"b2"`) {
+		t.Errorf("batch body %s", body)
+	}
+}
+
+func TestGzipDisabled(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Compression.Enabled = false
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	resp := do(t, "POST", ts.URL+"/rank", gzipped(t, cohortJSON("c1", 200)), map[string]string{"Content-Encoding": "gzip", "Accept-Encoding": "gzip"})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Vary") != "" {
+		t.Errorf("%d, headers %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"deflate, GZIP;q=0.5": true,
+		"gzip;q=0":            false,
+		"gzip; q=0.0, br":     false,
+		"*":                   true,
+		"br, identity":        false,
+	} {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
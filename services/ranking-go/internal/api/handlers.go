@@ -1,74 +1,1027 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
+	"ranking-go/internal/config"
+	"ranking-go/internal/export"
+	"ranking-go/internal/health"
 	"ranking-go/internal/rank"
+	"ranking-go/internal/ratelimit"
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+	"ranking-go/internal/tracing"
 )
 
-func RegisterHandlers(mux *http.ServeMux) {
-	mux.HandleFunc("GET /health", health)
-	mux.HandleFunc("POST /rank", rankHandler)
+// Server holds the dependencies shared by the HTTP handlers.
+type Server struct {
+	Store store.Store
+	// Tenants resolves the caller's tenant; nil trusts the X-Tenant header.
+	Tenants *tenant.Registry
+	// Auth authenticates callers before their tenant is resolved.
+	Auth Auth
+	// RateLimit throttles clients; zero rates leave them unthrottled.
+	RateLimit RateLimit
+	// Limits bounds request bodies, cohort sizes and percents.
+	Limits config.Limits
+	// Ratings are the K-factor and initial rating of /ratings.
+	Ratings config.Ratings
+	// Defaults are the options a /rank request starts from, unless its
+	// tenant has its own (see ResolveTenantDefaults).
+	Defaults rankOptions
+	// Profiles are named sets of /rank options that tenants selecting
+	// them apply over Defaults.
+	Profiles map[string]json.RawMessage
+	// Exports are the named targets a /rank request may write results to.
+	Exports map[string]export.Target
+	// Checks are the dependencies /readyz reports on.
+	Checks []health.Check
+	// ExternalSort, if set, spills the sort of large cohorts to disk.
+	ExternalSort *rank.ExternalSort
+	// AdminToken enables the admin endpoints for bearers of it.
+	AdminToken string
+	// ConfigFile is the file Defaults were loaded from, for GET /config.
+	ConfigFile string
+	// JobWorkers is how many /rank/jobs rank at once; 0 means 2.
+	JobWorkers int
+	// Cache keeps leaderboard and stats responses between writes.
+	Cache ResponseCache
+	// RankWorkers is how many cohorts one /rank/batch or /rank/merged
+	// request ranks at once; 0 means GOMAXPROCS.
+	RankWorkers int
+	// Webhook signs and retries job callbacks.
+	Webhook Webhook
+	// Tracer records request and ranking spans; nil disables tracing.
+	Tracer *tracing.Tracer
+	// Logger receives the access log; nil uses slog.Default.
+	Logger *slog.Logger
+	// Settings are the process settings shown by GET /config.
+	Settings *config.Config
+	// Compression configures gzip responses.
+	Compression config.Compression
+	// DisableJobs and DisableMetrics leave /rank/jobs and /metrics
+	// unregistered.
+	DisableJobs    bool
+	DisableMetrics bool
+
+	jobs           jobTable
+	streams        streamHub
+	live           liveBoards
+	scoreBoards    scoreBoards
+	etags          etagCache
+	cache          *responseCache
+	defaultsTag    string
+	tenantDefaults map[string]rankOptions
+	metrics        *serverMetrics
+	defaultLimiter *ratelimit.Limiter
+	limiters       map[string]*ratelimit.Limiter
+}
+
+func NewServer(st store.Store, tenants *tenant.Registry) *Server {
+	return &Server{Store: st, Tenants: tenants, Limits: config.Default().Limits, Ratings: config.Default().Ratings, Compression: config.Default().Compression, metrics: newServerMetrics()}
+}
+
+func (s *Server) RegisterHandlers(mux *http.ServeMux) {
+	s.defaultsTag = defaultsTag(s.Defaults)
+	if s.Cache.MaxBytes > 0 {
+		s.cache = newResponseCache(s.Cache)
+	}
+	wrap := func(pattern string, h http.HandlerFunc) http.HandlerFunc {
+		return s.metrics.instrument(pattern, s.traced(pattern, s.logged(pattern, s.authenticated(pattern, s.rateLimited(pattern, s.compressed(s.limitBody(h)))))))
+	}
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.HandleFunc(pattern, wrap(pattern, h))
+	}
+	cached := func(pattern string, h http.HandlerFunc) {
+		handle(pattern, s.cached(pattern, h))
+	}
+	// Read-only views of a stored cohort share one mux pattern, since
+	// "GET /rank/{cohort_id}/<view>" would conflict with "GET
+	// /rank/jobs/{id}". Each view is still instrumented, limited and
+	// logged under its own route.
+	views := map[string]http.HandlerFunc{}
+	view := func(pattern string, h http.HandlerFunc) {
+		views[pattern[strings.LastIndexByte(pattern, '/')+1:]] = wrap(pattern, h)
+	}
+	if !s.DisableMetrics {
+		mux.Handle("GET /metrics", s.metrics.registry.Handler())
+	}
+	handle("GET /health", healthHandler)
+	handle("GET /readyz", s.readyHandler)
+	handle("GET /config", s.configHandler)
+	handle("POST /bench", s.benchHandler)
+	handle("POST /rank", s.idempotent(s.rankHandler))
+	handle("GET /rank/{cohort_id}", s.getRankHandler)
+	handle("PATCH /rank/{cohort_id}", s.idempotent(s.patchRankHandler))
+	handle("GET /rank/{cohort_id}/users/{user_id}", s.userRankHandler)
+	handle("GET /rank/{cohort_id}/users/{user_id}/neighbors", s.neighborsHandler)
+	handle("GET /rank/{cohort_id}/users/{user_id}/history", s.userHistoryHandler)
+	cached("GET /leaderboard/{cohort_id}", s.leaderboardHandler)
+	handle("GET /leaderboard/{cohort_id}/live", s.liveHandler)
+	cached("GET /cohorts/{cohort_id}/stats", s.statsHandler)
+	if !s.DisableJobs {
+		handle("POST /rank/jobs", s.idempotent(s.createJobHandler))
+		handle("GET /rank/jobs/{id}", s.getJobHandler)
+	}
+	handle("POST /rank/preview", s.previewHandler)
+	handle("POST /rank/batch", s.batchHandler)
+	handle("POST /rank/percentiles", s.recomputeHandler)
+	handle("POST /rank/irt", s.irtHandler)
+	handle("POST /rank/merged", s.mergedHandler)
+	handle("POST /equate", s.equateHandler)
+	handle("POST /rank/{cohort_id}/target", s.targetHandler)
+	handle("POST /ratings/matches", s.idempotent(s.matchesHandler))
+	handle("GET /ratings/{cohort_id}", s.ratingsHandler)
+	handle("POST /digests/scores", s.idempotent(s.digestScoresHandler))
+	handle("GET /digests/{cohort_id}", s.digestHandler)
+	handle("GET /digests/{cohort_id}/percentile", s.digestPercentileHandler)
+	handle("POST /rank/{cohort_id}/scores", s.idempotent(s.scoreHandler))
+	view("GET /rank/{cohort_id}/percentile", s.percentileHandler)
+	view("GET /rank/{cohort_id}/history", s.cohortHistoryHandler)
+	view("GET /rank/{cohort_id}/stream", s.streamHandler)
+	view("GET /rank/{cohort_id}/export.xlsx", s.exportXLSXHandler)
+	mux.HandleFunc("GET /rank/{cohort_id}/{view}", func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := views[r.PathValue("view")]; ok {
+			h(w, r)
+			return
+		}
+		writeProblem(w, r, http.StatusNotFound, codeNotFound, "404 page not found")
+	})
 }
 
-func health(w http.ResponseWriter, _ *http.Request) {
+func healthHandler(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("ok"))
 }
 
+// readyHandler reports each dependency's status; 503 unless every required
+// dependency is healthy.
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	rep := health.Run(r.Context(), s.Checks, 2*time.Second)
+	w.Header().Set("Content-Type", "application/json")
+	if !rep.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(rep)
+}
+
 type rankRequest struct {
-	CohortID string       `json:"cohort_id"`
-	Items    []rankItem   `json:"items"`
+	CohortID string     `json:"cohort_id"`
+	Items    []rankItem `json:"items"`
+	rankOptions
+	// Export writes the results to a target and returns only its location.
+	Export *exportRequest `json:"export,omitempty"`
+	// CallbackURL is notified when a /rank/jobs job finishes; other
+	// endpoints reject it.
+	CallbackURL string `json:"callback_url,omitempty"`
+
+	// dropped counts the items removed by the duplicates policy.
+	dropped int
+	// subjects are the per-subject items when the items have subjects;
+	// Items then holds each user's overall item.
+	subjects []subjectItems
+}
+
+// rankOptions are the optional tuning fields of a rank request.
+type rankOptions struct {
+	TrimPercent  float64  `json:"trim_percent,omitempty"`
+	TierOrder    []string `json:"tier_order,omitempty"`
+	UnknownTier  string   `json:"unknown_tier,omitempty"`
+	TiePrecision *int     `json:"tie_precision,omitempty"`
+	// ArrivalTieBreak breaks exact ties by earliest item arrival.
+	ArrivalTieBreak bool          `json:"arrival_tie_break,omitempty"`
+	TieBreak        []tieBreakKey `json:"tie_break,omitempty"`
+	TiePriority     []string      `json:"tie_priority,omitempty"`
+	// Pins fixes users at ranks regardless of score.
+	Pins map[string]int `json:"pins,omitempty"`
+	// ShuffleSeed resolves remaining ties by a seeded shuffle, not user_id.
+	ShuffleSeed *int64 `json:"shuffle_seed,omitempty"`
+	Transform   string `json:"transform,omitempty"`
+	// Scoring "wilson" ranks on the Wilson lower bound of each item's
+	// correct/total; results then carry wilson_score.
+	Scoring string `json:"scoring,omitempty"`
+	// Borda ranks by summed per-metric positions; order defaults to desc.
+	Borda []tieBreakKey `json:"borda,omitempty"`
+	// Weights ranks by a weighted composite of min-max normalized metrics
+	// ("percent" or a metrics key), higher is better unless the metric is
+	// listed in LowerIsBetter; results then carry composite.
+	Weights       map[string]float64 `json:"weights,omitempty"`
+	LowerIsBetter []string           `json:"lower_is_better,omitempty"`
+	// Decay ranks on percents discounted by age; results then carry
+	// decayed_score.
+	Decay *decayOptions `json:"decay,omitempty"`
+	// Shrinkage ranks on percents shrunk toward a prior by each item's
+	// attempts; results then carry adjusted_score.
+	Shrinkage *shrinkageOptions `json:"shrinkage,omitempty"`
+	GraceBand float64           `json:"grace_band,omitempty"`
+	// Strategy numbers tied users: "ordinal" (default), "dense",
+	// "competition" or "fractional" (adds fractional_rank).
+	Strategy string `json:"strategy,omitempty"`
+	// StabilityDelta adds each user's reachable rank range under a
+	// ±delta change to their percent.
+	StabilityDelta float64 `json:"stability_delta,omitempty"`
+	// TopK returns only the best top_k users, without sorting the rest.
+	TopK int `json:"top_k,omitempty"`
+
+	SingleItemPercentile  *float64 `json:"single_item_percentile,omitempty"`
+	TopPercentile         *float64 `json:"top_percentile,omitempty"`
+	NullLastTiePercentile bool     `json:"null_last_tie_percentile,omitempty"`
+	MinDenominator        int      `json:"min_denominator,omitempty"`
+	PercentileDirection   string   `json:"percentile_direction,omitempty"`
+	// PercentileMethod is the percentile definition, echoed in the
+	// response; self_exclusive by default.
+	PercentileMethod rank.PercentileMethod `json:"percentile_method,omitempty"`
+	// Duplicates is the policy for repeated user_ids: reject (default),
+	// keep_highest or keep_latest. Echoed in the response.
+	Duplicates string `json:"duplicates,omitempty"`
+	// MinScore is a passing cutoff on the raw percent; Cutoff says whether
+	// a percent exactly at it passes.
+	MinScore *float64 `json:"min_score,omitempty"`
+	Cutoff   string   `json:"cutoff,omitempty"`
+	// Weighted computes population-weighted percentiles from item weights;
+	// TieWeight places tied users within their group's weight span.
+	Weighted  bool   `json:"weighted,omitempty"`
+	TieWeight string `json:"tie_weight,omitempty"`
+	// Anchors computes percentiles from a fixed score→percentile curve.
+	Anchors []anchor `json:"anchors,omitempty"`
+	// NormalPercentile computes percentiles from a normal CDF instead of
+	// the cohort's order.
+	NormalPercentile *normalReference `json:"normal_percentile,omitempty"`
+	// Precision rounds reported percentiles to this many decimals.
+	Precision *int `json:"precision,omitempty"`
+
+	// IncludeScores adds percent and, when a transform is applied,
+	// transformed_score to each result.
+	IncludeScores bool `json:"include_scores,omitempty"`
+	// OutputOrder "worst_first" reverses the results array; ranks and
+	// percentiles are unchanged.
+	OutputOrder string `json:"output_order,omitempty"`
+	// Format "columns" returns parallel arrays instead of result rows
+	// (/rank and GET /rank/{cohort_id} only).
+	Format string `json:"format,omitempty"`
+	// IncludeTScore adds each user's cohort T-score (50 + 10z).
+	IncludeTScore bool `json:"include_t_score,omitempty"`
+	// Standardize adds both the z-score and the T-score.
+	Standardize bool `json:"standardize,omitempty"`
+	// IncludeCurve adds the rank-vs-score curve as parallel arrays.
+	IncludeCurve bool `json:"include_curve,omitempty"`
+	// IncludeTies lists each tied user's fellow tie members in tied_with,
+	// up to MaxTieMembers (default defaultMaxTieMembers).
+	IncludeTies   bool `json:"include_ties,omitempty"`
+	MaxTieMembers *int `json:"max_tie_members,omitempty"`
+	// Awards allocates discrete award slots by tie group (see awards.go).
+	Awards *awardOptions `json:"awards,omitempty"`
+	// PercentileEncoding "bp" reports percentiles as integer basis points
+	// (0–10000) instead of floats ("float", the default).
+	PercentileEncoding string `json:"percentile_encoding,omitempty"`
+	// RankBase numbers reported ranks from 0 or 1 (nil means 1). Ranking
+	// and percentile math always use 1-based ranks; see rebase.
+	RankBase *int `json:"rank_base,omitempty"`
+	// DisplayRank adds display_rank under this mode ("dense" or
+	// "competition") alongside true_rank, the ordinal position.
+	DisplayRank string `json:"display_rank,omitempty"`
+	// Quantile adds each user's percentile band, quantile (1 best) and
+	// quantile_label ("Top 10%"): quartile, quintile or decile.
+	Quantile rank.Quantile `json:"quantile,omitempty"`
+	// Badges, best first, names percentile ranges; each result gets the
+	// first badge its percentile reaches.
+	Badges []badge `json:"badges,omitempty"`
+	// IncludeSummary adds distribution statistics of the raw percents.
+	IncludeSummary bool `json:"include_summary,omitempty"`
+	// BucketBy partitions results by a bucket expression (see bucket.go).
+	BucketBy string `json:"bucket_by,omitempty"`
+	// FieldCase "camel" emits camelCase response keys instead of snake_case.
+	FieldCase string `json:"field_case,omitempty"`
+}
+
+// validate checks the presentation-only options; rank.Options validates
+// the rest.
+func (o rankOptions) validate() error {
+	if err := checkDuplicatePolicy(o.Duplicates); err != nil {
+		return err
+	}
+	switch o.OutputOrder {
+	case "", "best_first", "worst_first":
+	default:
+		return fmt.Errorf("output_order must be best_first or worst_first, got %q", o.OutputOrder)
+	}
+	for i, k := range o.TieBreak {
+		if k.Order != "" && k.Order != "asc" && k.Order != "desc" {
+			return fmt.Errorf("tie_break[%d].order must be asc or desc, got %q", i, k.Order)
+		}
+	}
+	for i, k := range o.Borda {
+		if k.Order != "" && k.Order != "asc" && k.Order != "desc" {
+			return fmt.Errorf("borda[%d].order must be asc or desc, got %q", i, k.Order)
+		}
+	}
+	// A century is far beyond any useful half-life and keeps the
+	// conversion to time.Duration from overflowing.
+	if d := o.Decay; d != nil && !(d.HalfLifeHours > 0 && d.HalfLifeHours <= 100*365*24) {
+		return fmt.Errorf("decay.half_life_hours must be > 0 and at most 876000, got %v", d.HalfLifeHours)
+	}
+	for _, m := range o.LowerIsBetter {
+		if _, ok := o.Weights[m]; !ok {
+			return fmt.Errorf("lower_is_better: %q has no weight", m)
+		}
+	}
+	switch o.Format {
+	case "", "rows", "columns":
+	default:
+		return fmt.Errorf("format must be rows or columns, got %q", o.Format)
+	}
+	if p := o.Precision; p != nil && (*p < 0 || *p > 10) {
+		return fmt.Errorf("precision must be in [0, 10], got %d", *p)
+	}
+	if o.Awards != nil {
+		if err := o.Awards.validate(); err != nil {
+			return err
+		}
+	}
+	switch o.PercentileEncoding {
+	case "", "float", "bp":
+	default:
+		return fmt.Errorf("percentile_encoding must be float or bp, got %q", o.PercentileEncoding)
+	}
+	if b := o.RankBase; b != nil && *b != 0 && *b != 1 {
+		return fmt.Errorf("rank_base must be 0 or 1, got %d", *b)
+	}
+	switch o.DisplayRank {
+	case "", "dense", "competition":
+	default:
+		return fmt.Errorf("display_rank must be dense or competition, got %q", o.DisplayRank)
+	}
+	if m := o.MaxTieMembers; m != nil && (*m < 0 || *m > maxTieMembersLimit) {
+		return fmt.Errorf("max_tie_members must be in [0, %d], got %d", maxTieMembersLimit, *m)
+	}
+	if err := validFieldCase(o.FieldCase); err != nil {
+		return err
+	}
+	if o.BucketBy != "" {
+		if _, err := parseBucketExpr(o.BucketBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decayOptions configures time-decayed scoring; see rank.Decay.
+type decayOptions struct {
+	HalfLifeHours float64 `json:"half_life_hours"`
+	// TimeMetric names the item timestamp, in Unix seconds; finished_at
+	// by default.
+	TimeMetric string `json:"time_metric,omitempty"`
+	// AsOf pins the reference time; nil means the moment of ranking.
+	AsOf *time.Time `json:"as_of,omitempty"`
+}
+
+func (d *decayOptions) toRank() *rank.Decay {
+	if d == nil {
+		return nil
+	}
+	out := &rank.Decay{HalfLife: time.Duration(d.HalfLifeHours * float64(time.Hour)), TimeMetric: d.TimeMetric}
+	if out.TimeMetric == "" {
+		out.TimeMetric = metricFinishedAt
+	}
+	if d.AsOf != nil {
+		out.AsOf = *d.AsOf
+	}
+	return out
+}
+
+// shrinkageOptions configures attempts-aware shrinkage; see rank.Shrinkage.
+type shrinkageOptions struct {
+	PriorAttempts float64 `json:"prior_attempts"`
+	// Prior is the percent shrunk toward; nil means the cohort's
+	// attempt-weighted mean.
+	Prior *float64 `json:"prior,omitempty"`
+	// AttemptsMetric names the attempt count; attempts by default.
+	AttemptsMetric string `json:"attempts_metric,omitempty"`
+}
+
+func (sh *shrinkageOptions) toRank() *rank.Shrinkage {
+	if sh == nil {
+		return nil
+	}
+	out := &rank.Shrinkage{PriorAttempts: sh.PriorAttempts, AttemptsMetric: sh.AttemptsMetric, Prior: sh.Prior}
+	if out.AttemptsMetric == "" {
+		out.AttemptsMetric = metricAttempts
+	}
+	return out
+}
+
+// badge is one rung of the badges ladder.
+type badge struct {
+	Name          string  `json:"name"`
+	MinPercentile float64 `json:"min_percentile"`
+}
+
+type anchor struct {
+	Score      float64 `json:"score"`
+	Percentile float64 `json:"percentile"`
+}
+
+// normalReference is the distribution for normal_percentile; unset fields
+// are estimated from the cohort.
+type normalReference struct {
+	Mean *float64 `json:"mean,omitempty"`
+	SD   *float64 `json:"sd,omitempty"`
+}
+
+// tieBreakKey is one level of a tie_break chain.
+type tieBreakKey struct {
+	Metric string `json:"metric"`
+	Order  string `json:"order"` // asc (default) or desc
+}
+
+func toTieBreak(keys []tieBreakKey) []rank.TieBreakKey {
+	if len(keys) == 0 {
+		return nil
+	}
+	out := make([]rank.TieBreakKey, len(keys))
+	for i, k := range keys {
+		out[i] = rank.TieBreakKey{Metric: k.Metric, Desc: k.Order == "desc"}
+	}
+	return out
+}
+
+// toBorda is toTieBreak with higher-is-better as the default order.
+func toBorda(keys []tieBreakKey) []rank.TieBreakKey {
+	if len(keys) == 0 {
+		return nil
+	}
+	out := make([]rank.TieBreakKey, len(keys))
+	for i, k := range keys {
+		out[i] = rank.TieBreakKey{Metric: k.Metric, Desc: k.Order != "asc"}
+	}
+	return out
+}
+
+// toComposite orders the weights by metric, so the composite sums in the
+// same order on every request.
+func toComposite(weights map[string]float64, lowerIsBetter []string) []rank.CompositeWeight {
+	if len(weights) == 0 {
+		return nil
+	}
+	out := make([]rank.CompositeWeight, 0, len(weights))
+	for m, w := range weights {
+		out = append(out, rank.CompositeWeight{Metric: m, Weight: w, Asc: slices.Contains(lowerIsBetter, m)})
+	}
+	slices.SortFunc(out, func(a, b rank.CompositeWeight) int { return strings.Compare(a.Metric, b.Metric) })
+	return out
+}
+
+func (o rankOptions) toRank() rank.Options {
+	out := rank.Options{
+		TrimPercent:     o.TrimPercent,
+		TierOrder:       o.TierOrder,
+		UnknownTier:     rank.UnknownTierPolicy(o.UnknownTier),
+		TiePrecision:    o.TiePrecision,
+		ArrivalTieBreak: o.ArrivalTieBreak,
+		TieBreak:        toTieBreak(o.TieBreak),
+		TiePriority:     o.TiePriority,
+		ShuffleSeed:     o.ShuffleSeed,
+		Pins:            o.Pins,
+		Transform:       rank.Transform(o.Transform),
+		Scoring:         rank.Scoring(o.Scoring),
+		Borda:           toBorda(o.Borda),
+		Composite:       toComposite(o.Weights, o.LowerIsBetter),
+		Decay:           o.Decay.toRank(),
+		Shrinkage:       o.Shrinkage.toRank(),
+		GraceBand:       o.GraceBand,
+		Strategy:        rank.Strategy(o.Strategy),
+		StabilityDelta:  o.StabilityDelta,
+		TopK:            o.TopK,
+
+		SingleItemPercentile:  o.SingleItemPercentile,
+		TopPercentile:         o.TopPercentile,
+		NullLastTiePercentile: o.NullLastTiePercentile,
+		MinDenominator:        o.MinDenominator,
+		Direction:             rank.PercentileDirection(o.PercentileDirection),
+		Method:                o.PercentileMethod,
+		MinScore:              o.MinScore,
+		Cutoff:                rank.CutoffInclusivity(o.Cutoff),
+		Weighted:              o.Weighted,
+		TieWeight:             rank.TieWeight(o.TieWeight),
+		Quantile:              o.Quantile,
+	}
+	if o.Badges != nil {
+		out.Badges = make([]rank.Badge, len(o.Badges))
+		for i, b := range o.Badges {
+			out.Badges[i] = rank.Badge{Name: b.Name, MinPercentile: b.MinPercentile}
+		}
+	}
+	if o.Anchors != nil {
+		out.Anchors = make([]rank.Anchor, len(o.Anchors))
+		for i, a := range o.Anchors {
+			out.Anchors[i] = rank.Anchor{Score: a.Score, Percentile: a.Percentile}
+		}
+	}
+	if n := o.NormalPercentile; n != nil {
+		out.Normal = &rank.NormalReference{Mean: n.Mean, SD: n.SD}
+	}
+	return out
 }
 
 type rankItem struct {
 	UserID  string  `json:"user_id"`
 	Percent float64 `json:"percent"`
+	Tier    string  `json:"tier,omitempty"`
+	// Metrics are extra named values such as exam_score or submitted_at.
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	// Arrival is a sequence number or timestamp, smaller is earlier.
+	Arrival *float64 `json:"arrival,omitempty"`
+	// FinishedAt and DurationSeconds record when and how fast the user
+	// completed the exam, for tie_break: they are ranked as the metrics
+	// "finished_at" (Unix seconds) and "duration_seconds".
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	DurationSeconds *float64   `json:"duration_seconds,omitempty"`
+	// Attempts is how many quizzes Percent is averaged over, for
+	// shrinkage; it is ranked as the metric "attempts".
+	Attempts *int `json:"attempts,omitempty"`
+	// Correct and Total give the user's accuracy as counts; an item with
+	// them has its percent computed, 100 * correct / total, and they are
+	// ranked as the metrics "correct" and "total".
+	Correct *int `json:"correct,omitempty"`
+	Total   *int `json:"total,omitempty"`
+	// Subject names the exam subject the item scores; a /rank request
+	// whose items have subjects carries one item per user and subject
+	// (see splitSubjects).
+	Subject string `json:"subject,omitempty"`
+	// Weight is the user's population weight for weighted percentiles.
+	Weight float64 `json:"weight,omitempty"`
 }
 
 type rankResult struct {
-	UserID    string  `json:"user_id"`
-	Rank      int     `json:"rank"`
-	Percentile float64 `json:"percentile"`
+	UserID           string   `json:"user_id"`
+	Rank             int      `json:"rank"`
+	Percentile       *float64 `json:"percentile"`
+	Percent          *float64 `json:"percent,omitempty"`
+	TransformedScore *float64 `json:"transformed_score,omitempty"`
+	ZScore           *float64 `json:"z_score,omitempty"`
+	TScore           *float64 `json:"t_score,omitempty"`
+	BordaPoints      *float64 `json:"borda_points,omitempty"`
+	Composite        *float64 `json:"composite,omitempty"`
+	DecayedScore     *float64 `json:"decayed_score,omitempty"`
+	AdjustedScore    *float64 `json:"adjusted_score,omitempty"`
+	WilsonScore      *float64 `json:"wilson_score,omitempty"`
+	// TiedWith lists the other members of the user's tie group, at most
+	// max_tie_members of them; TiedCount is the full count and
+	// TiedTruncated says the list was cut.
+	TiedWith      []string `json:"tied_with,omitempty"`
+	TiedCount     int      `json:"tied_count,omitempty"`
+	TiedTruncated bool     `json:"tied_truncated,omitempty"`
+	// FractionalRank is the tie group's mean position under the
+	// fractional strategy.
+	FractionalRank *float64 `json:"fractional_rank,omitempty"`
+	// Rank fields other than Rank are pointers so a 0-based rank isn't
+	// dropped as empty.
+	BestRank  *int `json:"best_rank,omitempty"`
+	WorstRank *int `json:"worst_rank,omitempty"`
+	// DisplayRank is the rank under display_rank; TrueRank the ordinal
+	// position, unique per user.
+	DisplayRank *int `json:"display_rank,omitempty"`
+	TrueRank    *int `json:"true_rank,omitempty"`
+	// Award is the award slot the user receives under awards; CoWinner
+	// says they share it with the rest of their tie group.
+	Award    *int `json:"award,omitempty"`
+	CoWinner bool `json:"co_winner,omitempty"`
+	// Quantile is the user's percentile band under quantile, 1 best.
+	Quantile      int    `json:"quantile,omitempty"`
+	QuantileLabel string `json:"quantile_label,omitempty"`
+	// Badge is the user's badge under badges.
+	Badge string `json:"badge,omitempty"`
+	// RankChange and PercentileChange compare a stored cohort's result
+	// with the user's in the previous version; absent for new users.
+	// A positive RankChange is a move up.
+	RankChange       *int     `json:"rank_change,omitempty"`
+	PercentileChange *float64 `json:"percentile_change,omitempty"`
+
+	// percent is the raw percent, reported in JSON only as Percent but
+	// always in CSV.
+	percent float64
 }
 
 type rankResponse struct {
-	CohortID string       `json:"cohort_id"`
-	Results  []rankResult `json:"results"`
+	CohortID string `json:"cohort_id"`
+	// Version is the stored ranking's version; absent when not stored.
+	// PreviousVersion is the version rank changes are measured against.
+	Version         int64        `json:"version,omitempty"`
+	PreviousVersion int64        `json:"previous_version,omitempty"`
+	Results         []rankResult `json:"results"`
+	// PercentileMethod echoes the percentile definition the request chose.
+	PercentileMethod rank.PercentileMethod `json:"percentile_method,omitempty"`
+	// DuplicatePolicy echoes the duplicates policy the request chose;
+	// DuplicatesDropped counts the repeated items it removed.
+	DuplicatePolicy   string `json:"duplicate_policy,omitempty"`
+	DuplicatesDropped int    `json:"duplicates_dropped,omitempty"`
+	// PercentileEncoding is "bp" when percentiles are integer basis
+	// points; divide by PercentileDivisor for the percentile.
+	PercentileEncoding string     `json:"percentile_encoding,omitempty"`
+	PercentileDivisor  int        `json:"percentile_divisor,omitempty"`
+	Curve              *rankCurve `json:"curve,omitempty"`
+	// Buckets partitions the results under bucket_by.
+	Buckets []bucketSummary `json:"buckets,omitempty"`
+	Summary *rankSummary    `json:"summary,omitempty"`
+	// Subjects ranks each subject separately when the items have
+	// subjects; the response's own results are the overall ranking.
+	Subjects []subjectRanking `json:"subjects,omitempty"`
+}
+
+type rankSummary struct {
+	Count    int          `json:"count"`
+	Mean     float64      `json:"mean"`
+	SD       float64      `json:"sd"`
+	Min      float64      `json:"min"`
+	Max      float64      `json:"max"`
+	Median   float64      `json:"median"`
+	Modality rankModality `json:"modality"`
+}
+
+// rankModality is the heuristic mode count (see rank.DetectModes).
+type rankModality struct {
+	Modes     int       `json:"modes"`
+	Locations []float64 `json:"locations"`
 }
 
-func rankHandler(w http.ResponseWriter, r *http.Request) {
+// rankCurve is rank.Curve: scores[i] is the ranked score at ranks[i].
+type rankCurve struct {
+	Ranks  []int     `json:"ranks"`
+	Scores []float64 `json:"scores"`
+}
+
+// resolveTenant writes the error response and returns nil if the caller
+// has no valid tenant.
+func (s *Server) resolveTenant(w http.ResponseWriter, r *http.Request) *tenant.Tenant {
+	t, err := s.tenantFor(r.Context(), credentialsOf(r.Header))
+	switch {
+	case errors.Is(err, tenant.ErrUnauthorized):
+		writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, err.Error())
+		return nil
+	case err != nil:
+		writeProblem(w, r, http.StatusForbidden, codeForbidden, err.Error())
+		return nil
+	}
+	return t
+}
+
+func (s *Server) rankHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeProblem(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "method not allowed")
+		return
+	}
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+
+	req, ok := s.decodeRankRequest(w, r, t)
+	if !ok {
+		return
+	}
+	if req.CallbackURL != "" {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "callback_url is only supported by /rank/jobs")
+		return
+	}
+	if req.Export != nil {
+		if err := req.Export.validate(s.Exports); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+	}
+
+	resp, results, err := s.rankChecked(r.Context(), req)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	var req rankRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid json: "+err.Error(), http.StatusBadRequest)
+	// Export before storing so a failed write leaves no trace.
+	var exported *exportResult
+	if req.Export != nil {
+		res, err := s.exportRanking(r, t.ID, *req.Export, resp)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadGateway, codeExportFailed, "export: "+err.Error())
+			return
+		}
+		exported = &res
+	}
+
+	if req.CohortID != "" {
+		if err := s.storeRanked(r.Context(), t.ID, req, results, &resp); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	if exported != nil {
+		writeJSON(w, withCase(exportResponse{CohortID: req.CohortID, Export: *exported}, req.FieldCase))
 		return
 	}
+	writeRanking(w, r, resp, req.rankOptions)
+}
+
+// decodeRankRequest reads a /rank body, JSON, NDJSON or CSV, on top of
+// t's defaults, and checks it (see checkRankRequest). On
+// failure it has already written the error.
+func (s *Server) decodeRankRequest(w http.ResponseWriter, r *http.Request, t *tenant.Tenant) (rankRequest, bool) {
+	req := rankRequest{rankOptions: s.defaultsFor(t)}
+	limit, tooMany := s.itemLimit(t)
+	var decode func(*http.Request, *rankRequest, int) error
+	var format string
+	switch {
+	case isNDJSON(r):
+		decode, format = decodeNDJSON, "ndjson"
+	case isCSV(r):
+		decode, format = decodeCSV, "csv"
+	}
+	if decode != nil {
+		err := decode(r, &req, limit)
+		switch {
+		case errors.Is(err, errTooManyItems):
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, codeTooManyItems, tooMany.Error())
+			return req, false
+		case err != nil:
+			decodeError(w, r, format, err)
+			return req, false
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, "json", err)
+		return req, false
+	}
+	logRequest(r, req.CohortID, len(req.Items))
+	if err := s.checkRankRequest(t, &req); err != nil {
+		writeError(w, r, err)
+		return req, false
+	}
+	return req, true
+}
+
+// rankItems validates opts and ranks items under them, recording the
+// cohort in the ranking metrics and a span. Errors are the caller's fault
+// (400).
+func (s *Server) rankItems(ctx context.Context, items []rankItem, opts rankOptions) ([]rank.Result, error) {
+	return s.rankCohort(ctx, toRankItems(items), opts)
+}
+
+// rankCohort is rankItems for items already in rank form, such as a
+// stored cohort's.
+func (s *Server) rankCohort(ctx context.Context, items []rank.Item, opts rankOptions) ([]rank.Result, error) {
+	span := s.startRankSpan(ctx, len(items))
+	defer span.End()
+	start := time.Now()
+	results, err := s.rankUnmetered(items, opts)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	s.metrics.observeRank(len(items), time.Since(start))
+	return results, nil
+}
+
+// rankUnmetered is rankCohort without the metrics, for synthetic cohorts
+// (POST /bench) that would skew them.
+func (s *Server) rankUnmetered(items []rank.Item, opts rankOptions) ([]rank.Result, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	ro := opts.toRank()
+	ro.ExternalSort = s.ExternalSort
+	return rank.Rank(items, ro)
+}
+
+// Metric names for rankItem's completion-time and attempts fields.
+const (
+	metricFinishedAt      = "finished_at"
+	metricDurationSeconds = "duration_seconds"
+	metricAttempts        = "attempts"
+)
 
-	items := make([]rank.Item, len(req.Items))
-	for i, it := range req.Items {
-		items[i] = rank.Item{UserID: it.UserID, Percent: it.Percent}
+func toRankItems(items []rankItem) []rank.Item {
+	out := make([]rank.Item, len(items))
+	for i, it := range items {
+		out[i] = rank.Item{UserID: it.UserID, Percent: it.percent(), Tier: it.Tier, Metrics: it.metrics(), Arrival: it.Arrival, Weight: it.Weight}
 	}
+	return out
+}
 
-	results := rank.RankByPercent(items)
+// percent is the item's percent, computed from Correct and Total when it
+// has them. No questions is 0%.
+func (it rankItem) percent() float64 {
+	if it.Correct == nil || it.Total == nil {
+		return it.Percent
+	}
+	if *it.Total == 0 {
+		return 0
+	}
+	return 100 * float64(*it.Correct) / float64(*it.Total)
+}
 
+// metrics is it.Metrics with the completion-time, attempts and count
+// fields added, copied so the request's map is left alone.
+func (it rankItem) metrics() map[string]float64 {
+	if it.FinishedAt == nil && it.DurationSeconds == nil && it.Attempts == nil && it.Correct == nil && it.Total == nil {
+		return it.Metrics
+	}
+	m := make(map[string]float64, len(it.Metrics)+5)
+	for k, v := range it.Metrics {
+		m[k] = v
+	}
+	if it.FinishedAt != nil {
+		m[metricFinishedAt] = float64(it.FinishedAt.UnixNano()) / 1e9
+	}
+	if it.DurationSeconds != nil {
+		m[metricDurationSeconds] = *it.DurationSeconds
+	}
+	if it.Attempts != nil {
+		m[metricAttempts] = float64(*it.Attempts)
+	}
+	if it.Correct != nil {
+		m[rank.MetricCorrect] = float64(*it.Correct)
+	}
+	if it.Total != nil {
+		m[rank.MetricTotal] = float64(*it.Total)
+	}
+	return m
+}
+
+// storeRanking saves a cohort's results with the inputs needed to re-rank
+// it and returns the new version (see store.Store.Put for ifVersion).
+func (s *Server) storeRanking(ctx context.Context, tenantID, cohortID string, items []rankItem, opts rankOptions, results []rank.Result, ifVersion int64) (int64, error) {
+	v, err := s.Store.Put(ctx, tenantID, store.Ranking{
+		CohortID: cohortID,
+		Items:    toRankItems(items),
+		Options:  opts.toRank(),
+		Results:  results,
+		RankedAt: time.Now().UTC(),
+	}, ifVersion)
+	if err == nil {
+		s.publishReranked(tenantID, cohortID, v)
+	}
+	return v, err
+}
+
+func (s *Server) getRankHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	stored, err := s.Store.Get(r.Context(), t.ID, r.PathValue("cohort_id"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	if s.notModified(w, r, t.ID, stored) {
+		return
+	}
+	opts := s.Defaults
+	opts.Quantile = stored.Options.Quantile
+	resp := toResponse(stored.CohortID, stored.Results, opts)
+	resp.Version = stored.Version
+	resp.PercentileMethod = stored.Options.Method
+	s.addChanges(r.Context(), t.ID, &resp, stored.Results, opts)
+	writeRanking(w, r, resp, opts)
+}
+
+func toResponse(cohortID string, results []rank.Result, opts rankOptions) rankResponse {
 	out := rankResponse{
-		CohortID: req.CohortID,
+		CohortID: cohortID,
 		Results:  make([]rankResult, len(results)),
 	}
+	if opts.PercentileEncoding == "bp" {
+		out.PercentileEncoding, out.PercentileDivisor = "bp", bpPerPercent
+	}
+	out.PercentileMethod = opts.PercentileMethod
+	out.DuplicatePolicy = opts.Duplicates
+	base := opts.rankBase()
 	for i, r := range results {
 		out.Results[i] = rankResult{
-			UserID:     r.UserID,
-			Rank:       r.Rank,
-			Percentile: r.Percentile,
+			UserID: r.UserID,
+			Rank:   rebase(r.Rank, base),
+		}
+		if r.FractionalRank != 0 {
+			fr := r.FractionalRank - 1 + float64(base)
+			out.Results[i].FractionalRank = &fr
+		}
+		if r.BestRank != 0 {
+			best, worst := rebase(r.BestRank, base), rebase(r.WorstRank, base)
+			out.Results[i].BestRank, out.Results[i].WorstRank = &best, &worst
+		}
+		if !r.PercentileNull {
+			p := opts.formatPercentile(r.Percentile)
+			out.Results[i].Percentile = &p
+		}
+		if k := opts.Quantile.Bands(); k > 0 && r.Quantile > 0 {
+			out.Results[i].Quantile = r.Quantile
+			out.Results[i].QuantileLabel = quantileLabel(r.Quantile, k)
+		}
+		out.Results[i].Badge = r.Badge
+		out.Results[i].percent = r.Percent
+		if opts.Standardize {
+			out.Results[i].ZScore = &r.ZScore
+		}
+		if opts.IncludeTScore || opts.Standardize {
+			out.Results[i].TScore = &r.TScore
+		}
+		if len(opts.Borda) > 0 {
+			pts := -r.Score
+			out.Results[i].BordaPoints = &pts
+		}
+		if len(opts.Weights) > 0 {
+			out.Results[i].Composite = &r.Score
+		}
+		if opts.Decay != nil {
+			out.Results[i].DecayedScore = &r.Score
+		}
+		if opts.Shrinkage != nil {
+			out.Results[i].AdjustedScore = &r.Score
 		}
+		if opts.Scoring == string(rank.ScoringWilson) {
+			out.Results[i].WilsonScore = &r.Score
+		}
+		if opts.IncludeScores {
+			out.Results[i].Percent = &r.Percent
+			if opts.Transform != "" {
+				out.Results[i].TransformedScore = &r.Score
+			}
+		}
+	}
+	if opts.DisplayRank != "" {
+		addDisplayRanks(out.Results, results, opts.DisplayRank, base)
+	}
+	if opts.Awards != nil {
+		addAwards(out.Results, results, *opts.Awards)
+	}
+	if opts.IncludeTies {
+		addTies(out.Results, results, opts.maxTieMembers())
+	}
+	if opts.IncludeCurve {
+		c := rank.CurveOf(results)
+		out.Curve = &rankCurve{Ranks: c.Ranks, Scores: c.Scores}
 	}
+	if opts.IncludeSummary {
+		sm := rank.SummaryOf(results)
+		out.Summary = &rankSummary{
+			Count: sm.Count, Mean: sm.Mean, SD: sm.SD, Min: sm.Min, Max: sm.Max, Median: sm.Median,
+			Modality: rankModality{Modes: len(sm.Modes), Locations: append([]float64{}, sm.Modes...)},
+		}
+	}
+	if opts.BucketBy != "" {
+		// validate has already parsed it.
+		if e, err := parseBucketExpr(opts.BucketBy); err == nil {
+			out.Buckets = e.summarize(results)
+		}
+	}
+	if opts.OutputOrder == "worst_first" {
+		slices.Reverse(out.Results)
+	}
+	return out
+}
+
+// formatPercentile applies percentile_encoding or precision to p.
+func (o rankOptions) formatPercentile(p float64) float64 {
+	switch {
+	case o.PercentileEncoding == "bp":
+		return math.Round(p * bpPerPercent)
+	case o.Precision != nil:
+		return roundTo(p, *o.Precision)
+	}
+	return p
+}
+
+func (o rankOptions) rankBase() int {
+	if o.RankBase != nil {
+		return *o.RankBase
+	}
+	return 1
+}
+
+// rebase turns a 1-based rank into one numbered from base. It is applied
+// only when results are reported, so rank_base never reaches the
+// percentile formulas, which assume the top user is rank 1.
+func rebase(rank, base int) int {
+	return rank - 1 + base
+}
+
+// bpPerPercent is the basis points in one percentile point, and the
+// divisor that decodes a bp-encoded percentile.
+const bpPerPercent = 100
+
+func roundTo(x float64, decimals int) float64 {
+	p := math.Pow10(decimals)
+	return math.Round(x*p) / p
+}
 
+func writeJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(out)
+	_ = json.NewEncoder(w).Encode(v)
 }
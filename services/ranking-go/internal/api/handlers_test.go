@@ -0,0 +1,754 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"ranking-go/internal/health"
+	"ranking-go/internal/rank"
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+)
+
+func newTestServer(t *testing.T, tenants *tenant.Registry) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	NewServer(store.NewMemory(), tenants).RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func do(t *testing.T, method, url, body string, header map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func decode[T any](t *testing.T, resp *http.Response) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return v
+}
+
+func TestTenantsDoNotShareCohortIDs(t *testing.T) {
+	ts := newTestServer(t, nil)
+	a := map[string]string{"X-Tenant": "college-a"}
+	b := map[string]string{"X-Tenant": "college-b"}
+
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"mock-1","items":[{"user_id":"alice","percent":70}]}`, a)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"mock-1","items":[{"user_id":"bob","percent":60}]}`, b)
+
+	for hdr, want := range map[string]string{"college-a": "alice", "college-b": "bob"} {
+		resp := do(t, "GET", ts.URL+"/rank/mock-1", "", map[string]string{"X-Tenant": hdr})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d", hdr, resp.StatusCode)
+		}
+		got := decode[rankResponse](t, resp)
+		if len(got.Results) != 1 || got.Results[0].UserID != want {
+			t.Errorf("%s: got %+v, want only %s", hdr, got.Results, want)
+		}
+	}
+}
+
+func TestTenantCannotFetchOtherTenantsCohort(t *testing.T) {
+	reg, err := tenant.NewRegistry([]tenant.Tenant{
+		{ID: "college-a", APIKeys: []string{"key-a"}},
+		{ID: "college-b", APIKeys: []string{"key-b"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, reg)
+
+	resp := do(t, "POST", ts.URL+"/rank", `{"cohort_id":"mock-1","items":[{"user_id":"alice","percent":70}]}`,
+		map[string]string{"X-API-Key": "key-a"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("post: status %d", resp.StatusCode)
+	}
+
+	resp = do(t, "GET", ts.URL+"/rank/mock-1", "", map[string]string{"X-API-Key": "key-b"})
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("other tenant's key: status %d, want 404", resp.StatusCode)
+	}
+	resp = do(t, "GET", ts.URL+"/rank/mock-1", "", map[string]string{"X-API-Key": "key-b", "X-Tenant": "college-a"})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("spoofed X-Tenant: status %d, want 403", resp.StatusCode)
+	}
+	resp = do(t, "GET", ts.URL+"/rank/mock-1", "", map[string]string{"X-Tenant": "college-a"})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("X-Tenant without key: status %d, want 401", resp.StatusCode)
+	}
+	resp = do(t, "GET", ts.URL+"/rank/mock-1", "", map[string]string{"X-API-Key": "key-a"})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("owner: status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestTenantMaxItems(t *testing.T) {
+	reg, err := tenant.NewRegistry([]tenant.Tenant{{ID: tenant.Default, MaxItems: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, reg)
+	resp := do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":1},{"user_id":"b","percent":2}]}`, nil)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want 413", resp.StatusCode)
+	}
+}
+
+func TestIncludeScoresWithTransform(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const items = `"items":[{"user_id":"a","percent":40},{"user_id":"b","percent":60},{"user_id":"c","percent":80}]`
+
+	cases := map[string]map[string]float64{
+		// mean 60, population sd sqrt(800/3)
+		"zscore": {"a": -20 / math.Sqrt(800.0/3), "b": 0, "c": 20 / math.Sqrt(800.0/3)},
+		"minmax": {"a": 0, "b": 0.5, "c": 1},
+	}
+	for transform, want := range cases {
+		resp := do(t, "POST", ts.URL+"/rank", `{`+items+`,"transform":"`+transform+`","include_scores":true}`, nil)
+		got := decode[rankResponse](t, resp)
+		raw := map[string]float64{"a": 40, "b": 60, "c": 80}
+		for i, r := range got.Results {
+			if r.Rank != i+1 {
+				t.Errorf("%s: %s rank %d, want %d", transform, r.UserID, r.Rank, i+1)
+			}
+			if r.Percent == nil || r.TransformedScore == nil {
+				t.Fatalf("%s: %s missing scores: %+v", transform, r.UserID, r)
+			}
+			if *r.Percent != raw[r.UserID] {
+				t.Errorf("%s: %s percent %v, want %v", transform, r.UserID, *r.Percent, raw[r.UserID])
+			}
+			if math.Abs(*r.TransformedScore-want[r.UserID]) > 1e-9 {
+				t.Errorf("%s: %s transformed_score %v, want %v", transform, r.UserID, *r.TransformedScore, want[r.UserID])
+			}
+		}
+	}
+}
+
+func TestScoresOmittedByDefault(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":40}],"transform":"zscore"}`, nil)
+	got := decode[rankResponse](t, resp)
+	if got.Results[0].Percent != nil || got.Results[0].TransformedScore != nil {
+		t.Errorf("scores should be omitted without include_scores: %+v", got.Results[0])
+	}
+}
+
+func TestOutputOrderWorstFirst(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const items = `"items":[{"user_id":"a","percent":40},{"user_id":"b","percent":60},{"user_id":"c","percent":80},{"user_id":"d","percent":60}]`
+
+	best := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`}`, nil)).Results
+	worst := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"output_order":"worst_first"}`, nil)).Results
+
+	if len(best) != len(worst) {
+		t.Fatalf("length mismatch: %d vs %d", len(best), len(worst))
+	}
+	for i := range best {
+		if !reflect.DeepEqual(best[i], worst[len(worst)-1-i]) {
+			t.Errorf("position %d: %+v is not the mirror of %+v", i, best[i], worst[len(worst)-1-i])
+		}
+	}
+	if worst[0].UserID != "a" || worst[0].Rank != 4 {
+		t.Errorf("worst_first should start with rank 4: got %+v", worst[0])
+	}
+}
+
+func TestOutputOrderInvalid(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank", `{"items":[],"output_order":"sideways"}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestIncludeCurve(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":40},{"user_id":"b","percent":90}],"include_curve":true}`, nil)
+	got := decode[rankResponse](t, resp)
+	if got.Curve == nil {
+		t.Fatal("curve missing")
+	}
+	if len(got.Curve.Ranks) != 2 || got.Curve.Ranks[0] != 1 || got.Curve.Scores[0] != 90 || got.Curve.Scores[1] != 40 {
+		t.Errorf("unexpected curve: %+v", got.Curve)
+	}
+}
+
+func TestNullLastTiePercentileIsJSONNull(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank",
+		`{"items":[{"user_id":"a","percent":90},{"user_id":"b","percent":40},{"user_id":"c","percent":40}],"grace_band":0.1,"null_last_tie_percentile":true}`, nil)
+	got := decode[struct {
+		Results []map[string]any `json:"results"`
+	}](t, resp).Results
+	for _, r := range got[1:] {
+		if v, ok := r["percentile"]; !ok || v != nil {
+			t.Errorf("%v: percentile should be null", r["user_id"])
+		}
+		if r["rank"] != 2.0 {
+			t.Errorf("%v: rank %v, want shared rank 2", r["user_id"], r["rank"])
+		}
+	}
+	if got[0]["percentile"] != 100.0 {
+		t.Errorf("a: percentile %v", got[0]["percentile"])
+	}
+}
+
+func TestIncludeTScore(t *testing.T) {
+	ts := newTestServer(t, nil)
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank",
+		`{"items":[{"user_id":"a","percent":50},{"user_id":"b","percent":70}],"include_t_score":true}`, nil))
+	// mean 60, sd 10: z = +1 / -1
+	if *got.Results[0].TScore != 60 || *got.Results[1].TScore != 40 {
+		t.Errorf("t scores: %v %v", *got.Results[0].TScore, *got.Results[1].TScore)
+	}
+	got = decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":50}]}`, nil))
+	if got.Results[0].TScore != nil || got.Results[0].ZScore != nil {
+		t.Error("t_score and z_score should be omitted by default")
+	}
+}
+
+func TestStandardize(t *testing.T) {
+	ts := newTestServer(t, nil)
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank",
+		`{"items":[{"user_id":"a","percent":50},{"user_id":"b","percent":70},{"user_id":"c","percent":60}],"standardize":true}`, nil))
+	// mean 60, sd sqrt(200/3).
+	sd := math.Sqrt(200.0 / 3)
+	for i, z := range []float64{10 / sd, 0, -10 / sd} {
+		r := got.Results[i]
+		if r.ZScore == nil || r.TScore == nil || math.Abs(*r.ZScore-z) > 1e-12 || math.Abs(*r.TScore-(50+10*z)) > 1e-12 {
+			t.Errorf("%s: z %v, t %v; want %v, %v", r.UserID, r.ZScore, r.TScore, z, 50+10*z)
+		}
+	}
+	cols := decode[rankColumns](t, do(t, "POST", ts.URL+"/rank",
+		`{"items":[{"user_id":"a","percent":50},{"user_id":"b","percent":50}],"standardize":true,"format":"columns"}`, nil))
+	if len(cols.ZScores) != 2 || cols.ZScores[0] != 0 || cols.TScores[1] != 50 {
+		t.Errorf("zero-variance columns: z %v, t %v", cols.ZScores, cols.TScores)
+	}
+}
+
+func TestRankSubjects(t *testing.T) {
+	ts := newTestServer(t, nil)
+	body := `{"cohort_id":"mock","items":[
+		{"user_id":"a","subject":"cardiology","percent":90},{"user_id":"b","subject":"cardiology","percent":60},
+		{"user_id":"a","subject":"pharmacology","percent":40},{"user_id":"b","subject":"pharmacology","percent":80},
+		{"user_id":"c","subject":"pharmacology","correct":7,"total":10}]}`
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", body, nil))
+	// Overall means: b 70, c 70, a 65.
+	if ids := userIDs(got.Results); !slices.Equal(ids, []string{"b", "c", "a"}) {
+		t.Errorf("overall %v", ids)
+	}
+	if len(got.Subjects) != 2 || got.Subjects[0].Subject != "cardiology" || got.Subjects[1].Subject != "pharmacology" {
+		t.Fatalf("subjects %+v", got.Subjects)
+	}
+	if ids := userIDs(got.Subjects[1].Results); !slices.Equal(ids, []string{"b", "c", "a"}) {
+		t.Errorf("pharmacology %v", ids)
+	}
+	if got.Version != 1 || got.Subjects[0].CohortID != "mock" {
+		t.Errorf("response %+v", got)
+	}
+	// Only the overall ranking is stored.
+	stored := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/mock", "", nil))
+	if len(stored.Results) != 3 || stored.Subjects != nil {
+		t.Errorf("stored %+v", stored)
+	}
+
+	cols := decode[rankColumns](t, do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","subject":"s","percent":1}],"format":"columns"}`, nil))
+	if len(cols.Subjects) != 1 || !slices.Equal(cols.Subjects[0].UserIDs, []string{"a"}) {
+		t.Errorf("columns %+v", cols.Subjects)
+	}
+
+	for _, c := range []struct{ url, body, field string }{
+		{"/rank", `{"items":[{"user_id":"a","subject":"s","percent":1},{"user_id":"b","percent":1}]}`, "items[1].subject"},
+		{"/rank", `{"items":[{"user_id":"a","subject":"s","percent":1},{"user_id":"a","subject":"s","percent":2}]}`, "items[1].user_id"},
+		{"/rank/preview", `{"items":[{"user_id":"a","subject":"s","percent":1}],"option_sets":[{"name":"x"}]}`, "items[0].subject"},
+	} {
+		resp := do(t, "POST", ts.URL+c.url, c.body, nil)
+		p := decode[problem](t, resp)
+		if resp.StatusCode != http.StatusBadRequest || len(p.Fields) != 1 || p.Fields[0].Field != c.field {
+			t.Errorf("%s %s: status %d, %+v; want %s", c.url, c.body, resp.StatusCode, p.Fields, c.field)
+		}
+	}
+}
+
+func TestRankTopK(t *testing.T) {
+	ts := newTestServer(t, nil)
+	body := `{"cohort_id":"mock","top_k":2,"items":[{"user_id":"a","percent":50},{"user_id":"b","percent":90},{"user_id":"c","percent":70},{"user_id":"d","percent":60},{"user_id":"e","percent":80}]}`
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", body, nil))
+	if ids := userIDs(got.Results); !slices.Equal(ids, []string{"b", "e"}) {
+		t.Fatalf("top 2 %v", ids)
+	}
+	// Percentiles are still against all five users.
+	if p := got.Results[1].Percentile; p == nil || *p != 75 {
+		t.Errorf("e percentile %v, want 75", p)
+	}
+
+	resp := do(t, "POST", ts.URL+"/rank", `{"top_k":2,"strategy":"fractional","items":[{"user_id":"a","percent":1}]}`, nil)
+	if p := decode[problem](t, resp); resp.StatusCode != http.StatusBadRequest || p.Code != codeInvalidOptions {
+		t.Errorf("top_k with fractional: status %d, %+v", resp.StatusCode, p)
+	}
+}
+
+func userIDs(results []rankResult) []string {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.UserID
+	}
+	return ids
+}
+
+type stubPinger struct{ err error }
+
+func (p stubPinger) Ping(context.Context) error { return p.err }
+
+func TestReadyz(t *testing.T) {
+	downErr := errors.New("unreachable")
+	cases := []struct {
+		name   string
+		checks []health.Check
+		status int
+	}{
+		{"all healthy", []health.Check{{Name: "store", Required: true, Pinger: stubPinger{}}}, http.StatusOK},
+		{"required down", []health.Check{
+			{Name: "store", Required: true, Pinger: stubPinger{downErr}},
+			{Name: "export:s3", Pinger: stubPinger{}},
+		}, http.StatusServiceUnavailable},
+		{"optional down", []health.Check{
+			{Name: "store", Required: true, Pinger: stubPinger{}},
+			{Name: "export:s3", Pinger: stubPinger{downErr}},
+		}, http.StatusOK},
+	}
+	for _, c := range cases {
+		srv := NewServer(store.NewMemory(), nil)
+		srv.Checks = c.checks
+		mux := http.NewServeMux()
+		srv.RegisterHandlers(mux)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+		if rec.Code != c.status {
+			t.Errorf("%s: status %d, want %d", c.name, rec.Code, c.status)
+		}
+		var rep health.Report
+		if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(rep.Dependencies) != len(c.checks) {
+			t.Errorf("%s: %d dependencies listed, want %d", c.name, len(rep.Dependencies), len(c.checks))
+		}
+		for _, d := range rep.Dependencies {
+			if (d.Status == "down") != (d.Error != "") {
+				t.Errorf("%s: %s status %q with error %q", c.name, d.Name, d.Status, d.Error)
+			}
+		}
+	}
+}
+
+func TestRankNormalPercentile(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":79.6},{"user_id":"b","percent":60}],"normal_percentile":{"mean":60,"sd":10},"precision":2}`, nil)
+	got := decode[rankResponse](t, resp)
+	if *got.Results[0].Percentile != 97.5 || *got.Results[1].Percentile != 50 {
+		t.Errorf("got %v, %v; want 97.5, 50", *got.Results[0].Percentile, *got.Results[1].Percentile)
+	}
+	resp = do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":1}],"normal_percentile":{"sd":0}}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("sd 0: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestRankIncludeSummary(t *testing.T) {
+	ts := newTestServer(t, nil)
+	body := `{"items":[{"user_id":"a","percent":20},{"user_id":"b","percent":21},{"user_id":"c","percent":22},
+		{"user_id":"d","percent":80},{"user_id":"e","percent":81},{"user_id":"f","percent":82}],"include_summary":true}`
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", body, nil))
+	s := got.Summary
+	if s == nil || s.Count != 6 || s.Min != 20 || s.Max != 82 || s.Median != 51 {
+		t.Fatalf("summary %+v", s)
+	}
+	if s.Modality.Modes != 2 || len(s.Modality.Locations) != 2 {
+		t.Errorf("modality %+v, want 2 modes", s.Modality)
+	}
+}
+
+func TestRankMinScoreCutoff(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const items = `"items":[{"user_id":"a","percent":80},{"user_id":"b","percent":60},{"user_id":"c","percent":60}]`
+	for cutoff, wantNull := range map[string]bool{"inclusive": false, "exclusive": true} {
+		got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"min_score":60,"cutoff":"`+cutoff+`"}`, nil))
+		for _, r := range got.Results[1:] {
+			if (r.Percentile == nil) != wantNull {
+				t.Errorf("%s: %s percentile %v", cutoff, r.UserID, r.Percentile)
+			}
+		}
+	}
+}
+
+func TestRankStabilityDelta(t *testing.T) {
+	ts := newTestServer(t, nil)
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":90},{"user_id":"b","percent":60.5},{"user_id":"c","percent":60}],"stability_delta":1}`, nil))
+	want := [][2]int{{1, 1}, {2, 3}, {2, 3}}
+	for i, r := range got.Results {
+		if [2]int{*r.BestRank, *r.WorstRank} != want[i] {
+			t.Errorf("%s: [%d %d], want %v", r.UserID, *r.BestRank, *r.WorstRank, want[i])
+		}
+	}
+}
+
+func TestRankWeightedTieWeight(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const items = `"items":[{"user_id":"a","percent":90,"weight":2},{"user_id":"b","percent":70,"weight":1},{"user_id":"c","percent":70,"weight":3},{"user_id":"d","percent":50,"weight":4}]`
+	for tw, want := range map[string]float64{"start": 40, "end": 80, "midpoint": 60} {
+		got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"weighted":true,"tie_weight":"`+tw+`"}`, nil))
+		if p := *got.Results[1].Percentile; p != want {
+			t.Errorf("%s: tied percentile %v, want %v", tw, p, want)
+		}
+	}
+}
+
+func TestRankBorda(t *testing.T) {
+	ts := newTestServer(t, nil)
+	body := `{"items":[
+		{"user_id":"a","metrics":{"sprint":10,"jump":1}},
+		{"user_id":"b","metrics":{"sprint":8,"jump":8}},
+		{"user_id":"c","metrics":{"sprint":6,"jump":9}}
+	],"borda":[{"metric":"sprint"},{"metric":"jump"}]}`
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", body, nil))
+	// a 1+3=4, b 2+2=4, c 3+1=4: all tied; a and c have a first place, a wins on user_id.
+	want := []struct {
+		id  string
+		pts float64
+	}{{"a", 4}, {"c", 4}, {"b", 4}}
+	for i, w := range want {
+		r := got.Results[i]
+		if r.UserID != w.id || r.BordaPoints == nil || *r.BordaPoints != w.pts {
+			t.Errorf("result %d = %s %v, want %s %v", i, r.UserID, r.BordaPoints, w.id, w.pts)
+		}
+	}
+}
+
+func TestRankWeights(t *testing.T) {
+	ts := newTestServer(t, nil)
+	body := `{"items":[
+		{"user_id":"a","percent":90,"metrics":{"avg_time_seconds":60}},
+		{"user_id":"b","percent":80,"metrics":{"avg_time_seconds":20}},
+		{"user_id":"c","percent":70,"metrics":{"avg_time_seconds":40}}
+	],"weights":{"percent":0.8,"avg_time_seconds":0.2},"lower_is_better":["avg_time_seconds"],"format":"columns"}`
+	resp := do(t, "POST", ts.URL+"/rank", body, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[rankColumns](t, resp)
+	// a .8*1 + 0 = .8, b .8*.5 + .2*1 = .6, c 0 + .2*.5 = .1.
+	if strings.Join(got.UserIDs, "") != "abc" || len(got.Composites) != 3 || math.Abs(got.Composites[1]-0.6) > 1e-12 {
+		t.Errorf("got %v %v", got.UserIDs, got.Composites)
+	}
+
+	// Speed outweighing accuracy puts b first.
+	body = strings.Replace(body, `"percent":0.8,"avg_time_seconds":0.2`, `"percent":0.2,"avg_time_seconds":0.8`, 1)
+	if got := decode[rankColumns](t, do(t, "POST", ts.URL+"/rank", body, nil)); got.UserIDs[0] != "b" {
+		t.Errorf("speed-weighted order %v", got.UserIDs)
+	}
+
+	for _, bad := range []string{
+		`"weights":{"percent":-1}`,
+		`"weights":{"speed":1}`,
+		`"weights":{"percent":1},"lower_is_better":["speed"]`,
+	} {
+		resp := do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":1}],`+bad+`}`, nil)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", bad, resp.StatusCode)
+		}
+	}
+}
+
+func TestRankDecay(t *testing.T) {
+	ts := newTestServer(t, nil)
+	body := `{"items":[
+		{"user_id":"a","percent":90,"finished_at":"2026-02-24T00:00:00Z"},
+		{"user_id":"b","percent":60,"finished_at":"2026-03-10T00:00:00Z"},
+		{"user_id":"c","percent":50,"metrics":{"taken":1773100800}}
+	],"decay":{"half_life_hours":168,"as_of":"2026-03-10T00:00:00Z"}`
+	resp := do(t, "POST", ts.URL+"/rank", body+`}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("c without finished_at: status %d, want 400", resp.StatusCode)
+	}
+
+	body = strings.Replace(body, `"metrics":{"taken":1773100800}`, `"finished_at":"2026-03-10T00:00:00Z"`, 1)
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", body+`}`, nil))
+	// a's 90 is two half-lives old: 22.5.
+	want := []struct {
+		id    string
+		score float64
+	}{{"b", 60}, {"c", 50}, {"a", 22.5}}
+	for i, w := range want {
+		r := got.Results[i]
+		if r.UserID != w.id || r.DecayedScore == nil || math.Abs(*r.DecayedScore-w.score) > 1e-9 {
+			t.Errorf("result %d = %s %v, want %s %v", i, r.UserID, r.DecayedScore, w.id, w.score)
+		}
+	}
+
+	// Any metric can hold the timestamp.
+	custom := `{"items":[{"user_id":"a","percent":90,"metrics":{"taken":1772150400}},{"user_id":"b","percent":60,"metrics":{"taken":1773100800}}],
+		"decay":{"half_life_hours":168,"time_metric":"taken","as_of":"2026-03-10T00:00:00Z"}}`
+	if got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", custom, nil)); got.Results[0].UserID != "b" {
+		t.Errorf("time_metric: order %+v", got.Results)
+	}
+
+	for _, bad := range []string{`"decay":{"half_life_hours":0}`, `"decay":{"half_life_hours":1,"time_metric":"x"},"transform":"log"`} {
+		resp := do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":1,"metrics":{"x":1}}],`+bad+`}`, nil)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", bad, resp.StatusCode)
+		}
+	}
+}
+
+func TestRankShrinkage(t *testing.T) {
+	ts := newTestServer(t, nil)
+	items := `"items":[
+		{"user_id":"one-shot","percent":100,"attempts":1},
+		{"user_id":"regular","percent":92,"attempts":40},
+		{"user_id":"new","percent":60,"attempts":9}
+	]`
+	// Without shrinkage the single perfect quiz wins.
+	if got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`}`, nil)); got.Results[0].UserID != "one-shot" || got.Results[0].AdjustedScore != nil {
+		t.Errorf("plain: %+v", got.Results[0])
+	}
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"shrinkage":{"prior_attempts":10}}`, nil))
+	want := []struct {
+		id    string
+		score float64
+	}{{"regular", 4544.0 / 50}, {"one-shot", 964.0 / 11}, {"new", 1404.0 / 19}}
+	for i, w := range want {
+		r := got.Results[i]
+		if r.UserID != w.id || r.AdjustedScore == nil || math.Abs(*r.AdjustedScore-w.score) > 1e-9 {
+			t.Errorf("result %d = %s %v, want %s %v", i, r.UserID, r.AdjustedScore, w.id, w.score)
+		}
+	}
+
+	for _, bad := range []string{
+		`{` + items + `,"shrinkage":{"prior_attempts":0}}`,
+		`{"items":[{"user_id":"a","percent":1}],"shrinkage":{"prior_attempts":5}}`,
+		`{"items":[{"user_id":"a","percent":1,"attempts":-2}]}`,
+		`{"items":[{"user_id":"a","percent":1,"attempts":2,"metrics":{"attempts":3}}]}`,
+	} {
+		if resp := do(t, "POST", ts.URL+"/rank", bad, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", bad, resp.StatusCode)
+		}
+	}
+}
+
+func TestRankWilson(t *testing.T) {
+	ts := newTestServer(t, nil)
+	items := `"items":[
+		{"user_id":"lucky","correct":3,"total":3},
+		{"user_id":"solid","correct":95,"total":100},
+		{"user_id":"steady","correct":40,"total":50}
+	]`
+	// Percents come from the counts: lucky's 100% wins on its own.
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"include_scores":true}`, nil))
+	if r := got.Results[0]; r.UserID != "lucky" || *r.Percent != 100 || r.WilsonScore != nil {
+		t.Errorf("by percent: %+v", r)
+	}
+	got = decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`,"scoring":"wilson"}`, nil))
+	want := []struct {
+		id    string
+		score float64
+	}{{"solid", 88.83}, {"steady", 66.96}, {"lucky", 43.85}}
+	for i, w := range want {
+		r := got.Results[i]
+		if r.UserID != w.id || r.WilsonScore == nil || math.Abs(*r.WilsonScore-w.score) > 0.01 {
+			t.Errorf("result %d = %s %v, want %s %v", i, r.UserID, r.WilsonScore, w.id, w.score)
+		}
+	}
+
+	for _, c := range []struct{ body, field string }{
+		{`{"items":[{"user_id":"a","correct":3}]}`, "items[0].total"},
+		{`{"items":[{"user_id":"a","correct":4,"total":3}]}`, "items[0].correct"},
+		{`{"items":[{"user_id":"a","percent":50,"correct":1,"total":2}]}`, "items[0].percent"},
+		{`{"items":[{"user_id":"a","correct":1,"total":2,"metrics":{"total":2}}]}`, "items[0].metrics.total"},
+	} {
+		resp := do(t, "POST", ts.URL+"/rank", c.body, nil)
+		if p := decode[problem](t, resp); resp.StatusCode != http.StatusBadRequest || len(p.Fields) != 1 || p.Fields[0].Field != c.field {
+			t.Errorf("%s: status %d, %+v; want %s", c.body, resp.StatusCode, p.Fields, c.field)
+		}
+	}
+	// Wilson scoring needs the counts on every item.
+	if resp := do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":50}],"scoring":"wilson"}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("percent-only wilson: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestRankShuffleSeed(t *testing.T) {
+	ts := newTestServer(t, nil)
+	body := `{"items":[{"user_id":"a","percent":5},{"user_id":"b","percent":5},{"user_id":"c","percent":5},{"user_id":"d","percent":5},{"user_id":"e","percent":5},{"user_id":"f","percent":9}],"shuffle_seed":42}`
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", body, nil))
+	var ids string
+	for _, r := range got.Results {
+		ids += r.UserID
+	}
+	if ids != "faecdb" {
+		t.Errorf("order %s, want faecdb", ids)
+	}
+}
+
+func TestRankAnchors(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const anchors = `"anchors":[{"score":40,"percentile":10},{"score":60,"percentile":50}]`
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":55},{"user_id":"b","percent":40}],`+anchors+`}`, nil))
+	if *got.Results[0].Percentile != 40 || *got.Results[1].Percentile != 10 {
+		t.Errorf("got %v, %v; want 40, 10", *got.Results[0].Percentile, *got.Results[1].Percentile)
+	}
+	resp := do(t, "POST", ts.URL+"/rank", `{"items":[],"anchors":[{"score":60,"percentile":50},{"score":40,"percentile":10}]}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("non-monotonic anchors: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestRankPins(t *testing.T) {
+	ts := newTestServer(t, nil)
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":90},{"user_id":"z","percent":1}],"pins":{"z":1}}`, nil))
+	if r := got.Results[0]; r.UserID != "z" || r.Rank != 1 || r.Percentile != nil {
+		t.Errorf("pinned: %+v", r)
+	}
+	if resp := do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":1}],"pins":{"a":1,"b":1}}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("conflicting pins: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestRankTopPercentile(t *testing.T) {
+	ts := newTestServer(t, nil)
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":90},{"user_id":"b","percent":50},{"user_id":"c","percent":10}],"top_percentile":99}`, nil))
+	if *got.Results[0].Percentile != 99 || *got.Results[1].Percentile != 50 {
+		t.Errorf("got %v, %v; want 99, 50", *got.Results[0].Percentile, *got.Results[1].Percentile)
+	}
+	if resp := do(t, "POST", ts.URL+"/rank", `{"items":[],"top_percentile":-1}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("negative top_percentile: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestRankPercentileEncodingBP(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const items = `"items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":70},{"user_id":"d","percent":60},{"user_id":"e","percent":50},{"user_id":"f","percent":40},{"user_id":"g","percent":30}]`
+	float := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`}`, nil))
+	if float.PercentileEncoding != "" {
+		t.Errorf("default encoding %q, want float (omitted)", float.PercentileEncoding)
+	}
+
+	resp := do(t, "POST", ts.URL+"/rank", `{`+items+`,"percentile_encoding":"bp","precision":1}`, nil)
+	raw, _ := io.ReadAll(resp.Body)
+	var bp rankResponse
+	if err := json.Unmarshal(raw, &bp); err != nil {
+		t.Fatal(err)
+	}
+	if bp.PercentileEncoding != "bp" || bp.PercentileDivisor != 100 {
+		t.Fatalf("encoding %q divisor %d, want bp 100", bp.PercentileEncoding, bp.PercentileDivisor)
+	}
+	if strings.Contains(string(raw), `"percentile":83.`) || !strings.Contains(string(raw), `"percentile":8333}`) {
+		t.Errorf("percentiles not integers: %s", raw)
+	}
+	for i, r := range bp.Results {
+		p := *float.Results[i].Percentile
+		if *r.Percentile != math.Round(p*100) {
+			t.Errorf("%s: bp %v, want round(%v*100)", r.UserID, *r.Percentile, p)
+		}
+		if d := *r.Percentile / float64(bp.PercentileDivisor); math.Abs(d-p) > 0.005 {
+			t.Errorf("%s: decodes to %v, want %v ± 0.005", r.UserID, d, p)
+		}
+	}
+
+	if resp := do(t, "POST", ts.URL+"/rank", `{"items":[],"percentile_encoding":"permille"}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown encoding: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestRankStrategy(t *testing.T) {
+	ts := newTestServer(t, nil)
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":90},{"user_id":"b","percent":90},{"user_id":"c","percent":80}],"strategy":"dense"}`, nil))
+	for i, want := range []int{1, 1, 2} {
+		if got.Results[i].Rank != want {
+			t.Errorf("%s: rank %d, want %d", got.Results[i].UserID, got.Results[i].Rank, want)
+		}
+	}
+	if resp := do(t, "POST", ts.URL+"/rank", `{"items":[],"strategy":"olympic"}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown strategy: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestRankCompetitionStrategy(t *testing.T) {
+	ts := newTestServer(t, nil)
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":90},{"user_id":"b","percent":90},{"user_id":"c","percent":80}],"strategy":"competition"}`, nil))
+	for i, want := range []int{1, 1, 3} {
+		if got.Results[i].Rank != want {
+			t.Errorf("%s: rank %d, want %d", got.Results[i].UserID, got.Results[i].Rank, want)
+		}
+	}
+}
+
+func TestRankFractionalStrategy(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const items = `"items":[{"user_id":"a","percent":90},{"user_id":"b","percent":90},{"user_id":"c","percent":80}]`
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"cohort_id":"frac",`+items+`,"strategy":"fractional"}`, nil))
+	for i, want := range []float64{1.5, 1.5, 3} {
+		if r := got.Results[i]; r.FractionalRank == nil || *r.FractionalRank != want {
+			t.Errorf("%s: fractional_rank %v, want %v", r.UserID, r.FractionalRank, want)
+		}
+	}
+	// Stored rankings keep it.
+	stored := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/frac", "", nil))
+	if r := stored.Results[0]; r.FractionalRank == nil || *r.FractionalRank != 1.5 {
+		t.Errorf("stored fractional_rank %v, want 1.5", r.FractionalRank)
+	}
+	plain := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`}`, nil))
+	if plain.Results[0].FractionalRank != nil {
+		t.Error("fractional_rank reported without the fractional strategy")
+	}
+}
+
+func TestRankPercentileMethod(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const items = `"items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":80},{"user_id":"d","percent":70}]`
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"cohort_id":"m",`+items+`,"percentile_method":"midpoint"}`, nil))
+	if got.PercentileMethod != rank.MethodMidpoint {
+		t.Errorf("echoed method %q, want midpoint", got.PercentileMethod)
+	}
+	for i, want := range []float64{87.5, 50, 50, 12.5} {
+		if p := *got.Results[i].Percentile; p != want {
+			t.Errorf("%s: %v, want %v", got.Results[i].UserID, p, want)
+		}
+	}
+	if stored := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/m", "", nil)); stored.PercentileMethod != rank.MethodMidpoint {
+		t.Errorf("stored method %q, want midpoint", stored.PercentileMethod)
+	}
+	if plain := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{`+items+`}`, nil)); plain.PercentileMethod != "" {
+		t.Errorf("default echoed as %q, want omitted", plain.PercentileMethod)
+	}
+	if resp := do(t, "POST", ts.URL+"/rank", `{"items":[],"percentile_method":"median"}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown method: status %d, want 400", resp.StatusCode)
+	}
+}
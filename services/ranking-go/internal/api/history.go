@@ -0,0 +1,119 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"ranking-go/internal/store"
+)
+
+type snapshotResponse struct {
+	Version    int64        `json:"version"`
+	RankedAt   time.Time    `json:"ranked_at"`
+	CohortSize int          `json:"cohort_size"`
+	Results    []rankResult `json:"results"`
+}
+
+type cohortHistoryResponse struct {
+	CohortID           string             `json:"cohort_id"`
+	Snapshots          []snapshotResponse `json:"snapshots"`
+	PercentileEncoding string             `json:"percentile_encoding,omitempty"`
+	PercentileDivisor  int                `json:"percentile_divisor,omitempty"`
+}
+
+type userHistoryEntry struct {
+	Version    int64     `json:"version"`
+	RankedAt   time.Time `json:"ranked_at"`
+	CohortSize int       `json:"cohort_size"`
+	Rank       int       `json:"rank"`
+	Percentile *float64  `json:"percentile"`
+}
+
+type userHistoryResponse struct {
+	CohortID           string             `json:"cohort_id"`
+	UserID             string             `json:"user_id"`
+	History            []userHistoryEntry `json:"history"`
+	PercentileEncoding string             `json:"percentile_encoding,omitempty"`
+	PercentileDivisor  int                `json:"percentile_divisor,omitempty"`
+}
+
+// history loads the cohort's snapshots within the optional from and to
+// query parameters (RFC 3339, inclusive), writing the error response and
+// returning false on failure.
+func (s *Server) history(w http.ResponseWriter, r *http.Request) ([]store.Ranking, bool) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return nil, false
+	}
+	var bounds [2]time.Time
+	for i, name := range []string{"from", "to"} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("%s must be an RFC 3339 time, got %q", name, v))
+			return nil, false
+		}
+		bounds[i] = at
+	}
+	if !bounds[0].IsZero() && !bounds[1].IsZero() && bounds[1].Before(bounds[0]) {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "to must not be before from")
+		return nil, false
+	}
+	snaps, err := s.Store.History(r.Context(), t.ID, r.PathValue("cohort_id"), bounds[0], bounds[1])
+	if err != nil {
+		writeStoreError(w, r, err)
+		return nil, false
+	}
+	return snaps, true
+}
+
+// cohortHistoryHandler returns the cohort's stored rankings, oldest first.
+func (s *Server) cohortHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	snaps, ok := s.history(w, r)
+	if !ok {
+		return
+	}
+	resp := cohortHistoryResponse{CohortID: r.PathValue("cohort_id"), Snapshots: []snapshotResponse{}}
+	for _, snap := range snaps {
+		rows := s.rowsOf(snap.CohortID, snap.Options.Quantile, snap.Results)
+		resp.Snapshots = append(resp.Snapshots, snapshotResponse{
+			Version:    snap.Version,
+			RankedAt:   snap.RankedAt,
+			CohortSize: len(snap.Results),
+			Results:    rows.Results,
+		})
+		resp.PercentileEncoding, resp.PercentileDivisor = rows.PercentileEncoding, rows.PercentileDivisor
+	}
+	writeJSON(w, withCase(resp, s.Defaults.FieldCase))
+}
+
+// userHistoryHandler returns one user's rank and percentile in each stored
+// ranking of the cohort that included them, oldest first.
+func (s *Server) userHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	snaps, ok := s.history(w, r)
+	if !ok {
+		return
+	}
+	userID := r.PathValue("user_id")
+	resp := userHistoryResponse{CohortID: r.PathValue("cohort_id"), UserID: userID, History: []userHistoryEntry{}}
+	for _, snap := range snaps {
+		i := userIndex(snap.Results, userID)
+		if i < 0 {
+			continue
+		}
+		row := s.rowsOf(snap.CohortID, snap.Options.Quantile, snap.Results[i:i+1])
+		resp.History = append(resp.History, userHistoryEntry{
+			Version:    snap.Version,
+			RankedAt:   snap.RankedAt,
+			CohortSize: len(snap.Results),
+			Rank:       row.Results[0].Rank,
+			Percentile: row.Results[0].Percentile,
+		})
+		resp.PercentileEncoding, resp.PercentileDivisor = row.PercentileEncoding, row.PercentileDivisor
+	}
+	writeJSON(w, withCase(resp, s.Defaults.FieldCase))
+}
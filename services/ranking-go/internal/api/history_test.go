@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80}]}`, nil).Body.Close()
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":70},{"user_id":"c","percent":80}]}`, nil).Body.Close()
+
+	resp := do(t, "GET", ts.URL+"/rank/c1/history", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	hist := decode[cohortHistoryResponse](t, resp)
+	if len(hist.Snapshots) != 2 || hist.Snapshots[0].Version != 1 || hist.Snapshots[1].Version != 2 {
+		t.Fatalf("snapshots %+v", hist.Snapshots)
+	}
+	if s := hist.Snapshots[1]; s.CohortSize != 2 || s.Results[0].UserID != "c" || s.RankedAt.IsZero() {
+		t.Errorf("latest snapshot %+v", s)
+	}
+
+	user := decode[userHistoryResponse](t, do(t, "GET", ts.URL+"/rank/c1/users/a/history", "", nil))
+	if len(user.History) != 2 || user.History[0].Rank != 1 || user.History[1].Rank != 2 || user.History[1].Version != 2 {
+		t.Errorf("user a history %+v", user.History)
+	}
+	// b dropped out of the second ranking.
+	user = decode[userHistoryResponse](t, do(t, "GET", ts.URL+"/rank/c1/users/b/history", "", nil))
+	if len(user.History) != 1 || user.History[0].Version != 1 {
+		t.Errorf("user b history %+v", user.History)
+	}
+	user = decode[userHistoryResponse](t, do(t, "GET", ts.URL+"/rank/c1/users/nobody/history", "", nil))
+	if user.History == nil || len(user.History) != 0 {
+		t.Errorf("unknown user history %+v", user.History)
+	}
+
+	future := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	if hist := decode[cohortHistoryResponse](t, do(t, "GET", ts.URL+"/rank/c1/history?from="+future, "", nil)); len(hist.Snapshots) != 0 {
+		t.Errorf("from the future: %+v", hist.Snapshots)
+	}
+
+	for path, want := range map[string]string{
+		"/rank/c1/history?from=yesterday":                                    codeInvalidRequest,
+		"/rank/c1/history?from=2026-02-01T00:00:00Z&to=2026-01-01T00:00:00Z": codeInvalidRequest,
+		"/rank/none/history":                                                 codeCohortNotFound,
+		"/rank/none/users/a/history":                                         codeCohortNotFound,
+	} {
+		if p := decode[problem](t, do(t, "GET", ts.URL+path, "", nil)); p.Code != want {
+			t.Errorf("%s: code %s, want %s", path, p.Code, want)
+		}
+	}
+}
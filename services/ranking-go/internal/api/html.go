@@ -0,0 +1,65 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// rankTable renders a ranking as a plain table. html/template escapes every
+// value, so user_ids can't inject markup.
+var rankTable = template.Must(template.New("rank").Funcs(template.FuncMap{
+	"pct": func(p *float64) string {
+		if p == nil {
+			return "—"
+		}
+		return strconv.FormatFloat(*p, 'f', -1, 64)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Ranking {{.CohortID}}</title></head>
+<body>
+<table>
+<caption>{{.CohortID}}</caption>
+<thead><tr><th>user_id</th><th>rank</th><th>percentile</th></tr></thead>
+<tbody>
+{{- range .Results}}
+<tr><td>{{.UserID}}</td><td>{{.Rank}}</td><td>{{pct .Percentile}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+// responseFormat returns the first type in Accept that this service can
+// produce for a ranking: "html", "csv" or "json". Anything else gets JSON.
+func responseFormat(r *http.Request) string {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		switch strings.TrimSpace(mt) {
+		case "text/html":
+			return "html"
+		case "text/csv":
+			return "csv"
+		case "application/json", "*/*":
+			return "json"
+		}
+	}
+	return "json"
+}
+
+// writeRanking writes resp as HTML, CSV or JSON depending on the Accept
+// header.
+func writeRanking(w http.ResponseWriter, r *http.Request, resp rankResponse, opts rankOptions) {
+	switch responseFormat(r) {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = rankTable.Execute(w, resp)
+	case "csv":
+		writeRankingCSV(w, resp.Results)
+	default:
+		writeJSON(w, withCase(present(resp, opts), opts.FieldCase))
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRankHTMLTable(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank",
+		`{"cohort_id":"c1","items":[{"user_id":"alice","percent":90},{"user_id":"<script>alert(1)</script>","percent":40}]}`,
+		map[string]string{"Accept": "text/html,application/xhtml+xml,*/*;q=0.8"})
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("content type %q", ct)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	body := string(b)
+
+	for _, want := range []string{
+		"<th>user_id</th><th>rank</th><th>percentile</th>",
+		"<tr><td>alice</td><td>1</td><td>100</td></tr>",
+		"<tr><td>&lt;script&gt;alert(1)&lt;/script&gt;</td><td>2</td><td>0</td></tr>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "<script>") {
+		t.Errorf("user_id not escaped:\n%s", body)
+	}
+	if n := strings.Count(body, "<tr><td>"); n != 2 {
+		t.Errorf("%d data rows, want 2", n)
+	}
+
+	// The stored ranking can be fetched as HTML too.
+	resp = do(t, "GET", ts.URL+"/rank/c1", "", map[string]string{"Accept": "text/html"})
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("GET content type %q", ct)
+	}
+}
+
+func TestRankDefaultsToJSON(t *testing.T) {
+	ts := newTestServer(t, nil)
+	for _, accept := range []string{"", "*/*", "application/json, text/html"} {
+		resp := do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":1}]}`, map[string]string{"Accept": accept})
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Accept %q: content type %q", accept, ct)
+		}
+	}
+}
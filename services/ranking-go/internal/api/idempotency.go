@@ -0,0 +1,150 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"ranking-go/internal/store"
+)
+
+const (
+	// idempotencyTTL is how long a response is replayed for retries of its
+	// Idempotency-Key.
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyPendingTTL is how long a request holds its key while
+	// running. It outlasts any response (see HTTP_WRITE_TIMEOUT), so the
+	// key is only freed early if the process dies mid-request.
+	idempotencyPendingTTL = 10 * time.Minute
+	maxIdempotencyKeyLen  = 255
+	// maxIdempotentResponse bounds the response saved for replay. A larger
+	// one frees the key instead, so a retry runs the request again.
+	maxIdempotentResponse = 4 << 20
+)
+
+// savedHeaders are the response headers kept with a response saved for
+// replay or caching.
+var savedHeaders = []string{"Content-Type", "Location", "Link", "ETag", "Cache-Control", "X-Content-Type-Options"}
+
+// idempotent lets a client such as a retrying gateway resend h safely. A
+// request with an Idempotency-Key runs once per tenant and key: a retry
+// gets the saved response with Idempotent-Replayed: true, 409 while the
+// first is still running, and 422 if its method, URL or body differ.
+// 5xx and 409 responses are not saved, so retrying those runs the request
+// again.
+func (s *Server) idempotent(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			h(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen || !printable(key) {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "Idempotency-Key must be 1 to 255 visible ASCII characters")
+			return
+		}
+		t := s.resolveTenant(w, r)
+		if t == nil {
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			decodeError(w, r, "body", err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+
+		rec := store.Idempotency{
+			Key:     key,
+			Request: r.Method + " " + r.URL.RequestURI() + " " + hex.EncodeToString(sum[:]),
+			Expires: time.Now().Add(idempotencyPendingTTL),
+		}
+		cur, claimed, err := s.Store.ClaimIdempotency(r.Context(), t.ID, rec)
+		switch {
+		case err != nil:
+			writeProblem(w, r, http.StatusInternalServerError, codeStoreError, "store: "+err.Error())
+			return
+		case claimed:
+		case cur.Request != rec.Request:
+			writeProblem(w, r, http.StatusUnprocessableEntity, codeIdempotencyKeyReused, "Idempotency-Key was already used for a different request")
+			return
+		case !cur.Done:
+			w.Header().Set("Retry-After", "1")
+			writeProblem(w, r, http.StatusConflict, codeIdempotencyKeyInUse, "a request with this Idempotency-Key is still running")
+			return
+		default:
+			for name, values := range cur.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(cur.Status)
+			w.Write(cur.Body)
+			return
+		}
+
+		resp := &responseCopy{ResponseWriter: w, status: http.StatusOK, limit: maxIdempotentResponse}
+		h(resp, r)
+		// The client may have gone, but its retry is exactly what the
+		// record is for.
+		ctx := context.WithoutCancel(r.Context())
+		if resp.status >= 500 || resp.status == http.StatusConflict || resp.tooLarge {
+			err = s.Store.DeleteIdempotency(ctx, t.ID, key)
+		} else {
+			rec.Done, rec.Status, rec.Header, rec.Body = true, resp.status, resp.header, resp.body.Bytes()
+			rec.Expires = time.Now().Add(idempotencyTTL)
+			err = s.Store.PutIdempotency(ctx, t.ID, rec)
+		}
+		if err != nil {
+			s.logger().Error("idempotency key not saved", "request_id", requestID(r.Context()), "error", err)
+		}
+	}
+}
+
+// responseCopy passes a response through while keeping its status,
+// savedHeaders and up to limit bytes of body. Unwrap keeps
+// http.ResponseController working through it.
+type responseCopy struct {
+	http.ResponseWriter
+	limit    int
+	status   int
+	header   map[string][]string
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+func (c *responseCopy) WriteHeader(code int) {
+	if c.header == nil {
+		c.status = code
+		c.header = map[string][]string{}
+		for _, name := range savedHeaders {
+			if v := c.Header().Values(name); len(v) > 0 {
+				c.header[http.CanonicalHeaderKey(name)] = v
+			}
+		}
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *responseCopy) Write(b []byte) (int, error) {
+	if c.header == nil {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.tooLarge {
+		if c.body.Len()+len(b) > c.limit {
+			c.tooLarge = true
+			c.body = bytes.Buffer{}
+		} else {
+			c.body.Write(b)
+		}
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *responseCopy) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	st := store.NewMemory()
+	mux := http.NewServeMux()
+	NewServer(st, nil).RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	key := map[string]string{"Idempotency-Key": "k1"}
+	body := `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80}]}`
+
+	first := do(t, "POST", ts.URL+"/rank", body, key)
+	firstBody, _ := io.ReadAll(first.Body)
+	retry := do(t, "POST", ts.URL+"/rank", body, key)
+	retryBody, _ := io.ReadAll(retry.Body)
+	if retry.StatusCode != http.StatusOK || retry.Header.Get("Idempotent-Replayed") != "true" || string(retryBody) != string(firstBody) {
+		t.Errorf("retry: %d %q\n%s\nwant\n%s", retry.StatusCode, retry.Header.Get("Idempotent-Replayed"), retryBody, firstBody)
+	}
+	if first.Header.Get("Idempotent-Replayed") != "" || retry.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers: first %v, retry %v", first.Header, retry.Header)
+	}
+
+	// A score update is applied once however often it is retried.
+	score := map[string]string{"Idempotency-Key": "s1"}
+	for i := 0; i < 3; i++ {
+		if resp := do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"b","percent":95}`, score); resp.StatusCode != http.StatusOK {
+			t.Fatalf("score update %d: %d", i, resp.StatusCode)
+		}
+	}
+	if got := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/c1", "", nil)); got.Version != 2 {
+		t.Errorf("version %d after retried updates, want 2", got.Version)
+	}
+
+	// The key is bound to its request and scoped to the tenant.
+	if resp := do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"b","percent":10}`, score); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("reused key: %d, want 422", resp.StatusCode)
+	}
+	if resp := do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"b","percent":95}`, map[string]string{"Idempotency-Key": "s1", "X-Tenant": "other"}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("other tenant: %d, want 404 for its missing cohort", resp.StatusCode)
+	}
+
+	// A conflict is not saved, so the retry with the fresh version runs.
+	patch := map[string]string{"Idempotency-Key": "p1", "If-Match": `"1"`}
+	patchBody := `{"items":[{"user_id":"c","percent":50}]}`
+	if resp := do(t, "PATCH", ts.URL+"/rank/c1", patchBody, patch); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("stale patch: %d, want 409", resp.StatusCode)
+	}
+	patch["If-Match"] = `"2"`
+	if resp := do(t, "PATCH", ts.URL+"/rank/c1", patchBody, patch); resp.StatusCode != http.StatusOK {
+		t.Errorf("retried patch: %d, want 200", resp.StatusCode)
+	}
+
+	// A retry while the first request is still running is told to wait.
+	scoreBody := `{"user_id":"a","percent":20}`
+	sum := sha256.Sum256([]byte(scoreBody))
+	st.ClaimIdempotency(context.Background(), tenant.Default, store.Idempotency{
+		Key:     "busy",
+		Request: "POST /rank/c1/scores " + hex.EncodeToString(sum[:]),
+		Expires: time.Now().Add(time.Minute),
+	})
+	resp := do(t, "POST", ts.URL+"/rank/c1/scores", scoreBody, map[string]string{"Idempotency-Key": "busy"})
+	if resp.StatusCode != http.StatusConflict || resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("running key: %d, Retry-After %q; want 409, 1", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	if resp := do(t, "POST", ts.URL+"/rank", body, map[string]string{"Idempotency-Key": strings.Repeat("k", 256)}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("long key: %d, want 400", resp.StatusCode)
+	}
+}
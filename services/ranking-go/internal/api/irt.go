@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"ranking-go/internal/irt"
+	"ranking-go/internal/rank"
+)
+
+// maxIRTQuestions bounds the questions of one POST /rank/irt.
+const maxIRTQuestions = 1000
+
+type irtRequest struct {
+	CohortID string `json:"cohort_id,omitempty"`
+	// Method is "eap" (default) or "mle".
+	Method    string        `json:"method,omitempty"`
+	Questions []irtQuestion `json:"questions"`
+	Responses []irtAnswers  `json:"responses"`
+}
+
+type irtQuestion struct {
+	ID         string  `json:"id"`
+	Difficulty float64 `json:"difficulty"`
+	// Discrimination defaults to 1.
+	Discrimination *float64 `json:"discrimination,omitempty"`
+}
+
+// irtAnswers is one user's response vector, aligned with the request's
+// questions: 1 correct, 0 wrong, null not given.
+type irtAnswers struct {
+	UserID    string `json:"user_id"`
+	Responses []*int `json:"responses"`
+}
+
+type irtResponse struct {
+	CohortID           string      `json:"cohort_id,omitempty"`
+	Method             string      `json:"method"`
+	PercentileEncoding string      `json:"percentile_encoding,omitempty"`
+	PercentileDivisor  int         `json:"percentile_divisor,omitempty"`
+	Results            []irtResult `json:"results"`
+}
+
+type irtResult struct {
+	rankResult
+	Theta float64 `json:"theta"`
+	// StandardError is null when the answers carry no information.
+	StandardError *float64 `json:"standard_error"`
+	Answered      int      `json:"answered"`
+}
+
+func (req irtRequest) validate() error {
+	ve := &validationError{}
+	switch irt.Method(req.Method) {
+	case "", irt.MethodEAP, irt.MethodMLE:
+	default:
+		ve.add("method", codeInvalidRequest, "must be eap or mle, got %q", req.Method)
+	}
+	switch {
+	case len(req.Questions) == 0:
+		ve.add("questions", codeMissingField, "at least one question is required")
+	case len(req.Questions) > maxIRTQuestions:
+		ve.add("questions", codeInvalidRequest, "at most %d questions, got %d", maxIRTQuestions, len(req.Questions))
+	}
+	ids := make(map[string]bool, len(req.Questions))
+	for i, q := range req.Questions {
+		at := fmt.Sprintf("questions[%d].", i)
+		switch {
+		case q.ID == "":
+			ve.add(at+"id", codeMissingField, "is required")
+		case ids[q.ID]:
+			ve.add(at+"id", codeInvalidRequest, "duplicate question id %q", q.ID)
+		}
+		ids[q.ID] = true
+		if !finite(q.Difficulty) {
+			ve.add(at+"difficulty", codeInvalidNumber, "must be a finite number")
+		}
+		if a := q.Discrimination; a != nil && !(*a > 0 && finite(*a)) {
+			ve.add(at+"discrimination", codeInvalidNumber, "must be a positive number, got %v", *a)
+		}
+	}
+	if len(req.Responses) == 0 {
+		ve.add("responses", codeMissingField, "at least one response is required")
+	}
+	users := make(map[string]bool, len(req.Responses))
+	for i, r := range req.Responses {
+		at := fmt.Sprintf("responses[%d].", i)
+		switch {
+		case r.UserID == "":
+			ve.add(at+"user_id", codeEmptyUserID, "must not be empty")
+		case users[r.UserID]:
+			ve.add(at+"user_id", codeDuplicateUserID, "duplicate user_id %q", r.UserID)
+		}
+		users[r.UserID] = true
+		if len(r.Responses) != len(req.Questions) {
+			ve.add(at+"responses", codeInvalidRequest, "must have one entry per question (%d), got %d", len(req.Questions), len(r.Responses))
+			continue
+		}
+		answered := 0
+		for j, v := range r.Responses {
+			if v == nil {
+				continue
+			}
+			answered++
+			if *v != 0 && *v != 1 {
+				ve.add(fmt.Sprintf("%sresponses[%d]", at, j), codeInvalidNumber, "must be 0, 1 or null, got %d", *v)
+			}
+		}
+		if answered == 0 {
+			ve.add(at+"responses", codeInvalidRequest, "must answer at least one question")
+		}
+	}
+	return ve.orNil()
+}
+
+// irtHandler estimates each user's ability from their answers to
+// calibrated questions and ranks users by it, best first. Ranks and
+// percentiles follow the configured defaults; nothing is stored.
+func (s *Server) irtHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	var req irtRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, "json", err)
+		return
+	}
+	logRequest(r, req.CohortID, len(req.Responses))
+	if limit, tooMany := s.itemLimit(t); limit > 0 && len(req.Responses) > limit {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codeTooManyItems, tooMany.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	method := irt.Method(req.Method)
+	if method == "" {
+		method = irt.MethodEAP
+	}
+
+	questions := make([]irt.Question, len(req.Questions))
+	for i, q := range req.Questions {
+		questions[i] = irt.Question{ID: q.ID, Difficulty: q.Difficulty, Discrimination: 1}
+		if q.Discrimination != nil {
+			questions[i].Discrimination = *q.Discrimination
+		}
+	}
+	responses := make([]irt.Response, len(req.Responses))
+	for i, resp := range req.Responses {
+		answers := make(map[string]bool, len(resp.Responses))
+		for j, v := range resp.Responses {
+			if v != nil {
+				answers[questions[j].ID] = *v == 1
+			}
+		}
+		responses[i] = irt.Response{UserID: resp.UserID, Answers: answers}
+	}
+	abilities, err := irt.Estimate(questions, responses, method)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	items := make([]rank.Item, len(abilities))
+	byUser := make(map[string]irt.Ability, len(abilities))
+	for i, a := range abilities {
+		items[i] = rank.Item{UserID: a.UserID, Percent: a.Theta}
+		byUser[a.UserID] = a
+	}
+	results, err := rank.Rank(items, rank.Options{})
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	rows := s.rowsOf(req.CohortID, "", results)
+	out := irtResponse{
+		CohortID:           req.CohortID,
+		Method:             string(method),
+		PercentileEncoding: rows.PercentileEncoding,
+		PercentileDivisor:  rows.PercentileDivisor,
+		Results:            make([]irtResult, len(rows.Results)),
+	}
+	for i, row := range rows.Results {
+		a := byUser[row.UserID]
+		out.Results[i] = irtResult{rankResult: row, Theta: a.Theta, Answered: a.Answered}
+		if !math.IsInf(a.SE, 0) && !math.IsNaN(a.SE) {
+			out.Results[i].StandardError = &a.SE
+		}
+	}
+	writeJSON(w, withCase(out, s.Defaults.FieldCase))
+}
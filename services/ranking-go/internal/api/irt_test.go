@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRankIRT(t *testing.T) {
+	ts := newTestServer(t, nil)
+	body := `{"cohort_id":"mock-1","method":"%s","questions":[
+		{"id":"q1","difficulty":-1},
+		{"id":"q2","difficulty":1},
+		{"id":"q3","difficulty":0,"discrimination":2.5}
+	],"responses":[
+		{"user_id":"easy-only","responses":[1,0,0]},
+		{"user_id":"sharp","responses":[0,0,1]},
+		{"user_id":"all","responses":[1,1,1]},
+		{"user_id":"partial","responses":[null,1,null]}
+	]}`
+	for _, method := range []string{"eap", "mle"} {
+		resp := do(t, "POST", ts.URL+"/rank/irt", fmt.Sprintf(body, method), nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d", method, resp.StatusCode)
+		}
+		got := decode[irtResponse](t, resp)
+		if got.Method != method || got.CohortID != "mock-1" || len(got.Results) != 4 {
+			t.Fatalf("%s: %+v", method, got)
+		}
+		if r := got.Results[0]; r.UserID != "all" || r.Rank != 1 || r.Answered != 3 || *r.Percentile != 100 {
+			t.Errorf("%s: top %+v", method, r)
+		}
+		// One right answer on the discriminating question beats one on
+		// the easy question.
+		pos := map[string]int{}
+		for i, r := range got.Results {
+			pos[r.UserID] = i
+			if i > 0 && r.Theta > got.Results[i-1].Theta {
+				t.Errorf("%s: not ordered by theta: %+v", method, got.Results)
+			}
+		}
+		if pos["sharp"] > pos["easy-only"] {
+			t.Errorf("%s: sharp below easy-only: %+v", method, got.Results)
+		}
+		if p := got.Results[pos["partial"]]; p.Answered != 1 || p.StandardError == nil {
+			t.Errorf("%s: partial %+v", method, p)
+		}
+	}
+
+	for _, c := range []struct{ body, field string }{
+		{fmt.Sprintf(body, "rasch"), "method"},
+		{`{"questions":[{"id":"q","difficulty":0,"discrimination":0}],"responses":[{"user_id":"a","responses":[1]}]}`, "questions[0].discrimination"},
+		{`{"questions":[{"id":"q","difficulty":0}],"responses":[{"user_id":"a","responses":[1,0]}]}`, "responses[0].responses"},
+		{`{"questions":[{"id":"q","difficulty":0}],"responses":[{"user_id":"a","responses":[2]}]}`, "responses[0].responses[0]"},
+		{`{"questions":[{"id":"q","difficulty":0}],"responses":[{"user_id":"a","responses":[null]}]}`, "responses[0].responses"},
+		{`{"questions":[{"id":"q","difficulty":0}],"responses":[{"user_id":"a","responses":[1]},{"user_id":"a","responses":[0]}]}`, "responses[1].user_id"},
+	} {
+		resp := do(t, "POST", ts.URL+"/rank/irt", c.body, nil)
+		if p := decode[problem](t, resp); resp.StatusCode != http.StatusBadRequest || len(p.Fields) != 1 || p.Fields[0].Field != c.field {
+			t.Errorf("%s: status %d, %+v; want %s", c.body, resp.StatusCode, p.Fields, c.field)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"ranking-go/internal/tracing"
+)
+
+type jobStatus string
+
+const (
+	jobQueued  jobStatus = "queued"
+	jobRunning jobStatus = "running"
+	jobDone    jobStatus = "done"
+	jobFailed  jobStatus = "failed"
+)
+
+const (
+	// defaultJobWorkers is how many jobs rank at once when
+	// Server.JobWorkers is unset.
+	defaultJobWorkers = 2
+	// maxPendingJobs bounds queued plus running jobs; beyond it
+	// POST /rank/jobs answers 503.
+	maxPendingJobs = 64
+	// jobRetention is how long a finished job's result stays readable.
+	jobRetention = time.Hour
+)
+
+// job is one asynchronous /rank computation. Fields after mu are guarded
+// by it.
+type job struct {
+	id        string
+	tenantID  string
+	cohortID  string
+	opts      rankOptions
+	createdAt time.Time
+	callback  string
+	// trace is the submitting request's span, parent of the job's.
+	trace tracing.SpanContext
+	// requestID is the submitting request's X-Request-ID.
+	requestID string
+
+	mu         sync.Mutex
+	status     jobStatus
+	finishedAt time.Time
+	resp       rankResponse
+	err        string
+	// cbStatus is "pending" until the callback is delivered or given up.
+	cbStatus   string
+	cbAttempts int
+	cbError    string
+}
+
+type jobResponse struct {
+	JobID      string         `json:"job_id"`
+	Status     jobStatus      `json:"status"`
+	CohortID   string         `json:"cohort_id,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Result     any            `json:"result,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Callback   *callbackState `json:"callback,omitempty"`
+}
+
+// callbackState reports a job's callback delivery.
+type callbackState struct {
+	URL      string `json:"url"`
+	Status   string `json:"status"` // pending, delivered or failed
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (j *job) response() jobResponse {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := jobResponse{JobID: j.id, Status: j.status, CohortID: j.cohortID, CreatedAt: j.createdAt, Error: j.err}
+	if !j.finishedAt.IsZero() {
+		t := j.finishedAt
+		out.FinishedAt = &t
+	}
+	if j.status == jobDone {
+		out.Result = present(j.resp, j.opts)
+	}
+	if j.callback != "" {
+		out.Callback = &callbackState{URL: j.callback, Status: j.cbStatus, Attempts: j.cbAttempts, Error: j.cbError}
+	}
+	return out
+}
+
+// jobTable holds the server's jobs in memory; its zero value is ready to
+// use. Jobs do not survive a restart.
+type jobTable struct {
+	mu      sync.Mutex
+	jobs    map[string]*job
+	pending int
+	sem     chan struct{}
+	// running counts jobs until their callback is settled too.
+	running sync.WaitGroup
+}
+
+// add registers j as queued, dropping jobs finished more than
+// jobRetention ago. It reports false when too many jobs are pending.
+func (t *jobTable) add(j *job, workers int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending >= maxPendingJobs {
+		return false
+	}
+	if t.jobs == nil {
+		t.jobs = map[string]*job{}
+		t.sem = make(chan struct{}, workers)
+	}
+	now := time.Now()
+	for id, old := range t.jobs {
+		old.mu.Lock()
+		expired := !old.finishedAt.IsZero() && now.Sub(old.finishedAt) > jobRetention
+		old.mu.Unlock()
+		if expired {
+			delete(t.jobs, id)
+		}
+	}
+	j.status = jobQueued
+	t.jobs[j.id] = j
+	t.pending++
+	t.running.Add(1)
+	return true
+}
+
+func (t *jobTable) get(id string) *job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.jobs[id]
+}
+
+func (t *jobTable) done() {
+	t.mu.Lock()
+	t.pending--
+	t.mu.Unlock()
+}
+
+func newJobID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// createJobHandler accepts a /rank body (JSON or NDJSON), queues it and
+// answers 202 with the job's ID at once; the ranking and its storage run
+// in the background.
+func (s *Server) createJobHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	req, ok := s.decodeRankRequest(w, r, t)
+	if !ok {
+		return
+	}
+	if req.Export != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "export is not supported for jobs")
+		return
+	}
+	if len(req.subjects) > 0 {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "subjects are only supported by /rank")
+		return
+	}
+	// Reject bad options now rather than in a failed job.
+	if err := req.validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if err := req.toRank().Validate(); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidOptions, err.Error())
+		return
+	}
+	if req.CallbackURL != "" {
+		if s.Webhook.Secret == "" {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "callback_url needs a webhook secret configured")
+			return
+		}
+		if err := s.Webhook.validateCallbackURL(req.CallbackURL); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+	}
+
+	workers := s.JobWorkers
+	if workers <= 0 {
+		workers = defaultJobWorkers
+	}
+	j := &job{id: newJobID(), tenantID: t.ID, cohortID: req.CohortID, opts: req.rankOptions, createdAt: time.Now().UTC(), callback: req.CallbackURL, trace: tracing.SpanContextFrom(r.Context()), requestID: requestID(r.Context())}
+	if j.callback != "" {
+		j.cbStatus = "pending"
+	}
+	if !s.jobs.add(j, workers) {
+		w.Header().Set("Retry-After", "30")
+		writeProblem(w, r, http.StatusServiceUnavailable, codeJobQueueFull, "too many pending jobs")
+		return
+	}
+	go s.runJob(j, req)
+
+	w.Header().Set("Location", "/rank/jobs/"+j.id)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(withCase(j.response(), req.FieldCase))
+}
+
+// runJob ranks and stores req as POST /rank would, then sends the
+// job's callback, if any.
+func (s *Server) runJob(j *job, req rankRequest) {
+	defer s.jobs.running.Done()
+	ctx, span := s.Tracer.Start(tracing.ContextWithSpanContext(context.Background(), j.trace), "rank job", tracing.KindInternal,
+		tracing.Attr{Key: "ranking.job_id", Value: j.id})
+	defer span.End()
+	payload := s.finishJob(ctx, j, req)
+	log := s.logger().With("job_id", j.id, "request_id", j.requestID)
+	if payload.Error != "" {
+		span.SetError(errors.New(payload.Error))
+		log.Warn("job failed", "cohort_id", j.cohortID, "error", payload.Error)
+	}
+	if j.callback == "" {
+		return
+	}
+	n, err := s.Webhook.deliver(ctx, j.callback, payload, j.requestID)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cbAttempts = n
+	if err != nil {
+		j.cbStatus, j.cbError = "failed", err.Error()
+		log.Warn("job callback failed", "attempts", n, "error", err)
+		return
+	}
+	j.cbStatus = "delivered"
+}
+
+// finishJob ranks req once a worker slot is free. The slot is released
+// before the callback, whose retries can take a while.
+func (s *Server) finishJob(ctx context.Context, j *job, req rankRequest) callbackPayload {
+	defer s.jobs.done()
+	s.jobs.sem <- struct{}{}
+	defer func() { <-s.jobs.sem }()
+
+	j.mu.Lock()
+	j.status = jobRunning
+	j.mu.Unlock()
+
+	resp, err := s.rankJob(ctx, j.tenantID, req)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.finishedAt = time.Now().UTC()
+	if err != nil {
+		j.status, j.err = jobFailed, err.Error()
+	} else {
+		j.status, j.resp = jobDone, resp
+	}
+	return callbackPayload{JobID: j.id, Status: j.status, CohortID: j.cohortID, Version: j.resp.Version, FinishedAt: j.finishedAt, Error: j.err, ResultURL: "/rank/jobs/" + j.id}
+}
+
+func (s *Server) rankJob(ctx context.Context, tenantID string, req rankRequest) (rankResponse, error) {
+	results, err := s.rankItems(ctx, req.Items, req.rankOptions)
+	if err != nil {
+		return rankResponse{}, err
+	}
+	resp := toResponse(req.CohortID, results, req.rankOptions)
+	resp.DuplicatesDropped = req.dropped
+	if req.CohortID != "" {
+		v, err := s.storeRanking(ctx, tenantID, req.CohortID, req.Items, req.rankOptions, results, 0)
+		if err != nil {
+			return rankResponse{}, fmt.Errorf("store: %w", err)
+		}
+		resp.Version = v
+	}
+	return resp, nil
+}
+
+// getJobHandler reports a job's status, with the /rank response once it
+// is done. Jobs are visible only to the tenant that created them.
+func (s *Server) getJobHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	j := s.jobs.get(r.PathValue("id"))
+	if j == nil || j.tenantID != t.ID {
+		writeProblem(w, r, http.StatusNotFound, codeJobNotFound, "job not found")
+		return
+	}
+	writeJSON(w, withCase(j.response(), j.opts.FieldCase))
+}
+
+// Shutdown waits for queued and running jobs, callbacks included, and then
+// flushes the tracer. Call it after the HTTP server has stopped accepting
+// requests; it returns ctx's error if ctx ends first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.jobs.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for jobs: %w", ctx.Err())
+	}
+	return s.Tracer.Shutdown(ctx)
+}
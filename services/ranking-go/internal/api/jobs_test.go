@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ranking-go/internal/store"
+)
+
+// waitJob polls a job until it finishes.
+func waitJob(t *testing.T, url string, header map[string]string) jobResponse {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp := do(t, "GET", url, "", header)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET job: status %d", resp.StatusCode)
+		}
+		got := decode[jobResponse](t, resp)
+		if got.Status == jobDone || got.Status == jobFailed {
+			return got
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s", got.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRankJob(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank/jobs", `{"cohort_id":"c1","items":[{"user_id":"a","percent":40},{"user_id":"b","percent":80}]}`, nil)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	created := decode[jobResponse](t, resp)
+	if created.JobID == "" || resp.Header.Get("Location") != "/rank/jobs/"+created.JobID {
+		t.Fatalf("got %+v, Location %q", created, resp.Header.Get("Location"))
+	}
+
+	got := waitJob(t, ts.URL+"/rank/jobs/"+created.JobID, nil)
+	if got.Status != jobDone || got.FinishedAt == nil || got.CohortID != "c1" {
+		t.Fatalf("got %+v", got)
+	}
+	result := got.Result.(map[string]any)
+	if result["version"] != float64(1) || len(result["results"].([]any)) != 2 {
+		t.Errorf("result %+v", result)
+	}
+	stored := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/c1", "", nil))
+	if len(stored.Results) != 2 || stored.Results[0].UserID != "b" {
+		t.Errorf("stored %+v", stored.Results)
+	}
+
+	// Other tenants can't see the job.
+	if resp := do(t, "GET", ts.URL+"/rank/jobs/"+created.JobID, "", map[string]string{"X-Tenant": "other"}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("other tenant: status %d, want 404", resp.StatusCode)
+	}
+	if resp := do(t, "GET", ts.URL+"/rank/jobs/nope", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown job: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestRankJobRejectsBadRequests(t *testing.T) {
+	ts := newTestServer(t, nil)
+	for name, body := range map[string]string{
+		"json":    `{"items":`,
+		"options": `{"items":[],"trim_percent":-1}`,
+		"export":  `{"items":[],"export":{"target":"local"}}`,
+	} {
+		if resp := do(t, "POST", ts.URL+"/rank/jobs", body, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", name, resp.StatusCode)
+		}
+	}
+}
+
+func TestJobTableLimitsPending(t *testing.T) {
+	var jt jobTable
+	for i := 0; i < maxPendingJobs; i++ {
+		if !jt.add(&job{id: newJobID()}, 1) {
+			t.Fatalf("job %d rejected", i)
+		}
+	}
+	if jt.add(&job{id: newJobID()}, 1) {
+		t.Error("expected the queue to be full")
+	}
+	jt.done()
+	if !jt.add(&job{id: newJobID()}, 1) {
+		t.Error("expected room after a job finished")
+	}
+}
+
+func TestShutdownWaitsForJobs(t *testing.T) {
+	release := make(chan struct{})
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hook.Close()
+
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Webhook = Webhook{Secret: "k", Allow: loopback}
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("no jobs: %v", err)
+	}
+	resp := do(t, "POST", ts.URL+"/rank/jobs", `{"callback_url":"`+hook.URL+`","items":[{"user_id":"a","percent":1}]}`, nil)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+
+	// The callback is stuck, so the job is not finished yet.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+	close(release)
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Errorf("after release: %v", err)
+	}
+}
+
+func TestDisableJobs(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	srv.DisableJobs, srv.DisableMetrics = true, true
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	if resp := do(t, "POST", ts.URL+"/rank/jobs", `{"items":[]}`, nil); resp.StatusCode == http.StatusAccepted {
+		t.Error("jobs still enabled")
+	}
+	if resp := do(t, "GET", ts.URL+"/metrics", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("metrics: status %d, want 404", resp.StatusCode)
+	}
+}
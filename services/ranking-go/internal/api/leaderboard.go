@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultLeaderboardLimit = 100
+	maxLeaderboardLimit     = 1000
+)
+
+type leaderboardResponse struct {
+	CohortID   string       `json:"cohort_id"`
+	Version    int64        `json:"version"`
+	CohortSize int          `json:"cohort_size"`
+	Results    []rankResult `json:"results"`
+	// NextCursor fetches the following page; absent on the last one.
+	NextCursor         string `json:"next_cursor,omitempty"`
+	PercentileEncoding string `json:"percentile_encoding,omitempty"`
+	PercentileDivisor  int    `json:"percentile_divisor,omitempty"`
+}
+
+// errStaleCursor means the cohort was re-ranked after the cursor was
+// issued, so its position no longer means the same thing.
+var errStaleCursor = errors.New("cursor is for an older version of the ranking; start again without a cursor")
+
+// A leaderboard cursor pins the ranking version and the offset of the
+// next row. Rankings are immutable per version, so pages of one version
+// never overlap or skip.
+func encodeCursor(version int64, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", version, offset)))
+}
+
+func decodeCursor(c string, version int64, size int) (int, error) {
+	v, off, err := parseCursor(c)
+	if err != nil {
+		return 0, err
+	}
+	if v != version {
+		return 0, errStaleCursor
+	}
+	if off < 0 || off > size {
+		return 0, errors.New("invalid cursor")
+	}
+	return off, nil
+}
+
+// parseCursor is decodeCursor without the checks against the ranking.
+func parseCursor(c string) (version int64, offset int, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return 0, 0, errors.New("invalid cursor")
+	}
+	if _, err := fmt.Sscanf(string(b), "%d:%d", &version, &offset); err != nil {
+		return 0, 0, errors.New("invalid cursor")
+	}
+	return version, offset, nil
+}
+
+// leaderboardHandler pages through a stored ranking, best first, reading
+// only the page where the store can (see readPage). As CSV, the next page
+// is linked from a Link header instead.
+func (s *Server) leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	limit := defaultLeaderboardLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, r, errLeaderboardLimit)
+			return
+		}
+		limit = n
+	}
+	p, out, err := s.leaderboardPage(r.Context(), t.ID, r.PathValue("cohort_id"), limit, r.URL.Query().Get("cursor"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if s.notModifiedPage(w, r, p) {
+		return
+	}
+	if responseFormat(r) == "csv" {
+		if out.NextCursor != "" {
+			q := r.URL.Query()
+			q.Set("cursor", out.NextCursor)
+			w.Header().Set("Link", "<"+r.URL.Path+"?"+q.Encode()+`>; rel="next"`)
+		}
+		writeRankingCSV(w, out.Results)
+		return
+	}
+	writeJSON(w, withCase(out, s.Defaults.FieldCase))
+}
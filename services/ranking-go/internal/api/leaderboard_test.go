@@ -0,0 +1,65 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLeaderboardPages(t *testing.T) {
+	ts := newTestServer(t, nil)
+	var items []string
+	for i := 0; i < 25; i++ {
+		items = append(items, fmt.Sprintf(`{"user_id":"u%02d","percent":%d}`, i, i))
+	}
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[`+strings.Join(items, ",")+`]}`, nil)
+
+	var seen []rankResult
+	cursor, pages := "", 0
+	for {
+		u := ts.URL + "/leaderboard/c1?limit=10"
+		if cursor != "" {
+			u += "&cursor=" + url.QueryEscape(cursor)
+		}
+		resp := do(t, "GET", u, "", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("page %d: status %d", pages, resp.StatusCode)
+		}
+		page := decode[leaderboardResponse](t, resp)
+		if page.CohortSize != 25 || page.Version != 1 {
+			t.Errorf("page %d: size %d version %d", pages, page.CohortSize, page.Version)
+		}
+		seen = append(seen, page.Results...)
+		pages++
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if pages != 3 || len(seen) != 25 {
+		t.Fatalf("%d pages, %d rows; want 3, 25", pages, len(seen))
+	}
+	for i, r := range seen {
+		if r.Rank != i+1 || r.UserID != fmt.Sprintf("u%02d", 24-i) {
+			t.Errorf("row %d: %s rank %d", i, r.UserID, r.Rank)
+		}
+	}
+
+	// Re-ranking invalidates cursors of the old version.
+	first := decode[leaderboardResponse](t, do(t, "GET", ts.URL+"/leaderboard/c1?limit=10", "", nil))
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":1}]}`, nil)
+	if resp := do(t, "GET", ts.URL+"/leaderboard/c1?cursor="+first.NextCursor, "", nil); resp.StatusCode != http.StatusGone {
+		t.Errorf("stale cursor: status %d, want 410", resp.StatusCode)
+	}
+
+	for _, q := range []string{"limit=0", "limit=1001", "limit=x", "cursor=garbage!"} {
+		if resp := do(t, "GET", ts.URL+"/leaderboard/c1?"+q, "", nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, resp.StatusCode)
+		}
+	}
+	if resp := do(t, "GET", ts.URL+"/leaderboard/nope", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown cohort: status %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"ranking-go/internal/store"
+	"ranking-go/internal/websocket"
+)
+
+const (
+	defaultLiveTop      = 10
+	maxLiveTop          = 100
+	defaultLiveInterval = time.Second
+	minLiveInterval     = 250 * time.Millisecond
+)
+
+// liveBoards shares one copy of each watched cohort among its live
+// leaderboards, so an update is read from the store once per replica
+// rather than once per connection.
+type liveBoards struct {
+	mu     sync.Mutex
+	boards map[streamKey]*liveBoard
+}
+
+type liveBoard struct {
+	viewers int
+	// mu serializes fetches, so viewers woken by the same update wait for
+	// one read instead of each making their own.
+	mu      sync.Mutex
+	ranking *store.Ranking
+}
+
+// join returns key's board, counting a viewer until leave.
+func (l *liveBoards) join(key streamKey) *liveBoard {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.boards == nil {
+		l.boards = map[streamKey]*liveBoard{}
+	}
+	b := l.boards[key]
+	if b == nil {
+		b = &liveBoard{}
+		l.boards[key] = b
+	}
+	b.viewers++
+	return b
+}
+
+// leave drops the board with its last viewer.
+func (l *liveBoards) leave(key streamKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b := l.boards[key]; b != nil {
+		if b.viewers--; b.viewers == 0 {
+			delete(l.boards, key)
+		}
+	}
+}
+
+// get returns the cohort at version or later, reading the store only if
+// no viewer has yet.
+func (b *liveBoard) get(ctx context.Context, st store.Store, key streamKey, version int64) (*store.Ranking, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ranking != nil && b.ranking.Version >= version {
+		return b.ranking, nil
+	}
+	stored, err := st.Get(ctx, key.tenant, key.cohort)
+	if err != nil {
+		return nil, err
+	}
+	b.ranking = &stored
+	return b.ranking, nil
+}
+
+// liveMessage is one live leaderboard update.
+type liveMessage struct {
+	CohortID   string       `json:"cohort_id"`
+	Version    int64        `json:"version"`
+	CohortSize int          `json:"cohort_size"`
+	Top        []rankResult `json:"top"`
+	// Me is the watching user's row: null without user_id, or while they
+	// are not in the cohort.
+	Me                 *rankResult `json:"me"`
+	PercentileEncoding string      `json:"percentile_encoding,omitempty"`
+	PercentileDivisor  int         `json:"percentile_divisor,omitempty"`
+}
+
+func (s *Server) liveMessage(stored *store.Ranking, top int, userID string) liveMessage {
+	rows := s.rowsOf(stored.CohortID, stored.Options.Quantile, stored.Results[:min(top, len(stored.Results))])
+	msg := liveMessage{
+		CohortID:           stored.CohortID,
+		Version:            stored.Version,
+		CohortSize:         len(stored.Results),
+		Top:                rows.Results,
+		PercentileEncoding: rows.PercentileEncoding,
+		PercentileDivisor:  rows.PercentileDivisor,
+	}
+	if i := userIndex(stored.Results, userID); userID != "" && i >= 0 {
+		me := s.rowsOf(stored.CohortID, stored.Options.Quantile, stored.Results[i:i+1]).Results[0]
+		msg.Me = &me
+	}
+	return msg
+}
+
+// liveHandler is GET /leaderboard/{cohort_id}/live, a WebSocket that
+// sends the cohort's top ranks, and the rank of ?user_id=, on connecting
+// and again whenever either changes. Updates arrive through the stream
+// hub (see streamHandler); each connection sends at most one message per
+// ?interval_ms=, coalescing the updates in between, so a burst of score
+// submissions costs every viewer one message. Messages from the client
+// are read and ignored.
+func (s *Server) liveHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	q := r.URL.Query()
+	top := defaultLiveTop
+	if v := q.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLiveTop {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("top must be an integer in [1, %d]", maxLiveTop))
+			return
+		}
+		top = n
+	}
+	interval := defaultLiveInterval
+	if v := q.Get("interval_ms"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || time.Duration(n)*time.Millisecond < minLiveInterval {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("interval_ms must be an integer >= %d", minLiveInterval.Milliseconds()))
+			return
+		}
+		interval = time.Duration(n) * time.Millisecond
+	}
+	userID := q.Get("user_id")
+
+	key := streamKey{t.ID, r.PathValue("cohort_id")}
+	events, cancel := s.streams.subscribe(key)
+	defer cancel()
+	board := s.live.join(key)
+	defer s.live.leave(key)
+	stored, err := board.get(r.Context(), s.Store, key, 0)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	c, err := websocket.Upgrade(w, r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	var last []byte
+	send := func(stored *store.Ranking) error {
+		data, _ := json.Marshal(withCase(s.liveMessage(stored, top, userID), s.Defaults.FieldCase))
+		if bytes.Equal(data, last) {
+			return nil
+		}
+		last = data
+		return c.WriteText(data)
+	}
+	if send(stored) != nil {
+		c.Close(websocket.CloseGoingAway, "")
+		return
+	}
+
+	want, sent := stored.Version, time.Now()
+	var throttle <-chan time.Time
+	ping := time.NewTicker(streamKeepalive)
+	defer ping.Stop()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				// Shutting down, or too far behind to catch up.
+				c.Close(websocket.CloseGoingAway, "reconnect")
+				return
+			}
+			if ev.id <= want {
+				continue
+			}
+			want = ev.id
+			if throttle == nil {
+				throttle = time.After(time.Until(sent.Add(interval)))
+			}
+		case <-throttle:
+			throttle = nil
+			stored, err := board.get(r.Context(), s.Store, key, want)
+			if err != nil {
+				c.Close(websocket.CloseTryAgainLater, "cohort unavailable")
+				return
+			}
+			sent = time.Now()
+			if send(stored) != nil {
+				c.Close(websocket.CloseGoingAway, "")
+				return
+			}
+		case <-ping.C:
+			if c.Ping() != nil {
+				c.Close(websocket.CloseGoingAway, "")
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ranking-go/internal/store"
+	"ranking-go/internal/websocket"
+)
+
+func readLive(t *testing.T, c *websocket.Conn) liveMessage {
+	t.Helper()
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg liveMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestLiveLeaderboard(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":70},{"user_id":"d","percent":60}]}`, nil)
+
+	for _, q := range []string{"top=0", "top=101", "interval_ms=100"} {
+		if resp := do(t, "GET", ts.URL+"/leaderboard/c1/live?"+q, "", nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, resp.StatusCode)
+		}
+	}
+	if resp := do(t, "GET", ts.URL+"/leaderboard/missing/live", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing cohort: status %d, want 404", resp.StatusCode)
+	}
+	if resp := do(t, "GET", ts.URL+"/leaderboard/c1/live", "", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("plain GET: status %d, want 400", resp.StatusCode)
+	}
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/leaderboard/c1/live?top=2&user_id=d&interval_ms=250"
+	c, _, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(websocket.CloseNormal, "")
+	msg := readLive(t, c)
+	if msg.Version != 1 || msg.CohortSize != 4 || len(msg.Top) != 2 || msg.Top[0].UserID != "a" || msg.Me == nil || msg.Me.Rank != 4 {
+		t.Fatalf("first message %+v", msg)
+	}
+
+	// A burst of updates within one interval arrives as one message with
+	// the latest state.
+	start := time.Now()
+	do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"d","percent":75}`, nil)
+	do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"d","percent":85}`, nil)
+	msg = readLive(t, c)
+	if msg.Version < 2 || msg.Me.Rank > 3 {
+		t.Fatalf("after updates %+v", msg)
+	}
+	if msg.Version == 2 {
+		msg = readLive(t, c)
+	}
+	if msg.Version != 3 || msg.Me.Rank != 2 || msg.Top[1].UserID != "d" {
+		t.Errorf("after updates %+v", msg)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("update sent after %v, inside the interval", elapsed)
+	}
+
+	// A score that moves nobody sends nothing; the next message is the
+	// one that changes what this viewer sees.
+	do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"c","percent":50}`, nil)
+	do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"c","percent":95}`, nil)
+	msg = readLive(t, c)
+	if msg.Version != 5 || msg.Top[0].UserID != "c" || msg.Me.Rank != 3 {
+		t.Errorf("after c moves %+v", msg)
+	}
+
+	srv.CloseStreams()
+	if _, _, err := c.ReadMessage(); !errors.Is(err, websocket.ErrClosed) {
+		t.Errorf("after CloseStreams: %v", err)
+	}
+}
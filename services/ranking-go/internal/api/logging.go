@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"ranking-go/internal/tracing"
+)
+
+// maxRequestIDLen bounds an incoming X-Request-ID we are willing to echo
+// into logs and responses.
+const maxRequestIDLen = 128
+
+type requestInfoKey struct{}
+
+// requestInfo collects what handlers learn about a request (its cohort and
+// item count) for the access log line.
+type requestInfo struct {
+	id string
+
+	mu       sync.Mutex
+	cohortID string
+	items    int
+}
+
+// logRequest records a cohort and adds n to the item count of r's access
+// log line; a no-op outside logged.
+func logRequest(r *http.Request, cohortID string, n int) {
+	info, _ := r.Context().Value(requestInfoKey{}).(*requestInfo)
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	if cohortID != "" {
+		info.cohortID = cohortID
+	}
+	info.items += n
+}
+
+// requestID returns the ID logged for the request ctx belongs to.
+func requestID(ctx context.Context) string {
+	if info, _ := ctx.Value(requestInfoKey{}).(*requestInfo); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+// logged writes one access log line per request. It keeps the caller's
+// X-Request-ID, or makes one, and returns it on the response so ranking
+// calls can be matched with the backend's logs.
+func (s *Server) logged(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > maxRequestIDLen || !printable(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		info := &requestInfo{id: id}
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		h(rec, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+
+		cohortID := r.PathValue("cohort_id")
+		info.mu.Lock()
+		if info.cohortID != "" {
+			cohortID = info.cohortID
+		}
+		items := info.items
+		info.mu.Unlock()
+
+		attrs := []slog.Attr{
+			slog.String("request_id", id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", rec.code),
+			slog.Float64("duration_ms", ms(time.Since(start))),
+		}
+		if cohortID != "" {
+			attrs = append(attrs, slog.String("cohort_id", cohortID))
+		}
+		if items > 0 {
+			attrs = append(attrs, slog.Int("items", items))
+		}
+		if sc := tracing.SpanContextFrom(r.Context()); sc.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", sc.TraceID.String()))
+		}
+		level := slog.LevelInfo
+		if rec.code >= 500 {
+			level = slog.LevelError
+		}
+		s.logger().LogAttrs(r.Context(), level, "request", attrs...)
+	}
+}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// printable reports whether id is visible ASCII, so a client can't inject
+// control characters into logs or headers.
+func printable(id string) bool {
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"ranking-go/internal/store"
+)
+
+// syncBuffer lets the handler goroutine and the test share a log buffer.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) lines(t *testing.T) []map[string]any {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(s.b.Bytes()), []byte("\n")) {
+		var m map[string]any
+		if err := json.Unmarshal(line, &m); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf syncBuffer
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp := do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":40},{"user_id":"b","percent":80}]}`,
+		map[string]string{"X-Request-ID": "req-123"})
+	if resp.Header.Get("X-Request-ID") != "req-123" {
+		t.Errorf("X-Request-ID %q, want the caller's", resp.Header.Get("X-Request-ID"))
+	}
+	resp = do(t, "GET", ts.URL+"/rank/c1", "", map[string]string{"X-Request-ID": "bad\tid"})
+	generated := resp.Header.Get("X-Request-ID")
+	if generated == "" || generated == "bad\tid" {
+		t.Errorf("X-Request-ID %q, want a generated one", generated)
+	}
+
+	lines := buf.lines(t)
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines", len(lines))
+	}
+	post, get := lines[0], lines[1]
+	for k, want := range map[string]any{"request_id": "req-123", "method": "POST", "path": "/rank", "route": "POST /rank", "status": float64(200), "cohort_id": "c1", "items": float64(2)} {
+		if post[k] != want {
+			t.Errorf("POST %s = %v, want %v", k, post[k], want)
+		}
+	}
+	if _, ok := post["duration_ms"].(float64); !ok {
+		t.Errorf("POST duration_ms = %v", post["duration_ms"])
+	}
+	if get["request_id"] != generated || get["cohort_id"] != "c1" || get["route"] != "GET /rank/{cohort_id}" {
+		t.Errorf("GET %v", get)
+	}
+	if _, ok := get["items"]; ok {
+		t.Errorf("GET logged items: %v", get)
+	}
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"ranking-go/internal/equate"
+	"ranking-go/internal/rank"
+)
+
+// maxMergedCohorts bounds the cohorts of one POST /rank/merged.
+const maxMergedCohorts = 100
+
+type mergedRequest struct {
+	// CohortID labels the merged ranking; it is not stored.
+	CohortID string         `json:"cohort_id,omitempty"`
+	Cohorts  []cohortSource `json:"cohorts"`
+	// Equate maps every other cohort onto Reference's distribution
+	// before merging.
+	Equate *mergedEquate `json:"equate,omitempty"`
+	rankOptions
+}
+
+type mergedEquate struct {
+	Method    string `json:"method"`
+	Reference string `json:"reference"`
+}
+
+type mergedResponse struct {
+	rankResponse
+	Cohorts []mergedCohort `json:"cohorts"`
+	Results []mergedResult `json:"results"`
+}
+
+type mergedCohort struct {
+	CohortID   string `json:"cohort_id"`
+	CohortSize int    `json:"cohort_size"`
+}
+
+// mergedResult is a merged row with the user's standing in their own
+// cohort.
+type mergedResult struct {
+	rankResult
+	CohortID         string   `json:"cohort_id"`
+	CohortRank       int      `json:"cohort_rank"`
+	CohortPercentile *float64 `json:"cohort_percentile"`
+	// EquatedPercent is the percent the merged ranking used, when
+	// equating.
+	EquatedPercent *float64 `json:"equated_percent,omitempty"`
+}
+
+func (req mergedRequest) validate(s *Server) error {
+	ve := &validationError{}
+	switch {
+	case len(req.Cohorts) < 2:
+		ve.add("cohorts", codeInvalidRequest, "at least two cohorts are required, got %d", len(req.Cohorts))
+	case len(req.Cohorts) > maxMergedCohorts:
+		ve.add("cohorts", codeInvalidRequest, "at most %d cohorts, got %d", maxMergedCohorts, len(req.Cohorts))
+	}
+	ids := make(map[string]bool, len(req.Cohorts))
+	for i, c := range req.Cohorts {
+		field := fmt.Sprintf("cohorts[%d]", i)
+		switch {
+		case c.CohortID == "":
+			ve.add(field+".cohort_id", codeMissingField, "is required")
+		case ids[c.CohortID]:
+			ve.add(field+".cohort_id", codeInvalidRequest, "duplicate cohort %q", c.CohortID)
+		}
+		ids[c.CohortID] = true
+		s.checkItems(ve, field+".items", c.Items)
+		checkNoSubjects(ve, field+".items", c.Items)
+	}
+	if e := req.Equate; e != nil {
+		switch equate.Method(e.Method) {
+		case equate.MethodLinear, equate.MethodEquipercentile:
+		default:
+			ve.add("equate.method", codeInvalidRequest, "must be linear or equipercentile, got %q", e.Method)
+		}
+		if !ids[e.Reference] {
+			ve.add("equate.reference", codeInvalidRequest, "must be one of the cohorts, got %q", e.Reference)
+		}
+	}
+	return ve.orNil()
+}
+
+// mergedHandler ranks several cohorts as one, e.g. colleges in a
+// national mock, reporting each user's merged standing alongside their
+// rank within their own cohort. Both rankings use the request's options.
+// Nothing is stored.
+func (s *Server) mergedHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	req := mergedRequest{rankOptions: s.defaultsFor(t)}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, "json", err)
+		return
+	}
+	if err := req.validate(s); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if err := req.rankOptions.validate(); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidOptions, err.Error())
+		return
+	}
+
+	cohorts := make([][]rank.Item, len(req.Cohorts))
+	err := runParallel(len(req.Cohorts), s.rankWorkers(), func(i int) (err error) {
+		cohorts[i], err = s.sourceItems(r.Context(), t.ID, req.Cohorts[i])
+		return err
+	})
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	total := 0
+	for _, items := range cohorts {
+		total += len(items)
+	}
+	logRequest(r, req.CohortID, total)
+	if limit, tooMany := s.itemLimit(t); limit > 0 && total > limit {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codeTooManyItems, tooMany.Error())
+		return
+	}
+
+	// Each user belongs to one cohort; their own-cohort rows are kept by
+	// user_id for the merged rows.
+	type standing struct {
+		cohort  string
+		result  rank.Result
+		equated *float64
+	}
+	standings := make(map[string]*standing, total)
+	ve := &validationError{}
+	for i, items := range cohorts {
+		for _, it := range items {
+			if prev, dup := standings[it.UserID]; dup {
+				ve.add(fmt.Sprintf("cohorts[%d]", i), codeDuplicateUserID, "user %q is also in cohort %q", it.UserID, prev.cohort)
+				continue
+			}
+			standings[it.UserID] = &standing{cohort: req.Cohorts[i].CohortID}
+		}
+	}
+	if err := ve.orNil(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	// The cohorts are independent, so they rank in parallel.
+	ranked := make([][]rank.Result, len(cohorts))
+	err = runParallel(len(cohorts), s.rankWorkers(), func(i int) (err error) {
+		if ranked[i], err = s.rankCohort(r.Context(), cohorts[i], req.rankOptions); err != nil {
+			return fmt.Errorf("cohort %q: %w", req.Cohorts[i].CohortID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidOptions, err.Error())
+		return
+	}
+
+	var reference []float64
+	if req.Equate != nil {
+		reference = percents(cohorts[cohortIndex(req.Cohorts, req.Equate.Reference)])
+	}
+	base := req.rankOptions.rankBase()
+	merged := make([]rank.Item, 0, total)
+	out := mergedResponse{Cohorts: make([]mergedCohort, len(req.Cohorts))}
+	for i, items := range cohorts {
+		id := req.Cohorts[i].CohortID
+		out.Cohorts[i] = mergedCohort{CohortID: id, CohortSize: len(items)}
+		for _, res := range ranked[i] {
+			standings[res.UserID].result = res
+		}
+
+		if req.Equate == nil || id == req.Equate.Reference {
+			merged = append(merged, items...)
+			continue
+		}
+		eq, err := equate.Fit(equate.Method(req.Equate.Method), percents(items), reference)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("equate cohort %q: %v", id, err))
+			return
+		}
+		for _, it := range items {
+			y := math.Max(s.Limits.MinPercent, math.Min(s.Limits.MaxPercent, eq.Equate(it.Percent)))
+			standings[it.UserID].equated = &y
+			it.Percent = y
+			merged = append(merged, it)
+		}
+	}
+
+	results, err := s.rankCohort(r.Context(), merged, req.rankOptions)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidOptions, err.Error())
+		return
+	}
+	out.rankResponse = toResponse(req.CohortID, results, req.rankOptions)
+	out.Results = make([]mergedResult, len(results))
+	for i, row := range out.rankResponse.Results {
+		st := standings[row.UserID]
+		m := mergedResult{rankResult: row, CohortID: st.cohort, CohortRank: rebase(st.result.Rank, base), EquatedPercent: st.equated}
+		if !st.result.PercentileNull {
+			p := req.rankOptions.formatPercentile(st.result.Percentile)
+			m.CohortPercentile = &p
+		}
+		out.Results[i] = m
+	}
+	writeJSON(w, withCase(out, req.FieldCase))
+}
+
+// cohortIndex returns the index of the cohort with the given ID.
+func cohortIndex(cohorts []cohortSource, id string) int {
+	for i, c := range cohorts {
+		if c.CohortID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMerged(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"college-a","items":[{"user_id":"a1","percent":90},{"user_id":"a2","percent":70}]}`, nil).Body.Close()
+	college := `{"cohort_id":"college-b","items":[{"user_id":"b1","percent":80},{"user_id":"b2","percent":60},{"user_id":"b3","percent":40}]}`
+
+	resp := do(t, "POST", ts.URL+"/rank/merged", `{"cohort_id":"national","cohorts":[{"cohort_id":"college-a"},`+college+`]}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[mergedResponse](t, resp)
+	want := []struct {
+		user, cohort     string
+		rank, cohortRank int
+	}{{"a1", "college-a", 1, 1}, {"b1", "college-b", 2, 1}, {"a2", "college-a", 3, 2}, {"b2", "college-b", 4, 2}, {"b3", "college-b", 5, 3}}
+	if len(got.Results) != len(want) {
+		t.Fatalf("results %+v", got.Results)
+	}
+	for i, w := range want {
+		r := got.Results[i]
+		if r.UserID != w.user || r.CohortID != w.cohort || r.Rank != w.rank || r.CohortRank != w.cohortRank || r.CohortPercentile == nil || r.EquatedPercent != nil {
+			t.Errorf("row %d: %+v, want %+v", i, r, w)
+		}
+	}
+	if got.CohortID != "national" || len(got.Cohorts) != 2 || got.Cohorts[1].CohortSize != 3 {
+		t.Errorf("response %+v", got)
+	}
+
+	// Equated onto college-a, college-b's 40..80 spread becomes 70..90:
+	// b1 ties a1 and b3 ties a2, ordered by input.
+	got = decode[mergedResponse](t, do(t, "POST", ts.URL+"/rank/merged", `{"cohorts":[{"cohort_id":"college-a"},`+college+`],"equate":{"method":"equipercentile","reference":"college-a"}}`, nil))
+	equated := map[string]float64{"b1": 90, "b2": 80, "b3": 70}
+	for i, user := range []string{"a1", "b1", "b2", "a2", "b3"} {
+		r := got.Results[i]
+		w, ok := equated[user]
+		if r.UserID != user || (r.EquatedPercent != nil) != ok || (ok && *r.EquatedPercent != w) {
+			t.Errorf("equated row %d: %+v, want %s", i, r, user)
+		}
+	}
+
+	for _, c := range []struct {
+		body   string
+		status int
+		field  string
+	}{
+		{`{"cohorts":[` + college + `]}`, http.StatusBadRequest, "cohorts"},
+		{`{"cohorts":[` + college + `,` + college + `]}`, http.StatusBadRequest, "cohorts[1].cohort_id"},
+		{`{"cohorts":[{"items":[{"user_id":"x","percent":1}]},` + college + `]}`, http.StatusBadRequest, "cohorts[0].cohort_id"},
+		{`{"cohorts":[{"cohort_id":"x","items":[{"user_id":"b1","percent":1}]},` + college + `]}`, http.StatusBadRequest, "cohorts[1]"},
+		{`{"cohorts":[{"cohort_id":"college-a"},` + college + `],"equate":{"method":"linear","reference":"nope"}}`, http.StatusBadRequest, "equate.reference"},
+		{`{"cohorts":[{"cohort_id":"nope"},` + college + `]}`, http.StatusNotFound, ""},
+	} {
+		resp := do(t, "POST", ts.URL+"/rank/merged", c.body, nil)
+		p := decode[problem](t, resp)
+		if resp.StatusCode != c.status || (c.field != "" && (len(p.Fields) != 1 || p.Fields[0].Field != c.field)) {
+			t.Errorf("%s: status %d, %+v; want %d %s", c.body, resp.StatusCode, p.Fields, c.status, c.field)
+		}
+	}
+}
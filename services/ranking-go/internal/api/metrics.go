@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"ranking-go/internal/metrics"
+)
+
+var (
+	durationBuckets   = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+	cohortSizeBuckets = []float64{10, 100, 1000, 10_000, 50_000, 100_000, 250_000, 500_000, 1_000_000, 2_000_000}
+)
+
+// serverMetrics are the series served on GET /metrics.
+type serverMetrics struct {
+	registry        *metrics.Registry
+	requests        *metrics.Counter
+	requestDuration *metrics.Histogram
+	cohortSize      *metrics.Histogram
+	rankDuration    *metrics.Histogram
+	cacheRequests   *metrics.Counter
+}
+
+func newServerMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	return &serverMetrics{
+		registry:        r,
+		requests:        r.NewCounter("ranking_http_requests_total", "HTTP requests by route and status code.", "route", "code"),
+		requestDuration: r.NewHistogram("ranking_http_request_duration_seconds", "HTTP request latency by route.", durationBuckets, "route"),
+		cohortSize:      r.NewHistogram("ranking_cohort_size", "Items per ranked cohort.", cohortSizeBuckets),
+		rankDuration:    r.NewHistogram("ranking_rank_duration_seconds", "Time spent ranking one cohort, excluding I/O.", durationBuckets),
+		cacheRequests:   r.NewCounter("ranking_response_cache_requests_total", "Response cache lookups by route and result: hit_local, hit_shared, miss or error.", "route", "result"),
+	}
+}
+
+func (m *serverMetrics) observeRank(items int, d time.Duration) {
+	m.cohortSize.Observe(float64(items))
+	m.rankDuration.Observe(d.Seconds())
+}
+
+// instrument counts and times h under its route pattern, so paths with
+// IDs in them don't each become a series.
+func (m *serverMetrics) instrument(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		h(rec, r)
+		m.requests.Inc(route, strconv.Itoa(rec.code))
+		m.requestDuration.Observe(time.Since(start).Seconds(), route)
+	}
+}
+
+// statusRecorder captures the response code. Unwrap keeps
+// http.ResponseController (flushing, full duplex) working through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader {
+		rec.code, rec.wroteHeader = code, true
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":40},{"user_id":"b","percent":80}]}`, nil)
+	do(t, "GET", ts.URL+"/rank/c1", "", nil)
+	do(t, "GET", ts.URL+"/rank/nope", "", nil)
+
+	resp := do(t, "GET", ts.URL+"/metrics", "", nil)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	b, _ := io.ReadAll(resp.Body)
+	body := string(b)
+	for _, want := range []string{
+		`ranking_http_requests_total{route="POST /rank",code="200"} 1`,
+		`ranking_http_requests_total{route="GET /rank/{cohort_id}",code="200"} 1`,
+		`ranking_http_requests_total{route="GET /rank/{cohort_id}",code="404"} 1`,
+		`ranking_http_request_duration_seconds_count{route="POST /rank"} 1`,
+		`ranking_cohort_size_bucket{le="10"} 1`,
+		`ranking_cohort_size_sum 2`,
+		`ranking_rank_duration_seconds_count 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in\n%s", want, body)
+		}
+	}
+}
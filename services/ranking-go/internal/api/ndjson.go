@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// errTooManyItems is returned by decodeNDJSON when the item limit is
+// exceeded; decoding stops there. It is also the error for the tenant's
+// own limit (see itemLimit).
+var errTooManyItems = errors.New("too many items for tenant")
+
+// maxNDJSONLine bounds a single item line.
+const maxNDJSONLine = 1 << 20
+
+func isNDJSON(r *http.Request) bool {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mt == "application/x-ndjson"
+}
+
+// decodeNDJSON fills req from an application/x-ndjson /rank body: one item
+// per line, blank lines skipped. cohort_id, callback_url and options come
+// from the query (?cohort_id=...&options={...}) since the body holds only
+// items. Lines
+// are decoded one at a time, so memory grows with the items, not with the
+// raw body. maxItems > 0 stops at that many items.
+func decodeNDJSON(r *http.Request, req *rankRequest, maxItems int) error {
+	if err := decodeQuery(r, req); err != nil {
+		return err
+	}
+	sc := bufio.NewScanner(r.Body)
+	sc.Buffer(make([]byte, 0, 64<<10), maxNDJSONLine)
+	for line := 1; sc.Scan(); line++ {
+		b := sc.Bytes()
+		if len(b) == 0 || len(b) == 1 && b[0] == '\r' {
+			continue
+		}
+		var it rankItem
+		if err := json.Unmarshal(b, &it); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if maxItems > 0 && len(req.Items) == maxItems {
+			return errTooManyItems
+		}
+		req.Items = append(req.Items, it)
+	}
+	if err := sc.Err(); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// decodeQuery fills the request fields other than items from the query,
+// for bodies that hold only items.
+func decodeQuery(r *http.Request, req *rankRequest) error {
+	q := r.URL.Query()
+	req.CohortID = q.Get("cohort_id")
+	req.CallbackURL = q.Get("callback_url")
+	if o := q.Get("options"); o != "" {
+		if err := json.Unmarshal([]byte(o), &req.rankOptions); err != nil {
+			return fmt.Errorf("options: %w", err)
+		}
+	}
+	return nil
+}
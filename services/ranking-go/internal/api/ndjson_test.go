@@ -0,0 +1,65 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"ranking-go/internal/tenant"
+)
+
+func TestRankNDJSON(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ndjson := map[string]string{"Content-Type": "application/x-ndjson"}
+	q := url.Values{"cohort_id": {"c1"}, "options": {`{"precision":1}`}}
+
+	body := "{\"user_id\":\"a\",\"percent\":40}\n\n{\"user_id\":\"b\",\"percent\":80}\r\n{\"user_id\":\"c\",\"percent\":60}"
+	resp := do(t, "POST", ts.URL+"/rank?"+q.Encode(), body, ndjson)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[rankResponse](t, resp)
+
+	want := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank",
+		`{"cohort_id":"c2","precision":1,"items":[{"user_id":"a","percent":40},{"user_id":"b","percent":80},{"user_id":"c","percent":60}]}`, nil))
+	if got.CohortID != "c1" || len(got.Results) != len(want.Results) {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range want.Results {
+		g, w := got.Results[i], want.Results[i]
+		if g.UserID != w.UserID || g.Rank != w.Rank || *g.Percentile != *w.Percentile {
+			t.Errorf("row %d: got %+v, want %+v", i, g, w)
+		}
+	}
+	if resp := do(t, "GET", ts.URL+"/rank/c1", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("stored cohort: status %d", resp.StatusCode)
+	}
+}
+
+func TestRankNDJSONErrors(t *testing.T) {
+	ndjson := map[string]string{"Content-Type": "application/x-ndjson; charset=utf-8"}
+	ts := newTestServer(t, nil)
+
+	resp := do(t, "POST", ts.URL+"/rank", "{\"user_id\":\"a\",\"percent\":1}\n{\"user_id\":\"b\",\n", ndjson)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad line: status %d, want 400", resp.StatusCode)
+	}
+	if b, _ := io.ReadAll(resp.Body); !strings.Contains(string(b), "line 2") {
+		t.Errorf("bad line: body %q, want line number", b)
+	}
+	if resp := do(t, "POST", ts.URL+"/rank?options={", "", ndjson); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad options: status %d, want 400", resp.StatusCode)
+	}
+
+	reg, err := tenant.NewRegistry([]tenant.Tenant{{ID: tenant.Default, MaxItems: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited := newTestServer(t, reg)
+	resp = do(t, "POST", limited.URL+"/rank", "{\"user_id\":\"a\",\"percent\":1}\n{\"user_id\":\"b\",\"percent\":2}\n", ndjson)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want 413", resp.StatusCode)
+	}
+}
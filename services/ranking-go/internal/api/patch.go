@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ranking-go/internal/rank"
+	"ranking-go/internal/store"
+)
+
+// patchRequest updates a stored cohort: items are upserted by user_id and
+// remove drops users. The cohort is re-ranked with its stored options.
+type patchRequest struct {
+	Items  []rankItem `json:"items"`
+	Remove []string   `json:"remove"`
+	// ExpectedVersion may be sent instead of an If-Match header.
+	ExpectedVersion int64 `json:"expected_version"`
+}
+
+// patchRankHandler applies an update only if the caller saw the latest
+// version (If-Match or expected_version): 428 if neither is sent, 409 if the
+// cohort changed since.
+func (s *Server) patchRankHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	var req patchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, "json", err)
+		return
+	}
+	if err := s.validateItems("items", req.Items); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if err := rejectSubjects("items", req.Items); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	expected := req.ExpectedVersion
+	if h := r.Header.Get("If-Match"); h != "" {
+		v, err := strconv.ParseInt(strings.Trim(h, `"`), 10, 64)
+		if err != nil || v <= 0 {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "If-Match must be a ranking version")
+			return
+		}
+		expected = v
+	}
+	if expected <= 0 {
+		writeProblem(w, r, http.StatusPreconditionRequired, codeVersionRequired, "If-Match or expected_version is required")
+		return
+	}
+
+	cohortID := r.PathValue("cohort_id")
+	cur, err := s.Store.Get(r.Context(), t.ID, cohortID)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	if cur.Version != expected {
+		writeProblem(w, r, http.StatusConflict, codeVersionConflict, store.ErrVersionConflict.Error())
+		return
+	}
+
+	logRequest(r, "", len(req.Items))
+	items := mergeItems(cur.Items, toRankItems(req.Items), req.Remove)
+	if limit, tooMany := s.itemLimit(t); limit > 0 && len(items) > limit {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codeTooManyItems, tooMany.Error())
+		return
+	}
+	opts := cur.Options
+	opts.ExternalSort = s.ExternalSort
+	span := s.startRankSpan(r.Context(), len(items))
+	start := time.Now()
+	results, err := rank.Rank(items, opts)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidOptions, err.Error())
+		return
+	}
+	s.metrics.observeRank(len(items), time.Since(start))
+	// The conditional write catches updates that landed after our Get.
+	v, err := s.Store.Put(r.Context(), t.ID, store.Ranking{
+		CohortID: cohortID,
+		Items:    items,
+		Options:  cur.Options,
+		Results:  results,
+		RankedAt: time.Now().UTC(),
+	}, expected)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	s.publishRankChanges(t.ID, cohortID, v, cur.Results, results)
+
+	view := s.Defaults
+	view.Quantile = cur.Options.Quantile
+	resp := toResponse(cohortID, results, view)
+	resp.Version = v
+	resp.PercentileMethod = cur.Options.Method
+	resp.PreviousVersion = cur.Version
+	applyChanges(resp.Results, results, cur.Results, view)
+	writeRanking(w, r, resp, view)
+}
+
+// mergeItems returns cur with upserts applied by user_id and removed users
+// dropped; existing users keep their position.
+func mergeItems(cur, upserts []rank.Item, remove []string) []rank.Item {
+	drop := make(map[string]bool, len(remove))
+	for _, id := range remove {
+		drop[id] = true
+	}
+	pending := make(map[string]rank.Item, len(upserts))
+	for _, it := range upserts {
+		pending[it.UserID] = it
+	}
+	out := make([]rank.Item, 0, len(cur)+len(upserts))
+	for _, it := range cur {
+		if drop[it.UserID] {
+			continue
+		}
+		if up, ok := pending[it.UserID]; ok {
+			it = up
+			delete(pending, it.UserID)
+		}
+		out = append(out, it)
+	}
+	for _, it := range upserts {
+		if _, ok := pending[it.UserID]; ok && !drop[it.UserID] {
+			out = append(out, it)
+			delete(pending, it.UserID)
+		}
+	}
+	return out
+}
+
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeProblem(w, r, http.StatusNotFound, codeCohortNotFound, err.Error())
+	case errors.Is(err, store.ErrVersionConflict):
+		writeProblem(w, r, http.StatusConflict, codeVersionConflict, err.Error())
+	default:
+		writeProblem(w, r, http.StatusInternalServerError, codeStoreError, "store: "+err.Error())
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPatchWithCurrentVersion(t *testing.T) {
+	ts := newTestServer(t, nil)
+	created := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank",
+		`{"cohort_id":"live","items":[{"user_id":"a","percent":50},{"user_id":"b","percent":60},{"user_id":"c","percent":70}]}`, nil))
+	if created.Version != 1 {
+		t.Fatalf("created version %d, want 1", created.Version)
+	}
+
+	resp := do(t, "PATCH", ts.URL+"/rank/live", `{"items":[{"user_id":"a","percent":99},{"user_id":"d","percent":10}],"remove":["c"]}`,
+		map[string]string{"If-Match": `"1"`})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[rankResponse](t, resp)
+	if got.Version != 2 {
+		t.Errorf("version %d, want 2", got.Version)
+	}
+	want := []string{"a", "b", "d"}
+	if len(got.Results) != len(want) {
+		t.Fatalf("got %+v", got.Results)
+	}
+	for i, id := range want {
+		if got.Results[i].UserID != id || got.Results[i].Rank != i+1 {
+			t.Errorf("position %d: %+v, want %s", i, got.Results[i], id)
+		}
+	}
+
+	stored := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/live", "", nil))
+	if stored.Version != 2 || len(stored.Results) != 3 {
+		t.Errorf("stored: %+v", stored)
+	}
+
+	// expected_version in the body works too.
+	resp = do(t, "PATCH", ts.URL+"/rank/live", `{"remove":["d"],"expected_version":2}`, nil)
+	if resp.StatusCode != http.StatusOK || decode[rankResponse](t, resp).Version != 3 {
+		t.Errorf("body version: status %d", resp.StatusCode)
+	}
+}
+
+func TestPatchStaleVersionConflicts(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"live","items":[{"user_id":"a","percent":50}]}`, nil)
+	do(t, "PATCH", ts.URL+"/rank/live", `{"items":[{"user_id":"b","percent":60}]}`, map[string]string{"If-Match": "1"})
+
+	// A second writer still holding version 1 must not clobber version 2.
+	resp := do(t, "PATCH", ts.URL+"/rank/live", `{"items":[{"user_id":"c","percent":70}]}`, map[string]string{"If-Match": "1"})
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("stale version: status %d, want 409", resp.StatusCode)
+	}
+	got := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/live", "", nil))
+	if got.Version != 2 || len(got.Results) != 2 {
+		t.Errorf("stale write applied: %+v", got)
+	}
+}
+
+func TestPatchRequiresVersion(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"live","items":[{"user_id":"a","percent":50}]}`, nil)
+	if resp := do(t, "PATCH", ts.URL+"/rank/live", `{}`, nil); resp.StatusCode != http.StatusPreconditionRequired {
+		t.Errorf("no version: status %d, want 428", resp.StatusCode)
+	}
+	if resp := do(t, "PATCH", ts.URL+"/rank/missing", `{}`, map[string]string{"If-Match": "1"}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing cohort: status %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"ranking-go/internal/rank"
+)
+
+type percentileResponse struct {
+	CohortID   string `json:"cohort_id"`
+	Version    int64  `json:"version"`
+	CohortSize int    `json:"cohort_size"`
+	// Score is the hypothetical percent; Rank and Percentile are what it
+	// would earn joining the cohort.
+	Score              float64  `json:"score"`
+	Rank               int      `json:"rank"`
+	Percentile         *float64 `json:"percentile"`
+	Quantile           int      `json:"quantile,omitempty"`
+	QuantileLabel      string   `json:"quantile_label,omitempty"`
+	Badge              string   `json:"badge,omitempty"`
+	PercentileEncoding string   `json:"percentile_encoding,omitempty"`
+	PercentileDivisor  int      `json:"percentile_divisor,omitempty"`
+}
+
+// percentileHandler answers "what percentile would this score earn?" on a
+// stored cohort: the score joins the cohort as one more user, everyone
+// else unchanged, under the options the cohort was ranked with.
+func (s *Server) percentileHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	score, err := s.scoreParam(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	stored, err := s.Store.Get(r.Context(), t.ID, r.PathValue("cohort_id"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	opts := stored.Options
+	opts.ExternalSort = s.ExternalSort
+	placed, err := rank.Place(stored.Items, opts, score)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	row := s.rowsOf(stored.CohortID, stored.Options.Quantile, []rank.Result{placed})
+	writeJSON(w, withCase(percentileResponse{
+		CohortID:           stored.CohortID,
+		Version:            stored.Version,
+		CohortSize:         len(stored.Items),
+		Score:              score,
+		Rank:               row.Results[0].Rank,
+		Percentile:         row.Results[0].Percentile,
+		Quantile:           row.Results[0].Quantile,
+		QuantileLabel:      row.Results[0].QuantileLabel,
+		Badge:              row.Results[0].Badge,
+		PercentileEncoding: row.PercentileEncoding,
+		PercentileDivisor:  row.PercentileDivisor,
+	}, s.Defaults.FieldCase))
+}
+
+// scoreParam reads the required ?score= percent of a percentile query.
+func (s *Server) scoreParam(r *http.Request) (float64, error) {
+	ve := &validationError{}
+	v := r.URL.Query().Get("score")
+	score, err := strconv.ParseFloat(v, 64)
+	switch {
+	case v == "":
+		ve.add("score", codeMissingField, "is required")
+	case err != nil:
+		ve.add("score", codeInvalidNumber, "must be a number, got %q", v)
+	default:
+		s.checkPercent(ve, "score", score)
+	}
+	return score, ve.orNil()
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPercentileForScore(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[
+		{"user_id":"a","percent":92},{"user_id":"b","percent":85},{"user_id":"c","percent":80},{"user_id":"d","percent":71}
+	]}`, nil).Body.Close()
+
+	resp := do(t, "GET", ts.URL+"/rank/c1/percentile?score=85", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[percentileResponse](t, resp)
+	// 85 joins as the 5th user, wins the tie with b: rank 2 of 5.
+	if got.CohortSize != 4 || got.Score != 85 || got.Rank != 2 || got.Percentile == nil || *got.Percentile != 75 {
+		t.Errorf("got %+v", got)
+	}
+
+	for url, want := range map[string]string{
+		"/rank/c1/percentile":            codeMissingField,
+		"/rank/c1/percentile?score=high": codeInvalidNumber,
+		"/rank/c1/percentile?score=101":  codeInvalidPercent,
+		"/rank/none/percentile?score=50": codeCohortNotFound,
+		"/rank/c1/no-such-view?score=50": codeNotFound,
+	} {
+		if p := decode[problem](t, do(t, "GET", ts.URL+url, "", nil)); p.Code != want {
+			t.Errorf("%s: code %s, want %s", url, p.Code, want)
+		}
+	}
+
+	// Job lookups still win over cohort views.
+	if resp := do(t, "GET", ts.URL+"/rank/jobs/percentile", "", nil); decode[problem](t, resp).Code != codeJobNotFound {
+		t.Errorf("jobs route shadowed")
+	}
+}
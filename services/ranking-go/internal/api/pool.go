@@ -0,0 +1,90 @@
+package api
+
+import (
+	"runtime"
+	"sync"
+)
+
+// rankWorkers is how many cohorts one request ranks at once.
+func (s *Server) rankWorkers() int {
+	if s.RankWorkers > 0 {
+		return s.RankWorkers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// runParallel calls fn(0) to fn(n-1) on up to workers goroutines and
+// returns the error of the lowest i that failed, so which error a caller
+// sees does not depend on scheduling.
+func runParallel(n, workers int, fn func(i int) error) error {
+	errs := make([]error, n)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inOrder runs jobs as they are submitted, up to workers at once, and
+// emits each result in submission order as soon as it and those before it
+// are done: a streaming pipeline whose memory is bounded by workers jobs,
+// not by everything submitted. emit runs on one goroutine at a time.
+type inOrder[T any] struct {
+	workers int
+	emit    func(T)
+	slots   chan struct{}
+	queue   chan chan T
+	done    chan struct{}
+}
+
+// submit starts job, first waiting for a free worker.
+func (o *inOrder[T]) submit(job func() T) {
+	if o.queue == nil {
+		o.start()
+	}
+	o.slots <- struct{}{}
+	ch := make(chan T, 1)
+	o.queue <- ch
+	go func() { ch <- job() }()
+}
+
+func (o *inOrder[T]) start() {
+	o.slots = make(chan struct{}, max(o.workers, 1))
+	o.queue = make(chan chan T, cap(o.slots))
+	o.done = make(chan struct{})
+	go func() {
+		defer close(o.done)
+		for ch := range o.queue {
+			o.emit(<-ch)
+			<-o.slots
+		}
+	}()
+}
+
+// flush waits until every submitted result is emitted. The pipeline can
+// be submitted to again afterwards.
+func (o *inOrder[T]) flush() {
+	if o.queue == nil {
+		return
+	}
+	close(o.queue)
+	<-o.done
+	o.queue = nil
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunParallel(t *testing.T) {
+	var running, peak atomic.Int32
+	done := make([]bool, 20)
+	err := runParallel(len(done), 3, func(i int) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(time.Millisecond)
+		done[i] = true
+		if i == 7 || i == 12 {
+			return fmt.Errorf("job %d", i)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "job 7" {
+		t.Errorf("err %v, want the lowest failure, job 7", err)
+	}
+	if peak.Load() > 3 || slices.Contains(done, false) {
+		t.Errorf("peak %d workers, done %v", peak.Load(), done)
+	}
+	if err := runParallel(0, 3, func(int) error { return errors.New("called") }); err != nil {
+		t.Errorf("no jobs: %v", err)
+	}
+}
+
+func TestInOrder(t *testing.T) {
+	var got []int
+	var running, peak atomic.Int32
+	o := &inOrder[int]{workers: 4, emit: func(v int) { got = append(got, v) }}
+	for i := 0; i < 10; i++ {
+		o.submit(func() int {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(time.Duration(10-i) * time.Millisecond) // later jobs finish first
+			return i
+		})
+	}
+	o.flush()
+	if !slices.Equal(got, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Errorf("emitted %v", got)
+	}
+	if peak.Load() > 4 {
+		t.Errorf("peak %d jobs, want at most 4", peak.Load())
+	}
+
+	// The first result is emitted without waiting for more submissions.
+	emitted := make(chan int, 1)
+	o = &inOrder[int]{workers: 4, emit: func(v int) { emitted <- v }}
+	o.submit(func() int { return 42 })
+	select {
+	case v := <-emitted:
+		if v != 42 {
+			t.Errorf("emitted %d", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("result not emitted before flush")
+	}
+	o.flush()
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// maxOptionSets bounds the work a single preview request can ask for.
+const maxOptionSets = 20
+
+type previewRequest struct {
+	CohortID   string       `json:"cohort_id"`
+	Items      []rankItem   `json:"items"`
+	OptionSets []previewSet `json:"option_sets"`
+}
+
+// previewSet is one named set of /rank options. Options start from the
+// service defaults, exactly like a /rank request.
+type previewSet struct {
+	Name    string          `json:"name"`
+	Options json.RawMessage `json:"options"`
+}
+
+type previewResponse struct {
+	CohortID string         `json:"cohort_id"`
+	Previews []namedRanking `json:"previews"`
+}
+
+type namedRanking struct {
+	Name string `json:"name"`
+	rankResponse
+}
+
+// previewHandler ranks one cohort under several option sets side by side.
+// Nothing is stored.
+func (s *Server) previewHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+
+	var req previewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, "json", err)
+		return
+	}
+	if len(req.OptionSets) == 0 || len(req.OptionSets) > maxOptionSets {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("option_sets must have 1 to %d entries", maxOptionSets))
+		return
+	}
+	logRequest(r, req.CohortID, len(req.Items))
+	if limit, tooMany := s.itemLimit(t); limit > 0 && len(req.Items) > limit {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codeTooManyItems, tooMany.Error())
+		return
+	}
+	if err := s.validateItems("items", req.Items); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if err := rejectSubjects("items", req.Items); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	out := previewResponse{CohortID: req.CohortID, Previews: make([]namedRanking, 0, len(req.OptionSets))}
+	seen := make(map[string]bool, len(req.OptionSets))
+	for _, set := range req.OptionSets {
+		if set.Name == "" || seen[set.Name] {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("option set name %q is empty or duplicated", set.Name))
+			return
+		}
+		seen[set.Name] = true
+
+		opts := s.defaultsFor(t)
+		if len(set.Options) > 0 {
+			if err := json.Unmarshal(set.Options, &opts); err != nil {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, fmt.Sprintf("option set %q: invalid json: %v", set.Name, err))
+				return
+			}
+		}
+		// Each set applies its own duplicates policy.
+		items, dropped, err := dedupeItems("items", req.Items, opts.Duplicates)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeDuplicateUserID, fmt.Sprintf("option set %q: %v", set.Name, err))
+			return
+		}
+		results, err := s.rankItems(r.Context(), items, opts)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidOptions, fmt.Sprintf("option set %q: %v", set.Name, err))
+			return
+		}
+		resp := toResponse(req.CohortID, results, opts)
+		resp.DuplicatesDropped = dropped
+		out.Previews = append(out.Previews, namedRanking{Name: set.Name, rankResponse: resp})
+	}
+
+	writeJSON(w, withCase(out, s.Defaults.FieldCase))
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPreviewMatchesDirectRank(t *testing.T) {
+	ts := newTestServer(t, nil)
+	const items = `"items":[{"user_id":"a","percent":70},{"user_id":"b","percent":69.5},{"user_id":"c","percent":90},{"user_id":"d","percent":10}]`
+	sets := map[string]string{
+		"plain":   `{}`,
+		"grace":   `{"grace_band":1}`,
+		"trimmed": `{"trim_percent":25,"precision":1}`,
+		"zscore":  `{"transform":"zscore","include_scores":true,"output_order":"worst_first"}`,
+	}
+	body := `{"cohort_id":"c1",` + items + `,"option_sets":[`
+	first := true
+	for name, opts := range sets {
+		if !first {
+			body += ","
+		}
+		first = false
+		body += `{"name":"` + name + `","options":` + opts + `}`
+	}
+	body += `]}`
+
+	resp := do(t, "POST", ts.URL+"/rank/preview", body, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[previewResponse](t, resp)
+	if len(got.Previews) != len(sets) {
+		t.Fatalf("got %d previews, want %d", len(got.Previews), len(sets))
+	}
+
+	for _, p := range got.Previews {
+		body := `{"cohort_id":"c1",` + items
+		if inner := strings.Trim(sets[p.Name], "{}"); inner != "" {
+			body += "," + inner
+		}
+		direct := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", body+"}", nil))
+		// Previews aren't stored, so have no version to compare against.
+		direct.Version, direct.PreviousVersion = 0, 0
+		for i := range direct.Results {
+			direct.Results[i].RankChange, direct.Results[i].PercentileChange = nil, nil
+		}
+		if !reflect.DeepEqual(p.rankResponse, direct) {
+			t.Errorf("%s: preview %+v != direct %+v", p.Name, p.rankResponse, direct)
+		}
+	}
+}
+
+func TestPreviewRejectsBadSets(t *testing.T) {
+	ts := newTestServer(t, nil)
+	for name, sets := range map[string]string{
+		"none":      `[]`,
+		"duplicate": `[{"name":"x","options":{}},{"name":"x","options":{}}]`,
+		"unnamed":   `[{"options":{}}]`,
+		"invalid":   `[{"name":"x","options":{"trim_percent":90}}]`,
+	} {
+		resp := do(t, "POST", ts.URL+"/rank/preview", `{"items":[{"user_id":"a","percent":1}],"option_sets":`+sets+`}`, nil)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", name, resp.StatusCode)
+		}
+	}
+}
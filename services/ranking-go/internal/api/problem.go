@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Error codes are stable identifiers clients can branch on; the detail
+// text may change. Field-level codes appear in a problem's fields.
+const (
+	codeInvalidJSON          = "INVALID_JSON"
+	codeInvalidRequest       = "INVALID_REQUEST"
+	codeInvalidOptions       = "INVALID_OPTIONS"
+	codeBodyTooLarge         = "BODY_TOO_LARGE"
+	codeUnsupportedEncoding  = "UNSUPPORTED_ENCODING"
+	codeTooManyItems         = "TOO_MANY_ITEMS"
+	codeUnauthorized         = "UNAUTHORIZED"
+	codeInvalidToken         = "INVALID_TOKEN"
+	codeForbidden            = "FORBIDDEN"
+	codeRateLimited          = "RATE_LIMITED"
+	codeNotFound             = "NOT_FOUND"
+	codeCohortNotFound       = "COHORT_NOT_FOUND"
+	codeUserNotFound         = "USER_NOT_FOUND"
+	codeJobNotFound          = "JOB_NOT_FOUND"
+	codeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	codeVersionRequired      = "VERSION_REQUIRED"
+	codeVersionConflict      = "VERSION_CONFLICT"
+	codeIdempotencyKeyInUse  = "IDEMPOTENCY_KEY_IN_USE"
+	codeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+	codeJobQueueFull         = "JOB_QUEUE_FULL"
+	codeAuthUnavailable      = "AUTH_UNAVAILABLE"
+	codeExportFailed         = "EXPORT_FAILED"
+	codeStoreError           = "STORE_ERROR"
+	codeStaleCursor          = "STALE_CURSOR"
+	codeInvalidPercent       = "INVALID_PERCENT"
+	codeInvalidNumber        = "INVALID_NUMBER"
+	codeInvalidType          = "INVALID_TYPE"
+	codeEmptyUserID          = "EMPTY_USER_ID"
+	codeDuplicateUserID      = "DUPLICATE_USER_ID"
+	codeMissingField         = "MISSING_FIELD"
+)
+
+// problem is an RFC 7807 application/problem+json body. Type is always
+// "about:blank", so Title is the status text and Code says what went
+// wrong.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	// Fields lists invalid fields, at most maxFieldErrors of them;
+	// FieldCount is the total when more were found.
+	Fields     []fieldError `json:"fields,omitempty"`
+	FieldCount int          `json:"field_count,omitempty"`
+}
+
+// writeProblem answers r with status and a problem body.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	sendProblem(w, r, problem{Status: status, Code: code, Detail: detail})
+}
+
+func sendProblem(w http.ResponseWriter, r *http.Request, p problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+	p.RequestID = requestID(r.Context())
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/problem+json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// writeValidationError answers 400 for err: with its fields for a
+// validationError, coded by the first invalid field, else as
+// INVALID_OPTIONS.
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var ve *validationError
+	if !errors.As(err, &ve) {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidOptions, err.Error())
+		return
+	}
+	sendProblem(w, r, validationProblem(ve))
+}
+
+// validationProblem is the 400 for ve.
+func validationProblem(ve *validationError) problem {
+	p := problem{Status: http.StatusBadRequest, Code: ve.Fields[0].Code, Detail: ve.Error(), Fields: ve.Fields}
+	if ve.Total > len(ve.Fields) {
+		p.FieldCount = ve.Total
+	}
+	return p
+}
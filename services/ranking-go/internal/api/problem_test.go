@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProblemResponses(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":50}]}`, nil).Body.Close()
+
+	cases := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"POST", "/rank", `{"items":`, http.StatusBadRequest, codeInvalidJSON},
+		{"POST", "/rank", `{"items":[{"user_id":"a","percent":101}]}`, http.StatusBadRequest, codeInvalidPercent},
+		{"POST", "/rank", `{"items":[{"user_id":"a","percent":1}],"precision":-1}`, http.StatusBadRequest, codeInvalidOptions},
+		{"GET", "/leaderboard/missing", "", http.StatusNotFound, codeCohortNotFound},
+		{"GET", "/rank/c1/users/nobody", "", http.StatusNotFound, codeUserNotFound},
+		{"GET", "/rank/jobs/nope", "", http.StatusNotFound, codeJobNotFound},
+	}
+	for _, c := range cases {
+		resp := do(t, c.method, ts.URL+c.path, c.body, nil)
+		if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("%s %s: Content-Type = %q", c.method, c.path, ct)
+		}
+		got := decode[problem](t, resp)
+		if resp.StatusCode != c.status || got.Status != c.status || got.Code != c.code {
+			t.Errorf("%s %s: status %d, problem %+v; want %d %s", c.method, c.path, resp.StatusCode, got, c.status, c.code)
+			continue
+		}
+		if got.Type != "about:blank" || got.Title != http.StatusText(c.status) || got.Instance != c.path || got.Detail == "" {
+			t.Errorf("%s %s: problem %+v", c.method, c.path, got)
+		}
+	}
+}
+
+func TestBatchErrorCodes(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank/batch", `[{"cohort_id":"a","items":[{"user_id":"","percent":1}]},{"cohort_id":"b","items":[{"user_id":"x","percent":1}]}]`, nil)
+	got := decode[[]batchEntryJSON](t, resp)
+	if len(got) != 2 || got[0].ErrorCode != codeEmptyUserID || !strings.Contains(got[0].Error, "user_id") || got[1].ErrorCode != "" {
+		t.Fatalf("entries = %+v", got)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestQuantileLabels(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","quantile":"quartile","items":[
+		{"user_id":"a","percent":92},{"user_id":"b","percent":85},{"user_id":"c","percent":80},{"user_id":"d","percent":71},{"user_id":"e","percent":60}
+	]}`, nil)
+	got := decode[rankResponse](t, resp)
+	want := []struct {
+		q     int
+		label string
+	}{{1, "Top 25%"}, {1, "Top 25%"}, {2, "Top 50%"}, {3, "Bottom 50%"}, {4, "Bottom 25%"}}
+	for i, w := range want {
+		if r := got.Results[i]; r.Quantile != w.q || r.QuantileLabel != w.label {
+			t.Errorf("%s: %d %q, want %d %q", r.UserID, r.Quantile, r.QuantileLabel, w.q, w.label)
+		}
+	}
+
+	// Stored views keep the cohort's bands.
+	user := decode[userRankResponse](t, do(t, "GET", ts.URL+"/rank/c1/users/d", "", nil))
+	if user.Quantile != 3 || user.QuantileLabel != "Bottom 50%" {
+		t.Errorf("user lookup: %+v", user.rankResult)
+	}
+	lb := decode[leaderboardResponse](t, do(t, "GET", ts.URL+"/leaderboard/c1?limit=1", "", nil))
+	if len(lb.Results) != 1 || lb.Results[0].QuantileLabel != "Top 25%" {
+		t.Errorf("leaderboard: %+v", lb.Results)
+	}
+
+	// Without the option there are no bands.
+	resp = do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":92}]}`, nil)
+	if got := decode[rankResponse](t, resp); got.Results[0].Quantile != 0 || got.Results[0].QuantileLabel != "" {
+		t.Errorf("no quantile: %+v", got.Results[0])
+	}
+	resp = do(t, "POST", ts.URL+"/rank", `{"quantile":"decile","format":"columns","min_score":50,"items":[{"user_id":"a","percent":92},{"user_id":"b","percent":40}]}`, nil)
+	if cols := decode[rankColumns](t, resp); len(cols.Quantiles) != 2 || cols.Quantiles[0] != 1 || cols.Quantiles[1] != 0 || cols.QuantileLabels[0] != "Top 10%" {
+		t.Errorf("columns: %v %v", cols.Quantiles, cols.QuantileLabels)
+	}
+	if resp := do(t, "POST", ts.URL+"/rank", `{"quantile":"tercile","items":[{"user_id":"a","percent":1}]}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("tercile: status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ranking-go/internal/auth"
+	"ranking-go/internal/ratelimit"
+)
+
+// RateLimit throttles each client — its API key, JWT subject or, failing
+// those, its IP — with token buckets. Routes without their own limit share
+// one bucket per client under Default.
+type RateLimit struct {
+	Default ratelimit.Limit
+	// Routes overrides the limit for route patterns such as "POST /rank".
+	Routes map[string]ratelimit.Limit
+	// TrustForwardedFor takes the client IP from X-Forwarded-For, for use
+	// behind a proxy that sets it.
+	TrustForwardedFor bool
+}
+
+// rateLimitExempt routes are never throttled: probes come from the
+// orchestrator, often many per second from one IP.
+var rateLimitExempt = map[string]bool{
+	"GET /health": true,
+	"GET /readyz": true,
+}
+
+// rateLimited answers 429 with Retry-After once the client has spent its
+// tokens for route.
+func (s *Server) rateLimited(route string, h http.HandlerFunc) http.HandlerFunc {
+	if rateLimitExempt[route] {
+		return h
+	}
+	limiter := s.limiterFor(route)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := limiter.Allow(s.clientKey(r.Context(), credentialsOf(r.Header), s.clientIP(r))); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeProblem(w, r, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// limiterFor is route's limiter, shared by the HTTP route and the gRPC
+// method serving it. It is only called while registering them.
+func (s *Server) limiterFor(route string) *ratelimit.Limiter {
+	l, ok := s.RateLimit.Routes[route]
+	if !ok {
+		if s.defaultLimiter == nil {
+			s.defaultLimiter = ratelimit.New(s.RateLimit.Default)
+		}
+		return s.defaultLimiter
+	}
+	if s.limiters[route] == nil {
+		if s.limiters == nil {
+			s.limiters = map[string]*ratelimit.Limiter{}
+		}
+		s.limiters[route] = ratelimit.New(l)
+	}
+	return s.limiters[route]
+}
+
+// clientKey identifies the caller, authenticated by ctx's principal if
+// any and connecting from ip, for rate limiting. An X-API-Key counts only
+// once something has vouched for it, so clients can't dodge their bucket
+// by sending made-up keys.
+func (s *Server) clientKey(ctx context.Context, c credentials, ip string) string {
+	if p := auth.FromContext(ctx); p != nil {
+		switch p.Method {
+		case auth.MethodJWT:
+			return "jwt:" + p.Tenant + "/" + p.Subject
+		case auth.MethodServiceKey:
+			return "key:" + c.apiKey
+		}
+	}
+	if key := c.apiKey; key != "" {
+		// Only a key the registry knows gets a bucket of its own; made-up
+		// keys share their IP's.
+		if _, ok := s.Tenants.ByKey(key); ok {
+			return "key:" + key
+		}
+	}
+	return "ip:" + ip
+}
+
+func (s *Server) clientIP(r *http.Request) string {
+	if s.RateLimit.TrustForwardedFor {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			first, _, _ := strings.Cut(xff, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ranking-go/internal/ratelimit"
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+)
+
+func newLimitedServer(t *testing.T, tenants *tenant.Registry, rl RateLimit) *httptest.Server {
+	t.Helper()
+	srv := NewServer(store.NewMemory(), tenants)
+	srv.RateLimit = rl
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func status(t *testing.T, method, url string, header map[string]string) *http.Response {
+	t.Helper()
+	resp := do(t, method, url, `{"cohort_id":"c1","items":[{"user_id":"u1","percent":90}]}`, header)
+	resp.Body.Close()
+	return resp
+}
+
+func TestRateLimit(t *testing.T) {
+	ts := newLimitedServer(t, nil, RateLimit{
+		Default: ratelimit.Limit{Rate: 0.01, Burst: 2},
+		Routes:  map[string]ratelimit.Limit{"POST /rank": {Rate: 0.01, Burst: 1}},
+	})
+
+	if resp := status(t, "POST", ts.URL+"/rank", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first /rank: status = %d", resp.StatusCode)
+	}
+	resp := status(t, "POST", ts.URL+"/rank", nil)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("second /rank: status = %d, want 429", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "100" {
+		t.Fatalf("Retry-After = %q, want 100", got)
+	}
+
+	// Other routes share the default bucket, untouched by /rank.
+	for i := 0; i < 2; i++ {
+		if resp := status(t, "GET", ts.URL+"/rank/c1", nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %d: status = %d", i, resp.StatusCode)
+		}
+	}
+	if resp := status(t, "POST", ts.URL+"/rank/preview", nil); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("preview: status = %d, want 429 from the shared bucket", resp.StatusCode)
+	}
+
+	// Probes are never limited.
+	for i := 0; i < 5; i++ {
+		if resp := status(t, "GET", ts.URL+"/health", nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("/health: status = %d", resp.StatusCode)
+		}
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	reg, err := tenant.NewRegistry([]tenant.Tenant{
+		{ID: "a", APIKeys: []string{"ka"}},
+		{ID: "b", APIKeys: []string{"kb"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newLimitedServer(t, reg, RateLimit{Default: ratelimit.Limit{Rate: 0.01, Burst: 1}, TrustForwardedFor: true})
+
+	// Each API key has its own bucket even from the same IP.
+	for _, key := range []string{"ka", "kb"} {
+		if resp := status(t, "POST", ts.URL+"/rank", map[string]string{"X-API-Key": key}); resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status = %d", key, resp.StatusCode)
+		}
+	}
+	if resp := status(t, "POST", ts.URL+"/rank", map[string]string{"X-API-Key": "ka"}); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("ka again: status = %d, want 429", resp.StatusCode)
+	}
+
+	// Unknown keys don't get buckets of their own: they count against
+	// their IP, so minting keys doesn't dodge the limit.
+	for i, want := range []int{http.StatusUnauthorized, http.StatusTooManyRequests} {
+		h := map[string]string{"X-API-Key": fmt.Sprintf("made-up-%d", i), "X-Forwarded-For": "10.0.0.3"}
+		if resp := status(t, "POST", ts.URL+"/rank", h); resp.StatusCode != want {
+			t.Fatalf("made-up key %d: status = %d, want %d", i, resp.StatusCode, want)
+		}
+	}
+
+	// Without a key, clients are told apart by X-Forwarded-For when trusted.
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		h := map[string]string{"X-Forwarded-For": ip + ", 192.168.0.1", "X-Tenant": "missing"}
+		if resp := status(t, "POST", ts.URL+"/rank", h); resp.StatusCode == http.StatusTooManyRequests {
+			t.Fatalf("%s: limited on first request", ip)
+		}
+	}
+	h := map[string]string{"X-Forwarded-For": "10.0.0.1", "X-Tenant": "missing"}
+	if resp := status(t, "POST", ts.URL+"/rank", h); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("10.0.0.1 again: status = %d, want 429", resp.StatusCode)
+	}
+}
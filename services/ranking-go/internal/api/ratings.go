@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"ranking-go/internal/rating"
+	"ranking-go/internal/store"
+)
+
+// maxMatches bounds the matches of one POST /ratings/matches.
+const maxMatches = 10_000
+
+// ratingsRetries is how often a match upload re-reads and re-applies when
+// another upload to the same cohort wins the race.
+const ratingsRetries = 3
+
+type matchesRequest struct {
+	CohortID string `json:"cohort_id"`
+	// KFactor overrides Server.Ratings.KFactor for these matches; Elo
+	// cohorts only.
+	KFactor *float64       `json:"k_factor,omitempty"`
+	Matches []matchRequest `json:"matches"`
+}
+
+type matchRequest struct {
+	PlayerA string `json:"player_a"`
+	PlayerB string `json:"player_b"`
+	// Result is "a", "b" or "draw".
+	Result string `json:"result"`
+}
+
+var matchScores = map[string]float64{"a": 1, "b": 0, "draw": 0.5}
+
+func (req matchesRequest) validate() error {
+	ve := &validationError{}
+	if req.CohortID == "" {
+		ve.add("cohort_id", codeMissingField, "is required")
+	}
+	if req.KFactor != nil && (!(*req.KFactor > 0) || math.IsInf(*req.KFactor, 1)) {
+		ve.add("k_factor", codeInvalidNumber, "must be a positive number, got %v", *req.KFactor)
+	}
+	switch {
+	case len(req.Matches) == 0:
+		ve.add("matches", codeMissingField, "at least one match is required")
+	case len(req.Matches) > maxMatches:
+		ve.add("matches", codeInvalidRequest, "at most %d matches per request, got %d", maxMatches, len(req.Matches))
+	}
+	for i, m := range req.Matches {
+		field := fmt.Sprintf("matches[%d]", i)
+		if m.PlayerA == "" {
+			ve.add(field+".player_a", codeEmptyUserID, "must not be empty")
+		}
+		if m.PlayerB == "" {
+			ve.add(field+".player_b", codeEmptyUserID, "must not be empty")
+		}
+		if m.PlayerA != "" && m.PlayerA == m.PlayerB {
+			ve.add(field+".player_b", codeInvalidRequest, "player %q cannot play themselves", m.PlayerA)
+		}
+		if _, ok := matchScores[m.Result]; !ok {
+			ve.add(field+".result", codeInvalidRequest, "must be a, b or draw, got %q", m.Result)
+		}
+	}
+	return ve.orNil()
+}
+
+type ratingEntry struct {
+	Rank         int      `json:"rank,omitempty"`
+	UserID       string   `json:"user_id"`
+	Rating       float64  `json:"rating"`
+	RatingChange *float64 `json:"rating_change,omitempty"`
+	// Deviation and Volatility are reported for Glicko-2 tables.
+	Deviation  *float64 `json:"deviation,omitempty"`
+	Volatility *float64 `json:"volatility,omitempty"`
+	Matches    int      `json:"matches"`
+	Wins       int      `json:"wins"`
+	Losses     int      `json:"losses"`
+	Draws      int      `json:"draws"`
+}
+
+type ratingsResponse struct {
+	CohortID  string        `json:"cohort_id"`
+	System    string        `json:"system"`
+	Version   int64         `json:"version"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Players   []ratingEntry `json:"players"`
+}
+
+// roundRating reports ratings to one decimal; the full value is stored.
+func roundRating(r float64) float64 { return math.Round(r*10) / 10 }
+
+func newRatingEntry(p rating.Player, system string) ratingEntry {
+	e := ratingEntry{UserID: p.UserID, Rating: roundRating(p.Rating), Matches: p.Matches, Wins: p.Wins, Losses: p.Losses, Draws: p.Draws}
+	if system == rating.SystemGlicko2 {
+		dev, vol := roundRating(p.Deviation), math.Round(p.Volatility*1e6)/1e6
+		e.Deviation, e.Volatility = &dev, &vol
+	}
+	return e
+}
+
+// ratingSystem returns the system a table is updated with, or a field
+// error for options it does not take.
+func (s *Server) ratingSystem(system string, kFactor *float64) (rating.System, error) {
+	switch system {
+	case rating.SystemGlicko2:
+		if kFactor != nil {
+			ve := &validationError{}
+			ve.add("k_factor", codeInvalidRequest, "applies to elo cohorts only; this cohort uses glicko2")
+			return nil, ve
+		}
+		return rating.Glicko2{Initial: s.Ratings.InitialRating, Deviation: s.Ratings.InitialDeviation, Volatility: s.Ratings.InitialVolatility, Tau: s.Ratings.Tau}, nil
+	case rating.SystemElo:
+		elo := rating.Elo{K: s.Ratings.KFactor, Initial: s.Ratings.InitialRating}
+		if kFactor != nil {
+			elo.K = *kFactor
+		}
+		return elo, nil
+	}
+	return nil, fmt.Errorf("unknown rating system %q", system)
+}
+
+// matchesHandler applies a batch of match results, in order, to the
+// cohort's stored ratings, creating the table on its first matches with
+// the configured system. The response lists the players the matches
+// touched, best first, with how far each moved.
+func (s *Server) matchesHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	var req matchesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, "json", err)
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	matches := make([]rating.Match, len(req.Matches))
+	for i, m := range req.Matches {
+		matches[i] = rating.Match{A: m.PlayerA, B: m.PlayerB, ScoreA: matchScores[m.Result]}
+	}
+
+	var (
+		table  store.Ratings
+		before map[string]float64
+		err    error
+	)
+	for attempt := 0; attempt < ratingsRetries; attempt++ {
+		table, err = s.Store.GetRatings(r.Context(), t.ID, req.CohortID)
+		if errors.Is(err, store.ErrNotFound) {
+			table, err = store.Ratings{CohortID: req.CohortID, System: s.Ratings.SystemFor(req.CohortID)}, nil
+		}
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		system, err := s.ratingSystem(table.System, req.KFactor)
+		if err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+		players := make(map[string]*rating.Player, len(table.Players))
+		before = make(map[string]float64, len(table.Players))
+		for _, p := range table.Players {
+			p := p
+			players[p.UserID] = &p
+			before[p.UserID] = p.Rating
+		}
+		if err := system.Apply(players, matches); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		table.Players = rating.Sorted(players)
+		table.UpdatedAt = time.Now().UTC()
+		table.Version, err = s.Store.PutRatings(r.Context(), t.ID, table, table.Version)
+		if !errors.Is(err, store.ErrVersionConflict) {
+			break
+		}
+	}
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	played := make(map[string]bool)
+	for _, m := range matches {
+		played[m.A], played[m.B] = true, true
+	}
+	out := ratingsResponse{CohortID: table.CohortID, System: table.System, Version: table.Version, UpdatedAt: table.UpdatedAt, Players: []ratingEntry{}}
+	for _, p := range table.Players {
+		if !played[p.UserID] {
+			continue
+		}
+		e := newRatingEntry(p, table.System)
+		old, ok := before[p.UserID]
+		if !ok {
+			old = s.Ratings.InitialRating
+		}
+		change := roundRating(p.Rating - old)
+		e.RatingChange = &change
+		out.Players = append(out.Players, e)
+	}
+	writeJSON(w, withCase(out, s.Defaults.FieldCase))
+}
+
+// ratingsHandler returns a cohort's rating leaderboard, best first. Equal
+// ratings share a rank.
+func (s *Server) ratingsHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	table, err := s.Store.GetRatings(r.Context(), t.ID, r.PathValue("cohort_id"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	out := ratingsResponse{CohortID: table.CohortID, System: table.System, Version: table.Version, UpdatedAt: table.UpdatedAt, Players: make([]ratingEntry, len(table.Players))}
+	for i, p := range table.Players {
+		out.Players[i] = newRatingEntry(p, table.System)
+		out.Players[i].Rank = i + 1
+		if i > 0 && p.Rating == table.Players[i-1].Rating {
+			out.Players[i].Rank = out.Players[i-1].Rank
+		}
+	}
+	writeJSON(w, withCase(out, s.Defaults.FieldCase))
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ranking-go/internal/rating"
+	"ranking-go/internal/store"
+)
+
+func TestRatings(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/ratings/matches", `{"cohort_id":"duel","matches":[{"player_a":"a","player_b":"b","result":"a"}]}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[ratingsResponse](t, resp)
+	if got.Version != 1 || got.System != "elo" || len(got.Players) != 2 {
+		t.Fatalf("first matches %+v", got)
+	}
+	// Equal ratings expect 0.5 each, so the default K of 32 moves each by 16.
+	if a := got.Players[0]; a.UserID != "a" || a.Rating != 1516 || *a.RatingChange != 16 || a.Wins != 1 {
+		t.Errorf("winner %+v", a)
+	}
+
+	// A higher K moves ratings further; only the players in these matches
+	// are reported.
+	got = decode[ratingsResponse](t, do(t, "POST", ts.URL+"/ratings/matches", `{"cohort_id":"duel","k_factor":64,"matches":[{"player_a":"c","player_b":"b","result":"draw"}]}`, nil))
+	if got.Version != 2 || len(got.Players) != 2 || got.Players[0].UserID != "c" || got.Players[0].Draws != 1 {
+		t.Fatalf("second matches %+v", got)
+	}
+	if ch := *got.Players[0].RatingChange; ch >= 0 || ch < -32 {
+		t.Errorf("c drew with a weaker b but moved %v", ch)
+	}
+
+	board := decode[ratingsResponse](t, do(t, "GET", ts.URL+"/ratings/duel", "", nil))
+	if board.Version != 2 || len(board.Players) != 3 {
+		t.Fatalf("leaderboard %+v", board)
+	}
+	for i, want := range []string{"a", "c", "b"} {
+		if p := board.Players[i]; p.UserID != want || p.Rank != i+1 || p.RatingChange != nil {
+			t.Errorf("leaderboard[%d] = %+v, want %s at rank %d", i, p, want, i+1)
+		}
+	}
+
+	// Ratings are per tenant and apart from rankings.
+	if resp := do(t, "GET", ts.URL+"/ratings/duel", "", map[string]string{"X-Tenant": "other"}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("other tenant: status %d, want 404", resp.StatusCode)
+	}
+	if resp := do(t, "GET", ts.URL+"/rank/duel", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("ranking of a rated cohort: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestRatingsValidation(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/ratings/matches", `{"k_factor":0,"matches":[{"player_a":"a","player_b":"a","result":"win"},{"player_a":"","player_b":"b","result":"b"}]}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", resp.StatusCode)
+	}
+	p := decode[problem](t, resp)
+	want := []string{"cohort_id", "k_factor", "matches[0].player_b", "matches[0].result", "matches[1].player_a"}
+	if len(p.Fields) != len(want) {
+		t.Fatalf("fields %+v, want %v", p.Fields, want)
+	}
+	for i, f := range p.Fields {
+		if f.Field != want[i] {
+			t.Errorf("fields[%d] = %s, want %s", i, f.Field, want[i])
+		}
+	}
+	// Nothing was stored.
+	if resp := do(t, "GET", ts.URL+"/ratings/duel", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestRatingsGlicko2(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Ratings.Cohorts = map[string]string{"sporadic": rating.SystemGlicko2}
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	got := decode[ratingsResponse](t, do(t, "POST", ts.URL+"/ratings/matches", `{"cohort_id":"sporadic","matches":[{"player_a":"a","player_b":"b","result":"a"}]}`, nil))
+	if got.System != "glicko2" || len(got.Players) != 2 {
+		t.Fatalf("glicko2 matches %+v", got)
+	}
+	// Two unrated players: a large move, and both grow more certain.
+	a := got.Players[0]
+	if a.UserID != "a" || *a.RatingChange < 100 || a.Deviation == nil || *a.Deviation >= 350 || a.Volatility == nil {
+		t.Errorf("winner %+v", a)
+	}
+
+	// Other cohorts keep the default, Elo, without deviations.
+	got = decode[ratingsResponse](t, do(t, "POST", ts.URL+"/ratings/matches", `{"cohort_id":"duel","matches":[{"player_a":"a","player_b":"b","result":"b"}]}`, nil))
+	if got.System != "elo" || got.Players[0].Deviation != nil {
+		t.Errorf("elo cohort %+v", got)
+	}
+
+	board := decode[ratingsResponse](t, do(t, "GET", ts.URL+"/ratings/sporadic", "", nil))
+	if board.System != "glicko2" || board.Players[1].Deviation == nil {
+		t.Errorf("glicko2 leaderboard %+v", board)
+	}
+
+	resp := do(t, "POST", ts.URL+"/ratings/matches", `{"cohort_id":"sporadic","k_factor":16,"matches":[{"player_a":"a","player_b":"b","result":"a"}]}`, nil)
+	if p := decode[problem](t, resp); resp.StatusCode != http.StatusBadRequest || len(p.Fields) != 1 || p.Fields[0].Field != "k_factor" {
+		t.Errorf("k_factor on glicko2: status %d, %+v", resp.StatusCode, p)
+	}
+}
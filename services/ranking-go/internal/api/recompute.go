@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"ranking-go/internal/rank"
+)
+
+type recomputeRequest struct {
+	CohortSize int                   `json:"cohort_size"`
+	Method     rank.PercentileMethod `json:"method"`
+	Ranks      []rankedUser          `json:"ranks"`
+	// RankBase says whether Ranks count from 0 or 1 (nil means 1).
+	RankBase *int `json:"rank_base,omitempty"`
+}
+
+type rankedUser struct {
+	UserID string `json:"user_id"`
+	Rank   int    `json:"rank"`
+}
+
+type recomputeResponse struct {
+	CohortSize int                   `json:"cohort_size"`
+	Method     rank.PercentileMethod `json:"method"`
+	Results    []rankResult          `json:"results"`
+}
+
+// recomputeHandler recomputes percentiles for an existing ranking from its
+// ranks alone, e.g. to restate an archived ranking under another percentile
+// method. No scores are needed and nothing is stored.
+func (s *Server) recomputeHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+
+	var req recomputeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, "json", err)
+		return
+	}
+	if limit, tooMany := s.itemLimit(t); limit > 0 && len(req.Ranks) > limit {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codeTooManyItems, tooMany.Error())
+		return
+	}
+	if req.CohortSize != len(req.Ranks) {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("cohort_size %d does not match %d ranks", req.CohortSize, len(req.Ranks)))
+		return
+	}
+	base := rankOptions{RankBase: req.RankBase}
+	if err := base.validate(); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	// The percentile formulas take 1-based ranks.
+	shift := 1 - base.rankBase()
+	ranks := make([]int, len(req.Ranks))
+	seen := make(map[string]bool, len(req.Ranks))
+	for i, u := range req.Ranks {
+		if seen[u.UserID] {
+			writeProblem(w, r, http.StatusBadRequest, codeDuplicateUserID, fmt.Sprintf("duplicate user_id %q", u.UserID))
+			return
+		}
+		seen[u.UserID] = true
+		ranks[i] = u.Rank + shift
+	}
+	pcts, err := rank.PercentilesFromRanks(ranks, req.Method)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	if req.Method == "" {
+		req.Method = rank.MethodSelfExclusive
+	}
+	out := recomputeResponse{CohortSize: req.CohortSize, Method: req.Method, Results: make([]rankResult, len(req.Ranks))}
+	for i, u := range req.Ranks {
+		out.Results[i] = rankResult{UserID: u.UserID, Rank: u.Rank, Percentile: &pcts[i]}
+	}
+	writeJSON(w, withCase(out, s.Defaults.FieldCase))
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"ranking-go/internal/rank"
+)
+
+func TestRecomputeStoredRanking(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":70},{"user_id":"c","percent":50},{"user_id":"d","percent":30}]}`, nil)
+	stored := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/c1", "", nil))
+
+	req := recomputeRequest{CohortSize: len(stored.Results)}
+	for _, r := range stored.Results {
+		req.Ranks = append(req.Ranks, rankedUser{UserID: r.UserID, Rank: r.Rank})
+	}
+	for method, want := range map[string][]float64{
+		"exclusive": {75, 50, 25, 0},
+		"inclusive": {100, 75, 50, 25},
+	} {
+		req.Method = rank.PercentileMethod(method)
+		body, _ := json.Marshal(req)
+		resp := do(t, "POST", ts.URL+"/rank/percentiles", string(body), nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d", method, resp.StatusCode)
+		}
+		got := decode[recomputeResponse](t, resp)
+		if string(got.Method) != method {
+			t.Errorf("method echoed as %q, want %q", got.Method, method)
+		}
+		for i, r := range got.Results {
+			if r.UserID != stored.Results[i].UserID || r.Rank != stored.Results[i].Rank {
+				t.Errorf("%s: result %d is %s/%d, want %s/%d", method, i, r.UserID, r.Rank, stored.Results[i].UserID, stored.Results[i].Rank)
+			}
+			if *r.Percentile != want[i] {
+				t.Errorf("%s: %s percentile %v, want %v", method, r.UserID, *r.Percentile, want[i])
+			}
+		}
+	}
+}
+
+func TestRecomputeRejectsInconsistentRanks(t *testing.T) {
+	ts := newTestServer(t, nil)
+	for name, body := range map[string]string{
+		"size mismatch": `{"cohort_size":3,"ranks":[{"user_id":"a","rank":1},{"user_id":"b","rank":2}]}`,
+		"gap":           `{"cohort_size":2,"ranks":[{"user_id":"a","rank":1},{"user_id":"b","rank":3}]}`,
+		"duplicate":     `{"cohort_size":2,"ranks":[{"user_id":"a","rank":1},{"user_id":"a","rank":2}]}`,
+		"method":        `{"cohort_size":1,"method":"median","ranks":[{"user_id":"a","rank":1}]}`,
+	} {
+		if resp := do(t, "POST", ts.URL+"/rank/percentiles", body, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", name, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ranking-go/internal/kafka"
+	"ranking-go/internal/rank"
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+)
+
+// maxEventRetries bounds the re-reads of a cohort whose conditional write
+// lost to a concurrent update.
+const maxEventRetries = 3
+
+// scoreEvent is a score submission consumed from Kafka instead of POSTed
+// to /rank/{cohort_id}/scores.
+type scoreEvent struct {
+	Tenant   string   `json:"tenant"`
+	CohortID string   `json:"cohort_id"`
+	UserID   string   `json:"user_id"`
+	Percent  *float64 `json:"percent"`
+	// SubmittedAt orders a user's events; the record's timestamp if
+	// absent.
+	SubmittedAt *time.Time `json:"submitted_at"`
+}
+
+// submitted is ev's SubmittedAt in Unix nanoseconds, or else the record
+// time's; 0 if neither is known.
+func (ev scoreEvent) submitted(m kafka.Message) int64 {
+	switch {
+	case ev.SubmittedAt != nil:
+		return ev.SubmittedAt.UnixNano()
+	case !m.Time.IsZero():
+		return m.Time.UnixNano()
+	}
+	return 0
+}
+
+// parseScoreEvent decodes and checks one event. An empty tenant is
+// tenant.Default.
+func (s *Server) parseScoreEvent(data []byte) (scoreEvent, *tenant.Tenant, error) {
+	var ev scoreEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return ev, nil, err
+	}
+	if ev.Tenant == "" {
+		ev.Tenant = tenant.Default
+	}
+	ve := &validationError{}
+	if ev.CohortID == "" {
+		ve.add("cohort_id", codeMissingField, "is required")
+	}
+	if strings.TrimSpace(ev.UserID) == "" {
+		ve.add("user_id", codeEmptyUserID, "must not be empty")
+	}
+	if ev.Percent == nil {
+		ve.add("percent", codeMissingField, "is required")
+	} else {
+		s.checkPercent(ve, "percent", *ev.Percent)
+	}
+	if err := ve.orNil(); err != nil {
+		return ev, nil, err
+	}
+	t, err := s.Tenants.Lookup(ev.Tenant)
+	if err != nil {
+		return ev, nil, fmt.Errorf("tenant %q: %w", ev.Tenant, err)
+	}
+	return ev, t, nil
+}
+
+// ConsumeScores applies a batch of score-submitted events from Kafka, as
+// POST /rank/{cohort_id}/scores would, except that an unknown cohort is
+// created with the configured defaults. Each cohort is read and written
+// once per batch. Events that can never apply (malformed, unknown tenant,
+// over the tenant's max_items) are logged and skipped; a store error
+// fails the batch, so the consumer hands it over again. Events come more
+// than once after a failure or a rebalance, and from several partitions
+// out of order, so each user's submission time is stored with their
+// percent and an event submitted no later than it is stale and skipped:
+// a replay neither repeats a write nor undoes a later one.
+func (s *Server) ConsumeScores(ctx context.Context, msgs []kafka.Message) error {
+	type cohort struct {
+		t      *tenant.Tenant
+		events []timedScore
+	}
+	var order []streamKey
+	cohorts := map[streamKey]*cohort{}
+	for _, m := range msgs {
+		ev, t, err := s.parseScoreEvent(m.Value)
+		if err != nil {
+			s.logger().Warn("skipping score event", "partition", m.Partition, "offset", m.Offset, "error", err)
+			continue
+		}
+		key := streamKey{t.ID, ev.CohortID}
+		if cohorts[key] == nil {
+			cohorts[key] = &cohort{t: t}
+			order = append(order, key)
+		}
+		cohorts[key].events = append(cohorts[key].events, timedScore{ev, ev.submitted(m)})
+	}
+	for _, key := range order {
+		c := cohorts[key]
+		var err error
+		for try := 0; try < maxEventRetries; try++ {
+			if err = s.applyScoreEvents(ctx, c.t, key.cohort, c.events); !errors.Is(err, store.ErrVersionConflict) {
+				break
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("cohort %q: %w", key.cohort, err)
+		}
+	}
+	return nil
+}
+
+// timedScore is a parsed event and when it was submitted.
+type timedScore struct {
+	scoreEvent
+	submitted int64
+}
+
+// applyScoreEvents updates one cohort with its events, in order, but for
+// any that are stale.
+func (s *Server) applyScoreEvents(ctx context.Context, t *tenant.Tenant, cohortID string, events []timedScore) error {
+	cur, err := s.Store.Get(ctx, t.ID, cohortID)
+	// A new cohort is created only if no other replica has meanwhile; if
+	// one has, the write conflicts and the events apply on top of it.
+	ifVersion := cur.Version
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		cur = store.Ranking{CohortID: cohortID, Options: s.defaultsFor(t).toRank()}
+		ifVersion = store.IfAbsent
+	case err != nil:
+		return err
+	}
+	opts := cur.Options
+	opts.ExternalSort = s.ExternalSort
+	// submitted is each known user's latest submission time.
+	submitted := make(map[string]int64, len(cur.Items))
+	for _, it := range cur.Items {
+		submitted[it.UserID] = it.Submitted
+	}
+	limit, tooMany := s.itemLimit(t)
+	scores := make([]rank.Score, 0, len(events))
+	stale := 0
+	for _, ev := range events {
+		last, known := submitted[ev.UserID]
+		switch {
+		case limit > 0 && len(submitted) >= limit && !known:
+			s.logger().Warn("skipping score event", "cohort_id", cohortID, "user_id", ev.UserID, "error", tooMany)
+			continue
+		case known && ev.submitted != 0 && ev.submitted <= last:
+			stale++
+			continue
+		}
+		submitted[ev.UserID] = max(last, ev.submitted)
+		scores = append(scores, rank.Score{UserID: ev.UserID, Percent: *ev.Percent, Submitted: ev.submitted})
+	}
+	if stale > 0 {
+		s.logger().Info("skipped stale score events", "cohort_id", cohortID, "events", stale)
+	}
+	if len(scores) == 0 {
+		return nil
+	}
+	// One batch through rank.UpdateScores: under incremental options each
+	// event moves one user on a board rather than re-ranking the cohort.
+	start := time.Now()
+	items, results, err := rank.UpdateScores(cur.Items, cur.Results, opts, scores)
+	if err != nil {
+		s.logger().Warn("skipping score events", "cohort_id", cohortID, "events", len(scores), "error", err)
+		return nil
+	}
+	s.metrics.observeRank(len(items), time.Since(start))
+	v, err := s.Store.Put(ctx, t.ID, store.Ranking{
+		CohortID: cohortID,
+		Items:    items,
+		Options:  cur.Options,
+		Results:  results,
+		RankedAt: time.Now().UTC(),
+	}, ifVersion)
+	if err != nil {
+		return err
+	}
+	s.publishRankChanges(t.ID, cohortID, v, cur.Results, results)
+	return nil
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"ranking-go/internal/kafka"
+	"ranking-go/internal/rank"
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+)
+
+// racedStore is a store that another replica creates cohort "new" in
+// just after the first Get finds it missing.
+type racedStore struct {
+	*store.Memory
+	raced bool
+}
+
+func (r *racedStore) Get(ctx context.Context, tenant, cohortID string) (store.Ranking, error) {
+	got, err := r.Memory.Get(ctx, tenant, cohortID)
+	if cohortID == "new" && !r.raced {
+		r.raced = true
+		items := []rank.Item{{UserID: "other", Percent: 50}}
+		if _, err := r.Memory.Put(ctx, tenant, store.Ranking{CohortID: "new", Items: items, Results: rank.RankByPercent(items)}, 0); err != nil {
+			return got, err
+		}
+	}
+	return got, err
+}
+
+func TestConsumeScoresCreateRace(t *testing.T) {
+	st := &racedStore{Memory: store.NewMemory()}
+	srv := NewServer(st, nil)
+	err := srv.ConsumeScores(context.Background(), []kafka.Message{
+		{Value: []byte(`{"cohort_id":"new","user_id":"x","percent":40}`), Time: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The other replica's cohort is kept, with the event applied on top.
+	got, err := st.Get(context.Background(), tenant.Default, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := userIDs(toResponse("new", got.Results, srv.Defaults).Results); !slices.Equal(ids, []string{"other", "x"}) || got.Version != 2 {
+		t.Errorf("new is %v at version %d", ids, got.Version)
+	}
+}
+
+func TestConsumeScores(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80}]}`, nil)
+
+	at := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	msgs := []kafka.Message{
+		{Value: []byte(`{"cohort_id":"c1","user_id":"c","percent":85}`), Time: at},
+		{Value: []byte(`{"cohort_id":"new","user_id":"x","percent":40}`), Time: at},
+		{Value: []byte(`not json`), Time: at},
+		{Value: []byte(`{"cohort_id":"c1","user_id":"","percent":85}`), Time: at},
+		{Value: []byte(`{"cohort_id":"c1","user_id":"a","percent":70}`), Time: at},
+		{Value: []byte(`{"tenant":"other","cohort_id":"new","user_id":"y","percent":50}`), Time: at},
+		{Value: []byte(`{"cohort_id":"new","user_id":"z","percent":60}`), Time: at},
+	}
+	for replay := 0; replay < 2; replay++ {
+		if err := srv.ConsumeScores(context.Background(), msgs); err != nil {
+			t.Fatal(err)
+		}
+		// Both c1 events land in one write, on top of the stored cohort;
+		// replayed, they are stale and nothing is written.
+		got := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/c1", "", nil))
+		if ids := userIDs(got.Results); !slices.Equal(ids, []string{"c", "b", "a"}) || got.Version != 2 {
+			t.Errorf("replay %d: c1 is %v at version %d", replay, ids, got.Version)
+		}
+		// An unknown cohort is created, per tenant.
+		got = decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/new", "", nil))
+		if ids := userIDs(got.Results); !slices.Equal(ids, []string{"z", "x"}) {
+			t.Errorf("replay %d: new is %v", replay, ids)
+		}
+		got = decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/new", "", map[string]string{"X-Tenant": "other"}))
+		if ids := userIDs(got.Results); !slices.Equal(ids, []string{"y"}) {
+			t.Errorf("replay %d: other tenant's new is %v", replay, ids)
+		}
+	}
+
+	// A user's events apply in submission order, whatever order they
+	// come in, and a score update is newer than an event submitted before
+	// it.
+	err := srv.ConsumeScores(context.Background(), []kafka.Message{
+		{Value: []byte(`{"cohort_id":"c1","user_id":"a","percent":99,"submitted_at":"2026-03-01T00:00:02Z"}`)},
+		{Value: []byte(`{"cohort_id":"c1","user_id":"a","percent":10,"submitted_at":"2026-03-01T00:00:01Z"}`)},
+		{Value: []byte(`{"cohort_id":"c1","user_id":"b","percent":5}`), Time: at.Add(-time.Second)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"c","percent":1}`, nil)
+	err = srv.ConsumeScores(context.Background(), []kafka.Message{
+		{Value: []byte(`{"cohort_id":"c1","user_id":"c","percent":100,"submitted_at":"2026-03-01T00:00:03Z"}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/c1", "", nil))
+	if ids := userIDs(got.Results); !slices.Equal(ids, []string{"a", "b", "c"}) || got.Version != 4 {
+		t.Errorf("out of order: c1 is %v at version %d", ids, got.Version)
+	}
+}
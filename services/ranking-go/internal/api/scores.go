@@ -0,0 +1,254 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ranking-go/internal/rank"
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+)
+
+type scoreRequest struct {
+	UserID  string   `json:"user_id"`
+	Percent *float64 `json:"percent"`
+}
+
+type scoreResponse struct {
+	CohortID   string `json:"cohort_id"`
+	Version    int64  `json:"version"`
+	CohortSize int    `json:"cohort_size"`
+	rankResult
+	// Changed lists the other users whose rank moved, best first by new
+	// rank.
+	Changed            []rankChange `json:"changed"`
+	PercentileEncoding string       `json:"percentile_encoding,omitempty"`
+	PercentileDivisor  int          `json:"percentile_divisor,omitempty"`
+}
+
+type rankChange struct {
+	UserID  string `json:"user_id"`
+	OldRank int    `json:"old_rank"`
+	NewRank int    `json:"new_rank"`
+}
+
+// maxScoreBoards bounds the boards kept for score updates; past it the
+// cache starts over.
+const maxScoreBoards = 1000
+
+// scoreBoards keeps a rank.Board of each cohort taking score updates, so
+// an update finds the user's new place in O(log n) and writes only the
+// score (see store.Store.PutScore) instead of re-ranking and rewriting
+// the whole cohort. Each board is tagged with the version it reflects; an
+// update that finds the store has moved on reloads it.
+type scoreBoards struct {
+	mu sync.Mutex
+	m  map[streamKey]*scoreBoard
+}
+
+type scoreBoard struct {
+	// mu is held across an update, from placing the user to moving them
+	// once the score is written, so the board never runs ahead of the
+	// store and the cohort's events go out in version order.
+	mu      sync.Mutex
+	board   *rank.Board // nil until loaded
+	opts    rank.Options
+	version int64
+}
+
+// get returns key's board, loaded or not.
+func (c *scoreBoards) get(key streamKey) *scoreBoard {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil || len(c.m) >= maxScoreBoards {
+		c.m = map[streamKey]*scoreBoard{}
+	}
+	b := c.m[key]
+	if b == nil {
+		b = &scoreBoard{}
+		c.m[key] = b
+	}
+	return b
+}
+
+// scoreHandler records one user's new percent in a stored cohort (adding
+// the user if new). Under incremental options (see
+// rank.Options.Incremental) the user is placed on the cohort's board and
+// only the score is written; other cohorts are re-ranked and stored in
+// full (see rank.UpdateScore). The write is conditional on the version
+// the board or read reflects, so concurrent submissions never overwrite
+// each other: a board found out of date is reloaded and the update tried
+// once more, and a loser after that gets 409 and can simply resubmit.
+func (s *Server) scoreHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	var req scoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, "json", err)
+		return
+	}
+	ve := &validationError{}
+	if strings.TrimSpace(req.UserID) == "" {
+		ve.add("user_id", codeEmptyUserID, "must not be empty")
+	}
+	if req.Percent == nil {
+		ve.add("percent", codeMissingField, "is required")
+	} else {
+		s.checkPercent(ve, "percent", *req.Percent)
+	}
+	if err := ve.orNil(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	key := streamKey{t.ID, r.PathValue("cohort_id")}
+	sb := s.scoreBoards.get(key)
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	for reloaded := false; ; reloaded = true {
+		if sb.board == nil || reloaded {
+			cur, err := s.Store.Get(r.Context(), t.ID, key.cohort)
+			if err != nil {
+				sb.board = nil
+				writeStoreError(w, r, err)
+				return
+			}
+			if !cur.Options.Incremental() {
+				sb.board = nil
+				s.rerankScore(w, r, t, cur, req)
+				return
+			}
+			sb.board, sb.opts, sb.version = rank.NewBoard(cur.Results), cur.Options, cur.Version
+		}
+		err := s.boardScore(w, r, t, key, sb, req)
+		if errors.Is(err, store.ErrVersionConflict) && !reloaded {
+			continue
+		}
+		if err != nil {
+			sb.board = nil
+			writeStoreError(w, r, err)
+		}
+		return
+	}
+}
+
+// boardScore records req against sb's loaded board: it places the user,
+// writes the score, then moves the user on the board and reports who
+// moved, walking only the ranks between the user's old and new place. A
+// store error is returned unwritten.
+func (s *Server) boardScore(w http.ResponseWriter, r *http.Request, t *tenant.Tenant, key streamKey, sb *scoreBoard, req scoreRequest) error {
+	b, pct := sb.board, *req.Percent
+	from, to := b.Place(req.UserID, pct)
+	if limit, tooMany := s.itemLimit(t); limit > 0 && from < 0 && b.Len() >= limit {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codeTooManyItems, tooMany.Error())
+		return nil
+	}
+	span := s.startRankSpan(r.Context(), b.Len())
+	start := time.Now()
+	v, err := s.Store.PutScore(r.Context(), t.ID, key.cohort, rank.Score{UserID: req.UserID, Percent: pct}, time.Now().UTC(), sb.version)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return err
+	}
+	b.Set(req.UserID, pct)
+	sb.version = v
+	n := b.Len()
+	s.metrics.observeRank(n, time.Since(start))
+
+	// Everyone between the user's old and new place shifts by one: down
+	// if the user rose past them or is new, up if the user fell.
+	lo, hi, shift := to, n, -1
+	switch {
+	case from > to:
+		hi = from + 1
+	case from >= 0 && from < to:
+		lo, hi, shift = from, to+1, 1
+	case from == to:
+		hi = lo
+	}
+	base := s.Defaults.rankBase()
+	out := scoreResponse{CohortID: key.cohort, Version: v, CohortSize: n, Changed: []rankChange{}}
+	var moves []streamChange
+	b.Walk(lo, hi, func(i int, userID string, _ float64) {
+		if userID == req.UserID {
+			move := streamChange{UserID: userID, NewRank: rebase(i+1, base)}
+			if from >= 0 {
+				old := rebase(from+1, base)
+				move.OldRank = &old
+			}
+			moves = append(moves, move)
+			return
+		}
+		old := rebase(i+1+shift, base)
+		out.Changed = append(out.Changed, rankChange{UserID: userID, OldRank: old, NewRank: rebase(i+1, base)})
+		moves = append(moves, streamChange{UserID: userID, OldRank: &old, NewRank: rebase(i+1, base)})
+	})
+	s.publishMoves(t.ID, key.cohort, v, n, moves)
+
+	mean, sd := b.Moments().MeanSD()
+	row := s.rowsOf(key.cohort, sb.opts.Quantile, []rank.Result{sb.opts.ResultAt(req.UserID, pct, to, n, mean, sd)})
+	out.rankResult = row.Results[0]
+	out.PercentileEncoding, out.PercentileDivisor = row.PercentileEncoding, row.PercentileDivisor
+	writeJSON(w, withCase(out, s.Defaults.FieldCase))
+	return nil
+}
+
+// rerankScore records req in cur, a cohort whose options need a full
+// re-rank, and stores it whole.
+func (s *Server) rerankScore(w http.ResponseWriter, r *http.Request, t *tenant.Tenant, cur store.Ranking, req scoreRequest) {
+	if limit, tooMany := s.itemLimit(t); limit > 0 && len(cur.Items) >= limit && userIndex(cur.Results, req.UserID) < 0 {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codeTooManyItems, tooMany.Error())
+		return
+	}
+
+	opts := cur.Options
+	opts.ExternalSort = s.ExternalSort
+	span := s.startRankSpan(r.Context(), len(cur.Items))
+	start := time.Now()
+	items, results, err := rank.UpdateScores(cur.Items, cur.Results, opts, []rank.Score{{UserID: req.UserID, Percent: *req.Percent, Submitted: start.UnixNano()}})
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidOptions, err.Error())
+		return
+	}
+	s.metrics.observeRank(len(items), time.Since(start))
+	v, err := s.Store.Put(r.Context(), t.ID, store.Ranking{
+		CohortID: cur.CohortID,
+		Items:    items,
+		Options:  cur.Options,
+		Results:  results,
+		RankedAt: time.Now().UTC(),
+	}, cur.Version)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	s.publishRankChanges(t.ID, cur.CohortID, v, cur.Results, results)
+
+	old := make(map[string]int, len(cur.Results))
+	for _, res := range cur.Results {
+		old[res.UserID] = res.Rank
+	}
+	base := s.Defaults.rankBase()
+	out := scoreResponse{CohortID: cur.CohortID, Version: v, CohortSize: len(results), Changed: []rankChange{}}
+	for i, res := range results {
+		if res.UserID == req.UserID {
+			row := s.rowsOf(cur.CohortID, opts.Quantile, results[i:i+1])
+			out.rankResult = row.Results[0]
+			out.PercentileEncoding, out.PercentileDivisor = row.PercentileEncoding, row.PercentileDivisor
+			continue
+		}
+		if prev := old[res.UserID]; prev != res.Rank {
+			out.Changed = append(out.Changed, rankChange{UserID: res.UserID, OldRank: rebase(prev, base), NewRank: rebase(res.Rank, base)})
+		}
+	}
+	writeJSON(w, withCase(out, s.Defaults.FieldCase))
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestScoreUpdate(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":70},{"user_id":"d","percent":60}]}`, nil)
+
+	// d jumps from 4th to 2nd; b and c each drop one place, a is unmoved.
+	resp := do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"d","percent":85}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[scoreResponse](t, resp)
+	if got.UserID != "d" || got.Rank != 2 || got.Version != 2 || got.CohortSize != 4 {
+		t.Errorf("got %+v", got)
+	}
+	want := []rankChange{{"b", 2, 3}, {"c", 3, 4}}
+	if len(got.Changed) != len(want) {
+		t.Fatalf("changed %+v, want %+v", got.Changed, want)
+	}
+	for i := range want {
+		if got.Changed[i] != want[i] {
+			t.Errorf("changed[%d] = %+v, want %+v", i, got.Changed[i], want[i])
+		}
+	}
+
+	// The stored cohort matches a full re-rank.
+	stored := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/c1", "", nil))
+	full := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":70},{"user_id":"d","percent":85}]}`, nil))
+	for i := range full.Results {
+		if s, f := stored.Results[i], full.Results[i]; s.UserID != f.UserID || s.Rank != f.Rank || *s.Percentile != *f.Percentile {
+			t.Errorf("row %d: stored %+v, full %+v", i, s, f)
+		}
+	}
+
+	// A new user is added at the bottom; nobody else moves.
+	got = decode[scoreResponse](t, do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"e","percent":10}`, nil))
+	if got.Rank != 5 || got.CohortSize != 5 || len(got.Changed) != 0 {
+		t.Errorf("new user: %+v", got)
+	}
+
+	for body, status := range map[string]int{
+		`{"user_id":"a"}`:  http.StatusBadRequest,
+		`{"percent":50}`:   http.StatusBadRequest,
+		`{"user_id":"a",}`: http.StatusBadRequest,
+	} {
+		if resp := do(t, "POST", ts.URL+"/rank/c1/scores", body, nil); resp.StatusCode != status {
+			t.Errorf("%s: status %d, want %d", body, resp.StatusCode, status)
+		}
+	}
+	if resp := do(t, "POST", ts.URL+"/rank/nope/scores", `{"user_id":"a","percent":1}`, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown cohort: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestScoreUpdateBoard(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":70}]}`, nil)
+	do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"c","percent":75}`, nil)
+
+	// a falls from 1st to 3rd; b and c each rise one place.
+	got := decode[scoreResponse](t, do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"a","percent":60}`, nil))
+	want := []rankChange{{"b", 2, 1}, {"c", 3, 2}}
+	if got.Rank != 3 || got.Version != 3 || !slices.Equal(got.Changed, want) {
+		t.Errorf("fall: %+v, want rank 3 and changes %+v", got, want)
+	}
+
+	// Overwriting the cohort leaves the handler's board stale; the next
+	// score reloads it rather than conflicting.
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"x","percent":50},{"user_id":"y","percent":40}]}`, nil)
+	resp := do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"y","percent":55}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("after overwrite: status %d", resp.StatusCode)
+	}
+	got = decode[scoreResponse](t, resp)
+	if got.Rank != 1 || got.CohortSize != 2 || got.Version != 5 || !slices.Equal(got.Changed, []rankChange{{"x", 1, 2}}) {
+		t.Errorf("after overwrite: %+v", got)
+	}
+
+	// Scores read back the same as a full re-rank.
+	stored := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/c1", "", nil))
+	full := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"x","percent":50},{"user_id":"y","percent":55}]}`, nil))
+	for i := range full.Results {
+		if s, f := stored.Results[i], full.Results[i]; s.UserID != f.UserID || s.Rank != f.Rank || *s.Percentile != *f.Percentile {
+			t.Errorf("row %d: stored %+v, full %+v", i, s, f)
+		}
+	}
+}
+
+func TestScoreUpdateRerank(t *testing.T) {
+	ts := newTestServer(t, nil)
+	// Dense ranks are not incremental, so the cohort is re-ranked whole.
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","strategy":"dense","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":70}]}`, nil)
+	got := decode[scoreResponse](t, do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"c","percent":90}`, nil))
+	if got.Rank != 1 || got.Version != 2 || !slices.Equal(got.Changed, []rankChange{}) {
+		t.Errorf("dense: %+v", got)
+	}
+	stored := decode[rankResponse](t, do(t, "GET", ts.URL+"/rank/c1", "", nil))
+	if r := stored.Results[2]; r.UserID != "b" || r.Rank != 2 {
+		t.Errorf("dense: stored %+v", stored.Results)
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"ranking-go/internal/rank"
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+)
+
+// The service layer is what POST /rank, GET /leaderboard/{cohort_id} and
+// GET /rank/{cohort_id}/users/{user_id} do once their request is read,
+// shared by the HTTP handlers and the gRPC server. Its failures are
+// *serviceErrors, *validationErrors or store errors; problemFor says how
+// each is answered.
+
+// serviceError is a failure with the status and code it is answered with.
+type serviceError struct {
+	status int
+	code   string
+	err    error
+}
+
+func (e *serviceError) Error() string { return e.err.Error() }
+func (e *serviceError) Unwrap() error { return e.err }
+
+// invalidOptions is a 400 for err, which names the bad option or item,
+// unless it is already a validationError with its fields.
+func invalidOptions(err error) error {
+	var ve *validationError
+	if errors.As(err, &ve) {
+		return err
+	}
+	return &serviceError{http.StatusBadRequest, codeInvalidOptions, err}
+}
+
+var errLeaderboardLimit = &serviceError{http.StatusBadRequest, codeInvalidRequest, fmt.Errorf("limit must be an integer in [1, %d]", maxLeaderboardLimit)}
+
+// problemFor is the problem err is answered with.
+func problemFor(err error) problem {
+	var se *serviceError
+	var ve *validationError
+	switch {
+	case errors.As(err, &se):
+		return problem{Status: se.status, Code: se.code, Detail: se.err.Error()}
+	case errors.As(err, &ve):
+		return validationProblem(ve)
+	case errors.Is(err, store.ErrNotFound):
+		return problem{Status: http.StatusNotFound, Code: codeCohortNotFound, Detail: err.Error()}
+	case errors.Is(err, store.ErrVersionConflict):
+		return problem{Status: http.StatusConflict, Code: codeVersionConflict, Detail: err.Error()}
+	}
+	return problem{Status: http.StatusInternalServerError, Code: codeStoreError, Detail: "store: " + err.Error()}
+}
+
+// writeError answers a service-layer failure.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	sendProblem(w, r, problemFor(err))
+}
+
+// checkRankRequest enforces t's item limit on a decoded /rank request,
+// validates its items, applies the duplicates policy and splits out
+// subjects.
+func (s *Server) checkRankRequest(t *tenant.Tenant, req *rankRequest) error {
+	if limit, tooMany := s.itemLimit(t); limit > 0 && len(req.Items) > limit {
+		return &serviceError{http.StatusRequestEntityTooLarge, codeTooManyItems, tooMany}
+	}
+	if err := s.validateItems("items", req.Items); err != nil {
+		return invalidOptions(err)
+	}
+	items, dropped, err := dedupeItems("items", req.Items, req.Duplicates)
+	if err != nil {
+		return invalidOptions(err)
+	}
+	overall, subjects, err := splitSubjects("items", items)
+	if err != nil {
+		return invalidOptions(err)
+	}
+	req.Items, req.dropped, req.subjects = overall, dropped, subjects
+	return nil
+}
+
+// rankChecked ranks a checked /rank request, and each of its subjects.
+func (s *Server) rankChecked(ctx context.Context, req rankRequest) (rankResponse, []rank.Result, error) {
+	results, err := s.rankItems(ctx, req.Items, req.rankOptions)
+	if err != nil {
+		return rankResponse{}, nil, &serviceError{http.StatusBadRequest, codeInvalidOptions, err}
+	}
+	resp := toResponse(req.CohortID, results, req.rankOptions)
+	resp.DuplicatesDropped = req.dropped
+	if len(req.subjects) > 0 {
+		if resp.Subjects, err = s.rankSubjects(ctx, req.CohortID, req.subjects, req.rankOptions); err != nil {
+			return rankResponse{}, nil, &serviceError{http.StatusBadRequest, codeInvalidOptions, err}
+		}
+	}
+	return resp, results, nil
+}
+
+// storeRanked stores the results of req under its cohort, and sets resp's
+// version and rank changes.
+func (s *Server) storeRanked(ctx context.Context, tenantID string, req rankRequest, results []rank.Result, resp *rankResponse) error {
+	v, err := s.storeRanking(ctx, tenantID, req.CohortID, req.Items, req.rankOptions, results, 0)
+	if err != nil {
+		return &serviceError{http.StatusInternalServerError, codeStoreError, fmt.Errorf("store: %w", err)}
+	}
+	resp.Version = v
+	s.addChanges(ctx, tenantID, resp, results, req.rankOptions)
+	return nil
+}
+
+// leaderboardPage reads limit rows of a stored ranking, best first, from
+// cursor or the top, reading only the page where the store can (see
+// readPage). The page read is returned too, for its ETag.
+func (s *Server) leaderboardPage(ctx context.Context, tenantID, cohortID string, limit int, cursor string) (store.Page, leaderboardResponse, error) {
+	if limit < 1 || limit > maxLeaderboardLimit {
+		return store.Page{}, leaderboardResponse{}, errLeaderboardLimit
+	}
+	// The page to read comes from the cursor, but the cursor can only be
+	// checked against the version read with it.
+	off := 0
+	if cursor != "" {
+		if _, o, err := parseCursor(cursor); err == nil && o > 0 {
+			off = o
+		}
+	}
+	p, err := s.readPage(ctx, tenantID, cohortID, off, off+limit)
+	if err != nil {
+		return p, leaderboardResponse{}, err
+	}
+	if cursor != "" {
+		if _, err = decodeCursor(cursor, p.Version, p.Size); err != nil {
+			status, code := http.StatusBadRequest, codeInvalidRequest
+			if errors.Is(err, errStaleCursor) {
+				status, code = http.StatusGone, codeStaleCursor
+			}
+			return p, leaderboardResponse{}, &serviceError{status, code, err}
+		}
+	}
+	end := p.Offset + len(p.Results)
+	page := s.rowsOf(p.CohortID, p.Options.Quantile, p.Results)
+	out := leaderboardResponse{
+		CohortID:           p.CohortID,
+		Version:            p.Version,
+		CohortSize:         p.Size,
+		Results:            page.Results,
+		PercentileEncoding: page.PercentileEncoding,
+		PercentileDivisor:  page.PercentileDivisor,
+	}
+	if end < p.Size {
+		out.NextCursor = encodeCursor(p.Version, end)
+	}
+	return p, out, nil
+}
+
+// userRank reads one user's row of a stored cohort, and the page it is
+// on, for its ETag.
+func (s *Server) userRank(ctx context.Context, tenantID, cohortID, userID string) (store.Page, userRankResponse, error) {
+	p, err := s.readPageAround(ctx, tenantID, cohortID, userID, 0)
+	if errors.Is(err, store.ErrUserNotFound) {
+		return p, userRankResponse{}, &serviceError{http.StatusNotFound, codeUserNotFound, errors.New("user not in cohort")}
+	}
+	if err != nil {
+		return p, userRankResponse{}, err
+	}
+	resp := s.rowsOf(p.CohortID, p.Options.Quantile, p.Results)
+	return p, userRankResponse{
+		CohortID:           p.CohortID,
+		Version:            p.Version,
+		CohortSize:         p.Items,
+		rankResult:         resp.Results[0],
+		PercentileEncoding: resp.PercentileEncoding,
+		PercentileDivisor:  resp.PercentileDivisor,
+	}, nil
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ranking-go/internal/rank"
+)
+
+const (
+	defaultHistogramBins = 10
+	maxHistogramBins     = 100
+)
+
+type statsResponse struct {
+	CohortID string `json:"cohort_id"`
+	Version  int64  `json:"version"`
+	rankSummary
+	Histogram []histogramBin `json:"histogram"`
+}
+
+// histogramBin counts the percents in [Min, Max); the last bin includes
+// its Max.
+type histogramBin struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// statsHandler describes a stored cohort's distribution of raw percents:
+// the include_summary statistics plus a histogram for charting. ?bins=N
+// splits Limits.MinPercent..MaxPercent into N equal bins (10 by default);
+// ?edges=0,50,80,100 gives the bin edges instead.
+func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	edges, err := s.histogramEdges(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	stored, err := s.Store.Get(r.Context(), t.ID, r.PathValue("cohort_id"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	if s.notModified(w, r, t.ID, stored) {
+		return
+	}
+
+	sm := rank.SummaryOf(stored.Results)
+	out := statsResponse{
+		CohortID: stored.CohortID,
+		Version:  stored.Version,
+		rankSummary: rankSummary{
+			Count: sm.Count, Mean: sm.Mean, SD: sm.SD, Min: sm.Min, Max: sm.Max, Median: sm.Median,
+			Modality: rankModality{Modes: len(sm.Modes), Locations: append([]float64{}, sm.Modes...)},
+		},
+		Histogram: make([]histogramBin, len(edges)-1),
+	}
+	for i, n := range rank.Histogram(stored.Results, edges) {
+		out.Histogram[i] = histogramBin{Min: edges[i], Max: edges[i+1], Count: n}
+	}
+	writeJSON(w, withCase(out, s.Defaults.FieldCase))
+}
+
+// histogramEdges reads ?bins or ?edges; at most one may be set.
+func (s *Server) histogramEdges(r *http.Request) ([]float64, error) {
+	ve := &validationError{}
+	q := r.URL.Query()
+	if q.Has("bins") && q.Has("edges") {
+		ve.add("edges", codeInvalidRequest, "cannot be combined with bins")
+		return nil, ve
+	}
+	if v := q.Get("edges"); v != "" {
+		parts := strings.Split(v, ",")
+		if len(parts) < 2 || len(parts) > maxHistogramBins+1 {
+			ve.add("edges", codeInvalidRequest, "must list 2 to %d numbers", maxHistogramBins+1)
+			return nil, ve
+		}
+		edges := make([]float64, len(parts))
+		prev := math.Inf(-1)
+		for i, p := range parts {
+			x, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			switch {
+			case err != nil || !finite(x):
+				ve.add(fmt.Sprintf("edges[%d]", i), codeInvalidNumber, "must be a finite number, got %q", p)
+				continue
+			case x <= prev:
+				ve.add(fmt.Sprintf("edges[%d]", i), codeInvalidRequest, "must be greater than %v", prev)
+			}
+			edges[i], prev = x, x
+		}
+		return edges, ve.orNil()
+	}
+
+	bins := defaultHistogramBins
+	if v := q.Get("bins"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistogramBins {
+			ve.add("bins", codeInvalidRequest, "must be an integer in [1, %d]", maxHistogramBins)
+			return nil, ve
+		}
+		bins = n
+	}
+	lo, hi := s.Limits.MinPercent, s.Limits.MaxPercent
+	edges := make([]float64, bins+1)
+	for i := range edges {
+		edges[i] = lo + (hi-lo)*float64(i)/float64(bins)
+	}
+	return edges, nil
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCohortStats(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[
+		{"user_id":"a","percent":92},{"user_id":"b","percent":85},{"user_id":"c","percent":40},{"user_id":"d","percent":71}
+	]}`, nil).Body.Close()
+
+	resp := do(t, "GET", ts.URL+"/cohorts/c1/stats?bins=4", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[statsResponse](t, resp)
+	if got.Count != 4 || got.Mean != 72 || got.Median != 78 || got.Min != 40 || got.Max != 92 || got.Version != 1 {
+		t.Errorf("summary %+v", got.rankSummary)
+	}
+	want := []histogramBin{{0, 25, 0}, {25, 50, 1}, {50, 75, 1}, {75, 100, 2}}
+	if len(got.Histogram) != len(want) {
+		t.Fatalf("histogram %+v", got.Histogram)
+	}
+	for i := range want {
+		if got.Histogram[i] != want[i] {
+			t.Errorf("bin %d = %+v, want %+v", i, got.Histogram[i], want[i])
+		}
+	}
+
+	got = decode[statsResponse](t, do(t, "GET", ts.URL+"/cohorts/c1/stats?edges=0,80,90,100", "", nil))
+	if len(got.Histogram) != 3 || got.Histogram[0].Count != 2 || got.Histogram[1].Count != 1 || got.Histogram[2].Count != 1 {
+		t.Errorf("edges: %+v", got.Histogram)
+	}
+	if got := decode[statsResponse](t, do(t, "GET", ts.URL+"/cohorts/c1/stats", "", nil)); len(got.Histogram) != defaultHistogramBins {
+		t.Errorf("default bins: %d", len(got.Histogram))
+	}
+
+	for url, want := range map[string]string{
+		"/cohorts/c1/stats?bins=0":           codeInvalidRequest,
+		"/cohorts/c1/stats?edges=0,x":        codeInvalidNumber,
+		"/cohorts/c1/stats?edges=50,10":      codeInvalidRequest,
+		"/cohorts/c1/stats?bins=2&edges=0,1": codeInvalidRequest,
+		"/cohorts/none/stats":                codeCohortNotFound,
+	} {
+		if p := decode[problem](t, do(t, "GET", ts.URL+url, "", nil)); p.Code != want {
+			t.Errorf("%s: code %s, want %s", url, p.Code, want)
+		}
+	}
+}
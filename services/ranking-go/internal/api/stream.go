@@ -0,0 +1,280 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"ranking-go/internal/rank"
+)
+
+// streamBuffer is how many events a stream may fall behind before it is
+// dropped; the client reconnects and refetches.
+const streamBuffer = 64
+
+// streamKeepalive is how often an idle stream writes a comment, so proxies
+// don't close it.
+const streamKeepalive = 15 * time.Second
+
+// streamEvent is one server-sent event, encoded once for every stream.
+type streamEvent struct {
+	name string
+	id   int64
+	data []byte
+}
+
+type streamKey struct{ tenant, cohort string }
+
+// streamHub fans cohort events out to the streams subscribed to them. It
+// is in-process: a stream sees the updates made through its own replica.
+type streamHub struct {
+	mu     sync.Mutex
+	subs   map[streamKey]map[chan streamEvent]bool
+	closed bool
+}
+
+// subscribe returns the channel key's events arrive on and a func to stop
+// them. The channel is closed when the stream falls behind or the hub
+// closes.
+func (h *streamHub) subscribe(key streamKey) (<-chan streamEvent, func()) {
+	ch := make(chan streamEvent, streamBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subs == nil {
+		h.subs = map[streamKey]map[chan streamEvent]bool{}
+	}
+	if h.subs[key] == nil {
+		h.subs[key] = map[chan streamEvent]bool{}
+	}
+	h.subs[key][ch] = true
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.drop(key, ch)
+	}
+}
+
+// drop closes ch unless it is already gone. h.mu must be held.
+func (h *streamHub) drop(key streamKey, ch chan streamEvent) {
+	if !h.subs[key][ch] {
+		return
+	}
+	delete(h.subs[key], ch)
+	if len(h.subs[key]) == 0 {
+		delete(h.subs, key)
+	}
+	close(ch)
+}
+
+// publish sends ev to key's streams without waiting on any of them.
+func (h *streamHub) publish(key streamKey, ev streamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[key] {
+		select {
+		case ch <- ev:
+		default:
+			h.drop(key, ch)
+		}
+	}
+}
+
+// subscribed reports whether key has any streams, so publishers can skip
+// building events nobody reads.
+func (h *streamHub) subscribed(key streamKey) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs[key]) > 0
+}
+
+// close ends every stream, now and later.
+func (h *streamHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, chs := range h.subs {
+		for ch := range chs {
+			h.drop(key, ch)
+		}
+	}
+	h.closed = true
+}
+
+// CloseStreams ends every open GET /rank/{cohort_id}/stream and live
+// leaderboard. Register it with http.Server.RegisterOnShutdown, since
+// Shutdown waits for handlers and streams never finish on their own.
+func (s *Server) CloseStreams() {
+	s.streams.close()
+}
+
+type streamReady struct {
+	CohortID   string `json:"cohort_id"`
+	Version    int64  `json:"version"`
+	CohortSize int    `json:"cohort_size"`
+}
+
+type streamRankChange struct {
+	CohortID   string `json:"cohort_id"`
+	Version    int64  `json:"version"`
+	CohortSize int    `json:"cohort_size"`
+	// Changed lists every user whose rank moved, best first by new rank.
+	Changed []streamChange `json:"changed"`
+	Removed []string       `json:"removed,omitempty"`
+}
+
+// streamChange is a user's move; OldRank is null for a user new to the
+// cohort.
+type streamChange struct {
+	UserID  string `json:"user_id"`
+	OldRank *int   `json:"old_rank"`
+	NewRank int    `json:"new_rank"`
+}
+
+type streamReranked struct {
+	CohortID string `json:"cohort_id"`
+	Version  int64  `json:"version"`
+}
+
+// event encodes v as a streamEvent in the configured field case.
+func (s *Server) event(name string, version int64, v any) streamEvent {
+	data, _ := json.Marshal(withCase(v, s.Defaults.FieldCase))
+	return streamEvent{name: name, id: version, data: data}
+}
+
+// publishRankChanges retires the cohort's cached responses and sends a
+// rank_change event for an incremental update from prev to results, if
+// any rank moved.
+func (s *Server) publishRankChanges(tenantID, cohortID string, version int64, prev, results []rank.Result) {
+	s.invalidateCache(tenantID, cohortID)
+	key := streamKey{tenantID, cohortID}
+	if !s.streams.subscribed(key) {
+		return
+	}
+	old := make(map[string]int, len(prev))
+	for _, res := range prev {
+		old[res.UserID] = res.Rank
+	}
+	base := s.Defaults.rankBase()
+	ev := streamRankChange{CohortID: cohortID, Version: version, CohortSize: len(results), Changed: []streamChange{}}
+	for _, res := range results {
+		prevRank, ok := old[res.UserID]
+		delete(old, res.UserID)
+		switch {
+		case !ok:
+			ev.Changed = append(ev.Changed, streamChange{UserID: res.UserID, NewRank: rebase(res.Rank, base)})
+		case prevRank != res.Rank:
+			o := rebase(prevRank, base)
+			ev.Changed = append(ev.Changed, streamChange{UserID: res.UserID, OldRank: &o, NewRank: rebase(res.Rank, base)})
+		}
+	}
+	for _, res := range prev {
+		if _, gone := old[res.UserID]; gone {
+			ev.Removed = append(ev.Removed, res.UserID)
+		}
+	}
+	if len(ev.Changed) == 0 && len(ev.Removed) == 0 {
+		return
+	}
+	s.streams.publish(key, s.event("rank_change", version, ev))
+}
+
+// publishMoves is publishRankChanges for an update that already knows
+// who moved.
+func (s *Server) publishMoves(tenantID, cohortID string, version int64, size int, changed []streamChange) {
+	s.invalidateCache(tenantID, cohortID)
+	key := streamKey{tenantID, cohortID}
+	if len(changed) > 0 && s.streams.subscribed(key) {
+		s.streams.publish(key, s.event("rank_change", version, streamRankChange{CohortID: cohortID, Version: version, CohortSize: size, Changed: changed}))
+	}
+}
+
+// publishReranked retires the cohort's cached responses and tells streams
+// it was ranked afresh, so they refetch it.
+func (s *Server) publishReranked(tenantID, cohortID string, version int64) {
+	s.invalidateCache(tenantID, cohortID)
+	key := streamKey{tenantID, cohortID}
+	if s.streams.subscribed(key) {
+		s.streams.publish(key, s.event("reranked", version, streamReranked{CohortID: cohortID, Version: version}))
+	}
+}
+
+// streamHandler is GET /rank/{cohort_id}/stream: a text/event-stream that
+// opens with a "ready" event carrying the stored version, then sends
+// "rank_change" whenever a score update or PATCH moves anyone's rank and
+// "reranked" when the cohort is ranked afresh or an update's event comes
+// after a later one's. Each event's id is the version it describes. A
+// stream that falls streamBuffer events behind is closed; the client
+// reconnects and compares versions.
+func (s *Server) streamHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	cohortID := r.PathValue("cohort_id")
+	key := streamKey{t.ID, cohortID}
+	// Subscribe before reading the cohort, so no update falls between the
+	// ready event and the first change.
+	events, cancel := s.streams.subscribe(key)
+	defer cancel()
+	stored, err := s.Store.Get(r.Context(), t.ID, cohortID)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The server's write timeout is meant for ordinary responses.
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	send := func(ev streamEvent) error {
+		if _, err := fmt.Fprintf(w, "event: %s\nid: %d\ndata: %s\n\n", ev.name, ev.id, ev.data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	if send(s.event("ready", stored.Version, streamReady{CohortID: cohortID, Version: stored.Version, CohortSize: len(stored.Results)})) != nil {
+		return
+	}
+
+	// The ready event covers every version up to its own. Concurrent
+	// updates may publish out of order, though, and an update's moves
+	// arriving after a later one's no longer apply on top of what was
+	// sent: the stream sends "reranked" at the later version instead, so
+	// the client refetches.
+	base, last := stored.Version, stored.Version
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			switch {
+			case ev.id <= base:
+				continue
+			case ev.id <= last:
+				ev = s.event("reranked", last, streamReranked{CohortID: cohortID, Version: last})
+			default:
+				last = ev.id
+			}
+			if send(ev) != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil || rc.Flush() != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
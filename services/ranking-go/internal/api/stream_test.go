@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+)
+
+// sseEvent is one event read off a stream.
+type sseEvent struct {
+	name, id string
+	data     []byte
+}
+
+func readEvent(t *testing.T, r *bufio.Reader) (sseEvent, bool) {
+	t.Helper()
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return ev, false
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && ev.name != "":
+			return ev, true
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = []byte(strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+func TestStreamRankChanges(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80},{"user_id":"c","percent":70}]}`, nil)
+
+	if resp := do(t, "GET", ts.URL+"/rank/missing/stream", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing cohort: status %d, want 404", resp.StatusCode)
+	}
+
+	resp := do(t, "GET", ts.URL+"/rank/c1/stream", "", nil)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+	events := bufio.NewReader(resp.Body)
+	ev, ok := readEvent(t, events)
+	if !ok || ev.name != "ready" || ev.id != "1" {
+		t.Fatalf("first event %q id %q", ev.name, ev.id)
+	}
+
+	// A score that moves nobody sends nothing; the next one moves c to
+	// the top and a and b down one.
+	do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"c","percent":75}`, nil)
+	do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"c","percent":95}`, nil)
+	ev, ok = readEvent(t, events)
+	if !ok || ev.name != "rank_change" || ev.id != "3" {
+		t.Fatalf("got event %q id %q, want rank_change 3", ev.name, ev.id)
+	}
+	var change streamRankChange
+	if err := json.Unmarshal(ev.data, &change); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, len(change.Changed))
+	for i, c := range change.Changed {
+		got[i] = c.UserID
+		if c.OldRank == nil || *c.OldRank == c.NewRank {
+			t.Errorf("change %+v", c)
+		}
+	}
+	if change.Version != 3 || strings.Join(got, ",") != "c,a,b" {
+		t.Errorf("got %+v", change)
+	}
+
+	// A new user has no old rank.
+	do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"d","percent":99}`, nil)
+	ev, _ = readEvent(t, events)
+	change = streamRankChange{}
+	json.Unmarshal(ev.data, &change)
+	if len(change.Changed) != 4 || change.Changed[0].UserID != "d" || change.Changed[0].OldRank != nil {
+		t.Errorf("new user: %+v", change)
+	}
+
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":90}]}`, nil)
+	if ev, _ = readEvent(t, events); ev.name != "reranked" || ev.id != "5" {
+		t.Errorf("got event %q id %q, want reranked 5", ev.name, ev.id)
+	}
+
+	srv.CloseStreams()
+	if ev, ok := readEvent(t, events); ok {
+		t.Errorf("stream still open after CloseStreams: %q", ev.name)
+	}
+}
+
+func TestStreamOutOfOrder(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":80}]}`, nil)
+	do(t, "POST", ts.URL+"/rank/c1/scores", `{"user_id":"b","percent":95}`, nil)
+
+	events := bufio.NewReader(do(t, "GET", ts.URL+"/rank/c1/stream", "", nil).Body)
+	if ev, ok := readEvent(t, events); !ok || ev.name != "ready" || ev.id != "2" {
+		t.Fatalf("first event %q id %q", ev.name, ev.id)
+	}
+	// Version 2 is in the ready event; 4 is published before 3.
+	key := streamKey{tenant.Default, "c1"}
+	for _, v := range []int64{2, 4, 3, 5} {
+		srv.streams.publish(key, srv.event("rank_change", v, streamRankChange{CohortID: "c1", Version: v}))
+	}
+	for _, want := range []sseEvent{{name: "rank_change", id: "4"}, {name: "reranked", id: "4"}, {name: "rank_change", id: "5"}} {
+		if ev, ok := readEvent(t, events); !ok || ev.name != want.name || ev.id != want.id {
+			t.Errorf("got event %q id %q, want %s %s", ev.name, ev.id, want.name, want.id)
+		}
+	}
+	srv.CloseStreams()
+}
+
+func TestStreamHubDropsSlowStreams(t *testing.T) {
+	var h streamHub
+	key := streamKey{"t", "c"}
+	events, cancel := h.subscribe(key)
+	defer cancel()
+	for i := 0; i <= streamBuffer; i++ {
+		h.publish(key, streamEvent{name: "rank_change", id: int64(i)})
+	}
+	n := 0
+	for range events {
+		n++
+	}
+	if n != streamBuffer || h.subscribed(key) {
+		t.Errorf("received %d events before the drop, want %d", n, streamBuffer)
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// subjectItems are one subject's items in a /rank request.
+type subjectItems struct {
+	Subject string
+	Items   []rankItem
+}
+
+// subjectRanking is one subject's ranking in a /rank response.
+type subjectRanking struct {
+	Subject string `json:"subject"`
+	rankResponse
+}
+
+// splitSubjects separates a request whose items carry subjects, one per
+// user and subject, into each subject's items, in order of first
+// appearance, and one overall item per user. A user's overall percent is
+// the mean of their subject percents, or, when all their items have
+// counts, the pooled 100 * sum(correct) / sum(total); their other fields
+// come from their first item. Without subjects it returns items as they
+// are. Either every item has a subject or none does.
+func splitSubjects(field string, items []rankItem) ([]rankItem, []subjectItems, error) {
+	first := -1
+	for i, it := range items {
+		if it.Subject != "" {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return items, nil, nil
+	}
+
+	ve := &validationError{}
+	var subjects []subjectItems
+	bySubject := make(map[string]int)
+	byUser := make(map[string]int)
+	var overall []rankItem
+	var sums []float64
+	var counts []int
+	pooled := make([]bool, 0, len(items))
+	for i, it := range items {
+		if it.Subject == "" {
+			ve.add(fmt.Sprintf("%s[%d].subject", field, i), codeMissingField, "is required when %s[%d] has one", field, first)
+			continue
+		}
+		j, ok := bySubject[it.Subject]
+		if !ok {
+			j = len(subjects)
+			bySubject[it.Subject] = j
+			subjects = append(subjects, subjectItems{Subject: it.Subject})
+		}
+		subjects[j].Items = append(subjects[j].Items, it)
+
+		u, ok := byUser[it.UserID]
+		if !ok {
+			u = len(overall)
+			byUser[it.UserID] = u
+			o := it
+			o.Subject, o.Correct, o.Total = "", nil, nil
+			if it.Correct != nil {
+				c, t := *it.Correct, *it.Total
+				o.Correct, o.Total = &c, &t
+			}
+			overall = append(overall, o)
+			sums, counts = append(sums, 0), append(counts, 0)
+			pooled = append(pooled, it.Correct != nil)
+		} else if pooled[u] = pooled[u] && it.Correct != nil; pooled[u] {
+			*overall[u].Correct += *it.Correct
+			*overall[u].Total += *it.Total
+		}
+		sums[u] += it.percent()
+		counts[u]++
+	}
+	if err := ve.orNil(); err != nil {
+		return nil, nil, err
+	}
+	for u := range overall {
+		if !pooled[u] {
+			overall[u].Correct, overall[u].Total = nil, nil
+			overall[u].Percent = sums[u] / float64(counts[u])
+		}
+	}
+	return overall, subjects, nil
+}
+
+// rankSubjects ranks each subject's items under opts.
+func (s *Server) rankSubjects(ctx context.Context, cohortID string, subjects []subjectItems, opts rankOptions) ([]subjectRanking, error) {
+	out := make([]subjectRanking, len(subjects))
+	for i, sub := range subjects {
+		results, err := s.rankItems(ctx, sub.Items, opts)
+		if err != nil {
+			return nil, fmt.Errorf("subject %q: %w", sub.Subject, err)
+		}
+		out[i] = subjectRanking{Subject: sub.Subject, rankResponse: toResponse(cohortID, results, opts)}
+	}
+	return out, nil
+}
+
+// rejectSubjects fails items with a subject, for endpoints that take one
+// item per user.
+func rejectSubjects(field string, items []rankItem) error {
+	ve := &validationError{}
+	checkNoSubjects(ve, field, items)
+	return ve.orNil()
+}
+
+// checkNoSubjects adds rejectSubjects' field errors to ve.
+func checkNoSubjects(ve *validationError, field string, items []rankItem) {
+	for i, it := range items {
+		if it.Subject != "" {
+			ve.add(fmt.Sprintf("%s[%d].subject", field, i), codeInvalidRequest, "subjects are only supported by /rank")
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"ranking-go/internal/rank"
+)
+
+type targetRequest struct {
+	UserID     string `json:"user_id"`
+	TargetRank int    `json:"target_rank"`
+	// MaxPercent caps the answer; nil means 100.
+	MaxPercent *float64 `json:"max_percent,omitempty"`
+}
+
+type targetResponse struct {
+	CohortID       string  `json:"cohort_id"`
+	UserID         string  `json:"user_id"`
+	TargetRank     int     `json:"target_rank"`
+	CurrentRank    int     `json:"current_rank"`
+	CurrentPercent float64 `json:"current_percent"`
+	// Status is "reachable", "already_reached" or "unreachable".
+	Status string `json:"status"`
+	// RequiredPercent is the least percent that reaches the target; with
+	// Exclusive the user needs strictly more than it.
+	RequiredPercent *float64 `json:"required_percent,omitempty"`
+	Exclusive       bool     `json:"exclusive,omitempty"`
+	// BestRank is the rank at max_percent, reported when unreachable.
+	BestRank int    `json:"best_rank,omitempty"`
+	Message  string `json:"message"`
+}
+
+// targetHandler answers "what percent would this user need for rank N?" on
+// a stored cohort, holding everyone else fixed and applying the options
+// the cohort was ranked with, tie-break rules included.
+func (s *Server) targetHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	var req targetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, "json", err)
+		return
+	}
+	stored, err := s.Store.Get(r.Context(), t.ID, r.PathValue("cohort_id"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	maxPercent := 100.0
+	if req.MaxPercent != nil {
+		maxPercent = *req.MaxPercent
+	}
+
+	opts := stored.Options
+	opts.ExternalSort = s.ExternalSort
+	need, err := rank.RequiredPercent(stored.Items, opts, req.UserID, req.TargetRank, maxPercent)
+	switch {
+	case errors.Is(err, rank.ErrUnknownUser):
+		writeProblem(w, r, http.StatusNotFound, codeUserNotFound, err.Error())
+		return
+	case err != nil:
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	out := targetResponse{
+		CohortID:       stored.CohortID,
+		UserID:         req.UserID,
+		TargetRank:     req.TargetRank,
+		CurrentRank:    need.CurrentRank,
+		CurrentPercent: need.CurrentPercent,
+	}
+	switch {
+	case need.Reached:
+		out.Status = "already_reached"
+		out.Message = "user is already at or above the target rank"
+	case need.Reachable:
+		out.Status = "reachable"
+		out.RequiredPercent = &need.MinPercent
+		out.Exclusive = need.Exclusive
+		out.Message = "minimum percent to reach the target rank with everyone else unchanged"
+		if need.Exclusive {
+			out.Message = "user needs strictly more than required_percent: at exactly that percent they would lose the tie-break"
+		}
+	default:
+		out.Status = "unreachable"
+		out.BestRank = need.BestRank
+		out.Message = "target rank cannot be reached without exceeding max_percent; best_rank is the rank at max_percent"
+	}
+	writeJSON(w, withCase(out, s.Defaults.FieldCase))
+}
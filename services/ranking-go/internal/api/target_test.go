@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTargetRank(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[
+		{"user_id":"a","percent":92},{"user_id":"b","percent":85},{"user_id":"c","percent":80},{"user_id":"d","percent":71}
+	],"tie_priority":["d"]}`, nil)
+
+	post := func(body string) targetResponse {
+		t.Helper()
+		resp := do(t, "POST", ts.URL+"/rank/c1/target", body, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d", body, resp.StatusCode)
+		}
+		return decode[targetResponse](t, resp)
+	}
+
+	// d wins ties by tie_priority, so matching c is enough.
+	got := post(`{"user_id":"d","target_rank":3}`)
+	if got.Status != "reachable" || got.RequiredPercent == nil || *got.RequiredPercent != 80 || got.Exclusive || got.CurrentRank != 4 {
+		t.Errorf("reachable: %+v", got)
+	}
+	got = post(`{"user_id":"d","target_rank":1,"max_percent":90}`)
+	if got.Status != "unreachable" || got.BestRank != 2 || got.RequiredPercent != nil {
+		t.Errorf("unreachable: %+v", got)
+	}
+	got = post(`{"user_id":"b","target_rank":3}`)
+	if got.Status != "already_reached" || got.CurrentRank != 2 {
+		t.Errorf("already reached: %+v", got)
+	}
+
+	for body, want := range map[string]int{
+		`{"user_id":"zz","target_rank":1}`: http.StatusNotFound,
+		`{"user_id":"a","target_rank":0}`:  http.StatusBadRequest,
+	} {
+		if resp := do(t, "POST", ts.URL+"/rank/c1/target", body, nil); resp.StatusCode != want {
+			t.Errorf("%s: status %d, want %d", body, resp.StatusCode, want)
+		}
+	}
+	if resp := do(t, "POST", ts.URL+"/rank/nope/target", `{"user_id":"a","target_rank":1}`, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing cohort: status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import "ranking-go/internal/rank"
+
+// Tie membership lists are capped so an all-tied cohort can't produce an
+// n² payload.
+const (
+	defaultMaxTieMembers = 50
+	maxTieMembersLimit   = 1000
+)
+
+func (o rankOptions) maxTieMembers() int {
+	if o.MaxTieMembers != nil {
+		return *o.MaxTieMembers
+	}
+	return defaultMaxTieMembers
+}
+
+// addTies fills tied_with, tied_count and tied_truncated on rows, which are
+// in the same (best-first) order as results. Untied users get nothing.
+func addTies(rows []rankResult, results []rank.Result, limit int) {
+	for start := 0; start < len(results); {
+		end := start + 1
+		for end < len(results) && results[end].TieGroup == results[start].TieGroup {
+			end++
+		}
+		if size := end - start; size > 1 {
+			for i := start; i < end; i++ {
+				rows[i].TiedCount = size - 1
+				rows[i].TiedWith = make([]string, 0, min(limit, size-1))
+				for j := start; j < end && len(rows[i].TiedWith) < limit; j++ {
+					if j != i {
+						rows[i].TiedWith = append(rows[i].TiedWith, results[j].UserID)
+					}
+				}
+				rows[i].TiedTruncated = size-1 > limit
+			}
+		}
+		start = end
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTiedWithTruncatesLargeGroups(t *testing.T) {
+	ts := newTestServer(t, nil)
+	items := make([]string, 0, 31)
+	for i := 0; i < 30; i++ {
+		items = append(items, fmt.Sprintf(`{"user_id":"u%02d","percent":50}`, i))
+	}
+	items = append(items, `{"user_id":"top","percent":99}`)
+	body := `{"items":[` + strings.Join(items, ",") + `],"include_ties":true,"max_tie_members":5}`
+
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", body, nil))
+	if r := got.Results[0]; r.UserID != "top" || r.TiedWith != nil || r.TiedCount != 0 || r.TiedTruncated {
+		t.Errorf("untied user: %+v", r)
+	}
+	for _, r := range got.Results[1:] {
+		if len(r.TiedWith) != 5 || r.TiedCount != 29 || !r.TiedTruncated {
+			t.Fatalf("%s: %d listed, count %d, truncated %v", r.UserID, len(r.TiedWith), r.TiedCount, r.TiedTruncated)
+		}
+		for _, id := range r.TiedWith {
+			if id == r.UserID {
+				t.Fatalf("%s lists itself", r.UserID)
+			}
+		}
+	}
+
+	cols := decode[rankColumns](t, do(t, "POST", ts.URL+"/rank", strings.Replace(body, `"include_ties"`, `"format":"columns","include_ties"`, 1), nil))
+	if len(cols.TiedWith[1]) != 5 || cols.TiedCounts[1] != 29 || !cols.TiedTruncated[1] || len(cols.TiedWith[0]) != 0 {
+		t.Errorf("columns: %v %v %v", cols.TiedWith[:2], cols.TiedCounts[:2], cols.TiedTruncated[:2])
+	}
+}
+
+func TestTiedWithUnderCap(t *testing.T) {
+	ts := newTestServer(t, nil)
+	got := decode[rankResponse](t, do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":1},{"user_id":"b","percent":1}],"include_ties":true}`, nil))
+	if r := got.Results[0]; len(r.TiedWith) != 1 || r.TiedWith[0] != "b" || r.TiedCount != 1 || r.TiedTruncated {
+		t.Errorf("got %+v", r)
+	}
+	if resp := do(t, "POST", ts.URL+"/rank", `{"items":[],"include_ties":true,"max_tie_members":-1}`, nil); resp.StatusCode != 400 {
+		t.Errorf("status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestTieBreakByCompletionTime(t *testing.T) {
+	ts := newTestServer(t, nil)
+	items := `"items":[
+		{"user_id":"a","percent":80,"duration_seconds":1200,"finished_at":"2026-03-01T10:20:00Z"},
+		{"user_id":"b","percent":80,"duration_seconds":900,"finished_at":"2026-03-01T10:25:00Z"},
+		{"user_id":"c","percent":80,"duration_seconds":900,"finished_at":"2026-03-01T10:15:00Z"},
+		{"user_id":"d","percent":90}
+	]`
+	ids := func(body string) string {
+		resp := do(t, "POST", ts.URL+"/rank", body, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d", body, resp.StatusCode)
+		}
+		var out string
+		for _, r := range decode[rankResponse](t, resp).Results {
+			out += r.UserID
+		}
+		return out
+	}
+	// tie_break needs its metrics on every item, d included.
+	tied := strings.Replace(items, `{"user_id":"d","percent":90}`, `{"user_id":"d","percent":90,"duration_seconds":0,"finished_at":"2026-03-01T10:00:00Z"}`, 1)
+
+	// percent desc, duration asc, user_id asc: b and c tie on 900s.
+	if got := ids(`{` + tied + `,"tie_break":[{"metric":"duration_seconds"}]}`); got != "dbca" {
+		t.Errorf("by duration: %s, want dbca", got)
+	}
+	// Finishing time settles the duration tie.
+	if got := ids(`{` + tied + `,"tie_break":[{"metric":"duration_seconds"},{"metric":"finished_at"}]}`); got != "dcba" {
+		t.Errorf("by duration then finish: %s, want dcba", got)
+	}
+	// Without a tie_break the times are ignored.
+	if got := ids(`{` + items + `}`); got != "dabc" {
+		t.Errorf("default: %s, want dabc", got)
+	}
+
+	for _, bad := range []string{
+		`{"user_id":"a","percent":1,"duration_seconds":-1}`,
+		`{"user_id":"a","percent":1,"duration_seconds":1,"metrics":{"duration_seconds":2}}`,
+	} {
+		resp := do(t, "POST", ts.URL+"/rank", `{"items":[`+bad+`]}`, nil)
+		if got := decode[problem](t, resp); resp.StatusCode != http.StatusBadRequest || len(got.Fields) != 1 {
+			t.Errorf("%s: status %d, problem %+v", bad, resp.StatusCode, got)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"ranking-go/internal/tracing"
+)
+
+// traced runs h in a server span named after its route, continuing the
+// caller's trace when the request carries a traceparent header.
+func (s *Server) traced(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Tracer == nil {
+			h(w, r)
+			return
+		}
+		ctx := r.Context()
+		if sc, ok := tracing.ParseTraceparent(r.Header.Get("Traceparent")); ok {
+			ctx = tracing.ContextWithSpanContext(ctx, sc)
+		}
+		ctx, span := s.Tracer.Start(ctx, route, tracing.KindServer,
+			tracing.Attr{Key: "http.request.method", Value: r.Method},
+			tracing.Attr{Key: "http.route", Value: route},
+			tracing.Attr{Key: "url.path", Value: r.URL.Path})
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		h(rec, r.WithContext(ctx))
+		span.SetAttributes(tracing.Attr{Key: "http.response.status_code", Value: rec.code})
+		if rec.code >= 500 {
+			span.SetError(errors.New(http.StatusText(rec.code)))
+		}
+	}
+}
+
+// startRankSpan covers one call into the rank package, which takes no
+// context of its own.
+func (s *Server) startRankSpan(ctx context.Context, items int) *tracing.Span {
+	_, span := s.Tracer.Start(ctx, "rank.Rank", tracing.KindInternal, tracing.Attr{Key: "ranking.cohort_size", Value: items})
+	return span
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"ranking-go/internal/store"
+	"ranking-go/internal/tracing"
+)
+
+func TestTracing(t *testing.T) {
+	var mu sync.Mutex
+	var spans []map[string]any
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []map[string]any `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Tracer = tracing.NewTracer(tracing.NewExporter(collector.URL, "ranking-go", nil, nil))
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":40}]}`,
+		map[string]string{"Traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+	if err := srv.Tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	byName := map[string]map[string]any{}
+	for _, s := range spans {
+		byName[s["name"].(string)] = s
+	}
+	root, ranked := byName["POST /rank"], byName["rank.Rank"]
+	if root == nil || ranked == nil {
+		t.Fatalf("spans %v", spans)
+	}
+	if root["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" || root["parentSpanId"] != "00f067aa0ba902b7" {
+		t.Errorf("root %v", root)
+	}
+	if ranked["traceId"] != root["traceId"] || ranked["parentSpanId"] != root["spanId"] {
+		t.Errorf("rank span %v", ranked)
+	}
+}
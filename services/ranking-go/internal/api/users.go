@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"ranking-go/internal/rank"
+	"ranking-go/internal/store"
+)
+
+type userRankResponse struct {
+	CohortID   string `json:"cohort_id"`
+	Version    int64  `json:"version"`
+	CohortSize int    `json:"cohort_size"`
+	rankResult
+	PercentileEncoding string `json:"percentile_encoding,omitempty"`
+	PercentileDivisor  int    `json:"percentile_divisor,omitempty"`
+}
+
+// userRankHandler returns one user's row of a stored cohort, for clients
+// that only show "your rank".
+func (s *Server) userRankHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	p, resp, err := s.userRank(r.Context(), t.ID, r.PathValue("cohort_id"), r.PathValue("user_id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if s.notModifiedPage(w, r, p) {
+		return
+	}
+	writeJSON(w, withCase(resp, s.Defaults.FieldCase))
+}
+
+const (
+	defaultNeighborWindow = 5
+	maxNeighborWindow     = 100
+)
+
+type neighborsResponse struct {
+	CohortID   string `json:"cohort_id"`
+	Version    int64  `json:"version"`
+	CohortSize int    `json:"cohort_size"`
+	UserID     string `json:"user_id"`
+	// Results are the user and up to Window users on each side, best
+	// first; fewer at either end of the ranking.
+	Results            []rankResult `json:"results"`
+	PercentileEncoding string       `json:"percentile_encoding,omitempty"`
+	PercentileDivisor  int          `json:"percentile_divisor,omitempty"`
+}
+
+// neighborsHandler returns the slice of a stored ranking around one user,
+// "rank around me", without formatting the rest of the cohort.
+func (s *Server) neighborsHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	window := defaultNeighborWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxNeighborWindow {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("window must be an integer in [0, %d]", maxNeighborWindow))
+			return
+		}
+		window = n
+	}
+	userID := r.PathValue("user_id")
+	p, err := s.readPageAround(r.Context(), t.ID, r.PathValue("cohort_id"), userID, window)
+	if errors.Is(err, store.ErrUserNotFound) {
+		writeProblem(w, r, http.StatusNotFound, codeUserNotFound, "user not in cohort")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	resp := s.rowsOf(p.CohortID, p.Options.Quantile, p.Results)
+	writeJSON(w, withCase(neighborsResponse{
+		CohortID:           p.CohortID,
+		Version:            p.Version,
+		CohortSize:         p.Items,
+		UserID:             userID,
+		Results:            resp.Results,
+		PercentileEncoding: resp.PercentileEncoding,
+		PercentileDivisor:  resp.PercentileDivisor,
+	}, s.Defaults.FieldCase))
+}
+
+// readPage reads positions [from, to) of a stored cohort: from the store
+// itself if it is a store.Pager, so a page costs the page and not the
+// cohort, and otherwise off the whole ranking.
+func (s *Server) readPage(ctx context.Context, tenantID, cohortID string, from, to int) (store.Page, error) {
+	if pg, ok := s.Store.(store.Pager); ok {
+		p, err := pg.Page(ctx, tenantID, cohortID, from, to)
+		if !errors.Is(err, store.ErrNotPaged) {
+			return p, err
+		}
+	}
+	stored, err := s.Store.Get(ctx, tenantID, cohortID)
+	if err != nil {
+		return store.Page{}, err
+	}
+	return pageOf(stored, from, to), nil
+}
+
+// readPageAround is readPage for userID and up to window users on each
+// side; store.ErrUserNotFound if the user isn't in the cohort.
+func (s *Server) readPageAround(ctx context.Context, tenantID, cohortID, userID string, window int) (store.Page, error) {
+	if pg, ok := s.Store.(store.Pager); ok {
+		p, err := pg.PageAround(ctx, tenantID, cohortID, userID, window)
+		if !errors.Is(err, store.ErrNotPaged) {
+			return p, err
+		}
+	}
+	stored, err := s.Store.Get(ctx, tenantID, cohortID)
+	if err != nil {
+		return store.Page{}, err
+	}
+	i := userIndex(stored.Results, userID)
+	if i < 0 {
+		return store.Page{}, store.ErrUserNotFound
+	}
+	return pageOf(stored, max(i-window, 0), i+window+1), nil
+}
+
+// pageOf cuts positions [from, to) out of stored.
+func pageOf(stored store.Ranking, from, to int) store.Page {
+	n := len(stored.Results)
+	from, to = min(from, n), min(to, n)
+	return store.Page{
+		CohortID: stored.CohortID,
+		Version:  stored.Version,
+		Options:  stored.Options,
+		Size:     n,
+		Items:    len(stored.Items),
+		Offset:   from,
+		Results:  stored.Results[from:max(from, to)],
+	}
+}
+
+// rowsOf formats a slice of a stored ranking under the default rank
+// numbering and percentile formatting, with the quantile bands the cohort
+// was ranked with. Options that need the whole cohort (ties, awards,
+// display ranks, summaries) are left out.
+func (s *Server) rowsOf(cohortID string, q rank.Quantile, results []rank.Result) rankResponse {
+	d := s.Defaults
+	return toResponse(cohortID, results, rankOptions{
+		Precision:          d.Precision,
+		RankBase:           d.RankBase,
+		PercentileEncoding: d.PercentileEncoding,
+		Quantile:           q,
+	})
+}
+
+// quantileLabel names band b of k for display: "Top 10%" for the top
+// decile, and "Bottom 10%" for the last one; bands in the lower half count
+// from the bottom.
+func quantileLabel(b, k int) string {
+	if 2*b <= k {
+		return fmt.Sprintf("Top %d%%", b*100/k)
+	}
+	return fmt.Sprintf("Bottom %d%%", (k-b+1)*100/k)
+}
+
+func userIndex(results []rank.Result, userID string) int {
+	for i, r := range results {
+		if r.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUserRank(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[{"user_id":"a","percent":90},{"user_id":"b","percent":70},{"user_id":"c","percent":50}]}`, nil)
+
+	resp := do(t, "GET", ts.URL+"/rank/c1/users/b", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	got := decode[userRankResponse](t, resp)
+	if got.CohortID != "c1" || got.UserID != "b" || got.Rank != 2 || *got.Percentile != 50 || got.CohortSize != 3 || got.Version != 1 {
+		t.Errorf("got %+v", got)
+	}
+
+	for _, url := range []string{"/rank/c1/users/zed", "/rank/nope/users/a"} {
+		if resp := do(t, "GET", ts.URL+url, "", nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", url, resp.StatusCode)
+		}
+	}
+	// Tenants can't look into each other's cohorts.
+	if resp := do(t, "GET", ts.URL+"/rank/c1/users/a", "", map[string]string{"X-Tenant": "other"}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("other tenant: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	ts := newTestServer(t, nil)
+	var items []string
+	for i := 0; i < 20; i++ {
+		items = append(items, fmt.Sprintf(`{"user_id":"u%02d","percent":%d}`, i, 100-i))
+	}
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[`+strings.Join(items, ",")+`]}`, nil)
+
+	for _, c := range []struct {
+		user, query string
+		first, last int // ranks
+	}{
+		{"u10", "", 6, 16},
+		{"u10", "?window=2", 9, 13},
+		{"u01", "?window=5", 1, 7},   // clipped at the top
+		{"u19", "?window=3", 17, 20}, // and at the bottom
+		{"u05", "?window=0", 6, 6},
+	} {
+		resp := do(t, "GET", ts.URL+"/rank/c1/users/"+c.user+"/neighbors"+c.query, "", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s%s: status %d", c.user, c.query, resp.StatusCode)
+		}
+		got := decode[neighborsResponse](t, resp)
+		if n := len(got.Results); n != c.last-c.first+1 || got.Results[0].Rank != c.first || got.Results[n-1].Rank != c.last {
+			t.Errorf("%s%s: %d rows from rank %d, want ranks %d..%d", c.user, c.query, n, got.Results[0].Rank, c.first, c.last)
+		}
+		if got.CohortSize != 20 || got.UserID != c.user {
+			t.Errorf("%s%s: got %+v", c.user, c.query, got)
+		}
+	}
+
+	for q, want := range map[string]int{
+		"/rank/c1/users/u01/neighbors?window=101": http.StatusBadRequest,
+		"/rank/c1/users/u01/neighbors?window=-1":  http.StatusBadRequest,
+		"/rank/c1/users/zed/neighbors":            http.StatusNotFound,
+	} {
+		if resp := do(t, "GET", ts.URL+q, "", nil); resp.StatusCode != want {
+			t.Errorf("%s: status %d, want %d", q, resp.StatusCode, want)
+		}
+	}
+}
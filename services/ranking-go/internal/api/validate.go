@@ -0,0 +1,229 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"ranking-go/internal/rank"
+	"ranking-go/internal/tenant"
+)
+
+// maxFieldErrors caps the field errors reported for one request; the
+// total is still counted.
+const maxFieldErrors = 100
+
+// fieldError is one invalid field, named by its JSON path
+// ("items[3].percent"), with its own error code.
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// validationError lists a request's invalid fields; handlers send it as
+// a 400 problem with writeValidationError.
+type validationError struct {
+	Fields []fieldError
+	Total  int
+}
+
+func (e *validationError) add(field, code, format string, args ...any) {
+	if e.Total++; len(e.Fields) < maxFieldErrors {
+		e.Fields = append(e.Fields, fieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (e *validationError) Error() string {
+	msg := e.Fields[0].Field + ": " + e.Fields[0].Message
+	if e.Total > 1 {
+		msg += fmt.Sprintf(" (and %d more)", e.Total-1)
+	}
+	return msg
+}
+
+func (e *validationError) orNil() error {
+	if e.Total == 0 {
+		return nil
+	}
+	return e
+}
+
+// decodeError answers a failed body decode: 413 when the body exceeded
+// Limits.MaxBodyBytes, a field error for a value of the wrong type, and
+// otherwise 400 "invalid <format>: ...".
+func decodeError(w http.ResponseWriter, r *http.Request, format string, err error) {
+	var tooLarge *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		ve := &validationError{}
+		ve.add(fieldPath(typeErr.Field), codeInvalidType, "must be %s, got %s", jsonType(typeErr.Type.Kind().String()), typeErr.Value)
+		writeValidationError(w, r, ve)
+	default:
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "invalid "+format+": "+err.Error())
+	}
+}
+
+// fieldPath writes encoding/json's "items.0.percent" as "items[0].percent".
+func fieldPath(field string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(part); err == nil && i > 0 {
+			b.WriteString("[" + part + "]")
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// jsonType names a Go kind the way a JSON client would think of it.
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "float"), strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"):
+		return "a number"
+	case kind == "string":
+		return "a string"
+	case kind == "bool":
+		return "true or false"
+	case kind == "slice", kind == "array":
+		return "an array"
+	case kind == "map", kind == "struct":
+		return "an object"
+	}
+	return "a " + kind
+}
+
+// limitBody rejects bodies over Limits.MaxBodyBytes: up front when the
+// Content-Length says so, otherwise once reading passes the limit.
+func (s *Server) limitBody(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if max := s.Limits.MaxBodyBytes; max > 0 {
+			if r.ContentLength > max {
+				writeProblem(w, r, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", max))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+		}
+		h(w, r)
+	}
+}
+
+// itemLimit is the most items t may send for one cohort, 0 for no limit,
+// and the error to report past it: the tenant's max_items or the
+// server-wide Limits.MaxItems, whichever is lower.
+func (s *Server) itemLimit(t *tenant.Tenant) (int, error) {
+	limit, err := t.MaxItems, errTooManyItems
+	if m := s.Limits.MaxItems; m > 0 && (limit == 0 || m < limit) {
+		limit, err = m, fmt.Errorf("too many items: at most %d per cohort", m)
+	}
+	return limit, err
+}
+
+// validateItems checks every item, reporting all invalid fields at once:
+// user_ids must not be blank, percents must be finite and within
+// Limits.MinPercent..MaxPercent, metrics, arrivals and weights must be
+// finite, and durations and attempts must be non-negative. Counts come
+// in pairs with 0 <= correct <= total, in place of a percent. An item's
+// finished_at, duration_seconds, attempts, correct and total can't also be
+// among its metrics.
+func (s *Server) validateItems(field string, items []rankItem) error {
+	ve := &validationError{}
+	s.checkItems(ve, field, items)
+	return ve.orNil()
+}
+
+// checkItems adds validateItems' field errors to ve.
+func (s *Server) checkItems(ve *validationError, field string, items []rankItem) {
+	for i, it := range items {
+		at := fmt.Sprintf("%s[%d].", field, i)
+		if strings.TrimSpace(it.UserID) == "" {
+			ve.add(at+"user_id", codeEmptyUserID, "must not be empty")
+		}
+		s.checkCounts(ve, at, it)
+		if len(it.Metrics) > 0 {
+			names := make([]string, 0, len(it.Metrics))
+			for name := range it.Metrics {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			for _, name := range names {
+				if !finite(it.Metrics[name]) {
+					ve.add(at+"metrics."+name, codeInvalidNumber, "must be a finite number")
+				}
+			}
+		}
+		if it.Arrival != nil && !finite(*it.Arrival) {
+			ve.add(at+"arrival", codeInvalidNumber, "must be a finite number")
+		}
+		if d := it.DurationSeconds; d != nil && (!finite(*d) || *d < 0) {
+			ve.add(at+"duration_seconds", codeInvalidNumber, "must be a finite number >= 0")
+		}
+		if _, ok := it.Metrics[metricFinishedAt]; ok && it.FinishedAt != nil {
+			ve.add(at+"metrics."+metricFinishedAt, codeInvalidRequest, "conflicts with the item's finished_at")
+		}
+		if _, ok := it.Metrics[metricDurationSeconds]; ok && it.DurationSeconds != nil {
+			ve.add(at+"metrics."+metricDurationSeconds, codeInvalidRequest, "conflicts with the item's duration_seconds")
+		}
+		if it.Attempts != nil && *it.Attempts < 0 {
+			ve.add(at+"attempts", codeInvalidNumber, "must be >= 0, got %d", *it.Attempts)
+		}
+		if _, ok := it.Metrics[metricAttempts]; ok && it.Attempts != nil {
+			ve.add(at+"metrics."+metricAttempts, codeInvalidRequest, "conflicts with the item's attempts")
+		}
+		if _, ok := it.Metrics[rank.MetricCorrect]; ok && it.Correct != nil {
+			ve.add(at+"metrics."+rank.MetricCorrect, codeInvalidRequest, "conflicts with the item's correct")
+		}
+		if _, ok := it.Metrics[rank.MetricTotal]; ok && it.Total != nil {
+			ve.add(at+"metrics."+rank.MetricTotal, codeInvalidRequest, "conflicts with the item's total")
+		}
+		if !finite(it.Weight) {
+			ve.add(at+"weight", codeInvalidNumber, "must be a finite number")
+		}
+	}
+}
+
+// checkCounts checks an item's percent, or its correct and total counts
+// when it has them.
+func (s *Server) checkCounts(ve *validationError, at string, it rankItem) {
+	switch {
+	case it.Correct == nil && it.Total == nil:
+		s.checkPercent(ve, at+"percent", it.Percent)
+	case it.Correct == nil:
+		ve.add(at+"correct", codeMissingField, "is required with total")
+	case it.Total == nil:
+		ve.add(at+"total", codeMissingField, "is required with correct")
+	case *it.Correct < 0 || *it.Correct > *it.Total:
+		ve.add(at+"correct", codeInvalidNumber, "must be between 0 and total (%d), got %d", *it.Total, *it.Correct)
+	case it.Percent != 0:
+		ve.add(at+"percent", codeInvalidRequest, "must be omitted with correct and total")
+	default:
+		s.checkPercent(ve, at+"percent", it.percent())
+	}
+}
+
+// checkPercent adds a field error unless p is finite and in range.
+func (s *Server) checkPercent(ve *validationError, field string, p float64) {
+	lo, hi := s.Limits.MinPercent, s.Limits.MaxPercent
+	switch {
+	case !finite(p):
+		ve.add(field, codeInvalidPercent, "must be a finite number")
+	case p < lo || p > hi:
+		ve.add(field, codeInvalidPercent, "must be between %v and %v, got %v", lo, hi, p)
+	}
+}
+
+func finite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ranking-go/internal/store"
+	"ranking-go/internal/tenant"
+)
+
+func TestValidateItems(t *testing.T) {
+	ts := newTestServer(t, nil)
+	resp := do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c1","items":[
+		{"user_id":"a","percent":50},
+		{"user_id":"  ","percent":101},
+		{"user_id":"c","percent":-1,"metrics":{"exam":1}}
+	]}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+	got := decode[problem](t, resp)
+	want := []fieldError{
+		{"items[1].user_id", codeEmptyUserID, "must not be empty"},
+		{"items[1].percent", codeInvalidPercent, "must be between 0 and 100, got 101"},
+		{"items[2].percent", codeInvalidPercent, "must be between 0 and 100, got -1"},
+	}
+	if len(got.Fields) != len(want) {
+		t.Fatalf("fields = %+v", got.Fields)
+	}
+	for i := range want {
+		if got.Fields[i] != want[i] {
+			t.Errorf("fields[%d] = %+v, want %+v", i, got.Fields[i], want[i])
+		}
+	}
+
+	// A value of the wrong type is reported against its field (with its
+	// index on Go versions whose decoder records it).
+	resp = do(t, "POST", ts.URL+"/rank", `{"items":[{"user_id":"a","percent":"high"}]}`, nil)
+	got = decode[problem](t, resp)
+	if resp.StatusCode != http.StatusBadRequest || len(got.Fields) != 1 || !strings.HasSuffix(got.Fields[0].Field, "percent") {
+		t.Fatalf("status %d, fields %+v", resp.StatusCode, got.Fields)
+	}
+
+	// Score updates get the same checks.
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"c2","items":[{"user_id":"a","percent":50}]}`, nil).Body.Close()
+	resp = do(t, "POST", ts.URL+"/rank/c2/scores", `{"user_id":"","percent":1e308}`, nil)
+	got = decode[problem](t, resp)
+	if resp.StatusCode != http.StatusBadRequest || len(got.Fields) != 2 {
+		t.Fatalf("scores: status %d, fields %+v", resp.StatusCode, got.Fields)
+	}
+}
+
+func TestValidateFieldErrorCap(t *testing.T) {
+	ts := newTestServer(t, nil)
+	var b strings.Builder
+	b.WriteString(`{"items":[`)
+	for i := 0; i < 150; i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(`{"user_id":"","percent":1}`)
+	}
+	b.WriteString(`]}`)
+	resp := do(t, "POST", ts.URL+"/rank", b.String(), nil)
+	got := decode[problem](t, resp)
+	if len(got.Fields) != maxFieldErrors || got.FieldCount != 150 {
+		t.Fatalf("fields = %d, field_count = %d", len(got.Fields), got.FieldCount)
+	}
+}
+
+func TestBodyAndItemLimits(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Limits.MaxBodyBytes = 200
+	srv.Limits.MaxItems = 2
+	mux := http.NewServeMux()
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	big := `{"items":[{"user_id":"` + strings.Repeat("x", 300) + `","percent":1}]}`
+	resp := do(t, "POST", ts.URL+"/rank", big, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("big body: status = %d, want 413", resp.StatusCode)
+	}
+
+	// Without a Content-Length the limit trips while decoding.
+	req, _ := http.NewRequest("POST", ts.URL+"/rank", struct{ *strings.Reader }{strings.NewReader(big)})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("chunked body: status = %d, want 413", resp.StatusCode)
+	}
+
+	three := `{"items":[{"user_id":"a","percent":1},{"user_id":"b","percent":2},{"user_id":"c","percent":3}]}`
+	resp = do(t, "POST", ts.URL+"/rank", three, nil)
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	body := string(b)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || !strings.Contains(body, "at most 2") {
+		t.Fatalf("items: status = %d, body %q", resp.StatusCode, body)
+	}
+}
+
+func TestItemLimitPrefersTenant(t *testing.T) {
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Limits.MaxItems = 10
+	if n, err := srv.itemLimit(&tenant.Tenant{MaxItems: 5}); n != 5 || err != errTooManyItems {
+		t.Fatalf("tenant limit: %d, %v", n, err)
+	}
+	if n, _ := srv.itemLimit(&tenant.Tenant{MaxItems: 50}); n != 10 {
+		t.Fatalf("server limit: %d", n)
+	}
+	if n, _ := srv.itemLimit(&tenant.Tenant{}); n != 10 {
+		t.Fatalf("no tenant limit: %d", n)
+	}
+}
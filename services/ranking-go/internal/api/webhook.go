@@ -0,0 +1,228 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"ranking-go/internal/tracing"
+)
+
+const (
+	defaultWebhookAttempts = 5
+	defaultWebhookBackoff  = time.Second
+	webhookTimeout         = 10 * time.Second
+)
+
+// Webhook configures the callbacks /rank/jobs sends on completion.
+type Webhook struct {
+	// Secret keys the HMAC-SHA256 signature of every callback. Without it
+	// callback_url is rejected.
+	Secret string
+	// Attempts is the most deliveries tried per callback; 0 means 5.
+	Attempts int
+	// Backoff is the wait before the first retry, doubling after each;
+	// 0 means 1s.
+	Backoff time.Duration
+	// Allow lists address ranges callbacks may reach although they aren't
+	// public, e.g. a receiver on the internal network. Callbacks to any
+	// other loopback, private, link-local or reserved address are refused.
+	Allow []netip.Prefix
+	// Client, if set, sends callbacks without the address checks.
+	Client *http.Client
+}
+
+// errCallbackAddr is a callback URL resolving to an address it may not
+// reach.
+var errCallbackAddr = errors.New("callback_url must resolve to a public address")
+
+// reserved are ranges that netip.Addr's predicates don't rule out but
+// that no public receiver lives in.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// callbackPayload is the body POSTed to a job's callback_url: a pointer to
+// the result rather than the result itself, which may be megabytes.
+type callbackPayload struct {
+	JobID      string    `json:"job_id"`
+	Status     jobStatus `json:"status"`
+	CohortID   string    `json:"cohort_id,omitempty"`
+	Version    int64     `json:"version,omitempty"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      string    `json:"error,omitempty"`
+	// ResultURL is the path of GET /rank/jobs/{id}.
+	ResultURL string `json:"result_url"`
+}
+
+// validateCallbackURL rejects a callback_url that isn't an absolute http(s)
+// URL, or whose host is an address or name callbacks may not reach. Names
+// are checked again, resolved, when a callback is sent.
+func (wh Webhook) validateCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback_url must be an absolute http or https URL, got %q", raw)
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		host = "127.0.0.1"
+	}
+	if a, err := netip.ParseAddr(host); err == nil && !wh.permitted(a) {
+		return errCallbackAddr
+	}
+	return nil
+}
+
+// permitted reports whether callbacks may reach a.
+func (wh Webhook) permitted(a netip.Addr) bool {
+	a = a.Unmap()
+	for _, p := range wh.Allow {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	if !a.IsGlobalUnicast() || a.IsPrivate() {
+		return false
+	}
+	for _, p := range reserved {
+		if p.Contains(a) {
+			return false
+		}
+	}
+	return true
+}
+
+// client is wh.Client, or one that connects only to permitted addresses
+// and doesn't follow redirects. The check is made on each address dialled,
+// after DNS resolution, so a name can't be pointed at an internal address
+// once its URL has been accepted.
+func (wh Webhook) client() *http.Client {
+	if wh.Client != nil {
+		return wh.Client
+	}
+	d := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || !wh.permitted(ap.Addr()) {
+				return errCallbackAddr
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		// No proxy: the address dialled must be the receiver's.
+		Transport: &http.Transport{
+			DialContext:         d.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			ForceAttemptHTTP2:   true,
+		},
+		// A redirect could point anywhere; a 3xx is a final failure.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>", so a
+// captured callback can't be replayed with a fresh timestamp.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// deliver POSTs payload to target until it gets a 2xx, a response that
+// retrying won't change (a 3xx, or any other 4xx but 408 and 429), an
+// address it may not reach, or runs out of attempts. It returns the attempts made and the last failure.
+func (wh Webhook) deliver(ctx context.Context, target string, payload callbackPayload, requestID string) (int, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	attempts := wh.Attempts
+	if attempts <= 0 {
+		attempts = defaultWebhookAttempts
+	}
+	backoff := wh.Backoff
+	if backoff <= 0 {
+		backoff = defaultWebhookBackoff
+	}
+	client := wh.client()
+	if wh.Client == nil {
+		defer client.CloseIdleConnections()
+	}
+
+	var last error
+	for n := 1; n <= attempts; n++ {
+		if n > 1 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return n - 1, ctx.Err()
+			}
+			backoff *= 2
+		}
+		retry, err := wh.post(ctx, client, target, body, payload.JobID, requestID)
+		if err == nil {
+			return n, nil
+		}
+		last = err
+		if !retry {
+			return n, err
+		}
+	}
+	return attempts, last
+}
+
+func (wh Webhook) post(ctx context.Context, client *http.Client, target string, body []byte, jobID, requestID string) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Ranking-Job", jobID)
+	if requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	if sc := tracing.SpanContextFrom(ctx); sc.IsValid() {
+		req.Header.Set("Traceparent", sc.Traceparent())
+	}
+	req.Header.Set("X-Ranking-Timestamp", strconv.FormatInt(ts, 10))
+	req.Header.Set("X-Ranking-Signature", "sha256="+signWebhook(wh.Secret, ts, body))
+	resp, err := client.Do(req)
+	if err != nil {
+		// The address won't become reachable by retrying.
+		return !errors.Is(err, errCallbackAddr), err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("callback: %s", resp.Status)
+	}
+	return false, fmt.Errorf("callback: %s", resp.Status)
+}
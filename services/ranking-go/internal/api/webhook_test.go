@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"ranking-go/internal/store"
+)
+
+// loopback lets tests send callbacks to httptest servers.
+var loopback = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+func TestJobCallback(t *testing.T) {
+	var mu sync.Mutex
+	var got []callbackPayload
+	calls := 0
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get("X-Ranking-Timestamp"), 10, 64)
+		if r.Header.Get("X-Ranking-Signature") != "sha256="+signWebhook("s3cret", ts, body) {
+			t.Errorf("bad signature %q", r.Header.Get("X-Ranking-Signature"))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var p callbackPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Error(err)
+		}
+		got = append(got, p)
+	}))
+	defer hook.Close()
+
+	mux := http.NewServeMux()
+	srv := NewServer(store.NewMemory(), nil)
+	srv.Webhook = Webhook{Secret: "s3cret", Backoff: time.Millisecond, Allow: loopback}
+	srv.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	created := decode[jobResponse](t, do(t, "POST", ts.URL+"/rank/jobs", `{"cohort_id":"c1","callback_url":"`+hook.URL+`","items":[{"user_id":"a","percent":40}]}`, nil))
+	if created.Callback == nil || created.Callback.Status != "pending" {
+		t.Fatalf("created %+v", created)
+	}
+
+	// The job is done before its callback; wait for the delivery too.
+	var job jobResponse
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job = waitJob(t, ts.URL+"/rank/jobs/"+created.JobID, nil)
+		if job.Callback.Status != "pending" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job.Callback.Status != "delivered" || job.Callback.Attempts != 2 {
+		t.Fatalf("callback %+v", job.Callback)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 1 || got[0].JobID != created.JobID || got[0].Status != jobDone || got[0].Version != 1 || got[0].ResultURL != "/rank/jobs/"+created.JobID {
+		t.Errorf("payload %+v", got)
+	}
+}
+
+func TestWebhookDeliverGivesUp(t *testing.T) {
+	status := http.StatusBadRequest
+	calls := 0
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+	defer hook.Close()
+	wh := Webhook{Secret: "k", Attempts: 3, Backoff: time.Millisecond, Allow: loopback}
+
+	// A 4xx other than 408/429 is not retried.
+	if n, err := wh.deliver(context.Background(), hook.URL, callbackPayload{}, ""); err == nil || n != 1 || calls != 1 {
+		t.Errorf("400: attempts %d, calls %d, err %v", n, calls, err)
+	}
+	status, calls = http.StatusServiceUnavailable, 0
+	if n, err := wh.deliver(context.Background(), hook.URL, callbackPayload{}, ""); err == nil || n != 3 || calls != 3 {
+		t.Errorf("503: attempts %d, calls %d, err %v", n, calls, err)
+	}
+}
+
+func TestCallbackURLRejected(t *testing.T) {
+	ts := newTestServer(t, nil)
+	for path, body := range map[string]string{
+		// No webhook secret configured.
+		"/rank/jobs": `{"callback_url":"https://example.com/hook","items":[]}`,
+		"/rank":      `{"callback_url":"https://example.com/hook","items":[]}`,
+	} {
+		if resp := do(t, "POST", ts.URL+path, body, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", path, resp.StatusCode)
+		}
+	}
+	var wh Webhook
+	for _, u := range []string{
+		"/relative",
+		"ftp://example.com/x",
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://[::1]/hook",
+		"http://10.1.2.3/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::ffff:192.168.0.1]/hook",
+		"http://100.64.0.1/hook",
+	} {
+		if err := wh.validateCallbackURL(u); err == nil {
+			t.Errorf("%s: expected error", u)
+		}
+	}
+	if err := wh.validateCallbackURL("https://hooks.example.com/x"); err != nil {
+		t.Error(err)
+	}
+	wh.Allow = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	if err := wh.validateCallbackURL("http://10.1.2.3/hook"); err != nil {
+		t.Errorf("allowed range: %v", err)
+	}
+}
+
+func TestWebhookRefusesInternalAddresses(t *testing.T) {
+	calls := 0
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer hook.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(hook.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+	_, port, _ := net.SplitHostPort(hook.Listener.Addr().String())
+	wh := Webhook{Secret: "k", Attempts: 3, Backoff: time.Millisecond}
+
+	// The address is checked once resolved, and refusing it is final.
+	for _, target := range []string{hook.URL, "http://localhost:" + port} {
+		if n, err := wh.deliver(context.Background(), target, callbackPayload{}, ""); !errors.Is(err, errCallbackAddr) || n != 1 || calls != 0 {
+			t.Errorf("%s: attempts %d, calls %d, err %v", target, n, calls, err)
+		}
+	}
+
+	// Redirects aren't followed, even to an allowed address.
+	wh.Allow = loopback
+	if n, err := wh.deliver(context.Background(), redirect.URL, callbackPayload{}, ""); err == nil || n != 1 || calls != 0 {
+		t.Errorf("redirect: attempts %d, calls %d, err %v", n, calls, err)
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+
+	"ranking-go/internal/xlsx"
+)
+
+// xlsxColumns are the columns of a cohort's spreadsheet export.
+var xlsxColumns = []xlsx.Column{
+	{Header: "Rank", Width: 8, Format: xlsx.Integer},
+	{Header: "User", Width: 28},
+	{Header: "Percent", Width: 10, Format: xlsx.Decimal2},
+	{Header: "Percentile", Width: 11, Format: xlsx.Decimal2},
+	{Header: "Tier", Width: 12},
+}
+
+// exportXLSXHandler streams a stored ranking as an Excel workbook, one row
+// per user, best first. Ranks follow the server's rank_base and a withheld
+// percentile is left blank. The tier is the user's badge if the cohort has
+// a badge ladder, blank below it; only without one is it the item's tier
+// group, blank for items without one.
+func (s *Server) exportXLSXHandler(w http.ResponseWriter, r *http.Request) {
+	t := s.resolveTenant(w, r)
+	if t == nil {
+		return
+	}
+	stored, err := s.Store.Get(r.Context(), t.ID, r.PathValue("cohort_id"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	if s.notModified(w, r, t.ID, stored) {
+		return
+	}
+	badged := len(stored.Options.Badges) > 0
+	var tiers map[string]string
+	if !badged {
+		tiers = make(map[string]string, len(stored.Items))
+		for _, it := range stored.Items {
+			if it.Tier != "" {
+				tiers[it.UserID] = it.Tier
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", xlsx.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": stored.CohortID + ".xlsx"}))
+	x, err := xlsx.NewWriter(w, stored.CohortID, xlsxColumns)
+	if err == nil {
+		base := s.Defaults.rankBase()
+		for _, res := range stored.Results {
+			var pct any
+			if !res.PercentileNull {
+				pct = res.Percentile
+			}
+			tier := res.Badge
+			if !badged {
+				tier = tiers[res.UserID]
+			}
+			x.WriteRow(rebase(res.Rank, base), res.UserID, res.Percent, pct, tier)
+		}
+		err = x.Close()
+	}
+	if err != nil {
+		// The status is sent; all that's left is to cut the file short.
+		s.logger().Warn("xlsx export", "request_id", requestID(r.Context()), "cohort_id", stored.CohortID, "error", err)
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestExportXLSX(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"mock 1","tier_order":["gold","silver"],"items":[
+		{"user_id":"a","percent":70,"tier":"silver"},
+		{"user_id":"b","percent":60,"tier":"gold"},
+		{"user_id":"c","percent":90,"tier":"silver"}]}`, nil)
+
+	resp := do(t, "GET", ts.URL+"/rank/mock%201/export.xlsx", "", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" {
+		t.Fatalf("%d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if cd := resp.Header.Get("Content-Disposition"); cd != `attachment; filename="mock 1.xlsx"` {
+		t.Errorf("Content-Disposition %q", cd)
+	}
+	wantSheet(t, sheetRows(t, resp), [][]string{
+		{"Rank", "User", "Percent", "Percentile", "Tier"},
+		{"1", "b", "60", "100", "gold"},
+		{"2", "c", "90", "50", "silver"},
+		{"3", "a", "70", "0", "silver"},
+	})
+
+	if again := do(t, "GET", ts.URL+"/rank/mock%201/export.xlsx", "", map[string]string{"If-None-Match": resp.Header.Get("ETag")}); again.StatusCode != http.StatusNotModified {
+		t.Errorf("revalidated: %d, want 304", again.StatusCode)
+	}
+	if resp := do(t, "GET", ts.URL+"/rank/missing/export.xlsx", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing cohort: %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestExportXLSXBadges(t *testing.T) {
+	ts := newTestServer(t, nil)
+	do(t, "POST", ts.URL+"/rank", `{"cohort_id":"mock","badges":[{"name":"Gold","min_percentile":90},{"name":"Silver","min_percentile":40}],"items":[
+		{"user_id":"a","percent":70,"tier":"group-1"},
+		{"user_id":"b","percent":60,"tier":"group-2"},
+		{"user_id":"c","percent":90}]}`, nil)
+
+	// The badge, not the item's tier group; blank below the ladder.
+	wantSheet(t, sheetRows(t, do(t, "GET", ts.URL+"/rank/mock/export.xlsx", "", nil)), [][]string{
+		{"Rank", "User", "Percent", "Percentile", "Tier"},
+		{"1", "c", "90", "100", "Gold"},
+		{"2", "a", "70", "50", "Silver"},
+		{"3", "b", "60", "0", ""},
+	})
+}
+
+// sheetRows reads the cell values of an XLSX response's first sheet.
+func sheetRows(t *testing.T, resp *http.Response) [][]string {
+	t.Helper()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.NewDecoder(f).Decode(&sheet); err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, row := range sheet.Rows {
+		var cells []string
+		for _, c := range row.Cells {
+			cells = append(cells, c.Value+c.Inline)
+		}
+		got = append(got, cells)
+	}
+	return got
+}
+
+// wantSheet compares rows; a missing trailing cell reads as blank.
+func wantSheet(t *testing.T, got, want [][]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("rows %v", got)
+	}
+	for i := range want {
+		for j := range want[i] {
+			cell := ""
+			if j < len(got[i]) {
+				cell = got[i][j]
+			}
+			if cell != want[i][j] {
+				t.Errorf("row %d: %v, want %v", i, got[i], want[i])
+				break
+			}
+		}
+	}
+}
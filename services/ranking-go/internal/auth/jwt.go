@@ -0,0 +1,352 @@
+// Package auth verifies JWT bearer tokens against a JWKS endpoint and
+// carries the authenticated caller through request contexts.
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // SHA-256 for RS256/ES256
+	_ "crypto/sha512" // SHA-384 and SHA-512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidToken wraps every reason a token is rejected.
+var ErrInvalidToken = errors.New("invalid token")
+
+const (
+	// jwksTTL is how long fetched keys are trusted before a refetch.
+	jwksTTL = 10 * time.Minute
+	// minRefresh spaces fetch attempts, failed or not, so forged kids or
+	// a failing JWKS endpoint can't make us hammer it.
+	minRefresh = 30 * time.Second
+	// leeway tolerates clock skew on exp and nbf.
+	leeway = time.Minute
+)
+
+// JWTVerifier checks RS256/384/512 and ES256/384/512 tokens signed by a key
+// from JWKSURL.
+type JWTVerifier struct {
+	JWKSURL string
+	// Issuer and Audience, when set, must match iss and be one of aud.
+	Issuer   string
+	Audience string
+	// TenantClaim names the claim holding the caller's tenant; "" means
+	// "tenant".
+	TenantClaim string
+	Client      *http.Client
+
+	mu   sync.Mutex
+	keys map[string]crypto.PublicKey
+	// fetched is when keys were fetched, attempted when a fetch last
+	// started and fetchErr how it failed, if it did. refreshing is closed
+	// when the fetch in flight, if any, is done.
+	fetched    time.Time
+	attempted  time.Time
+	fetchErr   error
+	refreshing chan struct{}
+}
+
+// Claims are the verified token's claims used here.
+type Claims struct {
+	Subject string
+	Tenant  string
+}
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidToken, fmt.Sprintf(format, args...))
+}
+
+// Verify checks token's signature and registered claims and returns its
+// subject and tenant.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, invalid("malformed")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, invalid("header: %v", err)
+	}
+	hash, ok := map[string]crypto.Hash{
+		"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+		"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+	}[header.Alg]
+	if !ok {
+		return Claims{}, invalid("unsupported alg %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, invalid("signature encoding")
+	}
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(key, header.Alg, hash, h.Sum(nil), sig); err != nil {
+		return Claims{}, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, invalid("claims: %v", err)
+	}
+	return v.checkClaims(claims)
+}
+
+func verifySignature(key crypto.PublicKey, alg string, hash crypto.Hash, digest, sig []byte) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg[:2] != "RS" {
+			return invalid("alg %s does not match an RSA key", alg)
+		}
+		if rsa.VerifyPKCS1v15(k, hash, digest, sig) != nil {
+			return invalid("bad signature")
+		}
+	case *ecdsa.PublicKey:
+		// Each ES alg names one curve (RFC 7518 §3.4); a P-256 key must
+		// not verify an ES512 token, nor the reverse.
+		curve := map[string]string{"ES256": "P-256", "ES384": "P-384", "ES512": "P-521"}[alg]
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if curve != k.Curve.Params().Name || len(sig) != 2*size {
+			return invalid("alg %s does not match the EC key", alg)
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return invalid("bad signature")
+		}
+	default:
+		return invalid("unsupported key type")
+	}
+	return nil
+}
+
+func (v *JWTVerifier) checkClaims(c map[string]any) (Claims, error) {
+	now := time.Now()
+	exp, ok := c["exp"].(float64)
+	if !ok {
+		return Claims{}, invalid("missing exp")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return Claims{}, invalid("expired")
+	}
+	if nbf, ok := c["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return Claims{}, invalid("not yet valid")
+	}
+	if v.Issuer != "" && c["iss"] != v.Issuer {
+		return Claims{}, invalid("issuer %v", c["iss"])
+	}
+	if v.Audience != "" && !hasAudience(c["aud"], v.Audience) {
+		return Claims{}, invalid("audience %v", c["aud"])
+	}
+	claim := v.TenantClaim
+	if claim == "" {
+		claim = "tenant"
+	}
+	sub, _ := c["sub"].(string)
+	tenant, _ := c[claim].(string)
+	return Claims{Subject: sub, Tenant: tenant}, nil
+}
+
+func hasAudience(aud any, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []any:
+		return slices.Contains(a, any(want))
+	}
+	return false
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// key returns the signing key for kid, refetching the JWKS when the cache
+// is stale or doesn't know kid. A token without kid is accepted only when
+// the set has a single key.
+//
+// One fetch runs at a time, in the background, and without holding v.mu:
+// a known key is returned at once even if stale, so a slow or failing
+// JWKS endpoint only holds up tokens signed by keys not yet seen.
+func (v *JWTVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	now := time.Now()
+	k, known := v.lookup(kid)
+	if known && now.Sub(v.fetched) <= jwksTTL {
+		v.mu.Unlock()
+		return k, nil
+	}
+	if v.refreshing == nil && now.Sub(v.attempted) > minRefresh {
+		v.attempted = now
+		v.refreshing = make(chan struct{})
+		go v.refresh(context.WithoutCancel(ctx), v.refreshing)
+	}
+	done := v.refreshing
+	v.mu.Unlock()
+	if known {
+		// Keep serving known keys through a JWKS outage.
+		return k, nil
+	}
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if k, ok := v.lookup(kid); ok {
+		return k, nil
+	}
+	if v.fetchErr != nil {
+		return nil, fmt.Errorf("jwks: %w", v.fetchErr)
+	}
+	return nil, invalid("unknown key %q", kid)
+}
+
+// refresh fetches the JWKS, keeping the keys known so far if it fails,
+// and closes done.
+func (v *JWTVerifier) refresh(ctx context.Context, done chan struct{}) {
+	keys, err := v.fetch(ctx)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err == nil {
+		v.keys, v.fetched = keys, time.Now()
+	}
+	v.fetchErr = err
+	v.refreshing = nil
+	close(done)
+}
+
+func (v *JWTVerifier) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" {
+		if len(v.keys) != 1 {
+			return nil, false
+		}
+		for _, k := range v.keys {
+			return k, true
+		}
+	}
+	k, ok := v.keys[kid]
+	return k, ok
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// maxJWKSBytes caps the key set read from JWKSURL; real sets are a few
+// KiB.
+const maxJWKSBytes = 1 << 20
+
+func (v *JWTVerifier) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", v.JWKSURL, resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBytes)).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// Skip keys we can't use rather than failing the whole set.
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	b64 := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("bad key parameter")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := b64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("bad exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, ok := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported kty %q", k.Kty)
+}
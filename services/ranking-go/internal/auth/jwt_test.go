@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding
+
+// sign builds a compact JWS over claims with key (RSA or EC), hashing as
+// alg says whatever the key.
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	input := b64.EncodeToString(h) + "." + b64.EncodeToString(c)
+	hash := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}[alg[2:]]
+	digest := hash.New()
+	digest.Write([]byte(input))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, hash, digest.Sum(nil)); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+	}
+	return input + "." + b64.EncodeToString(sig)
+}
+
+func rsaJWK(kid string, k *rsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "use": "sig",
+		"n": b64.EncodeToString(k.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(k.E)).Bytes())}
+}
+
+func ecJWK(kid string, k *ecdsa.PublicKey) map[string]string {
+	size := (k.Curve.Params().BitSize + 7) / 8
+	return map[string]string{"kty": "EC", "kid": kid, "crv": k.Curve.Params().Name,
+		"x": b64.EncodeToString(k.X.FillBytes(make([]byte, size))), "y": b64.EncodeToString(k.Y.FillBytes(make([]byte, size)))}
+}
+
+// jwksServer serves *keys and counts fetches.
+func jwksServer(t *testing.T, keys *atomic.Value, fetches *atomic.Int32) string {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys.Load()})
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var keys atomic.Value
+	var fetches atomic.Int32
+	keys.Store([]map[string]string{rsaJWK("r1", &rsaKey.PublicKey), ecJWK("e1", &ecKey.PublicKey)})
+	v := &JWTVerifier{JWKSURL: jwksServer(t, &keys, &fetches), Issuer: "https://id.example", Audience: "ranking", TenantClaim: "org"}
+
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	good := map[string]any{"iss": "https://id.example", "aud": []string{"other", "ranking"}, "sub": "svc-1", "org": "uni-a", "exp": exp}
+	with := func(k string, val any) map[string]any {
+		c := map[string]any{}
+		for k, v := range good {
+			c[k] = v
+		}
+		if val == nil {
+			delete(c, k)
+		} else {
+			c[k] = val
+		}
+		return c
+	}
+
+	for _, tok := range []string{sign(t, "RS256", "r1", rsaKey, good), sign(t, "ES256", "e1", ecKey, good)} {
+		c, err := v.Verify(context.Background(), tok)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != (Claims{Subject: "svc-1", Tenant: "uni-a"}) {
+			t.Fatalf("claims = %+v", c)
+		}
+	}
+
+	bad := map[string]string{
+		"expired":       sign(t, "ES256", "e1", ecKey, with("exp", float64(time.Now().Add(-time.Hour).Unix()))),
+		"no exp":        sign(t, "ES256", "e1", ecKey, with("exp", nil)),
+		"not yet valid": sign(t, "ES256", "e1", ecKey, with("nbf", float64(time.Now().Add(time.Hour).Unix()))),
+		"issuer":        sign(t, "ES256", "e1", ecKey, with("iss", "https://evil.example")),
+		"audience":      sign(t, "ES256", "e1", ecKey, with("aud", "other")),
+		"wrong key":     sign(t, "ES256", "e1", otherKey, good),
+		"alg mismatch":  sign(t, "RS256", "e1", rsaKey, good),
+		"unknown kid":   sign(t, "ES256", "nope", ecKey, good),
+		"alg none":      b64.EncodeToString([]byte(`{"alg":"none"}`)) + "." + b64.EncodeToString([]byte(`{}`)) + ".",
+		"malformed":     "abc",
+	}
+	for name, tok := range bad {
+		if _, err := v.Verify(context.Background(), tok); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestVerifyECCurves(t *testing.T) {
+	keys := map[string]*ecdsa.PrivateKey{}
+	var jwks []map[string]string
+	for _, c := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		k, _ := ecdsa.GenerateKey(c, rand.Reader)
+		keys[c.Params().Name] = k
+		jwks = append(jwks, ecJWK(c.Params().Name, &k.PublicKey))
+	}
+	var set atomic.Value
+	var fetches atomic.Int32
+	set.Store(jwks)
+	v := &JWTVerifier{JWKSURL: jwksServer(t, &set, &fetches)}
+	claims := map[string]any{"exp": float64(time.Now().Add(time.Hour).Unix())}
+
+	// Each alg verifies only with its own curve's key, even when the
+	// signature is the right size, as ES256 under a P-384 key would be.
+	algs := map[string]string{"ES256": "P-256", "ES384": "P-384", "ES512": "P-521"}
+	for alg, want := range algs {
+		for crv, k := range keys {
+			_, err := v.Verify(context.Background(), sign(t, alg, crv, k, claims))
+			if crv == want && err != nil {
+				t.Errorf("%s with %s: %v", alg, crv, err)
+			}
+			if crv != want && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("%s with %s: err = %v, want ErrInvalidToken", alg, crv, err)
+			}
+		}
+	}
+}
+
+func TestVerifyJWKSTooLarge(t *testing.T) {
+	k, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, _ := json.Marshal(ecJWK("k1", &k.PublicKey))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Valid JSON, but padded past maxJWKSBytes.
+		w.Write([]byte(`{"keys": [` + strings.Repeat(" ", maxJWKSBytes) + string(key) + `]}`))
+	}))
+	t.Cleanup(ts.Close)
+	v := &JWTVerifier{JWKSURL: ts.URL}
+	claims := map[string]any{"exp": float64(time.Now().Add(time.Hour).Unix())}
+	if _, err := v.Verify(context.Background(), sign(t, "ES256", "k1", k, claims)); err == nil {
+		t.Error("verified against a key set over the size limit")
+	}
+}
+
+func TestVerifyKeyRotation(t *testing.T) {
+	k1, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	k2, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var keys atomic.Value
+	var fetches atomic.Int32
+	keys.Store([]map[string]string{ecJWK("k1", &k1.PublicKey)})
+	v := &JWTVerifier{JWKSURL: jwksServer(t, &keys, &fetches)}
+	claims := map[string]any{"exp": float64(time.Now().Add(time.Hour).Unix())}
+
+	if _, err := v.Verify(context.Background(), sign(t, "ES256", "k1", k1, claims)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(context.Background(), sign(t, "ES256", "k1", k1, claims)); err != nil {
+		t.Fatal(err)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("fetches = %d, want keys cached", n)
+	}
+
+	// A new kid refetches, but no more often than minRefresh.
+	keys.Store([]map[string]string{ecJWK("k1", &k1.PublicKey), ecJWK("k2", &k2.PublicKey)})
+	if _, err := v.Verify(context.Background(), sign(t, "ES256", "k2", k2, claims)); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("err = %v, want unknown key within minRefresh", err)
+	}
+	v.mu.Lock()
+	v.attempted = v.attempted.Add(-minRefresh - time.Second)
+	v.mu.Unlock()
+	if _, err := v.Verify(context.Background(), sign(t, "ES256", "k2", k2, claims)); err != nil {
+		t.Fatal(err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Fatalf("fetches = %d, want 2", n)
+	}
+}
+
+func TestVerifyJWKSFailureBacksOff(t *testing.T) {
+	k, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(ts.Close)
+	v := &JWTVerifier{JWKSURL: ts.URL}
+	token := sign(t, "ES256", "k1", k, map[string]any{"exp": float64(time.Now().Add(time.Hour).Unix())})
+
+	// A failed fetch counts as an attempt, and its error is reported
+	// until the next one.
+	for range 3 {
+		if _, err := v.Verify(context.Background(), token); err == nil || errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("err = %v, want a JWKS error", err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetches = %d, want 1 within minRefresh", n)
+	}
+}
+
+func TestVerifyStaleKeysDontWaitForRefresh(t *testing.T) {
+	k, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var keys atomic.Value
+	var fetches atomic.Int32
+	keys.Store([]map[string]string{ecJWK("k1", &k.PublicKey)})
+	url := jwksServer(t, &keys, &fetches)
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+	v := &JWTVerifier{JWKSURL: url}
+	claims := map[string]any{"exp": float64(time.Now().Add(time.Hour).Unix())}
+	if _, err := v.Verify(context.Background(), sign(t, "ES256", "k1", k, claims)); err != nil {
+		t.Fatal(err)
+	}
+
+	// With the cache stale and the endpoint hanging, the known key still
+	// verifies at once, and a token with an unknown kid gives up with its
+	// context rather than holding anyone else up.
+	v.mu.Lock()
+	v.JWKSURL = slow.URL
+	v.fetched = v.fetched.Add(-jwksTTL - time.Second)
+	v.attempted = v.attempted.Add(-jwksTTL - time.Second)
+	v.mu.Unlock()
+	start := time.Now()
+	for range 3 {
+		if _, err := v.Verify(context.Background(), sign(t, "ES256", "k1", k, claims)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := v.Verify(ctx, sign(t, "ES256", "k2", k, claims)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unknown kid: err = %v, want deadline exceeded", err)
+	}
+	if _, err := v.Verify(context.Background(), sign(t, "ES256", "k1", k, claims)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("verifying took %v", d)
+	}
+}
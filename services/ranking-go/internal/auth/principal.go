@@ -0,0 +1,31 @@
+package auth
+
+import "context"
+
+// Ways a caller can authenticate.
+const (
+	MethodJWT        = "jwt"
+	MethodServiceKey = "service_key"
+)
+
+// Principal is an authenticated caller. Tenant is set for JWT callers from
+// the tenant claim; service-key callers name their tenant with X-Tenant.
+type Principal struct {
+	Method  string
+	Subject string
+	Tenant  string
+}
+
+type principalKey struct{}
+
+// NewContext returns ctx carrying p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the request's principal, or nil if it authenticated
+// some other way (a tenant API key) or not at all.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
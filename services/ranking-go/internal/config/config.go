@@ -0,0 +1,711 @@
+// Package config resolves the service's process settings — listen address,
+// timeouts, store backend, logging, feature toggles, secrets and export
+// targets — from built-in defaults, the config file, environment variables
+// and command-line flags, each overriding the one before.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ranking-go/internal/ratelimit"
+	"ranking-go/internal/rating"
+)
+
+// Duration is a time.Duration written as a Go duration string ("90s").
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"90s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config is the "server" section of the config file. Ranking defaults live
+// in its "defaults" section, read by the api package; secrets (admin
+// token, webhook secret, S3 keys) and OpenTelemetry settings come only
+// from the environment.
+type Config struct {
+	Addr string `json:"addr"`
+	// GRPCAddr serves the RankingService over gRPC on a second listener;
+	// empty leaves it off.
+	GRPCAddr      string      `json:"grpc_addr,omitempty"`
+	LogLevel      string      `json:"log_level"`
+	ReadTimeout   Duration    `json:"read_timeout"`
+	WriteTimeout  Duration    `json:"write_timeout"`
+	IdleTimeout   Duration    `json:"idle_timeout"`
+	ShutdownGrace Duration    `json:"shutdown_grace_period"`
+	TenantsFile   string      `json:"tenants_file,omitempty"`
+	JobWorkers    int         `json:"job_workers"`
+	RankWorkers   int         `json:"rank_workers"`
+	Store         Store       `json:"store"`
+	SortSpill     Spill       `json:"sort_spill"`
+	Features      Features    `json:"features"`
+	Auth          Auth        `json:"auth"`
+	RateLimit     RateLimit   `json:"rate_limit"`
+	Limits        Limits      `json:"limits"`
+	Ratings       Ratings     `json:"ratings"`
+	Kafka         Kafka       `json:"kafka"`
+	Cache         Cache       `json:"cache"`
+	Compression   Compression `json:"compression"`
+	Webhook       Webhook     `json:"webhook"`
+	Exports       Exports     `json:"exports"`
+	// AdminToken enables the admin endpoints for bearers of it; empty
+	// leaves them off.
+	AdminToken string `json:"admin_token,omitempty"`
+
+	// File is the config file read, if any.
+	File string `json:"-"`
+}
+
+// Store selects where rankings are kept.
+type Store struct {
+	// Backend is memory, postgres or redis; empty picks from the URLs.
+	Backend        string `json:"backend,omitempty"`
+	DatabaseURL    string `json:"database_url,omitempty"`
+	DatabaseDriver string `json:"database_driver"`
+	RedisURL       string `json:"redis_url,omitempty"`
+}
+
+// Spill configures the on-disk sort; Threshold 0 always sorts in memory.
+type Spill struct {
+	Threshold int    `json:"threshold"`
+	Dir       string `json:"dir,omitempty"`
+}
+
+// Features switches optional endpoint groups off.
+type Features struct {
+	Jobs    bool `json:"jobs"`
+	Metrics bool `json:"metrics"`
+}
+
+// Auth configures caller authentication.
+type Auth struct {
+	// Required rejects requests without a JWT or API key.
+	Required bool `json:"required"`
+	// ServiceKeys are API keys for internal services, which name their
+	// tenant.
+	ServiceKeys []string `json:"service_keys,omitempty"`
+	// JWKSURL enables JWT bearer tokens signed by the keys it serves.
+	JWKSURL     string `json:"jwks_url,omitempty"`
+	Issuer      string `json:"issuer,omitempty"`
+	Audience    string `json:"audience,omitempty"`
+	TenantClaim string `json:"tenant_claim"`
+}
+
+// RateLimit throttles each client; see api.RateLimit. A zero rate is
+// unlimited.
+type RateLimit struct {
+	ratelimit.Limit
+	// Routes overrides the limit per route pattern, e.g. "POST /rank".
+	Routes            map[string]ratelimit.Limit `json:"routes,omitempty"`
+	TrustForwardedFor bool                       `json:"trust_forwarded_for"`
+}
+
+// Limits bounds what one request may carry.
+type Limits struct {
+	// MaxBodyBytes caps request bodies; 0 is unlimited.
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+	// MaxItems caps items per cohort for every tenant, on top of each
+	// tenant's own max_items; 0 is unlimited.
+	MaxItems int `json:"max_items"`
+	// MinPercent and MaxPercent bound item percents.
+	MinPercent float64 `json:"min_percent"`
+	MaxPercent float64 `json:"max_percent"`
+}
+
+// Ratings configures the head-to-head rating tables of /ratings.
+type Ratings struct {
+	// System is the rating system of new tables, elo or glicko2; Cohorts
+	// overrides it by cohort ID. A table keeps the system it was created
+	// with.
+	System  string            `json:"system"`
+	Cohorts map[string]string `json:"cohorts,omitempty"`
+	// KFactor is the most an Elo rating moves in one match; a request may
+	// override it.
+	KFactor float64 `json:"k_factor"`
+	// InitialRating is a player's rating before their first match.
+	InitialRating float64 `json:"initial_rating"`
+	// InitialDeviation, InitialVolatility and Tau configure Glicko-2.
+	InitialDeviation  float64 `json:"initial_deviation"`
+	InitialVolatility float64 `json:"initial_volatility"`
+	Tau               float64 `json:"tau"`
+}
+
+// Kafka configures worker mode, which applies score events consumed from
+// a topic; see api.Server.ConsumeScores. No brokers leaves it off.
+type Kafka struct {
+	Brokers []string `json:"brokers,omitempty"`
+	Topic   string   `json:"topic,omitempty"`
+	// Group is the consumer group whose committed offsets are resumed.
+	Group string `json:"group"`
+	// Start is where a group without committed offsets begins, earliest
+	// or latest.
+	Start string `json:"start"`
+	// TLS connects to the brokers over TLS, trusting CAFile's
+	// certificates if set and the system roots otherwise.
+	TLS    bool   `json:"tls,omitempty"`
+	CAFile string `json:"ca_file,omitempty"`
+	// SASL is PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, authenticating as
+	// Username; empty leaves it off.
+	SASL     string `json:"sasl,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Cache configures the leaderboard and stats response cache; see
+// api.ResponseCache. A zero MaxBytes leaves it off.
+type Cache struct {
+	MaxBytes int64    `json:"max_bytes"`
+	TTL      Duration `json:"ttl"`
+	// RedisURL adds a tier shared by replicas, which also carries
+	// invalidations between them.
+	RedisURL string `json:"redis_url,omitempty"`
+}
+
+// Compression configures gzip responses; see api.Server.Compression.
+// Gzip request bodies are always accepted.
+type Compression struct {
+	Enabled bool `json:"enabled"`
+	// MinBytes is the smallest response body worth compressing.
+	MinBytes int `json:"min_bytes"`
+	// Level is the gzip level, 1 (fastest) to 9 (smallest).
+	Level int `json:"level"`
+}
+
+// Webhook configures job callbacks; see api.Webhook.
+type Webhook struct {
+	// Secret signs callbacks; without it callback_url is rejected.
+	Secret string `json:"secret,omitempty"`
+	// Allow lists non-public address ranges callbacks may still reach.
+	Allow []netip.Prefix `json:"allow,omitempty"`
+}
+
+// Exports configures the targets a /rank request may write results to;
+// see package export. Each is off until set.
+type Exports struct {
+	// Dir is the local directory of the "local" target.
+	Dir string   `json:"dir,omitempty"`
+	S3  ExportS3 `json:"s3"`
+}
+
+// ExportS3 is the "s3" target, on when Bucket is set.
+type ExportS3 struct {
+	Bucket          string `json:"bucket,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	Region          string `json:"region,omitempty"`
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	// PathStyle addresses objects as endpoint/bucket/key, for MinIO.
+	PathStyle bool `json:"path_style,omitempty"`
+}
+
+// SystemFor returns the rating system for a new table of cohortID.
+func (r Ratings) SystemFor(cohortID string) string {
+	if s, ok := r.Cohorts[cohortID]; ok {
+		return s
+	}
+	return r.System
+}
+
+// minSecretLen is the shortest admin token, webhook secret or service key
+// accepted, so a placeholder can't slip into production.
+const minSecretLen = 16
+
+// Default returns the settings used when nothing overrides them.
+func Default() Config {
+	return Config{
+		Addr:          ":8080",
+		LogLevel:      "info",
+		ReadTimeout:   Duration(2 * time.Minute),
+		WriteTimeout:  Duration(5 * time.Minute),
+		IdleTimeout:   Duration(2 * time.Minute),
+		ShutdownGrace: Duration(30 * time.Second),
+		JobWorkers:    2,
+		Store:         Store{DatabaseDriver: "pgx"},
+		Features:      Features{Jobs: true, Metrics: true},
+		Auth:          Auth{TenantClaim: "tenant"},
+		Limits:        Limits{MaxBodyBytes: 256 << 20, MaxItems: 2_000_000, MaxPercent: 100},
+		Ratings:       Ratings{System: rating.SystemElo, KFactor: 32, InitialRating: 1500, InitialDeviation: 350, InitialVolatility: 0.06, Tau: 0.5},
+		Kafka:         Kafka{Group: "ranking-go", Start: "earliest"},
+		Cache:         Cache{MaxBytes: 64 << 20, TTL: Duration(30 * time.Second)},
+		Compression:   Compression{Enabled: true, MinBytes: 1024, Level: 6},
+	}
+}
+
+// Load resolves the configuration from args (without the program name)
+// and getenv. The config file is -config, else CONFIG_FILE; it may be
+// JSON or, by its .yaml/.yml extension, YAML.
+func Load(args []string, getenv func(string) string) (Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("ranking-go", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("CONFIG_FILE"), "config file (JSON or YAML)")
+	addr := fs.String("addr", "", "listen address, e.g. :8080")
+	logLevel := fs.String("log-level", "", "debug, info, warn or error")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if fs.NArg() > 0 {
+		return cfg, fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+
+	if *configFile != "" {
+		b, err := ReadFile(*configFile)
+		if err != nil {
+			return cfg, err
+		}
+		var doc struct {
+			Server json.RawMessage `json:"server"`
+		}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return cfg, fmt.Errorf("%s: %w", *configFile, err)
+		}
+		if len(doc.Server) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(doc.Server))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&cfg); err != nil {
+				return cfg, fmt.Errorf("%s: server: %w", *configFile, err)
+			}
+		}
+		cfg.File = *configFile
+	}
+
+	if err := cfg.applyEnv(getenv); err != nil {
+		return cfg, err
+	}
+	if *addr != "" {
+		cfg.Addr = *addr
+	}
+	if *logLevel != "" {
+		cfg.LogLevel = *logLevel
+	}
+	return cfg, cfg.Validate()
+}
+
+// ReadFile reads a config file as JSON, converting it first if its
+// extension is .yaml or .yml.
+func ReadFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if b, err = yamlToJSON(b); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return b, nil
+}
+
+func (c *Config) applyEnv(getenv func(string) string) error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v := getenv(name); v != "" {
+			*dst = v
+		}
+	}
+	// list reads a comma-separated list, skipping empty entries.
+	list := func(name string, dst *[]string) {
+		if v := getenv(name); v != "" {
+			*dst = []string{}
+			for _, s := range strings.Split(v, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					*dst = append(*dst, s)
+				}
+			}
+		}
+	}
+	num := func(name string, dst *int) {
+		if v := getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be an integer, got %q", name, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	dur := func(name string, dst *Duration) {
+		if v := getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a duration such as 90s, got %q", name, v))
+				return
+			}
+			*dst = Duration(d)
+		}
+	}
+	float := func(name string, dst *float64) {
+		if v := getenv(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a number, got %q", name, v))
+				return
+			}
+			*dst = f
+		}
+	}
+	toggle := func(name string, dst *bool) {
+		if v := getenv(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be true or false, got %q", name, v))
+				return
+			}
+			*dst = b
+		}
+	}
+
+	if p := getenv("PORT"); p != "" {
+		c.Addr = ":" + p
+	}
+	str("LISTEN_ADDR", &c.Addr)
+	str("GRPC_ADDR", &c.GRPCAddr)
+	str("LOG_LEVEL", &c.LogLevel)
+	dur("HTTP_READ_TIMEOUT", &c.ReadTimeout)
+	dur("HTTP_WRITE_TIMEOUT", &c.WriteTimeout)
+	dur("HTTP_IDLE_TIMEOUT", &c.IdleTimeout)
+	dur("SHUTDOWN_GRACE_PERIOD", &c.ShutdownGrace)
+	str("TENANTS_FILE", &c.TenantsFile)
+	num("JOB_WORKERS", &c.JobWorkers)
+	num("RANK_WORKERS", &c.RankWorkers)
+	str("STORE_BACKEND", &c.Store.Backend)
+	str("DATABASE_URL", &c.Store.DatabaseURL)
+	str("DATABASE_DRIVER", &c.Store.DatabaseDriver)
+	str("REDIS_URL", &c.Store.RedisURL)
+	num("SORT_SPILL_THRESHOLD", &c.SortSpill.Threshold)
+	str("SORT_SPILL_DIR", &c.SortSpill.Dir)
+	toggle("FEATURE_JOBS", &c.Features.Jobs)
+	toggle("FEATURE_METRICS", &c.Features.Metrics)
+	toggle("AUTH_REQUIRED", &c.Auth.Required)
+	list("SERVICE_API_KEYS", &c.Auth.ServiceKeys)
+	str("JWT_JWKS_URL", &c.Auth.JWKSURL)
+	str("JWT_ISSUER", &c.Auth.Issuer)
+	str("JWT_AUDIENCE", &c.Auth.Audience)
+	str("JWT_TENANT_CLAIM", &c.Auth.TenantClaim)
+	float("RATE_LIMIT_RPS", &c.RateLimit.Rate)
+	num("RATE_LIMIT_BURST", &c.RateLimit.Burst)
+	toggle("RATE_LIMIT_TRUST_FORWARDED_FOR", &c.RateLimit.TrustForwardedFor)
+	maxBody := int(c.Limits.MaxBodyBytes)
+	num("MAX_BODY_BYTES", &maxBody)
+	c.Limits.MaxBodyBytes = int64(maxBody)
+	num("MAX_ITEMS", &c.Limits.MaxItems)
+	str("RATING_SYSTEM", &c.Ratings.System)
+	float("RATING_K_FACTOR", &c.Ratings.KFactor)
+	float("RATING_INITIAL", &c.Ratings.InitialRating)
+	list("KAFKA_BROKERS", &c.Kafka.Brokers)
+	str("KAFKA_TOPIC", &c.Kafka.Topic)
+	str("KAFKA_GROUP", &c.Kafka.Group)
+	str("KAFKA_START", &c.Kafka.Start)
+	toggle("KAFKA_TLS", &c.Kafka.TLS)
+	str("KAFKA_TLS_CA_FILE", &c.Kafka.CAFile)
+	str("KAFKA_SASL_MECHANISM", &c.Kafka.SASL)
+	str("KAFKA_SASL_USERNAME", &c.Kafka.Username)
+	str("KAFKA_SASL_PASSWORD", &c.Kafka.Password)
+	cacheBytes := int(c.Cache.MaxBytes)
+	num("CACHE_MAX_BYTES", &cacheBytes)
+	c.Cache.MaxBytes = int64(cacheBytes)
+	dur("CACHE_TTL", &c.Cache.TTL)
+	str("CACHE_REDIS_URL", &c.Cache.RedisURL)
+	toggle("COMPRESSION_ENABLED", &c.Compression.Enabled)
+	num("COMPRESSION_MIN_BYTES", &c.Compression.MinBytes)
+	num("COMPRESSION_LEVEL", &c.Compression.Level)
+	str("WEBHOOK_SECRET", &c.Webhook.Secret)
+	var allow []string
+	list("WEBHOOK_ALLOW", &allow)
+	if allow != nil {
+		c.Webhook.Allow = nil
+		for _, s := range allow {
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("WEBHOOK_ALLOW must list CIDR ranges, got %q", s))
+				continue
+			}
+			c.Webhook.Allow = append(c.Webhook.Allow, p)
+		}
+	}
+	str("EXPORT_DIR", &c.Exports.Dir)
+	str("S3_BUCKET", &c.Exports.S3.Bucket)
+	str("S3_ENDPOINT", &c.Exports.S3.Endpoint)
+	str("S3_REGION", &c.Exports.S3.Region)
+	str("S3_ACCESS_KEY_ID", &c.Exports.S3.AccessKeyID)
+	str("S3_SECRET_ACCESS_KEY", &c.Exports.S3.SecretAccessKey)
+	toggle("S3_PATH_STYLE", &c.Exports.S3.PathStyle)
+	str("ADMIN_TOKEN", &c.AdminToken)
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr must not be empty"))
+	}
+	if c.GRPCAddr != "" && c.GRPCAddr == c.Addr {
+		errs = append(errs, errors.New("grpc_addr must differ from addr"))
+	}
+	if _, err := c.Level(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, d := range []struct {
+		name string
+		v    Duration
+	}{
+		{"read_timeout", c.ReadTimeout}, {"write_timeout", c.WriteTimeout},
+		{"idle_timeout", c.IdleTimeout}, {"shutdown_grace_period", c.ShutdownGrace},
+	} {
+		if d.v <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", d.name, time.Duration(d.v)))
+		}
+	}
+	if c.JobWorkers <= 0 {
+		errs = append(errs, fmt.Errorf("job_workers must be positive, got %d", c.JobWorkers))
+	}
+	if c.RankWorkers < 0 {
+		errs = append(errs, fmt.Errorf("rank_workers must not be negative, got %d", c.RankWorkers))
+	}
+	if c.SortSpill.Threshold < 0 {
+		errs = append(errs, fmt.Errorf("sort_spill.threshold must not be negative, got %d", c.SortSpill.Threshold))
+	}
+	if _, err := c.Store.backend(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, validLimit("rate_limit", c.RateLimit.Limit)...)
+	routes := make([]string, 0, len(c.RateLimit.Routes))
+	for route := range c.RateLimit.Routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		method, path, ok := strings.Cut(route, " ")
+		if !ok || method == "" || !strings.HasPrefix(path, "/") {
+			errs = append(errs, fmt.Errorf("rate_limit.routes: want a route such as \"POST /rank\", got %q", route))
+		}
+		errs = append(errs, validLimit(fmt.Sprintf("rate_limit.routes[%q]", route), c.RateLimit.Routes[route])...)
+	}
+	if c.Limits.MaxBodyBytes < 0 || c.Limits.MaxItems < 0 {
+		errs = append(errs, errors.New("limits.max_body_bytes and limits.max_items must not be negative"))
+	}
+	if !(c.Limits.MinPercent < c.Limits.MaxPercent) {
+		errs = append(errs, fmt.Errorf("limits.min_percent must be below limits.max_percent, got %v and %v", c.Limits.MinPercent, c.Limits.MaxPercent))
+	}
+	errs = append(errs, c.Ratings.validate()...)
+	if len(c.Kafka.Brokers) > 0 {
+		if c.Kafka.Topic == "" || c.Kafka.Group == "" {
+			errs = append(errs, errors.New("kafka: brokers need a topic and group"))
+		}
+		if c.Kafka.Start != "earliest" && c.Kafka.Start != "latest" {
+			errs = append(errs, fmt.Errorf("kafka.start must be earliest or latest, got %q", c.Kafka.Start))
+		}
+		switch c.Kafka.SASL {
+		case "":
+		case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+			if c.Kafka.Username == "" {
+				errs = append(errs, errors.New("kafka.sasl needs a username"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("kafka.sasl must be PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, got %q", c.Kafka.SASL))
+		}
+		if c.Kafka.CAFile != "" && !c.Kafka.TLS {
+			errs = append(errs, errors.New("kafka.ca_file needs kafka.tls"))
+		}
+	}
+	if c.Cache.MaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("cache.max_bytes must not be negative, got %d", c.Cache.MaxBytes))
+	}
+	if c.Cache.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("cache.ttl must be positive, got %s", time.Duration(c.Cache.TTL)))
+	}
+	if c.Cache.RedisURL != "" {
+		if u, err := url.Parse(c.Cache.RedisURL); err != nil || u.Scheme != "redis" {
+			errs = append(errs, errors.New("cache.redis_url must be a redis:// URL"))
+		}
+	}
+	if c.Compression.MinBytes < 0 {
+		errs = append(errs, fmt.Errorf("compression.min_bytes must not be negative, got %d", c.Compression.MinBytes))
+	}
+	if c.Compression.Level < 1 || c.Compression.Level > 9 {
+		errs = append(errs, fmt.Errorf("compression.level must be in [1, 9], got %d", c.Compression.Level))
+	}
+	if c.Auth.JWKSURL != "" {
+		if u, err := url.Parse(c.Auth.JWKSURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("auth.jwks_url must be an http(s) URL, got %q", c.Auth.JWKSURL))
+		}
+		if c.Auth.TenantClaim == "" {
+			errs = append(errs, errors.New("auth.tenant_claim must not be empty"))
+		}
+	}
+	for _, s := range []struct {
+		name  string
+		value string
+	}{{"admin_token", c.AdminToken}, {"webhook.secret", c.Webhook.Secret}} {
+		if s.value != "" && len(s.value) < minSecretLen {
+			errs = append(errs, fmt.Errorf("%s must be at least %d characters", s.name, minSecretLen))
+		}
+	}
+	for i, k := range c.Auth.ServiceKeys {
+		if len(k) < minSecretLen {
+			errs = append(errs, fmt.Errorf("auth.service_keys[%d] must be at least %d characters", i, minSecretLen))
+		}
+	}
+	if s3 := c.Exports.S3; s3.Bucket != "" {
+		if u, err := url.Parse(s3.Endpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("exports.s3.endpoint must be an http(s) URL, got %q", s3.Endpoint))
+		}
+		if s3.Region == "" || s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+			errs = append(errs, errors.New("exports.s3 needs a region, access_key_id and secret_access_key"))
+		}
+	} else if s3 != (ExportS3{}) {
+		errs = append(errs, errors.New("exports.s3 settings need exports.s3.bucket"))
+	}
+	return errors.Join(errs...)
+}
+
+func (r Ratings) validate() []error {
+	var errs []error
+	validSystem := func(name, s string) {
+		if s != rating.SystemElo && s != rating.SystemGlicko2 {
+			errs = append(errs, fmt.Errorf("%s must be elo or glicko2, got %q", name, s))
+		}
+	}
+	validSystem("ratings.system", r.System)
+	cohorts := make([]string, 0, len(r.Cohorts))
+	for id := range r.Cohorts {
+		cohorts = append(cohorts, id)
+	}
+	sort.Strings(cohorts)
+	for _, id := range cohorts {
+		validSystem(fmt.Sprintf("ratings.cohorts[%q]", id), r.Cohorts[id])
+	}
+	for _, f := range []struct {
+		name string
+		v    float64
+	}{
+		{"k_factor", r.KFactor}, {"initial_rating", r.InitialRating},
+		{"initial_deviation", r.InitialDeviation}, {"initial_volatility", r.InitialVolatility}, {"tau", r.Tau},
+	} {
+		if !(f.v > 0) || math.IsInf(f.v, 1) {
+			errs = append(errs, fmt.Errorf("ratings.%s must be a positive number, got %v", f.name, f.v))
+		}
+	}
+	return errs
+}
+
+func validLimit(name string, l ratelimit.Limit) []error {
+	var errs []error
+	if l.Rate < 0 || math.IsNaN(l.Rate) || math.IsInf(l.Rate, 0) {
+		errs = append(errs, fmt.Errorf("%s.rate must be a non-negative number, got %v", name, l.Rate))
+	}
+	if l.Burst < 0 {
+		errs = append(errs, fmt.Errorf("%s.burst must not be negative, got %d", name, l.Burst))
+	}
+	return errs
+}
+
+// Level parses LogLevel.
+func (c Config) Level() (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return l, fmt.Errorf("log_level must be debug, info, warn or error, got %q", c.LogLevel)
+	}
+	return l, nil
+}
+
+// Kind returns the store backend, inferred from the URLs when unset.
+func (s Store) Kind() string {
+	b, _ := s.backend()
+	return b
+}
+
+func (s Store) backend() (string, error) {
+	switch s.Backend {
+	case "":
+		if s.DatabaseURL != "" && s.RedisURL != "" {
+			return "", errors.New("store: set database_url or redis_url, not both")
+		}
+		if s.DatabaseURL != "" {
+			return "postgres", nil
+		}
+		if s.RedisURL != "" {
+			return "redis", nil
+		}
+		return "memory", nil
+	case "memory":
+		return "memory", nil
+	case "postgres":
+		if s.DatabaseURL == "" {
+			return "", errors.New("store: postgres needs database_url")
+		}
+		return "postgres", nil
+	case "redis":
+		if s.RedisURL == "" {
+			return "", errors.New("store: redis needs redis_url")
+		}
+		return "redis", nil
+	}
+	return "", fmt.Errorf("store: backend must be memory, postgres or redis, got %q", s.Backend)
+}
+
+// Redacted returns c with the passwords in store and cache URLs and every
+// other secret masked, for display.
+func (c Config) Redacted() Config {
+	c.Store.DatabaseURL = redactURL(c.Store.DatabaseURL)
+	c.Store.RedisURL = redactURL(c.Store.RedisURL)
+	c.Cache.RedisURL = redactURL(c.Cache.RedisURL)
+	for _, s := range []*string{&c.Kafka.Password, &c.AdminToken, &c.Webhook.Secret, &c.Exports.S3.AccessKeyID, &c.Exports.S3.SecretAccessKey} {
+		if *s != "" {
+			*s = "[redacted]"
+		}
+	}
+	if len(c.Auth.ServiceKeys) > 0 {
+		keys := make([]string, len(c.Auth.ServiceKeys))
+		for i := range keys {
+			keys[i] = "[redacted]"
+		}
+		c.Auth.ServiceKeys = keys
+	}
+	return c
+}
+
+// redactURL masks the password in a URL. Strings that don't parse as a
+// URL with a scheme (e.g. key=value DSNs) are masked whole.
+func redactURL(s string) string {
+	if s == "" {
+		return ""
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return "[redacted]"
+	}
+	if q := u.Query(); q.Has("password") {
+		q.Set("password", "xxxxx")
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func writeFile(t *testing.T, name, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != ":8080" || cfg.Store.Kind() != "memory" || !cfg.Features.Jobs || time.Duration(cfg.ShutdownGrace) != 30*time.Second {
+		t.Errorf("got %+v", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  addr: ":7000"
+  log_level: warn
+  job_workers: 3
+  write_timeout: 10m
+defaults:
+  precision: 1
+`)
+	// File < env < flags.
+	cfg, err := Load([]string{"-addr", ":9000"}, env(map[string]string{
+		"CONFIG_FILE": path, "PORT": "8000", "JOB_WORKERS": "5", "FEATURE_METRICS": "false", "GRPC_ADDR": ":9090",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != ":9000" || cfg.GRPCAddr != ":9090" || cfg.LogLevel != "warn" || cfg.JobWorkers != 5 || cfg.Features.Metrics || time.Duration(cfg.WriteTimeout) != 10*time.Minute || cfg.File != path {
+		t.Errorf("got %+v", cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := map[string]struct {
+		args []string
+		env  map[string]string
+		file string
+		want string
+	}{
+		"unknown server field": {file: `{"server": {"adress": ":1"}}`, want: "adress"},
+		"bad duration":         {env: map[string]string{"HTTP_READ_TIMEOUT": "soon"}, want: "HTTP_READ_TIMEOUT"},
+		"both stores":          {env: map[string]string{"DATABASE_URL": "postgres://x", "REDIS_URL": "redis://y"}, want: "not both"},
+		"redis without url":    {env: map[string]string{"STORE_BACKEND": "redis"}, want: "redis_url"},
+		"log level":            {args: []string{"-log-level", "loud"}, want: "log_level"},
+		"workers":              {file: `{"server": {"job_workers": 0}}`, want: "job_workers"},
+		"rank workers":         {env: map[string]string{"RANK_WORKERS": "-1"}, want: "rank_workers"},
+		"unknown flag":         {args: []string{"-nope"}, want: "nope"},
+		"jwks url":             {env: map[string]string{"JWT_JWKS_URL": "file:///keys.json"}, want: "jwks_url"},
+		"auth required":        {env: map[string]string{"AUTH_REQUIRED": "always"}, want: "AUTH_REQUIRED"},
+		"percent range":        {file: `{"server": {"limits": {"min_percent": 100, "max_percent": 0}}}`, want: "limits.min_percent"},
+		"rate":                 {env: map[string]string{"RATE_LIMIT_RPS": "-1"}, want: "rate_limit.rate"},
+		"route":                {file: `{"server": {"rate_limit": {"routes": {"/rank": {"rate": 1}}}}}`, want: "rate_limit.routes"},
+		"rating system":        {file: `{"server": {"ratings": {"cohorts": {"duel": "trueskill"}}}}`, want: `ratings.cohorts["duel"]`},
+		"k factor":             {env: map[string]string{"RATING_K_FACTOR": "0"}, want: "ratings.k_factor"},
+		"kafka topic":          {env: map[string]string{"KAFKA_BROKERS": "b1:9092"}, want: "kafka"},
+		"kafka start":          {env: map[string]string{"KAFKA_BROKERS": "b1:9092", "KAFKA_TOPIC": "scores", "KAFKA_START": "now"}, want: "kafka.start"},
+		"kafka sasl":           {env: map[string]string{"KAFKA_BROKERS": "b1:9092", "KAFKA_TOPIC": "scores", "KAFKA_SASL_MECHANISM": "GSSAPI"}, want: "kafka.sasl"},
+		"kafka sasl user":      {env: map[string]string{"KAFKA_BROKERS": "b1:9092", "KAFKA_TOPIC": "scores", "KAFKA_SASL_MECHANISM": "PLAIN"}, want: "kafka.sasl"},
+		"kafka ca file":        {env: map[string]string{"KAFKA_BROKERS": "b1:9092", "KAFKA_TOPIC": "scores", "KAFKA_TLS_CA_FILE": "/ca.pem"}, want: "kafka.ca_file"},
+		"cache ttl":            {env: map[string]string{"CACHE_TTL": "0s"}, want: "cache.ttl"},
+		"cache redis":          {env: map[string]string{"CACHE_REDIS_URL": "http://cache"}, want: "cache.redis_url"},
+		"compression level":    {env: map[string]string{"COMPRESSION_LEVEL": "11"}, want: "compression.level"},
+		"grpc addr":            {env: map[string]string{"LISTEN_ADDR": ":9000", "GRPC_ADDR": ":9000"}, want: "grpc_addr"},
+		"webhook allow":        {env: map[string]string{"WEBHOOK_ALLOW": "10.0.0.0/8,internal"}, want: "WEBHOOK_ALLOW"},
+		"webhook allow file":   {file: `{"server": {"webhook": {"allow": ["10.0.0.1"]}}}`, want: "10.0.0.1"},
+		"admin token":          {env: map[string]string{"ADMIN_TOKEN": "changeme"}, want: "admin_token"},
+		"webhook secret":       {file: `{"server": {"webhook": {"secret": "x"}}}`, want: "webhook.secret"},
+		"service key":          {env: map[string]string{"SERVICE_API_KEYS": "0123456789abcdef,short"}, want: "auth.service_keys[1]"},
+		"s3 without bucket":    {env: map[string]string{"S3_REGION": "eu-west-1"}, want: "exports.s3.bucket"},
+		"s3 endpoint":          {env: map[string]string{"S3_BUCKET": "ranks", "S3_ENDPOINT": "minio:9000"}, want: "exports.s3.endpoint"},
+		"s3 credentials":       {env: map[string]string{"S3_BUCKET": "ranks", "S3_ENDPOINT": "http://minio:9000", "S3_REGION": "us-east-1"}, want: "secret_access_key"},
+		"s3 path style":        {env: map[string]string{"S3_PATH_STYLE": "yes"}, want: "S3_PATH_STYLE"},
+	}
+	for name, c := range cases {
+		e := map[string]string{}
+		for k, v := range c.env {
+			e[k] = v
+		}
+		if c.file != "" {
+			e["CONFIG_FILE"] = writeFile(t, "config.json", c.file)
+		}
+		_, err := Load(c.args, env(e))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want error mentioning %q", name, err, c.want)
+		}
+	}
+}
+
+func TestLoadKafka(t *testing.T) {
+	cfg, err := Load(nil, env(map[string]string{"KAFKA_BROKERS": "b1:9092, b2:9092,", "KAFKA_TOPIC": "scores"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k := cfg.Kafka; len(k.Brokers) != 2 || k.Brokers[1] != "b2:9092" || k.Group != "ranking-go" || k.Start != "earliest" || k.TLS || k.SASL != "" {
+		t.Errorf("got %+v", k)
+	}
+	cfg, err = Load(nil, env(map[string]string{"KAFKA_BROKERS": "b1:9093", "KAFKA_TOPIC": "scores", "KAFKA_TLS": "true",
+		"KAFKA_SASL_MECHANISM": "SCRAM-SHA-512", "KAFKA_SASL_USERNAME": "ranker", "KAFKA_SASL_PASSWORD": "hunter2"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k := cfg.Kafka; !k.TLS || k.SASL != "SCRAM-SHA-512" || k.Username != "ranker" || k.Password != "hunter2" {
+		t.Errorf("got %+v", k)
+	}
+	if r := cfg.Redacted(); r.Kafka.Password == "hunter2" {
+		t.Errorf("redacted %+v", r.Kafka)
+	}
+}
+
+func TestLoadWebhookAllow(t *testing.T) {
+	cfg, err := Load(nil, env(map[string]string{"WEBHOOK_ALLOW": "10.20.0.0/16, fd00::/8,"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := cfg.Webhook.Allow; len(a) != 2 || a[0].String() != "10.20.0.0/16" || a[1].String() != "fd00::/8" {
+		t.Errorf("got %v", a)
+	}
+}
+
+func TestLoadSecretsAndExports(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  admin_token: from-the-file-0001
+  auth:
+    service_keys: ["svc-key-from-file-01"]
+  exports:
+    dir: /var/exports
+    s3:
+      bucket: ranks
+      endpoint: http://minio:9000
+      region: us-east-1
+      access_key_id: minio
+      path_style: true
+`)
+	cfg, err := Load(nil, env(map[string]string{
+		"CONFIG_FILE": path, "WEBHOOK_SECRET": "webhook-secret-0001", "S3_SECRET_ACCESS_KEY": "minio-secret",
+		"SERVICE_API_KEYS": "svc-key-from-env-01, svc-key-from-env-02",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AdminToken != "from-the-file-0001" || cfg.Webhook.Secret != "webhook-secret-0001" || len(cfg.Auth.ServiceKeys) != 2 || cfg.Auth.ServiceKeys[1] != "svc-key-from-env-02" {
+		t.Errorf("got %+v", cfg)
+	}
+	want := Exports{Dir: "/var/exports", S3: ExportS3{Bucket: "ranks", Endpoint: "http://minio:9000", Region: "us-east-1", AccessKeyID: "minio", SecretAccessKey: "minio-secret", PathStyle: true}}
+	if cfg.Exports != want {
+		t.Errorf("exports %+v, want %+v", cfg.Exports, want)
+	}
+
+	r := cfg.Redacted()
+	for _, s := range append([]string{r.AdminToken, r.Webhook.Secret, r.Exports.S3.AccessKeyID, r.Exports.S3.SecretAccessKey}, r.Auth.ServiceKeys...) {
+		if s != "[redacted]" {
+			t.Errorf("not redacted: %q", s)
+		}
+	}
+	if len(r.Auth.ServiceKeys) != 2 || cfg.Auth.ServiceKeys[0] != "svc-key-from-env-01" || r.Exports.S3.Bucket != "ranks" {
+		t.Errorf("redacted %+v, original %+v", r, cfg)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.Store.DatabaseURL = "postgres://app:hunter2@db/ranks?sslmode=require"
+	c.Store.RedisURL = "host=db password=hunter2"
+	c.Cache.RedisURL = "redis://:hunter2@cache:6379"
+	r := c.Redacted()
+	if strings.Contains(r.Store.DatabaseURL, "hunter2") || !strings.Contains(r.Store.DatabaseURL, "app:") || r.Store.RedisURL != "[redacted]" {
+		t.Errorf("got %+v", r.Store)
+	}
+	if strings.Contains(r.Cache.RedisURL, "hunter2") {
+		t.Errorf("got %+v", r.Cache)
+	}
+}
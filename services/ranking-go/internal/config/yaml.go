@@ -0,0 +1,289 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// yamlToJSON converts the subset of YAML a config file needs into JSON:
+// block mappings and sequences (including "- key: value" items), comments,
+// plain, single- and double-quoted scalars, and flow values written as
+// JSON ({...}, [...]). Anchors, tags and multi-line scalars are rejected
+// rather than misread.
+func yamlToJSON(src []byte) ([]byte, error) {
+	lines, err := yamlLines(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return []byte("{}"), nil
+	}
+	p := &yamlParser{lines: lines}
+	var out bytes.Buffer
+	if err := p.node(&out, lines[0].indent); err != nil {
+		return nil, err
+	}
+	if p.i < len(p.lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return out.Bytes(), nil
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+func yamlLines(src []byte) ([]yamlLine, error) {
+	var out []yamlLine
+	for n, raw := range strings.Split(string(src), "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		text := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("yaml line %d: tabs are not allowed for indentation", n+1)
+		}
+		text = strings.TrimSpace(stripComment(text))
+		if text == "" || text == "---" {
+			continue
+		}
+		out = append(out, yamlLine{num: n + 1, indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: text})
+	}
+	return out, nil
+}
+
+// stripComment drops a "#" comment that starts the line or follows a
+// space, outside quotes.
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	num := 0
+	if p.i < len(p.lines) {
+		num = p.lines[p.i].num
+	} else if len(p.lines) > 0 {
+		num = p.lines[len(p.lines)-1].num
+	}
+	return fmt.Errorf("yaml line %d: %s", num, fmt.Sprintf(format, args...))
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// node writes the block starting at the current line, which must be at
+// indent.
+func (p *yamlParser) node(out *bytes.Buffer, indent int) error {
+	if isSeqItem(p.lines[p.i].text) {
+		return p.sequence(out, indent)
+	}
+	return p.mapping(out, indent)
+}
+
+func (p *yamlParser) mapping(out *bytes.Buffer, indent int) error {
+	out.WriteByte('{')
+	seen := map[string]bool{}
+	for first := true; p.i < len(p.lines) && p.lines[p.i].indent == indent && !isSeqItem(p.lines[p.i].text); first = false {
+		key, rest, err := splitKey(p.lines[p.i].text)
+		if err != nil {
+			return p.errorf("%v", err)
+		}
+		if seen[key] {
+			return p.errorf("duplicate key %q", key)
+		}
+		seen[key] = true
+		if !first {
+			out.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		out.Write(k)
+		out.WriteByte(':')
+		p.i++
+		if rest != "" {
+			if err := p.scalar(out, rest); err != nil {
+				return err
+			}
+			continue
+		}
+		// A nested block: deeper, or a sequence at the key's own indent.
+		switch {
+		case p.i < len(p.lines) && p.lines[p.i].indent > indent:
+			if err := p.node(out, p.lines[p.i].indent); err != nil {
+				return err
+			}
+		case p.i < len(p.lines) && p.lines[p.i].indent == indent && isSeqItem(p.lines[p.i].text):
+			if err := p.sequence(out, indent); err != nil {
+				return err
+			}
+		default:
+			out.WriteString("null")
+		}
+	}
+	if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+		return p.errorf("unexpected indentation")
+	}
+	out.WriteByte('}')
+	return nil
+}
+
+func (p *yamlParser) sequence(out *bytes.Buffer, indent int) error {
+	out.WriteByte('[')
+	for first := true; p.i < len(p.lines) && p.lines[p.i].indent == indent && isSeqItem(p.lines[p.i].text); first = false {
+		if !first {
+			out.WriteByte(',')
+		}
+		line := p.lines[p.i]
+		item := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+		switch {
+		case item == "":
+			p.i++
+			if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+				if err := p.node(out, p.lines[p.i].indent); err != nil {
+					return err
+				}
+			} else {
+				out.WriteString("null")
+			}
+		case isSeqItem(item) || isMappingEntry(item):
+			// "- key: value" opens a mapping whose keys line up with key;
+			// re-read the item as a line of its own at that column.
+			col := indent + len(line.text) - len(item)
+			p.lines[p.i] = yamlLine{num: line.num, indent: col, text: item}
+			if err := p.node(out, col); err != nil {
+				return err
+			}
+		default:
+			p.i++
+			if err := p.scalar(out, item); err != nil {
+				return err
+			}
+		}
+	}
+	if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+		return p.errorf("unexpected indentation")
+	}
+	out.WriteByte(']')
+	return nil
+}
+
+// isMappingEntry reports whether text is "key: ..." rather than a scalar.
+func isMappingEntry(text string) bool {
+	if text[0] == '{' || text[0] == '[' {
+		return false
+	}
+	_, _, err := splitKey(text)
+	return err == nil
+}
+
+// splitKey splits "key: value" (the key possibly quoted).
+func splitKey(text string) (key, rest string, err error) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quoted key")
+		}
+		if key, err = unquote(text[:end+1]); err != nil {
+			return "", "", err
+		}
+		text = text[end+1:]
+		if !strings.HasPrefix(text, ":") {
+			return "", "", fmt.Errorf("expected ':' after key")
+		}
+		return key, strings.TrimSpace(text[1:]), nil
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", fmt.Errorf("expected key: value, got %q", text)
+		}
+		i = len(text) - 1
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), nil
+}
+
+func closingQuote(s string) int {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case q == '\'' && s[i] == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquote(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	var out string
+	if err := json.Unmarshal([]byte(s), &out); err != nil {
+		return "", fmt.Errorf("bad double-quoted string %s", s)
+	}
+	return out, nil
+}
+
+var yamlNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+func (p *yamlParser) scalar(out *bytes.Buffer, s string) error {
+	switch {
+	case s[0] == '{' || s[0] == '[':
+		if !json.Valid([]byte(s)) {
+			return p.errorf("flow values must be written as JSON, got %s", s)
+		}
+		out.WriteString(s)
+		return nil
+	case s[0] == '"' || s[0] == '\'':
+		if closingQuote(s) != len(s)-1 {
+			return p.errorf("bad quoted string %s", s)
+		}
+		v, err := unquote(s)
+		if err != nil {
+			return p.errorf("%v", err)
+		}
+		b, _ := json.Marshal(v)
+		out.Write(b)
+		return nil
+	case strings.ContainsAny(s[:1], "&*!|>%@`"):
+		return p.errorf("unsupported YAML syntax %q (anchors, tags and block scalars are not supported)", s)
+	case s == "true" || s == "false" || s == "null":
+		out.WriteString(s)
+	case s == "~":
+		out.WriteString("null")
+	case yamlNumber.MatchString(s):
+		out.WriteString(s)
+	default:
+		b, _ := json.Marshal(s)
+		out.Write(b)
+	}
+	return nil
+}
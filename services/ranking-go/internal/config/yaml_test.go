@@ -0,0 +1,64 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	src := `# ranking-go
+server:
+  addr: ":9090"
+  read_timeout: 90s   # inline comment
+  job_workers: 4
+  features:
+    jobs: false
+  store:
+    backend: 'redis'
+    redis_url: "redis://:p#w@cache:6379/0"
+defaults:
+  precision: 2
+  tier_order:
+  - gold
+  - silver
+  tie_break:
+    - metric: time_taken
+      order: asc
+    - metric: attempts
+  awards: {"slots": 3, "policy": "share"}
+  empty:
+  ratio: -1.5e3
+  nothing: ~
+`
+	got, err := yamlToJSON([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"server":{"addr":":9090","read_timeout":"90s","job_workers":4,"features":{"jobs":false},"store":{"backend":"redis","redis_url":"redis://:p#w@cache:6379/0"}},
+	"defaults":{"precision":2,"tier_order":["gold","silver"],"tie_break":[{"metric":"time_taken","order":"asc"},{"metric":"attempts"}],"awards":{"slots":3,"policy":"share"},"empty":null,"ratio":-1.5e3,"nothing":null}}`
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("%s: %v", got, err)
+	}
+	_ = json.Unmarshal([]byte(want), &w)
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestYAMLToJSONRejects(t *testing.T) {
+	for name, src := range map[string]string{
+		"tab":           "a:\n\tb: 1\n",
+		"anchor":        "a: &x 1\n",
+		"block scalar":  "a: |\n  text\n",
+		"bad flow":      "a: {b: 1}\n",
+		"duplicate key": "a: 1\na: 2\n",
+		"bad indent":    "a: 1\n  b: 2\n",
+		"not a mapping": "just text\n",
+	} {
+		if _, err := yamlToJSON([]byte(src)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package equate maps scores from one cohort's distribution onto
+// another's, so results on papers of different difficulty can be compared
+// or ranked together.
+package equate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Method is an equating method.
+type Method string
+
+const (
+	// MethodLinear matches the mean and standard deviation:
+	// y = meanY + sdY/sdX * (x - meanX).
+	MethodLinear Method = "linear"
+	// MethodEquipercentile maps a score to the score with the same
+	// percentile rank in the other cohort, interpolating linearly between
+	// observed scores.
+	MethodEquipercentile Method = "equipercentile"
+)
+
+// Equating is a fitted mapping from one distribution to another.
+type Equating struct {
+	method Method
+	from   []float64 // sorted
+	to     []float64 // sorted
+	// Linear parameters: y = slope*x + intercept.
+	slope, intercept float64
+}
+
+// Fit prepares method from the from scores to the to scores. Linear
+// equating needs from scores with some spread.
+func Fit(method Method, from, to []float64) (*Equating, error) {
+	if len(from) == 0 || len(to) == 0 {
+		return nil, errors.New("both distributions need at least one score")
+	}
+	e := &Equating{method: method, from: sorted(from), to: sorted(to)}
+	switch method {
+	case MethodLinear:
+		mx, sx := meanSD(from)
+		my, sy := meanSD(to)
+		if sx == 0 {
+			return nil, errors.New("linear equating needs from scores that are not all equal")
+		}
+		e.slope = sy / sx
+		e.intercept = my - e.slope*mx
+	case MethodEquipercentile:
+	default:
+		return nil, fmt.Errorf("unknown method %q", method)
+	}
+	return e, nil
+}
+
+// Equate maps x, on the from scale, onto the to scale.
+func (e *Equating) Equate(x float64) float64 {
+	if e.method == MethodLinear {
+		return e.slope*x + e.intercept
+	}
+	return quantile(e.to, percentileRank(e.from, x))
+}
+
+// percentileRank is the mid-rank share of s below x, in [0, 1]: scores
+// equal to x count half.
+func percentileRank(s []float64, x float64) float64 {
+	below := sort.SearchFloat64s(s, x)
+	upTo := sort.Search(len(s), func(i int) bool { return s[i] > x })
+	return (float64(below) + float64(upTo-below)/2) / float64(len(s))
+}
+
+// quantile inverts percentileRank on s: the k-th smallest score sits at
+// rank (k + 0.5) / n, ranks between them interpolate linearly and ranks
+// beyond them clamp to the extremes.
+func quantile(s []float64, p float64) float64 {
+	n := float64(len(s))
+	pos := p*n - 0.5
+	switch {
+	case pos <= 0:
+		return s[0]
+	case pos >= n-1:
+		return s[len(s)-1]
+	}
+	k := int(pos)
+	return s[k] + (pos-float64(k))*(s[k+1]-s[k])
+}
+
+func sorted(s []float64) []float64 {
+	out := append([]float64(nil), s...)
+	sort.Float64s(out)
+	return out
+}
+
+// meanSD returns the mean and population standard deviation of s.
+func meanSD(s []float64) (mean, sd float64) {
+	for _, x := range s {
+		mean += x
+	}
+	mean /= float64(len(s))
+	for _, x := range s {
+		sd += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(sd / float64(len(s)))
+}
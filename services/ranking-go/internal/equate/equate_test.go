@@ -0,0 +1,49 @@
+package equate
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLinear(t *testing.T) {
+	// A harder paper: mean 50, sd 10, onto mean 70, sd 5.
+	e, err := Fit(MethodLinear, []float64{40, 60}, []float64{65, 75})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x, want := range map[float64]float64{50: 70, 60: 75, 40: 65, 80: 85} {
+		if got := e.Equate(x); math.Abs(got-want) > 1e-12 {
+			t.Errorf("linear(%v) = %v, want %v", x, got, want)
+		}
+	}
+	if _, err := Fit(MethodLinear, []float64{5, 5}, []float64{1, 2}); err == nil {
+		t.Error("no spread: no error")
+	}
+}
+
+func TestEquipercentile(t *testing.T) {
+	from := []float64{10, 20, 30, 40}
+	to := []float64{50, 60, 80, 90}
+	e, err := Fit(MethodEquipercentile, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each from score lands on the to score of the same rank; scores in
+	// between interpolate, and beyond the range clamp.
+	for x, want := range map[float64]float64{10: 50, 20: 60, 30: 80, 40: 90, 25: 70, 5: 50, 99: 90} {
+		if got := e.Equate(x); math.Abs(got-want) > 1e-12 {
+			t.Errorf("equipercentile(%v) = %v, want %v", x, got, want)
+		}
+	}
+	// Ties share the middle of their ranks.
+	e, _ = Fit(MethodEquipercentile, []float64{10, 10, 20, 30}, to)
+	if got := e.Equate(10); math.Abs(got-55) > 1e-12 {
+		t.Errorf("tied score = %v, want 55", got)
+	}
+	if _, err := Fit("irt", from, to); err == nil {
+		t.Error("unknown method: no error")
+	}
+	if _, err := Fit(MethodEquipercentile, nil, to); err == nil {
+		t.Error("empty from: no error")
+	}
+}
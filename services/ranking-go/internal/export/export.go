@@ -0,0 +1,81 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Target stores an exported ranking and returns where it can be fetched.
+// A Target either writes the whole object or returns an error.
+type Target interface {
+	Put(ctx context.Context, key, contentType string, data []byte) (location string, err error)
+}
+
+// LocalFS writes exports under Dir; the location is a file:// URL.
+type LocalFS struct {
+	Dir string
+}
+
+// Ping checks that Dir exists and is a directory.
+func (l LocalFS) Ping(context.Context) error {
+	fi, err := os.Stat(l.Dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", l.Dir)
+	}
+	return nil
+}
+
+func (l LocalFS) Put(_ context.Context, key, _ string, data []byte) (string, error) {
+	path := filepath.Join(l.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	// Write then rename so readers never see a partial file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".export-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(), nil
+}
+
+// Key builds an object key from caller-supplied parts, replacing anything
+// outside [A-Za-z0-9._-] so keys can't escape their prefix.
+func Key(parts ...string) (string, error) {
+	clean := make([]string, len(parts))
+	for i, p := range parts {
+		c := strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+				return r
+			}
+			return '_'
+		}, p)
+		if c == "" || strings.Trim(c, ".") == "" {
+			return "", fmt.Errorf("invalid key part %q", p)
+		}
+		clean[i] = c
+	}
+	return strings.Join(clean, "/"), nil
+}
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Pinger is implemented by dependencies that can report their own health.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Check is one dependency in the readiness report. Only Required checks
+// make the service unready when they fail.
+type Check struct {
+	Name     string
+	Required bool
+	Pinger   Pinger
+}
+
+// Status is the outcome of one Check.
+type Status struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	Status   string `json:"status"` // "ok" or "down"
+	Error    string `json:"error,omitempty"`
+}
+
+// Report is the aggregated readiness of all checks.
+type Report struct {
+	Ready        bool     `json:"ready"`
+	Dependencies []Status `json:"dependencies"`
+}
+
+// Run probes every check concurrently, each bounded by timeout, and reports
+// ready only if all required checks pass.
+func Run(ctx context.Context, checks []Check, timeout time.Duration) Report {
+	rep := Report{Ready: true, Dependencies: make([]Status, len(checks))}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			st := Status{Name: c.Name, Required: c.Required, Status: "ok"}
+			if err := c.Pinger.Ping(cctx); err != nil {
+				st.Status, st.Error = "down", err.Error()
+			}
+			rep.Dependencies[i] = st
+		}()
+	}
+	wg.Wait()
+	for _, st := range rep.Dependencies {
+		if st.Required && st.Status != "ok" {
+			rep.Ready = false
+		}
+	}
+	return rep
+}
@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type pingFunc func(context.Context) error
+
+func (f pingFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+var (
+	up   = pingFunc(func(context.Context) error { return nil })
+	down = pingFunc(func(context.Context) error { return errors.New("connection refused") })
+	hang = pingFunc(func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() })
+)
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		name   string
+		checks []Check
+		ready  bool
+	}{
+		{"all up", []Check{{"store", true, up}, {"export:s3", false, up}}, true},
+		{"required down", []Check{{"store", true, down}, {"export:s3", false, up}}, false},
+		{"optional down", []Check{{"store", true, up}, {"export:s3", false, down}}, true},
+		{"required hangs", []Check{{"store", true, hang}}, false},
+		{"no checks", nil, true},
+	}
+	for _, c := range cases {
+		rep := Run(context.Background(), c.checks, 50*time.Millisecond)
+		if rep.Ready != c.ready {
+			t.Errorf("%s: ready %v, want %v (%+v)", c.name, rep.Ready, c.ready, rep)
+		}
+		if len(rep.Dependencies) != len(c.checks) {
+			t.Errorf("%s: %d statuses, want %d", c.name, len(rep.Dependencies), len(c.checks))
+		}
+	}
+}
+
+func TestRunReportsErrors(t *testing.T) {
+	rep := Run(context.Background(), []Check{{"export:s3", false, down}}, time.Second)
+	st := rep.Dependencies[0]
+	if st.Status != "down" || st.Error != "connection refused" || st.Required {
+		t.Errorf("unexpected status %+v", st)
+	}
+}
@@ -0,0 +1,179 @@
+// Package irt estimates examinee ability (theta) under the two-parameter
+// logistic (2PL) Item Response Theory model, where the chance of a correct
+// answer to question j is 1 / (1 + exp(-a_j (theta - b_j))): b_j is the
+// question's difficulty and a_j its discrimination.
+package irt
+
+import (
+	"fmt"
+	"math"
+)
+
+// Method is how theta is estimated.
+type Method string
+
+const (
+	// MethodMLE maximises the likelihood of the answers. An all-correct
+	// or all-wrong record has no finite maximum and gets ±ThetaBound.
+	MethodMLE Method = "mle"
+	// MethodEAP takes the posterior mean under a standard normal prior,
+	// which is finite for every record and shrinks short ones toward 0.
+	MethodEAP Method = "eap"
+)
+
+// ThetaBound clamps MLE estimates, and is the EAP quadrature range.
+const ThetaBound = 4.0
+
+// Question is one calibrated question.
+type Question struct {
+	ID             string
+	Difficulty     float64
+	Discrimination float64
+}
+
+// Response is one user's answers, by question ID; questions the user
+// wasn't given are left out.
+type Response struct {
+	UserID  string
+	Answers map[string]bool
+}
+
+// Ability is a user's estimated theta with its standard error: 1/sqrt of
+// the test information for MLE, +Inf if the answers carry none at theta,
+// and the posterior SD for EAP.
+type Ability struct {
+	UserID   string
+	Theta    float64
+	SE       float64
+	Answered int
+}
+
+// answer is one response to a calibrated question.
+type answer struct {
+	a, b    float64
+	correct bool
+}
+
+// Estimate returns each response's ability, in input order. Every answer
+// must be to one of questions, and every response must answer at least
+// one.
+func Estimate(questions []Question, responses []Response, method Method) ([]Ability, error) {
+	if method != MethodMLE && method != MethodEAP {
+		return nil, fmt.Errorf("unknown method %q", method)
+	}
+	byID := make(map[string]Question, len(questions))
+	for _, q := range questions {
+		byID[q.ID] = q
+	}
+	out := make([]Ability, len(responses))
+	for i, r := range responses {
+		if len(r.Answers) == 0 {
+			return nil, fmt.Errorf("user %q: no answers", r.UserID)
+		}
+		answers := make([]answer, 0, len(r.Answers))
+		for id, correct := range r.Answers {
+			q, ok := byID[id]
+			if !ok {
+				return nil, fmt.Errorf("user %q: unknown question %q", r.UserID, id)
+			}
+			answers = append(answers, answer{q.Discrimination, q.Difficulty, correct})
+		}
+		var theta, se float64
+		if method == MethodMLE {
+			theta, se = mle(answers)
+		} else {
+			theta, se = eap(answers)
+		}
+		out[i] = Ability{UserID: r.UserID, Theta: theta, SE: se, Answered: len(answers)}
+	}
+	return out, nil
+}
+
+// logSigmoid is log(1 / (1 + exp(-z))), without overflow.
+func logSigmoid(z float64) float64 {
+	if z >= 0 {
+		return -math.Log1p(math.Exp(-z))
+	}
+	return z - math.Log1p(math.Exp(z))
+}
+
+func prob(theta float64, a answer) float64 {
+	return 1 / (1 + math.Exp(-a.a*(theta-a.b)))
+}
+
+// information is the test information at theta: sum of a^2 P (1 - P).
+func information(theta float64, answers []answer) float64 {
+	var info float64
+	for _, a := range answers {
+		p := prob(theta, a)
+		info += a.a * a.a * p * (1 - p)
+	}
+	return info
+}
+
+// mle runs Newton-Raphson from 0, with steps capped at 1 and theta kept
+// within ±ThetaBound.
+func mle(answers []answer) (theta, se float64) {
+	allCorrect, allWrong := true, true
+	for _, a := range answers {
+		allCorrect = allCorrect && a.correct
+		allWrong = allWrong && !a.correct
+	}
+	switch {
+	case allCorrect:
+		theta = ThetaBound
+	case allWrong:
+		theta = -ThetaBound
+	default:
+		for iter := 0; iter < 100; iter++ {
+			var grad float64
+			for _, a := range answers {
+				u := 0.0
+				if a.correct {
+					u = 1
+				}
+				grad += a.a * (u - prob(theta, a))
+			}
+			step := grad / information(theta, answers)
+			step = math.Max(-1, math.Min(1, step))
+			theta = math.Max(-ThetaBound, math.Min(ThetaBound, theta+step))
+			if math.Abs(step) < 1e-8 {
+				break
+			}
+		}
+	}
+	return theta, 1 / math.Sqrt(information(theta, answers))
+}
+
+// eapPoints is the number of quadrature points over ±ThetaBound.
+const eapPoints = 81
+
+// eap integrates the posterior on a fixed grid, in logs so long records
+// don't underflow.
+func eap(answers []answer) (theta, se float64) {
+	var logPost [eapPoints]float64
+	peak := math.Inf(-1)
+	for k := range logPost {
+		x := -ThetaBound + 2*ThetaBound*float64(k)/(eapPoints-1)
+		lp := -x * x / 2
+		for _, a := range answers {
+			z := a.a * (x - a.b)
+			if !a.correct {
+				z = -z
+			}
+			lp += logSigmoid(z)
+		}
+		logPost[k] = lp
+		peak = math.Max(peak, lp)
+	}
+	var sum, mean, sq float64
+	for k, lp := range logPost {
+		x := -ThetaBound + 2*ThetaBound*float64(k)/(eapPoints-1)
+		w := math.Exp(lp - peak)
+		sum += w
+		mean += w * x
+		sq += w * x * x
+	}
+	mean /= sum
+	return mean, math.Sqrt(math.Max(sq/sum-mean*mean, 0))
+}
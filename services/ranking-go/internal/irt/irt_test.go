@@ -0,0 +1,63 @@
+package irt
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	questions := []Question{{"easy", -1, 1}, {"hard", 1, 1}, {"sharp", 0, 2.5}, {"blunt", 0, 0.5}}
+	responses := []Response{
+		{"split", map[string]bool{"easy": true, "hard": false}},
+		{"perfect", map[string]bool{"easy": true, "hard": true}},
+		{"sharp", map[string]bool{"sharp": true, "blunt": false}},
+		{"blunt", map[string]bool{"sharp": false, "blunt": true}},
+	}
+	for _, m := range []Method{MethodMLE, MethodEAP} {
+		got, err := Estimate(questions, responses, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Symmetric difficulties with one of two right: theta 0.
+		if math.Abs(got[0].Theta) > 1e-6 || got[0].Answered != 2 {
+			t.Errorf("%s: split %+v, want theta 0", m, got[0])
+		}
+		// Getting the more discriminating question right counts for more.
+		if !(got[2].Theta > 0 && got[3].Theta < 0) {
+			t.Errorf("%s: sharp %v, blunt %v", m, got[2].Theta, got[3].Theta)
+		}
+		if !(got[1].Theta > got[0].Theta) {
+			t.Errorf("%s: perfect %v not above split %v", m, got[1].Theta, got[0].Theta)
+		}
+	}
+
+	mle, _ := Estimate(questions, responses[:2], MethodMLE)
+	// Information at 0 is 2 * P(1 - P) with P = 1/(1+e).
+	p := 1 / (1 + math.E)
+	if want := 1 / math.Sqrt(2*p*(1-p)); math.Abs(mle[0].SE-want) > 1e-9 {
+		t.Errorf("mle se %v, want %v", mle[0].SE, want)
+	}
+	if mle[1].Theta != ThetaBound {
+		t.Errorf("all correct: mle %v, want %v", mle[1].Theta, ThetaBound)
+	}
+	eap, _ := Estimate(questions, responses[:2], MethodEAP)
+	if th := eap[1].Theta; !(th > 0 && th < 2) || eap[1].SE >= 1 {
+		t.Errorf("all correct: eap %+v, want finite and shrunk", eap[1])
+	}
+}
+
+func TestEstimateErrors(t *testing.T) {
+	qs := []Question{{"q", 0, 1}}
+	for _, c := range []struct {
+		r []Response
+		m Method
+	}{
+		{[]Response{{"a", map[string]bool{"q": true}}}, "bayes"},
+		{[]Response{{"a", map[string]bool{"nope": true}}}, MethodMLE},
+		{[]Response{{"a", nil}}, MethodEAP},
+	} {
+		if _, err := Estimate(qs, c.r, c.m); err == nil {
+			t.Errorf("%+v: no error", c)
+		}
+	}
+}
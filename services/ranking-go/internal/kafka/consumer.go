@@ -0,0 +1,212 @@
+// Package kafka consumes one topic as a member of a consumer group, on
+// top of franz-go: partitions are balanced across the group's members and
+// move when members join or leave. Records may be delivered again after
+// a failure or a rebalance, so handlers must be idempotent.
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// Start positions for partitions the group has no offset for.
+const (
+	StartEarliest = "earliest"
+	StartLatest   = "latest"
+)
+
+// SASL mechanisms.
+const (
+	SASLPlain       = "PLAIN"
+	SASLSCRAMSHA256 = "SCRAM-SHA-256"
+	SASLSCRAMSHA512 = "SCRAM-SHA-512"
+)
+
+// Config configures a Consumer.
+type Config struct {
+	// Brokers are host:port bootstrap addresses.
+	Brokers []string
+	Topic   string
+	// Group is the consumer group joined and offsets are committed to.
+	Group string
+	// Start is StartEarliest (the default) or StartLatest.
+	Start    string
+	ClientID string
+	// MaxWait is how long a fetch waits for new records; 0 means 500ms.
+	MaxWait time.Duration
+	// Timeout bounds dialing; 0 means 10s.
+	Timeout time.Duration
+	// TLS connects over TLS, verifying brokers against the PEM
+	// certificates in CAFile if set and the system roots otherwise.
+	TLS    bool
+	CAFile string
+	// SASL authenticates as Username with one of the SASL mechanisms; no
+	// mechanism leaves it off.
+	SASL     string
+	Username string
+	Password string
+	// Logger receives retried errors; nil uses slog.Default.
+	Logger *slog.Logger
+}
+
+// Message is one record.
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Time      time.Time
+}
+
+// Consumer reads a topic. It is not safe for concurrent use.
+type Consumer struct {
+	cfg  Config
+	opts []kgo.Opt
+}
+
+// NewConsumer checks cfg; no connection is made until Run.
+func NewConsumer(cfg Config) (*Consumer, error) {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" || cfg.Group == "" {
+		return nil, errors.New("kafka: brokers, topic and group are required")
+	}
+	if cfg.Start == "" {
+		cfg.Start = StartEarliest
+	}
+	if cfg.Start != StartEarliest && cfg.Start != StartLatest {
+		return nil, fmt.Errorf("kafka: start must be %s or %s, got %q", StartEarliest, StartLatest, cfg.Start)
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "ranking-go"
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = 500 * time.Millisecond
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	start := kgo.NewOffset().AtStart()
+	if cfg.Start == StartLatest {
+		start = kgo.NewOffset().AtEnd()
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.ClientID(cfg.ClientID),
+		kgo.DialTimeout(cfg.Timeout),
+		kgo.ConsumeTopics(cfg.Topic),
+		kgo.ConsumerGroup(cfg.Group),
+		kgo.ConsumeResetOffset(start),
+		kgo.FetchMaxWait(cfg.MaxWait),
+		// Only handled records are committed: every few seconds, when
+		// partitions are revoked in a rebalance, and on leaving.
+		kgo.AutoCommitMarks(),
+	}
+	if cfg.TLS {
+		tc, err := tlsConfig(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.DialTLSConfig(tc))
+	}
+	if cfg.SASL != "" {
+		m, err := mechanism(cfg.SASL, cfg.Username, cfg.Password)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.SASL(m))
+	}
+	return &Consumer{cfg: cfg, opts: opts}, nil
+}
+
+func tlsConfig(caFile string) (*tls.Config, error) {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return tc, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	tc.RootCAs = x509.NewCertPool()
+	if !tc.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("kafka: no certificates in %s", caFile)
+	}
+	return tc, nil
+}
+
+func mechanism(name, user, pass string) (sasl.Mechanism, error) {
+	if user == "" {
+		return nil, errors.New("kafka: SASL needs a username")
+	}
+	switch name {
+	case SASLPlain:
+		return plain.Auth{User: user, Pass: pass}.AsMechanism(), nil
+	case SASLSCRAMSHA256:
+		return scram.Auth{User: user, Pass: pass}.AsSha256Mechanism(), nil
+	case SASLSCRAMSHA512:
+		return scram.Auth{User: user, Pass: pass}.AsSha512Mechanism(), nil
+	}
+	return nil, fmt.Errorf("kafka: SASL mechanism must be %s, %s or %s, got %q", SASLPlain, SASLSCRAMSHA256, SASLSCRAMSHA512, name)
+}
+
+// Run joins the group and fetches from the partitions assigned to it
+// until ctx ends, passing each fetch's records to handle, in offset order
+// within each partition. Records are committed once handle returns nil;
+// an error from handle is logged and the same records are handled again
+// after a backoff, doubling from 1s to 30s. Fetch errors are logged and
+// retried by the client. Run returns nil once ctx is done, after leaving
+// the group.
+func (c *Consumer) Run(ctx context.Context, handle func(context.Context, []Message) error) error {
+	cl, err := kgo.NewClient(c.opts...)
+	if err != nil {
+		return fmt.Errorf("kafka: %w", err)
+	}
+	defer cl.Close()
+	for {
+		fetches := cl.PollFetches(ctx)
+		if ctx.Err() != nil || fetches.IsClientClosed() {
+			return nil
+		}
+		fetches.EachError(func(topic string, partition int32, err error) {
+			c.cfg.Logger.Error("kafka consumer", "topic", topic, "partition", partition, "error", err)
+		})
+		records := fetches.Records()
+		if len(records) == 0 {
+			continue
+		}
+		msgs := make([]Message, len(records))
+		for i, r := range records {
+			msgs[i] = Message{Topic: r.Topic, Partition: r.Partition, Offset: r.Offset, Key: r.Key, Value: r.Value, Time: r.Timestamp}
+		}
+		for backoff := time.Second; ; backoff = min(2*backoff, 30*time.Second) {
+			err := handle(ctx, msgs)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			c.cfg.Logger.Error("kafka consumer", "topic", c.cfg.Topic, "error", err, "retry_in", backoff.String())
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		cl.MarkCommitRecords(records...)
+	}
+}
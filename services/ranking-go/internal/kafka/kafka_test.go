@@ -0,0 +1,283 @@
+package kafka
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// cluster is an in-memory Kafka cluster with the topic "scores" in two
+// partitions.
+func cluster(t *testing.T, opts ...kfake.Opt) *kfake.Cluster {
+	t.Helper()
+	c, err := kfake.NewCluster(append(opts, kfake.NumBrokers(1), kfake.SeedTopics(2, "scores"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// produce writes values to partition p of "scores", in one batch
+// compressed with codec.
+func produce(t *testing.T, c *kfake.Cluster, codec kgo.CompressionCodec, p int32, values ...string) {
+	t.Helper()
+	cl, err := kgo.NewClient(kgo.SeedBrokers(c.ListenAddrs()...), kgo.DefaultProduceTopic("scores"),
+		kgo.RecordPartitioner(kgo.ManualPartitioner()), kgo.ProducerBatchCompression(codec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	var rs []*kgo.Record
+	for _, v := range values {
+		rs = append(rs, &kgo.Record{Partition: p, Value: []byte(v)})
+	}
+	if err := cl.ProduceSync(context.Background(), rs...).FirstErr(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// consumer runs a Consumer in the background, recording what it handles
+// as "partition/value".
+type consumer struct {
+	mu   sync.Mutex
+	got  []string
+	stop func()
+}
+
+func consume(t *testing.T, cfg Config, handle func([]Message) error) *consumer {
+	t.Helper()
+	cfg.Topic, cfg.MaxWait = "scores", 20*time.Millisecond
+	if cfg.Group == "" {
+		cfg.Group = "g"
+	}
+	kc, err := NewConsumer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &consumer{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		kc.Run(ctx, func(_ context.Context, msgs []Message) error {
+			if handle != nil {
+				if err := handle(msgs); err != nil {
+					return err
+				}
+			}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			for _, m := range msgs {
+				c.got = append(c.got, strconv.Itoa(int(m.Partition))+"/"+string(m.Value))
+			}
+			return nil
+		})
+	}()
+	c.stop = func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(c.stop)
+	return c
+}
+
+// await waits for c to have handled n records.
+func (c *consumer) await(t *testing.T, n int) []string {
+	t.Helper()
+	for deadline := time.Now().Add(20 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		c.mu.Lock()
+		got := slices.Clone(c.got)
+		c.mu.Unlock()
+		if len(got) >= n {
+			return got
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t.Fatalf("handled %v, want %d records", c.got, n)
+	return nil
+}
+
+func TestConsumer(t *testing.T) {
+	kc := cluster(t)
+	brokers := kc.ListenAddrs()
+	produce(t, kc, kgo.NoCompression(), 0, "a", "b")
+	produce(t, kc, kgo.GzipCompression(), 0, "c")
+	produce(t, kc, kgo.SnappyCompression(), 1, "x")
+	produce(t, kc, kgo.Lz4Compression(), 1, "y")
+	produce(t, kc, kgo.ZstdCompression(), 1, "z")
+
+	// The first delivery fails, so the same records come again.
+	var mu sync.Mutex
+	failed := false
+	c := consume(t, Config{Brokers: brokers}, func([]Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !failed {
+			failed = true
+			return errors.New("store unavailable")
+		}
+		return nil
+	})
+	got := c.await(t, 6)
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"0/a", "0/b", "0/c", "1/x", "1/y", "1/z"}) {
+		t.Errorf("first run got %v", got)
+	}
+	c.stop()
+
+	// A new consumer in the group resumes where the last one committed.
+	produce(t, kc, kgo.NoCompression(), 1, "w")
+	c = consume(t, Config{Brokers: brokers}, nil)
+	if got := c.await(t, 1); !slices.Equal(got, []string{"1/w"}) {
+		t.Errorf("resumed run got %v", got)
+	}
+	c.stop()
+
+	// A new group starting at latest sees only what is produced later.
+	c = consume(t, Config{Brokers: brokers, Group: "fresh", Start: StartLatest}, nil)
+	for deadline := time.Now().Add(20 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		c.mu.Lock()
+		n := len(c.got)
+		c.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		produce(t, kc, kgo.NoCompression(), 0, "late")
+	}
+	if got := c.await(t, 1); got[0] != "0/late" {
+		t.Errorf("latest got %v", got)
+	}
+}
+
+func TestConsumerGroupRebalances(t *testing.T) {
+	kc := cluster(t)
+	brokers := kc.ListenAddrs()
+	produce(t, kc, kgo.NoCompression(), 0, "a")
+	produce(t, kc, kgo.NoCompression(), 1, "b")
+	first := consume(t, Config{Brokers: brokers}, nil)
+	first.await(t, 2)
+
+	// A second member takes one of the partitions; records keep coming
+	// from both, each to one member.
+	second := consume(t, Config{Brokers: brokers}, nil)
+	for i := 0; ; i++ {
+		if i == 200 {
+			t.Fatal("the second member was never assigned a partition")
+		}
+		produce(t, kc, kgo.NoCompression(), int32(i%2), "r"+strconv.Itoa(i))
+		time.Sleep(50 * time.Millisecond)
+		second.mu.Lock()
+		n := len(second.got)
+		second.mu.Unlock()
+		if n > 0 {
+			break
+		}
+	}
+	first.mu.Lock()
+	second.mu.Lock()
+	defer first.mu.Unlock()
+	defer second.mu.Unlock()
+	seen := map[string]bool{}
+	for _, r := range append(slices.Clone(first.got), second.got...) {
+		seen[r] = true
+	}
+	if !seen["0/a"] || !seen["1/b"] {
+		t.Errorf("records lost: first %v, second %v", first.got, second.got)
+	}
+}
+
+func TestConsumerSASL(t *testing.T) {
+	for _, mech := range []string{SASLPlain, SASLSCRAMSHA256, SASLSCRAMSHA512} {
+		t.Run(mech, func(t *testing.T) {
+			kc := cluster(t, kfake.EnableSASL(), kfake.Superuser(mech, "ranker", "secret"))
+			m, err := mechanism(mech, "ranker", "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cl, err := kgo.NewClient(kgo.SeedBrokers(kc.ListenAddrs()...), kgo.DefaultProduceTopic("scores"), kgo.SASL(m))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			if err := cl.ProduceSync(context.Background(), &kgo.Record{Value: []byte("a")}).FirstErr(); err != nil {
+				t.Fatal(err)
+			}
+			c := consume(t, Config{Brokers: kc.ListenAddrs(), SASL: mech, Username: "ranker", Password: "secret"}, nil)
+			if got := c.await(t, 1); len(got) != 1 {
+				t.Errorf("got %v", got)
+			}
+		})
+	}
+}
+
+func TestConsumerTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	kc := cluster(t, kfake.TLS(&tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}))
+	tc, err := tlsConfig(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := kgo.NewClient(kgo.SeedBrokers(kc.ListenAddrs()...), kgo.DefaultProduceTopic("scores"), kgo.DialTLSConfig(tc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	if err := cl.ProduceSync(context.Background(), &kgo.Record{Value: []byte("a")}).FirstErr(); err != nil {
+		t.Fatal(err)
+	}
+	c := consume(t, Config{Brokers: kc.ListenAddrs(), TLS: true, CAFile: caFile}, nil)
+	if got := c.await(t, 1); len(got) != 1 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestNewConsumerChecksConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{Topic: "t", Group: "g"},
+		{Brokers: []string{"b:9092"}, Group: "g"},
+		{Brokers: []string{"b:9092"}, Topic: "t", Group: "g", Start: "middle"},
+		{Brokers: []string{"b:9092"}, Topic: "t", Group: "g", SASL: "GSSAPI", Username: "u"},
+		{Brokers: []string{"b:9092"}, Topic: "t", Group: "g", SASL: SASLPlain},
+		{Brokers: []string{"b:9092"}, Topic: "t", Group: "g", TLS: true, CAFile: "testdata/missing.pem"},
+	} {
+		if _, err := NewConsumer(cfg); err == nil {
+			t.Errorf("%+v: no error", cfg)
+		}
+	}
+}
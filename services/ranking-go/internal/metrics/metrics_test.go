@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("reqs_total", "Requests.", "route", "code")
+	h := r.NewHistogram("size", "Sizes.", []float64{1, 10})
+	c.Inc("POST /rank", "200")
+	c.Inc("POST /rank", "200")
+	c.Inc(`a"b`, "400")
+	h.Observe(1)
+	h.Observe(5)
+	h.Observe(50)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP reqs_total Requests.
+# TYPE reqs_total counter
+reqs_total{route="POST /rank",code="200"} 2
+reqs_total{route="a\"b",code="400"} 1
+# HELP size Sizes.
+# TYPE size histogram
+size_bucket{le="1"} 1
+size_bucket{le="10"} 2
+size_bucket{le="+Inf"} 3
+size_sum 56
+size_count 3
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestLabelCountMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	NewRegistry().NewCounter("c", "C.", "route").Inc()
+}
@@ -0,0 +1,49 @@
+package rank
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Anchor is one point of a reference score→percentile curve.
+type Anchor struct {
+	Score      float64
+	Percentile float64
+}
+
+// validateAnchors requires at least two anchors with strictly increasing
+// scores, non-decreasing percentiles, and percentiles in [0, 100].
+func validateAnchors(a []Anchor) error {
+	if len(a) < 2 {
+		return fmt.Errorf("anchors: need at least 2 points, got %d", len(a))
+	}
+	for i, p := range a {
+		if p.Percentile < 0 || p.Percentile > 100 {
+			return fmt.Errorf("anchors[%d]: percentile must be in [0, 100], got %v", i, p.Percentile)
+		}
+		if i == 0 {
+			continue
+		}
+		if p.Score <= a[i-1].Score {
+			return fmt.Errorf("anchors[%d]: scores must be strictly increasing", i)
+		}
+		if p.Percentile < a[i-1].Percentile {
+			return fmt.Errorf("anchors[%d]: percentiles must not decrease", i)
+		}
+	}
+	return nil
+}
+
+// anchoredPercentile interpolates x linearly between the anchors around it.
+// Scores outside the curve clamp to the first or last anchor's percentile.
+func anchoredPercentile(a []Anchor, x float64) float64 {
+	i := sort.Search(len(a), func(i int) bool { return a[i].Score >= x })
+	switch {
+	case i == 0:
+		return a[0].Percentile
+	case i == len(a):
+		return a[len(a)-1].Percentile
+	}
+	lo, hi := a[i-1], a[i]
+	return lo.Percentile + (x-lo.Score)/(hi.Score-lo.Score)*(hi.Percentile-lo.Percentile)
+}
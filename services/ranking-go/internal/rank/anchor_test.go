@@ -0,0 +1,43 @@
+package rank
+
+import "testing"
+
+var curve = []Anchor{{Score: 40, Percentile: 10}, {Score: 60, Percentile: 50}, {Score: 80, Percentile: 90}}
+
+func TestRankAnchoredPercentile(t *testing.T) {
+	items := []Item{
+		{UserID: "at-low", Percent: 40},
+		{UserID: "between", Percent: 50}, // halfway 10..50
+		{UserID: "at-mid", Percent: 60},
+		{UserID: "upper", Percent: 75}, // 3/4 of 50..90
+		{UserID: "below", Percent: 20}, // clamps
+		{UserID: "above", Percent: 95}, // clamps
+	}
+	out, err := Rank(items, Options{Anchors: curve})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"at-low": 10, "between": 30, "at-mid": 50, "upper": 80, "below": 10, "above": 90}
+	for _, r := range out {
+		if !approx(r.Percentile, want[r.UserID]) {
+			t.Errorf("%s (%v): percentile %v, want %v", r.UserID, r.Percent, r.Percentile, want[r.UserID])
+		}
+	}
+}
+
+func TestRankAnchorsValidation(t *testing.T) {
+	for name, a := range map[string][]Anchor{
+		"one point":       {{Score: 50, Percentile: 50}},
+		"scores repeat":   {{Score: 50, Percentile: 40}, {Score: 50, Percentile: 60}},
+		"scores decrease": {{Score: 60, Percentile: 40}, {Score: 50, Percentile: 60}},
+		"pct decreases":   {{Score: 50, Percentile: 60}, {Score: 60, Percentile: 40}},
+		"pct over 100":    {{Score: 50, Percentile: 60}, {Score: 60, Percentile: 140}},
+	} {
+		if _, err := Rank(nil, Options{Anchors: a}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := Rank(nil, Options{Anchors: curve, Weighted: true}); err == nil {
+		t.Error("expected error combining anchors and weighted")
+	}
+}
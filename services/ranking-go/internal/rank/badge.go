@@ -0,0 +1,63 @@
+package rank
+
+import "fmt"
+
+// maxBadges bounds a badge ladder.
+const maxBadges = 20
+
+// Badge is one rung of a badge ladder: users at or above MinPercentile
+// earn Name unless a better badge claims them first. Badges are separate
+// from Item.Tier, which is an input that orders users; a badge is an
+// output read off the final percentile.
+type Badge struct {
+	Name          string
+	MinPercentile float64
+}
+
+// validateBadges requires 1 to maxBadges badges, best first, with distinct
+// non-empty names and strictly decreasing MinPercentile in [0, 100].
+func validateBadges(b []Badge) error {
+	if len(b) > maxBadges {
+		return fmt.Errorf("badges: at most %d, got %d", maxBadges, len(b))
+	}
+	seen := make(map[string]bool, len(b))
+	for i, x := range b {
+		switch {
+		case x.Name == "":
+			return fmt.Errorf("badges[%d]: empty name", i)
+		case seen[x.Name]:
+			return fmt.Errorf("badges[%d]: duplicate name %q", i, x.Name)
+		case x.MinPercentile < 0 || x.MinPercentile > 100:
+			return fmt.Errorf("badges[%d]: min_percentile must be in [0, 100], got %v", i, x.MinPercentile)
+		case i > 0 && x.MinPercentile >= b[i-1].MinPercentile:
+			return fmt.Errorf("badges[%d]: min_percentile must be below the previous badge's", i)
+		}
+		seen[x.Name] = true
+	}
+	return nil
+}
+
+// applyBadges gives each user the first badge whose MinPercentile their
+// percentile reaches, read top-is-100 like applyQuantile. Users below
+// every badge, or with a withheld percentile, get none.
+func applyBadges(out []Result, opts Options) {
+	if len(opts.Badges) == 0 {
+		return
+	}
+	for i := range out {
+		out[i].Badge = ""
+		if out[i].PercentileNull {
+			continue
+		}
+		p := out[i].Percentile
+		if opts.Direction == TopIsLow {
+			p = 100 - p
+		}
+		for _, b := range opts.Badges {
+			if p >= b.MinPercentile {
+				out[i].Badge = b.Name
+				break
+			}
+		}
+	}
+}
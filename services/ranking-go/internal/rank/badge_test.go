@@ -0,0 +1,37 @@
+package rank
+
+import "testing"
+
+var ladder = []Badge{{"Platinum", 95}, {"Gold", 75}, {"Silver", 50}, {"Bronze", 25}}
+
+func TestBadges(t *testing.T) {
+	// Percentiles 100, 75, 50, 25, 0.
+	items := []Item{{UserID: "a", Percent: 90}, {UserID: "b", Percent: 80}, {UserID: "c", Percent: 70}, {UserID: "d", Percent: 60}, {UserID: "e", Percent: 50}}
+	out, err := Rank(items, Options{Badges: ladder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Platinum", "Gold", "Silver", "Bronze", ""}
+	for i, r := range out {
+		if r.Badge != want[i] {
+			t.Errorf("%s (percentile %v): badge %q, want %q", r.UserID, r.Percentile, r.Badge, want[i])
+		}
+	}
+	out, _ = Rank(items, Options{Badges: ladder, Direction: TopIsLow})
+	if out[0].Badge != "Platinum" || out[4].Badge != "" {
+		t.Errorf("top_is_low: %q, %q", out[0].Badge, out[4].Badge)
+	}
+}
+
+func TestValidateBadges(t *testing.T) {
+	for name, b := range map[string][]Badge{
+		"empty name": {{"", 50}},
+		"duplicate":  {{"Gold", 80}, {"Gold", 50}},
+		"range":      {{"Gold", 101}},
+		"order":      {{"Silver", 50}, {"Gold", 80}},
+	} {
+		if err := (Options{Badges: b}).Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
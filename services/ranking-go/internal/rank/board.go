@@ -0,0 +1,239 @@
+package rank
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Board is a cohort kept in the order Rank gives it under incremental
+// options (see Options.Incremental): score, highest first, then user_id.
+// It is a treap whose nodes count their subtree, so finding a user's
+// position, the user at a position, and moving a user are all O(log n),
+// and it keeps the Moments behind the cohort's mean and SD. Not safe for
+// concurrent use.
+type Board struct {
+	root    *boardNode
+	scores  map[string]float64
+	moments Moments
+}
+
+type boardNode struct {
+	userID      string
+	score       float64
+	prio        uint64
+	size        int
+	left, right *boardNode
+}
+
+func nodeSize(n *boardNode) int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *boardNode) fix() { n.size = 1 + nodeSize(n.left) + nodeSize(n.right) }
+
+// ahead reports whether (score, userID) sorts ahead of n.
+func ahead(score float64, userID string, n *boardNode) bool {
+	return score > n.score || score == n.score && userID < n.userID
+}
+
+// NewBoard loads results, which must be in board order, as Rank returns
+// them under incremental options. It takes O(n): the treap is built
+// directly off the sorted results rather than by n inserts.
+func NewBoard(results []Result) *Board {
+	b := &Board{scores: make(map[string]float64, len(results))}
+	// A Cartesian tree on the priorities, keeping its right spine on a
+	// stack; a node popped off it is complete, so its size is final.
+	var spine []*boardNode
+	for _, r := range results {
+		n := &boardNode{userID: r.UserID, score: r.Score, prio: rand.Uint64(), size: 1}
+		var last *boardNode
+		for len(spine) > 0 && spine[len(spine)-1].prio < n.prio {
+			last = spine[len(spine)-1]
+			spine = spine[:len(spine)-1]
+			last.fix()
+		}
+		n.left = last
+		if len(spine) > 0 {
+			spine[len(spine)-1].right = n
+		}
+		spine = append(spine, n)
+		b.scores[r.UserID] = r.Score
+		b.moments.Add(r.Score)
+	}
+	for i := len(spine) - 1; i >= 0; i-- {
+		spine[i].fix()
+	}
+	if len(spine) > 0 {
+		b.root = spine[0]
+	}
+	return b
+}
+
+// Len is the number of users on the board.
+func (b *Board) Len() int { return nodeSize(b.root) }
+
+// Moments returns the running sums of the board's scores.
+func (b *Board) Moments() Moments { return b.moments }
+
+// Index returns userID's position, 0 best, or -1 if they are not on the
+// board.
+func (b *Board) Index(userID string) int {
+	score, ok := b.scores[userID]
+	if !ok {
+		return -1
+	}
+	return b.countAhead(score, userID)
+}
+
+// countAhead counts the users sorting ahead of (score, userID).
+func (b *Board) countAhead(score float64, userID string) int {
+	i := 0
+	for n := b.root; n != nil; {
+		switch {
+		case n.userID == userID && n.score == score:
+			return i + nodeSize(n.left)
+		case ahead(score, userID, n):
+			n = n.left
+		default:
+			i += nodeSize(n.left) + 1
+			n = n.right
+		}
+	}
+	return i
+}
+
+// Place returns where a move of userID to score would take them: their
+// current position from, -1 if they are new, and their position to once
+// moved. The board is unchanged.
+func (b *Board) Place(userID string, score float64) (from, to int) {
+	from = b.Index(userID)
+	to = b.countAhead(score, userID)
+	if from >= 0 && from < to {
+		// Their current place is among those counted.
+		to--
+	}
+	return from, to
+}
+
+// Set puts userID on the board with score, moving them if they are on it
+// already, and returns from and to as Place does.
+func (b *Board) Set(userID string, score float64) (from, to int) {
+	from, to = b.Place(userID, score)
+	if old, ok := b.scores[userID]; ok {
+		b.root = erase(b.root, old, userID)
+		b.moments.Remove(old)
+	}
+	l, r := split(b.root, score, userID)
+	b.root = merge(merge(l, &boardNode{userID: userID, score: score, prio: rand.Uint64(), size: 1}), r)
+	b.scores[userID] = score
+	b.moments.Add(score)
+	return from, to
+}
+
+// Walk calls fn with each user at positions from to to-1, in order.
+func (b *Board) Walk(from, to int, fn func(i int, userID string, score float64)) {
+	walk(b.root, 0, from, to, fn)
+}
+
+// walk visits n's subtree, whose first node is at position first.
+func walk(n *boardNode, first, from, to int, fn func(int, string, float64)) {
+	if n == nil || first >= to || first+n.size <= from {
+		return
+	}
+	walk(n.left, first, from, to, fn)
+	i := first + nodeSize(n.left)
+	if i >= from && i < to {
+		fn(i, n.userID, n.score)
+	}
+	walk(n.right, i+1, from, to, fn)
+}
+
+// split cuts n into the nodes sorting ahead of (score, userID) and the
+// rest.
+func split(n *boardNode, score float64, userID string) (l, r *boardNode) {
+	if n == nil {
+		return nil, nil
+	}
+	if ahead(score, userID, n) {
+		l, n.left = split(n.left, score, userID)
+		n.fix()
+		return l, n
+	}
+	n.right, r = split(n.right, score, userID)
+	n.fix()
+	return n, r
+}
+
+// merge joins l and r, every node of l sorting ahead of every node of r.
+func merge(l, r *boardNode) *boardNode {
+	switch {
+	case l == nil:
+		return r
+	case r == nil:
+		return l
+	case l.prio > r.prio:
+		l.right = merge(l.right, r)
+		l.fix()
+		return l
+	default:
+		r.left = merge(l, r.left)
+		r.fix()
+		return r
+	}
+}
+
+// erase removes userID, found at score, from n.
+func erase(n *boardNode, score float64, userID string) *boardNode {
+	switch {
+	case n == nil:
+		return nil
+	case n.userID == userID:
+		return merge(n.left, n.right)
+	case ahead(score, userID, n):
+		n.left = erase(n.left, score, userID)
+	default:
+		n.right = erase(n.right, score, userID)
+	}
+	n.fix()
+	return n
+}
+
+// Moments are the running sums behind a cohort's mean and population SD
+// as scores come and go. The sums are of each score less Shift, the first
+// score added, which keeps cancellation out of the SD of scores that sit
+// far from 0 next to their spread.
+type Moments struct {
+	N          int
+	Shift      float64
+	Sum, SumSq float64
+}
+
+func (m *Moments) Add(x float64) {
+	if m.N == 0 {
+		m.Shift, m.Sum, m.SumSq = x, 0, 0
+	}
+	d := x - m.Shift
+	m.N++
+	m.Sum += d
+	m.SumSq += d * d
+}
+
+func (m *Moments) Remove(x float64) {
+	d := x - m.Shift
+	m.N--
+	m.Sum -= d
+	m.SumSq -= d * d
+}
+
+// MeanSD returns the mean and population SD, both 0 for no scores.
+func (m Moments) MeanSD() (mean, sd float64) {
+	if m.N <= 0 {
+		return 0, 0
+	}
+	n := float64(m.N)
+	d := m.Sum / n
+	return m.Shift + d, math.Sqrt(max(m.SumSq/n-d*d, 0))
+}
@@ -0,0 +1,103 @@
+package rank
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestBoardMatchesSort(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var items []Item
+	for i := 0; i < 50; i++ {
+		items = append(items, Item{UserID: fmt.Sprintf("u%02d", i), Percent: float64(rng.Intn(20))})
+	}
+	b := NewBoard(RankByPercent(items))
+	scores := map[string]float64{}
+	for _, it := range items {
+		scores[it.UserID] = it.Percent
+	}
+	for step := 0; step < 500; step++ {
+		id := fmt.Sprintf("u%02d", rng.Intn(60))
+		pct := float64(rng.Intn(20))
+		wantFrom := -1
+		order := sortedIDs(scores)
+		for i, u := range order {
+			if u == id {
+				wantFrom = i
+			}
+		}
+		scores[id] = pct
+		order = sortedIDs(scores)
+		if pf, pt := b.Place(id, pct); b.Len() != len(order)-boolInt(wantFrom < 0) || pf != wantFrom || order[pt] != id {
+			t.Fatalf("step %d: Place(%s, %v) = %d, %d; want %d, %d", step, id, pct, pf, pt, wantFrom, indexOf(order, id))
+		}
+		b.Set(id, pct)
+		if b.Len() != len(order) {
+			t.Fatalf("step %d: Len %d, want %d", step, b.Len(), len(order))
+		}
+		b.Walk(0, b.Len(), func(i int, u string, s float64) {
+			if u != order[i] || s != scores[u] || b.Index(u) != i {
+				t.Fatalf("step %d: position %d holds %s (%v), want %s", step, i, u, s, order[i])
+			}
+		})
+	}
+
+	var got []int
+	b.Walk(10, 13, func(i int, _ string, _ float64) { got = append(got, i) })
+	if fmt.Sprint(got) != "[10 11 12]" {
+		t.Errorf("Walk(10, 13) visited %v", got)
+	}
+	if b.Index("nobody") != -1 {
+		t.Error("Index of a user not on the board")
+	}
+	var all []Item
+	for u, s := range scores {
+		all = append(all, Item{UserID: u, Percent: s})
+	}
+	mean, sd := b.Moments().MeanSD()
+	if wm, ws := meanStdDev(all); math.Abs(mean-wm) > 1e-9 || math.Abs(sd-ws) > 1e-9 {
+		t.Errorf("MeanSD %v, %v; want %v, %v", mean, sd, wm, ws)
+	}
+}
+
+func TestMomentsEqualScores(t *testing.T) {
+	var m Moments
+	for i := 0; i < 1000; i++ {
+		m.Add(73.1)
+	}
+	m.Remove(73.1)
+	if mean, sd := m.MeanSD(); mean != 73.1 || sd != 0 {
+		t.Errorf("MeanSD %v, %v; want 73.1, 0", mean, sd)
+	}
+}
+
+func sortedIDs(scores map[string]float64) []string {
+	var ids []string
+	for u := range scores {
+		ids = append(ids, u)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := ids[i], ids[j]
+		return scores[a] > scores[b] || scores[a] == scores[b] && a < b
+	})
+	return ids
+}
+
+func indexOf(ids []string, id string) int {
+	for i, u := range ids {
+		if u == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
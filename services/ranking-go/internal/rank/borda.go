@@ -0,0 +1,48 @@
+package rank
+
+import (
+	"fmt"
+	"sort"
+)
+
+// bordaPoints ranks items on each metric separately and returns each
+// item's Borda total, the sum of its positions (1 = best, so lower totals
+// are better), and its best single-metric position. Users tied on a metric
+// share the mean of the positions they span (a 2-way tie for 2nd scores
+// 2.5 each), so a tie neither rewards nor penalises its members.
+func bordaPoints(items []Item, metrics []TieBreakKey) (points, best []float64, err error) {
+	n := len(items)
+	points = make([]float64, n)
+	best = make([]float64, n)
+	vals := make([]float64, n)
+	order := make([]int, n)
+	for m, k := range metrics {
+		for i, it := range items {
+			v, ok := it.Metrics[k.Metric]
+			if !ok {
+				return nil, nil, fmt.Errorf("user %q: missing borda metric %q", it.UserID, k.Metric)
+			}
+			if k.Desc {
+				v = -v
+			}
+			vals[i] = v // smaller is better
+			order[i] = i
+		}
+		sort.Slice(order, func(a, b int) bool { return vals[order[a]] < vals[order[b]] })
+		for start := 0; start < n; {
+			end := start + 1
+			for end < n && vals[order[end]] == vals[order[start]] {
+				end++
+			}
+			pos := float64(start+1+end) / 2 // mean of positions start+1..end
+			for _, i := range order[start:end] {
+				points[i] += pos
+				if m == 0 || pos < best[i] {
+					best[i] = pos
+				}
+			}
+			start = end
+		}
+	}
+	return points, best, nil
+}
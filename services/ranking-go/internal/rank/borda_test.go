@@ -0,0 +1,64 @@
+package rank
+
+import (
+	"reflect"
+	"testing"
+)
+
+func bordaItem(id string, sprint, jump float64) Item {
+	return Item{UserID: id, Metrics: map[string]float64{"sprint": sprint, "jump": jump}}
+}
+
+func order(out []Result) []string {
+	ids := make([]string, len(out))
+	for i, r := range out {
+		ids[i] = r.UserID
+	}
+	return ids
+}
+
+func TestRankBordaCombinesMetrics(t *testing.T) {
+	// sprint order a, b, c, d; jump order c, b, d, a.
+	items := []Item{
+		bordaItem("a", 10, 1),
+		bordaItem("b", 8, 8),
+		bordaItem("c", 6, 9),
+		bordaItem("d", 4, 5),
+	}
+	out, err := Rank(items, Options{Borda: []TieBreakKey{{Metric: "sprint", Desc: true}, {Metric: "jump", Desc: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Totals: a 1+4=5, b 2+2=4, c 3+1=4, d 4+3=7. b and c tie on 4; c's
+	// best position (1st in jump) beats b's (2nd).
+	if got, want := order(out), []string{"c", "b", "a", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order %v, want %v", got, want)
+	}
+	if out[0].Score != -4 || out[3].Score != -7 {
+		t.Errorf("scores %v, %v; want -4, -7", out[0].Score, out[3].Score)
+	}
+	// The combined order matches neither single metric.
+	for _, m := range []string{"sprint", "jump"} {
+		single, _ := Rank(items, Options{Borda: []TieBreakKey{{Metric: m, Desc: true}}})
+		if reflect.DeepEqual(order(single), order(out)) {
+			t.Errorf("borda order equals %s order", m)
+		}
+	}
+}
+
+func TestBordaPointsShareTies(t *testing.T) {
+	items := []Item{bordaItem("a", 9, 0), bordaItem("b", 7, 0), bordaItem("c", 7, 0), bordaItem("d", 1, 0)}
+	points, _, err := bordaPoints(items, []TieBreakKey{{Metric: "sprint", Desc: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{1, 2.5, 2.5, 4}; !reflect.DeepEqual(points, want) {
+		t.Errorf("points %v, want %v", points, want)
+	}
+	if _, err := Rank([]Item{{UserID: "x"}}, Options{Borda: []TieBreakKey{{Metric: "sprint"}}}); err == nil {
+		t.Error("expected error for missing metric")
+	}
+	if _, err := Rank(nil, Options{Borda: []TieBreakKey{{Metric: "sprint"}}, Transform: TransformLog}); err == nil {
+		t.Error("expected error combining borda and transform")
+	}
+}
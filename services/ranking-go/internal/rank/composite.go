@@ -0,0 +1,75 @@
+package rank
+
+import (
+	"fmt"
+	"math"
+)
+
+// CompositePercent names Item.Percent in Options.Composite; any other
+// metric is read from Item.Metrics.
+const CompositePercent = "percent"
+
+// maxCompositeMetrics bounds Options.Composite.
+const maxCompositeMetrics = 20
+
+// CompositeWeight is one term of a composite score. Asc marks metrics where
+// lower is better, such as a duration or an attempt count.
+type CompositeWeight struct {
+	Metric string
+	Weight float64
+	Asc    bool
+}
+
+func validateComposite(ws []CompositeWeight) error {
+	if len(ws) > maxCompositeMetrics {
+		return fmt.Errorf("weights: at most %d metrics, got %d", maxCompositeMetrics, len(ws))
+	}
+	seen := make(map[string]bool, len(ws))
+	for _, w := range ws {
+		switch {
+		case w.Metric == "":
+			return fmt.Errorf("weights: empty metric")
+		case seen[w.Metric]:
+			return fmt.Errorf("weights: duplicate metric %q", w.Metric)
+		case !(w.Weight > 0) || math.IsInf(w.Weight, 1):
+			return fmt.Errorf("weights: %q must be a positive number, got %v", w.Metric, w.Weight)
+		}
+		seen[w.Metric] = true
+	}
+	return nil
+}
+
+// compositeScores min-max normalizes each weighted metric across the
+// cohort to [0, 1], 1 best (flipped for Asc), and returns each item's
+// weighted sum. A metric every item shares normalizes to 1 for everyone,
+// so it shifts composites without reordering them. With weights summing
+// to 1 the composite is in [0, 1].
+func compositeScores(items []Item, ws []CompositeWeight) ([]float64, error) {
+	out := make([]float64, len(items))
+	vals := make([]float64, len(items))
+	for _, w := range ws {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for i, it := range items {
+			v, ok := it.Percent, true
+			if w.Metric != CompositePercent {
+				v, ok = it.Metrics[w.Metric]
+			}
+			if !ok {
+				return nil, fmt.Errorf("user %q: missing weighted metric %q", it.UserID, w.Metric)
+			}
+			vals[i] = v
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+		for i, v := range vals {
+			norm := 1.0
+			if hi > lo {
+				norm = (v - lo) / (hi - lo)
+				if w.Asc {
+					norm = 1 - norm
+				}
+			}
+			out[i] += w.Weight * norm
+		}
+	}
+	return out, nil
+}
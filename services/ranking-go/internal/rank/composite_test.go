@@ -0,0 +1,66 @@
+package rank
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRankComposite(t *testing.T) {
+	item := func(id string, percent, secs float64) Item {
+		return Item{UserID: id, Percent: percent, Metrics: map[string]float64{"avg_time_seconds": secs}}
+	}
+	// Percent spans 60..100 and time 20..60, so both normalize in
+	// quarters; c is the most accurate but the slowest.
+	items := []Item{item("a", 80, 20), item("b", 70, 30), item("c", 100, 60), item("d", 60, 40)}
+	opts := Options{Composite: []CompositeWeight{
+		{Metric: CompositePercent, Weight: 0.5},
+		{Metric: "avg_time_seconds", Weight: 0.5, Asc: true},
+	}}
+	out, err := Rank(items, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a: .5*.5 + .5*1 = .75; b: .5*.25 + .5*.75 = .5; c: .5*1 + .5*0 = .5;
+	// d: .5*0 + .5*.5 = .25.
+	// b and c tie and fall to user_id.
+	if got, want := order(out), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order %v, want %v", got, want)
+	}
+	for i, want := range []float64{0.75, 0.5, 0.5, 0.25} {
+		if math.Abs(out[i].Score-want) > 1e-12 {
+			t.Errorf("%s: composite %v, want %v", out[i].UserID, out[i].Score, want)
+		}
+	}
+
+	// Weighting percent alone is plain percent order.
+	out, _ = Rank(items, Options{Composite: []CompositeWeight{{Metric: CompositePercent, Weight: 1}}})
+	if got, want := order(out), []string{"c", "a", "b", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("percent only: order %v, want %v", got, want)
+	}
+
+	// A metric everyone shares normalizes to 1.
+	same := []Item{item("a", 50, 10), item("b", 50, 10)}
+	out, _ = Rank(same, opts)
+	if out[0].Score != 1 || out[1].Score != 1 {
+		t.Errorf("constant metrics: %+v", out)
+	}
+}
+
+func TestRankCompositeErrors(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 1}}
+	for _, c := range []struct {
+		opts Options
+		want string
+	}{
+		{Options{Composite: []CompositeWeight{{Metric: "speed", Weight: 1}}}, `missing weighted metric "speed"`},
+		{Options{Composite: []CompositeWeight{{Metric: "percent", Weight: 0}}}, "positive"},
+		{Options{Composite: []CompositeWeight{{Metric: "percent", Weight: 1}, {Metric: "percent", Weight: 1}}}, "duplicate"},
+		{Options{Composite: []CompositeWeight{{Metric: "percent", Weight: 1}}, Transform: TransformLog}, "mutually exclusive"},
+	} {
+		if _, err := Rank(items, c.opts); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%+v: err %v, want %q", c.opts, err, c.want)
+		}
+	}
+}
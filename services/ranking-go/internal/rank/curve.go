@@ -0,0 +1,22 @@
+package rank
+
+// Curve is the rank-vs-score curve of a ranking as parallel arrays:
+// Scores[i] is the ranked score at Ranks[i]. Suited to log-log plotting.
+type Curve struct {
+	Ranks  []int
+	Scores []float64
+}
+
+// CurveOf extracts the curve from results in one pass. Results must be in
+// rank order, as returned by Rank; scores are then non-increasing.
+func CurveOf(results []Result) Curve {
+	c := Curve{
+		Ranks:  make([]int, len(results)),
+		Scores: make([]float64, len(results)),
+	}
+	for i, r := range results {
+		c.Ranks[i] = r.Rank
+		c.Scores[i] = r.Score
+	}
+	return c
+}
@@ -0,0 +1,45 @@
+package rank
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestCurveOfMatchesSortedScores(t *testing.T) {
+	items := []Item{
+		{UserID: "a", Percent: 12},
+		{UserID: "b", Percent: 97},
+		{UserID: "c", Percent: 55},
+		{UserID: "d", Percent: 55},
+		{UserID: "e", Percent: 3},
+	}
+	c := CurveOf(RankByPercent(items))
+
+	want := make([]float64, len(items))
+	for i, it := range items {
+		want[i] = it.Percent
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(want)))
+
+	if len(c.Ranks) != len(items) || len(c.Scores) != len(items) {
+		t.Fatalf("curve length: %d ranks, %d scores", len(c.Ranks), len(c.Scores))
+	}
+	for i := range want {
+		if c.Scores[i] != want[i] {
+			t.Errorf("score[%d] = %v, want %v", i, c.Scores[i], want[i])
+		}
+		if c.Ranks[i] != i+1 {
+			t.Errorf("rank[%d] = %d, want %d", i, c.Ranks[i], i+1)
+		}
+		if i > 0 && (c.Scores[i] > c.Scores[i-1] || c.Ranks[i] < c.Ranks[i-1]) {
+			t.Errorf("curve not monotonic at %d", i)
+		}
+	}
+}
+
+func TestCurveOfEmpty(t *testing.T) {
+	c := CurveOf(nil)
+	if len(c.Ranks) != 0 || len(c.Scores) != 0 {
+		t.Errorf("expected empty curve: %+v", c)
+	}
+}
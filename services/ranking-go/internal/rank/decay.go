@@ -0,0 +1,49 @@
+package rank
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Decay discounts each percent by its age, so recent results count for
+// more: score = percent * 0.5^(age / HalfLife). Ages are measured from the
+// item's TimeMetric, in Unix seconds, to AsOf; results from after AsOf
+// count in full.
+type Decay struct {
+	HalfLife   time.Duration
+	TimeMetric string
+	// AsOf is the reference time; zero means the moment of ranking, so a
+	// stored cohort decays further each time it is re-ranked.
+	AsOf time.Time
+}
+
+func (d *Decay) validate() error {
+	switch {
+	case d.HalfLife <= 0:
+		return fmt.Errorf("decay: half_life must be > 0, got %v", d.HalfLife)
+	case d.TimeMetric == "":
+		return fmt.Errorf("decay: empty time metric")
+	}
+	return nil
+}
+
+// decayScores returns each item's decayed percent.
+func decayScores(items []Item, d Decay) ([]float64, error) {
+	asOf := d.AsOf
+	if asOf.IsZero() {
+		asOf = time.Now()
+	}
+	now := float64(asOf.UnixNano()) / 1e9
+	halfLife := d.HalfLife.Seconds()
+	out := make([]float64, len(items))
+	for i, it := range items {
+		at, ok := it.Metrics[d.TimeMetric]
+		if !ok {
+			return nil, fmt.Errorf("user %q: missing decay time metric %q", it.UserID, d.TimeMetric)
+		}
+		age := math.Max(now-at, 0)
+		out[i] = it.Percent * math.Exp2(-age/halfLife)
+	}
+	return out, nil
+}
@@ -0,0 +1,56 @@
+package rank
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRankDecay(t *testing.T) {
+	asOf := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	item := func(id string, percent float64, daysAgo float64) Item {
+		at := float64(asOf.Unix()) - daysAgo*86400
+		return Item{UserID: id, Percent: percent, Metrics: map[string]float64{"finished_at": at}}
+	}
+	// With a 7-day half-life, a's 90 from two weeks ago is worth 22.5,
+	// behind b's fresh 60 and c's week-old 80 (40). d is from the future
+	// and counts in full.
+	items := []Item{item("a", 90, 14), item("b", 60, 0), item("c", 80, 7), item("d", 30, -1)}
+	out, err := Rank(items, Options{Decay: &Decay{HalfLife: 7 * 24 * time.Hour, TimeMetric: "finished_at", AsOf: asOf}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := order(out), []string{"b", "c", "d", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order %v, want %v", got, want)
+	}
+	for i, want := range []float64{60, 40, 30, 22.5} {
+		if math.Abs(out[i].Score-want) > 1e-9 {
+			t.Errorf("%s: decayed %v, want %v", out[i].UserID, out[i].Score, want)
+		}
+	}
+	if out[3].Percent != 90 {
+		t.Errorf("raw percent %v, want 90", out[3].Percent)
+	}
+
+	// A zero AsOf decays to now.
+	hourAgo := []Item{{UserID: "a", Percent: 80, Metrics: map[string]float64{"finished_at": float64(time.Now().Add(-time.Hour).Unix())}}}
+	now, _ := Rank(hourAgo, Options{Decay: &Decay{HalfLife: time.Hour, TimeMetric: "finished_at"}})
+	if math.Abs(now[0].Score-40) > 0.1 {
+		t.Errorf("decay to now: score %v, want about 40", now[0].Score)
+	}
+}
+
+func TestRankDecayErrors(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 1}}
+	for _, opts := range []Options{
+		{Decay: &Decay{HalfLife: time.Hour, TimeMetric: "finished_at"}},
+		{Decay: &Decay{TimeMetric: "finished_at"}},
+		{Decay: &Decay{HalfLife: time.Hour}},
+		{Decay: &Decay{HalfLife: time.Hour, TimeMetric: "t"}, Transform: TransformLog},
+	} {
+		if _, err := Rank(items, opts); err == nil {
+			t.Errorf("%+v: no error", opts.Decay)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package rank
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// ExternalSort bounds the memory used to sort large cohorts. Cohorts over
+// Threshold items are sorted Threshold entries at a time, each sorted run
+// spilled to a temp file in Dir ("" is the OS temp dir), and the runs
+// k-way merged back. Only one run is held in memory while spilling and one
+// entry per run while merging; the input items and final results are still
+// in memory.
+type ExternalSort struct {
+	Threshold int
+	Dir       string
+}
+
+// spilled is the on-disk form of an entry; gob needs exported fields.
+type spilled struct {
+	Item    Item
+	Score   float64
+	Arrival float64
+	Tier    int
+	Keys    []float64
+	Prio    int
+	Shuffle int
+}
+
+// externalSort returns the same order as sortItems' in-memory path, which
+// is total (user_id breaks every remaining tie), so the result is
+// identical.
+func externalSort(n int, build func(int) (entry, error), x ExternalSort) ([]entry, error) {
+	var runs []*os.File
+	defer func() {
+		for _, f := range runs {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	chunk := make([]entry, 0, x.Threshold)
+	for start := 0; start < n; start += x.Threshold {
+		end := min(start+x.Threshold, n)
+		chunk = chunk[:0]
+		for i := start; i < end; i++ {
+			e, err := build(i)
+			if err != nil {
+				return nil, err
+			}
+			chunk = append(chunk, e)
+		}
+		sort.Slice(chunk, func(i, j int) bool { return less(chunk[i], chunk[j]) })
+
+		f, err := os.CreateTemp(x.Dir, "rank-run-*")
+		if err != nil {
+			return nil, fmt.Errorf("external sort: %w", err)
+		}
+		runs = append(runs, f)
+		if err := writeRun(f, chunk); err != nil {
+			return nil, fmt.Errorf("external sort: %w", err)
+		}
+	}
+
+	h := make(runHeap, 0, len(runs))
+	for _, f := range runs {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("external sort: %w", err)
+		}
+		r := &run{dec: gob.NewDecoder(bufio.NewReader(f))}
+		ok, err := r.next()
+		if err != nil {
+			return nil, fmt.Errorf("external sort: %w", err)
+		}
+		if ok {
+			h = append(h, r)
+		}
+	}
+	heap.Init(&h)
+
+	sorted := make([]entry, 0, n)
+	for len(h) > 0 {
+		r := h[0]
+		sorted = append(sorted, r.head)
+		ok, err := r.next()
+		if err != nil {
+			return nil, fmt.Errorf("external sort: %w", err)
+		}
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	return sorted, nil
+}
+
+func writeRun(f *os.File, chunk []entry) error {
+	w := bufio.NewWriter(f)
+	enc := gob.NewEncoder(w)
+	for _, e := range chunk {
+		if err := enc.Encode(spilled{Item: e.Item, Score: e.score, Arrival: e.arrival, Tier: e.tier, Keys: e.keys, Prio: e.prio, Shuffle: e.shuffle}); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// run is a sorted spill file being merged; head is its smallest unread entry.
+type run struct {
+	dec  *gob.Decoder
+	head entry
+}
+
+// next reads the run's next entry into head; false at the end of the run.
+func (r *run) next() (bool, error) {
+	var s spilled
+	if err := r.dec.Decode(&s); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	r.head = entry{Item: s.Item, score: s.Score, arrival: s.Arrival, tier: s.Tier, keys: s.Keys, prio: s.Prio, shuffle: s.Shuffle}
+	return true, nil
+}
+
+type runHeap []*run
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return less(h[i].head, h[j].head) }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)        { *h = append(*h, x.(*run)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
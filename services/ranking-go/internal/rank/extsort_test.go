@@ -0,0 +1,53 @@
+package rank
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestExternalSortMatchesInMemory(t *testing.T) {
+	items := make([]Item, 103)
+	for i := range items {
+		items[i] = Item{
+			UserID:  fmt.Sprintf("u%03d", (i*37)%103),
+			Percent: float64((i * 7) % 11), // plenty of ties
+			Tier:    []string{"Gold", "Silver", "Bronze"}[i%3],
+			Metrics: map[string]float64{"time": float64(i % 5)},
+		}
+	}
+	for name, opts := range map[string]Options{
+		"plain":     {},
+		"tiers":     {TierOrder: []string{"Gold", "Silver"}, UnknownTier: UnknownTierLast},
+		"tie_break": {TieBreak: []TieBreakKey{{Metric: "time"}}, TiePriority: []string{"u050", "u007"}},
+		"zscore":    {Transform: TransformZScore, GraceBand: 1, NullLastTiePercentile: true},
+	} {
+		want, err := Rank(items, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		dir := t.TempDir()
+		opts.ExternalSort = &ExternalSort{Threshold: 10, Dir: dir}
+		got, err := Rank(items, opts)
+		if err != nil {
+			t.Fatalf("%s external: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: external sort differs from in-memory sort", name)
+		}
+		if left, _ := os.ReadDir(dir); len(left) != 0 {
+			t.Errorf("%s: %d spill files left behind", name, len(left))
+		}
+	}
+}
+
+func TestExternalSortBelowThresholdStaysInMemory(t *testing.T) {
+	opts := Options{ExternalSort: &ExternalSort{Threshold: 10, Dir: "/nonexistent"}}
+	if _, err := Rank([]Item{{UserID: "a", Percent: 1}, {UserID: "b", Percent: 2}}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Rank(make([]Item, 11), opts); err == nil {
+		t.Error("expected spill error for unwritable dir")
+	}
+}
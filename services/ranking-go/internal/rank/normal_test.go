@@ -0,0 +1,67 @@
+package rank
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalCDFKnownValues(t *testing.T) {
+	for _, c := range []struct{ z, want float64 }{
+		{0, 0.5},
+		{1, 0.8413447460685429},
+		{-1, 0.15865525393145707},
+		{1.96, 0.9750021048517795},
+		{-2.576, 0.004997532315735019},
+	} {
+		if got := normalCDF(c.z); math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("Φ(%v) = %v, want %v", c.z, got, c.want)
+		}
+	}
+	if got := normalCDF(-8); got <= 0 || math.Abs(got-6.220960574271819e-16)/6.220960574271819e-16 > 1e-9 {
+		t.Errorf("Φ(-8) = %v, lost lower-tail precision", got)
+	}
+}
+
+func TestRankNormalPercentile(t *testing.T) {
+	mean, sd := 60.0, 10.0
+	items := []Item{
+		{UserID: "a", Percent: 60},
+		{UserID: "b", Percent: 79.6},
+		{UserID: "c", Percent: 50},
+	}
+	out, err := Rank(items, Options{Normal: &NormalReference{Mean: &mean, SD: &sd}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"b": 97.50021048517795, "a": 50, "c": 15.865525393145707}
+	for _, r := range out {
+		if !approx(r.Percentile, want[r.UserID]) {
+			t.Errorf("%s: percentile %v, want %v", r.UserID, r.Percentile, want[r.UserID])
+		}
+	}
+	if out[0].UserID != "b" || out[0].Rank != 1 {
+		t.Errorf("ranking changed: %+v", out)
+	}
+}
+
+func TestRankNormalPercentileEstimated(t *testing.T) {
+	// Cohort mean 50, population SD 10: ±1 SD.
+	items := []Item{{UserID: "a", Percent: 60}, {UserID: "b", Percent: 40}}
+	out, err := Rank(items, Options{Normal: &NormalReference{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approx(out[0].Percentile, 84.13447460685429) || !approx(out[1].Percentile, 15.865525393145707) {
+		t.Errorf("got %v, %v", out[0].Percentile, out[1].Percentile)
+	}
+
+	same := []Item{{UserID: "a", Percent: 70}, {UserID: "b", Percent: 70}}
+	if out, _ := Rank(same, Options{Normal: &NormalReference{}}); out[0].Percentile != 50 {
+		t.Errorf("zero-variance cohort: %v, want 50", out[0].Percentile)
+	}
+
+	zero := 0.0
+	if _, err := Rank(items, Options{Normal: &NormalReference{SD: &zero}}); err == nil {
+		t.Error("expected error for sd 0")
+	}
+}
@@ -0,0 +1,121 @@
+package rank
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PercentileMethod is a percentile-rank definition. Each is a function of
+// the cohort size n, a user's competition rank r (1 + number of users
+// strictly better) and the size t of their tie group.
+type PercentileMethod string
+
+const (
+	// MethodSelfExclusive: 100 * (n-r) / (n-1), 100 when n = 1. The user is
+	// left out of their own reference; this is RankByPercent's formula.
+	MethodSelfExclusive PercentileMethod = "self_exclusive"
+	// MethodExclusive: 100 * (users strictly below) / n = 100 * (n-r-t+1) / n.
+	MethodExclusive PercentileMethod = "exclusive"
+	// MethodInclusive: 100 * (users at or below) / n = 100 * (n-r+1) / n.
+	MethodInclusive PercentileMethod = "inclusive"
+	// MethodMidpoint: 100 * (users strictly below + half the tie group) / n
+	// = 100 * (n-r-t/2+1) / n, the mean of exclusive and inclusive.
+	MethodMidpoint PercentileMethod = "midpoint"
+)
+
+func (m PercentileMethod) valid() bool {
+	switch m {
+	case "", MethodSelfExclusive, MethodExclusive, MethodInclusive, MethodMidpoint:
+		return true
+	}
+	return false
+}
+
+// percentileOf applies m; "" is MethodSelfExclusive.
+func (m PercentileMethod) percentileOf(n, r, t int) float64 {
+	switch m {
+	case MethodExclusive:
+		return 100 * float64(n-r-t+1) / float64(n)
+	case MethodInclusive:
+		return 100 * float64(n-r+1) / float64(n)
+	case MethodMidpoint:
+		return 100 * (float64(n-r+1) - float64(t)/2) / float64(n)
+	default:
+		if n == 1 {
+			return 100
+		}
+		return 100 * float64(n-r) / float64(n-1)
+	}
+}
+
+// PercentilesFromRanks recomputes percentiles for a whole cohort from its
+// stored ranks alone, without scores. ranks must be a consistent ordinal or
+// competition ranking of all n = len(ranks) users: starting at 1, and a
+// group of t users sharing rank r is followed by rank r+t. Results are in
+// input order.
+func PercentilesFromRanks(ranks []int, m PercentileMethod) ([]float64, error) {
+	if !m.valid() {
+		return nil, fmt.Errorf("unknown percentile method %q", m)
+	}
+	n := len(ranks)
+	sorted := append([]int(nil), ranks...)
+	sort.Ints(sorted)
+	ties := make(map[int]int, n)
+	for i := 0; i < n; {
+		r := sorted[i]
+		if r != i+1 {
+			return nil, fmt.Errorf("inconsistent ranks: expected rank %d, got %d", i+1, r)
+		}
+		j := i
+		for j < n && sorted[j] == r {
+			j++
+		}
+		ties[r] = j - i
+		i = j
+	}
+
+	out := make([]float64, n)
+	for i, r := range ranks {
+		out[i] = m.percentileOf(n, r, ties[r])
+	}
+	return out, nil
+}
+
+// applyMethod sets percentiles under m (not MethodSelfExclusive, which is
+// Rank's positional formula) for the users with pos >= 0, the reference.
+// Tie groups are runs of equal score and tier in sorted order, counted
+// within the reference.
+func applyMethod(sorted []entry, pos []int, out []Result, m PercentileMethod) {
+	n := 0
+	for _, p := range pos {
+		if p >= 0 {
+			n++
+		}
+	}
+	if n == 0 {
+		return
+	}
+	above := 0
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && sorted[end].score == sorted[start].score && sorted[end].tier == sorted[start].tier {
+			end++
+		}
+		t := 0
+		for i := start; i < end; i++ {
+			if pos[i] >= 0 {
+				t++
+			}
+		}
+		if t > 0 {
+			p := m.percentileOf(n, above+1, t)
+			for i := start; i < end; i++ {
+				if pos[i] >= 0 {
+					out[i].Percentile = p
+				}
+			}
+		}
+		above += t
+		start = end
+	}
+}
@@ -0,0 +1,110 @@
+package rank
+
+import "testing"
+
+func TestPercentilesFromRanksMethods(t *testing.T) {
+	// Archived ordinal ranking of 5 users, in arbitrary order.
+	ranks := []int{3, 1, 5, 2, 4}
+	cases := map[PercentileMethod][]float64{
+		MethodSelfExclusive: {50, 100, 0, 75, 25},
+		MethodExclusive:     {40, 80, 0, 60, 20},
+		MethodInclusive:     {60, 100, 20, 80, 40},
+		MethodMidpoint:      {50, 90, 10, 70, 30},
+	}
+	for m, want := range cases {
+		got, err := PercentilesFromRanks(ranks, m)
+		if err != nil {
+			t.Fatalf("%s: %v", m, err)
+		}
+		for i := range want {
+			if !approx(got[i], want[i]) {
+				t.Errorf("%s: rank %d percentile %v, want %v", m, ranks[i], got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestPercentilesFromRanksSelfExclusiveMatchesRank(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 9}, {UserID: "b", Percent: 3}, {UserID: "c", Percent: 6}}
+	r := RankByPercent(items)
+	ranks := make([]int, len(r))
+	for i := range r {
+		ranks[i] = r[i].Rank
+	}
+	got, err := PercentilesFromRanks(ranks, MethodSelfExclusive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range r {
+		if !approx(got[i], r[i].Percentile) {
+			t.Errorf("%s: %v, want %v", r[i].UserID, got[i], r[i].Percentile)
+		}
+	}
+}
+
+func TestPercentilesFromRanksCompetitionTies(t *testing.T) {
+	// 1, 2, 2, 4: the tied pair has one user strictly below.
+	got, err := PercentilesFromRanks([]int{1, 2, 2, 4}, MethodExclusive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{75, 25, 25, 0}
+	for i := range want {
+		if !approx(got[i], want[i]) {
+			t.Errorf("index %d: %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPercentilesFromRanksInconsistent(t *testing.T) {
+	for _, ranks := range [][]int{
+		{2, 3},       // doesn't start at 1
+		{1, 1, 2},    // dense, not competition
+		{1, 2, 4},    // gap
+		{1, 2, 2, 3}, // rank after a tie must skip
+	} {
+		if _, err := PercentilesFromRanks(ranks, MethodInclusive); err == nil {
+			t.Errorf("%v: expected error", ranks)
+		}
+	}
+	if _, err := PercentilesFromRanks([]int{1}, "median"); err == nil {
+		t.Error("expected error for unknown method")
+	}
+}
+
+func TestRankPercentileMethods(t *testing.T) {
+	// n = 5 with a two-way tie at the second score.
+	items := []Item{{UserID: "a", Percent: 90}, {UserID: "b", Percent: 80}, {UserID: "c", Percent: 80}, {UserID: "d", Percent: 70}, {UserID: "e", Percent: 60}}
+	for m, want := range map[PercentileMethod][]float64{
+		MethodExclusive: {80, 40, 40, 20, 0},
+		MethodInclusive: {100, 80, 80, 40, 20},
+		MethodMidpoint:  {90, 60, 60, 30, 10},
+		"":              {100, 75, 50, 25, 0},
+	} {
+		out, err := Rank(items, Options{Method: m})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, r := range out {
+			if !approx(r.Percentile, want[i]) {
+				t.Errorf("%q: %s %v, want %v", m, r.UserID, r.Percentile, want[i])
+			}
+		}
+	}
+}
+
+func TestRankPercentileMethodReference(t *testing.T) {
+	// Users failing min_score are left out of n.
+	items := []Item{{UserID: "a", Percent: 90}, {UserID: "b", Percent: 80}, {UserID: "c", Percent: 10}}
+	cut := 50.0
+	out, _ := Rank(items, Options{Method: MethodInclusive, MinScore: &cut})
+	if out[0].Percentile != 100 || out[1].Percentile != 50 || !out[2].PercentileNull {
+		t.Errorf("got %+v", out)
+	}
+	if _, err := Rank(items, Options{Method: MethodMidpoint, Weighted: true}); err == nil {
+		t.Error("expected error for percentile_method with weighted")
+	}
+	if _, err := Rank(items, Options{Method: "median"}); err == nil {
+		t.Error("expected error for unknown method")
+	}
+}
@@ -0,0 +1,69 @@
+package rank
+
+import "fmt"
+
+// validatePins checks what can be checked without the cohort: ranks are
+// positive and no two users share one.
+func validatePins(pins map[string]int) error {
+	byRank := make(map[int]string, len(pins))
+	for id, r := range pins {
+		if r < 1 {
+			return fmt.Errorf("pins: user %q: rank must be >= 1, got %d", id, r)
+		}
+		if other, dup := byRank[r]; dup {
+			a, b := min(id, other), max(id, other)
+			return fmt.Errorf("pins: users %q and %q both pinned to rank %d", a, b, r)
+		}
+		byRank[r] = id
+	}
+	return nil
+}
+
+// applyPins moves each pinned user to position rank-1 and fills the other
+// positions with the unpinned users in their sorted order.
+func applyPins(sorted []entry, pins map[string]int) ([]entry, error) {
+	n := len(sorted)
+	out := make([]entry, n)
+	filled := make([]bool, n)
+	found := 0
+	for _, e := range sorted {
+		r, ok := pins[e.UserID]
+		if !ok {
+			continue
+		}
+		if r > n {
+			return nil, fmt.Errorf("pins: user %q: rank %d exceeds cohort size %d", e.UserID, r, n)
+		}
+		e.pinned = true
+		out[r-1], filled[r-1] = e, true
+		found++
+	}
+	if found != len(pins) {
+		for id := range pins {
+			if !containsUser(sorted, id) {
+				return nil, fmt.Errorf("pins: user %q not in cohort", id)
+			}
+		}
+	}
+	j := 0
+	for _, e := range sorted {
+		if _, ok := pins[e.UserID]; ok {
+			continue
+		}
+		for filled[j] {
+			j++
+		}
+		out[j] = e
+		j++
+	}
+	return out, nil
+}
+
+func containsUser(sorted []entry, id string) bool {
+	for _, e := range sorted {
+		if e.UserID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package rank
+
+import "testing"
+
+func TestRankPinToFirst(t *testing.T) {
+	items := []Item{
+		{UserID: "a", Percent: 90},
+		{UserID: "b", Percent: 80},
+		{UserID: "base", Percent: 10}, // reference baseline shown on top
+		{UserID: "c", Percent: 70},
+	}
+	out, err := Rank(items, Options{Pins: map[string]int{"base": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"base", "a", "b", "c"}
+	for i, r := range out {
+		if r.UserID != want[i] || r.Rank != i+1 {
+			t.Errorf("rank %d: %s, want %s", r.Rank, r.UserID, want[i])
+		}
+	}
+	if !out[0].PercentileNull {
+		t.Error("pinned user should have no percentile")
+	}
+	// The others' percentiles ignore the pinned user: a, b, c = 100, 50, 0.
+	for i, p := range []float64{100, 50, 0} {
+		if r := out[i+1]; r.PercentileNull || !approx(r.Percentile, p) {
+			t.Errorf("%s: percentile %v, want %v", r.UserID, r.Percentile, p)
+		}
+	}
+}
+
+func TestRankPinsFillAround(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 4}, {UserID: "b", Percent: 3}, {UserID: "c", Percent: 2}, {UserID: "d", Percent: 1}}
+	out, err := Rank(items, Options{Pins: map[string]int{"a": 4, "d": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ""
+	for _, r := range out {
+		got += r.UserID
+	}
+	if got != "bdca" {
+		t.Errorf("order %s, want bdca", got)
+	}
+}
+
+func TestRankPinsConflicts(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 2}, {UserID: "b", Percent: 1}}
+	for name, pins := range map[string]map[string]int{
+		"same rank":  {"a": 1, "b": 1},
+		"zero":       {"a": 0},
+		"past end":   {"a": 3},
+		"not cohort": {"zz": 1},
+	} {
+		if _, err := Rank(items, Options{Pins: pins}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
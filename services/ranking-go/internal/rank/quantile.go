@@ -0,0 +1,54 @@
+package rank
+
+import "math"
+
+// Quantile groups users by percentile into equal bands, so clients can
+// show "Top 10%" without recomputing: Result.Quantile is 1 for the top
+// band and Bands() for the bottom one.
+type Quantile string
+
+const (
+	QuantileQuartile Quantile = "quartile"
+	QuantileQuintile Quantile = "quintile"
+	QuantileDecile   Quantile = "decile"
+)
+
+// Bands is how many bands q splits the percentile scale into; 0 for none.
+func (q Quantile) Bands() int {
+	switch q {
+	case QuantileQuartile:
+		return 4
+	case QuantileQuintile:
+		return 5
+	case QuantileDecile:
+		return 10
+	}
+	return 0
+}
+
+func (q Quantile) valid() bool {
+	return q == "" || q.Bands() > 0
+}
+
+// applyQuantile sets each user's band from their final percentile, read
+// top-is-100 whatever the Direction, so band 1 is always the best users.
+// A user at exactly a band's lower edge (90 for the top decile) is in it.
+// Users without a percentile get no band.
+func applyQuantile(out []Result, opts Options) {
+	k := opts.Quantile.Bands()
+	if k == 0 {
+		return
+	}
+	for i := range out {
+		out[i].Quantile = 0
+		if out[i].PercentileNull {
+			continue
+		}
+		p := out[i].Percentile
+		if opts.Direction == TopIsLow {
+			p = 100 - p
+		}
+		b := int(math.Ceil((100 - p) * float64(k) / 100))
+		out[i].Quantile = min(max(b, 1), k)
+	}
+}
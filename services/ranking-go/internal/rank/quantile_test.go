@@ -0,0 +1,57 @@
+package rank
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestQuantileBands(t *testing.T) {
+	// 11 users: percentiles 100, 90, ..., 0.
+	var items []Item
+	for i := 0; i < 11; i++ {
+		items = append(items, Item{UserID: fmt.Sprintf("u%02d", i), Percent: float64(100 - i)})
+	}
+	out, err := Rank(items, Options{Quantile: QuantileDecile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{1, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for i, r := range out {
+		if r.Quantile != want[i] {
+			t.Errorf("%s (percentile %v): decile %d, want %d", r.UserID, r.Percentile, r.Quantile, want[i])
+		}
+	}
+
+	// Bands are read top-is-100 whatever the direction.
+	out, _ = Rank(items, Options{Quantile: QuantileQuartile, Direction: TopIsLow})
+	if out[0].Quantile != 1 || out[10].Quantile != 4 {
+		t.Errorf("top_is_low: first %d, last %d", out[0].Quantile, out[10].Quantile)
+	}
+
+	// Withheld percentiles get no band.
+	cut := 95.0
+	out, _ = Rank(items, Options{Quantile: QuantileQuintile, MinScore: &cut})
+	if out[0].Quantile != 1 || out[10].Quantile != 0 {
+		t.Errorf("min_score: first %d, last %d", out[0].Quantile, out[10].Quantile)
+	}
+
+	if _, err := Rank(items, Options{Quantile: "tercile"}); err == nil {
+		t.Error("expected error for unknown quantile")
+	}
+}
+
+func TestUpdateScoreKeepsQuantiles(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 90}, {UserID: "b", Percent: 50}, {UserID: "c", Percent: 10}}
+	opts := Options{Quantile: QuantileQuartile}
+	results, _ := Rank(items, opts)
+	newItems, got, err := UpdateScore(items, results, opts, "c", 95)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := Rank(newItems, opts)
+	for i := range want {
+		if got[i].Quantile != want[i].Quantile {
+			t.Errorf("%s: quantile %d, want %d", got[i].UserID, got[i].Quantile, want[i].Quantile)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package rank
 
 import (
+	"fmt"
+	"math"
+	"math/rand"
 	"sort"
 )
 
@@ -8,6 +11,19 @@ import (
 type Item struct {
 	UserID  string
 	Percent float64
+	// Tier is a categorical award tier; only used when Options.TierOrder is set.
+	Tier string
+	// Metrics are extra named values, e.g. for Options.TieBreak.
+	Metrics map[string]float64
+	// Arrival orders submissions, smaller is earlier (a sequence number or
+	// timestamp); only used by Options.ArrivalTieBreak.
+	Arrival *float64
+	// Weight is the user's population weight under Options.Weighted; 0
+	// means 1.
+	Weight float64
+	// Submitted is when Percent was submitted, in Unix nanoseconds, for
+	// updates that may arrive late or twice; 0 if unknown. Not ranked on.
+	Submitted int64
 }
 
 // Result is (user_id, rank, percentile). Rank 1 is best.
@@ -15,46 +31,750 @@ type Result struct {
 	UserID     string
 	Rank       int
 	Percentile float64
+	// PercentileNull means the percentile is withheld (see
+	// Options.NullLastTiePercentile); Percentile is then meaningless.
+	PercentileNull bool
+	// Percent is the raw input; Score is what was ranked (Percent after
+	// Options.Transform).
+	Percent float64
+	Score   float64
+	// ZScore is Percent's standard score against the cohort mean and
+	// population SD, 0 for a zero-variance cohort.
+	ZScore float64
+	// TScore is 50 + 10·ZScore.
+	TScore float64
+	// TieGroup numbers tie groups from 0, best first: users tied on score
+	// within a tier, or sharing a GraceBand group, have the same TieGroup.
+	TieGroup int
+	// BestRank and WorstRank bound the rank reachable by moving this
+	// user's percent by Options.StabilityDelta; 0 when not computed.
+	BestRank, WorstRank int
+	// FractionalRank is the mean position of the user's tie group under
+	// StrategyFractional; 0 otherwise.
+	FractionalRank float64
+	// Quantile is the user's percentile band under Options.Quantile, 1
+	// best; 0 when not computed or the percentile is withheld.
+	Quantile int
+	// Badge is the name of the user's badge under Options.Badges; "" for
+	// none.
+	Badge string
+}
+
+// Options tunes Rank. The zero value reproduces RankByPercent.
+type Options struct {
+	// TrimPercent drops the top and bottom TrimPercent% of the cohort from the
+	// percentile reference. Everyone is still ranked; users in the trimmed
+	// tails are clamped to 100 (top) or 0 (bottom). Must be in [0, 50).
+	TrimPercent float64
+
+	// TierOrder, best first, makes Item.Tier the primary sort key; percent
+	// only orders users within a tier.
+	TierOrder []string
+	// UnknownTier decides what happens to tiers missing from TierOrder.
+	UnknownTier UnknownTierPolicy
+
+	// TiePrecision rounds scores to this many decimals before they are
+	// compared, so e.g. 80.04 and 80.01 tie at 1 decimal but not at 2. nil
+	// compares exact values.
+	TiePrecision *int
+
+	// ArrivalTieBreak resolves exact score ties by earliest Item.Arrival,
+	// before TieBreak. Every item must have an Arrival.
+	ArrivalTieBreak bool
+
+	// TieBreak resolves exact score ties by these metrics, in order, until
+	// one differs. Every item must carry every listed metric. TiePriority
+	// and user_id apply only after all keys are equal.
+	TieBreak []TieBreakKey
+
+	// TiePriority orders users within an exact tie: listed users first, in
+	// list order, then unlisted users by user_id. IDs not in the cohort are
+	// ignored.
+	TiePriority []string
+
+	// Pins fixes users at ranks regardless of score (user_id -> rank); the
+	// rest fill the remaining ranks in their usual order. Pinned users get
+	// no percentile and are left out of everyone else's percentile
+	// reference, so the others' percentiles are as if the pinned users
+	// weren't ranked. They never join ties or grace groups.
+	Pins map[string]int
+
+	// ShuffleSeed, if set, replaces user_id as the last tie-break with a
+	// seeded random permutation of the cohort. The permutation is drawn
+	// over the users in user_id order, so it depends only on the seed and
+	// the set of users, never on input order.
+	ShuffleSeed *int64
+
+	// Transform ranks on a transformed score instead of the raw percent.
+	Transform Transform
+
+	// Scoring ranks on a score computed from other metrics; see Scoring.
+	// Under ScoringWilson, Result.Score is the Wilson lower bound.
+	Scoring Scoring
+
+	// Borda ranks each listed metric separately (Desc: higher is better)
+	// and orders users by the sum of their positions, lowest first; see
+	// bordaPoints. Equal totals go to the better best single-metric
+	// position, then the usual tie-breaks. Percent is ignored for
+	// ordering, and Result.Score is the negated point total.
+	Borda []TieBreakKey
+
+	// Composite ranks on a weighted sum of normalized metrics instead of
+	// the raw percent; see compositeScores. Result.Score is the composite.
+	Composite []CompositeWeight
+
+	// Decay ranks on percents discounted by age; see Decay. Result.Score
+	// is the decayed percent.
+	Decay *Decay
+
+	// Shrinkage ranks on percents shrunk toward a prior by attempt count;
+	// see Shrinkage. Result.Score is the shrunk percent.
+	Shrinkage *Shrinkage
+
+	// GraceBand, in percentage points, reports near-tied users with a shared
+	// rank. Neighbours in sorted order whose percents differ by at most
+	// GraceBand join the same group, and groups chain transitively: 70, 69.4
+	// and 68.8 share a rank under a 0.6 band though 70 and 68.8 are 1.2 apart.
+	// Each group reports its best member's rank. Sort order and percentiles
+	// still follow the true order. 0 disables grouping.
+	GraceBand float64
+
+	// Strategy numbers tied users; the default is StrategyOrdinal.
+	// Percentiles always follow sort order, whatever the strategy.
+	Strategy Strategy
+
+	// SingleItemPercentile is the percentile given when the percentile
+	// reference holds a single user (n=1, or one user left after trimming).
+	// nil means 100.
+	SingleItemPercentile *float64
+
+	// TopPercentile caps every percentile, so the best user shows this
+	// value rather than 100. Clamping everyone (not only rank 1) keeps
+	// percentiles in rank order. It applies after the percentile method
+	// (including Weighted, Anchors and Normal) and before Direction. nil
+	// means no cap.
+	TopPercentile *float64
+
+	// MinDenominator floors the self-exclusive denominator n-1 so tiny
+	// cohorts don't swing between 0 and 100: percentile = 100 * (1 -
+	// (rank-1) / max(n-1, MinDenominator)). 0 keeps the exact n-1.
+	MinDenominator int
+
+	// StabilityDelta, in percentage points, computes each user's
+	// BestRank and WorstRank under a ±StabilityDelta change to their own
+	// percent. 0 disables it.
+	StabilityDelta float64
+
+	// MinScore is a passing cutoff on the raw percent. Users who fail it
+	// are still ranked, but their percentile is withheld (PercentileNull)
+	// and the percentile reference is only the users who pass. Cutoff
+	// decides whether a percent exactly at MinScore passes.
+	MinScore *float64
+	Cutoff   CutoffInclusivity
+
+	// Method chooses the percentile definition. "" and MethodSelfExclusive
+	// keep the positional formula; the others are computed from each tie
+	// group's competition rank and size within the reference (see
+	// PercentileMethod), and TrimPercent, MinDenominator and
+	// SingleItemPercentile then have no effect on percentiles.
+	Method PercentileMethod
+
+	// Weighted replaces the self-exclusive percentile with a
+	// population-weighted one: the share of the reference's total
+	// Item.Weight below the user, read within the user's tie group as
+	// TieWeight says. TrimPercent, MinDenominator and SingleItemPercentile
+	// then have no effect on percentiles.
+	Weighted  bool
+	TieWeight TieWeight
+
+	// Anchors, if set, replaces the empirical percentile with one read off
+	// a fixed reference curve: each raw percent is linearly interpolated
+	// between the anchors around it, clamping outside the curve. Like
+	// Normal, the cohort itself does not affect percentiles.
+	Anchors []Anchor
+
+	// Normal, if set, replaces the empirical percentile with a normal-CDF
+	// percentile of the raw percent. TrimPercent, MinDenominator and
+	// SingleItemPercentile then have no effect on percentiles.
+	Normal *NormalReference
+
+	// Direction TopIsLow reports every percentile p as 100 - p, after all
+	// other percentile options, so the best user is near 0. Ranks are
+	// unchanged.
+	Direction PercentileDirection
+
+	// NullLastTiePercentile withholds the percentile of users tied for last
+	// place, keeping their rank. The last tie group is the trailing run of
+	// equal scores, or the last grace group when GraceBand is set; a lone
+	// last-place user is not a tie and keeps their percentile.
+	NullLastTiePercentile bool
+
+	// Quantile assigns each user a percentile band (Result.Quantile):
+	// quartile, quintile or decile. "" assigns none.
+	Quantile Quantile
+
+	// Badges, best first, names percentile ranges (Result.Badge), e.g.
+	// Platinum from 95, Gold from 80. Users below the last get none.
+	Badges []Badge
+
+	// ExternalSort, if set, sorts cohorts larger than its threshold on disk.
+	// The ranking is identical either way.
+	ExternalSort *ExternalSort
+
+	// TopK, if positive, returns only the best TopK users, selected with a
+	// bounded heap instead of sorting the cohort. Their ranks and
+	// percentiles are those of the full ranking. It takes precedence over
+	// ExternalSort and cannot be combined with options that need the users
+	// below the top (see validateTopK). 0 returns everyone.
+	TopK int
+}
+
+// PercentileDirection is which end of the percentile scale the top user is at.
+type PercentileDirection string
+
+const (
+	TopIs100 PercentileDirection = "top_is_100" // default
+	TopIsLow PercentileDirection = "top_is_low"
+)
+
+// CutoffInclusivity is whether a score exactly at a cutoff passes it.
+type CutoffInclusivity string
+
+const (
+	CutoffInclusive CutoffInclusivity = "inclusive" // default: passes if >= cutoff
+	CutoffExclusive CutoffInclusivity = "exclusive" // passes if > cutoff
+)
+
+// passes reports whether percent meets MinScore under Cutoff. Every cutoff
+// check goes through here so the boundary is treated the same everywhere.
+func (o Options) passes(percent float64) bool {
+	if o.MinScore == nil {
+		return true
+	}
+	if o.Cutoff == CutoffExclusive {
+		return percent > *o.MinScore
+	}
+	return percent >= *o.MinScore
+}
+
+// TieBreakKey is one level of Options.TieBreak.
+type TieBreakKey struct {
+	Metric string
+	Desc   bool // higher value ranks first
+}
+
+// UnknownTierPolicy handles items whose Tier is not in Options.TierOrder.
+type UnknownTierPolicy string
+
+const (
+	UnknownTierError UnknownTierPolicy = "error" // default: reject the request
+	UnknownTierLast  UnknownTierPolicy = "last"  // rank below every known tier
+)
+
+// Validate reports the first invalid option.
+func (o Options) Validate() error {
+	if o.TrimPercent < 0 || o.TrimPercent >= 50 {
+		return fmt.Errorf("trim_percent must be in [0, 50), got %v", o.TrimPercent)
+	}
+	seen := make(map[string]bool, len(o.TierOrder))
+	for _, t := range o.TierOrder {
+		if seen[t] {
+			return fmt.Errorf("tier_order: duplicate tier %q", t)
+		}
+		seen[t] = true
+	}
+	switch o.UnknownTier {
+	case "", UnknownTierError, UnknownTierLast:
+	default:
+		return fmt.Errorf("unknown_tier must be %q or %q, got %q", UnknownTierError, UnknownTierLast, o.UnknownTier)
+	}
+	if p := o.TopPercentile; p != nil && (*p < 0 || *p > 100) {
+		return fmt.Errorf("top_percentile must be in [0, 100], got %v", *p)
+	}
+	if p := o.SingleItemPercentile; p != nil && (*p < 0 || *p > 100) {
+		return fmt.Errorf("single_item_percentile must be in [0, 100], got %v", *p)
+	}
+	for i, k := range o.TieBreak {
+		if k.Metric == "" {
+			return fmt.Errorf("tie_break[%d]: empty metric", i)
+		}
+	}
+	if p := o.TiePrecision; p != nil && (*p < 0 || *p > 10) {
+		return fmt.Errorf("tie_precision must be in [0, 10], got %d", *p)
+	}
+	switch o.Cutoff {
+	case "", CutoffInclusive, CutoffExclusive:
+	default:
+		return fmt.Errorf("cutoff must be %q or %q, got %q", CutoffInclusive, CutoffExclusive, o.Cutoff)
+	}
+	switch o.Direction {
+	case "", TopIs100, TopIsLow:
+	default:
+		return fmt.Errorf("percentile_direction must be %q or %q, got %q", TopIs100, TopIsLow, o.Direction)
+	}
+	if o.MinDenominator < 0 {
+		return fmt.Errorf("min_denominator must be >= 0, got %d", o.MinDenominator)
+	}
+	if err := validatePins(o.Pins); err != nil {
+		return err
+	}
+	if !o.Strategy.valid() {
+		return fmt.Errorf("strategy must be %q, %q, %q or %q, got %q", StrategyOrdinal, StrategyDense, StrategyCompetition, StrategyFractional, o.Strategy)
+	}
+	if len(o.Pins) > 0 && o.Strategy != "" && o.Strategy != StrategyOrdinal {
+		return fmt.Errorf("pins require the ordinal strategy")
+	}
+	if len(o.Pins) > 0 && o.StabilityDelta > 0 {
+		return fmt.Errorf("pins and stability_delta are mutually exclusive")
+	}
+	if o.StabilityDelta < 0 {
+		return fmt.Errorf("stability_delta must be >= 0, got %v", o.StabilityDelta)
+	}
+	if o.GraceBand < 0 {
+		return fmt.Errorf("grace_band must be >= 0, got %v", o.GraceBand)
+	}
+	if r := o.Normal; r != nil && r.SD != nil && *r.SD <= 0 {
+		return fmt.Errorf("normal_percentile sd must be > 0, got %v", *r.SD)
+	}
+	if !o.TieWeight.valid() {
+		return fmt.Errorf("tie_weight must be %q, %q or %q, got %q", TieWeightMidpoint, TieWeightStart, TieWeightEnd, o.TieWeight)
+	}
+	if o.Anchors != nil {
+		if err := validateAnchors(o.Anchors); err != nil {
+			return err
+		}
+	}
+	if !o.Method.valid() {
+		return fmt.Errorf("percentile_method must be %q, %q, %q or %q, got %q", MethodSelfExclusive, MethodExclusive, MethodInclusive, MethodMidpoint, o.Method)
+	}
+	custom := o.Method != "" && o.Method != MethodSelfExclusive
+	if n := b2i(o.Weighted) + b2i(o.Normal != nil) + b2i(o.Anchors != nil) + b2i(custom); n > 1 {
+		return fmt.Errorf("weighted, normal_percentile, anchors and percentile_method are mutually exclusive")
+	}
+	if x := o.ExternalSort; x != nil && x.Threshold <= 0 {
+		return fmt.Errorf("external sort threshold must be > 0, got %d", x.Threshold)
+	}
+	for i, k := range o.Borda {
+		if k.Metric == "" {
+			return fmt.Errorf("borda[%d]: empty metric", i)
+		}
+	}
+	if len(o.Borda) > 0 && o.Transform != TransformNone {
+		return fmt.Errorf("borda and transform are mutually exclusive")
+	}
+	if err := validateComposite(o.Composite); err != nil {
+		return err
+	}
+	if len(o.Composite) > 0 && (len(o.Borda) > 0 || o.Transform != TransformNone) {
+		return fmt.Errorf("weights, borda and transform are mutually exclusive")
+	}
+	if o.Decay != nil {
+		if err := o.Decay.validate(); err != nil {
+			return err
+		}
+		if len(o.Composite) > 0 || len(o.Borda) > 0 || o.Transform != TransformNone {
+			return fmt.Errorf("decay cannot be combined with weights, borda or transform")
+		}
+	}
+	if o.Shrinkage != nil {
+		if err := o.Shrinkage.validate(); err != nil {
+			return err
+		}
+		if len(o.Composite) > 0 || len(o.Borda) > 0 || o.Transform != TransformNone || o.Decay != nil {
+			return fmt.Errorf("shrinkage cannot be combined with weights, borda, transform or decay")
+		}
+	}
+	if !o.Scoring.valid() {
+		return fmt.Errorf("unknown scoring %q", o.Scoring)
+	}
+	if o.Scoring != ScoringPercent && (len(o.Composite) > 0 || len(o.Borda) > 0 || o.Transform != TransformNone || o.Decay != nil || o.Shrinkage != nil) {
+		return fmt.Errorf("scoring %q cannot be combined with weights, borda, transform, decay or shrinkage", o.Scoring)
+	}
+	if !o.Transform.valid() {
+		return fmt.Errorf("unknown transform %q", o.Transform)
+	}
+	if !o.Quantile.valid() {
+		return fmt.Errorf("quantile must be %q, %q or %q, got %q", QuantileQuartile, QuantileQuintile, QuantileDecile, o.Quantile)
+	}
+	if err := validateBadges(o.Badges); err != nil {
+		return err
+	}
+	return o.validateTopK()
 }
 
 // RankByPercent sorts by percent desc, tie-break by user_id asc (stable).
 // percentile = 100 * (1 - (rank-1)/(n-1)) for n>1 else 100.
 func RankByPercent(items []Item) []Result {
+	out, _ := Rank(items, Options{})
+	return out
+}
+
+// Rank is RankByPercent with options applied.
+func Rank(items []Item, opts Options) ([]Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
 	n := len(items)
 	if n == 0 {
-		return nil
+		return nil, nil
 	}
 
-	// Copy and sort: percent desc, then user_id asc
-	type kv struct {
-		userID  string
-		percent float64
+	if opts.Weighted {
+		if err := checkWeights(items); err != nil {
+			return nil, err
+		}
 	}
-	kvs := make([]kv, n)
-	for i := range items {
-		kvs[i] = kv{items[i].UserID, items[i].Percent}
+	sorted, err := sortItems(items, opts)
+	if err != nil {
+		return nil, err
 	}
-	sort.Slice(kvs, func(i, j int) bool {
-		if kvs[i].percent != kvs[j].percent {
-			return kvs[i].percent > kvs[j].percent
+	if len(opts.Pins) > 0 {
+		if sorted, err = applyPins(sorted, opts.Pins); err != nil {
+			return nil, err
 		}
-		return kvs[i].userID < kvs[j].userID
-	})
+	}
+
+	// pos[i] is sorted user i's position among the unpinned users who pass
+	// MinScore, or -1; without a cutoff or pins it is just i.
+	pos := make([]int, len(sorted))
+	passed := 0
+	for i, e := range sorted {
+		pos[i] = -1
+		if opts.passes(e.Percent) && !e.pinned {
+			pos[i] = passed
+			passed++
+		}
+	}
+	if len(sorted) < n {
+		// Under TopK the reference still counts every passing user.
+		passed = 0
+		for _, it := range items {
+			if opts.passes(it.Percent) {
+				passed++
+			}
+		}
+		n = len(sorted)
+	}
+
+	// Percentile reference: the middle passed-2k passing users after
+	// trimming k per tail.
+	k := int(float64(passed) * opts.TrimPercent / 100)
+	m := passed - 2*k
+
+	mean, sd := meanStdDev(items)
 
 	out := make([]Result, n)
-	for i := range kvs {
-		rank := i + 1
-		var pct float64
-		if n > 1 {
-			pct = 100.0 * (1.0 - float64(rank-1)/float64(n-1))
+	for i, e := range sorted {
+		out[i] = Result{
+			UserID:  e.UserID,
+			Rank:    i + 1,
+			Percent: e.Percent,
+			Score:   e.score,
+			ZScore:  zScore(e.Percent, mean, sd),
+			TScore:  tScore(e.Percent, mean, sd),
+		}
+		if pos[i] < 0 {
+			out[i].PercentileNull = true
 		} else {
-			pct = 100.0
+			out[i].Percentile = opts.percentile(pos[i], k, m)
 		}
-		out[i] = Result{
-			UserID:     kvs[i].userID,
-			Rank:       rank,
-			Percentile: pct,
+	}
+	if opts.Method != "" && opts.Method != MethodSelfExclusive {
+		applyMethod(sorted, pos, out, opts.Method)
+	}
+	if opts.Weighted {
+		applyWeighted(sorted, pos, out, opts.TieWeight)
+	}
+	if opts.Anchors != nil {
+		for i := range out {
+			out[i].Percentile = anchoredPercentile(opts.Anchors, out[i].Percent)
+		}
+	}
+	if opts.Normal != nil {
+		nm, nsd := opts.Normal.params(items)
+		for i := range out {
+			out[i].Percentile = normalPercentile(out[i].Percent, nm, nsd)
+		}
+	}
+	if c := opts.TopPercentile; c != nil {
+		for i := range out {
+			out[i].Percentile = math.Min(out[i].Percentile, *c)
+		}
+	}
+	if opts.Direction == TopIsLow {
+		for i := range out {
+			out[i].Percentile = 100 - out[i].Percentile
+		}
+	}
+	if opts.GraceBand > 0 {
+		applyGraceBand(sorted, out, opts.GraceBand)
+	}
+	for i := 1; i < n; i++ {
+		out[i].TieGroup = out[i-1].TieGroup
+		tied := sorted[i].score == sorted[i-1].score && sorted[i].tier == sorted[i-1].tier
+		if sorted[i].pinned || sorted[i-1].pinned || !tied && out[i].Rank != out[i-1].Rank {
+			out[i].TieGroup++
+		}
+	}
+	applyStrategy(out, opts.Strategy)
+	if opts.StabilityDelta > 0 {
+		applyStability(sorted, out, opts.StabilityDelta)
+	}
+	if opts.NullLastTiePercentile {
+		if start := lastTieStart(out); start < n-1 {
+			for i := start; i < n; i++ {
+				out[i].PercentileNull = true
+			}
+		}
+	}
+	applyQuantile(out, opts)
+	applyBadges(out, opts)
+	return out, nil
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func roundTo(x float64, decimals int) float64 {
+	p := math.Pow10(decimals)
+	return math.Round(x*p) / p
+}
+
+func zScore(x, mean, sd float64) float64 {
+	if sd == 0 {
+		return 0
+	}
+	return (x - mean) / sd
+}
+
+func tScore(x, mean, sd float64) float64 {
+	return 50 + 10*zScore(x, mean, sd)
+}
+
+// lastTieStart is the index of the first member of the last-place tie group.
+func lastTieStart(out []Result) int {
+	i := len(out) - 1
+	for i > 0 && out[i-1].TieGroup == out[len(out)-1].TieGroup {
+		i--
+	}
+	return i
+}
+
+// applyGraceBand gives each chained near-tie group its first member's rank.
+// Groups never span tiers.
+func applyGraceBand(sorted []entry, out []Result, band float64) {
+	for i := 1; i < len(sorted); i++ {
+		prev, cur := sorted[i-1], sorted[i]
+		if prev.pinned || cur.pinned {
+			continue
+		}
+		if prev.tier == cur.tier && prev.Percent-cur.Percent <= band {
+			out[i].Rank = out[i-1].Rank
+		}
+	}
+}
+
+// entry is an item with its precomputed sort keys.
+type entry struct {
+	Item
+	score   float64
+	tier    int       // index in TierOrder; 0 when unused
+	arrival float64   // Item.Arrival under ArrivalTieBreak; 0 otherwise
+	keys    []float64 // Borda best position, then TieBreak values negated for Desc; smaller is better
+	prio    int       // index in TiePriority; len(TiePriority) when unlisted
+	shuffle int       // position in the ShuffleSeed permutation; 0 when unused
+	pinned  bool      // placed by Options.Pins
+}
+
+// sortItems returns entries sorted by tier (if TierOrder is set), then
+// score desc, then arrival, then the TieBreak keys, then tie priority, then
+// the ShuffleSeed permutation, then user_id asc.
+func sortItems(items []Item, opts Options) ([]entry, error) {
+	scores, err := transformScores(items, opts.Transform)
+	if err != nil {
+		return nil, err
+	}
+	// Under Borda the score is the negated point total, so the usual
+	// score-descending order puts the lowest total first, and the best
+	// single-metric position is the first tie-break key.
+	var bordaBest []float64
+	if len(opts.Borda) > 0 {
+		var points []float64
+		if points, bordaBest, err = bordaPoints(items, opts.Borda); err != nil {
+			return nil, err
+		}
+		for i := range scores {
+			scores[i] = -points[i]
 		}
 	}
+	if len(opts.Composite) > 0 {
+		if scores, err = compositeScores(items, opts.Composite); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Decay != nil {
+		if scores, err = decayScores(items, *opts.Decay); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Shrinkage != nil {
+		if scores, err = shrunkScores(items, *opts.Shrinkage); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Scoring == ScoringWilson {
+		if scores, err = wilsonScores(items); err != nil {
+			return nil, err
+		}
+	}
+	if opts.TiePrecision != nil {
+		for i := range scores {
+			scores[i] = roundTo(scores[i], *opts.TiePrecision)
+		}
+	}
+
+	tierRank := make(map[string]int, len(opts.TierOrder))
+	for i, t := range opts.TierOrder {
+		tierRank[t] = i
+	}
+	prio := make(map[string]int, len(opts.TiePriority))
+	for i, id := range opts.TiePriority {
+		if _, dup := prio[id]; !dup {
+			prio[id] = i
+		}
+	}
+
+	var shuffle []int
+	if opts.ShuffleSeed != nil {
+		shuffle = shuffled(items, *opts.ShuffleSeed)
+	}
+
+	build := func(i int) (entry, error) {
+		it := items[i]
+		e := entry{Item: it, score: scores[i], prio: len(opts.TiePriority)}
+		if shuffle != nil {
+			e.shuffle = shuffle[i]
+		}
+		if len(opts.TierOrder) > 0 {
+			r, ok := tierRank[it.Tier]
+			if !ok {
+				if opts.UnknownTier != UnknownTierLast {
+					return entry{}, fmt.Errorf("user %q: tier %q not in tier_order", it.UserID, it.Tier)
+				}
+				r = len(opts.TierOrder)
+			}
+			e.tier = r
+		}
+		if p, ok := prio[it.UserID]; ok {
+			e.prio = p
+		}
+		if opts.ArrivalTieBreak {
+			if it.Arrival == nil {
+				return entry{}, fmt.Errorf("user %q: missing arrival", it.UserID)
+			}
+			e.arrival = *it.Arrival
+		}
+		if bordaBest != nil {
+			e.keys = append(e.keys, bordaBest[i])
+		}
+		if len(opts.TieBreak) > 0 {
+			for _, k := range opts.TieBreak {
+				v, ok := it.Metrics[k.Metric]
+				if !ok {
+					return entry{}, fmt.Errorf("user %q: missing tie_break metric %q", it.UserID, k.Metric)
+				}
+				if k.Desc {
+					v = -v
+				}
+				e.keys = append(e.keys, v)
+			}
+		}
+		return e, nil
+	}
+
+	if k := opts.TopK; k > 0 && k < len(items) {
+		return selectTop(len(items), k, build)
+	}
+	if x := opts.ExternalSort; x != nil && len(items) > x.Threshold {
+		return externalSort(len(items), build, *x)
+	}
+
+	sorted := make([]entry, len(items))
+	for i := range items {
+		e, err := build(i)
+		if err != nil {
+			return nil, err
+		}
+		sorted[i] = e
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+	return sorted, nil
+}
+
+// shuffled returns each item's position in a permutation seeded by seed and
+// drawn over the items in user_id order.
+func shuffled(items []Item, seed int64) []int {
+	byID := make([]int, len(items))
+	for i := range byID {
+		byID[i] = i
+	}
+	sort.SliceStable(byID, func(a, b int) bool { return items[byID[a]].UserID < items[byID[b]].UserID })
+	perm := rand.New(rand.NewSource(seed)).Perm(len(items))
+	out := make([]int, len(items))
+	for k, i := range byID {
+		out[i] = perm[k]
+	}
 	return out
 }
+
+func less(a, b entry) bool {
+	if a.tier != b.tier {
+		return a.tier < b.tier
+	}
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	if a.arrival != b.arrival {
+		return a.arrival < b.arrival
+	}
+	for i := range a.keys {
+		if a.keys[i] != b.keys[i] {
+			return a.keys[i] < b.keys[i]
+		}
+	}
+	if a.prio != b.prio {
+		return a.prio < b.prio
+	}
+	if a.shuffle != b.shuffle {
+		return a.shuffle < b.shuffle
+	}
+	return a.UserID < b.UserID
+}
+
+// percentile is the self-exclusive percentile of sorted position i against
+// a reference of m users starting at position k:
+// 100 * (1 - (i-k) / max(m-1, MinDenominator)).
+// Positions outside the reference clamp to 100 or 0. A one-user reference
+// without a MinDenominator floor gets SingleItemPercentile.
+func (o Options) percentile(i, k, m int) float64 {
+	denom := max(m-1, o.MinDenominator)
+	switch {
+	case i < k:
+		return 100
+	case i >= k+m:
+		return 0
+	case denom > 0:
+		return 100.0 * (1.0 - float64(i-k)/float64(denom))
+	case o.SingleItemPercentile != nil:
+		return *o.SingleItemPercentile
+	default:
+		return 100
+	}
+}
@@ -1,6 +1,7 @@
 package rank
 
 import (
+	"math"
 	"reflect"
 	"testing"
 )
@@ -33,6 +34,21 @@ func TestRankByPercentSingle(t *testing.T) {
 	}
 }
 
+func TestRankSingleItemPercentile(t *testing.T) {
+	fifty := 50.0
+	r, err := Rank([]Item{{UserID: "x", Percent: 50}}, Options{SingleItemPercentile: &fifty})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r[0].Percentile != 50 {
+		t.Errorf("got %v, want 50", r[0].Percentile)
+	}
+	bad := 101.0
+	if _, err := Rank(nil, Options{SingleItemPercentile: &bad}); err == nil {
+		t.Error("expected error for single_item_percentile > 100")
+	}
+}
+
 func TestRankByPercentEmpty(t *testing.T) {
 	r := RankByPercent(nil)
 	if r != nil {
@@ -43,3 +59,555 @@ func TestRankByPercentEmpty(t *testing.T) {
 		t.Fatalf("expected nil: got %v", r)
 	}
 }
+
+func TestRankTrimPercentClampsOutliers(t *testing.T) {
+	items := []Item{
+		{UserID: "low", Percent: 0},
+		{UserID: "a", Percent: 50},
+		{UserID: "b", Percent: 55},
+		{UserID: "c", Percent: 60},
+		{UserID: "d", Percent: 65},
+		{UserID: "e", Percent: 70},
+		{UserID: "high", Percent: 100},
+	}
+	plain, err := Rank(items, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trimmed, err := Rank(items, Options{TrimPercent: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ranks are unaffected by trimming.
+	for i := range plain {
+		if plain[i].UserID != trimmed[i].UserID || plain[i].Rank != trimmed[i].Rank {
+			t.Fatalf("rank changed at %d: %+v vs %+v", i, plain[i], trimmed[i])
+		}
+	}
+
+	// 15% of 7 trims one user per tail; the reference is e..a (5 users).
+	want := map[string][2]float64{
+		"high": {100, 100},
+		"e":    {100 * (1 - 1.0/6), 100},
+		"c":    {50, 50},
+		"a":    {100 * (1 - 5.0/6), 0},
+		"low":  {0, 0},
+	}
+	for i := range plain {
+		w, ok := want[plain[i].UserID]
+		if !ok {
+			continue
+		}
+		if !approx(plain[i].Percentile, w[0]) || !approx(trimmed[i].Percentile, w[1]) {
+			t.Errorf("%s: got %v / %v, want %v / %v",
+				plain[i].UserID, plain[i].Percentile, trimmed[i].Percentile, w[0], w[1])
+		}
+	}
+}
+
+func TestRankTrimPercentInvalid(t *testing.T) {
+	for _, p := range []float64{-1, 50, 80} {
+		if _, err := Rank([]Item{{UserID: "x", Percent: 1}}, Options{TrimPercent: p}); err == nil {
+			t.Errorf("trim_percent %v: expected error", p)
+		}
+	}
+}
+
+func TestRankTierOrderBeatsPercent(t *testing.T) {
+	items := []Item{
+		{UserID: "gold", Percent: 95, Tier: "Gold"},
+		{UserID: "plat", Percent: 60, Tier: "Platinum"},
+		{UserID: "silver", Percent: 99, Tier: "Silver"},
+		{UserID: "gold2", Percent: 80, Tier: "Gold"},
+	}
+	r, err := Rank(items, Options{TierOrder: []string{"Platinum", "Gold", "Silver"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"plat", "gold", "gold2", "silver"}
+	for i, id := range want {
+		if r[i].UserID != id || r[i].Rank != i+1 {
+			t.Errorf("position %d: got %+v, want %s", i, r[i], id)
+		}
+	}
+}
+
+func TestRankUnknownTier(t *testing.T) {
+	items := []Item{
+		{UserID: "mystery", Percent: 100, Tier: "Diamond"},
+		{UserID: "gold", Percent: 10, Tier: "Gold"},
+	}
+	if _, err := Rank(items, Options{TierOrder: []string{"Gold"}}); err == nil {
+		t.Error("default policy: expected error for unknown tier")
+	}
+	r, err := Rank(items, Options{TierOrder: []string{"Gold"}, UnknownTier: UnknownTierLast})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r[0].UserID != "gold" || r[1].UserID != "mystery" {
+		t.Errorf("unknown tier should sort last: got %+v", r)
+	}
+}
+
+func TestRankGraceBandChains(t *testing.T) {
+	items := []Item{
+		{UserID: "a", Percent: 90},
+		{UserID: "b", Percent: 89.5},
+		{UserID: "c", Percent: 88.7},
+		{UserID: "d", Percent: 87.9},
+		{UserID: "e", Percent: 80},
+		{UserID: "f", Percent: 79.5},
+	}
+	r, err := Rank(items, Options{GraceBand: 1.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a..d chain (each within 1.0 of the next) though a and d are 2.1 apart.
+	wantRank := []int{1, 1, 1, 1, 5, 5}
+	plain := RankByPercent(items)
+	for i := range r {
+		if r[i].UserID != plain[i].UserID {
+			t.Errorf("position %d: true order changed: %s vs %s", i, r[i].UserID, plain[i].UserID)
+		}
+		if r[i].Rank != wantRank[i] {
+			t.Errorf("%s: rank %d, want %d", r[i].UserID, r[i].Rank, wantRank[i])
+		}
+		if r[i].Percentile != plain[i].Percentile {
+			t.Errorf("%s: percentile changed: %v vs %v", r[i].UserID, r[i].Percentile, plain[i].Percentile)
+		}
+	}
+}
+
+func TestRankGraceBandInvalid(t *testing.T) {
+	if _, err := Rank([]Item{{UserID: "a"}}, Options{GraceBand: -1}); err == nil {
+		t.Error("expected error for negative grace_band")
+	}
+}
+
+func TestRankNullLastTiePercentile(t *testing.T) {
+	items := []Item{
+		{UserID: "a", Percent: 90},
+		{UserID: "b", Percent: 70},
+		{UserID: "c", Percent: 50},
+		{UserID: "d", Percent: 50},
+	}
+	// Exact tie: ordinal ranks are kept, percentiles withheld.
+	r, err := Rank(items, Options{NullLastTiePercentile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNull := map[string]bool{"c": true, "d": true}
+	for _, res := range r {
+		if res.PercentileNull != wantNull[res.UserID] {
+			t.Errorf("%s: PercentileNull %v", res.UserID, res.PercentileNull)
+		}
+	}
+	if r[2].Rank != 3 || r[3].Rank != 4 {
+		t.Errorf("ranks changed: %+v", r)
+	}
+
+	// With a shared rank for the tie, both keep rank 3.
+	r, err = Rank(items, Options{NullLastTiePercentile: true, GraceBand: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r[2].Rank != 3 || r[3].Rank != 3 || !r[2].PercentileNull || !r[3].PercentileNull {
+		t.Errorf("tied last place: got %+v %+v", r[2], r[3])
+	}
+	if r[1].PercentileNull {
+		t.Errorf("b is not last: %+v", r[1])
+	}
+}
+
+func TestRankNullLastTiePercentileLoneLast(t *testing.T) {
+	r, err := Rank([]Item{{UserID: "a", Percent: 90}, {UserID: "b", Percent: 10}}, Options{NullLastTiePercentile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r[1].PercentileNull {
+		t.Errorf("lone last place should keep percentile: %+v", r[1])
+	}
+}
+
+func TestRankTiePriorityOverridesUserID(t *testing.T) {
+	items := []Item{
+		{UserID: "alice", Percent: 80},
+		{UserID: "bob", Percent: 80},
+		{UserID: "carol", Percent: 80},
+		{UserID: "dave", Percent: 95},
+		{UserID: "erin", Percent: 80},
+	}
+	r, err := Rank(items, Options{TiePriority: []string{"erin", "carol", "ghost", "dave"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// dave is listed but not tied, so the list doesn't move him; listed tied
+	// users come first, then unlisted by user_id; ghost is ignored.
+	want := []string{"dave", "erin", "carol", "alice", "bob"}
+	for i, id := range want {
+		if r[i].UserID != id || r[i].Rank != i+1 {
+			t.Errorf("position %d: got %+v, want %s", i, r[i], id)
+		}
+	}
+}
+
+func TestRankTScore(t *testing.T) {
+	// mean 60, population sd = sqrt((400+0+400+0)/4) = sqrt(200)
+	items := []Item{
+		{UserID: "a", Percent: 40},
+		{UserID: "b", Percent: 60},
+		{UserID: "c", Percent: 80},
+		{UserID: "d", Percent: 60},
+	}
+	r := RankByPercent(items)
+	z := 20 / math.Sqrt(200)
+	want := map[string]float64{"a": 50 - 10*z, "b": 50, "c": 50 + 10*z, "d": 50}
+	for _, res := range r {
+		if !approx(res.TScore, want[res.UserID]) {
+			t.Errorf("%s: T %v, want %v", res.UserID, res.TScore, want[res.UserID])
+		}
+	}
+}
+
+func TestRankTScoreZeroVariance(t *testing.T) {
+	for _, res := range RankByPercent([]Item{{UserID: "a", Percent: 70}, {UserID: "b", Percent: 70}}) {
+		if res.TScore != 50 {
+			t.Errorf("%s: T %v, want 50", res.UserID, res.TScore)
+		}
+	}
+}
+
+func TestRankMinDenominator(t *testing.T) {
+	one := []Item{{UserID: "x", Percent: 50}}
+	two := []Item{{UserID: "x", Percent: 50}, {UserID: "y", Percent: 40}}
+
+	cases := []struct {
+		name  string
+		items []Item
+		floor int
+		want  []float64
+	}{
+		{"n=1 exact", one, 0, []float64{100}},
+		{"n=1 floored", one, 4, []float64{100}},
+		{"n=2 exact", two, 0, []float64{100, 0}},
+		{"n=2 floored", two, 4, []float64{100, 75}},
+		{"n=2 floor below n-1", two, 1, []float64{100, 0}},
+	}
+	for _, c := range cases {
+		r, err := Rank(c.items, Options{MinDenominator: c.floor})
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		for i, w := range c.want {
+			if !approx(r[i].Percentile, w) {
+				t.Errorf("%s: %s percentile %v, want %v", c.name, r[i].UserID, r[i].Percentile, w)
+			}
+		}
+	}
+	if _, err := Rank(one, Options{MinDenominator: -1}); err == nil {
+		t.Error("expected error for negative min_denominator")
+	}
+}
+
+func TestRankTiePrecision(t *testing.T) {
+	items := []Item{
+		{UserID: "a", Percent: 80.01},
+		{UserID: "b", Percent: 80.04},
+		{UserID: "c", Percent: 70},
+	}
+	one, two := 1, 2
+
+	// At 2 decimals b is ahead; at 1 decimal a and b tie and user_id decides.
+	r, err := Rank(items, Options{TiePrecision: &two})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r[0].UserID != "b" {
+		t.Errorf("precision 2: got %s first, want b", r[0].UserID)
+	}
+	r, err = Rank(items, Options{TiePrecision: &one})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r[0].UserID != "a" || r[1].UserID != "b" {
+		t.Errorf("precision 1: got %s, %s, want a, b", r[0].UserID, r[1].UserID)
+	}
+	if r[0].Score != 80 || r[1].Score != 80 {
+		t.Errorf("precision 1: scores %v, %v, want 80", r[0].Score, r[1].Score)
+	}
+
+	bad := 11
+	if _, err := Rank(items, Options{TiePrecision: &bad}); err == nil {
+		t.Error("expected error for tie_precision 11")
+	}
+}
+
+func TestRankTieBreakKeysLexicographic(t *testing.T) {
+	m := func(exam, submitted, attempts float64) map[string]float64 {
+		return map[string]float64{"exam_score": exam, "submitted_at": submitted, "attempts": attempts}
+	}
+	items := []Item{
+		{UserID: "a", Percent: 80, Metrics: m(70, 200, 3)},
+		{UserID: "b", Percent: 80, Metrics: m(70, 200, 1)},
+		{UserID: "c", Percent: 80, Metrics: m(70, 100, 5)},
+		{UserID: "d", Percent: 80, Metrics: m(75, 300, 9)},
+		{UserID: "e", Percent: 80, Metrics: m(70, 200, 1)},
+	}
+	keys := []TieBreakKey{
+		{Metric: "exam_score", Desc: true},
+		{Metric: "submitted_at"},
+		{Metric: "attempts"},
+	}
+	r, err := Rank(items, Options{TieBreak: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// d wins on exam_score; c on submitted_at; a, b, e need attempts, and
+	// b vs e falls through to user_id.
+	want := []string{"d", "c", "b", "e", "a"}
+	for i, id := range want {
+		if r[i].UserID != id {
+			t.Errorf("position %d: got %s, want %s", i, r[i].UserID, id)
+		}
+	}
+}
+
+func TestRankTieBreakMissingMetric(t *testing.T) {
+	items := []Item{
+		{UserID: "a", Percent: 80, Metrics: map[string]float64{"exam_score": 1}},
+		{UserID: "b", Percent: 80},
+	}
+	if _, err := Rank(items, Options{TieBreak: []TieBreakKey{{Metric: "exam_score"}}}); err == nil {
+		t.Error("expected error for item missing a tie_break metric")
+	}
+}
+
+func TestRankPercentileDirectionComplementary(t *testing.T) {
+	items := []Item{
+		{UserID: "a", Percent: 91},
+		{UserID: "b", Percent: 77},
+		{UserID: "c", Percent: 60},
+		{UserID: "d", Percent: 52},
+		{UserID: "e", Percent: 12},
+	}
+	high, err := Rank(items, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	low, err := Rank(items, Options{Direction: TopIsLow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range high {
+		if high[i].UserID != low[i].UserID || high[i].Rank != low[i].Rank {
+			t.Errorf("position %d: rank changed: %+v vs %+v", i, high[i], low[i])
+		}
+		if !approx(high[i].Percentile+low[i].Percentile, 100) {
+			t.Errorf("%s: %v + %v != 100", high[i].UserID, high[i].Percentile, low[i].Percentile)
+		}
+	}
+	if low[0].Percentile != 0 {
+		t.Errorf("top user under top_is_low: %v, want 0", low[0].Percentile)
+	}
+	if _, err := Rank(items, Options{Direction: "sideways"}); err == nil {
+		t.Error("expected error for unknown direction")
+	}
+}
+
+func approx(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
+
+func TestRankMinScoreCutoffInclusivity(t *testing.T) {
+	cut := 50.0
+	items := []Item{
+		{UserID: "a", Percent: 90},
+		{UserID: "b", Percent: 70},
+		{UserID: "c", Percent: 50}, // exactly at the cutoff
+		{UserID: "d", Percent: 30},
+	}
+	for _, c := range []struct {
+		cutoff CutoffInclusivity
+		want   map[string]float64 // absent = withheld
+	}{
+		// c passes: reference a, b, c (denominator 2).
+		{CutoffInclusive, map[string]float64{"a": 100, "b": 50, "c": 0}},
+		// c fails: reference a, b (denominator 1).
+		{CutoffExclusive, map[string]float64{"a": 100, "b": 0}},
+	} {
+		out, err := Rank(items, Options{MinScore: &cut, Cutoff: c.cutoff})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, r := range out {
+			if r.Rank != i+1 {
+				t.Errorf("%s: %s rank %d, want %d", c.cutoff, r.UserID, r.Rank, i+1)
+			}
+			want, ok := c.want[r.UserID]
+			if r.PercentileNull == ok {
+				t.Errorf("%s: %s withheld=%v, want %v", c.cutoff, r.UserID, r.PercentileNull, !ok)
+			} else if ok && !approx(r.Percentile, want) {
+				t.Errorf("%s: %s percentile %v, want %v", c.cutoff, r.UserID, r.Percentile, want)
+			}
+		}
+	}
+	if _, err := Rank(items, Options{MinScore: &cut, Cutoff: ">="}); err == nil {
+		t.Error("expected error for unknown cutoff")
+	}
+}
+
+func TestRankStabilityRange(t *testing.T) {
+	items := []Item{
+		{UserID: "iso", Percent: 95},
+		{UserID: "p1", Percent: 70.8},
+		{UserID: "p2", Percent: 70.5},
+		{UserID: "mid", Percent: 70.2},
+		{UserID: "p3", Percent: 69.9},
+		{UserID: "p4", Percent: 69.4},
+		{UserID: "low", Percent: 40},
+	}
+	out, err := Rank(items, Options{StabilityDelta: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][2]int{}
+	for _, r := range out {
+		got[r.UserID] = [2]int{r.BestRank, r.WorstRank}
+	}
+	// mid could pass or fall behind every packed neighbour within 1 point.
+	if got["mid"] != [2]int{2, 6} {
+		t.Errorf("mid range %v, want [2 6]", got["mid"])
+	}
+	// The isolated leader and tail can't move.
+	if got["iso"] != [2]int{1, 1} || got["low"] != [2]int{7, 7} {
+		t.Errorf("isolated ranges %v %v, want [1 1] [7 7]", got["iso"], got["low"])
+	}
+	if got["p1"] != [2]int{2, 5} {
+		t.Errorf("p1 range %v, want [2 5]", got["p1"])
+	}
+}
+
+func TestRankStabilityWithinTier(t *testing.T) {
+	items := []Item{
+		{UserID: "a", Percent: 50, Tier: "Gold"},
+		{UserID: "b", Percent: 90, Tier: "Silver"},
+		{UserID: "c", Percent: 89, Tier: "Silver"},
+	}
+	out, _ := Rank(items, Options{TierOrder: []string{"Gold", "Silver"}, StabilityDelta: 5})
+	if out[0].BestRank != 1 || out[0].WorstRank != 1 || out[2].BestRank != 2 || out[2].WorstRank != 3 {
+		t.Errorf("got %+v", out)
+	}
+}
+
+func TestRankShuffleSeedResolvesTies(t *testing.T) {
+	items := []Item{
+		{UserID: "a", Percent: 50}, {UserID: "b", Percent: 50}, {UserID: "c", Percent: 50},
+		{UserID: "d", Percent: 50}, {UserID: "e", Percent: 50}, {UserID: "f", Percent: 90},
+	}
+	seed := int64(42)
+	first, err := Rank(items, Options{ShuffleSeed: &seed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := func(out []Result) string {
+		s := ""
+		for _, r := range out {
+			s += r.UserID
+		}
+		return s
+	}
+	got := ids(first)
+	if got[0] != 'f' {
+		t.Errorf("scores must still rank first: %s", got)
+	}
+	// Pinned so a change to the permutation (which would re-order
+	// published rankings) fails loudly.
+	if got != "faecdb" {
+		t.Errorf("seed 42 order %s, want faecdb (not alphabetical fabcde)", got)
+	}
+
+	// Same seed, reversed input: same order.
+	rev := make([]Item, len(items))
+	for i := range items {
+		rev[i] = items[len(items)-1-i]
+	}
+	again, _ := Rank(rev, Options{ShuffleSeed: &seed})
+	if ids(again) != got {
+		t.Errorf("seed %d: %s then %s", seed, got, ids(again))
+	}
+
+	other := int64(7)
+	if o, _ := Rank(items, Options{ShuffleSeed: &other}); ids(o) == got {
+		t.Errorf("seeds 42 and 7 agree on %s", got)
+	}
+	// Explicit tie priority still wins over the shuffle.
+	pinned, _ := Rank(items, Options{ShuffleSeed: &seed, TiePriority: []string{"e"}})
+	if pinned[1].UserID != "e" {
+		t.Errorf("tie_priority ignored: %s", ids(pinned))
+	}
+}
+
+func TestRankTieGroups(t *testing.T) {
+	items := []Item{
+		{UserID: "a", Percent: 90, Tier: "Gold"},
+		{UserID: "b", Percent: 70, Tier: "Gold"},
+		{UserID: "c", Percent: 70, Tier: "Gold"},
+		{UserID: "d", Percent: 70, Tier: "Silver"}, // same score, other tier
+		{UserID: "e", Percent: 69.8, Tier: "Silver"},
+	}
+	out, err := Rank(items, Options{TierOrder: []string{"Gold", "Silver"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{0, 1, 1, 2, 3}
+	for i, r := range out {
+		if r.TieGroup != want[i] {
+			t.Errorf("%s: tie group %d, want %d", r.UserID, r.TieGroup, want[i])
+		}
+	}
+	// A grace band joins d and e.
+	out, _ = Rank(items, Options{TierOrder: []string{"Gold", "Silver"}, GraceBand: 0.5})
+	if out[3].TieGroup != out[4].TieGroup {
+		t.Errorf("grace group split: %+v", out)
+	}
+}
+
+func TestRankTopPercentile(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 90}, {UserID: "b", Percent: 80}, {UserID: "c", Percent: 70}, {UserID: "d", Percent: 60}, {UserID: "e", Percent: 50}}
+	def, _ := Rank(items, Options{})
+	if def[0].Percentile != 100 {
+		t.Errorf("default top percentile %v, want 100", def[0].Percentile)
+	}
+
+	cap := 99.0
+	out, err := Rank(items, Options{TopPercentile: &cap})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []float64{99, 75, 50, 25, 0} {
+		if !approx(out[i].Percentile, want) {
+			t.Errorf("%s: %v, want %v", out[i].UserID, out[i].Percentile, want)
+		}
+	}
+
+	// Capped before the direction flip: the top shows 100 - 99.
+	low, _ := Rank(items, Options{TopPercentile: &cap, Direction: TopIsLow})
+	if !approx(low[0].Percentile, 1) || !approx(low[4].Percentile, 100) {
+		t.Errorf("top_is_low: %v .. %v, want 1 .. 100", low[0].Percentile, low[4].Percentile)
+	}
+
+	// Everyone above the cap is clamped, so order never inverts.
+	tight := 60.0
+	clamped, _ := Rank(items, Options{TopPercentile: &tight})
+	for i, want := range []float64{60, 60, 50, 25, 0} {
+		if !approx(clamped[i].Percentile, want) {
+			t.Errorf("cap 60: %s %v, want %v", clamped[i].UserID, clamped[i].Percentile, want)
+		}
+	}
+	bad := 101.0
+	if _, err := Rank(items, Options{TopPercentile: &bad}); err == nil {
+		t.Error("expected error for top_percentile 101")
+	}
+}
@@ -0,0 +1,50 @@
+package rank
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRankShrinkage(t *testing.T) {
+	item := func(id string, percent, attempts float64) Item {
+		return Item{UserID: id, Percent: percent, Metrics: map[string]float64{"attempts": attempts}}
+	}
+	// The prior is the attempt-weighted mean, 4320/50 = 86.4. a's single
+	// perfect quiz shrinks to (100 + 864) / 11, below b's forty at 92.
+	items := []Item{item("a", 100, 1), item("b", 92, 40), item("c", 60, 9)}
+	out, err := Rank(items, Options{Shrinkage: &Shrinkage{PriorAttempts: 10, AttemptsMetric: "attempts"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := order(out), []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order %v, want %v", got, want)
+	}
+	for i, want := range []float64{4544.0 / 50, 964.0 / 11, 1404.0 / 19} {
+		if math.Abs(out[i].Score-want) > 1e-9 {
+			t.Errorf("%s: shrunk %v, want %v", out[i].UserID, out[i].Score, want)
+		}
+	}
+
+	// A fixed prior, and zero attempts meaning the prior itself.
+	prior := 50.0
+	items = append(items, item("d", 100, 0))
+	out, _ = Rank(items, Options{Shrinkage: &Shrinkage{PriorAttempts: 10, AttemptsMetric: "attempts", Prior: &prior}})
+	if d := out[len(out)-1]; d.UserID != "d" || d.Score != 50 {
+		t.Errorf("last %+v, want d at the prior", d)
+	}
+}
+
+func TestRankShrinkageErrors(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 1, Metrics: map[string]float64{"attempts": -1}}}
+	for _, opts := range []Options{
+		{Shrinkage: &Shrinkage{PriorAttempts: 1, AttemptsMetric: "attempts"}},
+		{Shrinkage: &Shrinkage{PriorAttempts: 1, AttemptsMetric: "missing"}},
+		{Shrinkage: &Shrinkage{AttemptsMetric: "attempts"}},
+		{Shrinkage: &Shrinkage{PriorAttempts: 1, AttemptsMetric: "attempts"}, Transform: TransformLog},
+	} {
+		if _, err := Rank(items, opts); err == nil {
+			t.Errorf("%+v: no error", opts.Shrinkage)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package rank
+
+import "sort"
+
+// applyStability sets each result's BestRank and WorstRank: the ranks the
+// user could reach if their own raw percent moved by up to ±delta while
+// everyone else stayed put. Users in better tiers stay ahead and worse
+// tiers behind; within the user's tier, others strictly above x+delta stay
+// ahead and others strictly below x-delta stay behind, and anyone in
+// between could end up on either side (ties at the band edges are counted
+// as won for BestRank and lost for WorstRank). Each tier's percents are
+// sorted once and every bound is a binary search, O(n log n) overall.
+func applyStability(sorted []entry, out []Result, delta float64) {
+	for start := 0; start < len(sorted); {
+		end := start
+		for end < len(sorted) && sorted[end].tier == sorted[start].tier {
+			end++
+		}
+		xs := make([]float64, end-start) // ascending
+		for i := start; i < end; i++ {
+			xs[i-start] = sorted[i].Percent
+		}
+		sort.Float64s(xs)
+
+		for i := start; i < end; i++ {
+			x := sorted[i].Percent
+			// Others strictly above x+delta; the user isn't among them.
+			above := len(xs) - sort.Search(len(xs), func(j int) bool { return xs[j] > x+delta })
+			// Others strictly below x-delta.
+			below := sort.Search(len(xs), func(j int) bool { return xs[j] >= x-delta })
+			out[i].BestRank = start + above + 1
+			out[i].WorstRank = end - below
+		}
+		start = end
+	}
+}
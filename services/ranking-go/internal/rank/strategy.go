@@ -0,0 +1,64 @@
+package rank
+
+// Strategy decides how tied users are numbered. Ties are tie groups (see
+// Result.TieGroup): equal scores within a tier, or a shared GraceBand
+// group. Tie-break options still order users within a group.
+type Strategy string
+
+const (
+	// StrategyOrdinal gives everyone a distinct rank in sort order (1234).
+	StrategyOrdinal Strategy = "ordinal"
+	// StrategyDense gives a tie group one rank and the next group the next
+	// integer (1223).
+	StrategyDense Strategy = "dense"
+	// StrategyCompetition gives a tie group its first member's position,
+	// so the next group skips past the tie (1224).
+	StrategyCompetition Strategy = "competition"
+	// StrategyFractional gives a tie group the mean of the positions it
+	// spans in Result.FractionalRank (1, 2.5, 2.5, 4), as Spearman's rank
+	// correlation expects; Rank is then the competition rank.
+	StrategyFractional Strategy = "fractional"
+)
+
+func (s Strategy) valid() bool {
+	switch s {
+	case "", StrategyOrdinal, StrategyDense, StrategyCompetition, StrategyFractional:
+		return true
+	}
+	return false
+}
+
+// applyStrategy renumbers out, whose TieGroups are set, under s.
+func applyStrategy(out []Result, s Strategy) {
+	switch s {
+	case StrategyDense:
+		for i := range out {
+			out[i].Rank = out[i].TieGroup + 1
+		}
+	case StrategyCompetition, StrategyFractional:
+		for start := 0; start < len(out); {
+			end := start + 1
+			for end < len(out) && out[end].TieGroup == out[start].TieGroup {
+				end++
+			}
+			// Positions start+1..end average to (start+1+end)/2.
+			mean := float64(start+1+end) / 2
+			for i := start; i < end; i++ {
+				out[i].Rank = start + 1
+				if s == StrategyFractional {
+					out[i].FractionalRank = mean
+				}
+			}
+			start = end
+		}
+	}
+}
+
+// CompetitionRank is RankByPercent with standard competition ranking:
+// users with equal percents share a rank and the next user's rank counts
+// everyone above them, so two users tied at the top are both 1 and the
+// next is 3.
+func CompetitionRank(items []Item) []Result {
+	out, _ := Rank(items, Options{Strategy: StrategyCompetition})
+	return out
+}
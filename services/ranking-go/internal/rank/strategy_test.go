@@ -0,0 +1,99 @@
+package rank
+
+import "testing"
+
+func TestRankDenseStrategy(t *testing.T) {
+	items := []Item{{UserID: "d", Percent: 70}, {UserID: "a", Percent: 90}, {UserID: "c", Percent: 80}, {UserID: "b", Percent: 80}, {UserID: "e", Percent: 70}, {UserID: "f", Percent: 60}}
+	out, err := Rank(items, Options{Strategy: StrategyDense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		id   string
+		rank int
+	}{{"a", 1}, {"b", 2}, {"c", 2}, {"d", 3}, {"e", 3}, {"f", 4}}
+	for i, w := range want {
+		if out[i].UserID != w.id || out[i].Rank != w.rank {
+			t.Errorf("%d: %s rank %d, want %s rank %d", i, out[i].UserID, out[i].Rank, w.id, w.rank)
+		}
+	}
+	// Percentiles are unchanged from ordinal ranking.
+	ord := RankByPercent(items)
+	for i := range out {
+		if out[i].Percentile != ord[i].Percentile {
+			t.Errorf("%s: percentile %v, ordinal %v", out[i].UserID, out[i].Percentile, ord[i].Percentile)
+		}
+	}
+}
+
+func TestRankDenseStrategyTiePrecisionAndGrace(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 80.04}, {UserID: "b", Percent: 80.01}, {UserID: "c", Percent: 79}, {UserID: "d", Percent: 78.5}, {UserID: "e", Percent: 50}}
+	prec := 1
+	out, _ := Rank(items, Options{Strategy: StrategyDense, TiePrecision: &prec, GraceBand: 0.5})
+	for i, want := range []int{1, 1, 2, 2, 3} {
+		if out[i].Rank != want {
+			t.Errorf("%s: rank %d, want %d", out[i].UserID, out[i].Rank, want)
+		}
+	}
+}
+
+func TestRankStrategyValidation(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 1}, {UserID: "b", Percent: 2}}
+	if _, err := Rank(items, Options{Strategy: "olympic"}); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+	if _, err := Rank(items, Options{Strategy: StrategyDense, Pins: map[string]int{"a": 1}}); err == nil {
+		t.Error("expected error for pins with dense strategy")
+	}
+	if _, err := Rank(items, Options{Strategy: StrategyOrdinal, Pins: map[string]int{"a": 1}}); err != nil {
+		t.Errorf("pins with ordinal strategy: %v", err)
+	}
+}
+
+func TestCompetitionRank(t *testing.T) {
+	items := []Item{{UserID: "c", Percent: 80}, {UserID: "b", Percent: 95}, {UserID: "a", Percent: 95}, {UserID: "d", Percent: 70}, {UserID: "e", Percent: 70}, {UserID: "f", Percent: 60}}
+	out := CompetitionRank(items)
+	want := []struct {
+		id   string
+		rank int
+	}{{"a", 1}, {"b", 1}, {"c", 3}, {"d", 4}, {"e", 4}, {"f", 6}}
+	for i, w := range want {
+		if out[i].UserID != w.id || out[i].Rank != w.rank {
+			t.Errorf("%d: %s rank %d, want %s rank %d", i, out[i].UserID, out[i].Rank, w.id, w.rank)
+		}
+	}
+	same, err := Rank(items, Options{Strategy: StrategyCompetition})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range out {
+		if same[i] != out[i] {
+			t.Errorf("%d: Rank with StrategyCompetition %+v, CompetitionRank %+v", i, same[i], out[i])
+		}
+	}
+}
+
+func TestRankFractionalStrategy(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 90}, {UserID: "b", Percent: 80}, {UserID: "c", Percent: 80}, {UserID: "d", Percent: 70}, {UserID: "e", Percent: 70}, {UserID: "f", Percent: 70}}
+	out, err := Rank(items, Options{Strategy: StrategyFractional})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := 0.0
+	for i, want := range []struct {
+		rank int
+		frac float64
+	}{{1, 1}, {2, 2.5}, {2, 2.5}, {4, 5}, {4, 5}, {4, 5}} {
+		if out[i].Rank != want.rank || out[i].FractionalRank != want.frac {
+			t.Errorf("%s: rank %d fractional %v, want %d %v", out[i].UserID, out[i].Rank, out[i].FractionalRank, want.rank, want.frac)
+		}
+		sum += out[i].FractionalRank
+	}
+	// Fractional ranks always sum to n(n+1)/2, as Spearman's rho assumes.
+	if sum != 21 {
+		t.Errorf("fractional ranks sum to %v, want 21", sum)
+	}
+	if ord := RankByPercent(items); ord[0].FractionalRank != 0 {
+		t.Errorf("ordinal FractionalRank %v, want 0", ord[0].FractionalRank)
+	}
+}
@@ -0,0 +1,165 @@
+package rank
+
+import (
+	"math"
+	"sort"
+)
+
+// Summary describes the distribution of a cohort's raw percents.
+type Summary struct {
+	Count    int
+	Mean     float64
+	SD       float64 // population
+	Min, Max float64
+	Median   float64
+	// Modes are the approximate locations of the distribution's modes,
+	// ascending; see DetectModes.
+	Modes []float64
+}
+
+// SummaryOf summarizes the raw percents of results. Empty results give the
+// zero Summary.
+func SummaryOf(results []Result) Summary {
+	n := len(results)
+	if n == 0 {
+		return Summary{}
+	}
+	xs := make([]float64, n)
+	for i, r := range results {
+		xs[i] = r.Percent
+	}
+	sort.Float64s(xs)
+	s := Summary{Count: n, Min: xs[0], Max: xs[n-1]}
+	if n%2 == 1 {
+		s.Median = xs[n/2]
+	} else {
+		s.Median = (xs[n/2-1] + xs[n/2]) / 2
+	}
+	for _, x := range xs {
+		s.Mean += x
+	}
+	s.Mean /= float64(n)
+	var ss float64
+	for _, x := range xs {
+		ss += (x - s.Mean) * (x - s.Mean)
+	}
+	s.SD = math.Sqrt(ss / float64(n))
+	s.Modes = DetectModes(xs, s.SD)
+	return s
+}
+
+// Mode detection tuning.
+const (
+	modeGrid     = 256 // density evaluation points
+	modeMinPeak  = 0.1 // a peak must reach this fraction of the highest
+	modeMaxDip   = 0.8 // valley / lower peak must be below this to separate
+	modeMinItems = 3   // smaller samples are reported as one mode
+)
+
+// DetectModes is a heuristic mode finder over sorted values xs with
+// population SD sd. It smooths xs with a Gaussian kernel density estimate
+// (Silverman's rule-of-thumb bandwidth, 0.9 * min(sd, IQR/1.34) * n^-1/5),
+// evaluated on a 256-point grid spanning the data plus three bandwidths, and
+// takes its local maxima. Peaks below 10% of the tallest are noise. Two
+// neighbouring peaks count as separate modes only if the density between
+// them dips below 80% of the lower peak; otherwise the taller one stands for
+// both. Silverman's bandwidth oversmooths, so close or small modes merge
+// rather than spurious ones appearing: a reported split is a real gap, but
+// a single mode does not prove unimodality. Locations are grid points, so
+// they are accurate to about (range + 6h) / 256.
+func DetectModes(xs []float64, sd float64) []float64 {
+	n := len(xs)
+	if n == 0 {
+		return nil
+	}
+	if n < modeMinItems || sd == 0 {
+		return []float64{xs[n/2]}
+	}
+	spread := sd
+	if iqr := (quantileSorted(xs, 0.75) - quantileSorted(xs, 0.25)) / 1.34; iqr > 0 && iqr < spread {
+		spread = iqr
+	}
+	h := 0.9 * spread * math.Pow(float64(n), -0.2)
+
+	lo, hi := xs[0]-3*h, xs[n-1]+3*h
+	step := (hi - lo) / (modeGrid - 1)
+	d := make([]float64, modeGrid)
+	var top float64
+	for i := range d {
+		g := lo + float64(i)*step
+		for _, x := range xs {
+			z := (g - x) / h
+			d[i] += math.Exp(-0.5 * z * z)
+		}
+		top = math.Max(top, d[i])
+	}
+
+	var peaks []int
+	for i := 1; i < modeGrid-1; i++ {
+		if d[i] > d[i-1] && d[i] >= d[i+1] && d[i] >= modeMinPeak*top {
+			peaks = append(peaks, i)
+		}
+	}
+	var kept []int
+	for _, p := range peaks {
+		if len(kept) == 0 {
+			kept = append(kept, p)
+			continue
+		}
+		last := kept[len(kept)-1]
+		valley := d[last]
+		for i := last; i <= p; i++ {
+			valley = math.Min(valley, d[i])
+		}
+		if valley < modeMaxDip*math.Min(d[last], d[p]) {
+			kept = append(kept, p)
+		} else if d[p] > d[last] {
+			kept[len(kept)-1] = p
+		}
+	}
+
+	out := make([]float64, len(kept))
+	for i, p := range kept {
+		out[i] = lo + float64(p)*step
+	}
+	return out
+}
+
+// quantileSorted is the linearly interpolated q-quantile of sorted xs.
+func quantileSorted(xs []float64, q float64) float64 {
+	pos := q * float64(len(xs)-1)
+	i := int(pos)
+	if i+1 >= len(xs) {
+		return xs[len(xs)-1]
+	}
+	return xs[i] + (pos-float64(i))*(xs[i+1]-xs[i])
+}
+
+// Histogram counts the raw percents of results in the bins between
+// consecutive edges, which must be increasing: bin i is [edges[i],
+// edges[i+1]), and the last bin also includes its upper edge. Percents
+// outside the edges are not counted.
+func Histogram(results []Result, edges []float64) []int {
+	if len(edges) < 2 {
+		return nil
+	}
+	counts := make([]int, len(edges)-1)
+	last := len(edges) - 1
+	for _, r := range results {
+		x := r.Percent
+		if x < edges[0] || x > edges[last] {
+			continue
+		}
+		i := sort.SearchFloat64s(edges, x)
+		// SearchFloat64s finds the first edge >= x; x in [edges[i-1],
+		// edges[i]) belongs to bin i-1 unless it sits on edge i.
+		if i < last && edges[i] == x {
+			i++
+		}
+		if i == 0 {
+			i = 1
+		}
+		counts[i-1]++
+	}
+	return counts
+}
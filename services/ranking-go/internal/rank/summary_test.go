@@ -0,0 +1,66 @@
+package rank
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func synthetic(seed int64, centers ...float64) []Item {
+	rng := rand.New(rand.NewSource(seed))
+	var items []Item
+	for c, mu := range centers {
+		for i := 0; i < 150; i++ {
+			items = append(items, Item{UserID: fmt.Sprintf("c%d-%d", c, i), Percent: mu + 5*rng.NormFloat64()})
+		}
+	}
+	return items
+}
+
+func TestDetectModesUnimodal(t *testing.T) {
+	s := SummaryOf(RankByPercent(synthetic(1, 60)))
+	if len(s.Modes) != 1 {
+		t.Fatalf("modes %v, want 1", s.Modes)
+	}
+	if math.Abs(s.Modes[0]-60) > 3 {
+		t.Errorf("mode at %v, want near 60", s.Modes[0])
+	}
+}
+
+func TestDetectModesBimodal(t *testing.T) {
+	s := SummaryOf(RankByPercent(synthetic(2, 30, 80)))
+	if len(s.Modes) != 2 {
+		t.Fatalf("modes %v, want 2", s.Modes)
+	}
+	if math.Abs(s.Modes[0]-30) > 3 || math.Abs(s.Modes[1]-80) > 3 {
+		t.Errorf("modes at %v, want near 30 and 80", s.Modes)
+	}
+}
+
+func TestSummaryOf(t *testing.T) {
+	s := SummaryOf(RankByPercent([]Item{{UserID: "a", Percent: 10}, {UserID: "b", Percent: 30}, {UserID: "c", Percent: 20}, {UserID: "d", Percent: 40}}))
+	if s.Count != 4 || s.Min != 10 || s.Max != 40 || s.Median != 25 || s.Mean != 25 || !approx(s.SD, math.Sqrt(125)) {
+		t.Errorf("got %+v", s)
+	}
+	if s := SummaryOf(RankByPercent([]Item{{UserID: "a", Percent: 5}, {UserID: "b", Percent: 5}, {UserID: "c", Percent: 5}})); len(s.Modes) != 1 || s.Modes[0] != 5 {
+		t.Errorf("constant cohort modes %v, want [5]", s.Modes)
+	}
+	if s := SummaryOf(nil); s.Count != 0 || s.Modes != nil {
+		t.Errorf("empty: %+v", s)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	results := RankByPercent([]Item{
+		{UserID: "a", Percent: 0}, {UserID: "b", Percent: 49.9}, {UserID: "c", Percent: 50},
+		{UserID: "d", Percent: 100}, {UserID: "e", Percent: 120}, {UserID: "f", Percent: 75},
+	})
+	got := Histogram(results, []float64{0, 50, 100})
+	if len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("got %v, want [2 3]", got)
+	}
+	if Histogram(results, []float64{0}) != nil {
+		t.Error("one edge: want nil")
+	}
+}
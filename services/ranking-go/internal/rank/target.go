@@ -0,0 +1,185 @@
+package rank
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrUnknownUser is returned for a user ID that is not in the cohort.
+var ErrUnknownUser = errors.New("user not in cohort")
+
+// Requirement is what a user needs to reach a target rank.
+type Requirement struct {
+	CurrentRank    int
+	CurrentPercent float64
+	// Reached: the user already has TargetRank or better.
+	Reached bool
+	// Reachable: some percent up to the maximum reaches the target.
+	// MinPercent is then the least such percent; Exclusive means the user
+	// needs strictly more than MinPercent (they would lose the tie at it).
+	Reachable  bool
+	MinPercent float64
+	Exclusive  bool
+	// BestRank is the rank the user would have at the maximum percent.
+	BestRank int
+}
+
+// threshold is a candidate answer: percent itself, or anything above it.
+type threshold struct {
+	percent   float64
+	exclusive bool
+}
+
+func (c threshold) value() float64 {
+	if c.exclusive {
+		return math.Nextafter(c.percent, math.Inf(1))
+	}
+	return c.percent
+}
+
+// RequiredPercent finds the least percent userID would need, everyone else
+// unchanged, to be ranked target or better under opts, scoring at most
+// maxPercent. The user's rank can only change where their percent meets or
+// passes another user's (tie-break rules decide the tie), or, under
+// GraceBand, comes within the band of one; RequiredPercent collects those
+// points and binary searches them, re-ranking the cohort O(log n) times.
+// Rank is non-increasing in the user's own percent for every option, which
+// is what makes the search valid. With TiePrecision, ties also start at the
+// rounding boundary below each percent; that boundary is exact for raw
+// percents but not under a Transform, where the answer can then be
+// slightly above the true minimum. Composite, decayed, shrunk and Wilson
+// scores mix in other inputs, so those cohorts are refused.
+func RequiredPercent(items []Item, opts Options, userID string, target int, maxPercent float64) (Requirement, error) {
+	if target < 1 || target > len(items) {
+		return Requirement{}, fmt.Errorf("target_rank must be in [1, %d], got %d", len(items), target)
+	}
+	// The candidate thresholds are other users' percents, which only mark
+	// rank changes when the score is a monotone function of percent alone.
+	if len(opts.Composite) > 0 || opts.Decay != nil || opts.Shrinkage != nil || opts.Scoring != ScoringPercent {
+		return Requirement{}, errors.New("cannot compute a required percent in a cohort ranked by weights, decay, shrinkage or scoring")
+	}
+	opts.TopK = 0 // the user may rank below it
+	idx := -1
+	for i, it := range items {
+		if it.UserID == userID {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return Requirement{}, ErrUnknownUser
+	}
+	work := append([]Item(nil), items...)
+	rankAt := func(p float64) (int, error) {
+		work[idx].Percent = p
+		out, err := Rank(work, opts)
+		if err != nil {
+			return 0, err
+		}
+		for _, r := range out {
+			if r.UserID == userID {
+				return r.Rank, nil
+			}
+		}
+		return 0, ErrUnknownUser
+	}
+
+	cur := items[idx].Percent
+	req := Requirement{CurrentPercent: cur}
+	var err error
+	if req.CurrentRank, err = rankAt(cur); err != nil {
+		return Requirement{}, err
+	}
+	if req.CurrentRank <= target {
+		req.Reached, req.Reachable, req.MinPercent, req.BestRank = true, true, cur, req.CurrentRank
+		return req, nil
+	}
+	if maxPercent < cur {
+		maxPercent = cur
+	}
+	if req.BestRank, err = rankAt(maxPercent); err != nil {
+		return Requirement{}, err
+	}
+	if req.BestRank > target {
+		return req, nil
+	}
+
+	cands := []threshold{{percent: maxPercent}}
+	add := func(c threshold) {
+		if v := c.value(); v > cur && v <= maxPercent {
+			cands = append(cands, c)
+		}
+	}
+	for i, it := range items {
+		if i == idx {
+			continue
+		}
+		add(threshold{percent: it.Percent})
+		add(threshold{percent: it.Percent, exclusive: true})
+		if opts.GraceBand > 0 {
+			add(threshold{percent: it.Percent - opts.GraceBand})
+		}
+		if opts.TiePrecision != nil {
+			half := 0.5 / math.Pow10(*opts.TiePrecision)
+			add(threshold{percent: roundTo(it.Percent, *opts.TiePrecision) - half})
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].value() < cands[j].value() })
+
+	var searchErr error
+	i := sort.Search(len(cands), func(i int) bool {
+		r, err := rankAt(cands[i].value())
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return r <= target
+	})
+	if searchErr != nil {
+		return Requirement{}, searchErr
+	}
+	req.Reachable = true
+	req.MinPercent, req.Exclusive = cands[i].percent, cands[i].exclusive
+	return req, nil
+}
+
+// Place ranks a hypothetical user scoring percent against the cohort, as if
+// they had joined it with everyone else unchanged, and returns their
+// result. The newcomer has no user_id, tier, metrics or arrival, so it
+// wins ties that fall through to user_id, and cohorts ranked by tier,
+// arrival, tie-break metrics, Borda points, composite weights, decay,
+// shrinkage or Wilson scoring can't place it.
+func Place(items []Item, opts Options, percent float64) (Result, error) {
+	switch {
+	case len(opts.TierOrder) > 0:
+		return Result{}, errors.New("cannot place a bare score in a cohort ranked by tier_order")
+	case opts.ArrivalTieBreak:
+		return Result{}, errors.New("cannot place a bare score in a cohort ranked with arrival_tie_break")
+	case len(opts.TieBreak) > 0:
+		return Result{}, errors.New("cannot place a bare score in a cohort ranked with tie_break")
+	case len(opts.Borda) > 0:
+		return Result{}, errors.New("cannot place a bare score in a cohort ranked by borda")
+	case len(opts.Composite) > 0:
+		return Result{}, errors.New("cannot place a bare score in a cohort ranked by weights")
+	case opts.Decay != nil:
+		return Result{}, errors.New("cannot place a bare score in a cohort ranked with decay")
+	case opts.Shrinkage != nil:
+		return Result{}, errors.New("cannot place a bare score in a cohort ranked with shrinkage")
+	case opts.Scoring != ScoringPercent:
+		return Result{}, fmt.Errorf("cannot place a bare score in a cohort ranked by %s scoring", opts.Scoring)
+	}
+	opts.TopK = 0 // the score may place below it
+	work := append(items[:len(items):len(items)], Item{Percent: percent})
+	out, err := Rank(work, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	for _, r := range out {
+		if r.UserID == "" {
+			return r, nil
+		}
+	}
+	return Result{}, ErrUnknownUser
+}
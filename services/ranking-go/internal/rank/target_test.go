@@ -0,0 +1,90 @@
+package rank
+
+import (
+	"errors"
+	"testing"
+)
+
+var targetCohort = []Item{
+	{UserID: "a", Percent: 92},
+	{UserID: "b", Percent: 85},
+	{UserID: "c", Percent: 80},
+	{UserID: "d", Percent: 71},
+	{UserID: "e", Percent: 60},
+}
+
+func TestRequiredPercentWinsTieByUserID(t *testing.T) {
+	// "d" sorts after "c" on user_id, so matching 80 isn't enough.
+	req, err := RequiredPercent(targetCohort, Options{}, "d", 3, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !req.Reachable || req.Reached || req.MinPercent != 80 || !req.Exclusive || req.CurrentRank != 4 {
+		t.Errorf("got %+v, want > 80", req)
+	}
+	// Likewise "e" loses a tie with "d" at 71.
+	req, _ = RequiredPercent(targetCohort, Options{}, "e", 4, 100)
+	if req.MinPercent != 71 || !req.Exclusive {
+		t.Errorf("e: got %+v, want > 71", req)
+	}
+}
+
+func TestRequiredPercentTiePriority(t *testing.T) {
+	req, err := RequiredPercent(targetCohort, Options{TiePriority: []string{"d"}}, "d", 3, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.MinPercent != 80 || req.Exclusive {
+		t.Errorf("got %+v, want >= 80", req)
+	}
+}
+
+func TestRequiredPercentUnreachableAndReached(t *testing.T) {
+	req, err := RequiredPercent(targetCohort, Options{}, "e", 1, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Reachable || req.BestRank != 2 {
+		t.Errorf("capped at 90: got %+v", req)
+	}
+	req, _ = RequiredPercent(targetCohort, Options{}, "b", 3, 100)
+	if !req.Reached || req.CurrentRank != 2 {
+		t.Errorf("already there: got %+v", req)
+	}
+	if _, err := RequiredPercent(targetCohort, Options{}, "zz", 1, 100); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("unknown user: %v", err)
+	}
+	if _, err := RequiredPercent(targetCohort, Options{}, "a", 6, 100); err == nil {
+		t.Error("expected error for target past the cohort")
+	}
+}
+
+func TestRequiredPercentTiePrecision(t *testing.T) {
+	// At 1 decimal, 79.95 rounds to 80.0 and ties "c"; "b" wins that tie.
+	items := []Item{{UserID: "c", Percent: 80.02}, {UserID: "b", Percent: 50}}
+	p := 1
+	req, _ := RequiredPercent(items, Options{TiePrecision: &p}, "b", 1, 100)
+	if !approx(req.MinPercent, 79.95) || req.Exclusive {
+		t.Errorf("got %+v, want >= 79.95", req)
+	}
+}
+
+func TestPlace(t *testing.T) {
+	// Joining at 80 ties c and wins the tie: rank 3 of 6.
+	r, err := Place(targetCohort, Options{}, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Rank != 3 || r.Percentile != 60 {
+		t.Errorf("80: got rank %d, percentile %v", r.Rank, r.Percentile)
+	}
+	if r, _ := Place(targetCohort, Options{}, 100); r.Rank != 1 || r.Percentile != 100 {
+		t.Errorf("100: got rank %d, percentile %v", r.Rank, r.Percentile)
+	}
+	if r, _ := Place(targetCohort, Options{}, 0); r.Rank != 6 || r.Percentile != 0 {
+		t.Errorf("0: got rank %d, percentile %v", r.Rank, r.Percentile)
+	}
+	if _, err := Place(targetCohort, Options{TieBreak: []TieBreakKey{{Metric: "x"}}}, 50); err == nil {
+		t.Error("expected error under tie_break")
+	}
+}
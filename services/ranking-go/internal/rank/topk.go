@@ -0,0 +1,62 @@
+package rank
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+// selectTop returns the k best of n entries in sorted order, in
+// O(n log k) time and O(k) entries of memory: a heap keeps the k best so
+// far with the worst of them on top, to be replaced by any better entry.
+// less is total, so the result is the first k of the full sort.
+func selectTop(n, k int, build func(int) (entry, error)) ([]entry, error) {
+	h := make(worstHeap, 0, k)
+	for i := 0; i < n; i++ {
+		e, err := build(i)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(h) < k:
+			heap.Push(&h, e)
+		case less(e, h[0]):
+			h[0] = e
+			heap.Fix(&h, 0)
+		}
+	}
+	sorted := []entry(h)
+	sort.Slice(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+	return sorted, nil
+}
+
+// validateTopK rejects options that need the users below the top k.
+func (o Options) validateTopK() error {
+	if o.TopK < 0 {
+		return fmt.Errorf("top_k must be >= 0, got %d", o.TopK)
+	}
+	if o.TopK == 0 {
+		return nil
+	}
+	custom := o.Method != "" && o.Method != MethodSelfExclusive
+	if len(o.Pins) > 0 || o.Weighted || custom || o.GraceBand > 0 || o.StabilityDelta > 0 || o.NullLastTiePercentile || o.Strategy == StrategyFractional {
+		return fmt.Errorf("top_k cannot be combined with pins, weighted, percentile_method, grace_band, stability_delta, null_last_tie_percentile or the fractional strategy")
+	}
+	return nil
+}
+
+// worstHeap is a heap of entries with the worst on top.
+type worstHeap []entry
+
+func (h worstHeap) Len() int           { return len(h) }
+func (h worstHeap) Less(i, j int) bool { return less(h[j], h[i]) }
+func (h worstHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *worstHeap) Push(x any)        { *h = append(*h, x.(entry)) }
+func (h *worstHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
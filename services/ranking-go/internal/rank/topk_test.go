@@ -0,0 +1,55 @@
+package rank
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTopKMatchesFullRanking(t *testing.T) {
+	items := make([]Item, 103)
+	for i := range items {
+		items[i] = Item{
+			UserID:  fmt.Sprintf("u%03d", (i*37)%103),
+			Percent: float64((i * 7) % 11), // plenty of ties
+			Tier:    []string{"Gold", "Silver", "Bronze"}[i%3],
+			Metrics: map[string]float64{"time": float64(i % 5)},
+		}
+	}
+	cut := 50.0
+	for name, opts := range map[string]Options{
+		"plain":     {},
+		"tiers":     {TierOrder: []string{"Gold", "Silver"}, UnknownTier: UnknownTierLast},
+		"tie_break": {TieBreak: []TieBreakKey{{Metric: "time"}}, TiePriority: []string{"u050", "u007"}},
+		"dense":     {Strategy: StrategyDense, TrimPercent: 10},
+		"cutoff":    {MinScore: &cut, Strategy: StrategyCompetition, Quantile: QuantileDecile},
+	} {
+		want, err := Rank(items, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, k := range []int{1, 10, 103, 500} {
+			opts.TopK = k
+			got, err := Rank(items, opts)
+			if err != nil {
+				t.Fatalf("%s top %d: %v", name, k, err)
+			}
+			if n := min(k, len(items)); !reflect.DeepEqual(got, want[:n]) {
+				t.Errorf("%s top %d: differs from the full ranking's first %d", name, k, n)
+			}
+		}
+	}
+}
+
+func TestTopKValidate(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"negative":   {TopK: -1},
+		"pins":       {TopK: 5, Pins: map[string]int{"a": 1}},
+		"fractional": {TopK: 5, Strategy: StrategyFractional},
+		"method":     {TopK: 5, Method: MethodMidpoint},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package rank
+
+import (
+	"fmt"
+	"math"
+)
+
+// Transform maps raw percents onto the score used for ranking.
+type Transform string
+
+const (
+	TransformNone   Transform = ""
+	TransformZScore Transform = "zscore" // (x-mean)/sd, population sd; 0 if sd is 0
+	TransformLog    Transform = "log"    // ln(1+x)
+	TransformMinMax Transform = "minmax" // (x-min)/(max-min) in [0,1]; 0 if max==min
+)
+
+func (t Transform) valid() bool {
+	switch t {
+	case TransformNone, TransformZScore, TransformLog, TransformMinMax:
+		return true
+	}
+	return false
+}
+
+// transformScores returns the ranking score of each item under t.
+func transformScores(items []Item, t Transform) ([]float64, error) {
+	out := make([]float64, len(items))
+	switch t {
+	case TransformNone:
+		for i, it := range items {
+			out[i] = it.Percent
+		}
+	case TransformLog:
+		for i, it := range items {
+			if it.Percent <= -1 {
+				return nil, fmt.Errorf("user %q: percent %v out of range for log transform", it.UserID, it.Percent)
+			}
+			out[i] = math.Log1p(it.Percent)
+		}
+	case TransformZScore:
+		mean, sd := meanStdDev(items)
+		for i, it := range items {
+			if sd > 0 {
+				out[i] = (it.Percent - mean) / sd
+			}
+		}
+	case TransformMinMax:
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, it := range items {
+			lo = math.Min(lo, it.Percent)
+			hi = math.Max(hi, it.Percent)
+		}
+		for i, it := range items {
+			if hi > lo {
+				out[i] = (it.Percent - lo) / (hi - lo)
+			}
+		}
+	}
+	return out, nil
+}
+
+// meanStdDev returns the mean and population standard deviation of percents.
+func meanStdDev(items []Item) (mean, sd float64) {
+	n := float64(len(items))
+	if n == 0 {
+		return 0, 0
+	}
+	for _, it := range items {
+		mean += it.Percent
+	}
+	mean /= n
+	var ss float64
+	for _, it := range items {
+		d := it.Percent - mean
+		ss += d * d
+	}
+	return mean, math.Sqrt(ss / n)
+}
@@ -0,0 +1,47 @@
+package rank
+
+import "testing"
+
+func TestTransformKeepsOrder(t *testing.T) {
+	items := []Item{
+		{UserID: "a", Percent: 0},
+		{UserID: "b", Percent: 50},
+		{UserID: "c", Percent: 100},
+	}
+	for _, tr := range []Transform{TransformZScore, TransformLog, TransformMinMax} {
+		r, err := Rank(items, Options{Transform: tr})
+		if err != nil {
+			t.Fatalf("%s: %v", tr, err)
+		}
+		if r[0].UserID != "c" || r[2].UserID != "a" {
+			t.Errorf("%s: order changed: %+v", tr, r)
+		}
+		if r[0].Percent != 100 {
+			t.Errorf("%s: raw percent lost: %+v", tr, r[0])
+		}
+	}
+}
+
+func TestTransformDegenerateCohort(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 70}, {UserID: "b", Percent: 70}}
+	for _, tr := range []Transform{TransformZScore, TransformMinMax} {
+		r, err := Rank(items, Options{Transform: tr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, res := range r {
+			if res.Score != 0 {
+				t.Errorf("%s: zero-spread cohort should score 0, got %+v", tr, res)
+			}
+		}
+	}
+}
+
+func TestTransformInvalid(t *testing.T) {
+	if _, err := Rank([]Item{{UserID: "a"}}, Options{Transform: "sqrt"}); err == nil {
+		t.Error("expected error for unknown transform")
+	}
+	if _, err := Rank([]Item{{UserID: "a", Percent: -5}}, Options{Transform: TransformLog}); err == nil {
+		t.Error("expected error for log of percent <= -1")
+	}
+}
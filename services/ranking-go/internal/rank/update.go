@@ -0,0 +1,118 @@
+package rank
+
+import (
+	"math"
+	"slices"
+)
+
+// Score is one user's new percent, as UpdateScores applies it.
+type Score struct {
+	UserID  string
+	Percent float64
+	// Submitted, if not 0, replaces the item's Submitted.
+	Submitted int64
+}
+
+// UpdateScore sets one user's percent in a ranked cohort, adding the user
+// if they are new; it is UpdateScores with one score.
+func UpdateScore(items []Item, results []Result, opts Options, userID string, percent float64) ([]Item, []Result, error) {
+	return UpdateScores(items, results, opts, []Score{{UserID: userID, Percent: percent}})
+}
+
+// UpdateScores sets users' percents in a ranked cohort, in order, adding
+// users who are new, and returns the updated items and results. results
+// must be Rank(items, opts). The outcome is always exactly
+// Rank(newItems, opts).
+//
+// Under incremental options (see Options.Incremental) nothing is sorted:
+// results are loaded into a Board, each score moves one user in
+// O(log n), and the new results are read back off the board in one pass.
+// Other options re-rank the whole cohort, once.
+func UpdateScores(items []Item, results []Result, opts Options, scores []Score) ([]Item, []Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+	newItems := slices.Clone(items)
+	index := make(map[string]int, len(items))
+	for i, it := range newItems {
+		index[it.UserID] = i
+	}
+	for _, sc := range scores {
+		if i, ok := index[sc.UserID]; ok {
+			newItems[i].Percent = sc.Percent
+			if sc.Submitted != 0 {
+				newItems[i].Submitted = sc.Submitted
+			}
+			continue
+		}
+		index[sc.UserID] = len(newItems)
+		newItems = append(newItems, Item{UserID: sc.UserID, Percent: sc.Percent, Submitted: sc.Submitted})
+	}
+	if !opts.Incremental() || len(results) != len(items) {
+		out, err := Rank(newItems, opts)
+		return newItems, out, err
+	}
+
+	b := NewBoard(results)
+	for _, sc := range scores {
+		b.Set(sc.UserID, sc.Percent)
+	}
+	// The board's running moments are close, but a fresh pass over the
+	// items matches Rank to the last bit.
+	mean, sd := meanStdDev(newItems)
+	n := b.Len()
+	out := make([]Result, 0, n)
+	b.Walk(0, n, func(i int, userID string, score float64) {
+		r := opts.ResultAt(userID, score, i, n, mean, sd)
+		if i > 0 {
+			r.TieGroup = out[i-1].TieGroup
+			if score != out[i-1].Score {
+				r.TieGroup++
+			}
+		}
+		out = append(out, r)
+	})
+	return newItems, out, nil
+}
+
+// ResultAt is the result Rank gives, under incremental options, to the
+// user at position i (0 best) of a cohort of n with the given percent,
+// cohort mean and SD. Everything in it follows from those alone but
+// TieGroup, which depends on the neighbours and is left 0.
+func (o Options) ResultAt(userID string, percent float64, i, n int, mean, sd float64) Result {
+	k := int(float64(n) * o.TrimPercent / 100)
+	p := o.percentile(i, k, n-2*k)
+	if c := o.TopPercentile; c != nil {
+		p = math.Min(p, *c)
+	}
+	if o.Direction == TopIsLow {
+		p = 100 - p
+	}
+	out := []Result{{
+		UserID:     userID,
+		Rank:       i + 1,
+		Percentile: p,
+		Percent:    percent,
+		Score:      percent,
+		ZScore:     zScore(percent, mean, sd),
+		TScore:     tScore(percent, mean, sd),
+	}}
+	applyQuantile(out, o)
+	applyBadges(out, o)
+	return out[0]
+}
+
+// Incremental reports whether o orders users by raw percent, then
+// user_id, and computes percentiles from position alone, so that a Board
+// holds everything needed to rank under it. TrimPercent, MinDenominator,
+// SingleItemPercentile, TopPercentile, Direction, Quantile and Badges are
+// positional and allowed.
+func (o Options) Incremental() bool {
+	return len(o.TierOrder) == 0 && o.TiePrecision == nil && !o.ArrivalTieBreak &&
+		len(o.TieBreak) == 0 && len(o.TiePriority) == 0 && len(o.Pins) == 0 &&
+		o.ShuffleSeed == nil && o.Transform == TransformNone && len(o.Borda) == 0 &&
+		len(o.Composite) == 0 && o.Decay == nil && o.Shrinkage == nil && o.Scoring == ScoringPercent && o.GraceBand == 0 && (o.Strategy == "" || o.Strategy == StrategyOrdinal) &&
+		o.StabilityDelta == 0 && o.MinScore == nil &&
+		(o.Method == "" || o.Method == MethodSelfExclusive) &&
+		!o.Weighted && o.Anchors == nil && o.Normal == nil && !o.NullLastTiePercentile && o.TopK == 0
+}
@@ -0,0 +1,68 @@
+package rank
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateScoreMatchesRank(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	top := 99.0
+	for name, opts := range map[string]Options{
+		"plain":      {},
+		"positional": {TrimPercent: 10, MinDenominator: 5, TopPercentile: &top, Direction: TopIsLow},
+		"full":       {GraceBand: 2, Strategy: StrategyCompetition}, // falls back to Rank
+	} {
+		var items []Item
+		for i := 0; i < 40; i++ {
+			// Whole percents so updates land on ties.
+			items = append(items, Item{UserID: fmt.Sprintf("u%02d", i), Percent: float64(rng.Intn(30))})
+		}
+		results, err := Rank(items, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for step := 0; step < 200; step++ {
+			id := fmt.Sprintf("u%02d", rng.Intn(45)) // sometimes a new user
+			pct := float64(rng.Intn(30))
+			items, results, err = UpdateScore(items, results, opts, id, pct)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := Rank(items, opts)
+			if !reflect.DeepEqual(results, want) {
+				t.Fatalf("%s step %d (%s=%v):\n got %+v\nwant %+v", name, step, id, pct, results, want)
+			}
+		}
+	}
+}
+
+func TestUpdateScoreKeepsItemFields(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 50, Metrics: map[string]float64{"x": 1}}, {UserID: "b", Percent: 60}}
+	got, _, err := UpdateScore(items, RankByPercent(items), Options{}, "a", 70)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Percent != 70 || got[0].Metrics["x"] != 1 || items[0].Percent != 50 {
+		t.Errorf("items %+v (input %+v)", got, items)
+	}
+}
+
+func TestUpdateScoresBatch(t *testing.T) {
+	items := []Item{{UserID: "a", Percent: 50}, {UserID: "b", Percent: 60}, {UserID: "c", Percent: 70}}
+	opts := Options{Quantile: QuantileQuartile, Badges: []Badge{{Name: "top", MinPercentile: 90}}}
+	results, _ := Rank(items, opts)
+	scores := []Score{{UserID: "a", Percent: 90}, {UserID: "d", Percent: 65}, {UserID: "a", Percent: 55}, {UserID: "c", Percent: 40}}
+	got, gotResults, err := UpdateScores(items, results, opts, scores)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]Item(nil), items...), Item{UserID: "d", Percent: 65})
+	want[0].Percent, want[2].Percent = 55, 40
+	wantResults, _ := Rank(want, opts)
+	if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(gotResults, wantResults) {
+		t.Errorf("got %+v\n%+v\nwant %+v\n%+v", got, gotResults, want, wantResults)
+	}
+}
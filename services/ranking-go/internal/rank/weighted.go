@@ -0,0 +1,91 @@
+package rank
+
+import "fmt"
+
+// TieWeight is where within a tie group's weight span a weighted
+// percentile is read. With W the total weight of the reference, B the
+// weight strictly below the group and G the group's own weight:
+//
+//	TieWeightStart:    100 * B / W          (the group's lower edge)
+//	TieWeightEnd:      100 * (B + G) / W    (its upper edge)
+//	TieWeightMidpoint: 100 * (B + G/2) / W  (the default)
+//
+// An untied user is a group of one.
+type TieWeight string
+
+const (
+	TieWeightMidpoint TieWeight = "midpoint"
+	TieWeightStart    TieWeight = "start"
+	TieWeightEnd      TieWeight = "end"
+)
+
+func (t TieWeight) valid() bool {
+	switch t {
+	case "", TieWeightMidpoint, TieWeightStart, TieWeightEnd:
+		return true
+	}
+	return false
+}
+
+// weight is an item's population weight; unset (0) counts as 1.
+func (it Item) weight() float64 {
+	if it.Weight == 0 {
+		return 1
+	}
+	return it.Weight
+}
+
+func checkWeights(items []Item) error {
+	for _, it := range items {
+		if it.Weight < 0 {
+			return fmt.Errorf("user %q: weight must not be negative, got %v", it.UserID, it.Weight)
+		}
+	}
+	return nil
+}
+
+// applyWeighted sets weighted percentiles for the users with pos >= 0 (the
+// reference). Tie groups are runs of equal score and tier in sorted order.
+func applyWeighted(sorted []entry, pos []int, out []Result, tw TieWeight) {
+	var total float64
+	for i, e := range sorted {
+		if pos[i] >= 0 {
+			total += e.weight()
+		}
+	}
+	if total == 0 {
+		return
+	}
+	// Walk best to worst; above is the reference weight ranked above the
+	// current group.
+	var above float64
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && sorted[end].score == sorted[start].score && sorted[end].tier == sorted[start].tier {
+			end++
+		}
+		var group float64
+		for i := start; i < end; i++ {
+			if pos[i] >= 0 {
+				group += sorted[i].weight()
+			}
+		}
+		below := total - above - group
+		var p float64
+		switch tw {
+		case TieWeightStart:
+			p = 100 * below / total
+		case TieWeightEnd:
+			p = 100 * (below + group) / total
+		default:
+			p = 100 * (below + group/2) / total
+		}
+		for i := start; i < end; i++ {
+			if pos[i] >= 0 {
+				out[i].Percentile = p
+			}
+		}
+		above += group
+		start = end
+	}
+}
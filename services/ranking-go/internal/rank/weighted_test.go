@@ -0,0 +1,45 @@
+package rank
+
+import "testing"
+
+func TestRankWeightedTieConventions(t *testing.T) {
+	// Total weight 10; b and c tie, spanning weights 4..8 from the bottom.
+	items := []Item{
+		{UserID: "a", Percent: 90, Weight: 2},
+		{UserID: "b", Percent: 70, Weight: 1},
+		{UserID: "c", Percent: 70, Weight: 3},
+		{UserID: "d", Percent: 50, Weight: 4},
+	}
+	for tw, want := range map[TieWeight]map[string]float64{
+		TieWeightStart:    {"a": 80, "b": 40, "c": 40, "d": 0},
+		TieWeightEnd:      {"a": 100, "b": 80, "c": 80, "d": 40},
+		TieWeightMidpoint: {"a": 90, "b": 60, "c": 60, "d": 20},
+		"":                {"a": 90, "b": 60, "c": 60, "d": 20},
+	} {
+		out, err := Rank(items, Options{Weighted: true, TieWeight: tw})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range out {
+			if !approx(r.Percentile, want[r.UserID]) {
+				t.Errorf("%q: %s percentile %v, want %v", tw, r.UserID, r.Percentile, want[r.UserID])
+			}
+		}
+	}
+}
+
+func TestRankWeightedDefaultsAndErrors(t *testing.T) {
+	// Unset weights count as 1: midpoints of 4 equal slices.
+	out, _ := Rank([]Item{{UserID: "a", Percent: 4}, {UserID: "b", Percent: 3}, {UserID: "c", Percent: 2}, {UserID: "d", Percent: 1}}, Options{Weighted: true})
+	for i, want := range []float64{87.5, 62.5, 37.5, 12.5} {
+		if !approx(out[i].Percentile, want) {
+			t.Errorf("%s: %v, want %v", out[i].UserID, out[i].Percentile, want)
+		}
+	}
+	if _, err := Rank([]Item{{UserID: "a", Weight: -1}}, Options{Weighted: true}); err == nil {
+		t.Error("expected error for negative weight")
+	}
+	if _, err := Rank(nil, Options{Weighted: true, TieWeight: "median"}); err == nil {
+		t.Error("expected error for unknown tie_weight")
+	}
+}
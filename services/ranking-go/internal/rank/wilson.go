@@ -0,0 +1,59 @@
+package rank
+
+import (
+	"fmt"
+	"math"
+)
+
+// Scoring picks the score users are ranked on when it isn't a
+// transformed, weighted or adjusted percent.
+type Scoring string
+
+const (
+	ScoringPercent Scoring = ""       // the raw percent
+	ScoringWilson  Scoring = "wilson" // Wilson score lower bound of correct/total
+)
+
+func (s Scoring) valid() bool {
+	return s == ScoringPercent || s == ScoringWilson
+}
+
+// Metrics read by ScoringWilson.
+const (
+	MetricCorrect = "correct"
+	MetricTotal   = "total"
+)
+
+// wilsonZ is the normal quantile of the Wilson interval: 95% two-sided.
+const wilsonZ = 1.959963984540054
+
+// wilsonScores returns each item's Wilson score lower bound, as a percent:
+// the accuracy we are 97.5% confident the user is above, given correct of
+// total. Small samples score well below their raw accuracy, so 3/3 ranks
+// under 95/100. An item with no questions scores 0.
+func wilsonScores(items []Item) ([]float64, error) {
+	out := make([]float64, len(items))
+	for i, it := range items {
+		correct, okC := it.Metrics[MetricCorrect]
+		total, okT := it.Metrics[MetricTotal]
+		if !okC || !okT {
+			return nil, fmt.Errorf("user %q: wilson scoring needs the %q and %q metrics", it.UserID, MetricCorrect, MetricTotal)
+		}
+		if !(correct >= 0 && correct <= total) {
+			return nil, fmt.Errorf("user %q: correct must be in [0, total], got %v of %v", it.UserID, correct, total)
+		}
+		out[i] = 100 * wilsonLower(correct, total)
+	}
+	return out, nil
+}
+
+func wilsonLower(correct, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	p := correct / total
+	z2 := wilsonZ * wilsonZ
+	center := p + z2/(2*total)
+	margin := wilsonZ * math.Sqrt(p*(1-p)/total+z2/(4*total*total))
+	return math.Max((center-margin)/(1+z2/total), 0)
+}
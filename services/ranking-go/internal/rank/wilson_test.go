@@ -0,0 +1,43 @@
+package rank
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRankWilson(t *testing.T) {
+	item := func(id string, correct, total float64) Item {
+		return Item{UserID: id, Percent: 100 * correct / math.Max(total, 1), Metrics: map[string]float64{MetricCorrect: correct, MetricTotal: total}}
+	}
+	// 3/3 is perfect but thin evidence; 95/100 and even 40/50 rank above it.
+	items := []Item{item("lucky", 3, 3), item("solid", 95, 100), item("steady", 40, 50), item("none", 0, 0)}
+	out, err := Rank(items, Options{Scoring: ScoringWilson})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := order(out), []string{"solid", "steady", "lucky", "none"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order %v, want %v", got, want)
+	}
+	for i, want := range []float64{88.83, 66.96, 43.85, 0} {
+		if math.Abs(out[i].Score-want) > 0.01 {
+			t.Errorf("%s: wilson %v, want %v", out[i].UserID, out[i].Score, want)
+		}
+	}
+}
+
+func TestRankWilsonErrors(t *testing.T) {
+	for _, c := range []struct {
+		items []Item
+		opts  Options
+	}{
+		{[]Item{{UserID: "a", Metrics: map[string]float64{MetricCorrect: 1}}}, Options{Scoring: ScoringWilson}},
+		{[]Item{{UserID: "a", Metrics: map[string]float64{MetricCorrect: 3, MetricTotal: 2}}}, Options{Scoring: ScoringWilson}},
+		{[]Item{{UserID: "a"}}, Options{Scoring: "bayes"}},
+		{[]Item{{UserID: "a", Metrics: map[string]float64{MetricCorrect: 1, MetricTotal: 2}}}, Options{Scoring: ScoringWilson, Transform: TransformLog}},
+	} {
+		if _, err := Rank(c.items, c.opts); err == nil {
+			t.Errorf("%+v: no error", c)
+		}
+	}
+}
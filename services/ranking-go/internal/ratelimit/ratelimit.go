@@ -0,0 +1,80 @@
+// Package ratelimit throttles clients with one token bucket per key.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a sustained rate in requests per second and the burst allowed
+// above it. A zero Rate means unlimited; a zero Burst is one second's
+// worth of requests.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// sweepEvery is how often buckets that have refilled completely, and so
+// behave exactly like new ones, are dropped.
+const sweepEvery = time.Minute
+
+// Limiter holds a token bucket per key, each starting full.
+type Limiter struct {
+	limit Limit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func New(l Limit) *Limiter {
+	return &Limiter{limit: l, now: time.Now, buckets: map[string]*bucket{}}
+}
+
+// Allow takes a token from key's bucket. When it is empty Allow returns
+// false and how long until a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l.limit.Rate <= 0 {
+		return true, 0
+	}
+	burst := float64(l.limit.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(l.limit.Rate))
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > sweepEvery {
+		l.sweep(now, burst)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+func (l *Limiter) sweep(now time.Time, burst float64) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate >= burst {
+			delete(l.buckets, k)
+		}
+	}
+	l.lastSweep = now
+}
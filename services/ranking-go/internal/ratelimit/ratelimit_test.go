@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(Limit{Rate: 2, Burst: 3})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within burst refused", i)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("Allow = %v, %v; want refused, 500ms", ok, wait)
+	}
+	// Other keys have their own bucket.
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatal("b refused")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("refilled token refused")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("second token after 500ms allowed")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(Limit{Rate: 1, Burst: 1})
+	l.now = func() time.Time { return now }
+	l.Allow("a")
+	l.Allow("b")
+	now = now.Add(2 * sweepEvery)
+	l.Allow("c")
+	if len(l.buckets) != 1 {
+		t.Fatalf("buckets = %d, want refilled ones swept", len(l.buckets))
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	l := New(Limit{})
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatal("unlimited refused")
+		}
+	}
+}
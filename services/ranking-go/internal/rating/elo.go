@@ -0,0 +1,121 @@
+// Package rating keeps skill ratings from head-to-head matches, such as 1v1
+// quiz battles, as opposed to the rank package's one-off cohort rankings.
+package rating
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// SystemElo names the Elo system in stored rating tables.
+const SystemElo = "elo"
+
+// System updates a cohort's players from a batch of matches.
+type System interface {
+	Apply(players map[string]*Player, matches []Match) error
+}
+
+// Player is one user's rating and match record in a cohort. Deviation and
+// Volatility are Glicko-2's; Elo leaves them zero.
+type Player struct {
+	UserID     string
+	Rating     float64
+	Deviation  float64 `json:",omitempty"`
+	Volatility float64 `json:",omitempty"`
+	Matches    int
+	Wins       int
+	Losses     int
+	Draws      int
+}
+
+// Match is one game between A and B. ScoreA is A's result: 1 for a win,
+// 0.5 for a draw, 0 for a loss; B scores 1 - ScoreA.
+type Match struct {
+	A, B   string
+	ScoreA float64
+}
+
+func (m Match) validate() error {
+	switch {
+	case m.A == "" || m.B == "":
+		return fmt.Errorf("empty player")
+	case m.A == m.B:
+		return fmt.Errorf("player %q cannot play themselves", m.A)
+	case m.ScoreA != 0 && m.ScoreA != 0.5 && m.ScoreA != 1:
+		return fmt.Errorf("score must be 0, 0.5 or 1, got %v", m.ScoreA)
+	}
+	return nil
+}
+
+// Elo updates ratings one match at a time: each player moves by K times
+// the difference between their score and their expected score.
+type Elo struct {
+	K       float64
+	Initial float64
+}
+
+// Expected is the Elo expected score of a player rated ra against one
+// rated rb.
+func Expected(ra, rb float64) float64 {
+	return 1 / (1 + math.Pow(10, (rb-ra)/400))
+}
+
+// Apply plays matches in order against players, keyed by user ID, adding
+// players at the initial rating on their first match. It validates every
+// match before applying any, so players is untouched on error.
+func (e Elo) Apply(players map[string]*Player, matches []Match) error {
+	for i, m := range matches {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("matches[%d]: %w", i, err)
+		}
+	}
+	for _, m := range matches {
+		a, b := e.player(players, m.A), e.player(players, m.B)
+		ea := Expected(a.Rating, b.Rating)
+		a.Rating, b.Rating = a.Rating+e.K*(m.ScoreA-ea), b.Rating+e.K*(ea-m.ScoreA)
+		record(a, b, m.ScoreA)
+	}
+	return nil
+}
+
+func (e Elo) player(players map[string]*Player, id string) *Player {
+	p, ok := players[id]
+	if !ok {
+		p = &Player{UserID: id, Rating: e.Initial}
+		players[id] = p
+	}
+	return p
+}
+
+// record counts a match in both players' records.
+func record(a, b *Player, scoreA float64) {
+	a.Matches++
+	b.Matches++
+	switch scoreA {
+	case 1:
+		a.Wins++
+		b.Losses++
+	case 0:
+		a.Losses++
+		b.Wins++
+	default:
+		a.Draws++
+		b.Draws++
+	}
+}
+
+// Sorted returns players best first: by rating, then user ID.
+func Sorted(players map[string]*Player) []Player {
+	out := make([]Player, 0, len(players))
+	for _, p := range players {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rating != out[j].Rating {
+			return out[i].Rating > out[j].Rating
+		}
+		return out[i].UserID < out[j].UserID
+	})
+	return out
+}
@@ -0,0 +1,59 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+func TestElo(t *testing.T) {
+	e := Elo{K: 32, Initial: 1500}
+	players := map[string]*Player{}
+	if err := e.Apply(players, []Match{{A: "a", B: "b", ScoreA: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	// Equal ratings expect 0.5 each, so the winner gains K/2.
+	if a, b := players["a"], players["b"]; a.Rating != 1516 || b.Rating != 1484 || a.Wins != 1 || b.Losses != 1 {
+		t.Errorf("after one match: a %+v, b %+v", a, b)
+	}
+
+	// An upset moves more than an expected win, and ratings are zero-sum.
+	if err := e.Apply(players, []Match{{A: "b", B: "a", ScoreA: 1}, {A: "a", B: "c", ScoreA: 0.5}}); err != nil {
+		t.Fatal(err)
+	}
+	sum := 0.0
+	for _, p := range players {
+		sum += p.Rating
+	}
+	if math.Abs(sum-3*1500) > 1e-9 {
+		t.Errorf("ratings sum to %v, want 4500", sum)
+	}
+	if b := players["b"]; b.Rating <= 1500 || b.Matches != 2 {
+		t.Errorf("b after upset: %+v", b)
+	}
+	// a has dropped below 1500, so a draw costs the new c a little.
+	if c := players["c"]; c.Draws != 1 || c.Rating >= 1500 {
+		t.Errorf("c drew with a weaker a: %+v", c)
+	}
+
+	got := Sorted(players)
+	for i := 1; i < len(got); i++ {
+		if got[i].Rating > got[i-1].Rating {
+			t.Errorf("not sorted: %+v", got)
+		}
+	}
+
+	if math.Abs(Expected(1900, 1500)-10.0/11) > 1e-12 {
+		t.Errorf("expected(+400) = %v, want 10/11", Expected(1900, 1500))
+	}
+}
+
+func TestEloRejectsBadMatches(t *testing.T) {
+	e := Elo{K: 32, Initial: 1500}
+	for _, m := range []Match{{A: "a", B: "a", ScoreA: 1}, {A: "a", B: "", ScoreA: 1}, {A: "a", B: "b", ScoreA: 0.7}} {
+		players := map[string]*Player{}
+		// The valid first match must not be applied either.
+		if err := e.Apply(players, []Match{{A: "x", B: "y", ScoreA: 1}, m}); err == nil || len(players) != 0 {
+			t.Errorf("%+v: err %v, players %v", m, err, players)
+		}
+	}
+}
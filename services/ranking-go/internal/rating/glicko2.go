@@ -0,0 +1,133 @@
+package rating
+
+import (
+	"fmt"
+	"math"
+)
+
+// SystemGlicko2 names the Glicko-2 system in stored rating tables.
+const SystemGlicko2 = "glicko2"
+
+// glickoScale converts between the Glicko and Glicko-2 scales.
+const glickoScale = 173.7178
+
+// Glicko2 rates in periods: every match of one Apply is a single rating
+// period, scored against opponents' ratings from before it. Each player
+// carries a deviation, how uncertain the rating is, and a volatility, how
+// erratic their results are; a player who sits a period out keeps their
+// rating but grows less certain, up to Deviation. See Glickman, "Example
+// of the Glicko-2 system".
+type Glicko2 struct {
+	Initial float64
+	// Deviation and Volatility are a new player's.
+	Deviation  float64
+	Volatility float64
+	// Tau limits how fast volatility changes; 0.3 to 1.2 is typical.
+	Tau float64
+}
+
+// glickoEpsilon is the convergence tolerance of the volatility update.
+const glickoEpsilon = 1e-6
+
+type glickoResult struct {
+	mu, phi float64
+	score   float64
+}
+
+// Apply plays one rating period of matches, adding players at the
+// initial rating, deviation and volatility on their first match. As with
+// Elo.Apply, players is untouched on error.
+func (g Glicko2) Apply(players map[string]*Player, matches []Match) error {
+	for i, m := range matches {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("matches[%d]: %w", i, err)
+		}
+	}
+	for _, m := range matches {
+		g.player(players, m.A)
+		g.player(players, m.B)
+	}
+	// Each player's results, against the opponents as they were before
+	// the period.
+	results := make(map[string][]glickoResult, len(players))
+	for _, m := range matches {
+		a, b := players[m.A], players[m.B]
+		results[m.A] = append(results[m.A], glickoResult{toMu(b.Rating), b.Deviation / glickoScale, m.ScoreA})
+		results[m.B] = append(results[m.B], glickoResult{toMu(a.Rating), a.Deviation / glickoScale, 1 - m.ScoreA})
+		record(a, b, m.ScoreA)
+	}
+	for id, p := range players {
+		phi := p.Deviation / glickoScale
+		rs := results[id]
+		if len(rs) == 0 {
+			p.Deviation = math.Min(math.Sqrt(phi*phi+p.Volatility*p.Volatility)*glickoScale, g.Deviation)
+			continue
+		}
+		mu := toMu(p.Rating)
+		var vInv, delta float64
+		for _, r := range rs {
+			gj := glickoG(r.phi)
+			e := 1 / (1 + math.Exp(-gj*(mu-r.mu)))
+			vInv += gj * gj * e * (1 - e)
+			delta += gj * (r.score - e)
+		}
+		v := 1 / vInv
+		sigma := g.volatility(phi, p.Volatility, v, v*delta)
+		phiStar := math.Sqrt(phi*phi + sigma*sigma)
+		phiNew := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+		p.Rating = glickoScale*(mu+phiNew*phiNew*delta) + 1500
+		p.Deviation = phiNew * glickoScale
+		p.Volatility = sigma
+	}
+	return nil
+}
+
+func (g Glicko2) player(players map[string]*Player, id string) *Player {
+	p, ok := players[id]
+	if !ok {
+		p = &Player{UserID: id, Rating: g.Initial, Deviation: g.Deviation, Volatility: g.Volatility}
+		players[id] = p
+	}
+	return p
+}
+
+func toMu(r float64) float64 { return (r - 1500) / glickoScale }
+
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+// volatility is step 5 of the Glicko-2 update: the Illinois method on
+// f(x) = 0, where x is the log of the new volatility squared.
+func (g Glicko2) volatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	tau2 := g.Tau * g.Tau
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/tau2
+	}
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*g.Tau) < 0 {
+			k++
+		}
+		B = a - k*g.Tau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glickoEpsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
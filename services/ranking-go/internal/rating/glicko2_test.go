@@ -0,0 +1,50 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGlicko2(t *testing.T) {
+	g := Glicko2{Initial: 1500, Deviation: 350, Volatility: 0.06, Tau: 0.5}
+	// Glickman's worked example.
+	players := map[string]*Player{
+		"p":  {UserID: "p", Rating: 1500, Deviation: 200, Volatility: 0.06},
+		"o1": {UserID: "o1", Rating: 1400, Deviation: 30, Volatility: 0.06},
+		"o2": {UserID: "o2", Rating: 1550, Deviation: 100, Volatility: 0.06},
+		"o3": {UserID: "o3", Rating: 1700, Deviation: 300, Volatility: 0.06},
+		"x":  {UserID: "x", Rating: 1600, Deviation: 100, Volatility: 0.06},
+	}
+	err := g.Apply(players, []Match{{A: "p", B: "o1", ScoreA: 1}, {A: "o2", B: "p", ScoreA: 1}, {A: "p", B: "o3", ScoreA: 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := players["p"]
+	if math.Abs(p.Rating-1464.06) > 0.01 || math.Abs(p.Deviation-151.52) > 0.01 || math.Abs(p.Volatility-0.05999) > 1e-5 {
+		t.Errorf("p = %+v, want 1464.06, 151.52, 0.05999", p)
+	}
+	if p.Matches != 3 || p.Wins != 1 || p.Losses != 2 {
+		t.Errorf("p's record %+v", p)
+	}
+	// x sat the period out: same rating, less certain.
+	if x := players["x"]; x.Rating != 1600 || x.Deviation <= 100 || x.Matches != 0 {
+		t.Errorf("idle x = %+v", x)
+	}
+
+	// Newcomers start at the initial values, and a long-idle player's
+	// deviation stops at the initial deviation.
+	players = map[string]*Player{"old": {UserID: "old", Rating: 1700, Deviation: 349.99, Volatility: 0.5}}
+	if err := g.Apply(players, []Match{{A: "a", B: "b", ScoreA: 0.5}}); err != nil {
+		t.Fatal(err)
+	}
+	if a := players["a"]; a.Rating != 1500 || a.Deviation >= 350 || a.Draws != 1 {
+		t.Errorf("drawn newcomer a = %+v", a)
+	}
+	if old := players["old"]; old.Deviation != 350 {
+		t.Errorf("idle deviation %v, want capped at 350", old.Deviation)
+	}
+
+	if err := g.Apply(players, []Match{{A: "a", B: "a", ScoreA: 1}}); err == nil {
+		t.Error("self-match accepted")
+	}
+}
@@ -0,0 +1,703 @@
+// Ranking service RPCs, mirroring the HTTP API (see README.md). Field
+// meanings are those of the JSON fields with the same names.
+//
+// The Go stubs in internal/rpc/rankingv1 are generated from this file with
+// protoc-gen-go and protoc-gen-go-grpc (go generate ./internal/rpc); the
+// server is internal/rpc, listening on GRPC_ADDR.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: ranking/v1/ranking.proto
+
+package rankingv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Item struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Percent       float64                `protobuf:"fixed64,2,opt,name=percent,proto3" json:"percent,omitempty"`
+	Tier          string                 `protobuf:"bytes,3,opt,name=tier,proto3" json:"tier,omitempty"`
+	Metrics       map[string]float64     `protobuf:"bytes,4,rep,name=metrics,proto3" json:"metrics,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	Arrival       *float64               `protobuf:"fixed64,5,opt,name=arrival,proto3,oneof" json:"arrival,omitempty"`
+	Weight        float64                `protobuf:"fixed64,6,opt,name=weight,proto3" json:"weight,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Item) Reset() {
+	*x = Item{}
+	mi := &file_ranking_v1_ranking_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Item) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Item) ProtoMessage() {}
+
+func (x *Item) ProtoReflect() protoreflect.Message {
+	mi := &file_ranking_v1_ranking_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Item.ProtoReflect.Descriptor instead.
+func (*Item) Descriptor() ([]byte, []int) {
+	return file_ranking_v1_ranking_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Item) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Item) GetPercent() float64 {
+	if x != nil {
+		return x.Percent
+	}
+	return 0
+}
+
+func (x *Item) GetTier() string {
+	if x != nil {
+		return x.Tier
+	}
+	return ""
+}
+
+func (x *Item) GetMetrics() map[string]float64 {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *Item) GetArrival() float64 {
+	if x != nil && x.Arrival != nil {
+		return *x.Arrival
+	}
+	return 0
+}
+
+func (x *Item) GetWeight() float64 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+type RankRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	CohortId string                 `protobuf:"bytes,1,opt,name=cohort_id,json=cohortId,proto3" json:"cohort_id,omitempty"`
+	Items    []*Item                `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
+	// options_json is a JSON object of /rank options, e.g.
+	// {"strategy": "dense", "precision": 2}, so every HTTP option is
+	// available without duplicating the schema here.
+	OptionsJson   []byte `protobuf:"bytes,3,opt,name=options_json,json=optionsJson,proto3" json:"options_json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RankRequest) Reset() {
+	*x = RankRequest{}
+	mi := &file_ranking_v1_ranking_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RankRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RankRequest) ProtoMessage() {}
+
+func (x *RankRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ranking_v1_ranking_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RankRequest.ProtoReflect.Descriptor instead.
+func (*RankRequest) Descriptor() ([]byte, []int) {
+	return file_ranking_v1_ranking_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RankRequest) GetCohortId() string {
+	if x != nil {
+		return x.CohortId
+	}
+	return ""
+}
+
+func (x *RankRequest) GetItems() []*Item {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *RankRequest) GetOptionsJson() []byte {
+	if x != nil {
+		return x.OptionsJson
+	}
+	return nil
+}
+
+type RankResult struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Rank   int64                  `protobuf:"varint,2,opt,name=rank,proto3" json:"rank,omitempty"`
+	// Unset when the percentile is withheld (null in JSON).
+	Percentile     *float64 `protobuf:"fixed64,3,opt,name=percentile,proto3,oneof" json:"percentile,omitempty"`
+	FractionalRank *float64 `protobuf:"fixed64,4,opt,name=fractional_rank,json=fractionalRank,proto3,oneof" json:"fractional_rank,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *RankResult) Reset() {
+	*x = RankResult{}
+	mi := &file_ranking_v1_ranking_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RankResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RankResult) ProtoMessage() {}
+
+func (x *RankResult) ProtoReflect() protoreflect.Message {
+	mi := &file_ranking_v1_ranking_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RankResult.ProtoReflect.Descriptor instead.
+func (*RankResult) Descriptor() ([]byte, []int) {
+	return file_ranking_v1_ranking_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RankResult) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *RankResult) GetRank() int64 {
+	if x != nil {
+		return x.Rank
+	}
+	return 0
+}
+
+func (x *RankResult) GetPercentile() float64 {
+	if x != nil && x.Percentile != nil {
+		return *x.Percentile
+	}
+	return 0
+}
+
+func (x *RankResult) GetFractionalRank() float64 {
+	if x != nil && x.FractionalRank != nil {
+		return *x.FractionalRank
+	}
+	return 0
+}
+
+type RankResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	CohortId string                 `protobuf:"bytes,1,opt,name=cohort_id,json=cohortId,proto3" json:"cohort_id,omitempty"`
+	// 0 when the ranking was not stored.
+	Version          int64         `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	Results          []*RankResult `protobuf:"bytes,3,rep,name=results,proto3" json:"results,omitempty"`
+	PercentileMethod string        `protobuf:"bytes,4,opt,name=percentile_method,json=percentileMethod,proto3" json:"percentile_method,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *RankResponse) Reset() {
+	*x = RankResponse{}
+	mi := &file_ranking_v1_ranking_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RankResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RankResponse) ProtoMessage() {}
+
+func (x *RankResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ranking_v1_ranking_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RankResponse.ProtoReflect.Descriptor instead.
+func (*RankResponse) Descriptor() ([]byte, []int) {
+	return file_ranking_v1_ranking_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RankResponse) GetCohortId() string {
+	if x != nil {
+		return x.CohortId
+	}
+	return ""
+}
+
+func (x *RankResponse) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *RankResponse) GetResults() []*RankResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *RankResponse) GetPercentileMethod() string {
+	if x != nil {
+		return x.PercentileMethod
+	}
+	return ""
+}
+
+type GetLeaderboardRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	CohortId string                 `protobuf:"bytes,1,opt,name=cohort_id,json=cohortId,proto3" json:"cohort_id,omitempty"`
+	// 1-1000, default 100.
+	Limit         int32  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	Cursor        string `protobuf:"bytes,3,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLeaderboardRequest) Reset() {
+	*x = GetLeaderboardRequest{}
+	mi := &file_ranking_v1_ranking_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLeaderboardRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLeaderboardRequest) ProtoMessage() {}
+
+func (x *GetLeaderboardRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ranking_v1_ranking_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLeaderboardRequest.ProtoReflect.Descriptor instead.
+func (*GetLeaderboardRequest) Descriptor() ([]byte, []int) {
+	return file_ranking_v1_ranking_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetLeaderboardRequest) GetCohortId() string {
+	if x != nil {
+		return x.CohortId
+	}
+	return ""
+}
+
+func (x *GetLeaderboardRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *GetLeaderboardRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+type GetLeaderboardResponse struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	CohortId   string                 `protobuf:"bytes,1,opt,name=cohort_id,json=cohortId,proto3" json:"cohort_id,omitempty"`
+	Version    int64                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	CohortSize int64                  `protobuf:"varint,3,opt,name=cohort_size,json=cohortSize,proto3" json:"cohort_size,omitempty"`
+	Results    []*RankResult          `protobuf:"bytes,4,rep,name=results,proto3" json:"results,omitempty"`
+	// Empty on the last page.
+	NextCursor    string `protobuf:"bytes,5,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLeaderboardResponse) Reset() {
+	*x = GetLeaderboardResponse{}
+	mi := &file_ranking_v1_ranking_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLeaderboardResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLeaderboardResponse) ProtoMessage() {}
+
+func (x *GetLeaderboardResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ranking_v1_ranking_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLeaderboardResponse.ProtoReflect.Descriptor instead.
+func (*GetLeaderboardResponse) Descriptor() ([]byte, []int) {
+	return file_ranking_v1_ranking_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetLeaderboardResponse) GetCohortId() string {
+	if x != nil {
+		return x.CohortId
+	}
+	return ""
+}
+
+func (x *GetLeaderboardResponse) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *GetLeaderboardResponse) GetCohortSize() int64 {
+	if x != nil {
+		return x.CohortSize
+	}
+	return 0
+}
+
+func (x *GetLeaderboardResponse) GetResults() []*RankResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *GetLeaderboardResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+type GetUserRankRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CohortId      string                 `protobuf:"bytes,1,opt,name=cohort_id,json=cohortId,proto3" json:"cohort_id,omitempty"`
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetUserRankRequest) Reset() {
+	*x = GetUserRankRequest{}
+	mi := &file_ranking_v1_ranking_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetUserRankRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetUserRankRequest) ProtoMessage() {}
+
+func (x *GetUserRankRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ranking_v1_ranking_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetUserRankRequest.ProtoReflect.Descriptor instead.
+func (*GetUserRankRequest) Descriptor() ([]byte, []int) {
+	return file_ranking_v1_ranking_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetUserRankRequest) GetCohortId() string {
+	if x != nil {
+		return x.CohortId
+	}
+	return ""
+}
+
+func (x *GetUserRankRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type GetUserRankResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CohortId      string                 `protobuf:"bytes,1,opt,name=cohort_id,json=cohortId,proto3" json:"cohort_id,omitempty"`
+	Version       int64                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	CohortSize    int64                  `protobuf:"varint,3,opt,name=cohort_size,json=cohortSize,proto3" json:"cohort_size,omitempty"`
+	Result        *RankResult            `protobuf:"bytes,4,opt,name=result,proto3" json:"result,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetUserRankResponse) Reset() {
+	*x = GetUserRankResponse{}
+	mi := &file_ranking_v1_ranking_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetUserRankResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetUserRankResponse) ProtoMessage() {}
+
+func (x *GetUserRankResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ranking_v1_ranking_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetUserRankResponse.ProtoReflect.Descriptor instead.
+func (*GetUserRankResponse) Descriptor() ([]byte, []int) {
+	return file_ranking_v1_ranking_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetUserRankResponse) GetCohortId() string {
+	if x != nil {
+		return x.CohortId
+	}
+	return ""
+}
+
+func (x *GetUserRankResponse) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *GetUserRankResponse) GetCohortSize() int64 {
+	if x != nil {
+		return x.CohortSize
+	}
+	return 0
+}
+
+func (x *GetUserRankResponse) GetResult() *RankResult {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+var File_ranking_v1_ranking_proto protoreflect.FileDescriptor
+
+const file_ranking_v1_ranking_proto_rawDesc = "" +
+	"\n" +
+	"\x18ranking/v1/ranking.proto\x12\x10mediq.ranking.v1\"\x8b\x02\n" +
+	"\x04Item\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x18\n" +
+	"\apercent\x18\x02 \x01(\x01R\apercent\x12\x12\n" +
+	"\x04tier\x18\x03 \x01(\tR\x04tier\x12=\n" +
+	"\ametrics\x18\x04 \x03(\v2#.mediq.ranking.v1.Item.MetricsEntryR\ametrics\x12\x1d\n" +
+	"\aarrival\x18\x05 \x01(\x01H\x00R\aarrival\x88\x01\x01\x12\x16\n" +
+	"\x06weight\x18\x06 \x01(\x01R\x06weight\x1a:\n" +
+	"\fMetricsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01B\n" +
+	"\n" +
+	"\b_arrival\"{\n" +
+	"\vRankRequest\x12\x1b\n" +
+	"\tcohort_id\x18\x01 \x01(\tR\bcohortId\x12,\n" +
+	"\x05items\x18\x02 \x03(\v2\x16.mediq.ranking.v1.ItemR\x05items\x12!\n" +
+	"\foptions_json\x18\x03 \x01(\fR\voptionsJson\"\xaf\x01\n" +
+	"\n" +
+	"RankResult\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x12\n" +
+	"\x04rank\x18\x02 \x01(\x03R\x04rank\x12#\n" +
+	"\n" +
+	"percentile\x18\x03 \x01(\x01H\x00R\n" +
+	"percentile\x88\x01\x01\x12,\n" +
+	"\x0ffractional_rank\x18\x04 \x01(\x01H\x01R\x0efractionalRank\x88\x01\x01B\r\n" +
+	"\v_percentileB\x12\n" +
+	"\x10_fractional_rank\"\xaa\x01\n" +
+	"\fRankResponse\x12\x1b\n" +
+	"\tcohort_id\x18\x01 \x01(\tR\bcohortId\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x03R\aversion\x126\n" +
+	"\aresults\x18\x03 \x03(\v2\x1c.mediq.ranking.v1.RankResultR\aresults\x12+\n" +
+	"\x11percentile_method\x18\x04 \x01(\tR\x10percentileMethod\"b\n" +
+	"\x15GetLeaderboardRequest\x12\x1b\n" +
+	"\tcohort_id\x18\x01 \x01(\tR\bcohortId\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06cursor\x18\x03 \x01(\tR\x06cursor\"\xc9\x01\n" +
+	"\x16GetLeaderboardResponse\x12\x1b\n" +
+	"\tcohort_id\x18\x01 \x01(\tR\bcohortId\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x03R\aversion\x12\x1f\n" +
+	"\vcohort_size\x18\x03 \x01(\x03R\n" +
+	"cohortSize\x126\n" +
+	"\aresults\x18\x04 \x03(\v2\x1c.mediq.ranking.v1.RankResultR\aresults\x12\x1f\n" +
+	"\vnext_cursor\x18\x05 \x01(\tR\n" +
+	"nextCursor\"J\n" +
+	"\x12GetUserRankRequest\x12\x1b\n" +
+	"\tcohort_id\x18\x01 \x01(\tR\bcohortId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\"\xa3\x01\n" +
+	"\x13GetUserRankResponse\x12\x1b\n" +
+	"\tcohort_id\x18\x01 \x01(\tR\bcohortId\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x03R\aversion\x12\x1f\n" +
+	"\vcohort_size\x18\x03 \x01(\x03R\n" +
+	"cohortSize\x124\n" +
+	"\x06result\x18\x04 \x01(\v2\x1c.mediq.ranking.v1.RankResultR\x06result2\x98\x02\n" +
+	"\x0eRankingService\x12E\n" +
+	"\x04Rank\x12\x1d.mediq.ranking.v1.RankRequest\x1a\x1e.mediq.ranking.v1.RankResponse\x12c\n" +
+	"\x0eGetLeaderboard\x12'.mediq.ranking.v1.GetLeaderboardRequest\x1a(.mediq.ranking.v1.GetLeaderboardResponse\x12Z\n" +
+	"\vGetUserRank\x12$.mediq.ranking.v1.GetUserRankRequest\x1a%.mediq.ranking.v1.GetUserRankResponseB#Z!ranking-go/internal/rpc/rankingv1b\x06proto3"
+
+var (
+	file_ranking_v1_ranking_proto_rawDescOnce sync.Once
+	file_ranking_v1_ranking_proto_rawDescData []byte
+)
+
+func file_ranking_v1_ranking_proto_rawDescGZIP() []byte {
+	file_ranking_v1_ranking_proto_rawDescOnce.Do(func() {
+		file_ranking_v1_ranking_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ranking_v1_ranking_proto_rawDesc), len(file_ranking_v1_ranking_proto_rawDesc)))
+	})
+	return file_ranking_v1_ranking_proto_rawDescData
+}
+
+var file_ranking_v1_ranking_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_ranking_v1_ranking_proto_goTypes = []any{
+	(*Item)(nil),                   // 0: mediq.ranking.v1.Item
+	(*RankRequest)(nil),            // 1: mediq.ranking.v1.RankRequest
+	(*RankResult)(nil),             // 2: mediq.ranking.v1.RankResult
+	(*RankResponse)(nil),           // 3: mediq.ranking.v1.RankResponse
+	(*GetLeaderboardRequest)(nil),  // 4: mediq.ranking.v1.GetLeaderboardRequest
+	(*GetLeaderboardResponse)(nil), // 5: mediq.ranking.v1.GetLeaderboardResponse
+	(*GetUserRankRequest)(nil),     // 6: mediq.ranking.v1.GetUserRankRequest
+	(*GetUserRankResponse)(nil),    // 7: mediq.ranking.v1.GetUserRankResponse
+	nil,                            // 8: mediq.ranking.v1.Item.MetricsEntry
+}
+var file_ranking_v1_ranking_proto_depIdxs = []int32{
+	8, // 0: mediq.ranking.v1.Item.metrics:type_name -> mediq.ranking.v1.Item.MetricsEntry
+	0, // 1: mediq.ranking.v1.RankRequest.items:type_name -> mediq.ranking.v1.Item
+	2, // 2: mediq.ranking.v1.RankResponse.results:type_name -> mediq.ranking.v1.RankResult
+	2, // 3: mediq.ranking.v1.GetLeaderboardResponse.results:type_name -> mediq.ranking.v1.RankResult
+	2, // 4: mediq.ranking.v1.GetUserRankResponse.result:type_name -> mediq.ranking.v1.RankResult
+	1, // 5: mediq.ranking.v1.RankingService.Rank:input_type -> mediq.ranking.v1.RankRequest
+	4, // 6: mediq.ranking.v1.RankingService.GetLeaderboard:input_type -> mediq.ranking.v1.GetLeaderboardRequest
+	6, // 7: mediq.ranking.v1.RankingService.GetUserRank:input_type -> mediq.ranking.v1.GetUserRankRequest
+	3, // 8: mediq.ranking.v1.RankingService.Rank:output_type -> mediq.ranking.v1.RankResponse
+	5, // 9: mediq.ranking.v1.RankingService.GetLeaderboard:output_type -> mediq.ranking.v1.GetLeaderboardResponse
+	7, // 10: mediq.ranking.v1.RankingService.GetUserRank:output_type -> mediq.ranking.v1.GetUserRankResponse
+	8, // [8:11] is the sub-list for method output_type
+	5, // [5:8] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_ranking_v1_ranking_proto_init() }
+func file_ranking_v1_ranking_proto_init() {
+	if File_ranking_v1_ranking_proto != nil {
+		return
+	}
+	file_ranking_v1_ranking_proto_msgTypes[0].OneofWrappers = []any{}
+	file_ranking_v1_ranking_proto_msgTypes[2].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ranking_v1_ranking_proto_rawDesc), len(file_ranking_v1_ranking_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_ranking_v1_ranking_proto_goTypes,
+		DependencyIndexes: file_ranking_v1_ranking_proto_depIdxs,
+		MessageInfos:      file_ranking_v1_ranking_proto_msgTypes,
+	}.Build()
+	File_ranking_v1_ranking_proto = out.File
+	file_ranking_v1_ranking_proto_goTypes = nil
+	file_ranking_v1_ranking_proto_depIdxs = nil
+}
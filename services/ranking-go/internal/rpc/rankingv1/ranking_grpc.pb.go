@@ -0,0 +1,210 @@
+// Ranking service RPCs, mirroring the HTTP API (see README.md). Field
+// meanings are those of the JSON fields with the same names.
+//
+// The Go stubs in internal/rpc/rankingv1 are generated from this file with
+// protoc-gen-go and protoc-gen-go-grpc (go generate ./internal/rpc); the
+// server is internal/rpc, listening on GRPC_ADDR.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: ranking/v1/ranking.proto
+
+package rankingv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	RankingService_Rank_FullMethodName           = "/mediq.ranking.v1.RankingService/Rank"
+	RankingService_GetLeaderboard_FullMethodName = "/mediq.ranking.v1.RankingService/GetLeaderboard"
+	RankingService_GetUserRank_FullMethodName    = "/mediq.ranking.v1.RankingService/GetUserRank"
+)
+
+// RankingServiceClient is the client API for RankingService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RankingServiceClient interface {
+	// Rank ranks a cohort, storing it when cohort_id is set (POST /rank).
+	Rank(ctx context.Context, in *RankRequest, opts ...grpc.CallOption) (*RankResponse, error)
+	// GetLeaderboard pages through a stored ranking (GET /leaderboard/{cohort_id}).
+	GetLeaderboard(ctx context.Context, in *GetLeaderboardRequest, opts ...grpc.CallOption) (*GetLeaderboardResponse, error)
+	// GetUserRank returns one user's row (GET /rank/{cohort_id}/users/{user_id}).
+	GetUserRank(ctx context.Context, in *GetUserRankRequest, opts ...grpc.CallOption) (*GetUserRankResponse, error)
+}
+
+type rankingServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRankingServiceClient(cc grpc.ClientConnInterface) RankingServiceClient {
+	return &rankingServiceClient{cc}
+}
+
+func (c *rankingServiceClient) Rank(ctx context.Context, in *RankRequest, opts ...grpc.CallOption) (*RankResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RankResponse)
+	err := c.cc.Invoke(ctx, RankingService_Rank_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rankingServiceClient) GetLeaderboard(ctx context.Context, in *GetLeaderboardRequest, opts ...grpc.CallOption) (*GetLeaderboardResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetLeaderboardResponse)
+	err := c.cc.Invoke(ctx, RankingService_GetLeaderboard_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rankingServiceClient) GetUserRank(ctx context.Context, in *GetUserRankRequest, opts ...grpc.CallOption) (*GetUserRankResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetUserRankResponse)
+	err := c.cc.Invoke(ctx, RankingService_GetUserRank_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RankingServiceServer is the server API for RankingService service.
+// All implementations must embed UnimplementedRankingServiceServer
+// for forward compatibility.
+type RankingServiceServer interface {
+	// Rank ranks a cohort, storing it when cohort_id is set (POST /rank).
+	Rank(context.Context, *RankRequest) (*RankResponse, error)
+	// GetLeaderboard pages through a stored ranking (GET /leaderboard/{cohort_id}).
+	GetLeaderboard(context.Context, *GetLeaderboardRequest) (*GetLeaderboardResponse, error)
+	// GetUserRank returns one user's row (GET /rank/{cohort_id}/users/{user_id}).
+	GetUserRank(context.Context, *GetUserRankRequest) (*GetUserRankResponse, error)
+	mustEmbedUnimplementedRankingServiceServer()
+}
+
+// UnimplementedRankingServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRankingServiceServer struct{}
+
+func (UnimplementedRankingServiceServer) Rank(context.Context, *RankRequest) (*RankResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rank not implemented")
+}
+func (UnimplementedRankingServiceServer) GetLeaderboard(context.Context, *GetLeaderboardRequest) (*GetLeaderboardResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLeaderboard not implemented")
+}
+func (UnimplementedRankingServiceServer) GetUserRank(context.Context, *GetUserRankRequest) (*GetUserRankResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserRank not implemented")
+}
+func (UnimplementedRankingServiceServer) mustEmbedUnimplementedRankingServiceServer() {}
+func (UnimplementedRankingServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeRankingServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RankingServiceServer will
+// result in compilation errors.
+type UnsafeRankingServiceServer interface {
+	mustEmbedUnimplementedRankingServiceServer()
+}
+
+func RegisterRankingServiceServer(s grpc.ServiceRegistrar, srv RankingServiceServer) {
+	// If the following call pancis, it indicates UnimplementedRankingServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&RankingService_ServiceDesc, srv)
+}
+
+func _RankingService_Rank_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RankRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).Rank(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RankingService_Rank_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).Rank(ctx, req.(*RankRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_GetLeaderboard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLeaderboardRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).GetLeaderboard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RankingService_GetLeaderboard_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).GetLeaderboard(ctx, req.(*GetLeaderboardRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RankingService_GetUserRank_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserRankRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RankingServiceServer).GetUserRank(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RankingService_GetUserRank_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RankingServiceServer).GetUserRank(ctx, req.(*GetUserRankRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RankingService_ServiceDesc is the grpc.ServiceDesc for RankingService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RankingService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mediq.ranking.v1.RankingService",
+	HandlerType: (*RankingServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Rank",
+			Handler:    _RankingService_Rank_Handler,
+		},
+		{
+			MethodName: "GetLeaderboard",
+			Handler:    _RankingService_GetLeaderboard_Handler,
+		},
+		{
+			MethodName: "GetUserRank",
+			Handler:    _RankingService_GetUserRank_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "ranking/v1/ranking.proto",
+}
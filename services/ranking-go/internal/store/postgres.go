@@ -0,0 +1,482 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"ranking-go/internal/rank"
+	"ranking-go/internal/rating"
+)
+
+// postgresSchema is created by NewPostgres if missing. The ranking itself
+// is one jsonb document; only the lookup key and version are columns.
+// ranking_scores holds the scores PutScore recorded since, each under the
+// version it made. ranking_snapshots holds each cohort's history in the
+// same form as rankings, without items, ratings the head-to-head rating
+// tables, digests the score digests and idempotency_keys the responses
+// saved for Idempotency-Keys.
+var postgresSchema = []string{`CREATE TABLE IF NOT EXISTS rankings (
+	tenant    text        NOT NULL,
+	cohort_id text        NOT NULL,
+	version   bigint      NOT NULL,
+	ranked_at timestamptz NOT NULL,
+	data      jsonb       NOT NULL,
+	PRIMARY KEY (tenant, cohort_id)
+)`, `CREATE TABLE IF NOT EXISTS ranking_scores (
+	tenant    text             NOT NULL,
+	cohort_id text             NOT NULL,
+	version   bigint           NOT NULL,
+	user_id   text             NOT NULL,
+	percent   double precision NOT NULL,
+	at        timestamptz      NOT NULL,
+	PRIMARY KEY (tenant, cohort_id, version)
+)`, `CREATE TABLE IF NOT EXISTS ranking_snapshots (
+	tenant    text        NOT NULL,
+	cohort_id text        NOT NULL,
+	version   bigint      NOT NULL,
+	ranked_at timestamptz NOT NULL,
+	data      jsonb       NOT NULL,
+	PRIMARY KEY (tenant, cohort_id, version)
+)`, `CREATE TABLE IF NOT EXISTS ratings (
+	tenant     text        NOT NULL,
+	cohort_id  text        NOT NULL,
+	version    bigint      NOT NULL,
+	updated_at timestamptz NOT NULL,
+	data       jsonb       NOT NULL,
+	PRIMARY KEY (tenant, cohort_id)
+)`, `CREATE TABLE IF NOT EXISTS digests (
+	tenant     text        NOT NULL,
+	cohort_id  text        NOT NULL,
+	version    bigint      NOT NULL,
+	updated_at timestamptz NOT NULL,
+	data       jsonb       NOT NULL,
+	PRIMARY KEY (tenant, cohort_id)
+)`, `CREATE TABLE IF NOT EXISTS idempotency_keys (
+	tenant     text        NOT NULL,
+	key        text        NOT NULL,
+	expires_at timestamptz NOT NULL,
+	data       jsonb       NOT NULL,
+	PRIMARY KEY (tenant, key)
+)`, `CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at ON idempotency_keys (expires_at)`}
+
+// Postgres is a Store backed by a PostgreSQL table through database/sql.
+// The driver is the caller's choice: open db with any registered Postgres
+// driver (e.g. pgx's "pgx" or lib/pq's "postgres"). Safe for concurrent
+// use, including from several service instances sharing the database.
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres returns a store on db, creating its tables if needed.
+func NewPostgres(ctx context.Context, db *sql.DB) (*Postgres, error) {
+	for _, stmt := range postgresSchema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("create tables: %w", err)
+		}
+	}
+	return &Postgres{db: db}, nil
+}
+
+// document is a Ranking's jsonb form.
+type document struct {
+	Items   []rank.Item   `json:"items"`
+	Options rank.Options  `json:"options"`
+	Results []rank.Result `json:"results"`
+}
+
+func encodeRanking(r Ranking) ([]byte, error) {
+	// Spilling is a property of the server running the ranking, not of
+	// the cohort.
+	r.Options.ExternalSort = nil
+	return json.Marshal(document{Items: r.Items, Options: r.Options, Results: r.Results})
+}
+
+func decodeRanking(data []byte, r *Ranking) error {
+	var d document
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	r.Items, r.Options, r.Results = d.Items, d.Options, d.Results
+	return nil
+}
+
+// recordSnapshot follows a write CTE named "up" returning the new version:
+// it copies the ranking into ranking_snapshots, drops snapshots past
+// MaxSnapshots and drops the scores PutScore kept, which the new ranking
+// replaces, all in the write's statement. $1 and $2 are the tenant and
+// cohort; the snapshot document and the limit are the last two parameters.
+func recordSnapshot(snap, limit int) string {
+	return fmt.Sprintf(`, scores AS (
+			DELETE FROM ranking_scores WHERE tenant = $1 AND cohort_id = $2
+		), snap AS (
+			INSERT INTO ranking_snapshots (tenant, cohort_id, version, ranked_at, data)
+			SELECT $1, $2, version, ranked_at, $%[1]d FROM up
+		), trim AS (
+			DELETE FROM ranking_snapshots
+			WHERE tenant = $1 AND cohort_id = $2 AND version <= (SELECT version FROM up) - $%[2]d
+		)
+		SELECT version FROM up`, snap, limit)
+}
+
+func (p *Postgres) Put(ctx context.Context, tenant string, r Ranking, ifVersion int64) (int64, error) {
+	data, err := encodeRanking(r)
+	if err != nil {
+		return 0, err
+	}
+	snap, err := encodeRanking(snapshot(r))
+	if err != nil {
+		return 0, err
+	}
+	var v int64
+	if ifVersion == 0 {
+		// The upsert is atomic, so concurrent writers still get
+		// consecutive versions.
+		err = p.db.QueryRowContext(ctx, `WITH up AS (
+			INSERT INTO rankings (tenant, cohort_id, version, ranked_at, data)
+			VALUES ($1, $2, 1, $3, $4)
+			ON CONFLICT (tenant, cohort_id) DO UPDATE
+			SET version = rankings.version + 1, ranked_at = EXCLUDED.ranked_at, data = EXCLUDED.data
+			RETURNING version, ranked_at
+		)`+recordSnapshot(5, 6), tenant, r.CohortID, r.RankedAt, data, snap, MaxSnapshots).Scan(&v)
+		return v, err
+	}
+	if ifVersion == IfAbsent {
+		err = p.db.QueryRowContext(ctx, `WITH up AS (
+			INSERT INTO rankings (tenant, cohort_id, version, ranked_at, data)
+			VALUES ($1, $2, 1, $3, $4)
+			ON CONFLICT (tenant, cohort_id) DO NOTHING
+			RETURNING version, ranked_at
+		)`+recordSnapshot(5, 6), tenant, r.CohortID, r.RankedAt, data, snap, MaxSnapshots).Scan(&v)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrVersionConflict
+		}
+		return v, err
+	}
+	err = p.db.QueryRowContext(ctx, `WITH up AS (
+			UPDATE rankings
+			SET version = version + 1, ranked_at = $4, data = $5
+			WHERE tenant = $1 AND cohort_id = $2 AND version = $3
+			RETURNING version, ranked_at
+		)`+recordSnapshot(6, 7), tenant, r.CohortID, ifVersion, r.RankedAt, data, snap, MaxSnapshots).Scan(&v)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return v, err
+	}
+	return 0, p.missedWrite(ctx, "rankings", tenant, r.CohortID)
+}
+
+// missedWrite tells why a conditional write to table matched no row:
+// ErrVersionConflict if the cohort is there, ErrNotFound if not.
+func (p *Postgres) missedWrite(ctx context.Context, table, tenant, cohortID string) error {
+	var exists bool
+	if err := p.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+table+` WHERE tenant = $1 AND cohort_id = $2)`, tenant, cohortID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrNotFound
+}
+
+// pendingScoresSQL selects a rankings row's kept scores as a JSON array
+// of pendingScores, oldest first, so they are read in the row's own
+// statement.
+const pendingScoresSQL = `(SELECT coalesce(json_agg(json_build_object('user_id', s.user_id, 'percent', s.percent, 'at', s.at) ORDER BY s.version), '[]')
+	FROM ranking_scores s WHERE s.tenant = rankings.tenant AND s.cohort_id = rankings.cohort_id)`
+
+func (p *Postgres) Get(ctx context.Context, tenant, cohortID string) (Ranking, error) {
+	r, pending, err := p.get(ctx, p.db, tenant, cohortID)
+	if err != nil {
+		return Ranking{}, err
+	}
+	if err := fold(&r, pending); err != nil {
+		return Ranking{}, err
+	}
+	return r, nil
+}
+
+// get reads the stored ranking and its kept scores through q, the
+// database or a transaction.
+func (p *Postgres) get(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, tenant, cohortID string) (Ranking, []pendingScore, error) {
+	r := Ranking{CohortID: cohortID}
+	var data, scores []byte
+	err := q.QueryRowContext(ctx, `SELECT version, ranked_at, data, `+pendingScoresSQL+` FROM rankings WHERE tenant = $1 AND cohort_id = $2`,
+		tenant, cohortID).Scan(&r.Version, &r.RankedAt, &data, &scores)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Ranking{}, nil, ErrNotFound
+	}
+	if err != nil {
+		return Ranking{}, nil, err
+	}
+	if err := decodeRanking(data, &r); err != nil {
+		return Ranking{}, nil, fmt.Errorf("cohort %q: %w", cohortID, err)
+	}
+	var pending []pendingScore
+	if err := json.Unmarshal(scores, &pending); err != nil {
+		return Ranking{}, nil, fmt.Errorf("cohort %q scores: %w", cohortID, err)
+	}
+	r.RankedAt = r.RankedAt.UTC()
+	return r, pending, nil
+}
+
+func (p *Postgres) PutScore(ctx context.Context, tenant, cohortID string, sc rank.Score, at time.Time, ifVersion int64) (int64, error) {
+	var v, kept int64
+	err := p.db.QueryRowContext(ctx, `WITH up AS (
+			UPDATE rankings SET version = version + 1
+			WHERE tenant = $1 AND cohort_id = $2 AND ($3 = 0 OR version = $3)
+			RETURNING version
+		), score AS (
+			INSERT INTO ranking_scores (tenant, cohort_id, version, user_id, percent, at)
+			SELECT $1, $2, version, $4::text, $5::double precision, $6::timestamptz FROM up
+		)
+		SELECT version, (SELECT count(*) FROM ranking_scores WHERE tenant = $1 AND cohort_id = $2) + 1 FROM up`,
+		tenant, cohortID, ifVersion, sc.UserID, sc.Percent, at).Scan(&v, &kept)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, p.missedWrite(ctx, "rankings", tenant, cohortID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if kept >= MaxPendingScores {
+		// The score is stored either way; a fold that fails is tried
+		// again by the next PutScore.
+		p.foldScores(ctx, tenant, cohortID)
+	}
+	return v, nil
+}
+
+// foldScores folds the cohort's kept scores into its stored ranking. The
+// version is unchanged: Get already returned the folded ranking under it.
+func (p *Postgres) foldScores(ctx context.Context, tenant, cohortID string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Locking the row holds off PutScore; the read after it, a statement
+	// of its own, sees every score committed before.
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM rankings WHERE tenant = $1 AND cohort_id = $2 FOR UPDATE`, tenant, cohortID); err != nil {
+		return err
+	}
+	r, pending, err := p.get(ctx, tx, tenant, cohortID)
+	if err != nil {
+		return err
+	}
+	if err := fold(&r, pending); err != nil {
+		return err
+	}
+	data, err := encodeRanking(r)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE rankings SET ranked_at = $3, data = $4 WHERE tenant = $1 AND cohort_id = $2`,
+		tenant, cohortID, r.RankedAt, data); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ranking_scores WHERE tenant = $1 AND cohort_id = $2 AND version <= $3`,
+		tenant, cohortID, r.Version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *Postgres) History(ctx context.Context, tenant, cohortID string, from, to time.Time) ([]Ranking, error) {
+	bound := func(t time.Time) sql.NullTime { return sql.NullTime{Time: t, Valid: !t.IsZero()} }
+	rows, err := p.db.QueryContext(ctx, `SELECT version, ranked_at, data FROM ranking_snapshots
+		WHERE tenant = $1 AND cohort_id = $2
+		AND ($3::timestamptz IS NULL OR ranked_at >= $3) AND ($4::timestamptz IS NULL OR ranked_at <= $4)
+		ORDER BY version`, tenant, cohortID, bound(from), bound(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Ranking
+	for rows.Next() {
+		r := Ranking{CohortID: cohortID}
+		var data []byte
+		if err := rows.Scan(&r.Version, &r.RankedAt, &data); err != nil {
+			return nil, err
+		}
+		if err := decodeRanking(data, &r); err != nil {
+			return nil, fmt.Errorf("cohort %q version %d: %w", cohortID, r.Version, err)
+		}
+		r.RankedAt = r.RankedAt.UTC()
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		var exists bool
+		if err := p.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM rankings WHERE tenant = $1 AND cohort_id = $2)`, tenant, cohortID).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrNotFound
+		}
+	}
+	return out, nil
+}
+
+// ratingsDocument is a Ratings' jsonb form.
+type ratingsDocument struct {
+	System  string          `json:"system"`
+	Players []rating.Player `json:"players"`
+}
+
+func (p *Postgres) PutRatings(ctx context.Context, tenant string, r Ratings, ifVersion int64) (int64, error) {
+	data, err := json.Marshal(ratingsDocument{System: r.System, Players: r.Players})
+	if err != nil {
+		return 0, err
+	}
+	return p.putDocument(ctx, "ratings", tenant, r.CohortID, r.UpdatedAt, data, ifVersion)
+}
+
+func (p *Postgres) GetRatings(ctx context.Context, tenant, cohortID string) (Ratings, error) {
+	r := Ratings{CohortID: cohortID}
+	data, err := p.getDocument(ctx, "ratings", tenant, cohortID, &r.Version, &r.UpdatedAt)
+	if err != nil {
+		return Ratings{}, err
+	}
+	var d ratingsDocument
+	if err := json.Unmarshal(data, &d); err != nil {
+		return Ratings{}, fmt.Errorf("ratings %q: %w", cohortID, err)
+	}
+	r.System, r.Players = d.System, d.Players
+	return r, nil
+}
+
+func (p *Postgres) PutDigest(ctx context.Context, tenant string, d Digest, ifVersion int64) (int64, error) {
+	data, err := json.Marshal(d.Digest)
+	if err != nil {
+		return 0, err
+	}
+	return p.putDocument(ctx, "digests", tenant, d.CohortID, d.UpdatedAt, data, ifVersion)
+}
+
+func (p *Postgres) GetDigest(ctx context.Context, tenant, cohortID string) (Digest, error) {
+	d := Digest{CohortID: cohortID}
+	data, err := p.getDocument(ctx, "digests", tenant, cohortID, &d.Version, &d.UpdatedAt)
+	if err != nil {
+		return Digest{}, err
+	}
+	if err := json.Unmarshal(data, &d.Digest); err != nil {
+		return Digest{}, fmt.Errorf("digest %q: %w", cohortID, err)
+	}
+	return d, nil
+}
+
+// putDocument is Put for the tables keyed like ratings, which keep one
+// versioned jsonb document per cohort.
+func (p *Postgres) putDocument(ctx context.Context, table, tenant, cohortID string, updatedAt time.Time, data []byte, ifVersion int64) (int64, error) {
+	var v int64
+	if ifVersion == 0 {
+		err := p.db.QueryRowContext(ctx, `INSERT INTO `+table+` (tenant, cohort_id, version, updated_at, data)
+			VALUES ($1, $2, 1, $3, $4)
+			ON CONFLICT (tenant, cohort_id) DO UPDATE
+			SET version = `+table+`.version + 1, updated_at = EXCLUDED.updated_at, data = EXCLUDED.data
+			RETURNING version`, tenant, cohortID, updatedAt, data).Scan(&v)
+		return v, err
+	}
+	err := p.db.QueryRowContext(ctx, `UPDATE `+table+`
+		SET version = version + 1, updated_at = $4, data = $5
+		WHERE tenant = $1 AND cohort_id = $2 AND version = $3
+		RETURNING version`, tenant, cohortID, ifVersion, updatedAt, data).Scan(&v)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return v, err
+	}
+	return 0, p.missedWrite(ctx, table, tenant, cohortID)
+}
+
+// getDocument reads a putDocument row, ErrNotFound if there is none.
+func (p *Postgres) getDocument(ctx context.Context, table, tenant, cohortID string, version *int64, updatedAt *time.Time) ([]byte, error) {
+	var data []byte
+	err := p.db.QueryRowContext(ctx, `SELECT version, updated_at, data FROM `+table+` WHERE tenant = $1 AND cohort_id = $2`,
+		tenant, cohortID).Scan(version, updatedAt, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	*updatedAt = updatedAt.UTC()
+	return data, nil
+}
+
+// idempotencyDocument is an Idempotency's JSON form, in Postgres and
+// Redis.
+type idempotencyDocument struct {
+	Key     string              `json:"key"`
+	Request string              `json:"request"`
+	Done    bool                `json:"done"`
+	Status  int                 `json:"status,omitempty"`
+	Header  map[string][]string `json:"header,omitempty"`
+	Body    []byte              `json:"body,omitempty"`
+	Expires time.Time           `json:"expires"`
+}
+
+func encodeIdempotency(rec Idempotency) ([]byte, error) {
+	return json.Marshal(idempotencyDocument(rec))
+}
+
+func decodeIdempotency(data []byte) (Idempotency, error) {
+	var d idempotencyDocument
+	if err := json.Unmarshal(data, &d); err != nil {
+		return Idempotency{}, fmt.Errorf("idempotency record: %w", err)
+	}
+	return Idempotency(d), nil
+}
+
+func (p *Postgres) ClaimIdempotency(ctx context.Context, tenant string, rec Idempotency) (Idempotency, bool, error) {
+	data, err := encodeIdempotency(rec)
+	if err != nil {
+		return Idempotency{}, false, err
+	}
+	now := time.Now()
+	// Expired records of every tenant go as keys are claimed; the index
+	// on expires_at keeps this cheap.
+	if _, err := p.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now); err != nil {
+		return Idempotency{}, false, err
+	}
+	res, err := p.db.ExecContext(ctx, `INSERT INTO idempotency_keys (tenant, key, expires_at, data)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant, key) DO UPDATE
+		SET expires_at = EXCLUDED.expires_at, data = EXCLUDED.data
+		WHERE idempotency_keys.expires_at <= $5`, tenant, rec.Key, rec.Expires, data, now)
+	if err != nil {
+		return Idempotency{}, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return rec, err == nil, err
+	}
+	err = p.db.QueryRowContext(ctx, `SELECT data FROM idempotency_keys WHERE tenant = $1 AND key = $2`, tenant, rec.Key).Scan(&data)
+	if err != nil {
+		return Idempotency{}, false, err
+	}
+	cur, err := decodeIdempotency(data)
+	return cur, false, err
+}
+
+func (p *Postgres) PutIdempotency(ctx context.Context, tenant string, rec Idempotency) error {
+	data, err := encodeIdempotency(rec)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `INSERT INTO idempotency_keys (tenant, key, expires_at, data)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant, key) DO UPDATE
+		SET expires_at = EXCLUDED.expires_at, data = EXCLUDED.data`, tenant, rec.Key, rec.Expires, data)
+	return err
+}
+
+func (p *Postgres) DeleteIdempotency(ctx context.Context, tenant, key string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE tenant = $1 AND key = $2`, tenant, key)
+	return err
+}
+
+func (p *Postgres) Ping(ctx context.Context) error { return p.db.PingContext(ctx) }
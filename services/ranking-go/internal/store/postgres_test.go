@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"ranking-go/internal/rank"
+)
+
+func TestRankingDocumentRoundTrip(t *testing.T) {
+	prec, arrival, seed := 2, 3.0, int64(9)
+	items := []rank.Item{{UserID: "a", Percent: 81.5, Tier: "Gold", Metrics: map[string]float64{"exam": 7}, Arrival: &arrival, Weight: 2}, {UserID: "b", Percent: 60, Tier: "Gold", Metrics: map[string]float64{"exam": 5}}}
+	opts := rank.Options{
+		TierOrder:    []string{"Gold"},
+		TiePrecision: &prec,
+		TieBreak:     []rank.TieBreakKey{{Metric: "exam", Desc: true}},
+		ShuffleSeed:  &seed,
+		Strategy:     rank.StrategyDense,
+		Anchors:      []rank.Anchor{{Score: 0, Percentile: 0}, {Score: 100, Percentile: 100}},
+		ExternalSort: &rank.ExternalSort{Threshold: 10, Dir: "/tmp"},
+	}
+	results, err := rank.Rank(items, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := Ranking{Items: items, Options: opts, Results: results}
+	data, err := encodeRanking(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Ranking
+	if err := decodeRanking(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Options.ExternalSort = nil // not persisted
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", out, in)
+	}
+}
+
+// TestPostgres runs against a real database when POSTGRES_TEST_DSN is set
+// and the test binary links a driver registered as POSTGRES_TEST_DRIVER
+// (default "pgx").
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+	driver := os.Getenv("POSTGRES_TEST_DRIVER")
+	if driver == "" {
+		driver = "pgx"
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Skipf("open: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	p, err := NewPostgres(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenant := "test-" + time.Now().Format("150405.000000000")
+	defer db.ExecContext(ctx, `DELETE FROM rankings WHERE tenant = $1`, tenant)
+	defer db.ExecContext(ctx, `DELETE FROM ranking_snapshots WHERE tenant = $1`, tenant)
+	defer db.ExecContext(ctx, `DELETE FROM rankings WHERE tenant = $1`, tenant+"-scores")
+	defer db.ExecContext(ctx, `DELETE FROM ranking_scores WHERE tenant = $1`, tenant+"-scores")
+	defer db.ExecContext(ctx, `DELETE FROM ranking_snapshots WHERE tenant = $1`, tenant+"-scores")
+	defer db.ExecContext(ctx, `DELETE FROM ratings WHERE tenant = $1`, tenant+"-ratings")
+	defer db.ExecContext(ctx, `DELETE FROM digests WHERE tenant = $1`, tenant+"-digests")
+	defer db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE tenant LIKE $1`, tenant+"-idem%")
+
+	if _, err := p.Get(ctx, tenant, "c"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get missing: %v, want ErrNotFound", err)
+	}
+	if _, err := p.Put(ctx, tenant, Ranking{CohortID: "c"}, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("conditional put on missing cohort: %v, want ErrNotFound", err)
+	}
+	r := Ranking{CohortID: "c", Items: []rank.Item{{UserID: "a", Percent: 1}}, Results: rank.RankByPercent([]rank.Item{{UserID: "a", Percent: 1}}), RankedAt: time.Now().UTC().Truncate(time.Microsecond)}
+	for want := int64(1); want <= 2; want++ {
+		if v, err := p.Put(ctx, tenant, r, 0); err != nil || v != want {
+			t.Fatalf("put: version %d, err %v; want %d", v, err, want)
+		}
+	}
+	if _, err := p.Put(ctx, tenant, r, 1); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale put: %v, want ErrVersionConflict", err)
+	}
+	if _, err := p.Put(ctx, tenant, r, IfAbsent); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("create over stored cohort: %v, want ErrVersionConflict", err)
+	}
+	if v, err := p.Put(ctx, tenant, Ranking{CohortID: "new", RankedAt: r.RankedAt}, IfAbsent); err != nil || v != 1 {
+		t.Errorf("create: version %d, err %v; want 1", v, err)
+	}
+	if v, err := p.Put(ctx, tenant, r, 2); err != nil || v != 3 {
+		t.Errorf("current put: version %d, err %v; want 3", v, err)
+	}
+	got, err := p.Get(ctx, tenant, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Version = 3
+	if !reflect.DeepEqual(got, r) {
+		t.Errorf("get:\n got %+v\nwant %+v", got, r)
+	}
+	hist, err := p.History(ctx, tenant, "c", time.Time{}, time.Time{})
+	if err != nil || len(hist) != 3 || hist[2].Version != 3 || hist[2].Items != nil {
+		t.Errorf("history: %+v, %v", hist, err)
+	}
+	if _, err := p.History(ctx, tenant, "missing", time.Time{}, time.Time{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("history of missing cohort: %v, want ErrNotFound", err)
+	}
+	testScores(t, p, tenant+"-scores")
+	testRatings(t, p, tenant+"-ratings")
+	testDigests(t, p, tenant+"-digests")
+	testIdempotency(t, p, tenant+"-idem")
+	if err := p.Ping(ctx); err != nil {
+		t.Errorf("ping: %v", err)
+	}
+}
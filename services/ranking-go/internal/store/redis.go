@@ -0,0 +1,1021 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ranking-go/internal/rank"
+)
+
+// Redis is a Store backed by Redis, so rankings survive restarts and are
+// shared by every replica pointing at the same server. Each cohort is a
+// hash (version, ranked_at and the ranking as a JSON document, as in
+// Postgres) plus a sorted set of its user_ids, best first, which other
+// services can page with ZRANGE without decoding the document, a list of
+// the scores PutScore kept since, and a list of its last MaxSnapshots
+// snapshots. The sorted set is scored by rank, except under incremental
+// options (see rank.Options.Incremental), where it is scored by negated
+// percent: ZRANGE orders those ties by user_id, just as Rank does, so a
+// score update moves one member. Page reads those cohorts straight off
+// the sorted set, with the options and score moments kept in the hash;
+// other cohorts also keep their results in order and each user's
+// position (see redisRowsKeys). Rating tables are hashes of their own,
+// and idempotency records strings that expire with their keys.
+//
+// It speaks RESP itself, so no client library is needed, over a pool of
+// up to pool_size connections (a query parameter of the URL, default
+// 10). A command takes whichever connection is idle; only a
+// WATCH/MULTI/EXEC transaction holds one for its length. Writes are such
+// transactions, so versions stay consistent across replicas.
+type Redis struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+
+	// idle holds the open connections not in use; open holds a token for
+	// every open connection, in use or not, and its capacity is the pool
+	// size.
+	idle chan *redisConn
+	open chan struct{}
+}
+
+// redisConn is one connection of the pool.
+type redisConn struct {
+	conn    net.Conn
+	rd      *bufio.Reader
+	timeout time.Duration
+}
+
+// defaultRedisPoolSize is the pool size when the URL doesn't set one.
+const defaultRedisPoolSize = 10
+
+// redisNil is a nil bulk or array reply.
+var redisNil = errors.New("redis: nil")
+
+// NewRedis parses a redis://[:password@]host[:port][/db][?pool_size=n]
+// URL. Connections are opened as they are needed.
+func NewRedis(rawURL string) (*Redis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("redis url: scheme must be redis, got %q", u.Scheme)
+	}
+	r := &Redis{addr: u.Host, timeout: 5 * time.Second}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if pw, ok := u.User.Password(); ok {
+		r.password = pw
+	}
+	if p := strings.TrimPrefix(u.Path, "/"); p != "" {
+		if r.db, err = strconv.Atoi(p); err != nil {
+			return nil, fmt.Errorf("redis url: bad db %q", p)
+		}
+	}
+	size := defaultRedisPoolSize
+	if v := u.Query().Get("pool_size"); v != "" {
+		if size, err = strconv.Atoi(v); err != nil || size < 1 {
+			return nil, fmt.Errorf("redis url: bad pool_size %q", v)
+		}
+	}
+	r.idle, r.open = make(chan *redisConn, size), make(chan struct{}, size)
+	return r, nil
+}
+
+func redisKeys(tenant, cohortID string) (hash, zset string) {
+	// Tenant and cohort IDs are quoted so neither can forge the other's key.
+	base := "ranking:" + strconv.Quote(tenant) + ":" + strconv.Quote(cohortID)
+	return base, base + ":ranks"
+}
+
+// redisRatingsKey is a cohort's rating table: a hash of version,
+// updated_at and the table as JSON, as in Postgres.
+func redisRatingsKey(tenant, cohortID string) string {
+	return "ratings:" + strconv.Quote(tenant) + ":" + strconv.Quote(cohortID)
+}
+
+// redisDigestKey is a cohort's score digest, stored like its ratings.
+func redisDigestKey(tenant, cohortID string) string {
+	return "digest:" + strconv.Quote(tenant) + ":" + strconv.Quote(cohortID)
+}
+
+// redisIdempotencyKey is an Idempotency-Key's record, a string of JSON
+// that expires with it.
+func redisIdempotencyKey(tenant, key string) string {
+	return "idempotency:" + strconv.Quote(tenant) + ":" + strconv.Quote(key)
+}
+
+// redisScoresKey is the list of scores PutScore kept, as JSON
+// pendingScores, oldest first.
+func redisScoresKey(tenant, cohortID string) string {
+	hash, _ := redisKeys(tenant, cohortID)
+	return hash + ":scores"
+}
+
+// zscore is what user's member of a cohort's sorted set is scored by.
+func zscore(opts rank.Options, res rank.Result) string {
+	if opts.Incremental() {
+		return strconv.FormatFloat(-res.Percent, 'g', -1, 64)
+	}
+	return strconv.Itoa(res.Rank)
+}
+
+// redisRowsKeys are where a cohort ranked under options that aren't
+// incremental keeps what Page reads: its results in order, as a list of
+// JSON, and a hash of each user's position in it.
+func redisRowsKeys(tenant, cohortID string) (rows, index string) {
+	hash, _ := redisKeys(tenant, cohortID)
+	return hash + ":rows", hash + ":index"
+}
+
+// redisHistoryKey is the cohort's snapshot list, oldest first.
+func redisHistoryKey(tenant, cohortID string) string {
+	hash, _ := redisKeys(tenant, cohortID)
+	return hash + ":history"
+}
+
+// redisSnapshot is one history list element.
+type redisSnapshot struct {
+	Version  int64           `json:"version"`
+	RankedAt time.Time       `json:"ranked_at"`
+	Ranking  json.RawMessage `json:"ranking"`
+}
+
+func (r *Redis) Put(ctx context.Context, tenant string, rk Ranking, ifVersion int64) (int64, error) {
+	data, err := encodeRanking(rk)
+	if err != nil {
+		return 0, err
+	}
+	snap, err := encodeRanking(snapshot(rk))
+	if err != nil {
+		return 0, err
+	}
+	hash, zset := redisKeys(tenant, rk.CohortID)
+	rows, index := redisRowsKeys(tenant, rk.CohortID)
+	history := redisHistoryKey(tenant, rk.CohortID)
+	zadd := []string{"ZADD", zset}
+	for _, res := range rk.Results {
+		zadd = append(zadd, zscore(rk.Options, res), res.UserID)
+	}
+	paging, err := pageCommands(rk, hash, rows, index)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.versionedWrite(ctx, hash, ifVersion, func(_ *redisConn, v int64) ([][]string, error) {
+		cmds := [][]string{
+			{"HSET", hash, "version", strconv.FormatInt(v, 10), "ranked_at", rk.RankedAt.Format(time.RFC3339Nano), "data", string(data)},
+			{"DEL", zset},
+			{"DEL", redisScoresKey(tenant, rk.CohortID)},
+			{"DEL", rows},
+			{"DEL", index},
+		}
+		if len(rk.Results) > 0 {
+			cmds = append(cmds, zadd)
+		}
+		cmds = append(cmds, paging...)
+		entry, err := json.Marshal(redisSnapshot{Version: v, RankedAt: rk.RankedAt, Ranking: snap})
+		if err != nil {
+			return nil, err
+		}
+		return append(cmds,
+			[]string{"RPUSH", history, string(entry)},
+			[]string{"LTRIM", history, strconv.Itoa(-MaxSnapshots), "-1"}), nil
+	})
+}
+
+// pageCommands store what Page needs of rk beside its document, in rows
+// and index once cleared: its options, and then under incremental
+// options the moments of its scores, since the sorted set holds the rest;
+// under others its item count, its results in order, and each user's
+// position.
+func pageCommands(rk Ranking, hash, rows, index string) ([][]string, error) {
+	opts := rk.Options
+	opts.ExternalSort = nil
+	o, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Incremental() {
+		var m rank.Moments
+		for _, res := range rk.Results {
+			m.Add(res.Percent)
+		}
+		mb, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		return [][]string{{"HSET", hash, "options", string(o), "moments", string(mb)}}, nil
+	}
+	cmds := [][]string{{"HSET", hash, "options", string(o), "items", strconv.Itoa(len(rk.Items))}, {"HDEL", hash, "moments"}}
+	if len(rk.Results) == 0 {
+		return cmds, nil
+	}
+	rpush, hset := []string{"RPUSH", rows}, []string{"HSET", index}
+	for i, res := range rk.Results {
+		b, err := json.Marshal(res)
+		if err != nil {
+			return nil, err
+		}
+		rpush = append(rpush, string(b))
+		hset = append(hset, res.UserID, strconv.Itoa(i))
+	}
+	return append(cmds, rpush, hset), nil
+}
+
+// versionedWrite runs the commands write returns for the next version in
+// a MULTI, conditional on hash's version field as Store.Put describes,
+// and returns the new version. write must set the version field; it may
+// read with c, which is watching hash.
+func (r *Redis) versionedWrite(ctx context.Context, hash string, ifVersion int64, write func(c *redisConn, v int64) ([][]string, error)) (int64, error) {
+	var out int64
+	err := r.withConn(ctx, func(c *redisConn) error {
+		// EXEC fails only when another client wrote the key between WATCH
+		// and EXEC; an unconditional write just tries again.
+		for {
+			if _, err := c.do(ctx, "WATCH", hash); err != nil {
+				return err
+			}
+			cur, err := c.do(ctx, "HGET", hash, "version")
+			var v int64
+			switch {
+			case errors.Is(err, redisNil):
+			case err != nil:
+				return err
+			default:
+				if v, err = strconv.ParseInt(cur.(string), 10, 64); err != nil {
+					return fmt.Errorf("redis: bad version %q", cur)
+				}
+			}
+			if ifVersion == IfAbsent && v != 0 {
+				return ErrVersionConflict
+			}
+			if ifVersion > 0 && v != ifVersion {
+				if v == 0 {
+					return ErrNotFound
+				}
+				return ErrVersionConflict
+			}
+			cmds, err := write(c, v+1)
+			if err != nil {
+				return err
+			}
+			_, err = c.transact(ctx, cmds...)
+			if err == nil {
+				out = v + 1
+				return nil
+			}
+			if !errors.Is(err, redisNil) {
+				return err
+			}
+			if ifVersion != 0 {
+				return ErrVersionConflict
+			}
+		}
+	})
+	return out, err
+}
+
+func (r *Redis) Get(ctx context.Context, tenant, cohortID string) (Ranking, error) {
+	out, pending, err := r.get(ctx, tenant, cohortID)
+	if err != nil {
+		return Ranking{}, err
+	}
+	if err := fold(&out, pending); err != nil {
+		return Ranking{}, err
+	}
+	return out, nil
+}
+
+// get reads the stored ranking and its kept scores in one transaction.
+func (r *Redis) get(ctx context.Context, tenant, cohortID string) (Ranking, []pendingScore, error) {
+	hash, _ := redisKeys(tenant, cohortID)
+	var reply []any
+	err := r.withConn(ctx, func(c *redisConn) error {
+		var err error
+		reply, err = c.transact(ctx,
+			[]string{"HMGET", hash, "version", "ranked_at", "data"},
+			[]string{"LRANGE", redisScoresKey(tenant, cohortID), "0", "-1"})
+		return err
+	})
+	if err != nil {
+		return Ranking{}, nil, err
+	}
+	return decodeRedisRanking(cohortID, reply[0], reply[1])
+}
+
+// decodeRedisRanking decodes the replies to HMGET of a cohort's version,
+// ranked_at and data, and to LRANGE of its kept scores.
+func decodeRedisRanking(cohortID string, fields, scores any) (Ranking, []pendingScore, error) {
+	f, _ := fields.([]any)
+	if len(f) != 3 || f[0] == nil {
+		return Ranking{}, nil, ErrNotFound
+	}
+	out := Ranking{CohortID: cohortID}
+	v, _ := f[0].(string)
+	at, _ := f[1].(string)
+	data, _ := f[2].(string)
+	var err error
+	if out.Version, err = strconv.ParseInt(v, 10, 64); err != nil {
+		return Ranking{}, nil, fmt.Errorf("cohort %q: bad version %q", cohortID, v)
+	}
+	if out.RankedAt, err = time.Parse(time.RFC3339Nano, at); err != nil {
+		return Ranking{}, nil, fmt.Errorf("cohort %q: %w", cohortID, err)
+	}
+	if err := decodeRanking([]byte(data), &out); err != nil {
+		return Ranking{}, nil, fmt.Errorf("cohort %q: %w", cohortID, err)
+	}
+	list, _ := scores.([]any)
+	pending := make([]pendingScore, len(list))
+	for i, sc := range list {
+		raw, _ := sc.(string)
+		if err := json.Unmarshal([]byte(raw), &pending[i]); err != nil {
+			return Ranking{}, nil, fmt.Errorf("cohort %q scores: %w", cohortID, err)
+		}
+	}
+	return out, pending, nil
+}
+
+func (r *Redis) PutScore(ctx context.Context, tenant, cohortID string, sc rank.Score, at time.Time, ifVersion int64) (int64, error) {
+	hash, zset := redisKeys(tenant, cohortID)
+	scores := redisScoresKey(tenant, cohortID)
+	entry, err := json.Marshal(pendingScore{UserID: sc.UserID, Percent: sc.Percent, At: at})
+	if err != nil {
+		return 0, err
+	}
+	v, err := r.versionedWrite(ctx, hash, ifVersion, func(c *redisConn, v int64) ([][]string, error) {
+		if v == 1 {
+			return nil, ErrNotFound
+		}
+		set := []string{"HSET", hash, "version", strconv.FormatInt(v, 10)}
+		m, err := c.movedMoments(ctx, hash, zset, sc)
+		if err != nil {
+			return nil, err
+		}
+		if m != "" {
+			set = append(set, "moments", m)
+		}
+		return [][]string{
+			set,
+			{"ZADD", zset, strconv.FormatFloat(-sc.Percent, 'g', -1, 64), sc.UserID},
+			{"RPUSH", scores, string(entry)},
+		}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// The score is stored either way; a fold that fails is tried again by
+	// the next PutScore.
+	r.withConn(ctx, func(c *redisConn) error {
+		n, err := c.do(ctx, "LLEN", scores)
+		if kept, _ := n.(int64); err != nil || kept < MaxPendingScores {
+			return err
+		}
+		return c.foldScores(ctx, tenant, cohortID)
+	})
+	return v, nil
+}
+
+// movedMoments returns the cohort's moments, as JSON, with sc's user
+// moved to sc's percent, or "" if the cohort keeps none (see
+// pageCommands); c must be watching hash.
+func (c *redisConn) movedMoments(ctx context.Context, hash, zset string, sc rank.Score) (string, error) {
+	raw, err := c.do(ctx, "HGET", hash, "moments")
+	if errors.Is(err, redisNil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var m rank.Moments
+	if err := json.Unmarshal([]byte(raw.(string)), &m); err != nil {
+		return "", fmt.Errorf("%s moments: %w", hash, err)
+	}
+	old, err := c.do(ctx, "ZSCORE", zset, sc.UserID)
+	switch {
+	case errors.Is(err, redisNil):
+	case err != nil:
+		return "", err
+	default:
+		z, err := strconv.ParseFloat(old.(string), 64)
+		if err != nil {
+			return "", fmt.Errorf("%s: bad score %q", zset, old)
+		}
+		m.Remove(-z)
+	}
+	m.Add(sc.Percent)
+	b, err := json.Marshal(m)
+	return string(b), err
+}
+
+// foldScores folds the cohort's kept scores into its stored ranking,
+// unless another write gets in first. The version is unchanged: Get
+// already returned the folded ranking under it. The moments PutScore kept
+// in step are recomputed, so rounding never builds up.
+func (c *redisConn) foldScores(ctx context.Context, tenant, cohortID string) error {
+	hash, _ := redisKeys(tenant, cohortID)
+	rows, index := redisRowsKeys(tenant, cohortID)
+	scores := redisScoresKey(tenant, cohortID)
+	if _, err := c.do(ctx, "WATCH", hash, scores); err != nil {
+		return err
+	}
+	rk, kept, err := c.readFolded(ctx, cohortID, hash, scores)
+	if err != nil {
+		return err
+	}
+	data, err := encodeRanking(rk)
+	if err != nil {
+		return err
+	}
+	paging, err := pageCommands(rk, hash, rows, index)
+	if err != nil {
+		return err
+	}
+	cmds := [][]string{
+		{"HSET", hash, "ranked_at", rk.RankedAt.Format(time.RFC3339Nano), "data", string(data)},
+		{"LTRIM", scores, strconv.Itoa(kept), "-1"},
+		{"DEL", rows},
+		{"DEL", index},
+	}
+	_, err = c.transact(ctx, append(cmds, paging...)...)
+	return err
+}
+
+// readFolded reads the ranking at hash with the kept scores at scores
+// folded in, and how many scores there were.
+func (c *redisConn) readFolded(ctx context.Context, cohortID, hash, scores string) (Ranking, int, error) {
+	fields, err := c.do(ctx, "HMGET", hash, "version", "ranked_at", "data")
+	if err != nil {
+		return Ranking{}, 0, err
+	}
+	list, err := c.do(ctx, "LRANGE", scores, "0", "-1")
+	if err != nil {
+		return Ranking{}, 0, err
+	}
+	rk, pending, err := decodeRedisRanking(cohortID, fields, list)
+	if err != nil {
+		return Ranking{}, 0, err
+	}
+	return rk, len(pending), fold(&rk, pending)
+}
+
+// transact runs cmds in one MULTI and returns their replies. A WATCH set
+// before makes it fail with redisNil if a watched key changed.
+func (c *redisConn) transact(ctx context.Context, cmds ...[]string) ([]any, error) {
+	for _, cmd := range append([][]string{{"MULTI"}}, cmds...) {
+		if _, err := c.do(ctx, cmd...); err != nil {
+			c.do(ctx, "DISCARD")
+			return nil, err
+		}
+	}
+	reply, err := c.do(ctx, "EXEC")
+	if err != nil {
+		return nil, err
+	}
+	return reply.([]any), nil
+}
+
+// Page reads positions [from, to) of the cohort off its sorted set, and
+// under options that aren't incremental off its stored rows.
+func (r *Redis) Page(ctx context.Context, tenant, cohortID string, from, to int) (Page, error) {
+	var out Page
+	err := r.withConn(ctx, func(c *redisConn) error {
+		var err error
+		out, err = c.readPage(ctx, tenant, cohortID, from, to)
+		return err
+	})
+	return out, err
+}
+
+func (r *Redis) PageAround(ctx context.Context, tenant, cohortID, userID string, window int) (Page, error) {
+	hash, zset := redisKeys(tenant, cohortID)
+	_, index := redisRowsKeys(tenant, cohortID)
+	var out Page
+	err := r.withConn(ctx, func(c *redisConn) error {
+		// The user's position is read under WATCH, so the page read after
+		// it fails if the cohort changed in between; then start over.
+		for {
+			if _, err := c.do(ctx, "WATCH", hash); err != nil {
+				return err
+			}
+			i, err := c.position(ctx, zset, index, userID)
+			if err != nil {
+				return err
+			}
+			from, to := max(i-window, 0), i+window+1
+			if i < 0 {
+				// Read nothing, to tell a missing user from a missing
+				// cohort.
+				from, to = 0, 0
+			}
+			out, err = c.readPage(ctx, tenant, cohortID, from, to)
+			switch {
+			case errors.Is(err, redisNil):
+				continue
+			case err == nil && i < 0:
+				return ErrUserNotFound
+			}
+			return err
+		}
+	})
+	return out, err
+}
+
+// position returns userID's position in the cohort, -1 if absent: from
+// index, which only cohorts under options that aren't incremental keep,
+// or else from the sorted set.
+func (c *redisConn) position(ctx context.Context, zset, index, userID string) (int, error) {
+	reply, err := c.do(ctx, "HGET", index, userID)
+	if err == nil {
+		s, _ := reply.(string)
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("%s: bad position %q", index, s)
+		}
+		return i, nil
+	}
+	if !errors.Is(err, redisNil) {
+		return 0, err
+	}
+	reply, err = c.do(ctx, "ZRANK", zset, userID)
+	if errors.Is(err, redisNil) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	i, _ := reply.(int64)
+	return int(i), nil
+}
+
+// readPage reads positions [from, to) of the cohort in one MULTI, so
+// like transact it fails with redisNil if a watched key changed. Under
+// incremental options each result is worked out from the user's place
+// in the sorted set, the cohort's size and its moments (see
+// rank.Options.ResultAt); under others the stored rows are read, unless
+// PutScore has kept scores that they miss.
+func (c *redisConn) readPage(ctx context.Context, tenant, cohortID string, from, to int) (Page, error) {
+	hash, zset := redisKeys(tenant, cohortID)
+	rows, _ := redisRowsKeys(tenant, cohortID)
+	cmds := [][]string{
+		{"HMGET", hash, "version", "options", "moments", "items"},
+		{"ZCARD", zset},
+		{"LLEN", redisScoresKey(tenant, cohortID)},
+	}
+	if to > from {
+		start, stop := strconv.Itoa(from), strconv.Itoa(to-1)
+		cmds = append(cmds, []string{"ZRANGE", zset, start, stop, "WITHSCORES"}, []string{"LRANGE", rows, start, stop})
+	}
+	reply, err := c.transact(ctx, cmds...)
+	if err != nil {
+		return Page{}, err
+	}
+	f, _ := reply[0].([]any)
+	if len(f) != 4 || f[0] == nil {
+		return Page{}, ErrNotFound
+	}
+	if f[1] == nil {
+		// Stored before pages were.
+		return Page{}, ErrNotPaged
+	}
+	out := Page{CohortID: cohortID, Offset: from, Results: []rank.Result{}}
+	v, _ := f[0].(string)
+	if out.Version, err = strconv.ParseInt(v, 10, 64); err != nil {
+		return Page{}, fmt.Errorf("cohort %q: bad version %q", cohortID, v)
+	}
+	o, _ := f[1].(string)
+	if err := json.Unmarshal([]byte(o), &out.Options); err != nil {
+		return Page{}, fmt.Errorf("cohort %q options: %w", cohortID, err)
+	}
+	size, _ := reply[1].(int64)
+	out.Size, out.Items = int(size), int(size)
+
+	if !out.Options.Incremental() {
+		if kept, _ := reply[2].(int64); kept > 0 {
+			return Page{}, ErrNotPaged
+		}
+		n, _ := f[3].(string)
+		if out.Items, err = strconv.Atoi(n); err != nil {
+			return Page{}, fmt.Errorf("cohort %q: bad item count %q", cohortID, n)
+		}
+		if to <= from {
+			return out, nil
+		}
+		list, _ := reply[4].([]any)
+		out.Results = make([]rank.Result, len(list))
+		for i, e := range list {
+			raw, _ := e.(string)
+			if err := json.Unmarshal([]byte(raw), &out.Results[i]); err != nil {
+				return Page{}, fmt.Errorf("cohort %q rows: %w", cohortID, err)
+			}
+		}
+		return out, nil
+	}
+	if f[2] == nil {
+		return Page{}, ErrNotPaged
+	}
+	if to <= from {
+		return out, nil
+	}
+	var m rank.Moments
+	mj, _ := f[2].(string)
+	if err := json.Unmarshal([]byte(mj), &m); err != nil {
+		return Page{}, fmt.Errorf("cohort %q moments: %w", cohortID, err)
+	}
+	mean, sd := m.MeanSD()
+	z, _ := reply[3].([]any)
+	for i := 0; i+1 < len(z); i += 2 {
+		userID, _ := z[i].(string)
+		sc, _ := z[i+1].(string)
+		score, err := strconv.ParseFloat(sc, 64)
+		if err != nil {
+			return Page{}, fmt.Errorf("%s: bad score %q", zset, sc)
+		}
+		// 0 - score rather than -score, so a percent of 0 isn't -0.
+		out.Results = append(out.Results, out.Options.ResultAt(userID, 0-score, from+i/2, out.Size, mean, sd))
+	}
+	return out, nil
+}
+
+func (r *Redis) History(ctx context.Context, tenant, cohortID string, from, to time.Time) ([]Ranking, error) {
+	hash, _ := redisKeys(tenant, cohortID)
+	reply, err := r.do(ctx, "LRANGE", redisHistoryKey(tenant, cohortID), "0", "-1")
+	if err == nil && len(reply.([]any)) == 0 {
+		// An empty list is a missing cohort unless it was stored before
+		// history was kept.
+		if _, err = r.do(ctx, "HGET", hash, "version"); errors.Is(err, redisNil) {
+			err = ErrNotFound
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Ranking
+	for _, e := range reply.([]any) {
+		raw, _ := e.(string)
+		var s redisSnapshot
+		if err := json.Unmarshal([]byte(raw), &s); err != nil {
+			return nil, fmt.Errorf("cohort %q history: %w", cohortID, err)
+		}
+		if !inRange(s.RankedAt, from, to) {
+			continue
+		}
+		rk := Ranking{CohortID: cohortID, Version: s.Version, RankedAt: s.RankedAt}
+		if err := decodeRanking(s.Ranking, &rk); err != nil {
+			return nil, fmt.Errorf("cohort %q version %d: %w", cohortID, s.Version, err)
+		}
+		out = append(out, rk)
+	}
+	return out, nil
+}
+
+func (r *Redis) PutRatings(ctx context.Context, tenant string, rt Ratings, ifVersion int64) (int64, error) {
+	data, err := json.Marshal(ratingsDocument{System: rt.System, Players: rt.Players})
+	if err != nil {
+		return 0, err
+	}
+	hash := redisRatingsKey(tenant, rt.CohortID)
+	return r.versionedWrite(ctx, hash, ifVersion, func(_ *redisConn, v int64) ([][]string, error) {
+		return [][]string{{"HSET", hash, "version", strconv.FormatInt(v, 10), "updated_at", rt.UpdatedAt.Format(time.RFC3339Nano), "data", string(data)}}, nil
+	})
+}
+
+func (r *Redis) GetRatings(ctx context.Context, tenant, cohortID string) (Ratings, error) {
+	out := Ratings{CohortID: cohortID}
+	data, err := r.getDocument(ctx, redisRatingsKey(tenant, cohortID), &out.Version, &out.UpdatedAt)
+	if err != nil {
+		return Ratings{}, err
+	}
+	var d ratingsDocument
+	if err := json.Unmarshal(data, &d); err != nil {
+		return Ratings{}, fmt.Errorf("ratings %q: %w", cohortID, err)
+	}
+	out.System, out.Players = d.System, d.Players
+	return out, nil
+}
+
+func (r *Redis) PutDigest(ctx context.Context, tenant string, d Digest, ifVersion int64) (int64, error) {
+	data, err := json.Marshal(d.Digest)
+	if err != nil {
+		return 0, err
+	}
+	hash := redisDigestKey(tenant, d.CohortID)
+	return r.versionedWrite(ctx, hash, ifVersion, func(_ *redisConn, v int64) ([][]string, error) {
+		return [][]string{{"HSET", hash, "version", strconv.FormatInt(v, 10), "updated_at", d.UpdatedAt.Format(time.RFC3339Nano), "data", string(data)}}, nil
+	})
+}
+
+func (r *Redis) GetDigest(ctx context.Context, tenant, cohortID string) (Digest, error) {
+	out := Digest{CohortID: cohortID}
+	data, err := r.getDocument(ctx, redisDigestKey(tenant, cohortID), &out.Version, &out.UpdatedAt)
+	if err != nil {
+		return Digest{}, err
+	}
+	if err := json.Unmarshal(data, &out.Digest); err != nil {
+		return Digest{}, fmt.Errorf("digest %q: %w", cohortID, err)
+	}
+	return out, nil
+}
+
+// getDocument reads a hash of version, updated_at and data, as written by
+// PutRatings and PutDigest; ErrNotFound if it is missing.
+func (r *Redis) getDocument(ctx context.Context, hash string, version *int64, updatedAt *time.Time) ([]byte, error) {
+	reply, err := r.do(ctx, "HMGET", hash, "version", "updated_at", "data")
+	if err != nil {
+		return nil, err
+	}
+	f := reply.([]any)
+	if len(f) != 3 || f[0] == nil {
+		return nil, ErrNotFound
+	}
+	v, _ := f[0].(string)
+	at, _ := f[1].(string)
+	data, _ := f[2].(string)
+	if *version, err = strconv.ParseInt(v, 10, 64); err != nil {
+		return nil, fmt.Errorf("%s: bad version %q", hash, v)
+	}
+	if *updatedAt, err = time.Parse(time.RFC3339Nano, at); err != nil {
+		return nil, fmt.Errorf("%s: %w", hash, err)
+	}
+	return []byte(data), nil
+}
+
+func (r *Redis) ClaimIdempotency(ctx context.Context, tenant string, rec Idempotency) (Idempotency, bool, error) {
+	data, err := encodeIdempotency(rec)
+	if err != nil {
+		return Idempotency{}, false, err
+	}
+	k := redisIdempotencyKey(tenant, rec.Key)
+	// The record found may expire before it is read; then claim again.
+	for {
+		_, err := r.do(ctx, "SET", k, string(data), "NX", "PX", ttlMillis(rec.Expires))
+		if err == nil {
+			return rec, true, nil
+		}
+		if !errors.Is(err, redisNil) {
+			return Idempotency{}, false, err
+		}
+		reply, err := r.do(ctx, "GET", k)
+		if errors.Is(err, redisNil) {
+			continue
+		}
+		if err != nil {
+			return Idempotency{}, false, err
+		}
+		s, _ := reply.(string)
+		cur, err := decodeIdempotency([]byte(s))
+		return cur, false, err
+	}
+}
+
+func (r *Redis) PutIdempotency(ctx context.Context, tenant string, rec Idempotency) error {
+	data, err := encodeIdempotency(rec)
+	if err != nil {
+		return err
+	}
+	_, err = r.do(ctx, "SET", redisIdempotencyKey(tenant, rec.Key), string(data), "PX", ttlMillis(rec.Expires))
+	return err
+}
+
+func (r *Redis) DeleteIdempotency(ctx context.Context, tenant, key string) error {
+	_, err := r.do(ctx, "DEL", redisIdempotencyKey(tenant, key))
+	return err
+}
+
+// GetBytes, SetBytes and Incr let a Redis also serve as a plain cache
+// shared by replicas, e.g. the api package's response cache tier.
+
+// GetBytes returns the string at key, nil if there is none.
+func (r *Redis) GetBytes(ctx context.Context, key string) ([]byte, error) {
+	reply, err := r.do(ctx, "GET", key)
+	if errors.Is(err, redisNil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, _ := reply.(string)
+	return []byte(s), nil
+}
+
+// SetBytes stores val at key, expiring after ttl.
+func (r *Redis) SetBytes(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	_, err := r.do(ctx, "SET", key, string(val), "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	return err
+}
+
+// Incr adds one to the counter at key and returns the new count.
+func (r *Redis) Incr(ctx context.Context, key string) (int64, error) {
+	reply, err := r.do(ctx, "INCR", key)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return n, nil
+}
+
+// ttlMillis is the PX argument that expires a key at t, at least 1ms.
+func ttlMillis(t time.Time) string {
+	return strconv.FormatInt(max(time.Until(t).Milliseconds(), 1), 10)
+}
+
+func (r *Redis) Ping(ctx context.Context) error {
+	_, err := r.do(ctx, "PING")
+	return err
+}
+
+// do sends one command on an idle connection and returns its reply.
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+	var reply any
+	err := r.withConn(ctx, func(c *redisConn) error {
+		var err error
+		reply, err = c.do(ctx, args...)
+		return err
+	})
+	return reply, err
+}
+
+// withConn runs fn with a connection of its own, for a transaction or a
+// few commands that must share one. A WATCH that fn leaves behind when
+// it fails is cleared before the connection goes back to the pool.
+func (r *Redis) withConn(ctx context.Context, fn func(c *redisConn) error) error {
+	c, err := r.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(c)
+	if err != nil && c.conn != nil {
+		c.do(ctx, "UNWATCH")
+	}
+	r.release(c)
+	return err
+}
+
+// acquire takes an idle connection, or dials one if the pool has room,
+// or waits for one to be released.
+func (r *Redis) acquire(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.idle:
+		return c, nil
+	default:
+	}
+	select {
+	case c := <-r.idle:
+		return c, nil
+	case r.open <- struct{}{}:
+		c, err := r.dial(ctx)
+		if err != nil {
+			<-r.open
+			return nil, err
+		}
+		return c, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release returns c to the pool, or frees its place if it was dropped.
+func (r *Redis) release(c *redisConn) {
+	if c.conn == nil {
+		<-r.open
+		return
+	}
+	r.idle <- c
+}
+
+// do sends one command and reads its reply. Any transport error drops
+// the connection, and the pool then dials a new one.
+func (c *redisConn) do(ctx context.Context, args ...string) (any, error) {
+	if c.conn == nil {
+		return nil, errors.New("redis: connection dropped")
+	}
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+	reply, err := c.roundTrip(args)
+	var re redisError
+	if err != nil && !errors.Is(err, redisNil) && !errors.As(err, &re) {
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+func (r *Redis) dial(ctx context.Context) (*redisConn, error) {
+	d := net.Dialer{Timeout: r.timeout}
+	conn, err := d.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, rd: bufio.NewReader(conn), timeout: r.timeout}
+	conn.SetDeadline(time.Now().Add(r.timeout))
+	var setup [][]string
+	if r.password != "" {
+		setup = append(setup, []string{"AUTH", r.password})
+	}
+	if r.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.db)})
+	}
+	for _, cmd := range setup {
+		if _, err := c.roundTrip(cmd); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) roundTrip(args []string) (any, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(c.rd)
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// readReply reads one RESP2 reply: strings for simple and bulk strings,
+// int64 for integers, []any for arrays (nil elements for nil bulks), and
+// redisNil for a nil bulk or array at the top level.
+func readReply(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch body := line[1:]; line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, redisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, redisNil
+		}
+		// Read every element even after an error reply, so the connection
+		// stays in step.
+		out := make([]any, n)
+		var first error
+		for i := range out {
+			v, err := readReply(rd)
+			var re redisError
+			switch {
+			case errors.Is(err, redisNil):
+			case errors.As(err, &re):
+				if first == nil {
+					first = err
+				}
+			case err != nil:
+				return nil, err
+			default:
+				out[i] = v
+			}
+		}
+		return out, first
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -0,0 +1,552 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ranking-go/internal/rank"
+)
+
+// fakeRedis serves the handful of commands Redis uses over RESP. Every
+// connection shares one keyspace; transactions run at EXEC, failing if a
+// key the connection watches was written since, or once when
+// failNextExec is set, as if another replica had written the key.
+type fakeRedis struct {
+	mu           sync.Mutex
+	hashes       map[string]map[string]string
+	zsets        map[string]map[string]float64
+	lists        map[string][]string
+	strings      map[string]string
+	failNextExec bool
+	password     string
+	dialed       int
+	// writes counts the writes to each key, for WATCH.
+	writes map[string]int
+}
+
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeRedis{hashes: map[string]map[string]string{}, zsets: map[string]map[string]float64{}, lists: map[string][]string{}, strings: map[string]string{}, writes: map[string]int{}, password: password}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.dialed++
+			f.mu.Unlock()
+			go f.serve(c)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	rd := bufio.NewReader(c)
+	authed := f.password == ""
+	var queued [][]string
+	inMulti := false
+	watched := map[string]int{}
+	for {
+		v, err := readReply(rd)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, a := range v.([]any) {
+			args = append(args, a.(string))
+		}
+		cmd := strings.ToUpper(args[0])
+		switch {
+		case cmd == "AUTH":
+			authed = args[1] == f.password
+			if !authed {
+				io.WriteString(c, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			io.WriteString(c, "+OK\r\n")
+		case !authed:
+			io.WriteString(c, "-NOAUTH Authentication required.\r\n")
+		case cmd == "MULTI":
+			inMulti, queued = true, nil
+			io.WriteString(c, "+OK\r\n")
+		case cmd == "WATCH":
+			f.mu.Lock()
+			for _, k := range args[1:] {
+				watched[k] = f.writes[k]
+			}
+			f.mu.Unlock()
+			io.WriteString(c, "+OK\r\n")
+		case cmd == "UNWATCH":
+			clear(watched)
+			io.WriteString(c, "+OK\r\n")
+		case cmd == "DISCARD":
+			inMulti = false
+			clear(watched)
+			io.WriteString(c, "+OK\r\n")
+		case cmd == "EXEC":
+			inMulti = false
+			f.mu.Lock()
+			changed := false
+			for k, n := range watched {
+				changed = changed || f.writes[k] != n
+			}
+			clear(watched)
+			if f.failNextExec || changed {
+				f.failNextExec = false
+				f.mu.Unlock()
+				io.WriteString(c, "*-1\r\n")
+				continue
+			}
+			replies := make([]string, len(queued))
+			for i, q := range queued {
+				replies[i] = f.exec(q)
+			}
+			f.mu.Unlock()
+			fmt.Fprintf(c, "*%d\r\n%s", len(replies), strings.Join(replies, ""))
+		case inMulti:
+			queued = append(queued, args)
+			io.WriteString(c, "+QUEUED\r\n")
+		default:
+			f.mu.Lock()
+			io.WriteString(c, f.exec(args))
+			f.mu.Unlock()
+		}
+	}
+}
+
+func bulk(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+
+func (f *fakeRedis) exec(args []string) string {
+	cmd := strings.ToUpper(args[0])
+	switch cmd {
+	case "HSET", "HDEL", "DEL", "INCR", "SET", "ZADD", "RPUSH", "LTRIM":
+		f.writes[args[1]]++
+	}
+	switch cmd {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "HGET":
+		v, ok := f.hashes[args[1]][args[2]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(v)
+	case "HMGET":
+		out := fmt.Sprintf("*%d\r\n", len(args)-2)
+		for _, k := range args[2:] {
+			if v, ok := f.hashes[args[1]][k]; ok {
+				out += bulk(v)
+			} else {
+				out += "$-1\r\n"
+			}
+		}
+		return out
+	case "HSET":
+		h := f.hashes[args[1]]
+		if h == nil {
+			h = map[string]string{}
+			f.hashes[args[1]] = h
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			h[args[i]] = args[i+1]
+		}
+		return ":1\r\n"
+	case "DEL":
+		delete(f.hashes, args[1])
+		delete(f.zsets, args[1])
+		delete(f.lists, args[1])
+		delete(f.strings, args[1])
+		return ":1\r\n"
+	case "GET":
+		v, ok := f.strings[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(v)
+	case "INCR":
+		n, _ := strconv.ParseInt(f.strings[args[1]], 10, 64)
+		f.strings[args[1]] = strconv.FormatInt(n+1, 10)
+		return fmt.Sprintf(":%d\r\n", n+1)
+	case "SET":
+		// Expiry (PX) is accepted and ignored.
+		if _, ok := f.strings[args[1]]; ok && slices.Contains(args[3:], "NX") {
+			return "$-1\r\n"
+		}
+		f.strings[args[1]] = args[2]
+		return "+OK\r\n"
+	case "ZADD":
+		z := f.zsets[args[1]]
+		if z == nil {
+			z = map[string]float64{}
+			f.zsets[args[1]] = z
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			s, _ := strconv.ParseFloat(args[i], 64)
+			z[args[i+1]] = s
+		}
+		return fmt.Sprintf(":%d\r\n", (len(args)-2)/2)
+	case "HDEL":
+		for _, k := range args[2:] {
+			delete(f.hashes[args[1]], k)
+		}
+		return ":1\r\n"
+	case "ZCARD":
+		return fmt.Sprintf(":%d\r\n", len(f.zsets[args[1]]))
+	case "ZSCORE":
+		v, ok := f.zsets[args[1]][args[2]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(strconv.FormatFloat(v, 'g', -1, 64))
+	case "ZRANK":
+		i := slices.Index(f.members(args[1]), args[2])
+		if i < 0 {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", i)
+	case "ZRANGE":
+		// Only ZRANGE key start stop WITHSCORES, with start and stop >= 0.
+		m := f.members(args[1])
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		m = m[min(start, len(m)):min(stop+1, len(m))]
+		out := fmt.Sprintf("*%d\r\n", 2*len(m))
+		for _, u := range m {
+			out += bulk(u) + bulk(strconv.FormatFloat(f.zsets[args[1]][u], 'g', -1, 64))
+		}
+		return out
+	case "LLEN":
+		return fmt.Sprintf(":%d\r\n", len(f.lists[args[1]]))
+	case "RPUSH":
+		f.lists[args[1]] = append(f.lists[args[1]], args[2:]...)
+		return fmt.Sprintf(":%d\r\n", len(f.lists[args[1]]))
+	case "LTRIM", "LRANGE":
+		l := f.lists[args[1]]
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		if start < 0 {
+			start = max(len(l)+start, 0)
+		}
+		if stop < 0 {
+			stop += len(l)
+		}
+		stop = min(stop+1, len(l))
+		if start > stop {
+			start = stop
+		}
+		if args[0] == "LTRIM" {
+			f.lists[args[1]] = l[start:stop]
+			return "+OK\r\n"
+		}
+		out := fmt.Sprintf("*%d\r\n", stop-start)
+		for _, v := range l[start:stop] {
+			out += bulk(v)
+		}
+		return out
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func (f *fakeRedis) raceNextExec() {
+	f.mu.Lock()
+	f.failNextExec = true
+	f.mu.Unlock()
+}
+
+func (f *fakeRedis) zrange(key string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.members(key)
+}
+
+// members is the sorted set at key in ZRANGE order; f.mu must be held.
+func (f *fakeRedis) members(key string) []string {
+	var out []string
+	for m := range f.zsets[key] {
+		out = append(out, m)
+	}
+	z := f.zsets[key]
+	sort.Slice(out, func(i, j int) bool { return z[out[i]] < z[out[j]] || z[out[i]] == z[out[j]] && out[i] < out[j] })
+	return out
+}
+
+func TestRedisStore(t *testing.T) {
+	fake, addr := startFakeRedis(t, "s3cret")
+	r, err := NewRedis("redis://:s3cret@" + addr + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := r.Get(ctx, "t", "c"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get missing: %v, want ErrNotFound", err)
+	}
+	if _, err := r.Put(ctx, "t", Ranking{CohortID: "c"}, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("conditional put on missing cohort: %v, want ErrNotFound", err)
+	}
+	items := []rank.Item{{UserID: "a", Percent: 60}, {UserID: "b", Percent: 90}}
+	rk := Ranking{CohortID: "c", Items: items, Results: rank.RankByPercent(items), RankedAt: time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)}
+	for want := int64(1); want <= 2; want++ {
+		if v, err := r.Put(ctx, "t", rk, 0); err != nil || v != want {
+			t.Fatalf("put: version %d, err %v; want %d", v, err, want)
+		}
+	}
+	if _, err := r.Put(ctx, "t", rk, 1); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale put: %v, want ErrVersionConflict", err)
+	}
+	if _, err := r.Put(ctx, "t", rk, IfAbsent); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("create over stored cohort: %v, want ErrVersionConflict", err)
+	}
+	fake.raceNextExec()
+	if _, err := r.Put(ctx, "t", Ranking{CohortID: "new"}, IfAbsent); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("raced create: %v, want ErrVersionConflict", err)
+	}
+
+	// A write racing ours between WATCH and EXEC: conditional puts
+	// conflict, unconditional ones retry.
+	fake.raceNextExec()
+	if _, err := r.Put(ctx, "t", rk, 2); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("raced conditional put: %v, want ErrVersionConflict", err)
+	}
+	fake.raceNextExec()
+	if v, err := r.Put(ctx, "t", rk, 0); err != nil || v != 3 {
+		t.Errorf("raced put: version %d, err %v; want 3", v, err)
+	}
+
+	got, err := r.Get(ctx, "t", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rk
+	want.Version = 3
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("get:\n got %+v\nwant %+v", got, want)
+	}
+	hash, zset := redisKeys("t", "c")
+	if order := fake.zrange(zset); !reflect.DeepEqual(order, []string{"b", "a"}) {
+		t.Errorf("sorted set %v, want [b a]", order)
+	}
+
+	// Tenants are isolated, even with separators in their IDs.
+	if _, err := r.Get(ctx, "other", "c"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("other tenant: %v, want ErrNotFound", err)
+	}
+	if h, _ := redisKeys(`t":"c`, ""); h == hash {
+		t.Errorf("key collision: %s", h)
+	}
+	if err := r.Ping(ctx); err != nil {
+		t.Errorf("ping: %v", err)
+	}
+
+	// Every stored version is in the history, without items.
+	hist, err := r.History(ctx, "t", "c", time.Time{}, time.Time{})
+	if err != nil || len(hist) != 3 {
+		t.Fatalf("history: %d snapshots, err %v; want 3", len(hist), err)
+	}
+	snap := want
+	snap.Items = nil
+	if !reflect.DeepEqual(hist[2], snap) || hist[0].Version != 1 {
+		t.Errorf("history:\n got %+v\nwant %+v", hist[2], snap)
+	}
+	if hist, err := r.History(ctx, "t", "c", rk.RankedAt.Add(time.Second), time.Time{}); err != nil || len(hist) != 0 {
+		t.Errorf("history after last: %v, %v; want none", hist, err)
+	}
+	if _, err := r.History(ctx, "t", "missing", time.Time{}, time.Time{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("history of missing cohort: %v, want ErrNotFound", err)
+	}
+	testScores(t, r, "scored")
+	_, scored := redisKeys("scored", "c")
+	if order := fake.zrange(scored); !reflect.DeepEqual(order, []string{"b", "a"}) {
+		t.Errorf("sorted set after scores and a put: %v, want [b a]", order)
+	}
+	// A score moves one member; ties go by user_id, as in the ranking.
+	cur, _ := r.Get(ctx, "scored", "c")
+	if _, err := r.PutScore(ctx, "scored", "c", rank.Score{UserID: "0", Percent: 60}, time.Now(), cur.Version); err != nil {
+		t.Fatal(err)
+	}
+	if order := fake.zrange(scored); !reflect.DeepEqual(order, []string{"0", "b", "a"}) {
+		t.Errorf("sorted set after a score: %v, want [0 b a]", order)
+	}
+	testRatings(t, r, "rated")
+	testDigests(t, r, "digested")
+	testIdempotency(t, r, "idem")
+}
+
+func TestRedisCache(t *testing.T) {
+	_, addr := startFakeRedis(t, "")
+	r, _ := NewRedis("redis://" + addr)
+	ctx := context.Background()
+	if v, err := r.GetBytes(ctx, "k"); v != nil || err != nil {
+		t.Errorf("get missing: %q, %v", v, err)
+	}
+	if err := r.SetBytes(ctx, "k", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := r.GetBytes(ctx, "k"); string(v) != "v" || err != nil {
+		t.Errorf("get: %q, %v", v, err)
+	}
+	for want := int64(1); want <= 2; want++ {
+		if n, err := r.Incr(ctx, "n"); n != want || err != nil {
+			t.Errorf("incr: %d, %v; want %d", n, err, want)
+		}
+	}
+}
+
+func TestRedisBadPassword(t *testing.T) {
+	_, addr := startFakeRedis(t, "s3cret")
+	r, _ := NewRedis("redis://:wrong@" + addr)
+	if err := r.Ping(context.Background()); err == nil {
+		t.Error("ping with a wrong password succeeded")
+	}
+	if err := r.Ping(context.Background()); err == nil {
+		t.Error("second ping reused the unauthenticated connection")
+	}
+}
+
+func TestNewRedisURL(t *testing.T) {
+	r, err := NewRedis("redis://cache")
+	if err != nil || r.addr != "cache:6379" || r.db != 0 {
+		t.Errorf("got %+v, %v", r, err)
+	}
+	if r, err := NewRedis("redis://cache?pool_size=3"); err != nil || cap(r.open) != 3 {
+		t.Errorf("pool_size: %v", err)
+	}
+	for _, bad := range []string{"http://cache", "redis://cache/x", "redis://cache?pool_size=0"} {
+		if _, err := NewRedis(bad); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestRedisPool(t *testing.T) {
+	fake, addr := startFakeRedis(t, "")
+	r, _ := NewRedis("redis://" + addr + "?pool_size=2")
+	ctx := context.Background()
+	items := []rank.Item{{UserID: "a", Percent: 60}}
+	rk := Ranking{CohortID: "c", Items: items, Results: rank.RankByPercent(items)}
+	var wg sync.WaitGroup
+	versions := make([]int64, 20)
+	for i := range versions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := r.Put(ctx, "t", rk, 0)
+			if err != nil {
+				t.Error(err)
+			}
+			versions[i] = v
+		}()
+	}
+	wg.Wait()
+	slices.Sort(versions)
+	for i, v := range versions {
+		if v != int64(i+1) {
+			t.Fatalf("versions %v, want 1 to 20", versions)
+		}
+	}
+	if fake.dialed > 2 {
+		t.Errorf("%d connections dialed, want at most 2", fake.dialed)
+	}
+}
+
+func TestRedisPage(t *testing.T) {
+	fake, addr := startFakeRedis(t, "")
+	r, _ := NewRedis("redis://" + addr)
+	ctx := context.Background()
+	if _, err := r.Page(ctx, "t", "missing", 0, 10); !errors.Is(err, ErrNotFound) {
+		t.Errorf("page of missing cohort: %v, want ErrNotFound", err)
+	}
+
+	var items []rank.Item
+	for i := range 20 {
+		items = append(items, rank.Item{UserID: fmt.Sprintf("u%02d", i), Percent: float64(i * 37 % 50)})
+	}
+	for _, opts := range []rank.Options{{}, {Strategy: rank.StrategyDense}, {TopK: 12}} {
+		results, err := rank.Rank(items, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := r.Put(ctx, "t", Ranking{CohortID: "c", Items: items, Options: opts, Results: results}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.Incremental() {
+			for i, sc := range []rank.Score{{UserID: "u03", Percent: 49}, {UserID: "new", Percent: 0}, {UserID: "u03", Percent: 12}} {
+				if _, err := r.PutScore(ctx, "t", "c", sc, time.Now(), v+int64(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		full, err := r.Get(ctx, "t", "c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPage := func(name string, p Page, from, to int) {
+			t.Helper()
+			want := full.Results[from:to]
+			if p.Version != full.Version || p.Size != len(full.Results) || p.Items != len(full.Items) || p.Offset != from || len(p.Results) != len(want) {
+				t.Fatalf("%s: version %d, size %d, offset %d, %d results; want %d, %d, %d, %d", name, p.Version, p.Size, p.Offset, len(p.Results), full.Version, len(full.Results), from, len(want))
+			}
+			for i, got := range p.Results {
+				w := want[i]
+				if got.UserID != w.UserID || got.Rank != w.Rank || got.Percentile != w.Percentile || got.Percent != w.Percent || math.Abs(got.ZScore-w.ZScore) > 1e-9 {
+					t.Errorf("%s[%d]: got %+v, want %+v", name, i, got, w)
+				}
+			}
+		}
+		p, err := r.Page(ctx, "t", "c", 5, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPage("page", p, 5, 10)
+		last := len(full.Results) - 3
+		if p, err = r.Page(ctx, "t", "c", last, 100); err != nil {
+			t.Fatal(err)
+		}
+		checkPage("last page", p, last, len(full.Results))
+
+		// Around a user: the window is cut at either end.
+		for _, tc := range []struct{ at, window int }{{0, 2}, {7, 3}, {len(full.Results) - 1, 5}} {
+			p, err := r.PageAround(ctx, "t", "c", full.Results[tc.at].UserID, tc.window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkPage("around "+full.Results[tc.at].UserID, p, max(tc.at-tc.window, 0), min(tc.at+tc.window+1, len(full.Results)))
+		}
+		if _, err := r.PageAround(ctx, "t", "c", "nobody", 1); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("missing user: %v, want ErrUserNotFound", err)
+		}
+	}
+
+	// A cohort stored before pages were is read whole instead.
+	hash, _ := redisKeys("t", "c")
+	fake.mu.Lock()
+	delete(fake.hashes[hash], "options")
+	fake.mu.Unlock()
+	if _, err := r.PageAround(ctx, "t", "c", "u01", 1); !errors.Is(err, ErrNotPaged) {
+		t.Errorf("old cohort: %v, want ErrNotPaged", err)
+	}
+}
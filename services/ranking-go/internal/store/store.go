@@ -0,0 +1,398 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ranking-go/internal/rank"
+	"ranking-go/internal/rating"
+	"ranking-go/internal/tdigest"
+)
+
+var (
+	// ErrNotFound is returned when a tenant has no ranking for a cohort.
+	ErrNotFound = errors.New("cohort not found")
+	// ErrVersionConflict is returned by a conditional Put when the stored
+	// version is not the expected one.
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrUserNotFound is returned by Pager.PageAround for a user not in
+	// the cohort.
+	ErrUserNotFound = errors.New("user not in cohort")
+	// ErrNotPaged is returned by a Pager for a cohort it can't serve in
+	// part; Get still reads it whole.
+	ErrNotPaged = errors.New("cohort not stored for paging")
+)
+
+// Ranking is the latest computed ranking of a cohort, with the inputs it was
+// computed from so it can be updated and re-ranked.
+type Ranking struct {
+	CohortID string
+	Items    []rank.Item
+	Options  rank.Options
+	Results  []rank.Result
+	RankedAt time.Time
+	// Version starts at 1 and increases by one on every write. Set by the
+	// store; ignored on Put.
+	Version int64
+}
+
+// Ratings is a cohort's head-to-head rating table. Unlike a Ranking it is
+// built up match by match, so every update reads, changes and
+// conditionally writes it back.
+type Ratings struct {
+	CohortID string
+	// System is the rating system the table was built with, "elo".
+	System    string
+	Players   []rating.Player
+	UpdatedAt time.Time
+	// Version is as for Ranking.
+	Version int64
+}
+
+// Digest is a cohort's approximate score distribution, for cohorts too
+// large to rank exactly. Like Ratings it grows upload by upload.
+type Digest struct {
+	CohortID  string
+	Digest    tdigest.Digest
+	UpdatedAt time.Time
+	// Version is as for Ranking.
+	Version int64
+}
+
+// Idempotency is the outcome of a request sent with an Idempotency-Key,
+// kept so that a retry of the request is answered with the same response
+// instead of being run again.
+type Idempotency struct {
+	Key string
+	// Request identifies the request the key was first sent with, so the
+	// key can't be replayed for a different one.
+	Request string
+	// Done is false while the first request is still running; Status,
+	// Header and Body are its response once it is.
+	Done   bool
+	Status int
+	Header map[string][]string
+	Body   []byte
+	// Expires is when the record is dropped and the key may be used
+	// afresh.
+	Expires time.Time
+}
+
+// MaxSnapshots is how many past rankings History keeps per cohort; older
+// ones are dropped as new ones are stored.
+const MaxSnapshots = 100
+
+// snapshot is r as kept in a cohort's history: everything but the items,
+// which only matter for re-ranking the latest version.
+func snapshot(r Ranking) Ranking {
+	r.Items = nil
+	return r
+}
+
+// MaxPendingScores is how many scores PutScore keeps beside a stored
+// ranking before it folds them into the ranking itself.
+const MaxPendingScores = 256
+
+// pendingScore is a score PutScore recorded that is not yet folded into
+// its ranking. Its JSON form is what Postgres and Redis keep.
+type pendingScore struct {
+	UserID  string    `json:"user_id"`
+	Percent float64   `json:"percent"`
+	At      time.Time `json:"at"`
+}
+
+// fold applies pending to r, in order, as Get returns it. The ranking is
+// as of the last score.
+func fold(r *Ranking, pending []pendingScore) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	scores := make([]rank.Score, len(pending))
+	for i, p := range pending {
+		scores[i] = rank.Score{UserID: p.UserID, Percent: p.Percent, Submitted: p.At.UnixNano()}
+	}
+	items, results, err := rank.UpdateScores(r.Items, r.Results, r.Options, scores)
+	if err != nil {
+		return fmt.Errorf("cohort %q: %w", r.CohortID, err)
+	}
+	r.Items, r.Results, r.RankedAt = items, results, pending[len(pending)-1].At
+	return nil
+}
+
+// inRange reports whether t is within [from, to]; a zero bound is open.
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || !t.After(to))
+}
+
+// IfAbsent is the ifVersion of a write that creates its cohort, and
+// conflicts with any stored version.
+const IfAbsent int64 = -1
+
+// Store keeps the latest ranking per (tenant, cohort_id). Tenants are fully
+// isolated: the same cohort_id under two tenants is two distinct entries.
+type Store interface {
+	// Put stores r and returns its new version. If ifVersion > 0 the write
+	// only happens when the stored version equals it (ErrNotFound if there
+	// is none, ErrVersionConflict if it differs); if it is IfAbsent, only
+	// when there is none (ErrVersionConflict if there is).
+	Put(ctx context.Context, tenant string, r Ranking, ifVersion int64) (int64, error)
+	Get(ctx context.Context, tenant, cohortID string) (Ranking, error)
+	// PutScore records one user's new percent, at, in a stored ranking
+	// and returns its new version, without rewriting the ranking: the
+	// store keeps the scores recorded since the last Put beside it, Get
+	// folds them in (see rank.UpdateScores), and once MaxPendingScores
+	// have built up PutScore folds them into the stored ranking. It is
+	// meant for rankings under incremental options (see
+	// rank.Options.Incremental). ifVersion is as for Put; ErrNotFound if
+	// the cohort isn't stored. Only Put records History.
+	PutScore(ctx context.Context, tenant, cohortID string, sc rank.Score, at time.Time, ifVersion int64) (int64, error)
+	// History returns the cohort's stored rankings, without their items,
+	// ranked within [from, to] and oldest first; a zero bound is open.
+	// Every Put records one, and the last MaxSnapshots are kept.
+	// ErrNotFound if the cohort has never been stored.
+	History(ctx context.Context, tenant, cohortID string, from, to time.Time) ([]Ranking, error)
+	// PutRatings and GetRatings are Put and Get for rating tables, which
+	// are kept apart from rankings: a cohort can have both.
+	PutRatings(ctx context.Context, tenant string, r Ratings, ifVersion int64) (int64, error)
+	GetRatings(ctx context.Context, tenant, cohortID string) (Ratings, error)
+	// PutDigest and GetDigest are the same for score digests.
+	PutDigest(ctx context.Context, tenant string, d Digest, ifVersion int64) (int64, error)
+	GetDigest(ctx context.Context, tenant, cohortID string) (Digest, error)
+	// ClaimIdempotency stores rec and returns it with claimed true,
+	// unless rec.Key already holds an unexpired record, which it returns
+	// with claimed false.
+	ClaimIdempotency(ctx context.Context, tenant string, rec Idempotency) (stored Idempotency, claimed bool, err error)
+	// PutIdempotency replaces the record of rec.Key.
+	PutIdempotency(ctx context.Context, tenant string, rec Idempotency) error
+	// DeleteIdempotency drops the record of key, if any.
+	DeleteIdempotency(ctx context.Context, tenant, key string) error
+	// Ping reports whether the backend is reachable.
+	Ping(ctx context.Context) error
+}
+
+// Page is part of a stored ranking, as a Pager reads it: the results at
+// positions Offset onwards (0 best) and what they need to be shown.
+type Page struct {
+	CohortID string
+	Version  int64
+	RankedAt time.Time
+	Options  rank.Options
+	// Size is the number of results in the whole cohort, and Items the
+	// number of items ranked: more under TopK.
+	Size, Items int
+	Offset      int
+	Results     []rank.Result
+}
+
+// Pager is implemented by stores that can read part of a ranking without
+// loading all of it, so a leaderboard page or one user's rank costs the
+// page rather than the cohort. Results match Get's but for TieGroup,
+// which is left 0. Either method may return ErrNotPaged, and the caller
+// then falls back to Get.
+type Pager interface {
+	// Page returns the results at positions [from, to), cut to the
+	// cohort's size.
+	Page(ctx context.Context, tenant, cohortID string, from, to int) (Page, error)
+	// PageAround returns userID's result with up to window users on each
+	// side; ErrUserNotFound if they are not in the cohort.
+	PageAround(ctx context.Context, tenant, cohortID, userID string, window int) (Page, error)
+}
+
+type key struct {
+	tenant   string
+	cohortID string
+}
+
+type idempotencyKey struct {
+	tenant string
+	key    string
+}
+
+// Memory is an in-process Store. Safe for concurrent use.
+type Memory struct {
+	mu          sync.RWMutex
+	data        map[key]Ranking
+	pending     map[key][]pendingScore
+	history     map[key][]Ranking
+	ratings     map[key]Ratings
+	digests     map[key]Digest
+	idempotency map[idempotencyKey]Idempotency
+	// nextSweep is when expired idempotency records are next dropped.
+	nextSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{data: make(map[key]Ranking), pending: make(map[key][]pendingScore), history: make(map[key][]Ranking), ratings: make(map[key]Ratings), digests: make(map[key]Digest), idempotency: make(map[idempotencyKey]Idempotency)}
+}
+
+func (m *Memory) Put(_ context.Context, tenant string, r Ranking, ifVersion int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key{tenant, r.CohortID}
+	cur, ok := m.data[k]
+	switch {
+	case ifVersion == IfAbsent && ok:
+		return 0, ErrVersionConflict
+	case ifVersion > 0 && !ok:
+		return 0, ErrNotFound
+	case ifVersion > 0 && cur.Version != ifVersion:
+		return 0, ErrVersionConflict
+	}
+	r.Version = cur.Version + 1
+	m.data[k] = r
+	delete(m.pending, k)
+	h := append(m.history[k], snapshot(r))
+	if len(h) > MaxSnapshots {
+		h = append([]Ranking(nil), h[len(h)-MaxSnapshots:]...)
+	}
+	m.history[k] = h
+	return r.Version, nil
+}
+
+func (m *Memory) Get(_ context.Context, tenant, cohortID string) (Ranking, error) {
+	k := key{tenant, cohortID}
+	m.mu.RLock()
+	r, ok := m.data[k]
+	pending := m.pending[k]
+	m.mu.RUnlock()
+	if !ok {
+		return Ranking{}, ErrNotFound
+	}
+	// PutScore only ever appends to pending or replaces it, so it can be
+	// folded outside the lock.
+	if err := fold(&r, pending); err != nil {
+		return Ranking{}, err
+	}
+	return r, nil
+}
+
+func (m *Memory) PutScore(_ context.Context, tenant, cohortID string, sc rank.Score, at time.Time, ifVersion int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key{tenant, cohortID}
+	cur, ok := m.data[k]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	if ifVersion > 0 && cur.Version != ifVersion {
+		return 0, ErrVersionConflict
+	}
+	cur.Version++
+	pending := append(m.pending[k], pendingScore{UserID: sc.UserID, Percent: sc.Percent, At: at})
+	if len(pending) >= MaxPendingScores && fold(&cur, pending) == nil {
+		pending = nil
+	}
+	m.data[k], m.pending[k] = cur, pending
+	return cur.Version, nil
+}
+
+func (m *Memory) History(_ context.Context, tenant, cohortID string, from, to time.Time) ([]Ranking, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	h, ok := m.history[key{tenant, cohortID}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var out []Ranking
+	for _, r := range h {
+		if inRange(r.RankedAt, from, to) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) PutRatings(_ context.Context, tenant string, r Ratings, ifVersion int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key{tenant, r.CohortID}
+	cur, ok := m.ratings[k]
+	if ifVersion > 0 {
+		if !ok {
+			return 0, ErrNotFound
+		}
+		if cur.Version != ifVersion {
+			return 0, ErrVersionConflict
+		}
+	}
+	r.Version = cur.Version + 1
+	m.ratings[k] = r
+	return r.Version, nil
+}
+
+func (m *Memory) GetRatings(_ context.Context, tenant, cohortID string) (Ratings, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	r, ok := m.ratings[key{tenant, cohortID}]
+	if !ok {
+		return Ratings{}, ErrNotFound
+	}
+	return r, nil
+}
+
+func (m *Memory) PutDigest(_ context.Context, tenant string, d Digest, ifVersion int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key{tenant, d.CohortID}
+	cur, ok := m.digests[k]
+	if ifVersion > 0 {
+		if !ok {
+			return 0, ErrNotFound
+		}
+		if cur.Version != ifVersion {
+			return 0, ErrVersionConflict
+		}
+	}
+	d.Version = cur.Version + 1
+	m.digests[k] = d
+	return d.Version, nil
+}
+
+func (m *Memory) GetDigest(_ context.Context, tenant, cohortID string) (Digest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	d, ok := m.digests[key{tenant, cohortID}]
+	if !ok {
+		return Digest{}, ErrNotFound
+	}
+	return d, nil
+}
+
+func (m *Memory) ClaimIdempotency(_ context.Context, tenant string, rec Idempotency) (Idempotency, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.After(m.nextSweep) {
+		for k, cur := range m.idempotency {
+			if !now.Before(cur.Expires) {
+				delete(m.idempotency, k)
+			}
+		}
+		m.nextSweep = now.Add(time.Minute)
+	}
+	k := idempotencyKey{tenant, rec.Key}
+	if cur, ok := m.idempotency[k]; ok && now.Before(cur.Expires) {
+		return cur, false, nil
+	}
+	m.idempotency[k] = rec
+	return rec, true, nil
+}
+
+func (m *Memory) PutIdempotency(_ context.Context, tenant string, rec Idempotency) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.idempotency[idempotencyKey{tenant, rec.Key}] = rec
+	return nil
+}
+
+func (m *Memory) DeleteIdempotency(_ context.Context, tenant, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.idempotency, idempotencyKey{tenant, key})
+	return nil
+}
+
+func (m *Memory) Ping(context.Context) error { return nil }
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"ranking-go/internal/rank"
+	"ranking-go/internal/rating"
+	"ranking-go/internal/tdigest"
+)
+
+func TestMemoryVersions(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	if _, err := m.Put(ctx, "t", Ranking{CohortID: "c"}, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("conditional put on missing cohort: %v, want ErrNotFound", err)
+	}
+	for want := int64(1); want <= 3; want++ {
+		v, err := m.Put(ctx, "t", Ranking{CohortID: "c"}, 0)
+		if err != nil || v != want {
+			t.Fatalf("put: version %d, err %v; want %d", v, err, want)
+		}
+	}
+	if _, err := m.Put(ctx, "t", Ranking{CohortID: "c"}, 2); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale put: %v, want ErrVersionConflict", err)
+	}
+	if _, err := m.Put(ctx, "t", Ranking{CohortID: "c"}, IfAbsent); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("create over stored cohort: %v, want ErrVersionConflict", err)
+	}
+	if v, err := m.Put(ctx, "t", Ranking{CohortID: "new"}, IfAbsent); err != nil || v != 1 {
+		t.Errorf("create: version %d, err %v; want 1", v, err)
+	}
+	if v, err := m.Put(ctx, "t", Ranking{CohortID: "c"}, 3); err != nil || v != 4 {
+		t.Errorf("current put: version %d, err %v; want 4", v, err)
+	}
+	got, err := m.Get(ctx, "t", "c")
+	if err != nil || got.Version != 4 {
+		t.Errorf("get: version %d, err %v; want 4", got.Version, err)
+	}
+
+	// Other tenants have their own version sequence.
+	if v, _ := m.Put(ctx, "other", Ranking{CohortID: "c"}, 0); v != 1 {
+		t.Errorf("other tenant: version %d, want 1", v)
+	}
+}
+
+func TestMemoryHistory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	if _, err := m.History(ctx, "t", "c", time.Time{}, time.Time{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing cohort: %v, want ErrNotFound", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < MaxSnapshots+5; i++ {
+		r := Ranking{CohortID: "c", RankedAt: start.Add(time.Duration(i) * time.Hour), Items: []rank.Item{{UserID: "a"}}}
+		if _, err := m.Put(ctx, "t", r, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := m.History(ctx, "t", "c", time.Time{}, time.Time{})
+	if err != nil || len(all) != MaxSnapshots {
+		t.Fatalf("history: %d snapshots, err %v; want %d", len(all), err, MaxSnapshots)
+	}
+	if all[0].Version != 6 || all[len(all)-1].Version != MaxSnapshots+5 || all[0].Items != nil {
+		t.Errorf("history kept versions %d..%d, items %v", all[0].Version, all[len(all)-1].Version, all[0].Items)
+	}
+
+	// Bounds are inclusive.
+	got, _ := m.History(ctx, "t", "c", start.Add(10*time.Hour), start.Add(12*time.Hour))
+	if len(got) != 3 || got[0].Version != 11 {
+		t.Errorf("range: %+v", got)
+	}
+	if got, _ := m.History(ctx, "other", "c", time.Time{}, time.Time{}); got != nil {
+		t.Errorf("other tenant: %+v", got)
+	}
+}
+
+// testRatings runs the PutRatings and GetRatings contract against s.
+func testRatings(t *testing.T, s Store, tenant string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := s.GetRatings(ctx, tenant, "c"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get missing ratings: %v, want ErrNotFound", err)
+	}
+	if _, err := s.PutRatings(ctx, tenant, Ratings{CohortID: "c"}, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("conditional put on missing ratings: %v, want ErrNotFound", err)
+	}
+	r := Ratings{
+		CohortID:  "c",
+		System:    "elo",
+		Players:   []rating.Player{{UserID: "a", Rating: 1516, Matches: 1, Wins: 1}, {UserID: "b", Rating: 1484, Matches: 1, Losses: 1}},
+		UpdatedAt: time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC),
+	}
+	if v, err := s.PutRatings(ctx, tenant, r, 0); err != nil || v != 1 {
+		t.Fatalf("put ratings: version %d, err %v; want 1", v, err)
+	}
+	if _, err := s.PutRatings(ctx, tenant, r, 2); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale put ratings: %v, want ErrVersionConflict", err)
+	}
+	if v, err := s.PutRatings(ctx, tenant, r, 1); err != nil || v != 2 {
+		t.Errorf("current put ratings: version %d, err %v; want 2", v, err)
+	}
+	got, err := s.GetRatings(ctx, tenant, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Version = 2
+	if !reflect.DeepEqual(got, r) {
+		t.Errorf("get ratings:\n got %+v\nwant %+v", got, r)
+	}
+	// Ratings live apart from rankings.
+	if _, err := s.Get(ctx, tenant, "c"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ranking of a rated cohort: %v, want ErrNotFound", err)
+	}
+}
+
+// testScores runs the PutScore contract against s: kept scores show in
+// Get, before and after PutScore folds them in, and a Put replaces them.
+func testScores(t *testing.T, s Store, tenant string) {
+	t.Helper()
+	ctx := context.Background()
+	at := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := s.PutScore(ctx, tenant, "c", rank.Score{UserID: "a", Percent: 1}, at, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("score for a missing cohort: %v, want ErrNotFound", err)
+	}
+	items := []rank.Item{{UserID: "a", Percent: 50, Tier: "kept"}, {UserID: "b", Percent: 60}}
+	put := Ranking{CohortID: "c", Items: items, Results: rank.RankByPercent(items), RankedAt: at}
+	v, err := s.Put(ctx, tenant, put, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PutScore(ctx, tenant, "c", rank.Score{UserID: "a", Percent: 1}, at, v+1); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale score: %v, want ErrVersionConflict", err)
+	}
+
+	want := slices.Clone(items)
+	for i := 0; i < MaxPendingScores+10; i++ {
+		sc := rank.Score{UserID: fmt.Sprintf("u%d", i%7), Percent: float64(i % 97)}
+		if i%5 == 0 {
+			sc.UserID = "a"
+		}
+		at = at.Add(time.Second)
+		if v, err = s.PutScore(ctx, tenant, "c", sc, at, v); err != nil {
+			t.Fatal(err)
+		}
+		if j := slices.IndexFunc(want, func(it rank.Item) bool { return it.UserID == sc.UserID }); j >= 0 {
+			want[j].Percent, want[j].Submitted = sc.Percent, at.UnixNano()
+		} else {
+			want = append(want, rank.Item{UserID: sc.UserID, Percent: sc.Percent, Submitted: at.UnixNano()})
+		}
+		if i != 3 && i != MaxPendingScores+9 {
+			continue
+		}
+		got, err := s.Get(ctx, tenant, "c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := (Ranking{CohortID: "c", Items: want, Results: rank.RankByPercent(want), RankedAt: at, Version: v}); !reflect.DeepEqual(got, exp) {
+			t.Fatalf("after %d scores:\n got %+v\nwant %+v", i+1, got, exp)
+		}
+	}
+
+	if v, err = s.Put(ctx, tenant, put, v); err != nil {
+		t.Fatal(err)
+	}
+	put.Version = v
+	if got, err := s.Get(ctx, tenant, "c"); err != nil || !reflect.DeepEqual(got, put) {
+		t.Errorf("after put: %+v, %v; want %+v", got, err, put)
+	}
+}
+
+func TestMemoryScores(t *testing.T) {
+	testScores(t, NewMemory(), "t")
+}
+
+func TestMemoryRatings(t *testing.T) {
+	testRatings(t, NewMemory(), "t")
+}
+
+// testDigests runs the PutDigest and GetDigest contract against s.
+func testDigests(t *testing.T, s Store, tenant string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := s.GetDigest(ctx, tenant, "c"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get missing digest: %v, want ErrNotFound", err)
+	}
+	if _, err := s.PutDigest(ctx, tenant, Digest{CohortID: "c"}, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("conditional put on missing digest: %v, want ErrNotFound", err)
+	}
+	d := Digest{CohortID: "c", Digest: *tdigest.New(100), UpdatedAt: time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC)}
+	d.Digest.Add(40, 70, 70, 90)
+	if v, err := s.PutDigest(ctx, tenant, d, 0); err != nil || v != 1 {
+		t.Fatalf("put digest: version %d, err %v; want 1", v, err)
+	}
+	if _, err := s.PutDigest(ctx, tenant, d, 2); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale put digest: %v, want ErrVersionConflict", err)
+	}
+	got, err := s.GetDigest(ctx, tenant, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Version = 1
+	if !reflect.DeepEqual(got, d) {
+		t.Errorf("get digest:\n got %+v\nwant %+v", got, d)
+	}
+	// Digests live apart from ratings.
+	if _, err := s.GetRatings(ctx, tenant, "c"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ratings of a digested cohort: %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryDigests(t *testing.T) {
+	testDigests(t, NewMemory(), "t")
+}
+
+// testIdempotency runs the idempotency record contract against s.
+func testIdempotency(t *testing.T, s Store, tenant string) {
+	t.Helper()
+	ctx := context.Background()
+	pending := Idempotency{Key: "k", Request: "POST /rank abc", Expires: time.Now().Add(time.Minute).UTC().Truncate(time.Microsecond)}
+	if got, claimed, err := s.ClaimIdempotency(ctx, tenant, pending); err != nil || !claimed || !reflect.DeepEqual(got, pending) {
+		t.Fatalf("claim: %+v, %v, %v", got, claimed, err)
+	}
+	done := pending
+	done.Done, done.Status, done.Header, done.Body = true, 200, map[string][]string{"Content-Type": {"application/json"}}, []byte(`{"ok":true}`)
+	if err := s.PutIdempotency(ctx, tenant, done); err != nil {
+		t.Fatal(err)
+	}
+	retry := pending
+	retry.Request = "POST /rank def"
+	if got, claimed, err := s.ClaimIdempotency(ctx, tenant, retry); err != nil || claimed || !reflect.DeepEqual(got, done) {
+		t.Errorf("claim taken key:\n got %+v, %v, %v\nwant %+v", got, claimed, err, done)
+	}
+	// Keys are per tenant.
+	if _, claimed, err := s.ClaimIdempotency(ctx, tenant+"-other", pending); err != nil || !claimed {
+		t.Errorf("other tenant's claim: %v, %v", claimed, err)
+	}
+	if err := s.DeleteIdempotency(ctx, tenant, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, claimed, err := s.ClaimIdempotency(ctx, tenant, retry); err != nil || !claimed {
+		t.Errorf("claim deleted key: %v, %v", claimed, err)
+	}
+}
+
+func TestMemoryIdempotency(t *testing.T) {
+	m := NewMemory()
+	testIdempotency(t, m, "t")
+	// An expired record no longer holds its key.
+	ctx := context.Background()
+	rec := Idempotency{Key: "old", Expires: time.Now().Add(-time.Second)}
+	m.PutIdempotency(ctx, "t", rec)
+	if _, claimed, _ := m.ClaimIdempotency(ctx, "t", Idempotency{Key: "old", Expires: time.Now().Add(time.Minute)}); !claimed {
+		t.Error("expired key not claimed")
+	}
+}
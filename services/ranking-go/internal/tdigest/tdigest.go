@@ -0,0 +1,156 @@
+// Package tdigest is a merging t-digest (Dunning and Ertl): a compact
+// sketch of a score distribution that answers percentile queries
+// approximately, most accurately in the tails, in memory bounded by its
+// compression rather than by the number of scores.
+package tdigest
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultCompression keeps at most about 500 centroids, 8 KB of means and
+// weights, and puts percentiles within about 0.6 points at the median and
+// far closer in the tails.
+const DefaultCompression = 500
+
+// Centroid summarizes Weight scores by their mean.
+type Centroid struct {
+	Mean   float64 `json:"mean"`
+	Weight float64 `json:"weight"`
+}
+
+// Digest is a t-digest. Centroids are sorted by mean; a centroid at
+// quantile q holds at most about 2π√(q(1−q))/Compression of the scores,
+// so they are small in the tails and the sketch keeps at most about
+// Compression of them. Single scores are kept exactly.
+type Digest struct {
+	Compression float64    `json:"compression"`
+	Count       float64    `json:"count"`
+	Min         float64    `json:"min"`
+	Max         float64    `json:"max"`
+	Centroids   []Centroid `json:"centroids"`
+}
+
+// New returns an empty digest; compression <= 0 is DefaultCompression.
+func New(compression float64) *Digest {
+	if !(compression > 0) {
+		compression = DefaultCompression
+	}
+	return &Digest{Compression: compression}
+}
+
+// Add merges scores into the digest. Scores are finite; cost is
+// O((c + k) log(c + k)) for c centroids and k scores.
+func (d *Digest) Add(scores ...float64) {
+	if len(scores) == 0 {
+		return
+	}
+	all := make([]Centroid, 0, len(d.Centroids)+len(scores))
+	all = append(all, d.Centroids...)
+	if d.Count == 0 {
+		d.Min, d.Max = scores[0], scores[0]
+	}
+	for _, x := range scores {
+		all = append(all, Centroid{Mean: x, Weight: 1})
+		d.Min, d.Max = math.Min(d.Min, x), math.Max(d.Max, x)
+	}
+	d.Count += float64(len(scores))
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Mean < all[j].Mean })
+
+	// Greedily merge neighbours while a centroid spans at most one unit
+	// of the k1 scale, k(q) = δ/2π · asin(2q − 1).
+	k := func(q float64) float64 { return d.Compression / (2 * math.Pi) * math.Asin(2*q-1) }
+	out := make([]Centroid, 0, min(len(all), int(d.Compression)+1))
+	cur, before := all[0], 0.0
+	for _, c := range all[1:] {
+		if k((before+cur.Weight+c.Weight)/d.Count)-k(before/d.Count) <= 1 {
+			cur.Weight += c.Weight
+			cur.Mean += (c.Mean - cur.Mean) * c.Weight / cur.Weight
+			continue
+		}
+		out = append(out, cur)
+		before += cur.Weight
+		cur = c
+	}
+	d.Centroids = append(out, cur)
+}
+
+// CDF returns the estimated share of scores below x, scores equal to x
+// counting half, and the most the estimate can be off by when centroids
+// don't overlap: half the weight of each multi-score centroid next to x.
+// Between centroids it interpolates linearly. Both are 0 for an empty
+// digest.
+func (d *Digest) CDF(x float64) (share, bound float64) {
+	switch {
+	case d.Count == 0 || x < d.Min:
+		return 0, 0
+	case x > d.Max:
+		return 1, 0
+	}
+	spread := func(c Centroid) float64 {
+		if c.Weight > 1 {
+			return c.Weight / 2
+		}
+		return 0
+	}
+	before := 0.0
+	for i, c := range d.Centroids {
+		if c.Mean == x {
+			// Centroids at x, possibly several, count half.
+			at := 0.0
+			for _, e := range d.Centroids[i:] {
+				if e.Mean != x {
+					break
+				}
+				at += e.Weight
+			}
+			return (before + at/2) / d.Count, spread(Centroid{Weight: at}) / d.Count
+		}
+		if c.Mean > x {
+			// Interpolate from the previous centroid's centre, or Min, to
+			// this one's: a single score's weight sits at its mean, a
+			// centroid's spreads evenly either side of it.
+			lx, ly, lb := d.Min, 0.0, 0.0
+			if i > 0 {
+				p := d.Centroids[i-1]
+				lx, ly, lb = p.Mean, before-spread(p), spread(p)
+			}
+			rx, ry := c.Mean, before+spread(c)
+			y := ly + (ry-ly)*(x-lx)/(rx-lx)
+			return y / d.Count, (lb + spread(c)) / d.Count
+		}
+		before += c.Weight
+	}
+	// Between the last centroid's centre and Max.
+	p := d.Centroids[len(d.Centroids)-1]
+	lx, ly := p.Mean, d.Count-spread(p)
+	y := ly + (d.Count-ly)*(x-lx)/(d.Max-lx)
+	return y / d.Count, spread(p) / d.Count
+}
+
+// Quantile returns the estimated score at share q of the distribution,
+// interpolating between centroid centres, Min and Max. NaN for an empty
+// digest.
+func (d *Digest) Quantile(q float64) float64 {
+	if d.Count == 0 {
+		return math.NaN()
+	}
+	t := math.Max(0, math.Min(1, q)) * d.Count
+	lx, ly, before := d.Min, 0.0, 0.0
+	for _, c := range d.Centroids {
+		cx, cy := c.Mean, before+c.Weight/2
+		if t <= cy {
+			if cy == ly {
+				return cx
+			}
+			return lx + (cx-lx)*(t-ly)/(cy-ly)
+		}
+		lx, ly = cx, cy
+		before += c.Weight
+	}
+	if d.Count == ly {
+		return d.Max
+	}
+	return lx + (d.Max-lx)*(t-ly)/(d.Count-ly)
+}
@@ -0,0 +1,57 @@
+package tdigest
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestCDFExactForFewScores(t *testing.T) {
+	d := New(0)
+	d.Add(40, 70, 70, 90)
+	for _, c := range []struct{ x, want float64 }{
+		{30, 0}, {40, 0.125}, {50, 0.25}, {70, 0.5}, {80, 0.75}, {90, 0.875}, {95, 1},
+	} {
+		if got, bound := d.CDF(c.x); got != c.want || bound > 0.25 {
+			t.Errorf("CDF(%v) = %v ±%v, want %v", c.x, got, bound, c.want)
+		}
+	}
+	if q := d.Quantile(0.5); q != 70 {
+		t.Errorf("median %v, want 70", q)
+	}
+}
+
+func TestCDFWithinBound(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	d := New(100)
+	var all []float64
+	for batch := 0; batch < 20; batch++ {
+		xs := make([]float64, 5000)
+		for i := range xs {
+			xs[i] = 100 * rng.Float64() * rng.Float64() // skewed toward 0
+		}
+		d.Add(xs...)
+		all = append(all, xs...)
+	}
+	sort.Float64s(all)
+	if len(d.Centroids) > 100 || d.Count != float64(len(all)) {
+		t.Fatalf("%d centroids, count %v", len(d.Centroids), d.Count)
+	}
+	for _, x := range []float64{0.01, 1, 5, 25, 50, 75, 99} {
+		want := float64(sort.SearchFloat64s(all, x)) / float64(len(all))
+		got, bound := d.CDF(x)
+		if math.Abs(got-want) > bound+1e-4 {
+			t.Errorf("CDF(%v) = %v ±%v, exact %v", x, got, bound, want)
+		}
+		if bound > math.Pi/d.Compression {
+			t.Errorf("CDF(%v) bound %v", x, bound)
+		}
+	}
+	for _, q := range []float64{0.01, 0.5, 0.99} {
+		want := all[int(q*float64(len(all)))]
+		if got := d.Quantile(q); math.Abs(got-want) > 1 {
+			t.Errorf("Quantile(%v) = %v, exact %v", q, got, want)
+		}
+	}
+}
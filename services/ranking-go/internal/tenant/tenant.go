@@ -0,0 +1,153 @@
+package tenant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// Default is the tenant used when a request names none.
+const Default = "default"
+
+var (
+	// ErrUnauthorized means the request presented no usable credentials.
+	ErrUnauthorized = errors.New("tenant credentials required")
+	// ErrForbidden means the credentials don't grant the requested tenant.
+	ErrForbidden = errors.New("tenant not permitted")
+)
+
+// Tenant is one institution's configuration.
+type Tenant struct {
+	ID      string   `json:"id"`
+	APIKeys []string `json:"api_keys"`
+	// MaxItems caps items per rank request; 0 means unlimited.
+	MaxItems int `json:"max_items"`
+	// Profile names a set of ranking options in the config file, applied
+	// over the server defaults; Defaults are options applied over those.
+	// Both are decoded by package api.
+	Profile  string          `json:"profile,omitempty"`
+	Defaults json.RawMessage `json:"defaults,omitempty"`
+}
+
+// Registry maps API keys and tenant IDs to tenants.
+type Registry struct {
+	byID  map[string]*Tenant
+	byKey map[string]*Tenant
+}
+
+// NewRegistry indexes tenants, rejecting duplicate IDs or keys.
+func NewRegistry(tenants []Tenant) (*Registry, error) {
+	r := &Registry{byID: map[string]*Tenant{}, byKey: map[string]*Tenant{}}
+	for i := range tenants {
+		t := &tenants[i]
+		if t.ID == "" {
+			return nil, fmt.Errorf("tenant %d: empty id", i)
+		}
+		if _, dup := r.byID[t.ID]; dup {
+			return nil, fmt.Errorf("tenant %q: duplicate id", t.ID)
+		}
+		r.byID[t.ID] = t
+		for _, k := range t.APIKeys {
+			if _, dup := r.byKey[k]; dup {
+				return nil, fmt.Errorf("tenant %q: api key already assigned", t.ID)
+			}
+			r.byKey[k] = t
+		}
+	}
+	return r, nil
+}
+
+// All returns every tenant, by ID. A nil Registry has none.
+func (r *Registry) All() []Tenant {
+	if r == nil {
+		return nil
+	}
+	out := make([]Tenant, 0, len(r.byID))
+	for _, t := range r.byID {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// LoadFile reads a JSON array of tenants.
+func LoadFile(path string) (*Registry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants []Tenant
+	if err := json.Unmarshal(b, &tenants); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewRegistry(tenants)
+}
+
+// Lookup returns the tenant with id for a caller already authenticated
+// some other way, bypassing its API keys. A nil Registry knows every id.
+func (r *Registry) Lookup(id string) (*Tenant, error) {
+	if r == nil {
+		return &Tenant{ID: id}, nil
+	}
+	t, ok := r.byID[id]
+	if !ok {
+		return nil, ErrForbidden
+	}
+	return t, nil
+}
+
+// ByKey returns the tenant an API key belongs to, if any. A nil Registry
+// knows no keys.
+func (r *Registry) ByKey(key string) (*Tenant, bool) {
+	if r == nil {
+		return nil, false
+	}
+	t, ok := r.byKey[key]
+	return t, ok
+}
+
+// Resolve picks the request's tenant from X-API-Key and X-Tenant.
+//
+// A nil Registry trusts X-Tenant as-is (e.g. set by the gateway), falling back
+// to Default. Otherwise an API key selects its tenant and X-Tenant, if sent,
+// must agree; X-Tenant alone is accepted only for tenants without API keys.
+func (r *Registry) Resolve(req *http.Request) (*Tenant, error) {
+	return r.ResolveKey(req.Header.Get("X-API-Key"), req.Header.Get("X-Tenant"))
+}
+
+// ResolveKey is Resolve given the API key and tenant name sent, either
+// possibly empty.
+func (r *Registry) ResolveKey(key, name string) (*Tenant, error) {
+	if r == nil {
+		if name == "" {
+			name = Default
+		}
+		return &Tenant{ID: name}, nil
+	}
+
+	if key != "" {
+		t, ok := r.byKey[key]
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		if name != "" && name != t.ID {
+			return nil, ErrForbidden
+		}
+		return t, nil
+	}
+
+	if name == "" {
+		name = Default
+	}
+	t, ok := r.byID[name]
+	if !ok {
+		return nil, ErrForbidden
+	}
+	if len(t.APIKeys) > 0 {
+		return nil, ErrUnauthorized
+	}
+	return t, nil
+}
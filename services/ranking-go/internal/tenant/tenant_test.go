@@ -0,0 +1,102 @@
+package tenant
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewRegistryRejectsDuplicates(t *testing.T) {
+	if _, err := NewRegistry([]Tenant{{ID: "a"}, {ID: "a"}}); err == nil {
+		t.Error("duplicate id: expected error")
+	}
+	if _, err := NewRegistry([]Tenant{{ID: "a", APIKeys: []string{"k"}}, {ID: "b", APIKeys: []string{"k"}}}); err == nil {
+		t.Error("shared api key: expected error")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	reg, err := NewRegistry([]Tenant{
+		{ID: "a", APIKeys: []string{"key-a"}},
+		{ID: "open"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name, key, tenant, want string
+		err                     error
+	}{
+		{name: "key", key: "key-a", want: "a"},
+		{name: "key and matching header", key: "key-a", tenant: "a", want: "a"},
+		{name: "key and other header", key: "key-a", tenant: "open", err: ErrForbidden},
+		{name: "unknown key", key: "nope", err: ErrUnauthorized},
+		{name: "header for keyless tenant", tenant: "open", want: "open"},
+		{name: "header for keyed tenant", tenant: "a", err: ErrUnauthorized},
+		{name: "unknown tenant", tenant: "zzz", err: ErrForbidden},
+		{name: "no default tenant", err: ErrForbidden},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		if c.key != "" {
+			req.Header.Set("X-API-Key", c.key)
+		}
+		if c.tenant != "" {
+			req.Header.Set("X-Tenant", c.tenant)
+		}
+		got, err := reg.Resolve(req)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: err %v, want %v", c.name, err, c.err)
+			continue
+		}
+		if err == nil && got.ID != c.want {
+			t.Errorf("%s: tenant %q, want %q", c.name, got.ID, c.want)
+		}
+	}
+}
+
+func TestResolveNilRegistryTrustsHeader(t *testing.T) {
+	var reg *Registry
+	req := httptest.NewRequest("GET", "/", nil)
+	if got, _ := reg.Resolve(req); got.ID != Default {
+		t.Errorf("got %q, want %q", got.ID, Default)
+	}
+	req.Header.Set("X-Tenant", "x")
+	if got, _ := reg.Resolve(req); got.ID != "x" {
+		t.Errorf("got %q, want x", got.ID)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	r, err := NewRegistry([]Tenant{{ID: "a", APIKeys: []string{"ka"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.Lookup("a"); err != nil || got.ID != "a" {
+		t.Fatalf("Lookup(a) = %v, %v", got, err)
+	}
+	if _, err := r.Lookup("b"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("Lookup(b) err = %v, want ErrForbidden", err)
+	}
+	var none *Registry
+	if got, err := none.Lookup("b"); err != nil || got.ID != "b" {
+		t.Fatalf("nil Lookup(b) = %v, %v", got, err)
+	}
+}
+
+func TestByKey(t *testing.T) {
+	r, err := NewRegistry([]Tenant{{ID: "a", APIKeys: []string{"ka"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := r.ByKey("ka"); !ok || got.ID != "a" {
+		t.Fatalf("ByKey(ka) = %v, %v", got, ok)
+	}
+	if _, ok := r.ByKey("kb"); ok {
+		t.Fatal("ByKey(kb) found a tenant")
+	}
+	var none *Registry
+	if _, ok := none.ByKey("ka"); ok {
+		t.Fatal("nil ByKey(ka) found a tenant")
+	}
+}
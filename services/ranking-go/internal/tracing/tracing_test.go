@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const h = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(h)
+	if !ok || !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("got %+v, %v", sc, ok)
+	}
+	if sc.Traceparent() != h {
+		t.Errorf("round trip %q", sc.Traceparent())
+	}
+	if sc, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok || sc.Sampled {
+		t.Errorf("future version: %+v, %v", sc, ok)
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("%q: expected rejection", bad)
+		}
+	}
+}
+
+// collector is a fake OTLP/HTTP endpoint.
+type collector struct {
+	mu    sync.Mutex
+	spans []otlpSpan
+	attrs []otlpKeyValue
+	hdr   http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req otlpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hdr = r.Header
+	for _, rs := range req.ResourceSpans {
+		c.attrs = rs.Resource.Attributes
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+}
+
+func TestTracerExportsSpans(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	tr := NewTracer(NewExporter(srv.URL+"/v1/traces", "svc", map[string]string{"Authorization": "Bearer x"}, nil))
+
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := tr.Start(ContextWithSpanContext(context.Background(), parent), "POST /rank", KindServer, Attr{"http.route", "POST /rank"})
+	_, child := tr.Start(ctx, "rank.Rank", KindInternal, Attr{"ranking.cohort_size", 3})
+	child.SetError(errors.New("boom"))
+	child.End()
+	root.End()
+
+	// Unsampled traces are propagated but not exported.
+	unsampled, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, skipped := tr.Start(ContextWithSpanContext(context.Background(), unsampled), "GET /health", KindServer)
+	skipped.End()
+
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.spans) != 2 {
+		t.Fatalf("got %d spans", len(c.spans))
+	}
+	ch, rt := c.spans[0], c.spans[1]
+	if rt.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || rt.ParentSpanID != "00f067aa0ba902b7" || rt.Kind != KindServer {
+		t.Errorf("root %+v", rt)
+	}
+	if ch.TraceID != rt.TraceID || ch.ParentSpanID != rt.SpanID || ch.Status == nil || ch.Status.Message != "boom" {
+		t.Errorf("child %+v", ch)
+	}
+	if v := ch.Attributes[0].Value.IntValue; v == nil || *v != "3" {
+		t.Errorf("cohort size attribute %+v", ch.Attributes)
+	}
+	if len(c.attrs) != 1 || *c.attrs[0].Value.StringValue != "svc" {
+		t.Errorf("resource %+v", c.attrs)
+	}
+	if c.hdr.Get("Authorization") != "Bearer x" {
+		t.Errorf("headers %v", c.hdr)
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tr *Tracer
+	ctx, span := tr.Start(context.Background(), "x", KindInternal)
+	span.SetAttributes(Attr{"k", "v"})
+	span.SetError(errors.New("e"))
+	span.End()
+	if SpanContextFrom(ctx).IsValid() {
+		t.Error("nil tracer must not start a trace")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if tr, err := FromEnv(); tr != nil || err != nil {
+		t.Errorf("no endpoint: %v, %v", tr, err)
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318/")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected error for grpc protocol")
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=a%20b")
+	tr, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Shutdown(context.Background())
+	if e := tr.exporter; e.endpoint != "http://collector:4318/v1/traces" || e.headers["api-key"] != "a b" || e.service != "ranking-go" {
+		t.Errorf("exporter %+v", e)
+	}
+}
@@ -0,0 +1,358 @@
+// Package websocket is the part of RFC 6455 the live leaderboard needs:
+// the server handshake, text messages, ping/pong and the closing
+// handshake, without extensions or subprotocols. Dial is the matching
+// client, for tests and tools.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Opcodes.
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// Close codes.
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseMessageTooBig = 1009
+	CloseTryAgainLater = 1013
+	closeNoStatus      = 1005
+)
+
+const (
+	acceptGUID          = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	maxControlPayload   = 125
+	defaultMaxMessage   = 64 << 10
+	defaultWriteTimeout = 10 * time.Second
+)
+
+// ErrClosed is returned by ReadMessage once the peer has closed the
+// connection.
+var ErrClosed = errors.New("websocket: closed")
+
+// HandshakeError is a request that is not a valid WebSocket upgrade.
+type HandshakeError struct{ msg string }
+
+func (e HandshakeError) Error() string { return "websocket: " + e.msg }
+
+// Conn is one WebSocket connection. ReadMessage must be called from one
+// goroutine at a time; writes may come from any.
+type Conn struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	client bool
+
+	// MaxMessage bounds a message read; a larger one closes the
+	// connection with CloseMessageTooBig.
+	MaxMessage int64
+	// WriteTimeout bounds each frame written.
+	WriteTimeout time.Duration
+
+	wmu    sync.Mutex
+	closed bool
+}
+
+func newConn(c net.Conn, br *bufio.Reader, client bool) *Conn {
+	return &Conn{conn: c, br: br, client: client, MaxMessage: defaultMaxMessage, WriteTimeout: defaultWriteTimeout}
+}
+
+// Upgrade checks r is a WebSocket opening handshake, answers it and takes
+// over the connection. On a HandshakeError nothing has been written, so
+// the caller can still respond with an error.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	switch {
+	case r.Method != http.MethodGet:
+		return nil, HandshakeError{"method must be GET"}
+	case !headerHas(r.Header, "Connection", "upgrade"):
+		return nil, HandshakeError{"Connection header must include upgrade"}
+	case !headerHas(r.Header, "Upgrade", "websocket"):
+		return nil, HandshakeError{"Upgrade header must be websocket"}
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		return nil, HandshakeError{"Sec-WebSocket-Version must be 13"}
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return nil, HandshakeError{"invalid Sec-WebSocket-Key"}
+	}
+	c, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+	// Hijacking keeps the server's deadlines; the connection sets its own.
+	c.SetDeadline(time.Time{})
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+	return newConn(c, brw.Reader, false), nil
+}
+
+// Dial opens a client connection to a ws:// URL.
+func Dial(ctx context.Context, rawURL string, header http.Header) (*Conn, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req := &http.Request{Method: http.MethodGet, URL: u, Host: u.Host, Header: http.Header{}}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if err := req.Write(c); err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	br := bufio.NewReader(c)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		c.Close()
+		return nil, resp, fmt.Errorf("websocket: handshake failed with status %d", resp.StatusCode)
+	}
+	return newConn(c, br, true), resp, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerHas reports whether the comma-separated header name lists token,
+// ignoring case.
+func headerHas(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteText sends data as one text message.
+func (c *Conn) WriteText(data []byte) error {
+	return c.writeFrame(OpText, data)
+}
+
+// Ping sends a ping; the peer's pong is consumed by ReadMessage.
+func (c *Conn) Ping() error {
+	return c.writeFrame(OpPing, nil)
+}
+
+// Close sends a close frame with code and reason, then closes the
+// connection without waiting for the peer's reply.
+func (c *Conn) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+	}
+	err := c.writeFrame(OpClose, payload)
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if op == OpClose {
+		c.closed = true
+	}
+	hdr := make([]byte, 2, 14)
+	hdr[0] = 0x80 | op
+	switch n := len(payload); {
+	case n <= 125:
+		hdr[1] = byte(n)
+	case n <= 0xFFFF:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	if c.client {
+		// Client frames are masked (RFC 6455 section 5.3).
+		hdr[1] |= 0x80
+		mask := make([]byte, 4)
+		rand.Read(mask)
+		hdr = append(hdr, mask...)
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ mask[i%4]
+		}
+		payload = masked
+	}
+	if c.WriteTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.WriteTimeout))
+	}
+	_, err := (&net.Buffers{hdr, payload}).WriteTo(c.conn)
+	return err
+}
+
+// ReadMessage returns the next text or binary message, answering pings
+// and reassembling fragments on the way. When the peer closes, it replies
+// and returns ErrClosed; a protocol violation closes the connection too.
+func (c *Conn) ReadMessage() (op byte, data []byte, err error) {
+	var msg []byte
+	msgOp := byte(0)
+	for {
+		fin, fop, payload, err := c.readFrame()
+		if ce, ok := err.(closeError); ok {
+			return 0, nil, c.fail(ce)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		switch fop {
+		case OpPing:
+			if err := c.writeFrame(OpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			code := closeNoStatus
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			if code == closeNoStatus {
+				code = CloseNormal
+			}
+			c.Close(code, "")
+			return 0, nil, ErrClosed
+		case OpText, OpBinary:
+			if msgOp != 0 {
+				return 0, nil, c.fail(closeError{CloseProtocolError, "expected a continuation frame"})
+			}
+			msgOp = fop
+		case OpContinuation:
+			if msgOp == 0 {
+				return 0, nil, c.fail(closeError{CloseProtocolError, "unexpected continuation frame"})
+			}
+		default:
+			return 0, nil, c.fail(closeError{CloseProtocolError, "unknown opcode"})
+		}
+		if int64(len(msg)+len(payload)) > c.MaxMessage {
+			return 0, nil, c.fail(closeError{CloseMessageTooBig, "message too big"})
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msgOp, msg, nil
+		}
+	}
+}
+
+// closeError is a protocol violation that ends the connection with code.
+type closeError struct {
+	code   int
+	reason string
+}
+
+func (e closeError) Error() string { return fmt.Sprintf("websocket: %s (close %d)", e.reason, e.code) }
+
+// fail closes the connection for the violation e and returns it.
+func (c *Conn) fail(e closeError) error {
+	c.Close(e.code, e.reason)
+	return e
+}
+
+func (c *Conn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = hdr[0]&0x80 != 0, hdr[0]&0x0F
+	if hdr[0]&0x70 != 0 {
+		return false, 0, nil, closeError{CloseProtocolError, "reserved bits set"}
+	}
+	masked := hdr[1]&0x80 != 0
+	if masked == c.client {
+		return false, 0, nil, closeError{CloseProtocolError, "wrong masking"}
+	}
+	n := int64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = int64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = int64(binary.BigEndian.Uint64(b[:]) & (1<<63 - 1))
+	}
+	if op >= OpClose && (n > maxControlPayload || !fin) {
+		return false, 0, nil, closeError{CloseProtocolError, "invalid control frame"}
+	}
+	if n > c.MaxMessage {
+		return false, 0, nil, closeError{CloseMessageTooBig, "message too big"}
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
@@ -0,0 +1,147 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoServer echoes every text message back until the client closes.
+func echoServer(t *testing.T, maxMessage int64) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if maxMessage > 0 {
+			c.MaxMessage = maxMessage
+		}
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteText(msg); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func dial(t *testing.T, ts *httptest.Server) *Conn {
+	t.Helper()
+	c, _, err := Dial(context.Background(), "ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEcho(t *testing.T) {
+	c := dial(t, echoServer(t, 1<<20))
+	c.MaxMessage = 1 << 20
+	for _, msg := range []string{"", "hello", strings.Repeat("x", 200), strings.Repeat("y", 70000)} {
+		if err := c.WriteText([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		op, got, err := c.ReadMessage()
+		if err != nil || op != OpText || string(got) != msg {
+			t.Fatalf("echo of %d bytes: op %d, %d bytes, %v", len(msg), op, len(got), err)
+		}
+	}
+	// A ping is answered and the pong consumed before the next message.
+	if err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	c.WriteText([]byte("after ping"))
+	if _, got, err := c.ReadMessage(); err != nil || string(got) != "after ping" {
+		t.Fatalf("after ping: %q %v", got, err)
+	}
+	if err := c.Close(CloseNormal, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFragmentsAndLimits(t *testing.T) {
+	c := dial(t, echoServer(t, 8))
+	// "hel" + "lo" as two frames with a ping between them, zero-masked.
+	writeRaw := func(fin bool, op byte, payload string) {
+		t.Helper()
+		b := op
+		if fin {
+			b |= 0x80
+		}
+		frame := []byte{b, 0x80 | byte(len(payload)), 0, 0, 0, 0}
+		frame = append(frame, payload...)
+		if _, err := c.conn.Write(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeRaw(false, OpText, "hel")
+	writeRaw(true, OpPing, "")
+	writeRaw(true, OpContinuation, "lo")
+	if _, got, err := c.ReadMessage(); err != nil || string(got) != "hello" {
+		t.Fatalf("reassembled %q %v", got, err)
+	}
+
+	// Over MaxMessage closes the connection with 1009.
+	c.WriteText([]byte("too long for eight"))
+	_, _, err := c.ReadMessage()
+	if !errors.Is(err, ErrClosed) {
+		t.Fatalf("got %v, want the server to close", err)
+	}
+}
+
+func TestServerRejectsUnmaskedFrames(t *testing.T) {
+	ts := echoServer(t, 0)
+	c := dial(t, ts)
+	c.client = false // send unmasked frames
+	c.WriteText([]byte("hi"))
+	c.client = true
+	if _, _, err := c.ReadMessage(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got %v, want the server to close", err)
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	ts := echoServer(t, 0)
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", resp.StatusCode)
+	}
+
+	// A wrong version is refused before the connection is taken over.
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 8\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+	resp, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("version 8: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// The example from RFC 6455 section 1.3.
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("got %q", got)
+	}
+}
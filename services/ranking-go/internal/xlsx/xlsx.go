@@ -0,0 +1,237 @@
+// Package xlsx writes single-sheet Office Open XML (.xlsx) workbooks, the
+// format Excel and other spreadsheets open natively. Rows are streamed
+// into the zip as they are written, so a large sheet is never held in
+// memory; strings are stored inline rather than in a shared table for the
+// same reason.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of an .xlsx file.
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Format is a column's number format.
+type Format int
+
+const (
+	General  Format = iota
+	Integer         // 0
+	Decimal2        // 0.00
+)
+
+// Column describes one column of the sheet.
+type Column struct {
+	Header string
+	// Width is in characters; 0 leaves the spreadsheet's default.
+	Width  float64
+	Format Format
+}
+
+// Writer writes one sheet: a bold, frozen header row with a filter, then
+// the rows given to WriteRow. Close must be called to finish the file.
+type Writer struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	name  string
+	cols  []Column
+	rows  int
+}
+
+// NewWriter starts a workbook on w whose sheet is named name (cleaned of
+// characters spreadsheets reject) with cols.
+func NewWriter(w io.Writer, name string, cols []Column) (*Writer, error) {
+	x := &Writer{zw: zip.NewWriter(w), name: sheetName(name), cols: cols}
+	f, err := x.zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x.sheet = bufio.NewWriter(f)
+	x.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	x.sheet.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	var widths strings.Builder
+	for i, c := range cols {
+		if c.Width > 0 {
+			fmt.Fprintf(&widths, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, c.Width)
+		}
+	}
+	if widths.Len() > 0 {
+		x.sheet.WriteString(`<cols>` + widths.String() + `</cols>`)
+	}
+	x.sheet.WriteString(`<sheetData>`)
+	header := make([]any, len(cols))
+	for i, c := range cols {
+		header[i] = c.Header
+	}
+	x.writeRow(header, true)
+	return x, nil
+}
+
+// WriteRow appends a row. Cells are strings, ints or float64s in column
+// order; nil, or a NaN or infinite number, leaves a cell empty. Errors
+// writing to the underlying writer are reported by Close.
+func (x *Writer) WriteRow(cells ...any) error {
+	if len(cells) > len(x.cols) {
+		return fmt.Errorf("xlsx: row has %d cells for %d columns", len(cells), len(x.cols))
+	}
+	x.writeRow(cells, false)
+	return nil
+}
+
+func (x *Writer) writeRow(cells []any, header bool) {
+	x.rows++
+	fmt.Fprintf(x.sheet, `<row r="%d">`, x.rows)
+	for i, v := range cells {
+		ref := cellRef(i, x.rows)
+		style := styleHeader
+		if !header {
+			style = styleFor(x.cols[i].Format)
+		}
+		switch v := v.(type) {
+		case string:
+			fmt.Fprintf(x.sheet, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, ref, style)
+			xml.EscapeText(x.sheet, []byte(v))
+			x.sheet.WriteString(`</t></is></c>`)
+		case int:
+			fmt.Fprintf(x.sheet, `<c r="%s" s="%d"><v>%d</v></c>`, ref, style, v)
+		case float64:
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				fmt.Fprintf(x.sheet, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, strconv.FormatFloat(v, 'g', -1, 64))
+			}
+		}
+	}
+	x.sheet.WriteString(`</row>`)
+}
+
+// Close finishes the sheet and writes the rest of the workbook. It does
+// not close the underlying writer.
+func (x *Writer) Close() error {
+	lastCol := colName(len(x.cols) - 1)
+	fmt.Fprintf(x.sheet, `</sheetData><autoFilter ref="A1:%s%d"/></worksheet>`, lastCol, x.rows)
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+		{"xl/styles.xml", styles},
+		{"xl/workbook.xml", fmt.Sprintf(workbook, escape(x.name), escape(strings.ReplaceAll(x.name, "'", "''")), lastCol, x.rows)},
+	}
+	for _, p := range parts {
+		f, err := x.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return err
+		}
+	}
+	return x.zw.Close()
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// cellRef names the cell at 0-based column col and 1-based row, e.g. "B3".
+func cellRef(col, row int) string {
+	return colName(col) + strconv.Itoa(row)
+}
+
+// colName names 0-based column col: A to Z, then AA.
+func colName(col int) string {
+	var b []byte
+	for col++; col > 0; col = (col - 1) / 26 {
+		b = append([]byte{byte('A' + (col-1)%26)}, b...)
+	}
+	return string(b)
+}
+
+// sheetName makes name a valid sheet name: at most 31 characters, none of
+// []:*?/\, not starting or ending with an apostrophe, and not empty.
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	if r := []rune(strings.Trim(name, "'")); len(r) > 31 {
+		name = strings.TrimRight(string(r[:31]), "'")
+	} else {
+		name = string(r)
+	}
+	if name == "" {
+		return "Sheet1"
+	}
+	return name
+}
+
+// Indexes into styles' cellXfs.
+const (
+	styleGeneral = iota
+	styleHeader
+	styleInteger
+	styleDecimal2
+)
+
+func styleFor(f Format) int {
+	switch f {
+	case Integer:
+		return styleInteger
+	case Decimal2:
+		return styleDecimal2
+	}
+	return styleGeneral
+}
+
+const contentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// workbook takes the sheet name, escaped for XML, then quoted for a
+// formula, and the filter's last column and row.
+const workbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`<definedNames><definedName name="_xlnm._FilterDatabase" localSheetId="0" hidden="1">'%s'!$A$1:$%s$%d</definedName></definedNames>` +
+	`</workbook>`
+
+// styles defines the cellXfs above, using the built-in number formats 1
+// ("0") and 2 ("0.00").
+const styles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="1" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="2" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
@@ -0,0 +1,119 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+type sheetXML struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Style  int    `xml:"s,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+	Filter struct {
+		Ref string `xml:"ref,attr"`
+	} `xml:"autoFilter"`
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "Mock: exam 1/2", []Column{
+		{Header: "rank", Format: Integer}, {Header: "user", Width: 20}, {Header: "percent", Format: Decimal2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteRow(1, "a<b> & ' c ", 91.5)
+	w.WriteRow(2, "d", math.NaN())
+	if err := w.WriteRow(3, "e", 1.0, "extra"); err == nil {
+		t.Error("row with too many cells accepted")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = b
+		// Every part is well-formed XML.
+		for dec := xml.NewDecoder(bytes.NewReader(b)); ; {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if parts[name] == nil {
+			t.Errorf("missing %s", name)
+		}
+	}
+	if wb := string(parts["xl/workbook.xml"]); !strings.Contains(wb, `name="Mock_ exam 1_2"`) || !strings.Contains(wb, `$A$1:$C$3`) {
+		t.Errorf("workbook.xml: %s", wb)
+	}
+
+	var sheet sheetXML
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	if len(sheet.Rows) != 3 || sheet.Filter.Ref != "A1:C3" {
+		t.Fatalf("got %+v", sheet)
+	}
+	header, first, second := sheet.Rows[0], sheet.Rows[1], sheet.Rows[2]
+	if header.Cells[2].Inline != "percent" || header.Cells[2].Style != styleHeader {
+		t.Errorf("header: %+v", header)
+	}
+	if c := first.Cells; c[0].Value != "1" || c[0].Style != styleInteger || c[1].Inline != "a<b> & ' c " || c[1].Type != "inlineStr" || c[2].Ref != "C2" || c[2].Value != "91.5" || c[2].Style != styleDecimal2 {
+		t.Errorf("first row: %+v", first)
+	}
+	if len(second.Cells) != 2 {
+		t.Errorf("NaN cell written: %+v", second)
+	}
+}
+
+func TestCellRef(t *testing.T) {
+	for _, c := range []struct {
+		col, row int
+		want     string
+	}{{0, 1, "A1"}, {25, 2, "Z2"}, {26, 3, "AA3"}, {27, 1, "AB1"}, {701, 1, "ZZ1"}, {702, 1, "AAA1"}} {
+		if got := cellRef(c.col, c.row); got != c.want {
+			t.Errorf("cellRef(%d, %d) = %s, want %s", c.col, c.row, got, c.want)
+		}
+	}
+}
+
+func TestSheetName(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                      "Sheet1",
+		"''":                    "Sheet1",
+		"'quoted'":              "quoted",
+		"a[b]*?":                "a_b___",
+		strings.Repeat("x", 40): strings.Repeat("x", 31),
+	} {
+		if got := sheetName(in); got != want {
+			t.Errorf("sheetName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}